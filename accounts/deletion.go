@@ -0,0 +1,208 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/events"
+	"api/storage"
+
+	"gorm.io/gorm"
+)
+
+// PurgeJob nombre del trabajo periódico que anonimiza las cuentas vencidas
+const PurgeJob = "accounts.purge"
+
+// Cleanup elimina los datos relacionados con el usuario dentro de la transacción.
+// Los objetos del almacenamiento no se borran directamente sino a través de
+// files, para que solo desaparezcan si la transacción se confirma.
+type Cleanup func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error
+
+// Files objetos del almacenamiento pendientes de borrar tras la transacción
+type Files struct {
+	keys []string
+}
+
+// Delete programa el borrado del objeto (las claves vacías se ignoran)
+func (f *Files) Delete(key string) {
+	if key != "" {
+		f.keys = append(f.keys, key)
+	}
+}
+
+var (
+	mu       sync.RWMutex
+	cleanups = map[string]Cleanup{}
+)
+
+// RegisterCleanup añade un paso de borrado en cascada. Cada subsistema que
+// guarde datos asociados al usuario debe registrar el suyo.
+func RegisterCleanup(name string, fn Cleanup) {
+	mu.Lock()
+	defer mu.Unlock()
+	cleanups[name] = fn
+}
+
+func init() {
+	RegisterCleanup("uploads", func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error {
+		var sessions []database.UploadSession
+		if err := tx.Where("user_id = ?", userID).Find(&sessions).Error; err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			for n := 1; n <= s.TotalParts; n++ {
+				files.Delete(storage.PartKey(s.ID, n))
+			}
+			files.Delete(s.ObjectKey)
+			if err := tx.Where("session_id = ?", s.ID).Delete(&database.UploadPart{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&database.UploadSession{}).Error; err != nil {
+			return err
+		}
+
+		var direct []database.DirectUpload
+		if err := tx.Where("user_id = ?", userID).Find(&direct).Error; err != nil {
+			return err
+		}
+		for _, d := range direct {
+			files.Delete(d.ObjectKey)
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.DirectUpload{}).Error
+	})
+	RegisterCleanup("login_history", func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&database.LoginChallenge{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&database.MagicLink{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.LoginEvent{}).Error
+	})
+	RegisterCleanup("devices", func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&database.Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.Device{}).Error
+	})
+	RegisterCleanup("api_usage", func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error {
+		return tx.Where("user_id = ?", userID).Delete(&database.UserUsage{}).Error
+	})
+	RegisterCleanup("api_keys", func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error {
+		keys := tx.Model(&database.APIKey{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("api_key_id IN (?)", keys).Delete(&database.APIKeyUsage{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.APIKey{}).Error
+	})
+	RegisterCleanup("quotas", func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error {
+		if err := tx.Where("scope = ? AND scope_id = ?", "user", userID).Delete(&database.QuotaCounter{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("scope = ? AND scope_id = ?", "user", userID).Delete(&database.Quota{}).Error
+	})
+	RegisterCleanup("exports", func(ctx context.Context, tx *gorm.DB, userID uint, files *Files) error {
+		var list []database.DataExport
+		if err := tx.Where("user_id = ?", userID).Find(&list).Error; err != nil {
+			return err
+		}
+		for _, e := range list {
+			files.Delete(e.ObjectKey)
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.DataExport{}).Error
+	})
+}
+
+// DeletionGracePeriod plazo entre la solicitud de borrado y la anonimización
+func DeletionGracePeriod() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE")); err == nil && d >= 0 {
+		return d
+	}
+	return 30 * 24 * time.Hour
+}
+
+// CancelOnLogin indica si iniciar sesión durante el plazo cancela el borrado
+func CancelOnLogin() bool {
+	return os.Getenv("ACCOUNT_DELETION_CANCEL_ON_LOGIN") != "false"
+}
+
+// Purge anonimiza todas las cuentas cuyo plazo de borrado ha vencido
+func Purge(ctx context.Context, _ []byte) error {
+	var users []database.User
+	if err := database.DB.WithContext(ctx).Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ? AND anonymized_at IS NULL", clock.Now()).
+		Find(&users).Error; err != nil {
+		return err
+	}
+
+	for i := range users {
+		if err := Anonymize(ctx, &users[i]); err != nil {
+			log.Printf("❌ Error anonimizando el usuario %d: %v", users[i].ID, err)
+			continue
+		}
+		log.Printf("🧹 Usuario %d anonimizado", users[i].ID)
+	}
+	return nil
+}
+
+// Anonymize reemplaza los datos personales del usuario y elimina en cascada
+// sus datos relacionados. La fila se conserva para mantener la integridad
+// referencial, pero ya no identifica a nadie. Los archivos se borran solo
+// después de confirmar la transacción: si se deshace, siguen existiendo.
+func Anonymize(ctx context.Context, user *database.User) error {
+	files := &Files{}
+	files.Delete(user.AvatarKey)
+	files.Delete(user.AvatarThumbKey)
+	files.Delete(user.AvatarMediumKey)
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		mu.RLock()
+		defer mu.RUnlock()
+		for name, fn := range cleanups {
+			if err := fn(ctx, tx, user.ID, files); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		now := clock.Now()
+		return tx.Model(user).Updates(map[string]interface{}{
+			"email":              fmt.Sprintf("deleted-%d@anonymized.invalid", user.ID),
+			"name":               "Usuario eliminado",
+			"username":           nil,
+			"password":           "",
+			"is_active":          false,
+			"avatar_key":         "",
+			"avatar_thumb_key":   "",
+			"avatar_medium_key":  "",
+			"avatar_status":      "",
+			"stripe_customer_id": "",
+			"metadata":           nil,
+			"anonymized_at":      now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	events.Publish(ctx, events.Event{Type: events.UserDeleted, UserID: user.ID})
+
+	for _, key := range files.keys {
+		if err := storage.Default.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			log.Printf("⚠️  No se pudo borrar %s del usuario %d: %v", key, user.ID, err)
+		}
+	}
+	return nil
+}
+
+// RevokeAPIKeys revoca todas las claves de API activas del usuario
+func RevokeAPIKeys(ctx context.Context, userID uint) error {
+	return database.DB.WithContext(ctx).Model(&database.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", clock.Now()).Error
+}
@@ -0,0 +1,210 @@
+// Package apitest levanta el router completo de la API sobre una base de datos
+// SQLite en memoria para probar los handlers de punta a punta:
+//
+//	srv := apitest.New(t)
+//	user := srv.CreateUser(t, "user")
+//	res := srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token))
+//
+// La base de datos es global (database.DB), así que las pruebas que usan el
+// harness no deben ejecutarse en paralelo.
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api/auth"
+	"api/config"
+	"api/database"
+	"api/encryption"
+	"api/mail"
+	"api/plans"
+	"api/routes"
+	"api/services"
+	"api/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Password contraseña de los usuarios creados con CreateUser
+const Password = "secret123"
+
+var (
+	databases atomic.Int64
+	users     atomic.Int64
+)
+
+// Server router de la API listo para recibir peticiones
+type Server struct {
+	Router *gin.Engine
+}
+
+// User usuario de prueba con su token de acceso
+type User struct {
+	*database.User
+	Token string
+}
+
+// Response respuesta de una petición al router
+type Response struct {
+	*httptest.ResponseRecorder
+}
+
+// RequestOption modifica la petición antes de enviarla
+type RequestOption func(*http.Request)
+
+// New inicializa una base de datos vacía (con los planes predefinidos), el
+// almacenamiento en un directorio temporal y el router con todo su middleware
+func New(t testing.TB) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	// Cada servidor tiene su propia base de datos en memoria; la caché compartida
+	// la mantiene viva mientras el pool tenga alguna conexión abierta
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DB_NAME", fmt.Sprintf("file:apitest%d?mode=memory&cache=shared", databases.Add(1)))
+	t.Setenv("JWT_SECRET", "apitest-secret")
+	t.Setenv("STORAGE_DRIVER", "local")
+	t.Setenv("STORAGE_LOCAL_PATH", t.TempDir())
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("STRIPE_SECRET_KEY", "")
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("CAPTCHA_PROVIDER", "")
+	t.Setenv("CAPTCHA_VERIFY_URL", "")
+	t.Setenv("IP_BAN_ENABLED", "false")
+
+	if err := auth.Init(); err != nil {
+		t.Fatalf("auth.Init: %v", err)
+	}
+	t.Setenv("ENCRYPTION_KEYS", "")
+	if err := encryption.Init(); err != nil {
+		t.Fatalf("encryption.Init: %v", err)
+	}
+	if err := database.InitDB(); err != nil {
+		t.Fatalf("database.InitDB: %v", err)
+	}
+	database.DB = database.DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := plans.Seed(context.Background()); err != nil {
+		t.Fatalf("plans.Seed: %v", err)
+	}
+	if err := storage.InitStorage(); err != nil {
+		t.Fatalf("storage.InitStorage: %v", err)
+	}
+	mail.InitMailer()
+
+	router := gin.New()
+	config.SetupMiddleware(router)
+	routes.SetupRoutes(router)
+	return &Server{Router: router}
+}
+
+// CreateUser registra un usuario con el rol indicado y devuelve su token
+func (s *Server) CreateUser(t testing.TB, role string) *User {
+	t.Helper()
+	n := users.Add(1)
+	user, err := services.RegisterUser(context.Background(), fmt.Sprintf("user%d@apitest.local", n), Password, fmt.Sprintf("Usuario %d", n))
+	if err != nil {
+		t.Fatalf("RegisterUser: %v", err)
+	}
+	if role != "" && role != user.Role {
+		if err := database.DB.Model(user).Update("role", role).Error; err != nil {
+			t.Fatalf("actualizar rol: %v", err)
+		}
+		user.Role = role
+	}
+	// Como un inicio de sesión: los tokens sin sesión registrada no se aceptan
+	claims := auth.NewClaims(user.ID, user.Email, user.Role)
+	token, err := auth.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	expiry := time.Unix(claims.ExpiresAt, 0)
+	session := database.Session{ID: claims.ID, UserID: user.ID, ExpiresAt: expiry, TokenExpiresAt: expiry}
+	if err := database.DB.Create(&session).Error; err != nil {
+		t.Fatalf("registrar sesión: %v", err)
+	}
+	return &User{User: user, Token: token}
+}
+
+// Do envía la petición al router; body se serializa como JSON salvo que ya sea []byte
+func (s *Server) Do(t testing.TB, method, path string, body interface{}, opts ...RequestOption) *Response {
+	t.Helper()
+	var payload []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		payload = b
+	default:
+		var err error
+		if payload, err = json.Marshal(b); err != nil {
+			t.Fatalf("serializar el cuerpo: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	rec := httptest.NewRecorder()
+	s.Router.ServeHTTP(rec, req)
+	return &Response{rec}
+}
+
+// WithToken autentica la petición con el token JWT
+func WithToken(token string) RequestOption {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+// WithAPIKey autentica la petición con una clave de API
+func WithAPIKey(key string) RequestOption {
+	return WithHeader("X-API-Key", key)
+}
+
+// WithHeader añade una cabecera a la petición
+func WithHeader(name, value string) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set(name, value)
+	}
+}
+
+// WithClientIP envía la petición desde la IP indicada (por defecto 192.0.2.1)
+func WithClientIP(ip string) RequestOption {
+	return func(r *http.Request) {
+		r.RemoteAddr = net.JoinHostPort(ip, "1234")
+	}
+}
+
+// JSON decodifica el cuerpo de la respuesta en v
+func (r *Response) JSON(t testing.TB, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		t.Fatalf("respuesta no JSON (%d): %s", r.Code, r.Body.String())
+	}
+}
+
+// Expect falla la prueba si el código de estado no es el esperado
+func (r *Response) Expect(t testing.TB, status int) *Response {
+	t.Helper()
+	if r.Code != status {
+		t.Fatalf("estado %d, se esperaba %d: %s", r.Code, status, r.Body.String())
+	}
+	return r
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix identifica las claves de API frente a los tokens JWT
+const APIKeyPrefix = "gk_"
+
+// GenerateAPIKey crea una nueva clave de API y devuelve la clave en claro,
+// su prefijo visible y el hash que se almacena en la base de datos
+func GenerateAPIKey() (key, prefix, hash string) {
+	key = APIKeyPrefix + RandomToken(24)
+	return key, key[:len(APIKeyPrefix)+8], HashAPIKey(key)
+}
+
+// HashAPIKey calcula el hash con el que se busca una clave de API
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey indica si la credencial recibida tiene formato de clave de API
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
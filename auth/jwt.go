@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/ids"
+	"api/secrets"
+)
+
+var (
+	// ErrInvalidToken se devuelve cuando el token no tiene el formato esperado o la firma no coincide
+	ErrInvalidToken = errors.New("token inválido")
+	// ErrExpiredToken se devuelve cuando el token ya expiró
+	ErrExpiredToken = errors.New("token expirado")
+)
+
+// Claims datos contenidos en el token de acceso
+type Claims struct {
+	UserID uint   `json:"sub"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	ID     string `json:"jti"`
+	// Tenant del esquema en que se emitió (TENANCY=schema); vacío en el esquema public
+	Tenant    string `json:"tenant,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// Permisos concedidos para cualquier recurso al emitirlo (users:read, admin,
+	// orgs/acme:admin...) y versión de los permisos del usuario con la que se
+	// calcularon: solo se usan mientras sea la actual
+	Permissions []string `json:"perms,omitempty"`
+	PermVersion uint     `json:"perm_version,omitempty"`
+}
+
+var (
+	secretMu sync.RWMutex
+	secret   []byte
+	// previous secreto anterior, aceptado solo para verificar hasta previousUntil
+	// (cero = sin límite) para que rotar JWT_SECRET no invalide las sesiones abiertas
+	previous      []byte
+	previousUntil time.Time
+)
+
+func init() {
+	secrets.OnRenew("JWT_SECRET", Reload)
+}
+
+// Init carga JWT_SECRET y, opcionalmente, JWT_PREVIOUS_SECRET. En modo release
+// JWT_SECRET es obligatorio; en desarrollo, si falta, se genera un secreto
+// aleatorio que solo vale para este proceso.
+func Init() error {
+	value := os.Getenv("JWT_SECRET")
+	if value == "" {
+		if os.Getenv("GIN_MODE") == "release" {
+			return errors.New("JWT_SECRET es obligatorio en modo release")
+		}
+		value = RandomToken(32)
+		log.Println("⚠️  JWT_SECRET no configurado, usando un secreto aleatorio (los tokens no sobreviven a un reinicio)")
+	}
+
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secret = []byte(value)
+	previous, previousUntil = nil, time.Time{}
+	if old := os.Getenv("JWT_PREVIOUS_SECRET"); old != "" && old != value {
+		previous = []byte(old)
+	}
+	return nil
+}
+
+// Reload vuelve a leer JWT_SECRET tras una renovación de secretos. Si cambió,
+// el secreto anterior se sigue aceptando durante Expiration() para que los
+// tokens ya emitidos caduquen de forma natural.
+func Reload() error {
+	value := os.Getenv("JWT_SECRET")
+	if value == "" {
+		return errors.New("JWT_SECRET vacío tras la renovación, se mantiene el actual")
+	}
+
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	if secret == nil || string(secret) == value {
+		return nil
+	}
+	previous, previousUntil = secret, clock.Now().Add(Expiration())
+	secret = []byte(value)
+	log.Printf("🔑 JWT_SECRET rotado; el anterior se acepta hasta %s", previousUntil.Format(time.RFC3339))
+	return nil
+}
+
+// Secret devuelve la clave usada para firmar tokens
+func Secret() []byte {
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+	if secret == nil {
+		panic("auth: Init no se ha llamado")
+	}
+	return secret
+}
+
+// verificationKeys devuelve las claves con las que se aceptan firmas: la
+// actual y, durante la ventana de rotación, la anterior
+func verificationKeys() [][]byte {
+	keys := [][]byte{Secret()}
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+	if previous != nil && (previousUntil.IsZero() || clock.Now().Before(previousUntil)) {
+		keys = append(keys, previous)
+	}
+	return keys
+}
+
+// DeriveKey deriva del secreto una clave independiente para otro uso
+// (firma de URLs, cifrado en desarrollo...) sin reutilizar la del JWT
+func DeriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, Secret())
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Expiration devuelve la duración de los tokens de acceso
+func Expiration() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("JWT_EXPIRATION")); err == nil && d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// GenerateToken genera un JWT (HS256) firmado para el usuario indicado
+func GenerateToken(userID uint, email, role string) (string, error) {
+	return Sign(NewClaims(userID, email, role))
+}
+
+// NewClaims prepara los claims de un token de acceso nuevo, con un jti único
+func NewClaims(userID uint, email, role string) Claims {
+	now := clock.Now()
+	return Claims{
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		ID:        ids.New(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(Expiration()).Unix(),
+	}
+}
+
+// Sign serializa y firma unos claims arbitrarios
+func Sign(claims interface{}) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signature(Secret(), unsigned), nil
+}
+
+// ParseToken valida la firma y la expiración de un token y devuelve sus claims
+func ParseToken(token string) (*Claims, error) {
+	var claims Claims
+	if err := Verify(token, &claims); err != nil {
+		return nil, err
+	}
+	if clock.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+// Verify comprueba la firma de un token y decodifica su payload en dest
+func Verify(token string, dest interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+	valid := false
+	for _, key := range verificationKeys() {
+		if hmac.Equal([]byte(signature(key, parts[0]+"."+parts[1])), []byte(parts[2])) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, dest); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RandomToken genera una cadena hexadecimal aleatoria de n bytes
+func RandomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func signature(key []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
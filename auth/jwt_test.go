@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"api/clock"
+	"api/ids"
+)
+
+func setSecrets(t *testing.T, current, previous string) {
+	t.Helper()
+	t.Setenv("GIN_MODE", "release")
+	t.Setenv("JWT_SECRET", current)
+	t.Setenv("JWT_PREVIOUS_SECRET", previous)
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	setSecrets(t, "secreto-a", "")
+	valid, _ := GenerateToken(7, "a@example.com", "user")
+	expired, _ := Sign(Claims{UserID: 7, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	parts := strings.Split(valid, ".")
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":1,"role":"admin","exp":9999999999}`)) + "." + parts[2]
+
+	setSecrets(t, "secreto-b", "")
+	otherKey, _ := GenerateToken(7, "a@example.com", "user")
+	setSecrets(t, "secreto-a", "")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"válido", valid, nil},
+		{"expirado", expired, ErrExpiredToken},
+		{"payload alterado", forged, ErrInvalidToken},
+		{"firmado con otra clave", otherKey, ErrInvalidToken},
+		{"sin firma", parts[0] + "." + parts[1], ErrInvalidToken},
+		{"vacío", "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, se esperaba %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.UserID != 7 || claims.Role != "user") {
+				t.Errorf("claims inesperados: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	setSecrets(t, "secreto", "")
+	t.Setenv("JWT_EXPIRATION", "1h")
+	now := clock.NewFixed(time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC))
+	defer clock.Set(now)()
+	defer ids.Set(&ids.Sequence{Prefix: "jti"})()
+
+	token, _ := GenerateToken(7, "a@example.com", "user")
+	claims, err := ParseToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID != "jti-1" || claims.IssuedAt != now.Now().Unix() {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	now.Advance(59 * time.Minute)
+	if _, err := ParseToken(token); err != nil {
+		t.Fatalf("token rechazado antes de caducar: %v", err)
+	}
+	now.Advance(time.Minute)
+	if _, err := ParseToken(token); err != ErrExpiredToken {
+		t.Fatalf("err = %v, se esperaba %v", err, ErrExpiredToken)
+	}
+}
+
+func TestPreviousSecret(t *testing.T) {
+	now := clock.NewFixed(time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC))
+	defer clock.Set(now)()
+	setSecrets(t, "antiguo", "")
+	old, _ := GenerateToken(1, "a@example.com", "user")
+
+	// JWT_PREVIOUS_SECRET explícito: se acepta sin límite de tiempo
+	setSecrets(t, "nuevo", "antiguo")
+	if _, err := ParseToken(old); err != nil {
+		t.Fatalf("token firmado con JWT_PREVIOUS_SECRET rechazado: %v", err)
+	}
+	fresh, _ := GenerateToken(1, "a@example.com", "user")
+	setSecrets(t, "nuevo", "")
+	if _, err := ParseToken(fresh); err != nil {
+		t.Fatalf("los tokens nuevos deben firmarse con JWT_SECRET: %v", err)
+	}
+
+	// Rotación en caliente: el anterior vale durante Expiration()
+	setSecrets(t, "antiguo", "")
+	t.Setenv("JWT_SECRET", "rotado")
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(old); err != nil {
+		t.Fatalf("token anterior rechazado dentro de la ventana: %v", err)
+	}
+	now.Advance(Expiration())
+	if _, err := ParseToken(old); err != ErrInvalidToken {
+		t.Fatalf("token anterior aceptado fuera de la ventana: %v", err)
+	}
+}
+
+func TestInitRequiresSecretInRelease(t *testing.T) {
+	t.Setenv("GIN_MODE", "release")
+	t.Setenv("JWT_SECRET", "")
+	if err := Init(); err == nil {
+		t.Fatal("Init debe fallar sin JWT_SECRET en modo release")
+	}
+}
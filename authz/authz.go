@@ -0,0 +1,460 @@
+// Package authz es el motor de políticas de autorización: decide si un actor
+// puede hacer una acción (users:update) sobre un recurso a partir de políticas
+// con condiciones sobre los atributos de ambos (ABAC). Las políticas
+// predefinidas se registran en el código con Register; la administración
+// añade las suyas, guardadas en el esquema de ctx, sin cambiar el código.
+//
+// Una política deny que se cumple prevalece sobre cualquier allow; sin
+// ninguna política que lo permita, la acción se deniega.
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"api/database"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// Efectos de una política
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+var (
+	// ErrPolicyNotFound no hay ninguna política con ese ID
+	ErrPolicyNotFound = errors.New("política no encontrada")
+	// ErrPolicyExists ya hay una política con ese nombre
+	ErrPolicyExists = errors.New("ya existe una política con ese nombre")
+	// ErrInvalidPolicy la política no tiene efecto o acciones válidos
+	ErrInvalidPolicy = errors.New("política inválida")
+)
+
+// cacheTTL tiempo que se reutilizan las políticas leídas; con varias
+// instancias un cambio tarda como máximo esto en propagarse
+const cacheTTL = 5 * time.Second
+
+// Attributes atributos del actor o del recurso para las condiciones. Un valor
+// Lazy se calcula la primera vez que una condición lo usa.
+type Attributes map[string]interface{}
+
+// Lazy atributo que se calcula solo si se usa (p. ej. con consultas)
+type Lazy func() interface{}
+
+// Get valor del atributo; nil si no existe
+func (a Attributes) Get(name string) interface{} {
+	v, ok := a[name]
+	if !ok {
+		return nil
+	}
+	if lazy, ok := v.(Lazy); ok {
+		v = lazy()
+		a[name] = v
+	}
+	return v
+}
+
+// Resolve calcula todos los atributos Lazy y devuelve los valores
+func (a Attributes) Resolve() Attributes {
+	for name := range a {
+		a.Get(name)
+	}
+	return a
+}
+
+// Policy política de autorización
+type Policy struct {
+	// ID de las guardadas; 0 en las predefinidas
+	ID          uint     `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Effect      string   `json:"effect"`
+	Actions     []string `json:"actions"`
+	Condition   string   `json:"condition,omitempty"`
+	// Predefinida en el código: no se puede modificar ni eliminar
+	BuiltIn bool `json:"built_in"`
+
+	compiled *Condition
+	// Borrador que solo se aplica en una simulación
+	draft bool
+}
+
+// Applies indica si la política se aplica a la acción: exacta, recurso:* o *
+func (p *Policy) Applies(action string) bool {
+	for _, a := range p.Actions {
+		if a == "*" || a == action || (strings.HasSuffix(a, ":*") && strings.HasPrefix(action, strings.TrimSuffix(a, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches indica si la política se aplica a la acción y su condición se cumple
+func (p *Policy) Matches(action string, actor, resource Attributes) bool {
+	return p.Applies(action) && p.compiled.Matches(actor, resource)
+}
+
+// Request petición de autorización
+type Request struct {
+	Action   string
+	Actor    Attributes
+	Resource Attributes
+}
+
+// Decision resultado de una evaluación con la política que lo decidió
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Policy  string `json:"policy,omitempty"`
+	Effect  string `json:"effect,omitempty"`
+	BuiltIn bool   `json:"built_in,omitempty"`
+	// La decidió un borrador de una simulación
+	Draft  bool   `json:"draft,omitempty"`
+	Reason string `json:"reason"`
+}
+
+var (
+	mu        sync.Mutex
+	builtins  []*Policy
+	cache     = map[string]entry{}
+	listeners []func(context.Context) error
+)
+
+type entry struct {
+	policies []*Policy
+	loadedAt time.Time
+}
+
+// OnChange registra fn para que se llame tras cada cambio en las políticas del
+// esquema de ctx. Se llama desde init.
+func OnChange(fn func(ctx context.Context) error) {
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// Register añade una política predefinida. Se llama desde init; una política
+// inválida es un error de programación y provoca un pánico.
+func Register(p Policy) {
+	if err := p.compile(); err != nil {
+		panic(fmt.Sprintf("authz: política %s: %v", p.Name, err))
+	}
+	p.BuiltIn = true
+	mu.Lock()
+	defer mu.Unlock()
+	builtins = append(builtins, &p)
+}
+
+func (p *Policy) compile() error {
+	if p.Effect != Allow && p.Effect != Deny {
+		return fmt.Errorf("%w: el efecto debe ser allow o deny", ErrInvalidPolicy)
+	}
+	if len(p.Actions) == 0 {
+		return fmt.Errorf("%w: indica al menos una acción", ErrInvalidPolicy)
+	}
+	for _, a := range p.Actions {
+		if a != "*" && !strings.Contains(a, ":") {
+			return fmt.Errorf("%w: acción %q (recurso:operación, recurso:* o *)", ErrInvalidPolicy, a)
+		}
+	}
+	compiled, err := Compile(p.Condition)
+	if err != nil {
+		return err
+	}
+	p.compiled = compiled
+	return nil
+}
+
+// Evaluate decide la petición con las políticas predefinidas y las del esquema de ctx
+func Evaluate(ctx context.Context, req Request) (Decision, error) {
+	policies, err := load(ctx)
+	if err != nil {
+		return Decision{}, err
+	}
+	return decide(policies, req), nil
+}
+
+// decide aplica las políticas: la primera deny que se cumple deniega; si no,
+// la primera allow que se cumple permite; si ninguna, se deniega
+func decide(policies []*Policy, req Request) Decision {
+	if req.Actor == nil {
+		req.Actor = Attributes{}
+	}
+	if req.Resource == nil {
+		req.Resource = Attributes{}
+	}
+	var allowed *Policy
+	for _, p := range policies {
+		if !p.Matches(req.Action, req.Actor, req.Resource) {
+			continue
+		}
+		if p.Effect == Deny {
+			return Decision{Policy: p.Name, Effect: Deny, BuiltIn: p.BuiltIn, Draft: p.draft, Reason: "la política " + p.Name + " lo deniega"}
+		}
+		if allowed == nil {
+			allowed = p
+		}
+	}
+	if allowed != nil {
+		return Decision{Allowed: true, Policy: allowed.Name, Effect: Allow, BuiltIn: allowed.BuiltIn, Draft: allowed.draft, Reason: "la política " + allowed.Name + " lo permite"}
+	}
+	return Decision{Reason: "ninguna política lo permite"}
+}
+
+// Evaluation resultado de una política en una simulación
+type Evaluation struct {
+	Policy  string `json:"policy"`
+	Effect  string `json:"effect"`
+	BuiltIn bool   `json:"built_in,omitempty"`
+	Draft   bool   `json:"draft,omitempty"`
+	// La política se aplica a la acción
+	Applies bool `json:"applies"`
+	// Se aplica y su condición se cumple
+	Matched bool `json:"matched"`
+}
+
+// Simulation decisión de una simulación con los atributos usados y el
+// resultado de cada política
+type Simulation struct {
+	Decision
+	Actor    Attributes   `json:"actor"`
+	Resource Attributes   `json:"resource"`
+	Trace    []Evaluation `json:"trace"`
+}
+
+// Simulate evalúa la petición como Evaluate, añadiendo a las políticas del
+// esquema de ctx los borradores drafts (que no se guardan), y explica el
+// resultado de cada una
+func Simulate(ctx context.Context, req Request, drafts []Policy) (*Simulation, error) {
+	policies, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policies = append([]*Policy{}, policies...)
+	for i := range drafts {
+		p := drafts[i]
+		if err := p.compile(); err != nil {
+			return nil, fmt.Errorf("borrador %s: %w", p.Name, err)
+		}
+		p.draft = true
+		policies = append(policies, &p)
+	}
+	if req.Actor == nil {
+		req.Actor = Attributes{}
+	}
+	if req.Resource == nil {
+		req.Resource = Attributes{}
+	}
+
+	sim := &Simulation{Decision: decide(policies, req), Trace: make([]Evaluation, len(policies))}
+	for i, p := range policies {
+		applies := p.Applies(req.Action)
+		sim.Trace[i] = Evaluation{
+			Policy: p.Name, Effect: p.Effect, BuiltIn: p.BuiltIn, Draft: p.draft,
+			Applies: applies, Matched: applies && p.compiled.Matches(req.Actor, req.Resource),
+		}
+	}
+	sim.Actor, sim.Resource = req.Actor.Resolve(), req.Resource.Resolve()
+	return sim, nil
+}
+
+// Alcance de una concesión
+const (
+	// ScopeAll para cualquier recurso
+	ScopeAll = "all"
+	// ScopeConditional según los atributos del recurso
+	ScopeConditional = "conditional"
+)
+
+// Grant acción que una política concede (allow) o deniega (deny) a un actor
+type Grant struct {
+	Action    string `json:"action"`
+	Policy    string `json:"policy"`
+	Effect    string `json:"effect"`
+	BuiltIn   bool   `json:"built_in,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	Scope     string `json:"scope"`
+	// Atributos del actor que usa la condición, con su valor
+	Actor Attributes `json:"actor,omitempty"`
+}
+
+// Grants acciones de actions que las políticas del esquema de ctx conceden o
+// deniegan a actor, para cualquier recurso o según sus atributos, en el orden
+// de las acciones y de las políticas
+func Grants(ctx context.Context, actor Attributes, actions []string) ([]Grant, error) {
+	policies, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var grants []Grant
+	for _, action := range actions {
+		for _, p := range policies {
+			if !p.Applies(action) {
+				continue
+			}
+			matches, conditional := p.compiled.Partial(actor)
+			if !matches {
+				continue
+			}
+			g := Grant{Action: action, Policy: p.Name, Effect: p.Effect, BuiltIn: p.BuiltIn, Condition: p.Condition, Scope: ScopeAll}
+			if conditional {
+				g.Scope = ScopeConditional
+			}
+			if names := p.compiled.ActorAttributes(); len(names) > 0 {
+				g.Actor = Attributes{}
+				for _, name := range names {
+					g.Actor[name] = actor.Get(name)
+				}
+			}
+			grants = append(grants, g)
+		}
+	}
+	return grants, nil
+}
+
+// Policies devuelve las políticas predefinidas seguidas de las del esquema de ctx
+func Policies(ctx context.Context) ([]Policy, error) {
+	policies, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Policy, len(policies))
+	for i, p := range policies {
+		list[i] = *p
+	}
+	return list, nil
+}
+
+// load políticas predefinidas y guardadas, releyendo estas de la base de datos
+// como mucho cada cacheTTL
+func load(ctx context.Context) ([]*Policy, error) {
+	slug := tenancy.From(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	if cached, ok := cache[slug]; ok && time.Since(cached.loadedAt) < cacheTTL {
+		return cached.policies, nil
+	}
+
+	var stored []database.Policy
+	if err := database.DB.WithContext(ctx).Order("id").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	policies := append([]*Policy{}, builtins...)
+	for _, s := range stored {
+		p := fromModel(&s)
+		// Las guardadas se validan al crearlas; una que ya no compile no se aplica
+		if p.compile() == nil {
+			policies = append(policies, p)
+		}
+	}
+	cache[slug] = entry{policies: policies, loadedAt: time.Now()}
+	return policies, nil
+}
+
+// invalidate descarta las políticas en caché del esquema de ctx tras un cambio
+// y avisa a los registrados con OnChange
+func invalidate(ctx context.Context) {
+	mu.Lock()
+	delete(cache, tenancy.From(ctx))
+	notify := listeners
+	mu.Unlock()
+	for _, fn := range notify {
+		if err := fn(ctx); err != nil {
+			log.Printf("⚠️  Error al aplicar el cambio de las políticas: %v", err)
+		}
+	}
+}
+
+func fromModel(m *database.Policy) *Policy {
+	return &Policy{ID: m.ID, Name: m.Name, Description: m.Description, Effect: m.Effect, Actions: m.Actions, Condition: m.Condition}
+}
+
+// Create guarda una política en el esquema de ctx
+func Create(ctx context.Context, p Policy) (*Policy, error) {
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	if isBuiltIn(p.Name) {
+		return nil, ErrPolicyExists
+	}
+	m := database.Policy{Name: p.Name, Description: p.Description, Effect: p.Effect, Actions: p.Actions, Condition: p.Condition}
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&database.Policy{}).Where("name = ?", p.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPolicyExists
+		}
+		return tx.Create(&m).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidate(ctx)
+	return fromModel(&m), nil
+}
+
+// Update sustituye la política guardada id
+func Update(ctx context.Context, id uint, p Policy) (*Policy, error) {
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+	if isBuiltIn(p.Name) {
+		return nil, ErrPolicyExists
+	}
+	var m database.Policy
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&m, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPolicyNotFound
+			}
+			return err
+		}
+		var count int64
+		if err := tx.Model(&database.Policy{}).Where("name = ? AND id <> ?", p.Name, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPolicyExists
+		}
+		m.Name, m.Description, m.Effect, m.Actions, m.Condition = p.Name, p.Description, p.Effect, p.Actions, p.Condition
+		return tx.Save(&m).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidate(ctx)
+	return fromModel(&m), nil
+}
+
+// Delete elimina la política guardada id
+func Delete(ctx context.Context, id uint) error {
+	result := database.DB.WithContext(ctx).Delete(&database.Policy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPolicyNotFound
+	}
+	invalidate(ctx)
+	return nil
+}
+
+func isBuiltIn(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range builtins {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
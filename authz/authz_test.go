@@ -0,0 +1,105 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCondition(t *testing.T) {
+	actor := Attributes{"id": uint(7), "role": "user", "admin": false, "admin_orgs": []string{"acme"}}
+	tests := []struct {
+		condition string
+		resource  Attributes
+		want      bool
+	}{
+		{"", nil, true},
+		{`resource.id == actor.id`, Attributes{"id": uint(7)}, true},
+		{`resource.id == actor.id`, Attributes{"id": uint(8)}, false},
+		{`resource.id == 8`, Attributes{"id": uint(8)}, true},
+		{`resource.orgs intersects actor.admin_orgs and resource.role != "admin"`, Attributes{"orgs": []string{"globex", "acme"}, "role": "user"}, true},
+		{`resource.orgs intersects actor.admin_orgs and resource.role != "admin"`, Attributes{"orgs": []string{"acme"}, "role": "admin"}, false},
+		{`resource.orgs intersects actor.admin_orgs`, Attributes{}, false},
+		{`actor.role in ["admin", "user"]`, nil, true},
+		{`not (actor.admin or actor.role == "user")`, nil, false},
+		{`actor.id >= 7 and actor.id < 10`, nil, true},
+		{`resource.missing == null`, nil, true},
+		{`actor.admin`, nil, false},
+		{`resource.role == "admin"`, Attributes{"role": Lazy(func() interface{} { return "admin" })}, true},
+	}
+	for _, tt := range tests {
+		cond, err := Compile(tt.condition)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.condition, err)
+		}
+		resource := tt.resource
+		if resource == nil {
+			resource = Attributes{}
+		}
+		if got := cond.Matches(actor, resource); got != tt.want {
+			t.Errorf("%q con %v = %v, se esperaba %v", tt.condition, tt.resource, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{`actor.id = 1`, `user.id == 1`, `(actor.admin`, `actor.role == "x`, `actor.id == `, `actor.id == 1 1`} {
+		if _, err := Compile(invalid); !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("Compile(%q) = %v, se esperaba ErrInvalidCondition", invalid, err)
+		}
+	}
+}
+
+func TestPartial(t *testing.T) {
+	actor := Attributes{"id": uint(7), "admin": false, "admin_orgs": []string{"acme"}}
+	tests := []struct {
+		condition            string
+		matches, conditional bool
+	}{
+		{"", true, false},
+		{`actor.admin == false`, true, false},
+		{`actor.admin == true`, false, false},
+		{`resource.id == actor.id`, true, true},
+		{`actor.admin == true and resource.id == 1`, false, false},
+		{`actor.admin == false or resource.id == 1`, true, false},
+		{`resource.orgs intersects actor.admin_orgs and not (resource.role in ["admin"])`, true, true},
+	}
+	for _, tt := range tests {
+		cond, err := Compile(tt.condition)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.condition, err)
+		}
+		if matches, conditional := cond.Partial(actor); matches != tt.matches || conditional != tt.conditional {
+			t.Errorf("Partial(%q) = %v, %v; se esperaba %v, %v", tt.condition, matches, conditional, tt.matches, tt.conditional)
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	policies := []*Policy{
+		{Name: "owner", Effect: Allow, Actions: []string{"users:*"}, Condition: `resource.id == actor.id`},
+		{Name: "anyone-reads", Effect: Allow, Actions: []string{"users:read"}},
+		{Name: "no-api-key-deletes", Effect: Deny, Actions: []string{"users:delete"}, Condition: `actor.api_key == true`},
+	}
+	for _, p := range policies {
+		if err := p.compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		action  string
+		actor   Attributes
+		allowed bool
+		policy  string
+	}{
+		{"users:update", Attributes{"id": 1}, true, "owner"},
+		{"users:update", Attributes{"id": 2}, false, ""},
+		{"users:read", Attributes{"id": 2}, true, "anyone-reads"},
+		{"users:delete", Attributes{"id": 1, "api_key": true}, false, "no-api-key-deletes"},
+		{"orgs:delete", Attributes{"id": 1}, false, ""},
+	}
+	for _, tt := range tests {
+		d := decide(policies, Request{Action: tt.action, Actor: tt.actor, Resource: Attributes{"id": 1}})
+		if d.Allowed != tt.allowed || d.Policy != tt.policy {
+			t.Errorf("%s con %v = %+v", tt.action, tt.actor, d)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidCondition la condición de una política no se puede interpretar
+var ErrInvalidCondition = errors.New("condición inválida")
+
+// Condition condición compilada de una política. La sintaxis:
+//
+//	resource.orgs intersects actor.admin_orgs and resource.role != "admin"
+//
+// Operandos: atributos actor.<nombre> y resource.<nombre>, textos entre
+// comillas, números, true, false y listas [a, b]. Operadores: == != < <= > >=,
+// in (valor en lista), intersects (listas con algún elemento común), and, or,
+// not y paréntesis. Un atributo que no existe vale null.
+type Condition struct {
+	source string
+	eval   func(Attributes, Attributes) interface{}
+	// Atributos que usa, sin repetir
+	actor, resource []string
+}
+
+// String texto original de la condición
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Matches indica si la condición se cumple para actor y resource
+func (c *Condition) Matches(actor, resource Attributes) bool {
+	if c == nil || c.eval == nil {
+		return true
+	}
+	ok, _ := c.eval(actor, resource).(bool)
+	return ok
+}
+
+// Partial evalúa la condición conociendo solo el actor: matches si se cumple
+// para algún recurso y conditional si depende de los atributos del recurso
+// (si no, se cumple para todos o para ninguno)
+func (c *Condition) Partial(actor Attributes) (matches, conditional bool) {
+	if c == nil || c.eval == nil {
+		return true, false
+	}
+	resource := Attributes{}
+	for _, name := range c.resource {
+		resource[name] = unknown
+	}
+	if v := c.eval(actor, resource); v != unknown {
+		return truthy(v), false
+	}
+	return true, true
+}
+
+// ActorAttributes nombres de los atributos del actor que usa la condición
+func (c *Condition) ActorAttributes() []string {
+	if c == nil {
+		return nil
+	}
+	return c.actor
+}
+
+// Compile interpreta una condición; la vacía se cumple siempre
+func Compile(source string) (*Condition, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return &Condition{}, nil
+	}
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	eval, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: sobra %q", ErrInvalidCondition, p.tokens[p.pos].text)
+	}
+	return &Condition{source: source, eval: eval, actor: p.actor, resource: p.resource}, nil
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokNumber
+	tokOp
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		r := rune(s[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: texto sin cerrar", ErrInvalidCondition)
+			}
+			tokens = append(tokens, token{tokString, s[i+1 : i+1+end]})
+			i += end + 2
+		case strings.ContainsRune("()[],", r):
+			tokens = append(tokens, token{tokPunct, string(r)})
+			i++
+		case strings.ContainsRune("=!<>", r):
+			op := string(r)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf("%w: operador %q", ErrInvalidCondition, op)
+			}
+			tokens = append(tokens, token{tokOp, op})
+			i += len(op)
+		case unicode.IsDigit(r) || r == '-':
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, s[i:j]})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, s[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("%w: carácter %q", ErrInvalidCondition, r)
+		}
+	}
+	return tokens, nil
+}
+
+type evalFunc func(actor, resource Attributes) interface{}
+
+type parser struct {
+	tokens []token
+	pos    int
+	// Atributos usados, para Partial
+	actor, resource []string
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// accept consume el siguiente token si es text (palabra clave, operador o signo)
+func (p *parser) accept(text string) bool {
+	if t, ok := p.peek(); ok && t.kind != tokString && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (evalFunc, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(a, r Attributes) interface{} {
+			lv := l(a, r)
+			if truthy(lv) {
+				return true
+			}
+			rv := right(a, r)
+			if truthy(rv) {
+				return true
+			}
+			if lv == unknown || rv == unknown {
+				return unknown
+			}
+			return false
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (evalFunc, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(a, r Attributes) interface{} {
+			lv := l(a, r)
+			if lv != unknown && !truthy(lv) {
+				return false
+			}
+			rv := right(a, r)
+			if rv != unknown && !truthy(rv) {
+				return false
+			}
+			if lv == unknown || rv == unknown {
+				return unknown
+			}
+			return true
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (evalFunc, error) {
+	if p.accept("not") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(a, r Attributes) interface{} {
+			v := inner(a, r)
+			if v == unknown {
+				return unknown
+			}
+			return !truthy(v)
+		}, nil
+	}
+	if p.accept("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("%w: falta )", ErrInvalidCondition)
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (evalFunc, error) {
+	left, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.peek()
+	if !ok || !(t.kind == tokOp || (t.kind == tokIdent && (t.text == "in" || t.text == "intersects"))) {
+		return left, nil
+	}
+	p.pos++
+	right, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	op := t.text
+	return func(a, r Attributes) interface{} {
+		lv, rv := left(a, r), right(a, r)
+		if lv == unknown || rv == unknown {
+			return unknown
+		}
+		return compare(op, lv, rv)
+	}, nil
+}
+
+func (p *parser) value() (evalFunc, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: falta un operando", ErrInvalidCondition)
+	}
+	p.pos++
+	switch t.kind {
+	case tokString:
+		return constant(t.text), nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: número %q", ErrInvalidCondition, t.text)
+		}
+		return constant(n), nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		case "null":
+			return constant(nil), nil
+		}
+		scope, name, found := strings.Cut(t.text, ".")
+		if !found || name == "" || (scope != "actor" && scope != "resource") {
+			return nil, fmt.Errorf("%w: %q no es un atributo actor.<nombre> ni resource.<nombre>", ErrInvalidCondition, t.text)
+		}
+		if scope == "actor" {
+			p.actor = appendNew(p.actor, name)
+			return func(a, r Attributes) interface{} { return a.Get(name) }, nil
+		}
+		p.resource = appendNew(p.resource, name)
+		return func(a, r Attributes) interface{} { return r.Get(name) }, nil
+	case tokPunct:
+		if t.text != "[" {
+			break
+		}
+		var items []evalFunc
+		for !p.accept("]") {
+			if len(items) > 0 && !p.accept(",") {
+				return nil, fmt.Errorf("%w: falta , o ] en la lista", ErrInvalidCondition)
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return func(a, r Attributes) interface{} {
+			list := make([]interface{}, len(items))
+			for i, item := range items {
+				if list[i] = item(a, r); list[i] == unknown {
+					return unknown
+				}
+			}
+			return list
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %q inesperado", ErrInvalidCondition, t.text)
+}
+
+// unknown valor de los atributos del recurso en Partial; lo que depende de él
+// es unknown salvo que and u or se decidan con el otro operando
+var unknown = unknownValue{}
+
+type unknownValue struct{}
+
+func appendNew(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+func constant(v interface{}) evalFunc {
+	return func(Attributes, Attributes) interface{} { return v }
+}
+
+func truthy(v interface{}) bool {
+	b, _ := v.(bool)
+	return b
+}
+
+// compare aplica el operador; los tipos que no se pueden comparar dan false
+func compare(op string, left, right interface{}) bool {
+	left, right = normalizeValue(left), normalizeValue(right)
+	switch op {
+	case "==":
+		return equal(left, right)
+	case "!=":
+		return !equal(left, right)
+	case "in":
+		for _, item := range toList(right) {
+			if equal(left, item) {
+				return true
+			}
+		}
+		return false
+	case "intersects":
+		for _, l := range toList(left) {
+			for _, r := range toList(right) {
+				if equal(l, r) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return false
+	}
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
+
+// normalizeValue unifica los números como float64 y las listas como []interface{}
+func normalizeValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Slice:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = normalizeValue(rv.Index(i).Interface())
+		}
+		return list
+	}
+	return v
+}
+
+func toList(v interface{}) []interface{} {
+	list, _ := normalizeValue(v).([]interface{})
+	return list
+}
+
+func equal(left, right interface{}) bool {
+	left, right = normalizeValue(left), normalizeValue(right)
+	if _, ok := left.([]interface{}); ok {
+		return reflect.DeepEqual(left, right)
+	}
+	return left == right
+}
@@ -0,0 +1,249 @@
+// Package backup hace y restaura copias de seguridad cifradas de la base de
+// datos configurada: con pg_dump/pg_restore en PostgreSQL y con una copia
+// consistente del fichero (VACUUM INTO) en SQLite. Las copias se cifran con
+// una clave de datos envuelta por la clave maestra de encryption y se guardan
+// en el almacenamiento de la aplicación (disco local o S3).
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"api/clock"
+	"api/database"
+	"api/jobs"
+	"api/storage"
+	"api/tenancy"
+)
+
+// Job nombre del trabajo que hace una copia de seguridad
+const Job = "backup.create"
+
+// Payload datos del trabajo
+type Payload struct {
+	BackupID string `json:"backup_id"`
+}
+
+// ErrInMemory no se restaura sobre una base de datos SQLite en memoria
+var ErrInMemory = errors.New("la base de datos SQLite está en memoria")
+
+// ObjectKey clave de la copia en el almacenamiento
+func ObjectKey(id string) string {
+	return "backups/" + id + ".bak"
+}
+
+// Recover al arrancar da por fallidas las copias que estaban en curso en un
+// proceso anterior y vuelve a encolar las pendientes
+func Recover(ctx context.Context) error {
+	if err := database.DB.WithContext(ctx).Model(&database.Backup{}).Where("status = ?", "running").
+		Updates(map[string]interface{}{"status": "failed", "error": "interrumpida al reiniciar el servidor"}).Error; err != nil {
+		return err
+	}
+
+	var pending []database.Backup
+	if err := database.DB.WithContext(ctx).Where("status = ?", "pending").Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, b := range pending {
+		if err := jobs.Enqueue(ctx, Job, Payload{BackupID: b.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Process trabajo Job: hace la copia pedida desde la API
+func Process(ctx context.Context, payload []byte) error {
+	var p Payload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var b database.Backup
+	if err := database.DB.First(&b, "id = ?", p.BackupID).Error; err != nil {
+		return err
+	}
+	return Run(ctx, &b)
+}
+
+// Run hace la copia, la cifra y la sube al almacenamiento, y guarda en b su
+// estado
+func Run(ctx context.Context, b *database.Backup) error {
+	started := clock.Now()
+	if err := database.DB.Model(b).Updates(map[string]interface{}{
+		"status": "running", "driver": database.Driver(), "started_at": started,
+	}).Error; err != nil {
+		return err
+	}
+
+	size, err := upload(ctx, ObjectKey(b.ID), b.Tenant)
+	completed := clock.Now()
+	if err != nil {
+		database.DB.Model(b).Updates(map[string]interface{}{"status": "failed", "error": err.Error(), "completed_at": completed})
+		return err
+	}
+	log.Printf("💾 Copia de seguridad %s completada (%d bytes)", b.ID, size)
+	return database.DB.Model(b).Updates(map[string]interface{}{
+		"status": "ready", "object_key": ObjectKey(b.ID), "size": size, "completed_at": completed,
+	}).Error
+}
+
+// upload escribe la copia cifrada en un fichero temporal y la sube
+func upload(ctx context.Context, key, tenant string) (int64, error) {
+	f, err := os.CreateTemp("", "backup-*.bak")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := write(ctx, f, tenant); err != nil {
+		return 0, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := storage.Default.Put(ctx, key, f, size, "application/octet-stream"); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// Write escribe en w una copia cifrada de la base de datos configurada
+func Write(ctx context.Context, w io.Writer) error {
+	return write(ctx, w, "")
+}
+
+// write escribe en w una copia cifrada de la base de datos o, si se indica,
+// solo del esquema del tenant
+func write(ctx context.Context, w io.Writer, tenant string) error {
+	enc, err := newEncryptWriter(w)
+	if err != nil {
+		return err
+	}
+	if err := dump(ctx, enc, tenant); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Restore sustituye la base de datos configurada por la copia cifrada de r.
+// El servidor debe estar parado: en SQLite se reemplaza el fichero y en
+// PostgreSQL pg_restore borra y vuelve a crear las tablas.
+func Restore(ctx context.Context, r io.Reader) error {
+	dec, err := newDecryptReader(r)
+	if err != nil {
+		return err
+	}
+	if database.Driver() == "postgres" {
+		return pgCommand(ctx, "pg_restore", dec, nil,
+			"--clean", "--if-exists", "--no-owner", "--no-privileges", "--single-transaction", "--dbname", os.Getenv("DB_NAME"))
+	}
+	return restoreSQLite(dec)
+}
+
+// dump escribe en w la copia sin cifrar
+func dump(ctx context.Context, w io.Writer, tenant string) error {
+	if database.Driver() == "postgres" {
+		args := []string{"--format=custom", "--no-owner", "--no-privileges"}
+		if tenant != "" {
+			args = append(args, "--schema="+tenancy.Schema(tenant))
+		}
+		return pgCommand(ctx, "pg_dump", nil, w, args...)
+	}
+	if tenant != "" {
+		return errors.New("los tenants solo existen en PostgreSQL")
+	}
+
+	// VACUUM INTO hace una copia consistente aunque la base de datos esté en uso
+	dir, err := os.MkdirTemp("", "backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "db.sqlite")
+	if err := database.DB.WithContext(database.Unbounded(ctx)).Exec("VACUUM INTO ?", file).Error; err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// pgCommand ejecuta una herramienta de PostgreSQL (pg_dump, pg_restore) con
+// las credenciales de conexión de la aplicación
+func pgCommand(ctx context.Context, name string, stdin io.Reader, stdout io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	sslmode := os.Getenv("DB_SSLMODE")
+	if sslmode == "" {
+		sslmode = "disable"
+	}
+	// Las credenciales se leen al ejecutar para recoger las rotaciones
+	cmd.Env = append(os.Environ(),
+		"PGHOST="+os.Getenv("DB_HOST"),
+		"PGPORT="+os.Getenv("DB_PORT"),
+		"PGUSER="+os.Getenv("DB_USER"),
+		"PGPASSWORD="+os.Getenv("DB_PASSWORD"),
+		"PGDATABASE="+os.Getenv("DB_NAME"),
+		"PGSSLMODE="+sslmode,
+	)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// sqliteHeader comienzo de todos los ficheros de SQLite
+const sqliteHeader = "SQLite format 3\x00"
+
+// restoreSQLite escribe la copia junto al fichero de la base de datos y lo
+// reemplaza solo si se ha descifrado entera
+func restoreSQLite(r io.Reader) error {
+	target := database.SQLiteFile()
+	if strings.HasPrefix(target, "file:") || strings.Contains(target, ":memory:") {
+		return ErrInMemory
+	}
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(len(sqliteHeader)); err != nil || string(head) != sqliteHeader {
+		return errors.New("la copia no es de una base de datos SQLite")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, br); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// Los ficheros del diario de la base de datos anterior no valen para la nueva
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		os.Remove(target + suffix)
+	}
+	return os.Rename(tmp.Name(), target)
+}
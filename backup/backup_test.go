@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"api/database"
+	"api/encryption"
+)
+
+func setKey(t *testing.T, b byte) {
+	t.Helper()
+	t.Setenv("ENCRYPTION_KEYS", "k1:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32)))
+	t.Setenv("ENCRYPTION_ACTIVE_KEY", "")
+	if err := encryption.Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func encrypt(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := newEncryptWriter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Escrituras de tamaños que no coinciden con los bloques
+	for len(data) > 0 {
+		n := min(len(data), 10000)
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func decrypt(data []byte) ([]byte, error) {
+	r, err := newDecryptReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	setKey(t, 1)
+	for _, size := range []int{0, 1, chunkSize, chunkSize + 1, 3*chunkSize + 123} {
+		data := bytes.Repeat([]byte("copia de seguridad "), size/19+1)[:size]
+		sealed := encrypt(t, data)
+		if size >= 19 && bytes.Contains(sealed, data[:19]) {
+			t.Errorf("%d bytes: el texto en claro aparece en la copia", size)
+		}
+		plain, err := decrypt(sealed)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if !bytes.Equal(plain, data) {
+			t.Errorf("%d bytes: la copia descifrada no coincide", size)
+		}
+	}
+}
+
+func TestDecryptRejectsDamage(t *testing.T) {
+	setKey(t, 1)
+	sealed := encrypt(t, bytes.Repeat([]byte{7}, 2*chunkSize+10))
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)/2] ^= 1
+	// Cortada justo al final de un bloque: el último que queda no está marcado como último
+	truncated := sealed[:len(sealed)-(4+10+16)]
+	for name, data := range map[string][]byte{"modificada": tampered, "truncada": truncated, "sin cabecera": sealed[5:]} {
+		if _, err := decrypt(data); !errors.Is(err, ErrFormat) {
+			t.Errorf("%s: err = %v, se esperaba ErrFormat", name, err)
+		}
+	}
+
+	// Con otra clave maestra no se puede abrir
+	setKey(t, 2)
+	if _, err := decrypt(sealed); err == nil {
+		t.Error("se descifró la copia con otra clave maestra")
+	}
+}
+
+func TestBackupRestoreSQLite(t *testing.T) {
+	setKey(t, 1)
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DB_NAME", filepath.Join(t.TempDir(), "api.db"))
+	connect := func() {
+		if err := database.InitDB(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	disconnect := func() {
+		db, _ := database.DB.DB()
+		db.Close()
+	}
+	count := func() int64 {
+		var n int64
+		database.DB.Model(&database.User{}).Count(&n)
+		return n
+	}
+
+	connect()
+	database.DB.Create(&database.User{Email: "antes@example.com", Name: "Antes", Password: "x"})
+	var copy bytes.Buffer
+	if err := Write(context.Background(), &copy); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Create(&database.User{Email: "despues@example.com", Name: "Después", Password: "x"})
+	if count() != 2 {
+		t.Fatalf("usuarios = %d", count())
+	}
+	disconnect()
+
+	if err := Restore(context.Background(), bytes.NewReader(copy.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	connect()
+	defer disconnect()
+	if count() != 1 {
+		t.Errorf("usuarios tras restaurar = %d, se esperaba 1", count())
+	}
+}
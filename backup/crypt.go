@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"api/encryption"
+)
+
+// Formato de las copias cifradas: la cabecera magic, la DEK envuelta por la
+// clave maestra (encryption.NewDataKey) en una línea y después bloques de
+// hasta chunkSize bytes cifrados con AES-256-GCM, cada uno precedido de su
+// longitud (uint32). El nonce de cada bloque es su número y marca el último,
+// así que no se pueden reordenar, quitar ni truncar bloques sin que falle el
+// descifrado.
+const (
+	magic     = "GESHURO-BACKUP-1\n"
+	chunkSize = 64 << 10
+)
+
+// ErrFormat el fichero no es una copia de seguridad o está dañado
+var ErrFormat = errors.New("el fichero no es una copia de seguridad válida")
+
+// encryptWriter cifra lo que se escribe; Close escribe el último bloque
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+}
+
+// newEncryptWriter escribe la cabecera en w y devuelve el writer que cifra
+// los datos con una DEK nueva
+func newEncryptWriter(w io.Writer) (*encryptWriter, error) {
+	dek, wrapped, err := encryption.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, magic+wrapped+"\n"); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// El bloque lleno se cifra al llegar más datos: el último lo cifra Close
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		m := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+m]
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close cifra el último bloque; no cierra el writer de destino
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, nonce(e.counter, last), e.buf, nil)
+	e.counter++
+	e.buf = e.buf[:0]
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader descifra una copia escrita por encryptWriter
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	done    bool
+}
+
+// newDecryptReader lee la cabecera de r y desenvuelve su DEK
+func newDecryptReader(r io.Reader) (*decryptReader, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, head); err != nil || string(head) != magic {
+		return nil, ErrFormat
+	}
+	wrapped, err := br.ReadString('\n')
+	if err != nil {
+		return nil, ErrFormat
+	}
+	dek, err := encryption.OpenDataKey(strings.TrimSuffix(wrapped, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo descifrar la clave de la copia: %w", err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next descifra el siguiente bloque; es el último si no le siguen más datos
+func (d *decryptReader) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return ErrFormat
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > chunkSize+uint32(d.aead.Overhead()) {
+		return ErrFormat
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return ErrFormat
+	}
+	_, err := d.r.Peek(1)
+	last := errors.Is(err, io.EOF)
+	plain, err := d.aead.Open(sealed[:0], nonce(d.counter, last), sealed, nil)
+	if err != nil {
+		return ErrFormat
+	}
+	d.counter++
+	d.buf = plain
+	d.done = last
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce del bloque n: su número y un último byte a 1 en el último bloque
+func nonce(n uint64, last bool) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint64(b, n)
+	if last {
+		b[11] = 1
+	}
+	return b
+}
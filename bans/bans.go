@@ -0,0 +1,232 @@
+// Package bans bloquea temporalmente las IPs con comportamiento abusivo:
+// demasiados logins fallidos o una avalancha de respuestas 4xx en poco tiempo.
+// Los contadores viven en memoria de cada instancia; los bloqueos se guardan en
+// la base de datos y los aplican todas.
+package bans
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/iplist"
+)
+
+// Motivos de bloqueo
+const (
+	ReasonLoginFailures = "login_failures"
+	ReasonClientErrors  = "client_errors"
+	ReasonManual        = "manual"
+)
+
+// Valores por defecto de la configuración
+const (
+	defaultLoginFailures = 20
+	defaultClientErrors  = 300
+	defaultWindow        = 10 * time.Minute
+	defaultDuration      = time.Hour
+)
+
+// cacheTTL tiempo que se reutiliza la lista de bloqueos; con varias instancias
+// un bloqueo nuevo tarda como máximo esto en aplicarse en las demás
+const cacheTTL = 5 * time.Second
+
+// ErrNotBanned la IP no tiene ningún bloqueo activo
+var ErrNotBanned = errors.New("la IP no está bloqueada")
+
+// counter actividad de una IP en la ventana actual
+type counter struct {
+	start  time.Time
+	logins int
+	errors int
+}
+
+var (
+	mu        sync.Mutex
+	counters  = map[string]*counter{}
+	lastSweep time.Time
+
+	cacheMu  sync.Mutex
+	active   map[string]database.IPBan
+	loadedAt time.Time
+)
+
+// Enabled indica si el bloqueo automático está activo (IP_BAN_ENABLED=false lo desactiva)
+func Enabled() bool {
+	return os.Getenv("IP_BAN_ENABLED") != "false"
+}
+
+// Allowed indica si la IP está en IP_BAN_ALLOWLIST (IPs o rangos CIDR) y nunca se bloquea
+func Allowed(ip string) bool {
+	return iplist.Contains(iplist.Parse(os.Getenv("IP_BAN_ALLOWLIST")), ip)
+}
+
+// Banned devuelve el bloqueo activo de la IP, si lo tiene
+func Banned(ip string) (database.IPBan, bool) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if time.Since(loadedAt) >= cacheTTL {
+		var list []database.IPBan
+		err := database.DB.Where("lifted_at IS NULL AND expires_at > ?", clock.Now()).Find(&list).Error
+		// Ante un error de lectura se mantiene la última lista conocida
+		if err == nil {
+			active = make(map[string]database.IPBan, len(list))
+			for _, ban := range list {
+				active[ban.IP] = ban
+			}
+		}
+		loadedAt = time.Now()
+	}
+	ban, ok := active[ip]
+	if !ok || !ban.ExpiresAt.After(clock.Now()) {
+		return database.IPBan{}, false
+	}
+	return ban, true
+}
+
+// RecordFailedLogin cuenta un login fallido desde la IP y la bloquea al superar
+// IP_BAN_LOGIN_FAILURES en IP_BAN_WINDOW
+func RecordFailedLogin(ip string) {
+	record(ip, func(c *counter) bool {
+		c.logins++
+		return c.logins >= limit("IP_BAN_LOGIN_FAILURES", defaultLoginFailures)
+	}, ReasonLoginFailures)
+}
+
+// RecordClientError cuenta una respuesta 4xx a la IP y la bloquea al superar
+// IP_BAN_CLIENT_ERRORS en IP_BAN_WINDOW
+func RecordClientError(ip string) {
+	record(ip, func(c *counter) bool {
+		c.errors++
+		return c.errors >= limit("IP_BAN_CLIENT_ERRORS", defaultClientErrors)
+	}, ReasonClientErrors)
+}
+
+func record(ip string, count func(*counter) bool, reason string) {
+	if !Enabled() || ip == "" || Allowed(ip) {
+		return
+	}
+
+	now := clock.Now()
+	window := duration("IP_BAN_WINDOW", defaultWindow)
+
+	mu.Lock()
+	// Se descartan de vez en cuando las IPs sin actividad reciente
+	if now.Sub(lastSweep) > window {
+		for key, c := range counters {
+			if now.Sub(c.start) > window {
+				delete(counters, key)
+			}
+		}
+		lastSweep = now
+	}
+	c, ok := counters[ip]
+	if !ok || now.Sub(c.start) > window {
+		c = &counter{start: now}
+		counters[ip] = c
+	}
+	exceeded := count(c)
+	if exceeded {
+		delete(counters, ip)
+	}
+	mu.Unlock()
+
+	if !exceeded {
+		return
+	}
+	if _, banned := Banned(ip); banned {
+		return
+	}
+	if proxied(ip) {
+		log.Printf("⚠️  La IP %s superó el límite (%s) pero no se bloquea automáticamente: es privada o un proxy "+
+			"y la pueden compartir muchos clientes. Revisa TRUSTED_PROXIES", ip, reason)
+		return
+	}
+	if _, err := Ban(context.Background(), ip, reason, 0, nil); err != nil {
+		log.Printf("❌ No se pudo bloquear la IP %s: %v", ip, err)
+		return
+	}
+	log.Printf("🚫 IP %s bloqueada temporalmente (%s)", ip, reason)
+}
+
+// proxied indica si la IP es privada, local o de un proxy de TRUSTED_PROXIES.
+// Si llega como IP del cliente casi siempre es la del balanceador (falta
+// TRUSTED_PROXIES) y bloquearla dejaría fuera a todos los que pasan por él.
+func proxied(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		iplist.Contains(iplist.Parse(os.Getenv("TRUSTED_PROXIES")), ip)
+}
+
+// Ban bloquea la IP durante d (0 = IP_BAN_DURATION); by es el administrador que
+// lo hace a mano o nil si es automático
+func Ban(ctx context.Context, ip, reason string, d time.Duration, by *uint) (*database.IPBan, error) {
+	if d <= 0 {
+		d = duration("IP_BAN_DURATION", defaultDuration)
+	}
+	ban := database.IPBan{IP: ip, Reason: reason, ExpiresAt: clock.Now().Add(d), CreatedBy: by}
+	if err := database.DB.WithContext(ctx).Create(&ban).Error; err != nil {
+		return nil, err
+	}
+
+	cacheMu.Lock()
+	if active != nil {
+		active[ip] = ban
+	}
+	cacheMu.Unlock()
+	return &ban, nil
+}
+
+// Active devuelve los bloqueos vigentes, los más recientes primero
+func Active(ctx context.Context) ([]database.IPBan, error) {
+	var list []database.IPBan
+	err := database.DB.WithContext(ctx).Where("lifted_at IS NULL AND expires_at > ?", clock.Now()).
+		Order("created_at DESC").Find(&list).Error
+	return list, err
+}
+
+// Lift levanta los bloqueos activos de la IP y olvida su actividad reciente
+func Lift(ctx context.Context, ip string, by uint) error {
+	now := clock.Now()
+	result := database.DB.WithContext(ctx).Model(&database.IPBan{}).
+		Where("ip = ? AND lifted_at IS NULL AND expires_at > ?", ip, now).
+		Updates(map[string]interface{}{"lifted_at": now, "lifted_by": by})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotBanned
+	}
+
+	cacheMu.Lock()
+	delete(active, ip)
+	cacheMu.Unlock()
+	mu.Lock()
+	delete(counters, ip)
+	mu.Unlock()
+	return nil
+}
+
+func limit(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func duration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
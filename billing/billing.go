@@ -0,0 +1,260 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/plans"
+	"api/realtime"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func init() {
+	exports.RegisterSection("subscriptions", func(ctx context.Context, userID uint) (interface{}, error) {
+		var subs []database.Subscription
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&subs).Error
+		return subs, err
+	})
+
+	// Al anonimizar una cuenta se cancelan sus suscripciones en Stripe antes de
+	// borrar las locales; si Stripe falla, la purga se reintenta más tarde
+	accounts.RegisterCleanup("subscriptions", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		var subs []database.Subscription
+		if err := tx.Where("user_id = ? AND status NOT IN ?", userID, []string{"canceled", "incomplete_expired"}).Find(&subs).Error; err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if err := CancelSubscription(ctx, sub.StripeSubscriptionID); err != nil && !errors.Is(err, ErrDisabled) {
+				return fmt.Errorf("cancelando la suscripción %s: %w", sub.StripeSubscriptionID, err)
+			}
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.Subscription{}).Error
+	})
+}
+
+// CustomerJob nombre del trabajo que crea el cliente de Stripe tras el registro
+const CustomerJob = "billing.customer"
+
+// CustomerPayload datos del trabajo de creación de cliente
+type CustomerPayload struct {
+	UserID uint `json:"user_id"`
+}
+
+// CreateCustomerJob crea el cliente de Stripe de un usuario recién registrado
+func CreateCustomerJob(ctx context.Context, payload []byte) error {
+	var p CustomerPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, p.UserID).Error; err != nil {
+		return err
+	}
+	_, err := EnsureCustomer(ctx, &user)
+	if errors.Is(err, ErrDisabled) {
+		return nil
+	}
+	return err
+}
+
+// EnsureCustomer devuelve el cliente de Stripe del usuario, creándolo si aún
+// no existe. Stripe deduplica la creación por usuario (clave de idempotencia)
+// y el ID solo se guarda si nadie lo ha guardado antes.
+func EnsureCustomer(ctx context.Context, user *database.User) (string, error) {
+	if user.StripeCustomerID != "" {
+		return user.StripeCustomerID, nil
+	}
+
+	id, err := CreateCustomer(ctx, user.Email, user.Name, user.ID)
+	if err != nil {
+		return "", err
+	}
+	res := database.DB.WithContext(ctx).Model(&database.User{}).
+		Where("id = ? AND (stripe_customer_id = '' OR stripe_customer_id IS NULL)", user.ID).
+		UpdateColumn("stripe_customer_id", id)
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		// Otra petición guardó el cliente primero: usar el suyo
+		var current database.User
+		if err := database.DB.WithContext(ctx).Select("id", "stripe_customer_id").First(&current, user.ID).Error; err != nil {
+			return "", err
+		}
+		id = current.StripeCustomerID
+	}
+	user.StripeCustomerID = id
+	return id, nil
+}
+
+// PlanForPrice devuelve el plan asociado a un precio de Stripe. Solo los
+// precios configurados en los planes se pueden contratar.
+func PlanForPrice(ctx context.Context, priceID string) (*database.Plan, error) {
+	var plan database.Plan
+	if priceID == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if err := database.DB.WithContext(ctx).Where("stripe_price_id = ?", priceID).First(&plan).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// ActiveSubscription devuelve la suscripción activa del usuario a alguno de
+// los planes, si tiene alguna. Las suscripciones a precios que no están
+// asociados a un plan no dan acceso.
+func ActiveSubscription(ctx context.Context, userID uint) (*database.Subscription, bool) {
+	var sub database.Subscription
+	db := database.DB.WithContext(ctx)
+	planPrices := db.Model(&database.Plan{}).Select("stripe_price_id").Where("stripe_price_id <> ''")
+	err := db.Where("user_id = ? AND status IN ? AND price_id IN (?)", userID, []string{"active", "trialing"}, planPrices).
+		Order("current_period_end DESC").First(&sub).Error
+	if err != nil {
+		return nil, false
+	}
+	return &sub, true
+}
+
+// Event evento recibido en el webhook de Stripe
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// stripeSubscription campos utilizados del objeto subscription de Stripe
+type stripeSubscription struct {
+	ID                string `json:"id"`
+	Customer          string `json:"customer"`
+	Status            string `json:"status"`
+	CancelAtPeriodEnd bool   `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  int64  `json:"current_period_end"`
+	Items             struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+			Price            struct {
+				ID string `json:"id"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// HandleEvent aplica un evento del webhook; los tipos no soportados se ignoran.
+// Los reenvíos de un evento ya procesado se descartan y, como Stripe no
+// garantiza el orden, un evento anterior al último aplicado a la suscripción
+// no la sobrescribe.
+func HandleEvent(ctx context.Context, event Event) error {
+	var seen int64
+	if err := database.DB.WithContext(ctx).Model(&database.StripeEvent{}).Where("id = ?", event.ID).Count(&seen).Error; err != nil {
+		return err
+	}
+	if seen > 0 {
+		return nil
+	}
+
+	switch event.Type {
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var obj stripeSubscription
+		if err := json.Unmarshal(event.Data.Object, &obj); err != nil {
+			return err
+		}
+		if err := syncSubscription(ctx, obj, event.Created); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	// Solo se marca como procesado si se aplicó: un error hace que Stripe lo reenvíe
+	return database.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&database.StripeEvent{ID: event.ID, Type: event.Type, ProcessedAt: clock.Now()}).Error
+}
+
+func syncSubscription(ctx context.Context, obj stripeSubscription, eventAt int64) error {
+	var user database.User
+	if err := database.DB.WithContext(ctx).Where("stripe_customer_id = ?", obj.Customer).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("⚠️  Suscripción %s de un cliente desconocido (%s), se ignora", obj.ID, obj.Customer)
+			return nil
+		}
+		return err
+	}
+
+	sub := database.Subscription{
+		UserID:               user.ID,
+		StripeSubscriptionID: obj.ID,
+		StripeCustomerID:     obj.Customer,
+		Status:               obj.Status,
+		CancelAtPeriodEnd:    obj.CancelAtPeriodEnd,
+		LastEventAt:          eventAt,
+	}
+	// Las versiones recientes de la API informan el fin de periodo en cada elemento
+	periodEnd := obj.CurrentPeriodEnd
+	if len(obj.Items.Data) > 0 {
+		sub.PriceID = obj.Items.Data[0].Price.ID
+		if periodEnd == 0 {
+			periodEnd = obj.Items.Data[0].CurrentPeriodEnd
+		}
+	}
+	if periodEnd > 0 {
+		end := time.Unix(periodEnd, 0).UTC()
+		sub.CurrentPeriodEnd = &end
+	}
+
+	res := database.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "stripe_subscription_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "price_id", "current_period_end", "cancel_at_period_end", "last_event_at", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "subscriptions.last_event_at <= excluded.last_event_at"}}},
+	}).Create(&sub)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		log.Printf("⚠️  Evento de la suscripción %s anterior al último aplicado, se ignora", obj.ID)
+		return nil
+	}
+	if err := syncPlan(ctx, &user, sub); err != nil {
+		return err
+	}
+
+	realtime.Publish(ctx, user.ID, realtime.EventSubscriptionUpdated, map[string]interface{}{
+		"status":               sub.Status,
+		"cancel_at_period_end": sub.CancelAtPeriodEnd,
+		"current_period_end":   sub.CurrentPeriodEnd,
+	})
+	return nil
+}
+
+// syncPlan asigna el plan asociado al precio de la suscripción mientras esté
+// activa y devuelve al usuario al plan gratuito cuando termina
+func syncPlan(ctx context.Context, user *database.User, sub database.Subscription) error {
+	plan, err := PlanForPrice(ctx, sub.PriceID)
+	if err != nil {
+		return nil
+	}
+
+	code := user.PlanCode
+	if sub.Active() {
+		code = plan.Code
+	} else if user.PlanCode == plan.Code {
+		code = plans.Free
+	}
+	if code == user.PlanCode {
+		return nil
+	}
+	return database.DB.WithContext(ctx).Model(user).UpdateColumn("plan_code", code).Error
+}
@@ -0,0 +1,224 @@
+package billing
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/breaker"
+	"api/health"
+)
+
+// Tolerancia máxima entre la firma del webhook y la hora actual
+const webhookTolerance = 5 * time.Minute
+
+var (
+	// ErrDisabled la facturación no está configurada (falta STRIPE_SECRET_KEY)
+	ErrDisabled = errors.New("facturación no configurada")
+	// ErrInvalidSignature la firma del webhook no es válida o ha caducado
+	ErrInvalidSignature = errors.New("firma de webhook inválida")
+)
+
+var client = &http.Client{Timeout: 15 * time.Second, Transport: breaker.Transport("stripe", nil)}
+
+// Enabled indica si la integración con Stripe está configurada
+func Enabled() bool {
+	return os.Getenv("STRIPE_SECRET_KEY") != ""
+}
+
+func init() {
+	// Consultar el saldo no modifica nada en Stripe
+	health.Register("stripe", func(ctx context.Context) error {
+		if !Enabled() {
+			return health.ErrDisabled
+		}
+		var balance struct{}
+		return request(ctx, http.MethodGet, "/v1/balance", nil, "", &balance)
+	})
+}
+
+// DefaultPrice devuelve el precio usado cuando el cliente no indica ninguno
+func DefaultPrice() string {
+	return os.Getenv("STRIPE_PRICE_ID")
+}
+
+func apiBase() string {
+	if u := os.Getenv("STRIPE_API_BASE"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "https://api.stripe.com"
+}
+
+// ErrNotFound el objeto no existe en Stripe
+var ErrNotFound = errors.New("objeto de Stripe no encontrado")
+
+// call realiza una petición POST form-encoded a la API de Stripe y decodifica la respuesta en out
+func call(ctx context.Context, path string, form url.Values, out interface{}) error {
+	return request(ctx, http.MethodPost, path, form, "", out)
+}
+
+// request realiza una petición a la API de Stripe. Con idempotencyKey, Stripe
+// devuelve la misma respuesta a los reintentos de la misma operación.
+func request(ctx context.Context, method, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	if !Enabled() {
+		return ErrDisabled
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiBase()+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(os.Getenv("STRIPE_SECRET_KEY"), "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(body, &apiErr)
+		return fmt.Errorf("stripe: %d %s", resp.StatusCode, apiErr.Error.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// CreateCustomer crea un cliente en Stripe y devuelve su ID. La clave de
+// idempotencia por usuario evita clientes duplicados si dos peticiones
+// llegan a la vez o se reintenta tras un fallo de red.
+func CreateCustomer(ctx context.Context, email, name string, userID uint) (string, error) {
+	form := url.Values{
+		"email":             {email},
+		"name":              {name},
+		"metadata[user_id]": {strconv.FormatUint(uint64(userID), 10)},
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	key := "customer-user-" + strconv.FormatUint(uint64(userID), 10)
+	if err := request(ctx, http.MethodPost, "/v1/customers", form, key, &out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+// CancelSubscription cancela de inmediato una suscripción; si ya no existe no hace nada
+func CancelSubscription(ctx context.Context, subscriptionID string) error {
+	var out struct {
+		Status string `json:"status"`
+	}
+	err := request(ctx, http.MethodDelete, "/v1/subscriptions/"+url.PathEscape(subscriptionID), url.Values{}, "", &out)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// CreateCheckoutSession crea una sesión de Stripe Checkout para suscribirse al precio indicado
+func CreateCheckoutSession(ctx context.Context, customerID, priceID, successURL, cancelURL string) (string, error) {
+	form := url.Values{
+		"mode":                    {"subscription"},
+		"customer":                {customerID},
+		"line_items[0][price]":    {priceID},
+		"line_items[0][quantity]": {"1"},
+		"success_url":             {successURL},
+		"cancel_url":              {cancelURL},
+	}
+	var out struct {
+		URL string `json:"url"`
+	}
+	if err := call(ctx, "/v1/checkout/sessions", form, &out); err != nil {
+		return "", err
+	}
+	return out.URL, nil
+}
+
+// CreatePortalSession crea una sesión del portal de cliente para gestionar la suscripción
+func CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error) {
+	form := url.Values{"customer": {customerID}, "return_url": {returnURL}}
+	var out struct {
+		URL string `json:"url"`
+	}
+	if err := call(ctx, "/v1/billing_portal/sessions", form, &out); err != nil {
+		return "", err
+	}
+	return out.URL, nil
+}
+
+// VerifyWebhook comprueba la cabecera Stripe-Signature (t=...,v1=...) del payload
+func VerifyWebhook(payload []byte, header string) error {
+	secret := os.Getenv("STRIPE_WEBHOOK_SECRET")
+	if secret == "" {
+		return ErrDisabled
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// RedirectURL devuelve la URL configurada en env o, en su defecto, APP_URL + fallback
+func RedirectURL(env, fallback string) string {
+	if u := os.Getenv(env); u != "" {
+		return u
+	}
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return strings.TrimRight(base, "/") + fallback
+}
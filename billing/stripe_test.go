@@ -0,0 +1,56 @@
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func sign(secret string, ts int64, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "whsec_test")
+	payload := `{"id":"evt_1","type":"customer.subscription.updated"}`
+	now := time.Now().Unix()
+	valid := sign("whsec_test", now, payload)
+
+	tests := []struct {
+		name    string
+		payload string
+		header  string
+		wantErr error
+	}{
+		{"válida", payload, fmt.Sprintf("t=%d,v1=%s", now, valid), nil},
+		{"varias firmas (rotación del secreto)", payload, fmt.Sprintf("t=%d,v1=%s,v1=%s", now, sign("otro", now, payload), valid), nil},
+		{"con v0 de prueba", payload, fmt.Sprintf("t=%d,v0=abc,v1=%s", now, valid), nil},
+		{"payload alterado", payload + " ", fmt.Sprintf("t=%d,v1=%s", now, valid), ErrInvalidSignature},
+		{"otro secreto", payload, fmt.Sprintf("t=%d,v1=%s", now, sign("otro", now, payload)), ErrInvalidSignature},
+		{"caducada", payload, fmt.Sprintf("t=%d,v1=%s", now-600, sign("whsec_test", now-600, payload)), ErrInvalidSignature},
+		{"del futuro", payload, fmt.Sprintf("t=%d,v1=%s", now+600, sign("whsec_test", now+600, payload)), ErrInvalidSignature},
+		{"sin timestamp", payload, "v1=" + valid, ErrInvalidSignature},
+		{"sin firma", payload, fmt.Sprintf("t=%d", now), ErrInvalidSignature},
+		{"cabecera vacía", payload, "", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyWebhook([]byte(tt.payload), tt.header); err != tt.wantErr {
+				t.Errorf("err = %v, se esperaba %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyWebhookWithoutSecret(t *testing.T) {
+	t.Setenv("STRIPE_WEBHOOK_SECRET", "")
+	if err := VerifyWebhook([]byte("{}"), "t=1,v1=x"); err != ErrDisabled {
+		t.Errorf("err = %v, se esperaba ErrDisabled", err)
+	}
+}
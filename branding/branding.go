@@ -0,0 +1,114 @@
+// Package branding guarda la personalización de la instalación o, con
+// TENANCY=schema, de cada tenant (en el esquema de su contexto): logotipo y
+// color para la página de inicio de sesión, y nombre del remitente y pie de
+// los correos transaccionales, que se envían con Send.
+package branding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"api/database"
+	"api/mail"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// settingKey clave del ajuste donde se guarda la personalización
+const settingKey = "branding"
+
+// cacheTTL tiempo que se reutiliza la personalización leída; con varias
+// instancias un cambio tarda como máximo esto en propagarse
+const cacheTTL = 5 * time.Second
+
+// Settings personalización; los campos vacíos usan los valores de la instalación
+type Settings struct {
+	LogoURL string `json:"logo_url"`
+	// SenderName nombre que acompaña a la dirección de SMTP_FROM
+	SenderName string `json:"sender_name"`
+	// AccentColor color principal en hexadecimal (#1a73e8)
+	AccentColor string `json:"accent_color"`
+	// EmailFooter texto que se añade al final de los correos
+	EmailFooter string `json:"email_footer"`
+}
+
+type entry struct {
+	settings Settings
+	loadedAt time.Time
+}
+
+var (
+	mu    sync.Mutex
+	cache = map[string]entry{}
+)
+
+// Current devuelve la personalización del esquema de ctx, releyéndola de la
+// base de datos como mucho cada cacheTTL
+func Current(ctx context.Context) Settings {
+	slug := tenancy.From(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	cached, ok := cache[slug]
+	if ok && time.Since(cached.loadedAt) < cacheTTL {
+		return cached.settings
+	}
+
+	var setting database.Setting
+	err := database.DB.WithContext(ctx).Where("key = ?", settingKey).First(&setting).Error
+	switch {
+	case err == nil:
+		var settings Settings
+		if json.Unmarshal([]byte(setting.Value), &settings) == nil {
+			cached.settings = settings
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		cached.settings = Settings{}
+	}
+	// Ante un error de lectura se mantiene la última personalización conocida
+	cached.loadedAt = time.Now()
+	cache[slug] = cached
+	return cached.settings
+}
+
+// Set guarda la personalización del esquema de ctx y la aplica inmediatamente
+// en esta instancia
+func Set(ctx context.Context, settings Settings) error {
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.WithContext(ctx).Save(&database.Setting{Key: settingKey, Value: string(value)}).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	cache[tenancy.From(ctx)] = entry{settings: settings, loadedAt: time.Now()}
+	mu.Unlock()
+	return nil
+}
+
+// Send envía un correo transaccional con la personalización del esquema de ctx
+func Send(ctx context.Context, to, subject, body string) error {
+	return SendWithAttachments(ctx, to, subject, body, nil)
+}
+
+// SendWithAttachments envía un correo con adjuntos con la personalización del
+// esquema de ctx. El nombre del remitente solo se aplica si el mailer lo admite
+// (mail.NamedMailer).
+func SendWithAttachments(ctx context.Context, to, subject, body string, attachments []mail.Attachment) error {
+	settings := Current(ctx)
+	if settings.EmailFooter != "" {
+		body += "\n\n--\n" + settings.EmailFooter
+	}
+	if m, ok := mail.Default.(mail.NamedMailer); ok && settings.SenderName != "" {
+		return m.SendNamed(settings.SenderName, to, subject, body, attachments)
+	}
+	if len(attachments) > 0 {
+		return mail.SendWithAttachments(to, subject, body, attachments)
+	}
+	return mail.Send(to, subject, body)
+}
@@ -0,0 +1,211 @@
+// Package breaker corta las llamadas a un servicio externo (correo, Stripe,
+// proveedores de identidad...) que está fallando o no responde: tras varios
+// fallos seguidos el circuito se abre y las llamadas fallan al momento con
+// ErrOpen, sin ocupar workers ni peticiones esperando el timeout. Pasado un
+// tiempo se deja pasar una sola llamada de prueba (semiabierto): si va bien
+// el circuito se cierra y si no vuelve a abrirse.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"api/clock"
+)
+
+// ErrOpen el circuito del servicio está abierto y la llamada no se ha hecho
+var ErrOpen = errors.New("servicio externo no disponible temporalmente")
+
+// Estados del circuito
+const (
+	Closed   = "closed"
+	Open     = "open"
+	HalfOpen = "half_open"
+)
+
+// Stats estado y métricas de un circuito desde el arranque
+type Stats struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Fallos seguidos desde el último éxito
+	ConsecutiveFailures int   `json:"consecutive_failures"`
+	Requests            int64 `json:"requests"`
+	Successes           int64 `json:"successes"`
+	Failures            int64 `json:"failures"`
+	// Llamadas rechazadas sin hacerlas por estar abierto
+	Rejected    int64      `json:"rejected"`
+	OpenedAt    *time.Time `json:"opened_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Breaker circuito de un servicio externo
+type Breaker struct {
+	mu      sync.Mutex
+	stats   Stats
+	probing bool
+}
+
+var (
+	mu       sync.Mutex
+	breakers = map[string]*Breaker{}
+)
+
+// Get devuelve el circuito del servicio, creándolo la primera vez
+func Get(name string) *Breaker {
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = &Breaker{stats: Stats{Name: name, State: Closed}}
+		breakers[name] = b
+	}
+	return b
+}
+
+// All devuelve el estado de todos los circuitos, ordenados por nombre
+func All() []Stats {
+	mu.Lock()
+	list := make([]*Breaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	mu.Unlock()
+
+	stats := make([]Stats, 0, len(list))
+	for _, b := range list {
+		stats = append(stats, b.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Threshold fallos seguidos que abren el circuito (CIRCUIT_BREAKER_FAILURES, 5 por defecto)
+func Threshold() int {
+	if n, err := strconv.Atoi(os.Getenv("CIRCUIT_BREAKER_FAILURES")); err == nil && n > 0 {
+		return n
+	}
+	return 5
+}
+
+// OpenTimeout tiempo que el circuito sigue abierto antes de probar de nuevo
+// (CIRCUIT_BREAKER_OPEN_TIMEOUT, 30s por defecto)
+func OpenTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CIRCUIT_BREAKER_OPEN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// Stats devuelve una copia del estado del circuito
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	return b.stats
+}
+
+// Do ejecuta fn si el circuito lo permite; un error de fn cuenta como fallo
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Done(err)
+	return err
+}
+
+// Allow indica si se puede hacer la llamada; si devuelve nil hay que llamar
+// después a Done con su resultado
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	switch {
+	case b.stats.State == Open, b.stats.State == HalfOpen && b.probing:
+		b.stats.Rejected++
+		return ErrOpen
+	case b.stats.State == HalfOpen:
+		// Solo una llamada de prueba a la vez
+		b.probing = true
+	}
+	b.stats.Requests++
+	return nil
+}
+
+// Done registra el resultado de una llamada permitida por Allow. Las
+// llamadas que canceló quien las hizo no cuentan ni como éxito ni como fallo.
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil {
+		b.stats.Successes++
+		b.stats.ConsecutiveFailures = 0
+		if b.stats.State != Closed {
+			log.Printf("🔌 Circuito %s cerrado: el servicio responde de nuevo", b.stats.Name)
+			b.stats.State, b.stats.OpenedAt = Closed, nil
+		}
+		return
+	}
+
+	now := clock.Now()
+	b.stats.Failures++
+	b.stats.ConsecutiveFailures++
+	b.stats.LastError, b.stats.LastErrorAt = err.Error(), &now
+	if b.stats.State == HalfOpen || b.stats.ConsecutiveFailures >= Threshold() {
+		if b.stats.State != Open {
+			log.Printf("⚠️  Circuito %s abierto tras %d fallos seguidos: %v", b.stats.Name, b.stats.ConsecutiveFailures, err)
+		}
+		b.stats.State, b.stats.OpenedAt = Open, &now
+	}
+}
+
+// refresh pasa a semiabierto el circuito abierto cuyo tiempo ha pasado
+func (b *Breaker) refresh() {
+	if b.stats.State == Open && clock.Since(*b.stats.OpenedAt) >= OpenTimeout() {
+		b.stats.State = HalfOpen
+	}
+}
+
+// Transport envuelve base (nil: http.DefaultTransport) para pasar las
+// peticiones por el circuito del servicio. Cuentan como fallo los errores de
+// red (incluidos los timeouts) y las respuestas 5xx y 429; el resto de
+// respuestas, aunque sean errores del cliente, indican que el servicio responde.
+func Transport(name string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{breaker: Get(name), base: base}
+}
+
+type transport struct {
+	breaker *Breaker
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil:
+		t.breaker.Done(err)
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		t.breaker.Done(errors.New(resp.Status))
+	default:
+		t.breaker.Done(nil)
+	}
+	return resp, err
+}
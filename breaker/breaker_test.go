@@ -0,0 +1,101 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api/clock"
+)
+
+var errDown = errors.New("conexión rechazada")
+
+func TestBreakerOpensAndProbes(t *testing.T) {
+	t.Setenv("CIRCUIT_BREAKER_FAILURES", "3")
+	t.Setenv("CIRCUIT_BREAKER_OPEN_TIMEOUT", "30s")
+	now := clock.NewFixed(time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC))
+	t.Cleanup(clock.Set(now))
+	b := Get(t.Name())
+
+	calls := 0
+	fail := func() error { calls++; return errDown }
+	for i := 0; i < 3; i++ {
+		if err := b.Do(fail); !errors.Is(err, errDown) {
+			t.Fatalf("llamada %d: err = %v", i, err)
+		}
+	}
+	// Abierto: no se llama al servicio
+	if err := b.Do(fail); !errors.Is(err, ErrOpen) || calls != 3 {
+		t.Fatalf("err = %v, llamadas = %d", err, calls)
+	}
+	if s := b.Stats(); s.State != Open || s.Failures != 3 || s.Rejected != 1 || s.LastError != errDown.Error() {
+		t.Errorf("stats = %+v", s)
+	}
+
+	// Semiabierto: una sola llamada de prueba a la vez, y si falla se vuelve a abrir
+	now.Advance(30 * time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("segunda llamada durante la prueba: err = %v", err)
+	}
+	b.Done(errDown)
+	if s := b.Stats(); s.State != Open {
+		t.Errorf("tras fallar la prueba: %s", s.State)
+	}
+
+	// Si la prueba va bien se cierra
+	now.Advance(30 * time.Second)
+	if err := b.Do(func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.Stats(); s.State != Closed || s.ConsecutiveFailures != 0 || s.OpenedAt != nil {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestBreakerIgnoresCancelled(t *testing.T) {
+	t.Setenv("CIRCUIT_BREAKER_FAILURES", "1")
+	b := Get(t.Name())
+	b.Do(func() error { return context.Canceled })
+	if s := b.Stats(); s.State != Closed || s.Failures != 0 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	t.Setenv("CIRCUIT_BREAKER_FAILURES", "2")
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: Transport(t.Name(), nil)}
+	get := func() error {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// Los errores del cliente no abren el circuito
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status = http.StatusBadGateway
+	get()
+	get()
+	if err := get(); !errors.Is(err, ErrOpen) {
+		t.Errorf("err = %v, se esperaba ErrOpen", err)
+	}
+	if s := Get(t.Name()).Stats(); s.Successes != 3 || s.Failures != 2 || s.LastError != "502 Bad Gateway" {
+		t.Errorf("stats = %+v", s)
+	}
+}
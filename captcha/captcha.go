@@ -0,0 +1,138 @@
+// Package captcha verifica los tokens de reCAPTCHA, hCaptcha o Cloudflare
+// Turnstile. Los tres servicios comparten la misma API de verificación
+// (secret + response + remoteip) y solo cambia la URL.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/breaker"
+)
+
+// Proveedores admitidos en CAPTCHA_PROVIDER
+const (
+	ReCAPTCHA = "recaptcha"
+	HCaptcha  = "hcaptcha"
+	Turnstile = "turnstile"
+)
+
+// Valores por defecto de CAPTCHA_LOGIN_FAILURES y CAPTCHA_LOGIN_WINDOW
+const (
+	defaultLoginFailures = 3
+	defaultLoginWindow   = 15 * time.Minute
+)
+
+var verifyURLs = map[string]string{
+	ReCAPTCHA: "https://www.google.com/recaptcha/api/siteverify",
+	HCaptcha:  "https://api.hcaptcha.com/siteverify",
+	Turnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+var (
+	// ErrMissingToken la petición no incluye el token del CAPTCHA
+	ErrMissingToken = errors.New("falta el token del CAPTCHA")
+	// ErrRejected el proveedor no ha validado el token
+	ErrRejected = errors.New("CAPTCHA no superado")
+)
+
+var client = &http.Client{Timeout: 10 * time.Second, Transport: breaker.Transport("captcha", nil)}
+
+// Enabled indica si hay un proveedor de CAPTCHA configurado
+func Enabled() bool {
+	return verifyURL() != "" && os.Getenv("CAPTCHA_SECRET") != ""
+}
+
+// Provider proveedor configurado (recaptcha, hcaptcha o turnstile)
+func Provider() string {
+	return strings.ToLower(os.Getenv("CAPTCHA_PROVIDER"))
+}
+
+// SiteKey clave pública que el cliente necesita para mostrar el widget
+func SiteKey() string {
+	return os.Getenv("CAPTCHA_SITE_KEY")
+}
+
+// RequiredOnRegister indica si el registro exige CAPTCHA (CAPTCHA_REGISTER, activo por defecto)
+func RequiredOnRegister() bool {
+	return os.Getenv("CAPTCHA_REGISTER") != "false"
+}
+
+// LoginFailures intentos fallidos tras los que el login exige CAPTCHA
+// (CAPTCHA_LOGIN_FAILURES; 0 = siempre)
+func LoginFailures() int {
+	if n, err := strconv.Atoi(os.Getenv("CAPTCHA_LOGIN_FAILURES")); err == nil && n >= 0 {
+		return n
+	}
+	return defaultLoginFailures
+}
+
+// LoginWindow periodo en el que se cuentan los intentos fallidos (CAPTCHA_LOGIN_WINDOW)
+func LoginWindow() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CAPTCHA_LOGIN_WINDOW")); err == nil && d > 0 {
+		return d
+	}
+	return defaultLoginWindow
+}
+
+// verifyURL URL de verificación del proveedor; CAPTCHA_VERIFY_URL la sustituye
+// (servicios compatibles alojados aparte o pruebas)
+func verifyURL() string {
+	if u := os.Getenv("CAPTCHA_VERIFY_URL"); u != "" {
+		return u
+	}
+	return verifyURLs[Provider()]
+}
+
+// Verify comprueba el token con el proveedor. remoteIP es opcional.
+func Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrMissingToken
+	}
+
+	form := url.Values{"secret": {os.Getenv("CAPTCHA_SECRET")}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, verifyURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("verificación de CAPTCHA: estado %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		Score      *float64 `json:"score"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("verificación de CAPTCHA: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrRejected, strings.Join(result.ErrorCodes, ", "))
+	}
+	// reCAPTCHA v3 devuelve una puntuación en lugar de un reto superado o no
+	if result.Score != nil {
+		if min, err := strconv.ParseFloat(os.Getenv("CAPTCHA_MIN_SCORE"), 64); err == nil && *result.Score < min {
+			return fmt.Errorf("%w: puntuación %.2f", ErrRejected, *result.Score)
+		}
+	}
+	return nil
+}
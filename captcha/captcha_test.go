@@ -0,0 +1,68 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("secret") != "secreto" {
+			t.Errorf("secret = %q", r.FormValue("secret"))
+		}
+		switch r.FormValue("response") {
+		case "ok":
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+		case "bot":
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "score": 0.1})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error-codes": []string{"invalid-input-response"}})
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("CAPTCHA_PROVIDER", Turnstile)
+	t.Setenv("CAPTCHA_SECRET", "secreto")
+	t.Setenv("CAPTCHA_VERIFY_URL", srv.URL)
+	t.Setenv("CAPTCHA_MIN_SCORE", "0.5")
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"válido", "ok", nil},
+		{"sin token", "", ErrMissingToken},
+		{"rechazado", "falso", ErrRejected},
+		{"puntuación baja", "bot", ErrRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(context.Background(), tt.token, "203.0.113.7"); !errors.Is(err, tt.want) {
+				t.Errorf("Verify(%q) = %v, se esperaba %v", tt.token, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	t.Setenv("CAPTCHA_VERIFY_URL", "")
+	t.Setenv("CAPTCHA_SECRET", "secreto")
+
+	t.Setenv("CAPTCHA_PROVIDER", "")
+	if Enabled() {
+		t.Error("sin proveedor no debería estar activo")
+	}
+	t.Setenv("CAPTCHA_PROVIDER", "desconocido")
+	if Enabled() {
+		t.Error("con un proveedor desconocido no debería estar activo")
+	}
+	t.Setenv("CAPTCHA_PROVIDER", "hCaptcha")
+	if !Enabled() {
+		t.Error("hcaptcha debería estar activo")
+	}
+}
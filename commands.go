@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"api/backup"
+	"api/database"
+	"api/encryption"
+	"api/ids"
+	"api/scaffold"
+	"api/search"
+	"api/services"
+	"api/storage"
+)
+
+// runCommand ejecuta subcomandos de mantenimiento (api <comando>) y devuelve
+// false si el argumento no corresponde a ningún comando conocido
+func runCommand(args []string) bool {
+	switch args[0] {
+	case "rotate-keys":
+		if err := database.InitDB(); err != nil {
+			log.Fatal("Failed to connect to database:", err)
+		}
+		total, err := encryption.Rotate(database.DB)
+		if err != nil {
+			log.Fatal("Key rotation failed:", err)
+		}
+		log.Printf("✅ Rotación completada: %d filas re-cifradas con la clave %s", total, encryption.ActiveKeyID())
+	case "search-reindex":
+		if err := database.InitDB(); err != nil {
+			log.Fatal("Failed to connect to database:", err)
+		}
+		if err := search.Init(context.Background()); err != nil {
+			log.Fatal("Failed to initialize search backend:", err)
+		}
+		total, err := search.Reindex(context.Background())
+		if err != nil {
+			log.Fatal("Reindex failed:", err)
+		}
+		log.Printf("✅ Índice de búsqueda reconstruido: %d usuarios", total)
+	case "platform-admin":
+		if len(args) != 2 {
+			log.Fatal("Uso: api platform-admin <email>")
+		}
+		if err := database.InitDB(); err != nil {
+			log.Fatal("Failed to connect to database:", err)
+		}
+		res := database.DB.Model(&database.User{}).Where("LOWER(email) = LOWER(?)", args[1]).Update("role", services.RolePlatformAdmin)
+		if res.Error != nil {
+			log.Fatal("Role update failed:", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			log.Fatalf("No existe ningún usuario %s en el esquema public", args[1])
+		}
+		log.Printf("✅ %s es administrador de la plataforma", args[1])
+	case "backup":
+		backupCommand(args[1:])
+	case "restore":
+		restoreCommand(args[1:])
+	case "generate":
+		generateCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println("Uso: api [comando]")
+		fmt.Println()
+		fmt.Println("Sin comando inicia el servidor HTTP.")
+		fmt.Println()
+		fmt.Println("Comandos:")
+		fmt.Println("  rotate-keys        Re-cifra los campos cifrados con la clave maestra activa")
+		fmt.Println("  search-reindex     Vuelve a indexar los usuarios en el motor de búsqueda (SEARCH_BACKEND)")
+		fmt.Println("  platform-admin <email>  Da al usuario del esquema public el rol platform_admin (gestión de tenants)")
+		fmt.Println("  backup [fich]      Hace una copia cifrada de la base de datos en el almacenamiento o en el fichero indicado")
+		fmt.Println("  restore <ID|fich>  Restaura la base de datos desde una copia del almacenamiento o un fichero (con el servidor parado)")
+		fmt.Println("  generate resource <nombre>  Genera el modelo, servicio, handlers, rutas y pruebas de un recurso CRUD (desde la raíz del proyecto)")
+	default:
+		return false
+	}
+	return true
+}
+
+// backupCommand hace una copia de seguridad: en el fichero indicado o, sin
+// argumentos, en el almacenamiento, registrada como las que piden los
+// administradores
+func backupCommand(args []string) {
+	if err := database.InitDB(); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	ctx := context.Background()
+
+	if len(args) > 0 {
+		f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			log.Fatal("Backup failed:", err)
+		}
+		err = backup.Write(ctx, f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(args[0])
+			log.Fatal("Backup failed:", err)
+		}
+		log.Printf("✅ Copia de seguridad guardada en %s", args[0])
+		return
+	}
+
+	if err := storage.InitStorage(); err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+	b := database.Backup{ID: ids.New(), Status: "pending"}
+	if err := database.DB.Create(&b).Error; err != nil {
+		log.Fatal("Backup failed:", err)
+	}
+	if err := backup.Run(ctx, &b); err != nil {
+		log.Fatal("Backup failed:", err)
+	}
+	log.Printf("✅ Copia de seguridad %s guardada en %s", b.ID, backup.ObjectKey(b.ID))
+}
+
+// restoreCommand restaura la base de datos desde un fichero local o, si no
+// existe, desde la copia del almacenamiento con ese ID
+func restoreCommand(args []string) {
+	if len(args) != 1 {
+		log.Fatal("Uso: api restore <ID de la copia o fichero>")
+	}
+	ctx := context.Background()
+
+	var r io.ReadCloser
+	if f, err := os.Open(args[0]); err == nil {
+		r = f
+	} else {
+		if err := storage.InitStorage(); err != nil {
+			log.Fatal("Failed to initialize storage:", err)
+		}
+		if r, err = storage.Default.Get(ctx, backup.ObjectKey(args[0])); err != nil {
+			log.Fatalf("Copia %s no encontrada: %v", args[0], err)
+		}
+	}
+	defer r.Close()
+
+	if err := backup.Restore(ctx, r); err != nil {
+		log.Fatal("Restore failed:", err)
+	}
+	log.Printf("✅ Base de datos restaurada desde %s", args[0])
+}
+
+// generateCommand genera el esqueleto de un recurso en el proyecto del
+// directorio actual
+func generateCommand(args []string) {
+	if len(args) != 2 || args[0] != "resource" {
+		log.Fatal("Uso: api generate resource <nombre en singular, p. ej. blog-post>")
+	}
+	resource, err := scaffold.New(args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	files, err := scaffold.Generate(".", resource)
+	if err != nil {
+		log.Fatal("Generation failed:", err)
+	}
+	for _, f := range files {
+		log.Printf("  %s", f)
+	}
+	log.Printf("✅ Recurso %s generado en /%s; regenera la especificación con go generate ./openapi", resource.Name, resource.Path)
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"net/http"
+	"strconv"
+
+	"api/bans"
+	"api/clock"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IPBanMiddleware rechaza las peticiones de las IPs bloqueadas y cuenta las
+// respuestas 4xx de las demás para detectar avalanchas de errores (barridos de
+// rutas, fuerza bruta). Las IPs de IP_BAN_ALLOWLIST nunca se bloquean.
+func IPBanMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if bans.Allowed(ip) {
+			c.Next()
+			return
+		}
+		if ban, banned := bans.Banned(ip); banned {
+			c.Header("Retry-After", strconv.Itoa(int(clock.Until(ban.ExpiresAt).Seconds())+1))
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Tu IP está bloqueada temporalmente por actividad sospechosa",
+				"expires_at": ban.ExpiresAt,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+
+		if status := c.Writer.Status(); status >= 400 && status < 500 {
+			bans.RecordClientError(ip)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"api/jsonapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JSONAPIMiddleware activa el formato JSON:API cuando el cliente lo pide en Accept.
+// Los handlers de listados y detalles serializan sus recursos (ver handlers.respondJSONAPI)
+// y aquí se convierten los errores {"error": "mensaje", ...} en {"errors": [...]}.
+// Usar después de APIVersion para que el sobre de errores de v2 no se aplique.
+func JSONAPIMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !jsonapi.Accepts(c.GetHeader("Accept")) {
+			c.Next()
+			return
+		}
+		c.Set("jsonapi", true)
+
+		writer := &jsonAPIWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		writer.flush()
+	}
+}
+
+// jsonAPIWriter fija el tipo de medio de JSON:API y retiene los errores para reescribirlos
+type jsonAPIWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *jsonAPIWriter) Write(data []byte) (int, error) {
+	w.Header().Set("Content-Type", jsonapi.MediaType)
+	if w.Status() < 400 {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *jsonAPIWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *jsonAPIWriter) flush() {
+	if w.body.Len() == 0 {
+		return
+	}
+	w.ResponseWriter.Write(jsonAPIErrors(w.Status(), w.body.Bytes()))
+}
+
+// jsonAPIErrors convierte {"error": "mensaje", ...} en un documento de errores de
+// JSON:API; los demás campos se conservan en meta
+func jsonAPIErrors(status int, body []byte) []byte {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	message, ok := fields["error"].(string)
+	if !ok {
+		return body
+	}
+	delete(fields, "error")
+
+	apiErr := jsonapi.Error{Status: strconv.Itoa(status), Title: message}
+	if detail, ok := fields["message"].(string); ok {
+		apiErr.Detail = detail
+		delete(fields, "message")
+	}
+	if len(fields) > 0 {
+		apiErr.Meta = fields
+	}
+	if apiErr.Title == "" {
+		apiErr.Title = http.StatusText(status)
+	}
+
+	out, err := json.Marshal(jsonapi.Document{
+		Errors:  []jsonapi.Error{apiErr},
+		JSONAPI: map[string]string{"version": "1.1"},
+	})
+	if err != nil {
+		return body
+	}
+	return out
+}
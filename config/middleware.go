@@ -1,21 +1,48 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"api/auth"
+	"api/billing"
+	"api/clock"
+	"api/deprecation"
+	"api/iplist"
+	"api/maintenance"
+	"api/oauth"
+	"api/plans"
+	"api/quotas"
+	"api/sandbox"
+	"api/services"
+	"api/tenancy"
+	"api/terms"
+	"api/usage"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 // SetupMiddleware configura todos los middleware necesarios para la aplicación
 func SetupMiddleware(router *gin.Engine) {
+	// Solo se atiende X-Forwarded-For si la conexión llega desde un proxy de
+	// TRUSTED_PROXIES; sin configurar, la IP del cliente es la de la conexión
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// Configurar CORS
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-API-Key", "X-Maintenance-Bypass", "X-Captcha-Token", "X-Device-Token", "X-Token-Delivery", "X-Timezone", "X-Tenant", "X-Tenant-Write"},
+		ExposeHeaders:    []string{"Content-Length", "API-Version", "Deprecation", "Sunset", "Link", "X-Sandbox", "X-Timezone", "X-Tenant-Quota-Limit", "X-Tenant-Quota-Remaining", "X-Permissions-Stale"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -37,11 +64,40 @@ func SetupMiddleware(router *gin.Engine) {
 
 	// Middleware para recuperación de pánicos
 	router.Use(gin.Recovery())
+
+	// Bloqueo temporal de las IPs con comportamiento abusivo
+	router.Use(IPBanMiddleware())
+
+	// En modo sandbox las escrituras se deshacen al terminar cada petición
+	if sandbox.Enabled() {
+		router.Use(SandboxMiddleware())
+	}
+
+	// Modo mantenimiento activable en caliente desde /admin/maintenance
+	router.Use(MaintenanceMiddleware())
+
+	// Cabeceras Deprecation/Sunset/Link en las rutas marcadas como obsoletas
+	router.Use(DeprecationMiddleware())
+
+	// Esquema del tenant de la petición (TENANCY=schema) y su límite de peticiones
+	if tenancy.Enabled() {
+		router.Use(TenantMiddleware(), TenantQuotaMiddleware())
+	}
+
+	// Validación de peticiones (y respuestas en desarrollo) contra la especificación OpenAPI
+	if OpenAPIValidationEnabled() {
+		router.Use(OpenAPIValidationMiddleware())
+	}
 }
 
-// AuthMiddleware middleware para autenticación JWT
+// AuthMiddleware middleware para autenticación JWT o mediante clave de API
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		token := c.GetHeader("Authorization")
 		if token == "" {
 			c.JSON(401, gin.H{"error": "Token de autorización requerido"})
@@ -49,14 +105,519 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Aquí iría la lógica de validación del JWT
-		// Por ahora solo verificamos que el token existe
 		if len(token) < 7 || token[:7] != "Bearer " {
 			c.JSON(401, gin.H{"error": "Formato de token inválido"})
 			c.Abort()
 			return
 		}
 
+		if auth.IsAPIKey(token[7:]) {
+			authenticateAPIKey(c, token[7:])
+			return
+		}
+		if oauth.IsAccessToken(token[7:]) {
+			authenticateOAuthToken(c, token[7:])
+			return
+		}
+
+		identity, err := services.AuthenticateToken(c.Request.Context(), token[7:], c.ClientIP())
+		if errors.Is(err, services.ErrInactiveUser) {
+			c.JSON(401, gin.H{"error": "Usuario inactivo o eliminado"})
+			c.Abort()
+			return
+		}
+		if errors.Is(err, services.ErrIPNotAllowed) {
+			c.JSON(403, gin.H{"error": "Esta clave de API no admite peticiones desde tu IP"})
+			c.Abort()
+			return
+		}
+		if errors.Is(err, services.ErrWrongTenant) {
+			c.JSON(401, gin.H{"error": "El token pertenece a otro tenant"})
+			c.Abort()
+			return
+		}
+		if errors.Is(err, services.ErrSessionRevoked) {
+			c.JSON(401, gin.H{"error": "La sesión se ha cerrado"})
+			c.Abort()
+			return
+		}
+		if errors.Is(err, services.ErrSessionExpired) {
+			c.JSON(401, gin.H{"error": "La sesión ha caducado por inactividad"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Token inválido o expirado"})
+			c.Abort()
+			return
+		}
+
+		if suspended(c, identity) || restricted(c, identity) {
+			return
+		}
+		if identity.PasswordChangeRequired && !passwordChangeAllowed(c) {
+			c.JSON(403, gin.H{
+				"error":                    "Tienes que cambiar la contraseña antes de continuar",
+				"password_change_required": true,
+			})
+			c.Abort()
+			return
+		}
+		if identity.TermsPending && !termsAllowed(c) {
+			c.JSON(403, gin.H{
+				"error":          "Tienes que aceptar los términos de uso para continuar",
+				"terms_required": true,
+				"terms":          terms.Current(),
+			})
+			c.Abort()
+			return
+		}
+		if identity.ActingTenant != "" {
+			actInTenant(c, identity)
+			return
+		}
+
+		// Exponer la identidad del usuario al resto de la cadena
+		c.Set("userID", identity.UserID)
+		c.Set("userRole", identity.Role)
+		c.Set("claims", identity.Claims)
+		c.Set("userTimezone", identity.Timezone)
+		c.Set("platformAdmin", identity.PlatformAdmin)
+		c.Set("permissions", identity.Permissions)
+		c.Set("restricted", identity.Restricted)
+		if identity.StalePermissions {
+			// El cliente debería renovar el token (POST /auth/refresh)
+			c.Header("X-Permissions-Stale", "true")
+		}
+
+		c.Next()
+	}
+}
+
+// passwordChangeAllowed deja pasar, con la contraseña caducada, el cambio de
+// contraseña, la consulta del perfil y la renovación del token, en cualquier
+// versión de la API
+func passwordChangeAllowed(c *gin.Context) bool {
+	path := c.FullPath()
+	switch c.Request.Method {
+	case http.MethodPost:
+		return strings.HasSuffix(path, "/profile/password") || strings.HasSuffix(path, "/auth/refresh")
+	case http.MethodGet:
+		return strings.HasSuffix(path, "/profile")
+	}
+	return false
+}
+
+// termsAllowed deja pasar, sin haber aceptado los términos vigentes, su
+// aceptación, la consulta del perfil y la renovación del token. Las claves de
+// API y los tokens OAuth no pasan por aquí: las integraciones no pueden
+// mostrar la pantalla de aceptación.
+func termsAllowed(c *gin.Context) bool {
+	path := c.FullPath()
+	switch c.Request.Method {
+	case http.MethodPost:
+		return strings.HasSuffix(path, "/profile/terms") || strings.HasSuffix(path, "/auth/refresh")
+	case http.MethodGet:
+		return strings.HasSuffix(path, "/profile")
+	}
+	return false
+}
+
+// suspended responde 403 con el motivo si el usuario está suspendido, salvo en
+// las rutas con las que consulta y apela la suspensión
+func suspended(c *gin.Context, identity *services.Identity) bool {
+	if identity.Suspension == nil || strings.HasSuffix(c.FullPath(), "/profile/suspension") ||
+		strings.HasSuffix(c.FullPath(), "/profile/suspension/appeal") {
+		return false
+	}
+	c.JSON(403, gin.H{"error": "Tu cuenta está suspendida", "suspension": identity.Suspension})
+	c.Abort()
+	return true
+}
+
+// restricted responde 403 a las peticiones que modifican algo si la cuenta está
+// restringida. Se admiten la renovación del token, el cambio de contraseña y la
+// aceptación de los términos, y /batch y /graphql, que aplican la restricción
+// a cada petición y a las mutaciones.
+func restricted(c *gin.Context, identity *services.Identity) bool {
+	if !identity.Restricted || isReadOnly(c.Request.Method) {
+		return false
+	}
+	path := c.FullPath()
+	for _, allowed := range []string{"/auth/refresh", "/profile/password", "/profile/terms", "/batch", "/graphql"} {
+		if strings.HasSuffix(path, allowed) {
+			return false
+		}
+	}
+	c.JSON(403, gin.H{"error": "Tu cuenta está restringida: puedes consultar, pero no hacer cambios", "restricted": true})
+	c.Abort()
+	return true
+}
+
+// OptionalAuthMiddleware autentica igual que AuthMiddleware cuando la petición trae
+// credenciales y, si no las trae, la deja continuar como anónima
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	authenticate := AuthMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" && c.GetHeader("X-API-Key") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// VerboseHealthMiddleware exige autenticación y las IPs de administración
+// (ADMIN_ALLOW_IPS) para el modo detallado de /health (?verbose=1); el
+// handler comprueba el rol. La comprobación simple sigue siendo pública para
+// los balanceadores y orquestadores.
+func VerboseHealthMiddleware() gin.HandlerFunc {
+	authenticate := AuthMiddleware()
+	return func(c *gin.Context) {
+		if verbose := c.Query("verbose"); verbose != "1" && verbose != "true" {
+			c.Next()
+			return
+		}
+		allowed := iplist.Parse(os.Getenv("ADMIN_ALLOW_IPS"))
+		if len(allowed) > 0 && !iplist.Contains(allowed, c.ClientIP()) {
+			c.JSON(403, gin.H{"error": "Las rutas de administración no están disponibles desde tu IP"})
+			c.Abort()
+			return
+		}
+		authenticate(c)
+	}
+}
+
+// authenticateAPIKey valida una clave de API y expone la identidad de su propietario
+func authenticateAPIKey(c *gin.Context, key string) {
+	identity, err := services.AuthenticateAPIKey(c.Request.Context(), key, c.ClientIP())
+	if errors.Is(err, services.ErrIPNotAllowed) {
+		c.JSON(403, gin.H{"error": "Esta clave de API no admite peticiones desde tu IP"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(401, gin.H{"error": "Clave de API inválida o revocada"})
+		c.Abort()
+		return
+	}
+	if suspended(c, identity) || restricted(c, identity) {
+		return
+	}
+
+	c.Set("userID", identity.UserID)
+	c.Set("userRole", identity.Role)
+	c.Set("apiKeyID", identity.APIKeyID)
+	c.Set("restricted", identity.Restricted)
+	c.Set("userTimezone", identity.Timezone)
+
+	c.Next()
+}
+
+// authenticateOAuthToken valida un token emitido a una aplicación OAuth, que
+// solo puede usar las rutas de los scopes que el usuario le concedió
+func authenticateOAuthToken(c *gin.Context, token string) {
+	identity, err := services.AuthenticateOAuthToken(c.Request.Context(), token)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(401, gin.H{"error": "Token de acceso inválido o caducado"})
+		c.Abort()
+		return
+	}
+	if suspended(c, identity) || restricted(c, identity) {
+		return
+	}
+	if !oauth.Allows(identity.Scopes, c.Request.Method, c.FullPath()) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		c.JSON(403, gin.H{"error": "La aplicación no tiene permiso para esta operación", "scopes": identity.Scopes})
+		c.Abort()
+		return
+	}
+
+	c.Set("userID", identity.UserID)
+	c.Set("userRole", identity.Role)
+	c.Set("oauthClientID", identity.OAuthClientID)
+	c.Set("restricted", identity.Restricted)
+	c.Set("userTimezone", identity.Timezone)
+
+	c.Next()
+}
+
+// SessionOnlyMiddleware rechaza las peticiones autenticadas con una clave de
+// API: una clave filtrada no debe poder crear otras claves, revocar las del
+// usuario ni eliminar la cuenta (usar después de AuthMiddleware)
+func SessionOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("apiKeyID") != 0 {
+			c.JSON(403, gin.H{"error": "Esta operación requiere iniciar sesión; no se admiten claves de API"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminIPMiddleware restringe las rutas de administración a las IPs o rangos
+// CIDR de ADMIN_ALLOW_IPS (p. ej. la VPN), aunque las credenciales se filtren.
+// Sin configurar no limita nada.
+func AdminIPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed := iplist.Parse(os.Getenv("ADMIN_ALLOW_IPS"))
+		if len(allowed) > 0 && !iplist.Contains(allowed, c.ClientIP()) {
+			c.JSON(403, gin.H{"error": "Las rutas de administración no están disponibles desde tu IP"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminMiddleware restringe el acceso a usuarios con rol admin (usar después de AuthMiddleware)
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("userRole") != "admin" {
+			c.JSON(403, gin.H{"error": "Acceso restringido a administradores"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// UserAccessMiddleware decide con el motor de políticas si el usuario puede
+// hacer action sobre la cuenta de la ruta (/users/:id) (usar después de
+// AuthMiddleware)
+func UserAccessMiddleware(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(404, gin.H{"error": "Usuario no encontrado"})
+			c.Abort()
+			return
+		}
+		actor := services.Identity{
+			UserID: c.GetUint("userID"), Role: c.GetString("userRole"),
+			APIKeyID: c.GetUint("apiKeyID"), OAuthClientID: c.GetUint("oauthClientID"),
+			Permissions: c.GetStringSlice("permissions"),
+		}
+		err = services.AuthorizeUser(c.Request.Context(), actor, action, uint(id))
+		if errors.Is(err, services.ErrForbidden) {
+			c.JSON(403, gin.H{"error": "No tienes permiso para esta operación sobre el usuario", "action": action})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Error al comprobar los permisos"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// UsageMiddleware registra el uso de la API por usuario (usar después de AuthMiddleware)
+func UsageMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		// Se usa la plantilla de la ruta (/users/:id) para no fragmentar por IDs;
+		// las rutas inexistentes (404) no tienen plantilla y no se registran
+		if c.FullPath() == "" {
+			return
+		}
+		endpoint := c.Request.Method + " " + c.FullPath()
+		usage.Track(c.Request.Context(), c.GetUint("userID"), endpoint)
+		if keyID := c.GetUint("apiKeyID"); keyID != 0 {
+			usage.TrackKey(c.Request.Context(), keyID, endpoint)
+		}
+	}
+}
+
+// QuotaMiddleware aplica la cuota diaria de peticiones del usuario (usar después de AuthMiddleware)
+func QuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("userRole") == "admin" {
+			c.Next()
+			return
+		}
+
+		status, ok, err := quotas.Consume(c.Request.Context(), quotas.ScopeUser, c.GetUint("userID"), quotas.RequestsPerDay, 1)
+		if err != nil || status.Unlimited() {
+			c.Next()
+			return
+		}
+
+		c.Header("X-Quota-Limit", strconv.FormatInt(status.Limit, 10))
+		if !ok {
+			reset := quotas.NextReset()
+			c.Header("X-Quota-Remaining", "0")
+			c.Header("Retry-After", strconv.Itoa(int(clock.Until(reset).Seconds())+1))
+			c.JSON(429, gin.H{
+				"error":    "Cuota diaria de peticiones agotada",
+				"quota":    status,
+				"reset_at": reset,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Header("X-Quota-Remaining", strconv.FormatInt(status.Remaining, 10))
+		c.Next()
+	}
+}
+
+// RequireSubscription restringe el acceso a usuarios con una suscripción de pago activa (usar después de AuthMiddleware)
+func RequireSubscription() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := billing.ActiveSubscription(c.Request.Context(), c.GetUint("userID")); !ok {
+			c.JSON(402, gin.H{"error": "Esta función requiere una suscripción activa"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireFeature restringe el acceso a usuarios cuyo plan incluye la función indicada (usar después de AuthMiddleware)
+func RequireFeature(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("userRole") == "admin" {
+			c.Next()
+			return
+		}
+
+		plan, err := plans.ForUser(c.Request.Context(), c.GetUint("userID"))
+		if err != nil || !plan.HasFeature(feature) {
+			current := ""
+			if plan != nil {
+				current = plan.Code
+			}
+			c.JSON(403, gin.H{
+				"error":   "Tu plan no incluye esta función",
+				"feature": feature,
+				"plan":    current,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MaintenanceMiddleware responde 503 mientras el modo mantenimiento está activo,
+// salvo al health check, a las IPs permitidas, a quien presente el token de
+// MAINTENANCE_BYPASS_TOKEN en X-Maintenance-Bypass y a los administradores
+func MaintenanceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := maintenance.Current()
+		if !state.Enabled || isHealthCheck(c.Request.URL.Path) || isLogin(c) || maintenanceBypass(c, state) {
+			c.Next()
+			return
+		}
+
+		message := state.Message
+		if message == "" {
+			message = "Estamos realizando tareas de mantenimiento, vuelve a intentarlo en unos minutos"
+		}
+		retryAfter := state.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = 300
+		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(503, gin.H{
+			"error":       "Servicio en mantenimiento",
+			"message":     message,
+			"retry_after": retryAfter,
+		})
+		c.Abort()
+	}
+}
+
+// trustedProxies lee TRUSTED_PROXIES (IPs o CIDR separados por comas)
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+func isHealthCheck(path string) bool {
+	return strings.HasPrefix(path, "/api/") && strings.HasSuffix(path, "/health")
+}
+
+// loginRoutes rutas de inicio de sesión, relativas a cada versión de la API
+var loginRoutes = []string{"/auth/login", "/auth/login/verify", "/auth/login/identity"}
+
+// isLogin deja pasar el inicio de sesión (con contraseña o identidad externa, y
+// su verificación por riesgo) en cualquier versión de la API para que un
+// administrador con el token caducado pueda desactivar el mantenimiento;
+// services.Authenticate, AuthenticateIdentity y CompleteChallenge rechazan al resto
+func isLogin(c *gin.Context) bool {
+	path := c.FullPath()
+	if c.Request.Method != http.MethodPost || !strings.HasPrefix(path, "/api/") {
+		return false
+	}
+	for _, route := range loginRoutes {
+		if strings.HasSuffix(path, route) {
+			return true
+		}
+	}
+	return false
+}
+
+func maintenanceBypass(c *gin.Context, state maintenance.State) bool {
+	if state.Allowed(c.ClientIP()) {
+		return true
+	}
+
+	if maintenance.ValidBypassToken(c.GetHeader("X-Maintenance-Bypass")) {
+		return true
+	}
+
+	bearer := c.GetHeader("Authorization")
+	if len(bearer) > 7 && bearer[:7] == "Bearer " {
+		identity, err := services.AuthenticateToken(c.Request.Context(), bearer[7:], c.ClientIP())
+		if err == nil && identity.Role == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// DeprecationMiddleware añade las cabeceras Deprecation (RFC 9745), Sunset (RFC 8594)
+// y Link a las respuestas de las rutas registradas en el paquete deprecation
+func DeprecationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info, ok := deprecation.Lookup(c.Request.Method, c.FullPath())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		c.Header("Deprecation", fmt.Sprintf("@%d", info.Since.Unix()))
+		if info.Sunset != nil {
+			c.Header("Sunset", info.Sunset.UTC().Format(http.TimeFormat))
+		}
+		var links []string
+		if info.Successor != "" {
+			links = append(links, fmt.Sprintf("<%s>; rel=\"successor-version\"", info.Successor))
+		}
+		if info.Docs != "" {
+			links = append(links, fmt.Sprintf("<%s>; rel=\"deprecation\"", info.Docs))
+		}
+		if len(links) > 0 {
+			c.Header("Link", strings.Join(links, ", "))
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"api/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+// versionPrefix prefijo de versión de las rutas; la especificación las documenta sin él
+var versionPrefix = regexp.MustCompile(`^/api/v\d+`)
+
+// OpenAPIValidationEnabled indica si se validan las peticiones contra la
+// especificación OpenAPI (OPENAPI_VALIDATION=true)
+func OpenAPIValidationEnabled() bool {
+	return os.Getenv("OPENAPI_VALIDATION") == "true"
+}
+
+// OpenAPIValidationMiddleware rechaza con 400 las peticiones que no cumplen la
+// especificación OpenAPI generada. Fuera de GIN_MODE=release también comprueba
+// las respuestas de la v1 y registra las diferencias, para detectar anotaciones
+// de swag que no coinciden con lo que devuelve el handler.
+func OpenAPIValidationMiddleware() gin.HandlerFunc {
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec())
+	if err != nil {
+		log.Fatalf("❌ No se pudo cargar la especificación OpenAPI: %v", err)
+	}
+	options := &openapi3filter.Options{
+		// La autenticación la comprueban AuthMiddleware y compañía
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		SkipSettingDefaults: true,
+	}
+	// Sin el volcado del schema y el valor, que hacen ilegible el mensaje
+	options.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+		return err.Reason
+	})
+
+	return func(c *gin.Context) {
+		route := openAPIRoute(doc, c.Request.Method, c.FullPath())
+		if route == nil {
+			c.Next()
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, param := range c.Params {
+			params[param.Key] = strings.TrimPrefix(param.Value, "/")
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: params,
+			Route:      route,
+			Options:    options,
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "La petición no cumple la especificación de la API",
+				"details": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		if gin.Mode() == gin.ReleaseMode || !strings.HasPrefix(c.FullPath(), "/api/v1/") {
+			c.Next()
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		response := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 writer.Status(),
+			Header:                 writer.Header(),
+			Options:                options,
+		}
+		response.SetBodyBytes(writer.body.Bytes())
+		if err := openapi3filter.ValidateResponse(context.Background(), response); err != nil {
+			log.Printf("⚠️ La respuesta de %s %s (%d) no coincide con la especificación OpenAPI: %v",
+				route.Method, route.Path, writer.Status(), err)
+		}
+	}
+}
+
+// openAPIRoute operación de la especificación que corresponde a la ruta de Gin
+// (/api/v1/users/:id -> /users/{id}); nil si no está documentada
+func openAPIRoute(doc *openapi3.T, method, fullPath string) *routers.Route {
+	if fullPath == "" {
+		return nil
+	}
+	segments := strings.Split(versionPrefix.ReplaceAllString(fullPath, ""), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	path := strings.Join(segments, "/")
+
+	item := doc.Paths.Find(path)
+	if item == nil {
+		return nil
+	}
+	operation := item.GetOperation(method)
+	if operation == nil {
+		return nil
+	}
+	return &routers.Route{Spec: doc, Path: path, PathItem: item, Method: method, Operation: operation}
+}
+
+// recordingWriter guarda una copia del cuerpo de la respuesta para validarlo
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
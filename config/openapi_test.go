@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"api/openapi"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestOpenAPIRoute(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec())
+	if err != nil {
+		t.Fatalf("cargar la especificación: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		fullPath string
+		want     string
+	}{
+		{"ruta simple", "POST", "/api/v1/auth/register", "/auth/register"},
+		{"parámetro de ruta", "GET", "/api/v1/users/:id", "/users/{id}"},
+		{"v2 comparte especificación", "GET", "/api/v2/users/:id", "/users/{id}"},
+		{"comodín fuera de /api", "GET", "/files/*key", "/files/{key}"},
+		{"método no documentado", "PATCH", "/api/v1/auth/register", ""},
+		{"ruta no documentada", "GET", "/ws", ""},
+		{"sin ruta", "GET", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := openAPIRoute(doc, tt.method, tt.fullPath)
+			got := ""
+			if route != nil {
+				got = route.Path
+			}
+			if got != tt.want {
+				t.Errorf("openAPIRoute(%s %q) = %q, se esperaba %q", tt.method, tt.fullPath, got, tt.want)
+			}
+		})
+	}
+}
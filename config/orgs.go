@@ -0,0 +1,50 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrgMiddleware resuelve la organización del parámetro :org de la ruta (su
+// identificador o ID) y el rol del usuario en ella, que se guardan en "org",
+// "orgID" y "orgRole". Los permisos dentro de la organización dependen de ese
+// rol y no del global: se puede ser admin de una y member de otra. Exige que
+// el usuario tenga al menos el rol required (usar después de AuthMiddleware).
+func OrgMiddleware(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity := services.Identity{UserID: c.GetUint("userID"), Role: c.GetString("userRole")}
+		org, role, err := services.ResolveOrganization(c.Request.Context(), identity, c.Param("org"))
+		if errors.Is(err, services.ErrOrgNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organización no encontrada"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al resolver la organización"})
+			c.Abort()
+			return
+		}
+		c.Set("org", org)
+		c.Set("orgID", org.ID)
+		c.Set("orgRole", role)
+
+		RequireOrgRole(required)(c)
+	}
+}
+
+// RequireOrgRole exige al usuario el rol required en la organización de la
+// ruta (usar después de OrgMiddleware)
+func RequireOrgRole(required string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !services.OrgRoleAllows(c.GetString("orgRole"), required) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Necesitas el rol " + required + " en la organización", "org_role": c.GetString("orgRole")})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
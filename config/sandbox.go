@@ -0,0 +1,38 @@
+package config
+
+import (
+	"net/http"
+
+	"api/sandbox"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sandboxStreams rutas de conexiones de larga duración, que no deben retener el
+// bloqueo del sandbox (solo leen el usuario al autenticarse)
+var sandboxStreams = map[string]bool{"/ws": true, "/events": true}
+
+// SandboxMiddleware en modo sandbox atiende las lecturas en paralelo y cada
+// escritura en exclusiva, restaurando los datos de ejemplo al terminarla
+func SandboxMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Sandbox", "true")
+		// Las subpeticiones de un lote ya se ejecutan dentro del bloqueo del lote
+		if sandbox.Locked(c.Request.Context()) || sandboxStreams[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		var release func()
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			release = sandbox.Read()
+		default:
+			release = sandbox.Write()
+		}
+		defer release()
+
+		c.Request = c.Request.WithContext(sandbox.WithLock(c.Request.Context()))
+		c.Next()
+	}
+}
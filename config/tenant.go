@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/clock"
+	"api/database"
+	"api/quotas"
+	"api/services"
+	"api/tenancy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantMiddleware resuelve el tenant de la petición con TENANCY=schema: la
+// cabecera X-Tenant o, en los enlaces enviados por correo, ?tenant=. Sus
+// consultas van al esquema del tenant; sin tenant, al esquema public.
+func TenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		slug := c.GetHeader("X-Tenant")
+		if slug == "" {
+			slug = c.Query("tenant")
+		}
+		if slug == "" {
+			c.Next()
+			return
+		}
+
+		tenant, err := services.LookupTenant(c.Request.Context(), slug)
+		if errors.Is(err, services.ErrTenantSuspended) {
+			// Por impago, 402 para que el cliente pueda llevar al pago
+			status := http.StatusForbidden
+			if tenant.SuspendReason == services.SuspendBilling {
+				status = http.StatusPaymentRequired
+			}
+			c.JSON(status, gin.H{"error": "El tenant está suspendido", "reason": tenant.SuspendReason})
+			c.Abort()
+			return
+		}
+		if errors.Is(err, services.ErrTenantNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant no encontrado"})
+			c.Abort()
+			return
+		}
+		if errors.Is(err, services.ErrTenantUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "El tenant no está disponible"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al resolver el tenant"})
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(tenancy.With(c.Request.Context(), slug))
+		c.Set("tenant", slug)
+		c.Set("tenantID", tenant.ID)
+		c.Next()
+	}
+}
+
+// TenantQuotaMiddleware aplica el límite de peticiones por minuto del tenant
+// (usar después de TenantMiddleware) e informa del margen restante en las
+// cabeceras X-Tenant-Quota-Limit y X-Tenant-Quota-Remaining
+func TenantQuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID := c.GetUint("tenantID")
+		if tenantID == 0 {
+			c.Next()
+			return
+		}
+
+		status, ok, err := quotas.Consume(c.Request.Context(), quotas.ScopeTenant, tenantID, quotas.RequestsPerMinute, 1)
+		if err != nil || status.Unlimited() {
+			c.Next()
+			return
+		}
+
+		c.Header("X-Tenant-Quota-Limit", strconv.FormatInt(status.Limit, 10))
+		if !ok {
+			reset := quotas.NextMinute()
+			c.Header("X-Tenant-Quota-Remaining", "0")
+			c.Header("Retry-After", strconv.Itoa(int(clock.Until(reset).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":    "Límite de peticiones por minuto del tenant alcanzado",
+				"quota":    status,
+				"reset_at": reset,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Header("X-Tenant-Quota-Remaining", strconv.FormatInt(status.Remaining, 10))
+		c.Next()
+	}
+}
+
+// PlatformMiddleware reserva la ruta a la instalación (esquema public): la
+// administración de tenants, copias de seguridad, mantenimiento, etc. afecta
+// a todos los tenants y no se puede hacer desde uno de ellos
+func PlatformMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tenancy.From(c.Request.Context()) != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Operación reservada a la administración de la plataforma"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// PlatformAdminMiddleware restringe la ruta a los administradores de la
+// plataforma (usar después de AuthMiddleware y PlatformMiddleware)
+func PlatformAdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("platformAdmin") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Acceso restringido a los administradores de la plataforma"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// actInTenant atiende la petición de un administrador de la plataforma dentro
+// de un tenant, con salvaguardas: solo la administración del tenant (/admin),
+// sin identidad de usuario en él (sus IDs no son los del esquema public) y,
+// para escribir, repitiendo el tenant en X-Tenant-Write. Cada petición, también
+// las rechazadas, queda registrada en el esquema public.
+func actInTenant(c *gin.Context, identity *services.Identity) {
+	tenant := identity.ActingTenant
+	switch {
+	case !strings.Contains(c.FullPath(), "/admin/"):
+		c.JSON(http.StatusForbidden, gin.H{"error": "En un tenant, los administradores de la plataforma solo acceden a su administración"})
+		c.Abort()
+	case !isReadOnly(c.Request.Method) && c.GetHeader("X-Tenant-Write") != tenant:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Confirma la escritura en el tenant con la cabecera X-Tenant-Write: " + tenant})
+		c.Abort()
+	default:
+		c.Set("userID", uint(0))
+		c.Set("userRole", identity.Role)
+		c.Set("claims", identity.Claims)
+		c.Set("userTimezone", identity.Timezone)
+		c.Set("platformAdmin", true)
+		c.Set("platformAdminID", identity.UserID)
+		c.Next()
+	}
+
+	access := &database.TenantAccess{
+		AdminID: identity.UserID,
+		Tenant:  tenant,
+		Method:  c.Request.Method,
+		Path:    c.Request.URL.Path,
+		Status:  c.Writer.Status(),
+		IP:      c.ClientIP(),
+	}
+	if err := services.RecordTenantAccess(c.Request.Context(), access); err != nil {
+		log.Printf("⚠️  No se pudo registrar el acceso del administrador %d al tenant %s: %v", identity.UserID, tenant, err)
+	}
+}
+
+func isReadOnly(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"api/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueryTimeoutMiddleware responde 503 con el código query_timeout cuando una
+// consulta de la petición se canceló por superar DB_STATEMENT_TIMEOUT, en lugar
+// del error genérico del handler. Solo se detectan las consultas hechas con el
+// contexto de la petición. Usar después de APIVersion y JSONAPIMiddleware para
+// que el error se presente en el formato que pidió el cliente.
+func QueryTimeoutMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, timedOut := database.TrackTimeouts(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+
+		writer := &queryTimeoutWriter{ResponseWriter: c.Writer, timedOut: timedOut}
+		c.Writer = writer
+		c.Next()
+		writer.flush()
+	}
+}
+
+// queryTimeoutWriter retiene los errores 5xx para sustituirlos si hubo una consulta cancelada
+type queryTimeoutWriter struct {
+	gin.ResponseWriter
+	timedOut func() bool
+	body     bytes.Buffer
+}
+
+func (w *queryTimeoutWriter) Write(data []byte) (int, error) {
+	if w.Status() < 500 {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *queryTimeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *queryTimeoutWriter) flush() {
+	if w.body.Len() == 0 {
+		return
+	}
+	if !w.timedOut() {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+	body, _ := json.Marshal(gin.H{
+		"error": "La operación ha tardado demasiado, inténtalo más tarde",
+		"code":  "query_timeout",
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"api/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// slowQuery tarda varios segundos en SQLite
+const slowQuery = "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 100000000) SELECT count(*) FROM n"
+
+func TestQueryTimeoutMiddleware(t *testing.T) {
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("DB_NAME", filepath.Join(t.TempDir(), "api.db"))
+	t.Setenv("DB_STATEMENT_TIMEOUT", "50ms")
+	if err := database.InitDB(); err != nil {
+		t.Fatal(err)
+	}
+	database.DB = database.DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	t.Cleanup(func() {
+		if db, err := database.DB.DB(); err == nil {
+			db.Close()
+		}
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(QueryTimeoutMiddleware())
+	router.GET("/slow", func(c *gin.Context) {
+		var n int64
+		if err := database.DB.WithContext(c.Request.Context()).Raw(slowQuery).Scan(&n).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al contar"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"n": n})
+	})
+	router.GET("/broken", func(c *gin.Context) {
+		var n int64
+		if err := database.DB.WithContext(c.Request.Context()).Raw("SELECT count(*) FROM missing").Scan(&n).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al contar"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"n": n})
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/slow", http.StatusServiceUnavailable, "query_timeout"},
+		// Los demás errores no se tocan
+		{"/broken", http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, se esperaba %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body struct {
+				Error string `json:"error"`
+				Code  string `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == "" {
+				t.Fatalf("cuerpo = %s", w.Body)
+			}
+			if body.Code != tt.code {
+				t.Errorf("code = %q, se esperaba %q", body.Code, tt.code)
+			}
+		})
+	}
+}
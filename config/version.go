@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LatestAPIVersion versión más reciente de la API
+const LatestAPIVersion = 2
+
+// versionMediaType prefijo del tipo de medio para negociar la versión por Accept
+// (p. ej. Accept: application/vnd.geshuro.v2+json)
+const versionMediaType = "application/vnd.geshuro.v"
+
+// APIVersion fija la versión de la API del grupo de rutas. Los clientes de un
+// grupo anterior pueden pedir una versión más nueva mediante la cabecera Accept.
+func APIVersion(version int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := version
+		if requested := acceptVersion(c.GetHeader("Accept")); requested > version && requested <= LatestAPIVersion {
+			version = requested
+		}
+		c.Set("apiVersion", version)
+		c.Header("API-Version", strconv.Itoa(version))
+		// La respuesta depende de Accept; las cachés intermedias deben distinguirla
+		c.Writer.Header().Add("Vary", "Accept")
+
+		if version < 2 {
+			c.Next()
+			return
+		}
+
+		// A partir de v2 los errores usan un sobre común {"error": {"code", "message", "details"}}
+		writer := &errorEnvelopeWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		writer.flush()
+	}
+}
+
+// acceptVersion extrae la versión solicitada en la cabecera Accept (0 si no hay)
+func acceptVersion(accept string) int {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if !strings.HasPrefix(mediaType, versionMediaType) {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(mediaType, versionMediaType), "+json"))
+		if err == nil {
+			return v
+		}
+	}
+	return 0
+}
+
+// errorEnvelopeWriter retiene las respuestas de error para reescribirlas con el sobre de v2
+type errorEnvelopeWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *errorEnvelopeWriter) Write(data []byte) (int, error) {
+	if w.Status() < 400 {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *errorEnvelopeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *errorEnvelopeWriter) flush() {
+	if w.body.Len() == 0 {
+		return
+	}
+	w.ResponseWriter.Write(errorEnvelope(w.Status(), w.body.Bytes()))
+}
+
+// errorEnvelope convierte {"error": "mensaje", ...} en el sobre de errores de v2;
+// cualquier otro cuerpo se devuelve sin cambios
+func errorEnvelope(status int, body []byte) []byte {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	message, ok := fields["error"].(string)
+	if !ok {
+		return body
+	}
+	delete(fields, "error")
+
+	envelope := gin.H{
+		"code":    strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		"message": message,
+	}
+	if len(fields) > 0 {
+		envelope["details"] = fields
+	}
+	out, err := json.Marshal(gin.H{"error": envelope})
+	if err != nil {
+		return body
+	}
+	return out
+}
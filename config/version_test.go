@@ -0,0 +1,77 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAcceptVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   int
+	}{
+		{"vacía", "", 0},
+		{"json genérico", "application/json", 0},
+		{"v2", "application/vnd.geshuro.v2+json", 2},
+		{"sin sufijo", "application/vnd.geshuro.v3", 3},
+		{"con parámetros", "application/vnd.geshuro.v2+json; q=0.9", 2},
+		{"en una lista", "text/html, application/vnd.geshuro.v2+json", 2},
+		{"gana la primera válida", "application/vnd.geshuro.vX+json, application/vnd.geshuro.v1+json", 1},
+		{"versión no numérica", "application/vnd.geshuro.vX+json", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptVersion(tt.accept); got != tt.want {
+				t.Errorf("acceptVersion(%q) = %d, se esperaba %d", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{
+			"solo mensaje",
+			http.StatusNotFound,
+			`{"error":"Usuario no encontrado"}`,
+			`{"error":{"code":"not_found","message":"Usuario no encontrado"}}`,
+		},
+		{
+			"con detalles",
+			http.StatusTooManyRequests,
+			`{"error":"Cuota superada","limit":3}`,
+			`{"error":{"code":"too_many_requests","details":{"limit":3},"message":"Cuota superada"}}`,
+		},
+		{
+			"error no textual",
+			http.StatusBadRequest,
+			`{"error":{"code":"x"}}`,
+			`{"error":{"code":"x"}}`,
+		},
+		{
+			"sin campo error",
+			http.StatusServiceUnavailable,
+			`{"message":"mantenimiento"}`,
+			`{"message":"mantenimiento"}`,
+		},
+		{
+			"no es JSON",
+			http.StatusBadGateway,
+			`Bad Gateway`,
+			`Bad Gateway`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(errorEnvelope(tt.status, []byte(tt.body))); got != tt.want {
+				t.Errorf("errorEnvelope() = %s, se esperaba %s", got, tt.want)
+			}
+		})
+	}
+}
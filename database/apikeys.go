@@ -0,0 +1,27 @@
+package database
+
+import "time"
+
+// APIKey clave de API de un usuario; solo se almacena el hash de la clave
+type APIKey struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	UserID  uint   `json:"user_id" gorm:"index;not null"`
+	Name    string `json:"name" gorm:"not null"`
+	Prefix  string `json:"prefix" gorm:"size:16;not null"`
+	KeyHash string `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	// IPs o rangos CIDR desde los que se puede usar la clave (vacío = cualquiera)
+	AllowedIPs []string   `json:"allowed_ips,omitempty" gorm:"serializer:json"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// APIKeyUsage uso agregado de una clave de API por día y endpoint
+type APIKeyUsage struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	APIKeyID   uint      `json:"api_key_id" gorm:"uniqueIndex:idx_api_key_usage;not null"`
+	Day        string    `json:"day" gorm:"uniqueIndex:idx_api_key_usage;size:10;not null"`
+	Endpoint   string    `json:"endpoint" gorm:"uniqueIndex:idx_api_key_usage;not null"`
+	Count      int64     `json:"count" gorm:"not null"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
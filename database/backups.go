@@ -0,0 +1,23 @@
+package database
+
+import "time"
+
+// Backup copia de seguridad cifrada de la base de datos en el almacenamiento
+type Backup struct {
+	ID string `json:"id" gorm:"primaryKey;size:64"`
+	// pending, running, ready o failed
+	Status string `json:"status" gorm:"size:16;default:'pending'"`
+	// Motor de la base de datos copiada: postgres o sqlite
+	Driver string `json:"driver" gorm:"size:16"`
+	// Tenant exportado (solo su esquema); vacío si es de la base de datos completa
+	Tenant    string `json:"tenant,omitempty" gorm:"size:40"`
+	ObjectKey string `json:"-"`
+	Size      int64  `json:"size"`
+	Error     string `json:"error,omitempty"`
+	// Administrador que la pidió; vacío si se hizo con el comando api backup
+	RequestedBy *uint      `json:"requested_by,omitempty" gorm:"index"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
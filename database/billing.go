@@ -0,0 +1,32 @@
+package database
+
+import "time"
+
+// Subscription suscripción de pago sincronizada desde los webhooks de Stripe
+type Subscription struct {
+	ID                   uint       `json:"id" gorm:"primaryKey"`
+	UserID               uint       `json:"user_id" gorm:"index;not null"`
+	StripeSubscriptionID string     `json:"stripe_subscription_id" gorm:"uniqueIndex;size:255;not null"`
+	StripeCustomerID     string     `json:"-" gorm:"index;size:255"`
+	PriceID              string     `json:"price_id"`
+	Status               string     `json:"status" gorm:"not null"`
+	CurrentPeriodEnd     *time.Time `json:"current_period_end"`
+	CancelAtPeriodEnd    bool       `json:"cancel_at_period_end"`
+	// LastEventAt fecha del último evento de Stripe aplicado; los eventos más
+	// antiguos que llegan tarde se descartan
+	LastEventAt int64     `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Active indica si la suscripción da acceso a las funciones de pago
+func (s Subscription) Active() bool {
+	return s.Status == "active" || s.Status == "trialing"
+}
+
+// StripeEvent evento del webhook de Stripe ya procesado (deduplicación de reenvíos)
+type StripeEvent struct {
+	ID          string    `json:"id" gorm:"primaryKey;size:255"`
+	Type        string    `json:"type" gorm:"size:255"`
+	ProcessedAt time.Time `json:"processed_at" gorm:"index"`
+}
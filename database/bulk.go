@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+
+	"api/clock"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// bulkBatchSize filas por INSERT cuando no se puede usar COPY
+const bulkBatchSize = 500
+
+// BulkInsert inserta muchas filas de un modelo de la forma más rápida que
+// admite el motor y devuelve cuántas se insertaron. En PostgreSQL usa COPY,
+// que no ejecuta los hooks de GORM ni devuelve los IDs generados; dentro de
+// una transacción (db con un *sql.Tx) o con otros motores, INSERT por lotes.
+// Como en Create, los campos vacíos con valor por defecto toman ese valor y
+// las fechas de creación y actualización vacías, la hora actual.
+func BulkInsert[T any](ctx context.Context, db *gorm.DB, rows []T) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	db = db.WithContext(ctx)
+	var sqlDB *sql.DB
+	switch pool := db.Statement.ConnPool.(type) {
+	case *sql.DB:
+		sqlDB = pool
+	case *tenantPool:
+		sqlDB = pool.For(ctx)
+	}
+	if sqlDB == nil || db.Dialector.Name() != "postgres" {
+		result := db.CreateInBatches(rows, bulkBatchSize)
+		return result.RowsAffected, result.Error
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&rows[0]); err != nil {
+		return 0, err
+	}
+	columns, values, err := copyValues(ctx, stmt.Schema, rows)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var n int64
+	err = conn.Raw(func(driverConn interface{}) error {
+		pgConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("conexión %T sin soporte de COPY", driverConn)
+		}
+		n, err = pgConn.Conn().CopyFrom(ctx, pgx.Identifier{stmt.Schema.Table}, columns, pgx.CopyFromRows(values))
+		return err
+	})
+	return n, err
+}
+
+// copyValues columnas y valores de las filas para COPY. Se omiten las columnas
+// con valor por defecto que están vacías en todas las filas (el ID
+// autoincremental, por ejemplo), para que las rellene la base de datos.
+func copyValues[T any](ctx context.Context, s *schema.Schema, rows []T) ([]string, [][]interface{}, error) {
+	now := clock.Now()
+	var fields []*schema.Field
+	for _, field := range s.Fields {
+		if field.DBName == "" || !field.Creatable {
+			continue
+		}
+		if field.HasDefaultValue && field.DefaultValueInterface == nil && field.AutoCreateTime == 0 && field.AutoUpdateTime == 0 {
+			empty := true
+			for i := range rows {
+				if _, zero := field.ValueOf(ctx, reflectValue(&rows[i])); !zero {
+					empty = false
+					break
+				}
+			}
+			if empty {
+				continue
+			}
+		}
+		fields = append(fields, field)
+	}
+
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.DBName
+	}
+	values := make([][]interface{}, len(rows))
+	for i := range rows {
+		row := make([]interface{}, len(fields))
+		for j, field := range fields {
+			value, zero := field.ValueOf(ctx, reflectValue(&rows[i]))
+			switch {
+			case zero && field.DataType == schema.Time && (field.AutoCreateTime > 0 || field.AutoUpdateTime > 0):
+				value = now
+			case zero && field.DefaultValueInterface != nil:
+				value = field.DefaultValueInterface
+			}
+			// Serializadores (cifrado, JSON) y tipos como gorm.DeletedAt
+			if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+				value = nil
+			} else if valuer, ok := value.(driver.Valuer); ok {
+				v, err := valuer.Value()
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: %w", field.Name, err)
+				}
+				value = v
+			}
+			row[j] = value
+		}
+		values[i] = row
+	}
+	return columns, values, nil
+}
+
+func reflectValue[T any](row *T) reflect.Value {
+	return reflect.ValueOf(row).Elem()
+}
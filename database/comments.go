@@ -0,0 +1,25 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Comment comentario de un usuario en un post. Al eliminarlo se marca en
+// DeletedAt y deja de listarse hasta que la retención lo purga; al eliminar
+// el post se eliminan con él.
+type Comment struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	PostID uint   `json:"post_id" gorm:"index:idx_comments_post,priority:1;not null"`
+	UserID uint   `json:"user_id" gorm:"index;not null"`
+	Body   string `json:"body" gorm:"type:text;not null"`
+	// Ocultado por un administrador: solo lo ven su autor y los administradores
+	HiddenAt     *time.Time `json:"hidden_at,omitempty" gorm:"index"`
+	HiddenBy     *uint      `json:"hidden_by,omitempty"`
+	HiddenReason string     `json:"hidden_reason,omitempty" gorm:"size:500"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"index:idx_comments_post,priority:2"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	// Eliminado por su autor, el del post o un administrador
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
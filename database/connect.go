@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// maxIdleConns conexiones inactivas que conserva el pool de PostgreSQL
+const maxIdleConns = 2
+
+// ConnectRetries intentos de conexión al arrancar antes de rendirse
+// (DB_CONNECT_RETRIES, 10 por defecto; 0 = un solo intento)
+func ConnectRetries() int {
+	if n, err := strconv.Atoi(os.Getenv("DB_CONNECT_RETRIES")); err == nil && n >= 0 {
+		return n
+	}
+	return 10
+}
+
+// backoffLimits espera inicial y máxima entre intentos (DB_CONNECT_BACKOFF, 1s
+// por defecto, y DB_CONNECT_BACKOFF_MAX, 30s por defecto)
+func backoffLimits() (time.Duration, time.Duration) {
+	base, err := time.ParseDuration(os.Getenv("DB_CONNECT_BACKOFF"))
+	if err != nil || base <= 0 {
+		base = time.Second
+	}
+	max, err := time.ParseDuration(os.Getenv("DB_CONNECT_BACKOFF_MAX"))
+	if err != nil || max <= 0 {
+		max = 30 * time.Second
+	}
+	if max < base {
+		max = base
+	}
+	return base, max
+}
+
+// backoff espera antes del intento attempt (desde 0): crece exponencialmente
+// hasta el máximo y se reparte al azar entre la mitad y el total para que las
+// réplicas que arrancan a la vez no reintenten todas en el mismo instante
+func backoff(attempt int) time.Duration {
+	base, max := backoffLimits()
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// waitForDB espera a que la base de datos acepte conexiones, reintentando con
+// backoff (p. ej. mientras arranca el contenedor de PostgreSQL)
+func waitForDB(ctx context.Context, db *sql.DB) error {
+	retries := ConnectRetries()
+	for attempt := 0; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return err
+		}
+		wait := backoff(attempt)
+		log.Printf("⏳ Base de datos no disponible (intento %d/%d), reintentando en %s: %v", attempt+1, retries+1, wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Monitor comprueba periódicamente la conexión con la base de datos. Si se
+// pierde, descarta las conexiones inactivas del pool (probablemente rotas) y
+// reintenta con backoff hasta recuperarla; mientras tanto las peticiones que
+// usan la base de datos fallan, pero el servidor sigue en marcha.
+func Monitor(ctx context.Context, interval time.Duration) {
+	db, err := DB.DB()
+	if err != nil {
+		return
+	}
+	go func() {
+		attempt := 0
+		for {
+			wait := interval
+			if attempt > 0 {
+				wait = backoff(attempt - 1)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+
+			pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := db.PingContext(pingCtx)
+			cancel()
+			switch {
+			case err == nil && attempt > 0:
+				log.Printf("✅ Conexión con la base de datos recuperada tras %d intentos", attempt)
+				attempt = 0
+			case err != nil && ctx.Err() == nil:
+				if attempt == 0 {
+					log.Printf("⚠️  Conexión con la base de datos perdida, reconectando: %v", err)
+					// Cerrar las conexiones inactivas para que no se reutilicen al volver
+					db.SetMaxIdleConns(0)
+					db.SetMaxIdleConns(maxIdleConns)
+				}
+				attempt++
+			}
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// Total número de filas de un listado y si es una estimación
+type Total struct {
+	Count     int64
+	Estimated bool
+}
+
+type estimateKey struct{}
+
+// WithEstimatedCount permite que Count devuelva una estimación en lugar de
+// contar las filas; sin él los totales son siempre exactos
+func WithEstimatedCount(ctx context.Context) context.Context {
+	return context.WithValue(ctx, estimateKey{}, true)
+}
+
+// EstimateThreshold filas a partir de las que se estima el total
+// (COUNT_ESTIMATE_THRESHOLD, 10000 por defecto): por debajo COUNT(*) es barato
+// y el total es exacto
+func EstimateThreshold() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("COUNT_ESTIMATE_THRESHOLD"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return 10000
+}
+
+// CountCacheTTL tiempo que se reutiliza un total grande ya contado
+// (COUNT_CACHE_TTL, 1m por defecto)
+func CountCacheTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("COUNT_CACHE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return time.Minute
+}
+
+type cachedCount struct {
+	count   int64
+	expires time.Time
+}
+
+var (
+	countsMu sync.Mutex
+	counts   = map[string]cachedCount{}
+)
+
+// Count cuenta las filas de query. Si el contexto lo permite
+// (WithEstimatedCount) y la tabla es grande, evita el COUNT(*):
+//   - en PostgreSQL, sin filtros, usa la estimación del planificador
+//     (pg_class.reltuples), que se actualiza con ANALYZE/autovacuum;
+//   - si no, reutiliza durante CountCacheTTL el último total de la misma
+//     consulta que superó EstimateThreshold.
+func Count(query *gorm.DB) (Total, error) {
+	estimate, _ := query.Statement.Context.Value(estimateKey{}).(bool)
+	if !estimate {
+		var n int64
+		err := query.Count(&n).Error
+		return Total{Count: n}, err
+	}
+
+	threshold := EstimateThreshold()
+	if n, ok := reltuples(query); ok && n >= threshold {
+		return Total{Count: n, Estimated: true}, nil
+	}
+
+	// Las mismas tablas existen en el esquema de cada tenant
+	key := tenancy.From(query.Statement.Context) + ":" + query.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var n int64
+		return tx.Count(&n)
+	})
+	now := clock.Now()
+	countsMu.Lock()
+	cached, ok := counts[key]
+	countsMu.Unlock()
+	if ok && now.Before(cached.expires) && cached.count >= threshold {
+		return Total{Count: cached.count, Estimated: true}, nil
+	}
+
+	var n int64
+	if err := query.Count(&n).Error; err != nil {
+		return Total{}, err
+	}
+	countsMu.Lock()
+	if n >= threshold {
+		counts[key] = cachedCount{count: n, expires: now.Add(CountCacheTTL())}
+	} else {
+		delete(counts, key)
+	}
+	// Limpiar de vez en cuando las consultas caducadas
+	if len(counts) > 1000 {
+		for k, c := range counts {
+			if now.After(c.expires) {
+				delete(counts, k)
+			}
+		}
+	}
+	countsMu.Unlock()
+	return Total{Count: n}, nil
+}
+
+// reltuples estimación del número de filas de la tabla de query según las
+// estadísticas de PostgreSQL; solo si la consulta no tiene filtros
+func reltuples(query *gorm.DB) (int64, bool) {
+	if query.Dialector.Name() != "postgres" {
+		return 0, false
+	}
+	if _, filtered := query.Statement.Clauses["WHERE"]; filtered || len(query.Statement.Joins) > 0 {
+		return 0, false
+	}
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(query.Statement.Model); err != nil {
+		return 0, false
+	}
+	var n float64
+	err := query.Session(&gorm.Session{NewDB: true}).
+		Raw("SELECT reltuples FROM pg_class WHERE oid = to_regclass(?)", stmt.Schema.Table).Scan(&n).Error
+	// -1: la tabla aún no se ha analizado
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return int64(n), true
+}
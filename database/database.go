@@ -1,10 +1,19 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
+	"api/tenancy"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -13,12 +22,41 @@ import (
 
 var DB *gorm.DB
 
+// Driver devuelve el motor de base de datos configurado: "postgres" si están
+// todas las variables de conexión de PostgreSQL y DB_TYPE no es sqlite, o
+// "sqlite" en otro caso
+func Driver() string {
+	for _, name := range []string{"DB_HOST", "DB_USER", "DB_PASSWORD", "DB_NAME", "DB_PORT"} {
+		if os.Getenv(name) == "" {
+			return "sqlite"
+		}
+	}
+	if os.Getenv("DB_TYPE") == "sqlite" {
+		return "sqlite"
+	}
+	return "postgres"
+}
+
+// SQLiteFile fichero de la base de datos SQLite (DB_NAME, por defecto api.db)
+func SQLiteFile() string {
+	if name := os.Getenv("DB_NAME"); name != "" {
+		return name
+	}
+	return "api.db"
+}
+
+// PgBouncer indica si la API se conecta a PostgreSQL a través de PgBouncer en
+// modo transaction (DB_PGBOUNCER)
+func PgBouncer() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("DB_PGBOUNCER"))
+	return enabled
+}
+
 // InitDB inicializa la conexión a la base de datos
 func InitDB() error {
 	var err error
 
 	// Leer variables de entorno
-	dbType := os.Getenv("DB_TYPE")
 	host := os.Getenv("DB_HOST")
 	port := os.Getenv("DB_PORT")
 	user := os.Getenv("DB_USER")
@@ -29,20 +67,55 @@ func InitDB() error {
 		sslmode = "disable"
 	}
 
+	if tenancy.Enabled() && (Driver() != "postgres" || PgBouncer()) {
+		// Cada tenant necesita conexiones con su search_path, que PgBouncer en
+		// modo transaction no conserva
+		return errors.New("TENANCY=schema necesita PostgreSQL sin DB_PGBOUNCER")
+	}
+
 	// Si no hay configuración de PostgreSQL o DB_TYPE es sqlite, usar SQLite
-	if dbType == "sqlite" || host == "" || user == "" || password == "" || dbname == "" || port == "" {
-		if dbname == "" {
-			dbname = "api.db"
-		}
+	if Driver() == "sqlite" {
 		log.Println("📦 Usando SQLite para desarrollo local")
-		DB, err = gorm.Open(sqlite.Open(dbname), &gorm.Config{
+		DB, err = gorm.Open(sqlite.Open(SQLiteFile()), &gorm.Config{
 			Logger: logger.Default.LogMode(logger.Info),
 		})
 	} else {
 		log.Println("🐘 Usando PostgreSQL")
 		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=UTC", host, user, password, dbname, port, sslmode)
-		DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+		config, parseErr := pgx.ParseConfig(dsn)
+		if parseErr != nil {
+			return parseErr
+		}
+		if PgBouncer() {
+			// En modo transaction cada transacción puede ir a una conexión distinta
+			// del servidor: sin sentencias preparadas (ni la caché de pgx) ni
+			// parámetros de sesión, que PgBouncer rechaza o mezcla entre clientes
+			config.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+			config.StatementCacheCapacity = 0
+			config.DescriptionCacheCapacity = 0
+		} else if timeout := QueryTimeout(); timeout > 0 {
+			config.RuntimeParams["statement_timeout"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+		}
+		sqlDB := openPostgres(config)
+		if err := waitForDB(context.Background(), sqlDB); err != nil {
+			sqlDB.Close()
+			return err
+		}
+		var conn gorm.ConnPool = sqlDB
+		if tenancy.Enabled() {
+			conn = newTenantPool(sqlDB, func(schema string) *sql.DB {
+				tenantConfig := config.Copy()
+				tenantConfig.RuntimeParams["search_path"] = schema + ", public"
+				db := openPostgres(tenantConfig)
+				// Los tenants con poco tráfico no retienen conexiones
+				db.SetConnMaxIdleTime(5 * time.Minute)
+				return db
+			})
+		}
+		DB, err = gorm.Open(postgres.New(postgres.Config{Conn: conn, PreferSimpleProtocol: PgBouncer()}), &gorm.Config{
 			Logger: logger.Default.LogMode(logger.Info),
+			// Las sentencias preparadas de GORM no sobreviven a PgBouncer en modo transaction
+			PrepareStmt: false,
 		})
 	}
 
@@ -51,7 +124,16 @@ func InitDB() error {
 	}
 
 	// Auto-migrar los modelos
-	if err := DB.AutoMigrate(&User{}); err != nil {
+	if err := migrate(DB, ""); err != nil {
+		return err
+	}
+	if tenancy.Enabled() {
+		if err := migrateTenants(context.Background()); err != nil {
+			return err
+		}
+	}
+	// Límite de tiempo de las consultas, a partir de aquí
+	if err := registerTimeouts(DB, QueryTimeout()); err != nil {
 		return err
 	}
 
@@ -59,6 +141,58 @@ func InitDB() error {
 	return nil
 }
 
+// openPostgres abre un pool de conexiones con la configuración indicada. Las
+// credenciales se leen del entorno en cada conexión nueva para recoger las
+// rotaciones del gestor de secretos sin reiniciar.
+func openPostgres(config *pgx.ConnConfig) *sql.DB {
+	db := stdlib.OpenDB(*config, stdlib.OptionBeforeConnect(func(ctx context.Context, cc *pgx.ConnConfig) error {
+		cc.User = os.Getenv("DB_USER")
+		cc.Password = os.Getenv("DB_PASSWORD")
+		return nil
+	}))
+	db.SetConnMaxLifetime(time.Hour)
+	db.SetMaxIdleConns(maxIdleConns)
+	return db
+}
+
+// migrate crea o actualiza las tablas e índices de los modelos en schema
+// (vacío: el esquema por defecto); sin el statement_timeout de la sesión, que
+// una migración puede superar
+func migrate(db *gorm.DB, schema string) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		// Con PgBouncer no hay statement_timeout de sesión que quitar, y un SET
+		// pasaría a otros clientes de la misma conexión del servidor
+		if conn.Dialector.Name() == "postgres" && !PgBouncer() {
+			if err := conn.Exec("SET statement_timeout = 0").Error; err != nil {
+				return err
+			}
+			defer conn.Exec("RESET statement_timeout")
+		}
+		models := Models()
+		if schema != "" {
+			if err := conn.Exec(fmt.Sprintf("SET search_path TO %s, public", schema)).Error; err != nil {
+				return err
+			}
+			defer conn.Exec("RESET search_path")
+		} else {
+			// El registro de tenants solo está en el esquema public
+			models = append(models, platformModels()...)
+		}
+		if err := conn.AutoMigrate(models...); err != nil {
+			return err
+		}
+		partitionTables(conn)
+		createIndexes(conn)
+		checkIndexes(conn)
+		return nil
+	})
+}
+
+// Models devuelve todos los modelos persistidos, en el orden de migración
+func Models() []interface{} {
+	return []interface{}{&User{}, &UploadSession{}, &UploadPart{}, &DirectUpload{}, &DataExport{}, &RetentionRun{}, &LoginEvent{}, &UserUsage{}, &APIKey{}, &APIKeyUsage{}, &Quota{}, &QuotaCounter{}, &Subscription{}, &StripeEvent{}, &Plan{}, &Setting{}, &IPBan{}, &Device{}, &Session{}, &LoginChallenge{}, &MagicLink{}, &OAuthClient{}, &OAuthCode{}, &OAuthDeviceCode{}, &OAuthGrant{}, &OAuthToken{}, &TokenExchange{}, &LinkedIdentity{}, &Profile{}, &UserSettings{}, &UserChange{}, &Suspension{}, &SuspensionAction{}, &TermsAcceptance{}, &VerificationRequest{}, &Report{}, &ReportSchedule{}, &Backup{}, &Organization{}, &Membership{}, &Group{}, &GroupMember{}, &Policy{}, &Post{}, &Comment{}, &Tag{}, &UserTag{}}
+}
+
 // User modelo de usuario
 type User struct {
 	gorm.Model
@@ -67,4 +201,49 @@ type User struct {
 	Name     string `json:"name" gorm:"not null"`
 	Role     string `json:"role" gorm:"default:'user'"`
 	IsActive bool   `json:"is_active" gorm:"default:true"`
+	// Nombre de usuario público (en minúsculas); nil mientras no elija uno
+	Username *string `json:"username,omitempty" gorm:"uniqueIndex;size:32"`
+	// Claves del avatar original y sus variantes en el almacenamiento de archivos
+	AvatarKey       string `json:"-"`
+	AvatarThumbKey  string `json:"-"`
+	AvatarMediumKey string `json:"-"`
+	AvatarStatus    string `json:"-"`
+	// Última petición autenticada registrada por el seguimiento de uso
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+	// Borrado de cuenta solicitado por el usuario
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	AnonymizedAt        *time.Time `json:"-"`
+	// Cliente asociado en Stripe para la facturación
+	StripeCustomerID string `json:"-" gorm:"index"`
+	// Código del plan contratado (free, pro, enterprise)
+	PlanCode string `json:"plan" gorm:"size:32;default:'free'"`
+	// El usuario no quiere avisos de inicios de sesión desde dispositivos o países
+	// nuevos (los administradores los reciben siempre)
+	LoginAlertsDisabled bool `json:"login_alerts_disabled"`
+	// Zona horaria IANA (Europe/Madrid) en la que se le presentan las fechas e
+	// idioma preferido (etiqueta BCP 47); vacíos = UTC y el idioma por defecto
+	Timezone string `json:"timezone,omitempty" gorm:"size:64"`
+	Locale   string `json:"locale,omitempty" gorm:"size:35"`
+	// Versión de sus permisos: aumenta al cambiar su rol, sus organizaciones o
+	// grupos o las políticas, y los permisos de los tokens anteriores dejan de usarse
+	PermVersion uint `json:"-" gorm:"not null;default:1"`
+	// Último cambio de contraseña (nil = la del alta) y rotación exigida por un
+	// administrador: hasta cambiarla las sesiones solo sirven para hacerlo
+	PasswordChangedAt      *time.Time `json:"password_changed_at,omitempty"`
+	PasswordChangeRequired bool       `json:"password_change_required"`
+	// Suspensión en curso (ver Suspension); se comprueba su fin al autenticar
+	SuspensionID *uint `json:"-"`
+	// Cuenta restringida (p. ej. por la detección de abusos): puede iniciar
+	// sesión y consultar, pero no modificar nada
+	RestrictedAt      *time.Time `json:"restricted_at,omitempty"`
+	RestrictionReason string     `json:"restriction_reason,omitempty" gorm:"size:500"`
+	// Última versión de los términos de uso aceptada (ver TermsAcceptance):
+	// mientras no sea la vigente las sesiones solo sirven para aceptarla
+	TermsVersion    string     `json:"terms_version,omitempty" gorm:"size:32"`
+	TermsAcceptedAt *time.Time `json:"terms_accepted_at,omitempty"`
+	// Cuenta verificada por un administrador (ver VerificationRequest); se
+	// muestra en el perfil público
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	// Atributos propios de los integradores, validados por el paquete metadata
+	Metadata map[string]interface{} `json:"metadata,omitempty" gorm:"type:jsonb;serializer:json"`
 }
@@ -0,0 +1,44 @@
+package database
+
+import "time"
+
+// Device dispositivo desde el que un usuario ha iniciado sesión, identificado
+// por la huella de su agente de usuario (navegador, sistema y tipo)
+type Device struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	UserID      uint   `json:"user_id" gorm:"uniqueIndex:idx_user_device;not null"`
+	Fingerprint string `json:"-" gorm:"uniqueIndex:idx_user_device;size:64;not null"`
+	Browser     string `json:"browser"`
+	OS          string `json:"os"`
+	Type        string `json:"type" gorm:"size:16"`
+	// Último agente de usuario completo visto desde el dispositivo
+	UserAgent   string    `json:"user_agent" gorm:"serializer:encrypted"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at" gorm:"index"`
+	// Dispositivo de confianza (sin segundo factor) hasta esta fecha; TrustNonce
+	// cambia cada vez que se concede para invalidar los tokens anteriores
+	TrustedUntil *time.Time `json:"trusted_until,omitempty"`
+	TrustNonce   string     `json:"-" gorm:"size:32"`
+}
+
+// Session sesión abierta con un inicio de sesión; el ID es el jti del token emitido
+type Session struct {
+	ID       string `json:"id" gorm:"primaryKey;size:64"`
+	UserID   uint   `json:"user_id" gorm:"index;not null"`
+	DeviceID *uint  `json:"device_id" gorm:"index"`
+	IP       string `json:"ip" gorm:"serializer:encrypted"`
+	// País de la IP según GeoIP (vacío si no se conoce)
+	Country   string     `json:"country,omitempty" gorm:"size:2"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// Caducidad del token (con renovación por cookie, hasta cuándo se puede
+	// renovar): hasta entonces el registro no se puede purgar, porque un token
+	// sin sesión registrada se rechaza como revocado
+	TokenExpiresAt time.Time `json:"-" gorm:"index"`
+	// Hash del token de renovación de la cookie (vacío si se entregó solo el
+	// token) y del anterior, para detectar su reutilización
+	RefreshHash         string     `json:"-" gorm:"size:64;index"`
+	PreviousRefreshHash string     `json:"-" gorm:"size:64;index"`
+	RefreshedAt         *time.Time `json:"-"`
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// IsPostgres indica si la conexión actual es PostgreSQL
+func IsPostgres() bool {
+	return DB.Dialector.Name() == "postgres"
+}
+
+// DateBucket devuelve una expresión SQL que agrupa la columna por día o por
+// semana (lunes) como texto YYYY-MM-DD, según el dialecto en uso
+func DateBucket(column, period string) string {
+	if IsPostgres() {
+		if period == "week" {
+			return fmt.Sprintf("to_char(date_trunc('week', %s), 'YYYY-MM-DD')", column)
+		}
+		return fmt.Sprintf("to_char(date_trunc('day', %s), 'YYYY-MM-DD')", column)
+	}
+	if period == "week" {
+		return fmt.Sprintf("date(%s, 'weekday 0', '-6 days')", column)
+	}
+	return fmt.Sprintf("date(%s)", column)
+}
+
+// ParseTime interpreta fechas devueltas por agregados (MAX, MIN) que SQLite
+// entrega como texto y PostgreSQL como timestamp
+func ParseTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// PrefixCondition devuelve una condición que compara el prefijo (ya en
+// minúsculas) con lower(column) de forma que pueda usar el índice sobre esa
+// expresión (ver indexes): LIKE con text_pattern_ops en
+// PostgreSQL y un rango en SQLite, que no optimiza LIKE sobre expresiones
+func PrefixCondition(column, prefix string) (string, []interface{}) {
+	if IsPostgres() {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+		return fmt.Sprintf("lower(%s) LIKE ?", column), []interface{}{escaped + "%"}
+	}
+	return fmt.Sprintf("lower(%s) >= ? AND lower(%s) < ?", column, column), []interface{}{prefix, prefix + string(utf8.MaxRune)}
+}
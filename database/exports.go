@@ -0,0 +1,15 @@
+package database
+
+import "time"
+
+// DataExport exportación de los datos personales de un usuario (takeout)
+type DataExport struct {
+	ID        string     `json:"id" gorm:"primaryKey;size:64"`
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	Status    string     `json:"status" gorm:"default:'pending'"`
+	ObjectKey string     `json:"-"`
+	Size      int64      `json:"size"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"api/health"
+)
+
+func init() {
+	health.Register("database", func(ctx context.Context) error {
+		if DB == nil {
+			return fmt.Errorf("sin conexión")
+		}
+		db, err := DB.DB()
+		if err != nil {
+			return err
+		}
+		return db.PingContext(ctx)
+	})
+	// Las tablas de todos los modelos existen (AutoMigrate se completó)
+	health.Register("migrations", func(ctx context.Context) error {
+		if DB == nil {
+			return fmt.Errorf("sin conexión")
+		}
+		migrator := DB.WithContext(ctx).Migrator()
+		var missing []string
+		for _, model := range Models() {
+			if !migrator.HasTable(model) {
+				stmt := DB.Model(model).Statement
+				if err := stmt.Parse(model); err != nil {
+					return err
+				}
+				missing = append(missing, stmt.Schema.Table)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("faltan las tablas %s", strings.Join(missing, ", "))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,18 @@
+package database
+
+import "time"
+
+// LinkedIdentity identidad externa (Google, GitHub, SAML) vinculada a un usuario
+// para iniciar sesión con ella; cada usuario vincula como mucho una por proveedor
+type LinkedIdentity struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	UserID   uint   `json:"-" gorm:"uniqueIndex:idx_user_identity_provider;not null"`
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_user_identity_provider;uniqueIndex:idx_identity_subject;size:32;not null"`
+	// Identificador estable de la persona en el proveedor
+	Subject string `json:"-" gorm:"uniqueIndex:idx_identity_subject;size:255;not null"`
+	// Email y nombre que devolvió el proveedor al vincularla, para mostrarla
+	Email      string     `json:"email,omitempty" gorm:"serializer:encrypted"`
+	Name       string     `json:"name,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Index índice que AutoMigrate no sabe crear (de expresiones, parciales o
+// específicos de PostgreSQL) para las consultas habituales
+type Index struct {
+	Name   string
+	Table  string
+	Unique bool
+	// Columnas o expresiones; {opclass} se sustituye por text_pattern_ops en
+	// PostgreSQL, para que LIKE 'pre%' use el índice con cualquier collation
+	Columns string
+	// Condición de los índices parciales
+	Where string
+	// Solo en PostgreSQL con pg_trgm
+	Trigram bool
+}
+
+// indexes índices gestionados, que se crean al migrar si faltan
+var indexes = []Index{
+	// Búsqueda por prefijo de usuarios (ver PrefixCondition)
+	{Name: "idx_users_name_prefix", Table: "users", Columns: "lower(name){opclass}"},
+	{Name: "idx_users_email_prefix", Table: "users", Columns: "lower(email){opclass}"},
+	// Inicio de sesión y alta comparan el email sin distinguir mayúsculas
+	{Name: "idx_users_email_lower", Table: "users", Unique: true, Columns: "lower(email)"},
+	// Listados paginados por ID y altas por fecha, sin las cuentas eliminadas
+	{Name: "idx_users_active", Table: "users", Columns: "id", Where: "deleted_at IS NULL"},
+	{Name: "idx_users_created_at", Table: "users", Columns: "created_at"},
+	// Historial de un usuario, los más recientes primero
+	{Name: "idx_user_changes_user_created", Table: "user_changes", Columns: "user_id, created_at DESC"},
+	{Name: "idx_login_events_created_at", Table: "login_events", Columns: "created_at"},
+	// Búsqueda aproximada por nombre
+	{Name: "idx_users_name_trgm", Table: "users", Columns: "lower(name) gin_trgm_ops", Trigram: true},
+}
+
+// createIndexes crea los índices gestionados que falten. Un índice que no se
+// puede crear (p. ej. el único de lower(email) con emails repetidos en
+// distinto caso) no impide arrancar: lo avisa checkIndexes.
+func createIndexes(db *gorm.DB) {
+	postgres := db.Dialector.Name() == "postgres"
+	trigram = false
+	if postgres {
+		if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+			log.Printf("⚠️  pg_trgm no disponible, la búsqueda de usuarios solo usará prefijos: %v", err)
+		} else {
+			trigram = true
+		}
+	}
+
+	for _, index := range expectedIndexes(db) {
+		if err := db.Exec(index.sql(postgres)).Error; err != nil {
+			log.Printf("⚠️  No se pudo crear el índice %s: %v", index.Name, err)
+		}
+	}
+}
+
+// checkIndexes avisa de los índices gestionados que faltan en la base de datos
+func checkIndexes(db *gorm.DB) {
+	if missing := MissingIndexes(db); len(missing) > 0 {
+		log.Printf("⚠️  Faltan índices esperados, algunas consultas serán lentas: %s", strings.Join(missing, ", "))
+	}
+}
+
+// MissingIndexes índices gestionados que no existen en la base de datos
+func MissingIndexes(db *gorm.DB) []string {
+	var missing []string
+	migrator := db.Migrator()
+	for _, index := range expectedIndexes(db) {
+		if !migrator.HasIndex(index.Table, index.Name) {
+			missing = append(missing, index.Name)
+		}
+	}
+	return missing
+}
+
+// expectedIndexes índices gestionados que admite el motor
+func expectedIndexes(db *gorm.DB) []Index {
+	list := make([]Index, 0, len(indexes))
+	for _, index := range indexes {
+		if index.Trigram && !trigram {
+			continue
+		}
+		list = append(list, index)
+	}
+	return list
+}
+
+func (i Index) sql(postgres bool) string {
+	opclass, method := "", ""
+	if postgres {
+		opclass = " text_pattern_ops"
+	}
+	if i.Trigram {
+		method = " USING gin"
+	}
+	unique := ""
+	if i.Unique {
+		unique = "UNIQUE "
+	}
+	sql := fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s%s (%s)", unique, i.Name, i.Table, method,
+		strings.ReplaceAll(i.Columns, "{opclass}", opclass))
+	if i.Where != "" {
+		sql += " WHERE " + i.Where
+	}
+	return sql
+}
@@ -0,0 +1,16 @@
+package database
+
+import "time"
+
+// IPBan bloqueo temporal de una IP por comportamiento abusivo. Se conservan los
+// bloqueos vencidos o levantados como historial.
+type IPBan struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	IP        string     `json:"ip" gorm:"size:45;index;not null"`
+	Reason    string     `json:"reason" gorm:"size:32;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index"`
+	LiftedAt  *time.Time `json:"lifted_at,omitempty"`
+	LiftedBy  *uint      `json:"lifted_by,omitempty"`
+	CreatedBy *uint      `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
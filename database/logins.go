@@ -0,0 +1,51 @@
+package database
+
+import "time"
+
+// LoginEvent intento de inicio de sesión (exitoso o fallido)
+type LoginEvent struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	UserID    *uint  `json:"user_id" gorm:"index"`
+	Email     string `json:"email" gorm:"index"`
+	Success   bool   `json:"success" gorm:"index"`
+	IP        string `json:"ip" gorm:"serializer:encrypted"`
+	UserAgent string `json:"user_agent" gorm:"serializer:encrypted"`
+	// Puntuación de riesgo y decisión (allow, challenge, block) si RISK_SCORING está activo
+	RiskScore    int       `json:"risk_score,omitempty"`
+	RiskDecision string    `json:"risk_decision,omitempty" gorm:"size:16"`
+	RiskReasons  []string  `json:"risk_reasons,omitempty" gorm:"serializer:json"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index;not null"`
+}
+
+// LoginChallenge verificación adicional exigida por la puntuación de riesgo: el
+// inicio de sesión se completa con el código enviado por correo
+type LoginChallenge struct {
+	ID          string     `json:"id" gorm:"primaryKey;size:64"`
+	UserID      uint       `json:"user_id" gorm:"index;not null"`
+	CodeHash    string     `json:"-" gorm:"size:64;not null"`
+	Attempts    int        `json:"attempts"`
+	RiskScore   int        `json:"risk_score"`
+	RiskReasons []string   `json:"risk_reasons" gorm:"serializer:json"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"index"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// MagicLink enlace o código de inicio de sesión sin contraseña enviado por
+// correo (los códigos llevan CodeHash). Se guardan también las peticiones para
+// emails sin cuenta (UserID nil): cuentan para el límite de peticiones igual
+// que las demás.
+type MagicLink struct {
+	ID     string `json:"id" gorm:"primaryKey;size:64"`
+	UserID *uint  `json:"user_id" gorm:"index"`
+	Email  string `json:"email" gorm:"index;not null"`
+	// Dispositivo desde el que se pidió: abrirlo en otro exige confirmación
+	IP          string     `json:"ip" gorm:"size:45;index"`
+	UserAgent   string     `json:"user_agent" gorm:"serializer:encrypted"`
+	Fingerprint string     `json:"-" gorm:"size:64"`
+	CodeHash    string     `json:"-" gorm:"size:64"`
+	Attempts    int        `json:"attempts"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"index"`
+	UsedAt      *time.Time `json:"used_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,108 @@
+package database
+
+import "time"
+
+// OAuthClient aplicación de terceros registrada para pedir acceso a los datos
+// de los usuarios mediante OAuth2
+type OAuthClient struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	ClientID string `json:"client_id" gorm:"uniqueIndex;size:64;not null"`
+	// Usuario que registró la aplicación
+	OwnerID uint   `json:"owner_id" gorm:"index;not null"`
+	Name    string `json:"name" gorm:"not null"`
+	// Hash del secreto; vacío en los clientes públicos (SPA, móvil), que solo usan PKCE
+	SecretHash   string     `json:"-" gorm:"size:64"`
+	Public       bool       `json:"public"`
+	RedirectURIs []string   `json:"redirect_uris" gorm:"serializer:json"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// OAuthCode código de autorización pendiente de canjear por un token
+type OAuthCode struct {
+	ID            uint       `json:"-" gorm:"primaryKey"`
+	CodeHash      string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	ClientID      uint       `json:"-" gorm:"index;not null"`
+	UserID        uint       `json:"-" gorm:"index;not null"`
+	RedirectURI   string     `json:"-" gorm:"not null"`
+	Scopes        []string   `json:"-" gorm:"serializer:json"`
+	CodeChallenge string     `json:"-" gorm:"size:128;not null"`
+	ExpiresAt     time.Time  `json:"-" gorm:"index"`
+	UsedAt        *time.Time `json:"-"`
+}
+
+// OAuthDeviceCode autorización del flujo de dispositivo (RFC 8628): la
+// aplicación consulta con device_code mientras el usuario la aprueba con
+// user_code desde otro dispositivo
+type OAuthDeviceCode struct {
+	ID             uint   `json:"-" gorm:"primaryKey"`
+	DeviceCodeHash string `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	// Hash del código que teclea el usuario, normalizado (oauth.NormalizeUserCode)
+	UserCodeHash string   `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	ClientID     uint     `json:"-" gorm:"index;not null"`
+	Scopes       []string `json:"-" gorm:"serializer:json"`
+	// pending, approved, denied o used, y quién la aprobó o denegó
+	Status string `json:"-" gorm:"size:16;not null"`
+	UserID *uint  `json:"-" gorm:"index"`
+	// Segundos mínimos entre consultas; cada slow_down los aumenta
+	Interval     int        `json:"-" gorm:"not null"`
+	LastPolledAt *time.Time `json:"-"`
+	ExpiresAt    time.Time  `json:"-" gorm:"index"`
+	CreatedAt    time.Time  `json:"-"`
+}
+
+// OAuthGrant permisos que un usuario ha concedido a una aplicación
+type OAuthGrant struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_oauth_grant;not null"`
+	ClientID  uint      `json:"-" gorm:"uniqueIndex:idx_oauth_grant;not null"`
+	Scopes    []string  `json:"scopes" gorm:"serializer:json"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OAuthToken token de acceso emitido a una aplicación con su token de
+// renovación; de ambos solo se guarda el hash
+type OAuthToken struct {
+	ID               uint       `json:"id" gorm:"primaryKey"`
+	ClientID         uint       `json:"client_id" gorm:"index;not null"`
+	UserID           uint       `json:"user_id" gorm:"index;not null"`
+	AccessHash       string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	RefreshHash      string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	Scopes           []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RefreshExpiresAt time.Time  `json:"refresh_expires_at" gorm:"index"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	// Servicio para el que se emitió en un canje (RFC 8693); vacío = esta API
+	Audience string `json:"audience,omitempty" gorm:"size:64"`
+}
+
+// TokenExchange canje del token de un usuario por otro para un servicio
+// interno (RFC 8693), guardado para la auditoría
+type TokenExchange struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// Servicio que hizo el canje y usuario en cuyo nombre actúa
+	ClientID uint `json:"client_id" gorm:"index;not null"`
+	UserID   uint `json:"user_id" gorm:"index;not null"`
+	// Token presentado: session (JWT de sesión) u oauth (token de una
+	// aplicación, SubjectTokenID)
+	SubjectType    string `json:"subject_type" gorm:"size:16;not null"`
+	SubjectTokenID uint   `json:"subject_token_id,omitempty"`
+	// Token emitido, su audiencia (client_id del servicio destino) y sus scopes
+	TokenID   uint      `json:"token_id" gorm:"not null"`
+	Audience  string    `json:"audience" gorm:"size:64;not null"`
+	Scopes    []string  `json:"scopes" gorm:"serializer:json"`
+	IP        string    `json:"ip" gorm:"size:45"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// Sin TableName GORM las nombraría o_auth_*
+
+func (OAuthClient) TableName() string { return "oauth_clients" }
+func (OAuthCode) TableName() string   { return "oauth_codes" }
+func (OAuthGrant) TableName() string  { return "oauth_grants" }
+func (OAuthToken) TableName() string  { return "oauth_tokens" }
+
+func (OAuthDeviceCode) TableName() string { return "oauth_device_codes" }
+func (TokenExchange) TableName() string   { return "oauth_token_exchanges" }
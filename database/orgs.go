@@ -0,0 +1,51 @@
+package database
+
+import "time"
+
+// Organization organización de usuarios dentro de la instalación o de un
+// tenant. Cada usuario puede pertenecer a varias con un rol distinto en cada una.
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Slug      string    `json:"slug" gorm:"uniqueIndex;size:40;not null"`
+	Name      string    `json:"name" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Membership pertenencia de un usuario a una organización con su rol en ella
+// (admin o member), independiente de su rol global
+type Membership struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"uniqueIndex:idx_membership;not null"`
+	UserID         uint      `json:"user_id" gorm:"uniqueIndex:idx_membership;index;not null"`
+	Role           string    `json:"role" gorm:"size:16;not null"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Group grupo de usuarios de una organización (engineering, finance...). Sus
+// miembros reciben el rol del grupo en la organización además del suyo propio.
+type Group struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	OrganizationID uint   `json:"organization_id" gorm:"uniqueIndex:idx_group_slug;not null"`
+	Slug           string `json:"slug" gorm:"uniqueIndex:idx_group_slug;size:40;not null"`
+	Name           string `json:"name" gorm:"not null"`
+	// Rol en la organización que concede a sus miembros (admin o member)
+	Role      string    `json:"role" gorm:"size:16;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName groups es palabra reservada en algunos motores
+func (Group) TableName() string {
+	return "org_groups"
+}
+
+// GroupMember pertenencia de un usuario a un grupo; solo los miembros de la
+// organización pueden estar en sus grupos
+type GroupMember struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	GroupID   uint      `json:"group_id" gorm:"uniqueIndex:idx_group_member;not null"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_group_member;index;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
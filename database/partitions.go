@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/clock"
+
+	"gorm.io/gorm"
+)
+
+// PartitionJob trabajo periódico que crea las particiones de los próximos meses
+const PartitionJob = "database.partitions"
+
+// PartitionsAhead meses siguientes al actual cuya partición se crea por adelantado
+const PartitionsAhead = 3
+
+// Partitioning indica si las tablas de gran volumen se particionan por meses en
+// PostgreSQL (DB_PARTITIONING, activo por defecto)
+func Partitioning() bool {
+	if enabled, err := strconv.ParseBool(os.Getenv("DB_PARTITIONING")); err == nil {
+		return enabled
+	}
+	return true
+}
+
+// partitionedTable tabla que crece sin límite y se particiona por rangos
+// mensuales de Column, para que la retención elimine meses enteros con DROP
+// en lugar de borrar fila a fila
+type partitionedTable struct {
+	Model  interface{}
+	Table  string
+	Column string
+	// La columna es un día en texto (YYYY-MM-DD) en lugar de una fecha
+	Day bool
+}
+
+var partitionedTables = []partitionedTable{
+	{Model: &LoginEvent{}, Table: "login_events", Column: "created_at"},
+	{Model: &UserChange{}, Table: "user_changes", Column: "created_at"},
+	{Model: &UserUsage{}, Table: "user_usages", Column: "day", Day: true},
+	{Model: &APIKeyUsage{}, Table: "api_key_usages", Column: "day", Day: true},
+}
+
+// partitionTables convierte en particionadas las tablas de gran volumen que aún
+// no lo son y crea las particiones de los próximos meses. Como con los
+// índices, un fallo no impide arrancar: la tabla sigue sin particionar.
+func partitionTables(db *gorm.DB) {
+	if db.Dialector.Name() != "postgres" || !Partitioning() {
+		return
+	}
+	for _, p := range partitionedTables {
+		if relkind(db, p.Table) != "r" {
+			continue
+		}
+		if err := p.convert(db); err != nil {
+			log.Printf("⚠️  No se pudo particionar la tabla %s: %v", p.Table, err)
+			continue
+		}
+		log.Printf("🗂️  Tabla %s particionada por meses", p.Table)
+	}
+	if err := EnsurePartitions(db, clock.Now()); err != nil {
+		log.Printf("⚠️  No se pudieron crear las particiones: %v", err)
+	}
+}
+
+// convert sustituye la tabla por una particionada con las mismas columnas y
+// copia sus filas, en una transacción. La clave primaria pasa a incluir la
+// columna de partición, como exige PostgreSQL.
+func (p partitionedTable) convert(db *gorm.DB) error {
+	legacy := p.Table + "_unpartitioned"
+	return db.Transaction(func(tx *gorm.DB) error {
+		var months []string
+		if err := tx.Raw(fmt.Sprintf("SELECT DISTINCT %s FROM %s", p.monthOf(), p.Table)).Scan(&months).Error; err != nil {
+			return err
+		}
+		var sequence string
+		if err := tx.Raw("SELECT coalesce(pg_get_serial_sequence(?, 'id'), '')", p.Table).Scan(&sequence).Error; err != nil {
+			return err
+		}
+
+		statements := []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", p.Table, legacy),
+			fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (%s)",
+				p.Table, legacy, p.Column),
+			// Filas fuera de los meses creados (relojes desajustados, fechas erróneas)
+			fmt.Sprintf("CREATE TABLE %s_default PARTITION OF %s DEFAULT", p.Table, p.Table),
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		for _, m := range months {
+			month, err := time.Parse("2006-01", m)
+			if err != nil {
+				continue
+			}
+			if err := p.createPartition(tx, month); err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec(fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", p.Table, legacy)).Error; err != nil {
+			return err
+		}
+		// La secuencia del ID pertenece a la tabla antigua y se borraría con ella
+		if sequence != "" {
+			if err := tx.Exec(fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.id", sequence, p.Table)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec(fmt.Sprintf("DROP TABLE %s", legacy)).Error; err != nil {
+			return err
+		}
+		// Después de borrar la antigua, para que la clave conserve su nombre
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (id, %s)", p.Table, p.Column)).Error; err != nil {
+			return err
+		}
+		// Los índices del modelo se fueron con la tabla antigua
+		return tx.AutoMigrate(p.Model)
+	})
+}
+
+// EnsurePartitions crea, en las tablas particionadas, las particiones del mes
+// de now y de los PartitionsAhead siguientes que falten
+func EnsurePartitions(db *gorm.DB, now time.Time) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	month := monthStart(now)
+	for _, p := range partitionedTables {
+		if relkind(db, p.Table) != "p" {
+			continue
+		}
+		for i := 0; i <= PartitionsAhead; i++ {
+			if err := p.createPartition(db, month.AddDate(0, i, 0)); err != nil {
+				return fmt.Errorf("%s: %w", p.Table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// MaintainPartitions manejador de PartitionJob
+func MaintainPartitions(ctx context.Context, _ []byte) error {
+	return EnsurePartitions(DB.WithContext(ctx), clock.Now())
+}
+
+// DropPartitions elimina las particiones mensuales de table que terminan antes
+// de cutoff y devuelve cuántas filas tenían. Las reglas de retención borran
+// después con DELETE lo que quede anterior a cutoff (en la partición del mes
+// de cutoff o en la de por defecto). Sin particiones no hace nada.
+func DropPartitions(ctx context.Context, table string, cutoff time.Time) (int64, error) {
+	db := DB.WithContext(Unbounded(ctx))
+	if db.Dialector.Name() != "postgres" || relkind(db, table) != "p" {
+		return 0, nil
+	}
+	var names []string
+	if err := db.Raw("SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = to_regclass(?) ORDER BY c.relname",
+		table).Scan(&names).Error; err != nil {
+		return 0, err
+	}
+
+	var dropped int64
+	for _, name := range names {
+		month, err := time.Parse("2006_01", strings.TrimPrefix(name, table+"_p"))
+		if err != nil || !strings.HasPrefix(name, table+"_p") || month.AddDate(0, 1, 0).After(cutoff) {
+			continue
+		}
+		// Contar una partición grande puede superar el statement_timeout
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SET LOCAL statement_timeout = 0").Error; err != nil {
+				return err
+			}
+			var n int64
+			if err := tx.Table(name).Count(&n).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(fmt.Sprintf("DROP TABLE %s", name)).Error; err != nil {
+				return err
+			}
+			dropped += n
+			return nil
+		})
+		if err != nil {
+			return dropped, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return dropped, nil
+}
+
+func (p partitionedTable) createPartition(db *gorm.DB, month time.Time) error {
+	return db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_p%s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		p.Table, month.Format("2006_01"), p.Table, p.bound(month), p.bound(month.AddDate(0, 1, 0)))).Error
+}
+
+// bound límite de una partición en el formato de la columna
+func (p partitionedTable) bound(month time.Time) string {
+	if p.Day {
+		return month.Format("2006-01-02")
+	}
+	return month.Format("2006-01-02 15:04:05") + "+00"
+}
+
+// monthOf expresión SQL con el mes (YYYY-MM) de la columna de partición
+func (p partitionedTable) monthOf() string {
+	if p.Day {
+		return fmt.Sprintf("substr(%s, 1, 7)", p.Column)
+	}
+	return fmt.Sprintf("to_char(%s AT TIME ZONE 'UTC', 'YYYY-MM')", p.Column)
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// relkind tipo de la tabla en PostgreSQL: "r" normal, "p" particionada, "" si no existe
+func relkind(db *gorm.DB, table string) string {
+	var kind string
+	db.Raw("SELECT coalesce((SELECT relkind::text FROM pg_class WHERE oid = to_regclass(?)), '')", table).Scan(&kind)
+	return kind
+}
@@ -0,0 +1,24 @@
+package database
+
+import "time"
+
+// Plan plan comercial con las funciones (entitlements) que incluye
+type Plan struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Code          string    `json:"code" gorm:"uniqueIndex;size:32;not null"`
+	Name          string    `json:"name" gorm:"not null"`
+	Features      []string  `json:"features" gorm:"serializer:json"`
+	StripePriceID string    `json:"stripe_price_id" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// HasFeature indica si el plan incluye la función indicada
+func (p Plan) HasFeature(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package database
+
+import "time"
+
+// Policy política de autorización definida por la administración, que se
+// suma a las predefinidas en el código (ver paquete authz)
+type Policy struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"uniqueIndex;size:64;not null"`
+	Description string `json:"description,omitempty"`
+	// allow o deny
+	Effect string `json:"effect" gorm:"size:8;not null"`
+	// Acciones a las que se aplica (users:update, users:*, *)
+	Actions []string `json:"actions" gorm:"serializer:json;not null"`
+	// Condición sobre los atributos del actor y del recurso; vacía = siempre
+	Condition string    `json:"condition,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
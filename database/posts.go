@@ -0,0 +1,16 @@
+package database
+
+import "time"
+
+// Post publicación de un usuario. Las públicas las ve cualquier usuario
+// autenticado; las privadas, solo su autor y los administradores.
+type Post struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"user_id" gorm:"index;not null"`
+	Title  string `json:"title" gorm:"size:200;not null"`
+	Body   string `json:"body" gorm:"type:text"`
+	// public o private
+	Visibility string    `json:"visibility" gorm:"size:16;index;not null;default:public"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,27 @@
+package database
+
+import "time"
+
+// Profile datos personales opcionales del usuario. Se guardan aparte de User,
+// que solo tiene lo necesario para autenticar y autorizar.
+type Profile struct {
+	UserID uint   `json:"-" gorm:"primaryKey"`
+	Bio    string `json:"bio" gorm:"size:500"`
+	// Teléfono en formato E.164 (+34600111222)
+	Phone string `json:"phone" gorm:"serializer:encrypted"`
+	// Fecha de nacimiento (AAAA-MM-DD)
+	Birthday  string    `json:"birthday" gorm:"size:10"`
+	Address   Address   `json:"address" gorm:"embedded;embeddedPrefix:address_"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Address dirección postal del perfil
+type Address struct {
+	Line1      string `json:"line1" gorm:"serializer:encrypted"`
+	Line2      string `json:"line2" gorm:"serializer:encrypted"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code" gorm:"size:16"`
+	// Código ISO 3166-1 alfa-2 del país (ES, MX...)
+	Country string `json:"country" gorm:"size:2"`
+}
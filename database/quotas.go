@@ -0,0 +1,26 @@
+package database
+
+import "time"
+
+// Quota límite personalizado de una cuota para una cuenta; si no existe se
+// aplica el valor por defecto configurado
+type Quota struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	Scope     string    `json:"scope" gorm:"uniqueIndex:idx_quota;size:16;not null"`
+	ScopeID   uint      `json:"scope_id" gorm:"uniqueIndex:idx_quota;not null"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_quota;size:64;not null"`
+	Limit     int64     `json:"limit" gorm:"column:quota_limit;not null"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QuotaCounter consumo acumulado de una cuota de consumo (p. ej. peticiones
+// por día) en una ventana; compartido por todas las instancias de la API
+type QuotaCounter struct {
+	ID      uint   `json:"-" gorm:"primaryKey"`
+	Scope   string `json:"scope" gorm:"uniqueIndex:idx_quota_counter;size:16;not null"`
+	ScopeID uint   `json:"scope_id" gorm:"uniqueIndex:idx_quota_counter;not null"`
+	Name    string `json:"name" gorm:"uniqueIndex:idx_quota_counter;size:64;not null"`
+	// Period identifica la ventana de la cuota (el día UTC en las diarias)
+	Period string `json:"period" gorm:"uniqueIndex:idx_quota_counter;size:16;not null"`
+	Count  int64  `json:"count" gorm:"not null"`
+}
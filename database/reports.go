@@ -0,0 +1,44 @@
+package database
+
+import "time"
+
+// Report informe de administración generado en segundo plano: un libro de
+// Excel (usuarios, auditoría) o el resumen mensual en PDF
+type Report struct {
+	ID   string `json:"id" gorm:"primaryKey;size:64"`
+	Type string `json:"type" gorm:"size:32;not null"`
+	// Mes (2006-01) del resumen mensual; vacío en los demás informes
+	Period string `json:"period,omitempty" gorm:"size:7"`
+	// Periodo [inicio, fin) de los datos de los informes programados; sin él,
+	// todo el historial
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+	// Programación que lo generó (ver ReportSchedule)
+	ScheduleID  *uint      `json:"schedule_id,omitempty" gorm:"index"`
+	RequestedBy uint       `json:"requested_by" gorm:"index;not null"`
+	Status      string     `json:"status" gorm:"default:'pending'"`
+	ObjectKey   string     `json:"-"`
+	Size        int64      `json:"size"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ReportSchedule informe que se genera periódicamente y se envía por correo a
+// los destinatarios, con los datos del último periodo completo
+type ReportSchedule struct {
+	ID         uint     `json:"id" gorm:"primaryKey"`
+	Name       string   `json:"name" gorm:"size:100;not null"`
+	Type       string   `json:"type" gorm:"size:32;not null"`
+	Frequency  string   `json:"frequency" gorm:"size:16;not null"`
+	Recipients []string `json:"recipients" gorm:"serializer:json"`
+	Enabled    bool     `json:"enabled"`
+	CreatedBy  uint     `json:"created_by" gorm:"index;not null"`
+	// Próxima ejecución: el final del periodo que cubrirá el informe
+	NextRunAt time.Time  `json:"next_run_at" gorm:"index"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	// Error de la última ejecución; vacío si fue bien
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package database
+
+import "time"
+
+// RetentionRun resultado de ejecutar una regla de retención
+type RetentionRun struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	Rule       string    `json:"rule" gorm:"index;not null"`
+	Cutoff     time.Time `json:"cutoff"`
+	Purged     int64     `json:"purged"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at" gorm:"index"`
+	FinishedAt time.Time `json:"finished_at"`
+}
@@ -0,0 +1,10 @@
+package database
+
+// trigram indica si la extensión pg_trgm está disponible
+var trigram bool
+
+// HasTrigram indica si se puede buscar por similitud de trigramas (PostgreSQL
+// con la extensión pg_trgm instalada)
+func HasTrigram() bool {
+	return trigram
+}
@@ -0,0 +1,19 @@
+package database
+
+import "time"
+
+// Setting ajuste global de la aplicación modificable en caliente (valor JSON)
+type Setting struct {
+	Key       string    `json:"key" gorm:"primaryKey;size:64"`
+	Value     string    `json:"value" gorm:"type:text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserSettings preferencias guardadas por un usuario (ver paquete preferences);
+// Version aumenta con cada cambio para detectar escrituras concurrentes
+type UserSettings struct {
+	UserID    uint                   `json:"-" gorm:"primaryKey"`
+	Values    map[string]interface{} `json:"values" gorm:"column:preferences;serializer:json"`
+	Version   int                    `json:"version"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package database
+
+import "time"
+
+// Suspension suspensión de una cuenta por un administrador, con el motivo que
+// se muestra al usuario. Se conservan las vencidas y levantadas, con las
+// acciones de cada una, para revisar las apelaciones.
+type Suspension struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"user_id" gorm:"index;not null"`
+	Reason string `json:"reason" gorm:"size:500;not null"`
+	// nil = hasta que se levante
+	EndsAt    *time.Time `json:"ends_at"`
+	CreatedBy uint       `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	LiftedAt  *time.Time `json:"lifted_at,omitempty"`
+	LiftedBy  *uint      `json:"lifted_by,omitempty"`
+	// Apelación del usuario, una por suspensión: pending, rejected o accepted
+	Appeal       string             `json:"appeal,omitempty" gorm:"size:2000"`
+	AppealedAt   *time.Time         `json:"appealed_at,omitempty"`
+	AppealStatus string             `json:"appeal_status,omitempty" gorm:"size:16;index"`
+	Actions      []SuspensionAction `json:"actions,omitempty"`
+}
+
+// SuspensionAction acción sobre una suspensión: la suspensión, la apelación
+// del usuario y las decisiones de los administradores, con su nota
+type SuspensionAction struct {
+	ID           uint `json:"id" gorm:"primaryKey"`
+	SuspensionID uint `json:"suspension_id" gorm:"index;not null"`
+	// Administrador o, al apelar, el propio usuario suspendido
+	ActorID   uint      `json:"actor_id" gorm:"not null"`
+	Action    string    `json:"action" gorm:"size:32;not null"`
+	Note      string    `json:"note,omitempty" gorm:"size:2000"`
+	CreatedAt time.Time `json:"created_at"`
+}
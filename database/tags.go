@@ -0,0 +1,22 @@
+package database
+
+import "time"
+
+// Tag etiqueta que los administradores asignan a usuarios (beta, vip...). Se
+// crea al asignarla por primera vez.
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"uniqueIndex;size:40;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserTag asignación de una etiqueta a un usuario. La clave primaria sirve
+// para las etiquetas de un usuario e idx_user_tags_tag para filtrar los
+// usuarios por etiqueta.
+type UserTag struct {
+	UserID uint `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	TagID  uint `json:"tag_id" gorm:"primaryKey;autoIncrement:false;index:idx_user_tags_tag"`
+	// Administrador que la asignó
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
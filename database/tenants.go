@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api/tenancy"
+)
+
+// Tenant cliente con su propio esquema de PostgreSQL (TENANCY=schema). La
+// tabla solo existe en el esquema public.
+type Tenant struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Slug string `json:"slug" gorm:"uniqueIndex;size:40;not null"`
+	Name string `json:"name" gorm:"not null"`
+	// provisioning mientras se crea su esquema, active, suspended o failed si
+	// la última migración de su esquema falló (sus peticiones se rechazan)
+	Status string `json:"status" gorm:"size:16;not null;default:'provisioning'"`
+	Error  string `json:"error,omitempty"`
+	// Motivo de la suspensión: billing (impago, 402) o admin (403)
+	SuspendReason string     `json:"suspend_reason,omitempty" gorm:"size:16"`
+	SuspendedAt   *time.Time `json:"suspended_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Schema esquema de PostgreSQL del tenant
+func (t *Tenant) Schema() string {
+	return tenancy.Schema(t.Slug)
+}
+
+// TenantAccess petición de un administrador de la plataforma dentro de un
+// tenant (X-Tenant con un token del esquema public). Solo existe en public.
+type TenantAccess struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	AdminID   uint      `json:"admin_id" gorm:"index;not null"`
+	Tenant    string    `json:"tenant" gorm:"index;size:40;not null"`
+	Method    string    `json:"method" gorm:"size:8;not null"`
+	Path      string    `json:"path" gorm:"not null"`
+	Status    int       `json:"status"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// TenantEvent evento del ciclo de vida de un tenant (alta, suspensión,
+// reactivación, exportación, baja), para facturación y automatizaciones de
+// operaciones. Solo existe en public y se conserva tras la baja del tenant.
+type TenantEvent struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	Tenant string `json:"tenant" gorm:"index;size:40;not null"`
+	Type   string `json:"type" gorm:"index;size:32;not null"`
+	// Administrador de la plataforma que hizo la operación; vacío en las de
+	// la propia API (una exportación que termina)
+	ActorID *uint `json:"actor_id,omitempty"`
+	// Motivo de la suspensión, copia exportada o error, según el tipo
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// platformModels modelos que solo existen en el esquema public
+func platformModels() []interface{} {
+	return []interface{}{&Tenant{}, &TenantAccess{}, &TenantEvent{}}
+}
+
+// tenantPool pool de conexiones para GORM que envía cada consulta al esquema
+// del tenant de su contexto: un *sql.DB por tenant, cuyas conexiones se abren
+// con search_path = <esquema>, public (public por las extensiones, como
+// pg_trgm). Sin tenant en el contexto se usa el pool del esquema public.
+type tenantPool struct {
+	*sql.DB
+	open  func(schema string) *sql.DB
+	mu    sync.Mutex
+	pools map[string]*sql.DB
+}
+
+func newTenantPool(db *sql.DB, open func(schema string) *sql.DB) *tenantPool {
+	return &tenantPool{DB: db, open: open, pools: map[string]*sql.DB{}}
+}
+
+// For pool del tenant de ctx
+func (p *tenantPool) For(ctx context.Context) *sql.DB {
+	slug := tenancy.From(ctx)
+	if slug == "" {
+		return p.DB
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	db, ok := p.pools[slug]
+	if !ok {
+		db = p.open(tenancy.Schema(slug))
+		p.pools[slug] = db
+	}
+	return db
+}
+
+// close cierra y olvida el pool del tenant slug
+func (p *tenantPool) close(slug string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if db, ok := p.pools[slug]; ok {
+		db.Close()
+		delete(p.pools, slug)
+	}
+}
+
+func (p *tenantPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.For(ctx).PrepareContext(ctx, query)
+}
+
+func (p *tenantPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.For(ctx).ExecContext(ctx, query, args...)
+}
+
+func (p *tenantPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.For(ctx).QueryContext(ctx, query, args...)
+}
+
+func (p *tenantPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.For(ctx).QueryRowContext(ctx, query, args...)
+}
+
+func (p *tenantPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.For(ctx).BeginTx(ctx, opts)
+}
+
+// GetDBConn pool del esquema public, el que devuelve DB.DB()
+func (p *tenantPool) GetDBConn() (*sql.DB, error) {
+	return p.DB, nil
+}
+
+// MigrateTenant crea el esquema del tenant si no existe y crea o actualiza en
+// él las tablas e índices de los modelos
+func MigrateTenant(ctx context.Context, slug string) error {
+	if !tenancy.ValidSlug(slug) {
+		return fmt.Errorf("identificador de tenant inválido: %q", slug)
+	}
+	db := DB.WithContext(Unbounded(ctx))
+	if err := db.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", tenancy.Schema(slug))).Error; err != nil {
+		return err
+	}
+	return migrate(db, tenancy.Schema(slug))
+}
+
+// DropTenant borra el esquema del tenant con todos sus datos y cierra sus
+// conexiones
+func DropTenant(ctx context.Context, slug string) error {
+	if !tenancy.ValidSlug(slug) {
+		return fmt.Errorf("identificador de tenant inválido: %q", slug)
+	}
+	if pool, ok := DB.ConnPool.(*tenantPool); ok {
+		pool.close(slug)
+	}
+	return DB.WithContext(Unbounded(tenancy.With(ctx, ""))).
+		Exec(fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", tenancy.Schema(slug))).Error
+}
+
+// migrateTenants migra al arrancar los esquemas de los tenants activos y de
+// los que fallaron la vez anterior. Un tenant cuya migración falla queda como
+// failed y sus peticiones se rechazan: con el search_path, las tablas que le
+// faltaran se leerían del esquema public.
+func migrateTenants(ctx context.Context) error {
+	var list []Tenant
+	if err := DB.WithContext(ctx).Where("status IN ?", []string{"active", "failed"}).Order("id").Find(&list).Error; err != nil {
+		return err
+	}
+	for i := range list {
+		status, message := "active", ""
+		if err := MigrateTenant(ctx, list[i].Slug); err != nil {
+			log.Printf("❌ No se pudo migrar el esquema del tenant %s: %v", list[i].Slug, err)
+			status, message = "failed", err.Error()
+		}
+		if err := DB.WithContext(ctx).Model(&list[i]).Updates(map[string]interface{}{"status": status, "error": message}).Error; err != nil {
+			return err
+		}
+	}
+	if len(list) > 0 {
+		log.Printf("🏢 Esquemas de %d tenants migrados", len(list))
+	}
+	return nil
+}
+
+// ForEachTenant ejecuta fn con el esquema public y, con TENANCY=schema, con
+// cada tenant activo en el contexto. Si ctx ya es de un tenant solo se ejecuta
+// para él. Los errores de cada tenant no detienen a los demás.
+func ForEachTenant(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !tenancy.Enabled() || tenancy.From(ctx) != "" {
+		return fn(ctx)
+	}
+	var errs []error
+	if err := fn(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	var list []Tenant
+	if err := DB.WithContext(ctx).Where("status = ?", "active").Order("id").Find(&list).Error; err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, t := range list {
+		if err := fn(tenancy.With(ctx, t.Slug)); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", t.Slug, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PerTenant adapta el manejador de un trabajo periódico para que se ejecute
+// con ForEachTenant
+func PerTenant(h func(ctx context.Context, payload []byte) error) func(ctx context.Context, payload []byte) error {
+	return func(ctx context.Context, payload []byte) error {
+		return ForEachTenant(ctx, func(ctx context.Context) error {
+			return h(ctx, payload)
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package database
+
+import "time"
+
+// TermsAcceptance aceptación de una versión de los términos de uso, que se
+// conserva como prueba del consentimiento
+type TermsAcceptance struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"index;not null"`
+	Version    string    `json:"version" gorm:"size:32;not null"`
+	IP         string    `json:"ip" gorm:"size:45"`
+	AcceptedAt time.Time `json:"accepted_at"`
+}
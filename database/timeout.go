@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// QueryTimeout tiempo máximo de cada consulta (DB_STATEMENT_TIMEOUT, 30s por
+// defecto; 0 = sin límite). En PostgreSQL se aplica además como
+// statement_timeout de la sesión, para que el servidor corte la consulta
+// aunque el proceso que la lanzó haya desaparecido (salvo con PgBouncer, que
+// no admite parámetros de sesión: ahí hay que fijarlo en el rol).
+func QueryTimeout() time.Duration {
+	value := os.Getenv("DB_STATEMENT_TIMEOUT")
+	if value == "" {
+		return 30 * time.Second
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 30 * time.Second
+	}
+	return d
+}
+
+// IsTimeout indica si la consulta se canceló por superar su tiempo máximo
+// (el plazo del contexto o el statement_timeout de PostgreSQL)
+func IsTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &pgErr) && pgErr.Code == "57014"
+}
+
+type timeoutsKey struct{}
+
+// timeouts consultas de una petición con plazo, para TrackTimeouts
+type timeouts struct {
+	mu  sync.Mutex
+	hit bool
+	// Plazos de los cursores, que siguen corriendo mientras se leen
+	cursors []context.Context
+}
+
+func (t *timeouts) add(hit bool, cursor context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hit = t.hit || hit
+	if cursor != nil {
+		t.cursors = append(t.cursors, cursor)
+	}
+}
+
+func (t *timeouts) expired() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, ctx := range t.cursors {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return true
+		}
+	}
+	return t.hit
+}
+
+// TrackTimeouts devuelve un contexto que registra si alguna consulta hecha con
+// él superó su tiempo máximo, y la función para consultarlo
+func TrackTimeouts(ctx context.Context) (context.Context, func() bool) {
+	t := &timeouts{}
+	return context.WithValue(ctx, timeoutsKey{}, t), t.expired
+}
+
+type unboundedKey struct{}
+
+// Unbounded devuelve un contexto cuyas consultas no tienen el tiempo máximo de
+// QueryTimeout (operaciones largas como VACUUM INTO); en PostgreSQL sigue
+// aplicándose el statement_timeout de la sesión
+func Unbounded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unboundedKey{}, true)
+}
+
+// registerTimeouts limita cada consulta a timeout con un plazo en su contexto,
+// lo que funciona con cualquier motor. En los cursores (Rows, Scan) el plazo
+// cubre también la lectura de las filas; Stream los deja sin límite.
+func registerTimeouts(db *gorm.DB, timeout time.Duration) error {
+	before := func(cursor bool) func(tx *gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx := tx.Statement.Context
+			if timeout <= 0 || ctx.Value(unboundedKey{}) != nil {
+				return
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+				return
+			}
+			limited, cancel := context.WithTimeout(ctx, timeout)
+			tx.Statement.Context = limited
+			tx.InstanceSet("timeout:restore", func() {
+				// La misma sentencia puede reutilizarse en otra consulta
+				tx.Statement.Context = ctx
+				t, _ := ctx.Value(timeoutsKey{}).(*timeouts)
+				if cursor {
+					// Las filas se leen después: el plazo sigue corriendo hasta que venza
+					if t != nil {
+						t.add(false, limited)
+					}
+					return
+				}
+				hit := errors.Is(limited.Err(), context.DeadlineExceeded)
+				cancel()
+				if t != nil {
+					t.add(hit, nil)
+				}
+			})
+		}
+	}
+	after := func(tx *gorm.DB) {
+		if value, ok := tx.InstanceGet("timeout:restore"); ok {
+			if restore, _ := value.(func()); restore != nil {
+				restore()
+				tx.InstanceSet("timeout:restore", nil)
+			}
+		}
+		// statement_timeout de PostgreSQL
+		if IsTimeout(tx.Error) {
+			if t, ok := tx.Statement.Context.Value(timeoutsKey{}).(*timeouts); ok {
+				t.add(true, nil)
+			}
+		}
+	}
+
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("timeout:before", before(false)),
+		callbacks.Create().After("gorm:create").Register("timeout:after", after),
+		callbacks.Query().Before("gorm:query").Register("timeout:before", before(false)),
+		callbacks.Query().After("gorm:query").Register("timeout:after", after),
+		callbacks.Update().Before("gorm:update").Register("timeout:before", before(false)),
+		callbacks.Update().After("gorm:update").Register("timeout:after", after),
+		callbacks.Delete().Before("gorm:delete").Register("timeout:before", before(false)),
+		callbacks.Delete().After("gorm:delete").Register("timeout:after", after),
+		callbacks.Raw().Before("gorm:raw").Register("timeout:before", before(false)),
+		callbacks.Raw().After("gorm:raw").Register("timeout:after", after),
+		callbacks.Row().Before("gorm:row").Register("timeout:before", before(true)),
+		callbacks.Row().After("gorm:row").Register("timeout:after", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stream ejecuta como cursor la consulta que construye query y pasa sus filas
+// a fn, sin tiempo máximo: los listados en streaming y los informes leen las
+// filas al ritmo del cliente o del fichero que generan, y en PostgreSQL el
+// statement_timeout contaría ese tiempo. fn no debe retener las filas.
+func Stream(ctx context.Context, query func(db *gorm.DB) *gorm.DB, fn func(rows *sql.Rows) error) error {
+	run := func(tx *gorm.DB) error {
+		rows, err := query(tx).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		return fn(rows)
+	}
+	db := DB.WithContext(Unbounded(ctx))
+	if db.Dialector.Name() != "postgres" {
+		return run(db)
+	}
+	// SET LOCAL solo dura hasta el final de la transacción
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET LOCAL statement_timeout = 0").Error; err != nil {
+			return err
+		}
+		return run(tx)
+	})
+}
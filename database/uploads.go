@@ -0,0 +1,44 @@
+package database
+
+import "time"
+
+// UploadSession sesión de subida por partes que permite reanudar transferencias
+type UploadSession struct {
+	ID          string    `json:"id" gorm:"primaryKey;size:64"`
+	UserID      uint      `json:"user_id" gorm:"index;not null"`
+	Filename    string    `json:"filename" gorm:"not null"`
+	ContentType string    `json:"content_type"`
+	TotalSize   int64     `json:"total_size" gorm:"not null"`
+	ChunkSize   int64     `json:"chunk_size" gorm:"not null"`
+	TotalParts  int       `json:"total_parts" gorm:"not null"`
+	Status      string    `json:"status" gorm:"default:'pending'"`
+	ObjectKey   string    `json:"-"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UploadPart parte ya recibida de una sesión de subida
+type UploadPart struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	SessionID string    `json:"session_id" gorm:"uniqueIndex:idx_upload_part;size:64;not null"`
+	Number    int       `json:"number" gorm:"uniqueIndex:idx_upload_part;not null"`
+	Size      int64     `json:"size" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DirectUpload subida directa al almacenamiento mediante URL prefirmada,
+// pendiente de confirmación por parte del cliente
+type DirectUpload struct {
+	ID          string    `json:"id" gorm:"primaryKey;size:64"`
+	UserID      uint      `json:"user_id" gorm:"index;not null"`
+	Purpose     string    `json:"purpose" gorm:"not null"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type" gorm:"not null"`
+	Size        int64     `json:"size" gorm:"not null"`
+	Status      string    `json:"status" gorm:"default:'pending'"`
+	ObjectKey   string    `json:"-" gorm:"not null"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package database
+
+import "time"
+
+// UserUsage uso agregado de la API por usuario, día y endpoint
+type UserUsage struct {
+	ID         uint      `json:"-" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_user_usage;not null"`
+	Day        string    `json:"day" gorm:"uniqueIndex:idx_user_usage;size:10;not null"`
+	Endpoint   string    `json:"endpoint" gorm:"uniqueIndex:idx_user_usage;not null"`
+	Count      int64     `json:"count" gorm:"not null"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
@@ -0,0 +1,22 @@
+package database
+
+import "time"
+
+// UserChange modificación de un usuario hecha por un administrador: qué campos
+// cambió, con el valor anterior y el nuevo de cada uno
+type UserChange struct {
+	ID      uint `json:"id" gorm:"primaryKey"`
+	UserID  uint `json:"user_id" gorm:"index;not null"`
+	ActorID uint `json:"actor_id" gorm:"index;not null"`
+	// Operación que hizo el cambio (update, plan, delete)
+	Action    string        `json:"action" gorm:"size:32;not null"`
+	Changes   []FieldChange `json:"changes" gorm:"serializer:json"`
+	CreatedAt time.Time     `json:"created_at" gorm:"index;not null"`
+}
+
+// FieldChange valor anterior y nuevo de un campo; nil si no tenía valor
+type FieldChange struct {
+	Field  string  `json:"field"`
+	Before *string `json:"before"`
+	After  *string `json:"after"`
+}
@@ -0,0 +1,22 @@
+package database
+
+import "time"
+
+// VerificationRequest solicitud de verificación de una cuenta: el usuario
+// aporta pruebas y un administrador la aprueba o la rechaza con una nota. Se
+// conservan todas, también las rechazadas y retiradas.
+type VerificationRequest struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	UserID uint `json:"user_id" gorm:"index;not null"`
+	// pending, approved, rejected, cancelled o revoked (ver
+	// services.verificationTransitions)
+	Status   string   `json:"status" gorm:"size:16;index;not null"`
+	Evidence string   `json:"evidence" gorm:"size:4000;not null"`
+	Links    []string `json:"links,omitempty" gorm:"serializer:json"`
+	// Nota del administrador que la revisó, visible para el usuario
+	Notes      string     `json:"notes,omitempty" gorm:"size:2000"`
+	ReviewedBy *uint      `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
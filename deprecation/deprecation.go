@@ -0,0 +1,63 @@
+package deprecation
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Info datos de deprecación de una ruta
+type Info struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Since fecha desde la que la ruta se considera obsoleta
+	Since time.Time `json:"since"`
+	// Sunset fecha prevista de retirada (opcional)
+	Sunset *time.Time `json:"sunset,omitempty"`
+	// Successor ruta que la sustituye (opcional)
+	Successor string `json:"successor,omitempty"`
+	// Docs enlace con la guía de migración (opcional)
+	Docs string `json:"docs,omitempty"`
+}
+
+// Endpoint identificador de la ruta con el mismo formato que las métricas de uso ("GET /api/v1/users")
+func (i Info) Endpoint() string {
+	return i.Method + " " + i.Path
+}
+
+var (
+	mu     sync.RWMutex
+	routes = map[string]Info{}
+)
+
+// Register marca la ruta (plantilla completa, p. ej. /api/v1/users/:id) como obsoleta
+func Register(info Info) {
+	mu.Lock()
+	defer mu.Unlock()
+	routes[info.Endpoint()] = info
+}
+
+// Lookup devuelve los datos de deprecación de la ruta, si está marcada
+func Lookup(method, path string) (Info, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	info, ok := routes[method+" "+path]
+	return info, ok
+}
+
+// All devuelve las rutas obsoletas ordenadas por ruta y método
+func All() []Info {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]Info, 0, len(routes))
+	for _, info := range routes {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
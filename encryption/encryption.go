@@ -0,0 +1,273 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"api/auth"
+	"api/secrets"
+)
+
+// Prefijo de los valores cifrados: enc:v1:<keyID>:<DEK envuelta>:<datos>
+const prefix = "enc:v1:"
+
+// ErrNoKey se devuelve cuando no hay clave maestra configurada para la operación
+var ErrNoKey = errors.New("clave maestra de cifrado no disponible")
+
+// KeyProvider envuelve y desenvuelve claves de datos (DEK) con una clave
+// maestra. La implementación local usa claves en variables de entorno; un
+// KMS externo solo necesita implementar esta interfaz.
+type KeyProvider interface {
+	// ActiveKeyID identifica la clave maestra con la que se cifran los valores nuevos
+	ActiveKeyID() string
+	WrapKey(keyID string, dek []byte) ([]byte, error)
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+var (
+	mu       sync.RWMutex
+	provider KeyProvider
+)
+
+// SetProvider establece el proveedor de claves maestras
+func SetProvider(p KeyProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	provider = p
+}
+
+func currentProvider() (KeyProvider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if provider == nil {
+		return nil, ErrNoKey
+	}
+	return provider, nil
+}
+
+func init() {
+	secrets.OnRenew("ENCRYPTION_KEYS", Init)
+}
+
+// Init configura el proveedor local a partir de ENCRYPTION_KEYS
+// ("id1:base64,id2:base64") y ENCRYPTION_ACTIVE_KEY (por defecto la última).
+// En modo release las claves son obligatorias: la clave de desarrollo se
+// deriva de JWT_SECRET y rotar ese secreto dejaría ilegibles los datos cifrados.
+func Init() error {
+	raw := os.Getenv("ENCRYPTION_KEYS")
+	if raw == "" {
+		if os.Getenv("GIN_MODE") == "release" {
+			return errors.New("ENCRYPTION_KEYS es obligatorio en modo release")
+		}
+		log.Println("⚠️  ENCRYPTION_KEYS no configurada, usando una clave derivada de JWT_SECRET (solo desarrollo; los datos cifrados solo se leen con el mismo JWT_SECRET)")
+		SetProvider(&LocalKeyProvider{keys: map[string][]byte{"dev": auth.DeriveKey("pii-encryption")}, active: "dev"})
+		return nil
+	}
+
+	p := &LocalKeyProvider{keys: map[string][]byte{}}
+	for _, entry := range strings.Split(raw, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return fmt.Errorf("entrada de ENCRYPTION_KEYS inválida: %q", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("la clave %s debe ser de 32 bytes en base64", id)
+		}
+		p.keys[id] = key
+		p.active = id
+	}
+	if active := os.Getenv("ENCRYPTION_ACTIVE_KEY"); active != "" {
+		if _, ok := p.keys[active]; !ok {
+			return fmt.Errorf("ENCRYPTION_ACTIVE_KEY %s no está en ENCRYPTION_KEYS", active)
+		}
+		p.active = active
+	}
+
+	SetProvider(p)
+	log.Printf("🔐 Cifrado de campos con la clave maestra %s", p.active)
+	return nil
+}
+
+// ActiveKeyID devuelve la clave maestra activa del proveedor configurado
+func ActiveKeyID() string {
+	p, err := currentProvider()
+	if err != nil {
+		return ""
+	}
+	return p.ActiveKeyID()
+}
+
+// LocalKeyProvider claves maestras locales (AES-256-GCM)
+type LocalKeyProvider struct {
+	keys   map[string][]byte
+	active string
+}
+
+func (p *LocalKeyProvider) ActiveKeyID() string { return p.active }
+
+func (p *LocalKeyProvider) WrapKey(keyID string, dek []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, ErrNoKey
+	}
+	return seal(key, dek)
+}
+
+func (p *LocalKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoKey, keyID)
+	}
+	return open(key, wrapped)
+}
+
+// Encrypt cifra el texto con una DEK aleatoria envuelta por la clave maestra activa
+func Encrypt(plaintext string) (string, error) {
+	p, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	keyID := p.ActiveKeyID()
+	wrapped, err := p.WrapKey(keyID, dek)
+	if err != nil {
+		return "", err
+	}
+	data, err := seal(dek, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + keyID + ":" + base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(data), nil
+}
+
+// Decrypt descifra un valor generado por Encrypt. Los valores sin prefijo se
+// devuelven tal cual para admitir datos anteriores al cifrado.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 3)
+	if len(parts) != 3 {
+		return "", errors.New("valor cifrado malformado")
+	}
+
+	p, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	dek, err := p.UnwrapKey(parts[0], wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, data)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted indica si el valor tiene el formato de cifrado
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID devuelve la clave maestra con la que se cifró el valor
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+// NewDataKey genera una DEK para cifrar por su cuenta datos que no caben en
+// un valor (ficheros) y la devuelve junto con su versión envuelta por la
+// clave maestra activa (<keyID>:<base64>), que se guarda con los datos
+func NewDataKey() ([]byte, string, error) {
+	p, err := currentProvider()
+	if err != nil {
+		return nil, "", err
+	}
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, "", err
+	}
+	keyID := p.ActiveKeyID()
+	wrapped, err := p.WrapKey(keyID, dek)
+	if err != nil {
+		return nil, "", err
+	}
+	return dek, keyID + ":" + base64.RawStdEncoding.EncodeToString(wrapped), nil
+}
+
+// OpenDataKey desenvuelve una DEK de NewDataKey
+func OpenDataKey(wrapped string) ([]byte, error) {
+	keyID, encoded, ok := strings.Cut(wrapped, ":")
+	if !ok {
+		return nil, errors.New("clave de datos malformada")
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	p, err := currentProvider()
+	if err != nil {
+		return nil, err
+	}
+	return p.UnwrapKey(keyID, data)
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("datos cifrados demasiado cortos")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,99 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func setKeys(t *testing.T, keys, active string) {
+	t.Helper()
+	t.Setenv("ENCRYPTION_KEYS", keys)
+	t.Setenv("ENCRYPTION_ACTIVE_KEY", active)
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1), "")
+
+	for _, plaintext := range []string{"", "192.168.1.10", "Mozilla/5.0 (X11; Linux x86_64)", "ñandú 🔐"} {
+		encrypted, err := Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncrypted(encrypted) || KeyID(encrypted) != "k1" {
+			t.Fatalf("formato inesperado: %q", encrypted)
+		}
+		if plaintext != "" && strings.Contains(encrypted, plaintext) {
+			t.Fatalf("el texto en claro aparece en %q", encrypted)
+		}
+		decrypted, err := Decrypt(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decrypted != plaintext {
+			t.Errorf("Decrypt() = %q, se esperaba %q", decrypted, plaintext)
+		}
+	}
+}
+
+func TestDecryptAfterRotation(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1), "")
+	old, err := Encrypt("dato antiguo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Con k2 activa se siguen leyendo los valores cifrados con k1
+	setKeys(t, "k1:"+testKey(1)+",k2:"+testKey(2), "")
+	if got, err := Decrypt(old); err != nil || got != "dato antiguo" {
+		t.Fatalf("Decrypt() = %q, %v", got, err)
+	}
+	current, _ := Encrypt("dato nuevo")
+	if KeyID(current) != "k2" {
+		t.Errorf("KeyID() = %q, se esperaba k2", KeyID(current))
+	}
+
+	// Sin k1 el valor antiguo ya no se puede descifrar
+	setKeys(t, "k2:"+testKey(2), "")
+	if _, err := Decrypt(old); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Decrypt() sin la clave = %v, se esperaba ErrNoKey", err)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1), "")
+	encrypted, _ := Encrypt("secreto")
+
+	parts := strings.Split(encrypted, ":")
+	data, _ := base64.RawStdEncoding.DecodeString(parts[len(parts)-1])
+	data[len(data)-1] ^= 0xff
+	parts[len(parts)-1] = base64.RawStdEncoding.EncodeToString(data)
+
+	if _, err := Decrypt(strings.Join(parts, ":")); err == nil {
+		t.Error("se esperaba un error al descifrar un valor alterado")
+	}
+}
+
+func TestDecryptPlaintextPassthrough(t *testing.T) {
+	setKeys(t, "k1:"+testKey(1), "")
+	if got, err := Decrypt("sin cifrar"); err != nil || got != "sin cifrar" {
+		t.Errorf("Decrypt() = %q, %v", got, err)
+	}
+}
+
+func TestInitRequiresKeysInRelease(t *testing.T) {
+	t.Setenv("GIN_MODE", "release")
+	t.Setenv("ENCRYPTION_KEYS", "")
+	if err := Init(); err == nil {
+		t.Error("se esperaba un error sin ENCRYPTION_KEYS en modo release")
+	}
+}
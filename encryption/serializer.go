@@ -0,0 +1,111 @@
+package encryption
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer serializador GORM que cifra campos string en reposo.
+// Uso: Phone string `gorm:"serializer:encrypted"`
+type Serializer struct{}
+
+// Scan descifra el valor leído de la base de datos
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var raw string
+	switch v := dbValue.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("valor cifrado con tipo no soportado %T", dbValue)
+	}
+
+	plaintext, err := Decrypt(raw)
+	if err != nil {
+		return fmt.Errorf("descifrando %s: %w", field.Name, err)
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+// Value cifra el valor antes de escribirlo; las cadenas vacías no se cifran
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	s, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("el campo cifrado %s debe ser string", field.Name)
+	}
+	if s == "" {
+		return "", nil
+	}
+	return Encrypt(s)
+}
+
+var (
+	modelsMu sync.Mutex
+	models   []interface{}
+)
+
+// RegisterModel añade un modelo con campos cifrados a la rotación de claves
+func RegisterModel(model interface{}) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models = append(models, model)
+}
+
+// Rotate vuelve a cifrar con la clave maestra activa todos los registros de
+// los modelos registrados. Al leer se descifra con la clave original y al
+// guardar se cifra con la activa, por lo que las claves antiguas deben seguir
+// configuradas hasta que termine la rotación.
+func Rotate(db *gorm.DB) (int64, error) {
+	modelsMu.Lock()
+	list := append([]interface{}(nil), models...)
+	modelsMu.Unlock()
+
+	var total int64
+	for _, model := range list {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return total, err
+		}
+
+		var columns []string
+		for _, f := range stmt.Schema.Fields {
+			if f.TagSettings["SERIALIZER"] == "encrypted" {
+				columns = append(columns, f.DBName)
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType)).Interface()
+		result := db.Model(model).FindInBatches(rows, 200, func(tx *gorm.DB, batch int) error {
+			slice := reflect.ValueOf(rows).Elem()
+			for i := 0; i < slice.Len(); i++ {
+				row := slice.Index(i).Addr().Interface()
+				if err := db.Model(row).Select(columns).Updates(row).Error; err != nil {
+					return err
+				}
+			}
+			total += int64(slice.Len())
+			return nil
+		})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		log.Printf("🔄 %s: %d filas re-cifradas", stmt.Schema.Table, result.RowsAffected)
+	}
+	return total, nil
+}
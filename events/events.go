@@ -0,0 +1,61 @@
+// Package events reparte los eventos de dominio (altas, cambios y bajas de
+// usuarios) entre los paquetes que los siguen, sin que quien los emite tenga
+// que conocerlos. Los suscriptores se ejecutan en la misma goroutine que
+// Publish: el trabajo lento se encola con jobs.
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Tipos de evento
+const (
+	UserCreated = "user.created"
+	UserUpdated = "user.updated"
+	// UserDeleted la cuenta se eliminó o anonimizó
+	UserDeleted = "user.deleted"
+
+	// Ciclo de vida de los tenants (TENANCY=schema); se publican en el
+	// contexto del esquema public
+	TenantProvisioned = "tenant.provisioned"
+	TenantSuspended   = "tenant.suspended"
+	TenantResumed     = "tenant.resumed"
+	// TenantExported la exportación del esquema está lista para descargar
+	TenantExported     = "tenant.exported"
+	TenantExportFailed = "tenant.export_failed"
+	TenantDeleted      = "tenant.deleted"
+)
+
+// Event evento de dominio sobre un usuario o un tenant
+type Event struct {
+	Type   string
+	UserID uint
+	// Identificador del tenant en los eventos tenant.*
+	Tenant string
+}
+
+// Handler procesa un evento publicado
+type Handler func(ctx context.Context, e Event)
+
+var (
+	mu       sync.RWMutex
+	handlers []Handler
+)
+
+// Subscribe registra h para todos los eventos que se publiquen después
+func Subscribe(h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers = append(handlers, h)
+}
+
+// Publish entrega el evento a los suscriptores
+func Publish(ctx context.Context, e Event) {
+	mu.RLock()
+	list := handlers
+	mu.RUnlock()
+	for _, h := range list {
+		h(ctx, e)
+	}
+}
@@ -0,0 +1,199 @@
+package exports
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"api/branding"
+	"api/clock"
+	"api/database"
+	"api/jobs"
+	"api/realtime"
+	"api/storage"
+	"api/tenancy"
+)
+
+// Job nombre del trabajo que genera la exportación de datos
+const Job = "data.export"
+
+// Payload datos del trabajo de exportación
+type Payload struct {
+	ExportID string `json:"export_id"`
+}
+
+// Section obtiene una parte de los datos de un usuario para la exportación
+type Section func(ctx context.Context, userID uint) (interface{}, error)
+
+var (
+	mu       sync.RWMutex
+	sections = map[string]Section{}
+)
+
+// RegisterSection añade una sección al archivo de exportación (name.json).
+// Cada subsistema que guarde datos del usuario debe registrar la suya.
+func RegisterSection(name string, s Section) {
+	mu.Lock()
+	defer mu.Unlock()
+	sections[name] = s
+}
+
+func init() {
+	RegisterSection("profile", func(ctx context.Context, userID uint) (interface{}, error) {
+		var user database.User
+		if err := database.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+			return nil, err
+		}
+		user.Password = ""
+		return user, nil
+	})
+	RegisterSection("exports", func(ctx context.Context, userID uint) (interface{}, error) {
+		var list []database.DataExport
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&list).Error
+		return list, err
+	})
+}
+
+// PendingTimeout tiempo máximo que una exportación puede seguir pendiente antes
+// de darla por fallida (la cola de trabajos vive en memoria y se pierde al reiniciar)
+func PendingTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("EXPORT_PENDING_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Minute
+}
+
+// FailStale marca como fallidas las exportaciones pendientes que superan PendingTimeout
+func FailStale(ctx context.Context) (int64, error) {
+	res := database.DB.WithContext(ctx).Model(&database.DataExport{}).
+		Where("status = ? AND created_at < ?", "pending", clock.Now().Add(-PendingTimeout())).
+		Update("status", "failed")
+	return res.RowsAffected, res.Error
+}
+
+// Recover vuelve a encolar al arrancar las exportaciones que quedaron pendientes
+// en un proceso anterior; las que ya superan PendingTimeout se dan por fallidas
+func Recover(ctx context.Context) error {
+	if _, err := FailStale(ctx); err != nil {
+		return err
+	}
+
+	var pending []database.DataExport
+	if err := database.DB.WithContext(ctx).Where("status = ?", "pending").Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, e := range pending {
+		if err := jobs.Enqueue(ctx, Job, Payload{ExportID: e.ID}); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("📦 %d exportaciones pendientes vueltas a encolar", len(pending))
+	}
+	return nil
+}
+
+// LinkTTL duración del enlace de descarga de la exportación
+func LinkTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("EXPORT_LINK_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return 7 * 24 * time.Hour
+}
+
+// Process genera el ZIP con todos los datos del usuario y le avisa por correo
+func Process(ctx context.Context, payload []byte) error {
+	var p Payload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	db := database.DB.WithContext(ctx)
+	var export database.DataExport
+	if err := db.First(&export, "id = ?", p.ExportID).Error; err != nil {
+		return err
+	}
+	var user database.User
+	if err := db.First(&user, export.UserID).Error; err != nil {
+		return err
+	}
+
+	archive, err := build(ctx, user.ID)
+	if err != nil {
+		db.Model(&export).Update("status", "failed")
+		return err
+	}
+
+	key := fmt.Sprintf("exports/%d/%s.zip", user.ID, export.ID)
+	if err := storage.Default.Put(ctx, key, bytes.NewReader(archive), int64(len(archive)), "application/zip"); err != nil {
+		return err
+	}
+
+	expires := clock.Now().Add(LinkTTL())
+	if err := db.Model(&export).Updates(map[string]interface{}{
+		"status":     "ready",
+		"object_key": key,
+		"size":       len(archive),
+		"expires_at": expires,
+	}).Error; err != nil {
+		return err
+	}
+
+	realtime.Publish(ctx, user.ID, realtime.EventExportReady, map[string]interface{}{"id": export.ID, "expires_at": expires})
+
+	link := tenancy.Link(ctx, fmt.Sprintf("%s/api/v1/profile/exports/%s", appURL(), export.ID))
+	body := fmt.Sprintf("Hola %s,\n\nLa exportación de tus datos está lista. Puedes descargarla hasta el %s desde:\n\n%s\n",
+		user.Name, expires.Format("02/01/2006 15:04 MST"), link)
+	return branding.Send(ctx, user.Email, "Tu exportación de datos está lista", body)
+}
+
+// build genera el ZIP con un JSON por sección
+func build(ctx context.Context, userID uint) ([]byte, error) {
+	mu.RLock()
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		mu.RLock()
+		section := sections[name]
+		mu.RUnlock()
+
+		data, err := section(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("sección %s: %w", name, err)
+		}
+		w, err := zw.Create(name + ".json")
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:8080"
+}
@@ -0,0 +1,109 @@
+// Package geoip ubica las IPs (país y, con la edición City, coordenadas) con
+// una base de datos GeoLite2/GeoIP2 de MaxMind (GEOIP_DB_PATH). Sin base de
+// datos las búsquedas devuelven una ubicación vacía y las funciones que
+// dependen de ella (avisos de país nuevo, viajes imposibles) no actúan.
+package geoip
+
+import (
+	"log"
+	"math"
+	"net"
+	"os"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Location ubicación aproximada de una IP
+type Location struct {
+	// Código ISO 3166-1 del país ("" si no se conoce)
+	Country string
+	// Coordenadas, solo con una base de datos de ciudades (HasCoordinates)
+	Latitude       float64
+	Longitude      float64
+	HasCoordinates bool
+}
+
+// Locator resuelve la ubicación de una IP
+type Locator interface {
+	Locate(ip net.IP) (Location, error)
+}
+
+// Default localizador configurado para la aplicación
+var Default Locator = NoopLocator{}
+
+// Init abre la base de datos de GEOIP_DB_PATH; si no está definida no se
+// localiza ninguna IP
+func Init() error {
+	path := os.Getenv("GEOIP_DB_PATH")
+	if path == "" {
+		log.Println("🌍 GEOIP_DB_PATH no configurado, no se localizarán las IPs")
+		Default = NoopLocator{}
+		return nil
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return err
+	}
+	Default = &MaxMindLocator{reader: reader}
+	log.Printf("🌍 Usando la base de datos GeoIP %s", path)
+	return nil
+}
+
+// Lookup devuelve la ubicación de la IP con el localizador configurado (vacía si no se conoce)
+func Lookup(ip string) Location {
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.IsLoopback() || addr.IsPrivate() {
+		return Location{}
+	}
+	location, err := Default.Locate(addr)
+	if err != nil {
+		log.Printf("⚠️  No se pudo localizar la IP %s: %v", ip, err)
+		return Location{}
+	}
+	return location
+}
+
+// Country devuelve el país de la IP ("" si no se conoce)
+func Country(ip string) string {
+	return Lookup(ip).Country
+}
+
+// Distance devuelve la distancia en kilómetros entre dos ubicaciones con coordenadas
+func Distance(a, b Location) float64 {
+	const earthRadius = 6371.0
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// MaxMindLocator busca en una base de datos .mmdb de MaxMind. Con la edición
+// City devuelve también las coordenadas; con la Country, solo el país.
+type MaxMindLocator struct {
+	reader *geoip2.Reader
+}
+
+func (l *MaxMindLocator) Locate(ip net.IP) (Location, error) {
+	if city, err := l.reader.City(ip); err == nil {
+		return Location{
+			Country:        city.Country.IsoCode,
+			Latitude:       city.Location.Latitude,
+			Longitude:      city.Location.Longitude,
+			HasCoordinates: city.Location.Latitude != 0 || city.Location.Longitude != 0,
+		}, nil
+	}
+	record, err := l.reader.Country(ip)
+	if err != nil {
+		return Location{}, err
+	}
+	return Location{Country: record.Country.IsoCode}, nil
+}
+
+// NoopLocator no localiza ninguna IP
+type NoopLocator struct{}
+
+func (NoopLocator) Locate(net.IP) (Location, error) {
+	return Location{}, nil
+}
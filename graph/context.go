@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"context"
+
+	"api/database"
+	"api/services"
+)
+
+type contextKey int
+
+const (
+	identityKey contextKey = iota
+	loadersKey
+	loginMetaKey
+)
+
+// Identity usuario autenticado por config.AuthMiddleware (UserID 0 = anónimo)
+type Identity struct {
+	UserID   uint
+	Role     string
+	APIKeyID uint
+	// Aplicación OAuth, si se autenticó con un token OAuth
+	OAuthClientID uint
+	// Cuenta restringida: puede consultar pero no ejecutar mutaciones
+	Restricted bool
+}
+
+// actor identidad para las comprobaciones de permisos de services
+func (i Identity) actor() services.Identity {
+	return services.Identity{UserID: i.UserID, Role: i.Role, APIKeyID: i.APIKeyID, OAuthClientID: i.OAuthClientID}
+}
+
+// Loaders dataloaders de una petición GraphQL
+type Loaders struct {
+	Plans   *Loader[string, database.Plan]
+	APIKeys *Loader[uint, []database.APIKey]
+}
+
+// WithRequest prepara el contexto de una petición: identidad, datos del cliente y dataloaders
+func WithRequest(ctx context.Context, identity Identity, meta services.LoginMeta) context.Context {
+	ctx = context.WithValue(ctx, identityKey, identity)
+	ctx = context.WithValue(ctx, loginMetaKey, meta)
+	return context.WithValue(ctx, loadersKey, newLoaders())
+}
+
+func identityFrom(ctx context.Context) Identity {
+	identity, _ := ctx.Value(identityKey).(Identity)
+	return identity
+}
+
+func loginMetaFrom(ctx context.Context) services.LoginMeta {
+	meta, _ := ctx.Value(loginMetaKey).(services.LoginMeta)
+	return meta
+}
+
+func loadersFrom(ctx context.Context) *Loaders {
+	if loaders, ok := ctx.Value(loadersKey).(*Loaders); ok {
+		return loaders
+	}
+	return newLoaders()
+}
+
+func newLoaders() *Loaders {
+	return &Loaders{
+		Plans: NewLoader(func(ctx context.Context, codes []string) (map[string]database.Plan, error) {
+			var list []database.Plan
+			if err := database.DB.WithContext(ctx).Where("code IN ?", codes).Find(&list).Error; err != nil {
+				return nil, err
+			}
+			result := make(map[string]database.Plan, len(list))
+			for _, p := range list {
+				result[p.Code] = p
+			}
+			return result, nil
+		}),
+		APIKeys: NewLoader(func(ctx context.Context, userIDs []uint) (map[uint][]database.APIKey, error) {
+			var list []database.APIKey
+			if err := database.DB.WithContext(ctx).Where("user_id IN ?", userIDs).Order("created_at DESC").Find(&list).Error; err != nil {
+				return nil, err
+			}
+			result := make(map[uint][]database.APIKey, len(userIDs))
+			for _, k := range list {
+				result[k.UserID] = append(result[k.UserID], k)
+			}
+			return result, nil
+		}),
+	}
+}
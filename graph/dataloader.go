@@ -0,0 +1,78 @@
+package graph
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batchWait ventana durante la que se acumulan claves antes de lanzar la consulta
+const batchWait = 2 * time.Millisecond
+
+// Loader agrupa en una sola consulta las cargas de claves pedidas por los
+// resolvers de una misma petición y guarda los resultados para reutilizarlos
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending *batch[K, V]
+	cache   map[K]V
+}
+
+type batch[K comparable, V any] struct {
+	keys    []K
+	seen    map[K]bool
+	done    chan struct{}
+	results map[K]V
+	err     error
+}
+
+// NewLoader crea un Loader que resuelve cada lote con fetch
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, cache: map[K]V{}}
+}
+
+// Load devuelve el valor de la clave; las claves sin resultado devuelven el valor cero
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	if v, ok := l.cache[key]; ok {
+		l.mu.Unlock()
+		return v, nil
+	}
+	if l.pending == nil {
+		l.pending = &batch[K, V]{seen: map[K]bool{}, done: make(chan struct{})}
+		go l.run(ctx, l.pending)
+	}
+	b := l.pending
+	if !b.seen[key] {
+		b.seen[key] = true
+		b.keys = append(b.keys, key)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.results[key], b.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *Loader[K, V]) run(ctx context.Context, b *batch[K, V]) {
+	time.Sleep(batchWait)
+
+	l.mu.Lock()
+	l.pending = nil
+	l.mu.Unlock()
+
+	b.results, b.err = l.fetch(ctx, b.keys)
+	if b.err == nil {
+		l.mu.Lock()
+		for k, v := range b.results {
+			l.cache[k] = v
+		}
+		l.mu.Unlock()
+	}
+	close(b.done)
+}
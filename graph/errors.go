@@ -0,0 +1,116 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"api/services"
+	_ "api/validation"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Códigos de error expuestos en extensions.code
+const (
+	codeUnauthenticated = "UNAUTHENTICATED"
+	codeForbidden       = "FORBIDDEN"
+	codeNotFound        = "NOT_FOUND"
+	codeBadInput        = "BAD_USER_INPUT"
+	codeCaptcha         = "CAPTCHA_REQUIRED"
+	codeStepUp          = "STEP_UP_REQUIRED"
+	codeInternal        = "INTERNAL_SERVER_ERROR"
+)
+
+func gqlError(ctx context.Context, code, message string) error {
+	return &gqlerror.Error{
+		Path:       graphql.GetPath(ctx),
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
+
+// stepUpError pide completar el inicio de sesión con el código enviado por correo,
+// que se envía a POST /api/v1/auth/login/verify con el challenge_id de la extensión
+func stepUpError(ctx context.Context, challengeID string) error {
+	return &gqlerror.Error{
+		Path:       graphql.GetPath(ctx),
+		Message:    "Inicio de sesión inusual: introduce el código que te hemos enviado por correo",
+		Extensions: map[string]interface{}{"code": codeStepUp, "challenge_id": challengeID},
+	}
+}
+
+// RejectRestrictedMutations rechaza las mutaciones de las cuentas restringidas,
+// igual que config.AuthMiddleware las peticiones REST que modifican algo
+func RejectRestrictedMutations(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	op := graphql.GetOperationContext(ctx)
+	if !identityFrom(ctx).Restricted || op.Operation == nil || op.Operation.Operation != ast.Mutation {
+		return next(ctx)
+	}
+	return graphql.OneShot(&graphql.Response{Errors: gqlerror.List{{
+		Message:    "Tu cuenta está restringida: puedes consultar, pero no hacer cambios",
+		Extensions: map[string]interface{}{"code": codeForbidden, "restricted": true},
+	}}})
+}
+
+// requireUser devuelve la identidad autenticada o un error UNAUTHENTICATED
+func requireUser(ctx context.Context) (Identity, error) {
+	identity := identityFrom(ctx)
+	if identity.UserID == 0 {
+		return identity, gqlError(ctx, codeUnauthenticated, "Token de autorización requerido")
+	}
+	return identity, nil
+}
+
+// validate aplica una regla del validador compartido con los bindings de Gin
+func validate(ctx context.Context, field, value, rules string) error {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+	if err := engine.Var(value, rules); err != nil {
+		return gqlError(ctx, codeBadInput, "Valor inválido para "+field)
+	}
+	return nil
+}
+
+// serviceError traduce los errores de negocio de services a errores GraphQL
+func serviceError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return gqlError(ctx, codeNotFound, "Usuario no encontrado")
+	case errors.Is(err, services.ErrEmailTaken):
+		return gqlError(ctx, codeBadInput, "El email ya está registrado")
+	case errors.Is(err, services.ErrInvalidCredentials):
+		return gqlError(ctx, codeUnauthenticated, "Credenciales inválidas")
+	case errors.Is(err, services.ErrPendingDeletion):
+		return gqlError(ctx, codeForbidden, "La cuenta está en proceso de eliminación")
+	case errors.Is(err, services.ErrForbidden):
+		return gqlError(ctx, codeForbidden, "No tienes permiso para operar sobre este usuario")
+	case errors.Is(err, services.ErrEmailChangeForbidden):
+		return gqlError(ctx, codeForbidden, "El email solo se puede cambiar desde una sesión iniciada")
+	case errors.Is(err, services.ErrMaintenance):
+		return gqlError(ctx, codeForbidden, "Servicio en mantenimiento")
+	case errors.Is(err, services.ErrCaptchaRequired):
+		return gqlError(ctx, codeCaptcha, "Se requiere verificación CAPTCHA")
+	case errors.Is(err, services.ErrCaptchaInvalid):
+		return gqlError(ctx, codeCaptcha, "Verificación CAPTCHA no superada")
+	case errors.Is(err, services.ErrLoginBlocked):
+		return gqlError(ctx, codeForbidden, "Inicio de sesión bloqueado por actividad sospechosa")
+	case errors.Is(err, services.ErrAccountDisabled):
+		return gqlError(ctx, codeForbidden, "La cuenta está desactivada")
+	case errors.Is(err, services.ErrTooManySessions):
+		return gqlError(ctx, codeForbidden, "Has alcanzado el máximo de sesiones abiertas")
+	case errors.Is(err, services.ErrUserLimitReached):
+		return gqlError(ctx, codeForbidden, "La organización ha alcanzado su máximo de usuarios")
+	case errors.Is(err, services.ErrPwnedPassword):
+		return gqlError(ctx, codeBadInput, "La contraseña aparece en filtraciones de datos conocidas; elige otra")
+	case errors.Is(err, services.ErrPasswordCheckUnavailable):
+		return gqlError(ctx, codeInternal, "No se pudo comprobar la contraseña, inténtalo más tarde")
+	default:
+		return gqlError(ctx, codeInternal, "Error interno del servidor")
+	}
+}
@@ -0,0 +1,42 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package graph
+
+import (
+	"api/database"
+)
+
+type AuthPayload struct {
+	Token             string         `json:"token"`
+	User              *database.User `json:"user"`
+	DeletionCancelled bool           `json:"deletionCancelled"`
+}
+
+type Mutation struct {
+}
+
+type PageInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"perPage"`
+	Total      int `json:"total"`
+	TotalPages int `json:"totalPages"`
+}
+
+type Query struct {
+}
+
+type RegisterInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+type UpdateUserInput struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+type UserConnection struct {
+	Data []database.User `json:"data"`
+	Meta *PageInfo       `json:"meta"`
+}
@@ -0,0 +1,5 @@
+package graph
+
+// Resolver raíz de GraphQL. Los resolvers delegan en el paquete services,
+// el mismo que usan los handlers REST.
+type Resolver struct{}
@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// MarshalUintID serializa los IDs numéricos de GORM como el escalar ID de GraphQL
+func MarshalUintID(id uint) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(strconv.FormatUint(uint64(id), 10)))
+	})
+}
+
+// UnmarshalUintID interpreta un ID recibido como texto o número
+func UnmarshalUintID(v interface{}) (uint, error) {
+	switch v := v.(type) {
+	case string:
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("ID inválido: %q", v)
+		}
+		return uint(id), nil
+	default:
+		id, err := graphql.UnmarshalUint(v)
+		if err != nil {
+			return 0, fmt.Errorf("ID inválido: %v", v)
+		}
+		return id, nil
+	}
+}
@@ -0,0 +1,217 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.45
+
+import (
+	"api/database"
+	"api/normalize"
+	"api/plans"
+	"api/services"
+	"api/terms"
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// Register is the resolver for the register field.
+func (r *mutationResolver) Register(ctx context.Context, input RegisterInput) (*database.User, error) {
+	input.Email = normalize.Email(input.Email)
+	input.Name = normalize.Name(input.Name)
+	if err := validate(ctx, "email", input.Email, "required,email,not_disposable"); err != nil {
+		return nil, err
+	}
+	if err := validate(ctx, "password", input.Password, "required,strong_password"); err != nil {
+		return nil, err
+	}
+	if err := validate(ctx, "name", input.Name, "required"); err != nil {
+		return nil, err
+	}
+	if err := services.CheckCaptcha(ctx, services.CaptchaRegister, input.Email, loginMetaFrom(ctx)); err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	user, err := services.RegisterUser(ctx, input.Email, input.Password, input.Name)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// Login is the resolver for the login field.
+func (r *mutationResolver) Login(ctx context.Context, email string, password string) (*AuthPayload, error) {
+	result, err := services.Authenticate(ctx, normalize.Email(email), password, loginMetaFrom(ctx))
+	if errors.Is(err, services.ErrStepUpRequired) {
+		return nil, stepUpError(ctx, result.ChallengeID)
+	}
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	if len(result.TerminatedSessions) > 0 {
+		// Sesiones cerradas para no superar el máximo del rol, en las extensiones de la respuesta
+		ids := make([]string, len(result.TerminatedSessions))
+		for i, s := range result.TerminatedSessions {
+			ids[i] = s.ID
+		}
+		graphql.RegisterExtension(ctx, "terminated_sessions", ids)
+	}
+	if result.Suspension != nil {
+		graphql.RegisterExtension(ctx, "suspension", result.Suspension)
+	}
+	if result.PasswordChangeRequired {
+		// El token solo sirve para cambiar la contraseña en POST /profile/password
+		graphql.RegisterExtension(ctx, "password_change_required", true)
+	}
+	if result.TermsPending {
+		// El token solo sirve para aceptarlos en POST /profile/terms
+		graphql.RegisterExtension(ctx, "terms", terms.Current())
+	}
+	result.User.Password = ""
+	return &AuthPayload{Token: result.Token, User: result.User, DeletionCancelled: result.DeletionCancelled}, nil
+}
+
+// UpdateUser is the resolver for the updateUser field.
+func (r *mutationResolver) UpdateUser(ctx context.Context, id uint, input UpdateUserInput) (*database.User, error) {
+	identity, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes services.UserChanges
+	if input.Name != nil {
+		changes.Name = normalize.Name(*input.Name)
+	}
+	if input.Email != nil {
+		changes.Email = normalize.Email(*input.Email)
+		if err := validate(ctx, "email", changes.Email, "email,not_disposable"); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := services.UpdateUser(ctx, identity.actor(), id, changes)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return user, nil
+}
+
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationResolver) DeleteUser(ctx context.Context, id uint) (bool, error) {
+	identity, err := requireUser(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := services.DeleteUser(ctx, identity.actor(), id); err != nil {
+		return false, serviceError(ctx, err)
+	}
+	return true, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, page *int, perPage *int) (*UserConnection, error) {
+	if _, err := requireUser(ctx); err != nil {
+		return nil, err
+	}
+
+	number, size := 1, 20
+	if page != nil && *page > 0 {
+		number = *page
+	}
+	if perPage != nil && *perPage > 0 {
+		size = *perPage
+	}
+	if size > 100 {
+		size = 100
+	}
+
+	users, total, err := services.ListUsers(ctx, services.UserFilter{}, (number-1)*size, size)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return &UserConnection{
+		Data: users,
+		Meta: &PageInfo{Page: number, PerPage: size, Total: int(total.Count), TotalPages: (int(total.Count) + size - 1) / size},
+	}, nil
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id uint) (*database.User, error) {
+	identity, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.AuthorizeUser(ctx, identity.actor(), services.ActionUsersRead, id); err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	user, err := services.GetUser(ctx, id)
+	if errors.Is(err, services.ErrUserNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return user, nil
+}
+
+// Profile is the resolver for the profile field.
+func (r *queryResolver) Profile(ctx context.Context) (*database.User, error) {
+	identity, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := services.GetUser(ctx, identity.UserID)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return user, nil
+}
+
+// Plan is the resolver for the plan field.
+func (r *userResolver) Plan(ctx context.Context, obj *database.User) (*database.Plan, error) {
+	plan, err := loadersFrom(ctx).Plans.Load(ctx, obj.PlanCode)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	if plan.Code == "" {
+		// Código de plan desconocido: se aplica el gratuito, igual que plans.ForUser
+		if plan, err = loadersFrom(ctx).Plans.Load(ctx, plans.Free); err != nil {
+			return nil, serviceError(ctx, err)
+		}
+	}
+	return &plan, nil
+}
+
+// APIKeys is the resolver for the apiKeys field.
+func (r *userResolver) APIKeys(ctx context.Context, obj *database.User) ([]database.APIKey, error) {
+	identity := identityFrom(ctx)
+	if identity.UserID != obj.ID && identity.Role != "admin" {
+		return []database.APIKey{}, nil
+	}
+
+	keys, err := loadersFrom(ctx).APIKeys.Load(ctx, obj.ID)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	if keys == nil {
+		keys = []database.APIKey{}
+	}
+	return keys, nil
+}
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
+type mutationResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
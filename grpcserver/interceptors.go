@@ -0,0 +1,186 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"api/bans"
+	"api/maintenance"
+	"api/quotas"
+	"api/services"
+	"api/usage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type contextKey int
+
+const identityKey contextKey = iota
+
+// publicMethods métodos que no requieren credenciales
+var publicMethods = map[string]bool{
+	"/geshuro.v1.AuthService/Register": true,
+	"/geshuro.v1.AuthService/Login":    true,
+}
+
+func identityFrom(ctx context.Context) *services.Identity {
+	identity, _ := ctx.Value(identityKey).(*services.Identity)
+	return identity
+}
+
+// banInterceptor rechaza las llamadas de las IPs bloqueadas, como config.IPBanMiddleware
+func banInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ip := clientIP(ctx)
+	if _, banned := bans.Banned(ip); banned && !bans.Allowed(ip) {
+		return nil, status.Error(codes.PermissionDenied, "Tu IP está bloqueada temporalmente por actividad sospechosa")
+	}
+	return handler(ctx, req)
+}
+
+// writeMethods métodos que modifican datos, vedados a las cuentas restringidas
+var writeMethods = map[string]bool{
+	"/geshuro.v1.UserService/UpdateUser": true,
+	"/geshuro.v1.UserService/DeleteUser": true,
+}
+
+// authInterceptor valida el JWT o la clave de API de la metadata "authorization"
+// ("Bearer <token>") o "x-api-key", igual que config.AuthMiddleware
+func authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var identity *services.Identity
+	var err error
+	if key := first(md, "x-api-key"); key != "" {
+		identity, err = services.AuthenticateAPIKey(ctx, key, clientIP(ctx))
+	} else {
+		token := first(md, "authorization")
+		if token == "" {
+			return nil, status.Error(codes.Unauthenticated, "Token de autorización requerido")
+		}
+		if !strings.HasPrefix(token, "Bearer ") {
+			return nil, status.Error(codes.Unauthenticated, "Formato de token inválido")
+		}
+		identity, err = services.AuthenticateToken(ctx, token[7:], clientIP(ctx))
+	}
+	if errors.Is(err, services.ErrIPNotAllowed) {
+		return nil, status.Error(codes.PermissionDenied, "Esta clave de API no admite peticiones desde tu IP")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "Token inválido o expirado")
+	}
+	// La suspensión se consulta y se apela por REST (/api/v1/profile/suspension)
+	if identity.Suspension != nil {
+		return nil, status.Error(codes.PermissionDenied, "Tu cuenta está suspendida: "+identity.Suspension.Reason)
+	}
+	if identity.Restricted && writeMethods[info.FullMethod] {
+		return nil, status.Error(codes.PermissionDenied, "Tu cuenta está restringida: puedes consultar, pero no hacer cambios")
+	}
+	// La contraseña se cambia por REST (POST /api/v1/profile/password)
+	if identity.PasswordChangeRequired {
+		return nil, status.Error(codes.FailedPrecondition, "Tienes que cambiar la contraseña antes de continuar")
+	}
+	// Los términos se aceptan por REST (POST /api/v1/profile/terms)
+	if identity.TermsPending {
+		return nil, status.Error(codes.FailedPrecondition, "Tienes que aceptar los términos de uso para continuar")
+	}
+
+	return handler(context.WithValue(ctx, identityKey, identity), req)
+}
+
+// maintenanceInterceptor rechaza las llamadas durante el modo mantenimiento con
+// las mismas excepciones que config.MaintenanceMiddleware (usar tras authInterceptor)
+func maintenanceInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	state := maintenance.Current()
+	if !state.Enabled || info.FullMethod == "/geshuro.v1.AuthService/Login" {
+		return handler(ctx, req)
+	}
+	if identity := identityFrom(ctx); identity != nil && identity.Role == "admin" {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if state.Allowed(clientIP(ctx)) || maintenance.ValidBypassToken(first(md, "x-maintenance-bypass")) {
+		return handler(ctx, req)
+	}
+	return nil, status.Error(codes.Unavailable, "Servicio en mantenimiento")
+}
+
+// quotaInterceptor aplica la cuota diaria de peticiones (los admins están exentos)
+func quotaInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	identity := identityFrom(ctx)
+	if identity == nil || identity.Role == "admin" {
+		return handler(ctx, req)
+	}
+
+	quota, ok, err := quotas.Consume(ctx, quotas.ScopeUser, identity.UserID, quotas.RequestsPerDay, 1)
+	if err == nil && !quota.Unlimited() && !ok {
+		return nil, status.Error(codes.ResourceExhausted, "Cuota diaria de peticiones agotada")
+	}
+	return handler(ctx, req)
+}
+
+// usageInterceptor registra la llamada en las métricas de uso del usuario y de la clave
+func usageInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+
+	if identity := identityFrom(ctx); identity != nil {
+		endpoint := "GRPC " + info.FullMethod
+		usage.Track(ctx, identity.UserID, endpoint)
+		if identity.APIKeyID != 0 {
+			usage.TrackKey(ctx, identity.APIKeyID, endpoint)
+		}
+	}
+	return resp, err
+}
+
+// loginMeta datos del cliente para el historial de inicios de sesión
+func loginMeta(ctx context.Context) services.LoginMeta {
+	md, _ := metadata.FromIncomingContext(ctx)
+	meta := services.LoginMeta{
+		IP:           clientIP(ctx),
+		UserAgent:    first(md, "grpcgateway-user-agent"),
+		CaptchaToken: first(md, "x-captcha-token"),
+		APIKey:       first(md, "x-api-key"),
+		DeviceToken:  first(md, "x-device-token"),
+	}
+	if meta.UserAgent == "" {
+		meta.UserAgent = first(md, "user-agent")
+	}
+	return meta
+}
+
+// clientIP dirección del cliente. Es la del peer salvo que la llamada llegue por
+// la interfaz local (el gateway), que reenvía en x-forwarded-for la IP del cliente
+// HTTP ya resuelta por Gin; cualquier otro x-forwarded-for se ignora.
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if addr := net.ParseIP(ip); addr != nil && addr.IsLoopback() {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if forwarded := first(md, "x-forwarded-for"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	return ip
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package grpcserver
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	geshurov1 "api/proto/geshuro/v1"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Port puerto del servidor gRPC (GRPC_PORT, por defecto 9090)
+func Port() string {
+	if port := os.Getenv("GRPC_PORT"); port != "" {
+		return port
+	}
+	return "9090"
+}
+
+// Addr dirección en la que escucha el servidor gRPC (GRPC_ADDR). Por defecto solo
+// la interfaz local: el servidor no usa TLS y desde fuera se accede por el
+// gateway /rpc/v1; para exponerlo en una red interna se indica su dirección.
+func Addr() string {
+	if addr := os.Getenv("GRPC_ADDR"); addr != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", Port())
+}
+
+// dialAddr dirección con la que el gateway conecta con el servidor local
+func dialAddr() string {
+	host, port, err := net.SplitHostPort(Addr())
+	if err != nil {
+		return Addr()
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// NewServer crea el servidor gRPC con los interceptores de autenticación,
+// mantenimiento, cuotas y seguimiento de uso
+func NewServer() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(banInterceptor, authInterceptor, maintenanceInterceptor, quotaInterceptor, usageInterceptor),
+	)
+	geshurov1.RegisterAuthServiceServer(server, &authService{})
+	geshurov1.RegisterUserServiceServer(server, &userService{})
+	return server
+}
+
+// Start escucha en Addr y sirve las peticiones en segundo plano
+func Start() (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", Addr())
+	if err != nil {
+		return nil, err
+	}
+	if ip, ok := lis.Addr().(*net.TCPAddr); ok && !ip.IP.IsLoopback() {
+		log.Printf("⚠️  El servidor gRPC escucha en %s sin TLS; limita el acceso a la red interna", lis.Addr())
+	}
+
+	server := NewServer()
+	go func() {
+		if err := server.Serve(lis); err != nil {
+			log.Printf("❌ Servidor gRPC detenido: %v", err)
+		}
+	}()
+	log.Printf("🔌 Servidor gRPC escuchando en %s", lis.Addr())
+	return server, nil
+}
+
+// Gateway traduce las peticiones JSON/HTTP de /rpc/v1 a llamadas gRPC contra el
+// servidor local, de modo que pasan por los mismos interceptores
+func Gateway(ctx context.Context) (http.Handler, error) {
+	mux := runtime.NewServeMux(runtime.WithIncomingHeaderMatcher(headerMatcher))
+	endpoint := dialAddr()
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+
+	if err := geshurov1.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
+	if err := geshurov1.RegisterUserServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// headerMatcher reenvía también X-API-Key, X-Captcha-Token y X-Device-Token
+// como metadata x-api-key, x-captcha-token y x-device-token
+func headerMatcher(key string) (string, bool) {
+	switch http.CanonicalHeaderKey(key) {
+	case "X-Api-Key":
+		return "x-api-key", true
+	case "X-Captcha-Token":
+		return "x-captcha-token", true
+	case "X-Device-Token":
+		return "x-device-token", true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
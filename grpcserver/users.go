@@ -0,0 +1,209 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"api/database"
+	"api/normalize"
+	geshurov1 "api/proto/geshuro/v1"
+	"api/services"
+	_ "api/validation"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// authService implementa geshuro.v1.AuthService
+type authService struct {
+	geshurov1.UnimplementedAuthServiceServer
+}
+
+func (s *authService) Register(ctx context.Context, req *geshurov1.RegisterRequest) (*geshurov1.User, error) {
+	req.Email = normalize.Email(req.Email)
+	req.Name = normalize.Name(req.Name)
+	if err := validate(req.Email, "required,email,not_disposable", "email"); err != nil {
+		return nil, err
+	}
+	if err := validate(req.Password, "required,strong_password", "password"); err != nil {
+		return nil, err
+	}
+	if err := validate(req.Name, "required", "name"); err != nil {
+		return nil, err
+	}
+	if err := services.CheckCaptcha(ctx, services.CaptchaRegister, req.Email, loginMeta(ctx)); err != nil {
+		return nil, serviceError(err)
+	}
+
+	user, err := services.RegisterUser(ctx, req.Email, req.Password, req.Name)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return toProto(user), nil
+}
+
+func (s *authService) Login(ctx context.Context, req *geshurov1.LoginRequest) (*geshurov1.LoginResponse, error) {
+	result, err := services.Authenticate(ctx, normalize.Email(req.Email), req.Password, loginMeta(ctx))
+	if errors.Is(err, services.ErrStepUpRequired) {
+		// El código se envía a POST /api/v1/auth/login/verify
+		grpc.SetTrailer(ctx, metadata.Pairs("x-challenge-id", result.ChallengeID))
+		return nil, status.Error(codes.FailedPrecondition, "Inicio de sesión inusual: introduce el código que te hemos enviado por correo")
+	}
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	if len(result.TerminatedSessions) > 0 {
+		ids := make([]string, len(result.TerminatedSessions))
+		for i, s := range result.TerminatedSessions {
+			ids[i] = s.ID
+		}
+		// Sesiones cerradas para no superar el máximo de sesiones del rol
+		grpc.SetTrailer(ctx, metadata.Pairs("x-terminated-sessions", strings.Join(ids, ",")))
+	}
+	return &geshurov1.LoginResponse{
+		Token:             result.Token,
+		User:              toProto(result.User),
+		DeletionCancelled: result.DeletionCancelled,
+	}, nil
+}
+
+// userService implementa geshuro.v1.UserService
+type userService struct {
+	geshurov1.UnimplementedUserServiceServer
+}
+
+func (s *userService) ListUsers(ctx context.Context, req *geshurov1.ListUsersRequest) (*geshurov1.ListUsersResponse, error) {
+	page, perPage := int(req.Page), int(req.PerPage)
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 20
+	}
+	if perPage > 100 {
+		perPage = 100
+	}
+
+	users, total, err := services.ListUsers(ctx, services.UserFilter{}, (page-1)*perPage, perPage)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	resp := &geshurov1.ListUsersResponse{
+		Page:       int32(page),
+		PerPage:    int32(perPage),
+		Total:      total.Count,
+		TotalPages: int32((total.Count + int64(perPage) - 1) / int64(perPage)),
+	}
+	for i := range users {
+		resp.Users = append(resp.Users, toProto(&users[i]))
+	}
+	return resp, nil
+}
+
+func (s *userService) GetUser(ctx context.Context, req *geshurov1.GetUserRequest) (*geshurov1.User, error) {
+	if err := services.AuthorizeUser(ctx, *identityFrom(ctx), services.ActionUsersRead, uint(req.Id)); err != nil {
+		return nil, serviceError(err)
+	}
+	user, err := services.GetUser(ctx, uint(req.Id))
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return toProto(user), nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, req *geshurov1.UpdateUserRequest) (*geshurov1.User, error) {
+	req.Email = normalize.Email(req.Email)
+	req.Name = normalize.Name(req.Name)
+	if err := validate(req.Email, "omitempty,email,not_disposable", "email"); err != nil {
+		return nil, err
+	}
+
+	user, err := services.UpdateUser(ctx, *identityFrom(ctx), uint(req.Id), services.UserChanges{Name: req.Name, Email: req.Email})
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return toProto(user), nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, req *geshurov1.DeleteUserRequest) (*emptypb.Empty, error) {
+	if err := services.DeleteUser(ctx, *identityFrom(ctx), uint(req.Id)); err != nil {
+		return nil, serviceError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *userService) GetProfile(ctx context.Context, _ *emptypb.Empty) (*geshurov1.User, error) {
+	user, err := services.GetUser(ctx, identityFrom(ctx).UserID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return toProto(user), nil
+}
+
+func toProto(user *database.User) *geshurov1.User {
+	return &geshurov1.User{
+		Id:        uint64(user.ID),
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      user.Role,
+		IsActive:  user.IsActive,
+		Plan:      user.PlanCode,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+	}
+}
+
+// validate aplica una regla del validador compartido con los bindings de Gin
+func validate(value, rules, field string) error {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return nil
+	}
+	if err := engine.Var(value, rules); err != nil {
+		return status.Error(codes.InvalidArgument, "Valor inválido para "+field)
+	}
+	return nil
+}
+
+// serviceError traduce los errores de negocio de services a códigos gRPC
+func serviceError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return status.Error(codes.NotFound, "Usuario no encontrado")
+	case errors.Is(err, services.ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, "El email ya está registrado")
+	case errors.Is(err, services.ErrInvalidCredentials):
+		return status.Error(codes.Unauthenticated, "Credenciales inválidas")
+	case errors.Is(err, services.ErrPendingDeletion):
+		return status.Error(codes.PermissionDenied, "La cuenta está en proceso de eliminación")
+	case errors.Is(err, services.ErrForbidden):
+		return status.Error(codes.PermissionDenied, "No tienes permiso para operar sobre este usuario")
+	case errors.Is(err, services.ErrMaintenance):
+		return status.Error(codes.Unavailable, "Servicio en mantenimiento")
+	case errors.Is(err, services.ErrCaptchaRequired):
+		return status.Error(codes.FailedPrecondition, "Se requiere verificación CAPTCHA")
+	case errors.Is(err, services.ErrCaptchaInvalid):
+		return status.Error(codes.PermissionDenied, "Verificación CAPTCHA no superada")
+	case errors.Is(err, services.ErrLoginBlocked):
+		return status.Error(codes.PermissionDenied, "Inicio de sesión bloqueado por actividad sospechosa")
+	case errors.Is(err, services.ErrAccountDisabled):
+		return status.Error(codes.PermissionDenied, "La cuenta está desactivada")
+	case errors.Is(err, services.ErrTooManySessions):
+		return status.Error(codes.ResourceExhausted, "Has alcanzado el máximo de sesiones abiertas")
+	case errors.Is(err, services.ErrUserLimitReached):
+		return status.Error(codes.ResourceExhausted, "La organización ha alcanzado su máximo de usuarios")
+	case errors.Is(err, services.ErrPwnedPassword):
+		return status.Error(codes.InvalidArgument, "La contraseña aparece en filtraciones de datos conocidas; elige otra")
+	case errors.Is(err, services.ErrPasswordCheckUnavailable):
+		return status.Error(codes.Unavailable, "No se pudo comprobar la contraseña, inténtalo más tarde")
+	default:
+		return status.Error(codes.Internal, "Error interno del servidor")
+	}
+}
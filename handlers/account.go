@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/events"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DeleteProfile programa el borrado de la cuenta del usuario autenticado
+// @Summary Eliminar mi cuenta
+// @Description Programa la eliminación de la cuenta tras el periodo de gracia; los datos personales se anonimizan
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param confirmation body DeleteAccountRequest true "Contraseña actual"
+// @Success 202 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /profile [delete]
+func DeleteProfile(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Contraseña incorrecta"})
+		return
+	}
+
+	scheduled := clock.Now().Add(accounts.DeletionGracePeriod())
+	if err := database.DB.WithContext(c.Request.Context()).Model(user).Update("deletion_scheduled_at", scheduled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al programar la eliminación"})
+		return
+	}
+	events.Publish(c.Request.Context(), events.Event{Type: events.UserUpdated, UserID: user.ID})
+
+	// Las claves de API dejan de funcionar desde la solicitud, no al anonimizar
+	if err := accounts.RevokeAPIKeys(c.Request.Context(), user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al revocar las claves de API"})
+		return
+	}
+
+	message := "La cuenta se eliminará al finalizar el periodo de gracia"
+	if accounts.CancelOnLogin() {
+		message += "; iniciar sesión antes de esa fecha cancelará la eliminación"
+	}
+
+	writeJSON(c, http.StatusAccepted, gin.H{
+		"message":               message,
+		"deletion_scheduled_at": scheduled,
+	})
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
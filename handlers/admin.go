@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Bucket recuento agrupado por fecha
+type Bucket struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// GetAdminStats devuelve estadísticas agregadas de usuarios y accesos
+// @Summary Estadísticas de administración
+// @Description Totales de usuarios, activos/inactivos, distribución de roles y actividad de login del periodo
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Días a considerar (por defecto 30)"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/stats [get]
+func GetAdminStats(c *gin.Context) {
+	days := statsDays(c)
+	since := clock.Now().AddDate(0, 0, -days)
+
+	var byStatus []struct {
+		IsActive bool
+		Count    int64
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Select("is_active, COUNT(*) AS count").
+		Group("is_active").Scan(&byStatus).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al calcular estadísticas"})
+		return
+	}
+	var total, active int64
+	for _, row := range byStatus {
+		total += row.Count
+		if row.IsActive {
+			active = row.Count
+		}
+	}
+
+	var roles []struct {
+		Role  string `json:"role"`
+		Count int64  `json:"count"`
+	}
+	database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Select("role, COUNT(*) AS count").Group("role").Order("count DESC").Scan(&roles)
+
+	var signups int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Where("created_at >= ?", since).Count(&signups)
+
+	var logins []struct {
+		Success bool
+		Count   int64
+	}
+	database.DB.WithContext(c.Request.Context()).Model(&database.LoginEvent{}).Select("success, COUNT(*) AS count").
+		Where("created_at >= ?", since).Group("success").Scan(&logins)
+	loginStats := gin.H{"successful": int64(0), "failed": int64(0)}
+	for _, row := range logins {
+		if row.Success {
+			loginStats["successful"] = row.Count
+		} else {
+			loginStats["failed"] = row.Count
+		}
+	}
+
+	var activeUsers int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.LoginEvent{}).Where("created_at >= ? AND success = ?", since, true).
+		Distinct("user_id").Count(&activeUsers)
+	loginStats["unique_users"] = activeUsers
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"period_days": days,
+		"users": gin.H{
+			"total":    total,
+			"active":   active,
+			"inactive": total - active,
+		},
+		"roles":   roles,
+		"signups": signups,
+		"logins":  loginStats,
+	})
+}
+
+// GetSignupStats devuelve las altas agrupadas por día o semana
+// @Summary Altas por periodo
+// @Description Número de registros agrupados por día o por semana
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param period query string false "day o week (por defecto day)"
+// @Param days query int false "Días a considerar (por defecto 30)"
+// @Success 200 {array} Bucket
+// @Router /admin/stats/signups [get]
+func GetSignupStats(c *gin.Context) {
+	timeSeries(c, database.DB.WithContext(c.Request.Context()).Model(&database.User{}))
+}
+
+// GetLoginStats devuelve los inicios de sesión exitosos agrupados por día o semana
+// @Summary Logins por periodo
+// @Description Número de inicios de sesión exitosos agrupados por día o por semana
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param period query string false "day o week (por defecto day)"
+// @Param days query int false "Días a considerar (por defecto 30)"
+// @Success 200 {array} Bucket
+// @Router /admin/stats/logins [get]
+func GetLoginStats(c *gin.Context) {
+	timeSeries(c, database.DB.WithContext(c.Request.Context()).Model(&database.LoginEvent{}).Where("success = ?", true))
+}
+
+// timeSeries agrega por fecha de creación directamente en la base de datos
+func timeSeries(c *gin.Context, query *gorm.DB) {
+	period := c.DefaultQuery("period", "day")
+	if period != "day" && period != "week" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period debe ser day o week"})
+		return
+	}
+	since := clock.Now().AddDate(0, 0, -statsDays(c))
+
+	bucket := database.DateBucket("created_at", period)
+	buckets := []Bucket{}
+	if err := query.Select(bucket+" AS date, COUNT(*) AS count").
+		Where("created_at >= ?", since).
+		Group(bucket).Order("date").Scan(&buckets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al calcular estadísticas"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, buckets)
+}
+
+// statsDays lee el parámetro days (1-365, por defecto 30)
+func statsDays(c *gin.Context) int {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		return 30
+	}
+	return days
+}
+
+// GetUserUsage devuelve el uso de la API de un usuario
+// @Summary Uso de la API por usuario
+// @Description Peticiones totales, última actividad, endpoints utilizados y serie diaria de un usuario
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param days query int false "Días a considerar (por defecto 30)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/usage [get]
+func GetUserUsage(c *gin.Context) {
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	days := statsDays(c)
+	since := clock.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+	query := func() *gorm.DB {
+		return database.DB.WithContext(c.Request.Context()).Model(&database.UserUsage{}).Where("user_id = ? AND day >= ?", user.ID, since)
+	}
+
+	var total int64
+	query().Select("COALESCE(SUM(count), 0)").Scan(&total)
+
+	var rows []struct {
+		Endpoint   string
+		Count      int64
+		LastSeenAt string
+	}
+	query().Select("endpoint, SUM(count) AS count, MAX(last_seen_at) AS last_seen_at").
+		Group("endpoint").Order("count DESC").Scan(&rows)
+	endpoints := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		endpoints = append(endpoints, gin.H{
+			"endpoint":     row.Endpoint,
+			"count":        row.Count,
+			"last_seen_at": database.ParseTime(row.LastSeenAt),
+		})
+	}
+
+	daily := []Bucket{}
+	query().Select("day AS date, SUM(count) AS count").Group("day").Order("day").Scan(&daily)
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"user_id":          user.ID,
+		"period_days":      days,
+		"total_requests":   total,
+		"last_activity_at": user.LastActivityAt,
+		"endpoints":        endpoints,
+		"daily":            daily,
+	})
+}
+
+// GetUserHistory devuelve los cambios que los administradores hicieron en un usuario
+// @Summary Historial de cambios de un usuario
+// @Description Cambios hechos por administradores en la cuenta (datos, plan, eliminación) con el valor anterior y el nuevo de cada campo, los más recientes primero
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Cambios por página"
+// @Param exact_count query bool false "Contar el total exacto en lugar de estimarlo en tablas grandes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/history [get]
+func GetUserHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	page := pagination(c)
+	history, total, err := services.UserHistory(countContext(c), uint(id), page.Offset(), page.PerPage)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el historial"})
+		return
+	}
+
+	response := paginated(history, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// RequireUserPasswordChange obliga a un usuario a cambiar la contraseña
+// @Summary Exigir cambio de contraseña
+// @Description Hasta que el usuario cambie la contraseña, sus sesiones (también las ya abiertas) solo sirven para hacerlo en POST /profile/password y el inicio de sesión devuelve password_change_required. Queda en el historial de cambios del usuario
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/require-password-change [post]
+func RequireUserPasswordChange(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	user, err := services.RequirePasswordChange(c.Request.Context(), currentIdentity(c), uint(id))
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al exigir el cambio de contraseña"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "El usuario tendrá que cambiar la contraseña", "user": linkUser(c, user)})
+}
+
+// DeactivateUser desactiva la cuenta de un usuario
+// @Summary Desactivar usuario
+// @Description La cuenta deja de poder iniciar sesión (403) y sus tokens y claves de API dejan de valer (401). Se cierran sus sesiones y se revocan sus tokens OAuth, que no vuelven a valer al reactivarla. Un administrador no puede desactivar su propia cuenta. Queda en el historial de cambios del usuario
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/deactivate [post]
+func DeactivateUser(c *gin.Context) {
+	setUserActive(c, false)
+}
+
+// ActivateUser reactiva la cuenta de un usuario desactivado
+// @Summary Reactivar usuario
+// @Description El usuario vuelve a poder iniciar sesión y sus claves de API vuelven a valer; las sesiones cerradas al desactivarla no se recuperan. Las cuentas eliminadas no se pueden reactivar
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/activate [post]
+func ActivateUser(c *gin.Context) {
+	setUserActive(c, true)
+}
+
+func setUserActive(c *gin.Context, active bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	user, err := services.SetUserActive(c.Request.Context(), currentIdentity(c), uint(id), active)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	case errors.Is(err, services.ErrSelfDeactivation):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes desactivar tu propia cuenta"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cambiar el estado del usuario"})
+		return
+	}
+	message := "Usuario desactivado"
+	if active {
+		message = "Usuario reactivado"
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": message, "user": linkUser(c, user)})
+}
+
+// RestrictUser restringe la cuenta de un usuario
+// @Summary Restringir usuario
+// @Description El usuario puede iniciar sesión (la respuesta incluye restricted) y consultar, pero las peticiones que modifican algo (POST, PUT, PATCH, DELETE, mutaciones de GraphQL y métodos de escritura de gRPC) responden 403 con restricted: true. Se admiten la renovación del token y el cambio de contraseña. Restringir una cuenta ya restringida solo cambia el motivo. Queda en el historial de cambios del usuario
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param restriction body RestrictUserRequest true "Motivo"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/restrict [post]
+func RestrictUser(c *gin.Context) {
+	var req RestrictUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	setUserRestriction(c, true, req.Reason)
+}
+
+// UnrestrictUser levanta la restricción de la cuenta de un usuario
+// @Summary Levantar restricción
+// @Description El usuario vuelve a poder hacer cambios. Queda en el historial de cambios del usuario
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/unrestrict [post]
+func UnrestrictUser(c *gin.Context) {
+	setUserRestriction(c, false, "")
+}
+
+func setUserRestriction(c *gin.Context, restricted bool, reason string) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	var user *database.User
+	if restricted {
+		user, err = services.RestrictUser(c.Request.Context(), currentIdentity(c), uint(id), reason)
+	} else {
+		user, err = services.UnrestrictUser(c.Request.Context(), currentIdentity(c), uint(id))
+	}
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cambiar la restricción del usuario"})
+		return
+	}
+	message := "Restricción levantada"
+	if restricted {
+		message = "Usuario restringido"
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": message, "user": linkUser(c, user)})
+}
+
+// RestrictUserRequest motivo de la restricción
+type RestrictUserRequest struct {
+	Reason string `json:"reason" binding:"required,max=500" example:"Actividad marcada como abusiva"`
+}
+
+func (r *RestrictUserRequest) Normalize() { r.Reason = strings.TrimSpace(r.Reason) }
+
+// ExportUsers descarga en CSV los usuarios del listado
+// @Summary Exportar usuarios
+// @Description Descarga en CSV los mismos usuarios que GET /users, ordenados por ID y con el mismo filtro tag. Las filas se leen de la base de datos y se envían según se leen, sin cargarlas en memoria
+// @Tags admin
+// @Produce text/csv
+// @Security BearerAuth
+// @Param tag query string false "Solo los usuarios con todas estas etiquetas, separadas por comas"
+// @Success 200 {string} string "CSV con las columnas id, email, name, username, role, is_active, plan, created_at y last_activity_at"
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/users/export.csv [get]
+func ExportUsers(c *gin.Context) {
+	filter, ok := userFilter(c)
+	if !ok {
+		return
+	}
+	err := services.StreamUsers(c.Request.Context(), filter, func(rows *sql.Rows) error {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.csv"`, clock.Now().UTC().Format("2006-01-02")))
+		c.Status(http.StatusOK)
+
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"id", "email", "name", "username", "role", "is_active", "plan", "created_at", "last_activity_at"})
+		for n := 1; rows.Next(); n++ {
+			var user database.User
+			if err := database.DB.ScanRows(rows, &user); err != nil {
+				break
+			}
+			var username, lastActivity string
+			if user.Username != nil {
+				username = *user.Username
+			}
+			if user.LastActivityAt != nil {
+				lastActivity = user.LastActivityAt.UTC().Format(time.RFC3339)
+			}
+			w.Write([]string{
+				strconv.FormatUint(uint64(user.ID), 10), csvText(user.Email), csvText(user.Name), username, user.Role,
+				strconv.FormatBool(user.IsActive), user.PlanCode, user.CreatedAt.UTC().Format(time.RFC3339), lastActivity,
+			})
+			// El cliente recibe el fichero mientras se genera
+			if n%exportFlushRows == 0 {
+				w.Flush()
+				c.Writer.Flush()
+			}
+		}
+		w.Flush()
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al exportar usuarios"})
+	}
+}
+
+// exportFlushRows filas que se envían de una vez al exportar
+const exportFlushRows = 1000
+
+// csvText evita que una hoja de cálculo interprete como fórmula un texto
+// escrito por el usuario (=, +, - o @ al principio)
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
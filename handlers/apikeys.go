@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"api/auth"
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/iplist"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func init() {
+	exports.RegisterSection("api_keys", func(ctx context.Context, userID uint) (interface{}, error) {
+		var keys []database.APIKey
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&keys).Error
+		return keys, err
+	})
+}
+
+// CreateAPIKey crea una nueva clave de API para el usuario autenticado
+// @Summary Crear clave de API
+// @Description Genera una clave de API; la clave completa solo se devuelve en esta respuesta. Con allowed_ips solo se acepta desde esas IPs o rangos CIDR. Requiere sesión (no se admite otra clave de API)
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param key body CreateAPIKeyRequest true "Datos de la clave"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	if err := iplist.Validate(req.AllowedIPs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	key, prefix, hash := auth.GenerateAPIKey()
+	apiKey := database.APIKey{
+		UserID:     currentUserID(c),
+		Name:       strings.TrimSpace(req.Name),
+		Prefix:     prefix,
+		KeyHash:    hash,
+		AllowedIPs: req.AllowedIPs,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear la clave de API"})
+		return
+	}
+
+	writeJSON(c, http.StatusCreated, gin.H{
+		"message": "Clave de API creada; guárdala, no se volverá a mostrar",
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+// GetAPIKeys lista las claves de API del usuario autenticado
+// @Summary Listar claves de API
+// @Description Devuelve las claves de API del usuario (sin la clave completa)
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} database.APIKey
+// @Failure 403 {object} map[string]interface{}
+// @Router /api-keys [get]
+func GetAPIKeys(c *gin.Context) {
+	var keys []database.APIKey
+	database.DB.WithContext(c.Request.Context()).Where("user_id = ?", currentUserID(c)).Order("created_at DESC").Find(&keys)
+	if respondJSONAPI(c, http.StatusOK, keys, nil, nil) {
+		return
+	}
+	writeJSON(c, http.StatusOK, keys)
+}
+
+// RevokeAPIKey revoca una clave de API del usuario autenticado
+// @Summary Revocar clave de API
+// @Description Revoca la clave; las peticiones que la usen dejarán de autenticarse
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID de la clave"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	apiKey, ok := findAPIKey(c)
+	if !ok {
+		return
+	}
+
+	if apiKey.RevokedAt == nil {
+		now := clock.Now()
+		apiKey.RevokedAt = &now
+		database.DB.WithContext(c.Request.Context()).Model(apiKey).Update("revoked_at", now)
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"message": "Clave de API revocada", "api_key": apiKey})
+}
+
+// GetAPIKeyUsage devuelve el consumo de una clave de API
+// @Summary Uso de una clave de API
+// @Description Peticiones totales, endpoints utilizados y serie diaria de una clave de API del usuario
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID de la clave"
+// @Param days query int false "Días a considerar (por defecto 30)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /api-keys/{id}/usage [get]
+func GetAPIKeyUsage(c *gin.Context) {
+	apiKey, ok := findAPIKey(c)
+	if !ok {
+		return
+	}
+
+	days := statsDays(c)
+	since := clock.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+	query := func() *gorm.DB {
+		return database.DB.WithContext(c.Request.Context()).Model(&database.APIKeyUsage{}).Where("api_key_id = ? AND day >= ?", apiKey.ID, since)
+	}
+
+	var total int64
+	query().Select("COALESCE(SUM(count), 0)").Scan(&total)
+
+	var rows []struct {
+		Endpoint   string
+		Count      int64
+		LastSeenAt string
+	}
+	query().Select("endpoint, SUM(count) AS count, MAX(last_seen_at) AS last_seen_at").
+		Group("endpoint").Order("count DESC").Scan(&rows)
+	endpoints := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		endpoints = append(endpoints, gin.H{
+			"endpoint":     row.Endpoint,
+			"count":        row.Count,
+			"last_seen_at": database.ParseTime(row.LastSeenAt),
+		})
+	}
+
+	daily := []Bucket{}
+	query().Select("day AS date, SUM(count) AS count").Group("day").Order("day").Scan(&daily)
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"api_key_id":     apiKey.ID,
+		"period_days":    days,
+		"total_requests": total,
+		"last_used_at":   apiKey.LastUsedAt,
+		"endpoints":      endpoints,
+		"daily":          daily,
+	})
+}
+
+// findAPIKey carga una clave de API del usuario autenticado; si no existe responde 404
+func findAPIKey(c *gin.Context) (*database.APIKey, bool) {
+	var apiKey database.APIKey
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), currentUserID(c)).First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Clave de API no encontrada"})
+		return nil, false
+	}
+	return &apiKey, true
+}
+
+// CreateAPIKeyRequest estructura para crear una clave de API
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// IPs o rangos CIDR desde los que se podrá usar la clave (vacío = cualquiera)
+	AllowedIPs []string `json:"allowed_ips" example:"10.8.0.0/16"`
+}
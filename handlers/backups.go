@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api/backup"
+	"api/database"
+	"api/ids"
+	"api/jobs"
+	"api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestBackup inicia una copia de seguridad de la base de datos
+// @Summary Hacer copia de seguridad
+// @Description Hace de forma asíncrona una copia cifrada de la base de datos en el almacenamiento; su estado se consulta con GET /admin/backups/{id}. Para restaurarla se usa el comando api restore con el servidor parado
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} database.Backup
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/backups [post]
+func RequestBackup(c *gin.Context) {
+	var running int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.Backup{}).Where("status IN ?", []string{"pending", "running"}).Count(&running)
+	if running > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya hay una copia de seguridad en curso"})
+		return
+	}
+
+	adminID := currentUserID(c)
+	b := database.Backup{ID: ids.New(), Status: "pending", RequestedBy: &adminID}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&b).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear la copia de seguridad"})
+		return
+	}
+	if err := jobs.Enqueue(c.Request.Context(), backup.Job, backup.Payload{BackupID: b.ID}); err != nil {
+		database.DB.WithContext(c.Request.Context()).Model(&b).Update("status", "failed")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No se pudo iniciar la copia de seguridad, inténtalo más tarde"})
+		return
+	}
+
+	writeJSON(c, http.StatusAccepted, b)
+}
+
+// GetBackups lista las copias de seguridad
+// @Summary Listar copias de seguridad
+// @Description Copias de seguridad de la base de datos, las más recientes primero, con su estado
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Copias por página"
+// @Param exact_count query bool false "Contar el total exacto en lugar de estimarlo en tablas grandes"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/backups [get]
+func GetBackups(c *gin.Context) {
+	page := pagination(c)
+	var list []database.Backup
+	query := database.DB.WithContext(countContext(c)).Model(&database.Backup{})
+	total, err := database.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las copias de seguridad"})
+		return
+	}
+	if err := query.Order("created_at DESC, id").Offset(page.Offset()).Limit(page.PerPage).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las copias de seguridad"})
+		return
+	}
+
+	response := paginated(list, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// GetBackup devuelve el estado de una copia de seguridad
+// @Summary Estado de copia de seguridad
+// @Description Devuelve el estado de la copia y, si está lista, una URL firmada para descargar el fichero cifrado (se restaura con api restore <fichero>)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID de la copia"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/backups/{id} [get]
+func GetBackup(c *gin.Context) {
+	var b database.Backup
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ?", c.Param("id")).First(&b).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copia de seguridad no encontrada"})
+		return
+	}
+	if b.Status != "ready" {
+		writeJSON(c, http.StatusOK, gin.H{"backup": b})
+		return
+	}
+
+	url, err := storage.Default.SignedURL(c.Request.Context(), b.ObjectKey, signedURLTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar la URL de descarga"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"backup": b, "download_url": url})
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchHeaders cabeceras de la petición del lote que se copian a cada subpetición
+var batchHeaders = []string{"Authorization", "X-API-Key", "Accept", "Accept-Language", "User-Agent", "X-Maintenance-Bypass"}
+
+// Batch ejecuta varias peticiones de la API en una sola llamada
+// @Summary Peticiones por lotes
+// @Description Ejecuta en orden hasta 20 subpeticiones a través del router, con las mismas credenciales que la petición del lote (cada una cuenta para la cuota), y devuelve el estado y el cuerpo de cada una
+// @Tags batch
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param requests body BatchRequest true "Subpeticiones"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /batch [post]
+func Batch(router http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		base := apiBase(c)
+		for i, item := range req.Requests {
+			target, err := url.Parse(item.Path)
+			if err != nil || path.Clean(target.Path) != target.Path || !strings.HasPrefix(target.Path, base+"/") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("La petición %d debe ser una ruta de %s", i, base)})
+				return
+			}
+			if target.Path == c.FullPath() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("La petición %d no puede ser otro lote", i)})
+				return
+			}
+		}
+
+		responses := make([]BatchResponse, len(req.Requests))
+		for i, item := range req.Requests {
+			responses[i] = runBatchItem(c, router, item)
+		}
+		writeJSON(c, http.StatusOK, gin.H{"responses": responses})
+	}
+}
+
+// runBatchItem ejecuta una subpetición con las credenciales y la IP de la petición del lote
+func runBatchItem(c *gin.Context, router http.Handler, item BatchItem) BatchResponse {
+	sub, err := http.NewRequestWithContext(c.Request.Context(), item.Method, item.Path, bytes.NewReader(item.Body))
+	if err != nil {
+		return BatchResponse{Status: http.StatusBadRequest, Body: errorBody("Petición inválida")}
+	}
+	for _, name := range batchHeaders {
+		if value := c.GetHeader(name); value != "" {
+			sub.Header.Set(name, value)
+		}
+	}
+	if len(item.Body) > 0 {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	// La IP del cliente ya resuelta; Gin solo la lee de X-Forwarded-For si la
+	// conexión original viene de un proxy de confianza
+	sub.RemoteAddr = c.Request.RemoteAddr
+	sub.Header.Set("X-Forwarded-For", c.ClientIP())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, sub)
+
+	response := BatchResponse{Status: rec.Code, Body: rec.Body.Bytes()}
+	if location := rec.Header().Get("Location"); location != "" {
+		response.Headers = map[string]string{"Location": location}
+	}
+	if rec.Body.Len() == 0 {
+		response.Body = nil
+	} else if !json.Valid(response.Body) {
+		// Las respuestas que no son JSON se devuelven como cadena
+		response.Body, _ = json.Marshal(rec.Body.String())
+	}
+	return response
+}
+
+func errorBody(message string) json.RawMessage {
+	body, _ := json.Marshal(gin.H{"error": message})
+	return body
+}
+
+type BatchRequest struct {
+	Requests []BatchItem `json:"requests" binding:"required,min=1,max=20,dive"`
+}
+
+type BatchItem struct {
+	Method string          `json:"method" binding:"required,oneof=GET POST PUT PATCH DELETE"`
+	Path   string          `json:"path" binding:"required"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type BatchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"api/billing"
+	"api/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tamaño máximo aceptado para el cuerpo de un webhook
+const maxWebhookSize = 1 << 20
+
+// CreateCheckoutSession inicia el alta de una suscripción con Stripe Checkout
+// @Summary Iniciar suscripción
+// @Description Crea una sesión de Stripe Checkout y devuelve la URL a la que redirigir al usuario
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param checkout body CheckoutRequest false "Plan o precio a contratar (por defecto STRIPE_PRICE_ID); solo se admiten los precios de los planes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /billing/checkout [post]
+func CreateCheckoutSession(c *gin.Context) {
+	var req CheckoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ctx := c.Request.Context()
+	if req.Plan != "" {
+		var plan database.Plan
+		if err := database.DB.WithContext(ctx).Where("code = ?", req.Plan).First(&plan).Error; err != nil || plan.StripePriceID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El plan indicado no se puede contratar"})
+			return
+		}
+		req.PriceID = plan.StripePriceID
+	}
+	if req.PriceID == "" {
+		req.PriceID = billing.DefaultPrice()
+	}
+	if req.PriceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Debes indicar el plan a contratar"})
+		return
+	}
+	// Solo los precios asociados a un plan: cualquier otro precio de la cuenta
+	// de Stripe (p. ej. uno más barato) no debe dar acceso de pago
+	if _, err := billing.PlanForPrice(ctx, req.PriceID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El precio indicado no corresponde a ningún plan"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if _, active := billing.ActiveSubscription(c.Request.Context(), user.ID); active {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya tienes una suscripción activa, gestiónala desde el portal"})
+		return
+	}
+
+	customerID, err := billing.EnsureCustomer(ctx, user)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+
+	url, err := billing.CreateCheckoutSession(ctx, customerID, req.PriceID,
+		billing.RedirectURL("STRIPE_SUCCESS_URL", "/billing/success?session_id={CHECKOUT_SESSION_ID}"),
+		billing.RedirectURL("STRIPE_CANCEL_URL", "/billing/cancel"))
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"url": url})
+}
+
+// CreatePortalSession abre el portal de cliente de Stripe
+// @Summary Portal de facturación
+// @Description Devuelve la URL del portal de Stripe donde el usuario gestiona su suscripción y facturas
+// @Tags billing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /billing/portal [post]
+func CreatePortalSession(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	customerID, err := billing.EnsureCustomer(ctx, user)
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+
+	url, err := billing.CreatePortalSession(ctx, customerID, billing.RedirectURL("STRIPE_PORTAL_RETURN_URL", "/billing"))
+	if err != nil {
+		respondBillingError(c, err)
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"url": url})
+}
+
+// GetSubscription devuelve el estado de la suscripción del usuario
+// @Summary Mi suscripción
+// @Description Devuelve la suscripción activa del usuario y su historial
+// @Tags billing
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /billing/subscription [get]
+func GetSubscription(c *gin.Context) {
+	userID := currentUserID(c)
+
+	var history []database.Subscription
+	database.DB.WithContext(c.Request.Context()).Where("user_id = ?", userID).Order("created_at DESC").Find(&history)
+
+	active, ok := billing.ActiveSubscription(c.Request.Context(), userID)
+	writeJSON(c, http.StatusOK, gin.H{
+		"active":        ok,
+		"subscription":  active,
+		"subscriptions": history,
+	})
+}
+
+// StripeWebhook recibe los eventos de Stripe y sincroniza las suscripciones
+// @Summary Webhook de Stripe
+// @Description Endpoint para los eventos de Stripe; se valida la cabecera Stripe-Signature
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /billing/webhook [post]
+func StripeWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el evento"})
+		return
+	}
+
+	if err := billing.VerifyWebhook(payload, c.GetHeader("Stripe-Signature")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Firma del webhook inválida"})
+		return
+	}
+
+	var event billing.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Evento inválido"})
+		return
+	}
+
+	// Un error hace que Stripe reintente el envío más tarde
+	if err := billing.HandleEvent(c.Request.Context(), event); err != nil {
+		log.Printf("❌ Error procesando el evento de Stripe %s (%s): %v", event.ID, event.Type, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error procesando el evento"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"received": true})
+}
+
+func respondBillingError(c *gin.Context, err error) {
+	if errors.Is(err, billing.ErrDisabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "La facturación no está disponible"})
+		return
+	}
+	log.Printf("❌ Error de facturación: %v", err)
+	c.JSON(http.StatusBadGateway, gin.H{"error": "Error al comunicarse con el proveedor de pagos"})
+}
+
+// CheckoutRequest estructura para iniciar una suscripción
+type CheckoutRequest struct {
+	Plan    string `json:"plan"`
+	PriceID string `json:"price_id"`
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"api/branding"
+	"api/retention"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBranding devuelve la personalización para la página de inicio de sesión
+// @Summary Personalización pública
+// @Description Logotipo, color y nombre del tenant de la petición (X-Tenant o ?tenant=) o, sin tenant, de la instalación, para la página de inicio de sesión. No requiere autenticación; los campos vacíos usan los valores de la aplicación
+// @Tags auth
+// @Produce json
+// @Param tenant query string false "Identificador del tenant (alternativa a la cabecera X-Tenant)"
+// @Success 200 {object} branding.Settings
+// @Failure 404 {object} map[string]interface{}
+// @Router /branding [get]
+func GetBranding(c *gin.Context) {
+	writeJSON(c, http.StatusOK, branding.Current(c.Request.Context()))
+}
+
+// GetTenantSettings devuelve los ajustes del tenant
+// @Summary Ajustes del tenant
+// @Description Personalización (logotipo, color, nombre del remitente y pie de los correos) y plazos de retención propios del tenant de la petición o, sin tenant, de la instalación
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} TenantSettings
+// @Router /admin/tenant/settings [get]
+func GetTenantSettings(c *gin.Context) {
+	ctx := c.Request.Context()
+	overrides, err := retention.Overrides(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los ajustes"})
+		return
+	}
+	writeJSON(c, http.StatusOK, TenantSettings{Branding: branding.Current(ctx), Retention: overrides})
+}
+
+// UpdateTenantSettings modifica los ajustes del tenant
+// @Summary Modificar ajustes del tenant
+// @Description Sustituye la personalización y/o los plazos de retención propios (por regla, una duración como 720h u "off"; las reglas que no se envían usan el plazo de la instalación). Lo que no se envía no cambia
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body UpdateTenantSettingsRequest true "Personalización y plazos de retención"
+// @Success 200 {object} TenantSettings
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/tenant/settings [put]
+func UpdateTenantSettings(c *gin.Context) {
+	var req UpdateTenantSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if req.Retention != nil {
+		err := retention.SetOverrides(ctx, req.Retention)
+		if errors.Is(err, retention.ErrUnknownRule) || errors.Is(err, retention.ErrInvalidTTL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los plazos de retención"})
+			return
+		}
+	}
+	if req.Branding != nil {
+		if err := branding.Set(ctx, branding.Settings(*req.Branding)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar la personalización"})
+			return
+		}
+	}
+
+	GetTenantSettings(c)
+}
+
+// TenantSettings ajustes de un tenant
+type TenantSettings struct {
+	Branding branding.Settings `json:"branding"`
+	// Plazo propio por regla de retención
+	Retention map[string]string `json:"retention"`
+}
+
+// UpdateTenantSettingsRequest estructura para cambiar los ajustes de un tenant
+type UpdateTenantSettingsRequest struct {
+	Branding  *BrandingRequest  `json:"branding"`
+	Retention map[string]string `json:"retention"`
+}
+
+// BrandingRequest personalización de un tenant
+type BrandingRequest struct {
+	LogoURL     string `json:"logo_url" binding:"omitempty,http_url,max=500"`
+	SenderName  string `json:"sender_name" binding:"max=100"`
+	AccentColor string `json:"accent_color" binding:"omitempty,hexcolor"`
+	EmailFooter string `json:"email_footer" binding:"max=1000"`
+}
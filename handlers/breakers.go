@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api/breaker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCircuitBreakers devuelve el estado de los circuitos de los servicios externos
+// @Summary Circuitos de servicios externos
+// @Description Estado (closed, open, half_open) y métricas desde el arranque de esta réplica de cada circuito de las integraciones externas (correo, Stripe, CAPTCHA, proveedores de identidad, PDF): llamadas, éxitos, fallos, rechazadas con el circuito abierto y último error
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/circuit-breakers [get]
+func GetCircuitBreakers(c *gin.Context) {
+	writeJSON(c, http.StatusOK, gin.H{
+		"circuit_breakers": breaker.All(),
+		"threshold":        breaker.Threshold(),
+		"open_timeout":     breaker.OpenTimeout().String(),
+	})
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/database"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetComments lista los comentarios de un post
+// @Summary Listar comentarios
+// @Description Comentarios del post, los más antiguos primero. Los ocultos por un administrador solo los ven su autor y los administradores; los eliminados no se listan. 404 si el usuario no puede ver el post
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Param include query string false "Relaciones que añadir en included: author"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Comentarios por página"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id}/comments [get]
+func GetComments(c *gin.Context) {
+	pid, ok := postID(c)
+	if !ok {
+		return
+	}
+
+	page := pagination(c)
+	comments, total, err := services.ListComments(countContext(c), currentIdentity(c), pid, page.Offset(), page.PerPage)
+	if commentError(c, err) {
+		return
+	}
+	list := withCommentLinks(c, comments)
+	if !includeComments(c, list) {
+		return
+	}
+
+	response := paginated(list, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// CreateComment comenta un post
+// @Summary Comentar post
+// @Description Publica un comentario del usuario autenticado en un post que puede ver
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Param comment body CommentRequest true "Texto"
+// @Success 201 {object} database.Comment
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id}/comments [post]
+func CreateComment(c *gin.Context) {
+	pid, ok := postID(c)
+	if !ok {
+		return
+	}
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	comment, err := services.CreateComment(c.Request.Context(), currentIdentity(c), pid, req.Body)
+	if commentError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusCreated, withCommentLinks(c, []database.Comment{*comment})[0])
+}
+
+// GetComment devuelve un comentario de un post
+// @Summary Obtener comentario
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Param comment_id path int true "ID del comentario"
+// @Param include query string false "Relaciones que añadir en included: author"
+// @Success 200 {object} database.Comment
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id}/comments/{comment_id} [get]
+func GetComment(c *gin.Context) {
+	pid, id, ok := commentIDs(c)
+	if !ok {
+		return
+	}
+	comment, err := services.GetComment(c.Request.Context(), currentIdentity(c), pid, id)
+	if commentError(c, err) {
+		return
+	}
+	list := withCommentLinks(c, []database.Comment{*comment})
+	if !includeComments(c, list) {
+		return
+	}
+	writeJSON(c, http.StatusOK, list[0])
+}
+
+// UpdateComment modifica un comentario
+// @Summary Modificar comentario
+// @Description Sustituye el texto. Solo su autor; si estaba oculto sigue oculto
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Param comment_id path int true "ID del comentario"
+// @Param comment body CommentRequest true "Texto"
+// @Success 200 {object} database.Comment
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id}/comments/{comment_id} [put]
+func UpdateComment(c *gin.Context) {
+	pid, id, ok := commentIDs(c)
+	if !ok {
+		return
+	}
+	var req CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	comment, err := services.UpdateComment(c.Request.Context(), currentIdentity(c), pid, id, req.Body)
+	if commentError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, withCommentLinks(c, []database.Comment{*comment})[0])
+}
+
+// DeleteComment elimina un comentario
+// @Summary Eliminar comentario
+// @Description Lo pueden eliminar su autor, el autor del post y los administradores. Deja de listarse, pero los administradores pueden recuperarlo hasta que la retención lo purga (deleted_comments, 30 días)
+// @Tags comments
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Param comment_id path int true "ID del comentario"
+// @Success 204
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id}/comments/{comment_id} [delete]
+func DeleteComment(c *gin.Context) {
+	pid, id, ok := commentIDs(c)
+	if !ok {
+		return
+	}
+	if commentError(c, services.DeleteComment(c.Request.Context(), currentIdentity(c), pid, id)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetModerationComments lista los comentarios para moderarlos
+// @Summary Comentarios para moderar
+// @Description Comentarios de todos los posts en el estado indicado, los más recientes primero: hidden (por defecto, los ocultos), visible o deleted (eliminados aún recuperables)
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "hidden, visible o deleted"
+// @Param include query string false "Relaciones que añadir en included: author"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Comentarios por página"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/comments [get]
+func GetModerationComments(c *gin.Context) {
+	var req ModerationCommentsQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	page := pagination(c)
+	comments, total, err := services.ModerationComments(countContext(c), req.Status, page.Offset(), page.PerPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los comentarios"})
+		return
+	}
+	list := withCommentLinks(c, comments)
+	if !includeComments(c, list) {
+		return
+	}
+
+	response := paginated(list, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// HideComment oculta un comentario
+// @Summary Ocultar comentario
+// @Description Deja de mostrarse al resto de usuarios; su autor lo sigue viendo con hidden_at y el motivo (hidden_reason), obligatorio. Si ya estaba oculto no cambia
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del comentario"
+// @Param moderation body HideCommentRequest true "Motivo"
+// @Success 200 {object} database.Comment
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/comments/{id}/hide [post]
+func HideComment(c *gin.Context) {
+	id, ok := moderatedCommentID(c)
+	if !ok {
+		return
+	}
+	var req HideCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	comment, err := services.HideComment(c.Request.Context(), currentIdentity(c), id, req.Reason)
+	if commentError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, comment)
+}
+
+// UnhideComment vuelve a mostrar un comentario oculto
+// @Summary Mostrar comentario
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del comentario"
+// @Success 200 {object} database.Comment
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/comments/{id}/unhide [post]
+func UnhideComment(c *gin.Context) {
+	id, ok := moderatedCommentID(c)
+	if !ok {
+		return
+	}
+	comment, err := services.UnhideComment(c.Request.Context(), currentIdentity(c), id)
+	if commentError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, comment)
+}
+
+// RestoreComment recupera un comentario eliminado
+// @Summary Recuperar comentario
+// @Description Vuelve a listar un comentario eliminado que la retención aún no ha purgado. Los comentarios de un post eliminado se eliminan definitivamente con él
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del comentario"
+// @Success 200 {object} database.Comment
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/comments/{id}/restore [post]
+func RestoreComment(c *gin.Context) {
+	id, ok := moderatedCommentID(c)
+	if !ok {
+		return
+	}
+	comment, err := services.RestoreComment(c.Request.Context(), currentIdentity(c), id)
+	if commentError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, comment)
+}
+
+// commentIDs IDs del post y del comentario de las rutas anidadas
+func commentIDs(c *gin.Context) (uint, uint, bool) {
+	pid, ok := postID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseUint(c.Param("comment_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comentario no encontrado"})
+		return 0, 0, false
+	}
+	return pid, uint(id), true
+}
+
+func moderatedCommentID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comentario no encontrado"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// commentError responde a los errores de las rutas de comentarios; devuelve
+// false si no hubo error
+func commentError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrCommentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comentario no encontrado"})
+	case errors.Is(err, services.ErrCommentForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "No puedes modificar este comentario"})
+	default:
+		return postError(c, err)
+	}
+	return true
+}
+
+// CommentRequest texto de un comentario
+type CommentRequest struct {
+	Body string `json:"body" binding:"required,max=5000" example:"¡Muy útil, gracias!"`
+}
+
+// HideCommentRequest motivo por el que se oculta un comentario, que ve su autor
+type HideCommentRequest struct {
+	Reason string `json:"reason" binding:"required,max=500" example:"Lenguaje ofensivo"`
+}
+
+// ModerationCommentsQuery filtro del listado de moderación
+type ModerationCommentsQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=hidden visible deleted"`
+}
+
+func (r *CommentRequest) Normalize()     { r.Body = strings.TrimSpace(r.Body) }
+func (r *HideCommentRequest) Normalize() { r.Reason = strings.TrimSpace(r.Reason) }
@@ -0,0 +1,119 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"api/apitest"
+)
+
+func TestComments(t *testing.T) {
+	srv := apitest.New(t)
+	owner := srv.CreateUser(t, "")
+	commenter := srv.CreateUser(t, "")
+	other := srv.CreateUser(t, "")
+	admin := srv.CreateUser(t, "admin")
+	token := apitest.WithToken(owner.Token)
+	commenterToken := apitest.WithToken(commenter.Token)
+	otherToken := apitest.WithToken(other.Token)
+	adminToken := apitest.WithToken(admin.Token)
+
+	var post struct {
+		ID uint `json:"id"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/posts", map[string]string{"title": "Público"}, token).
+		Expect(t, http.StatusCreated).JSON(t, &post)
+	comments := "/api/v1/posts/" + itoa(post.ID) + "/comments"
+	srv.Do(t, http.MethodPost, "/api/v1/posts", map[string]string{"title": "Privado", "visibility": "private"}, token).
+		Expect(t, http.StatusCreated).JSON(t, &post)
+	private := "/api/v1/posts/" + itoa(post.ID) + "/comments"
+
+	type comment struct {
+		ID           uint   `json:"id"`
+		Body         string `json:"body"`
+		HiddenReason string `json:"hidden_reason"`
+		Links        map[string]struct {
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	var first, second comment
+	srv.Do(t, http.MethodPost, comments, map[string]string{"body": " Primero "}, commenterToken).
+		Expect(t, http.StatusCreated).JSON(t, &first)
+	if first.Body != "Primero" || first.Links["self"].Href != comments+"/"+itoa(first.ID) {
+		t.Errorf("comentario = %+v", first)
+	}
+	srv.Do(t, http.MethodPost, comments, map[string]string{"body": "Segundo"}, otherToken).
+		Expect(t, http.StatusCreated).JSON(t, &second)
+	srv.Do(t, http.MethodPost, comments, map[string]string{"body": ""}, otherToken).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, private, map[string]string{"body": "Hola"}, otherToken).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, private, nil, otherToken).Expect(t, http.StatusNotFound)
+
+	type listed struct {
+		Data []struct {
+			comment
+			Included struct {
+				Author struct {
+					ID uint `json:"id"`
+				} `json:"author"`
+			} `json:"included"`
+		} `json:"data"`
+		Meta struct {
+			Total int64 `json:"total"`
+		} `json:"meta"`
+	}
+	get := func(path string, token apitest.RequestOption) listed {
+		var list listed
+		srv.Do(t, http.MethodGet, path, nil, token).Expect(t, http.StatusOK).JSON(t, &list)
+		return list
+	}
+	list := get(comments+"?include=author", token)
+	if len(list.Data) != 2 || list.Data[0].ID != first.ID || list.Data[0].Included.Author.ID != commenter.ID {
+		t.Errorf("comentarios = %+v", list.Data)
+	}
+
+	// Solo el autor modifica el texto; el autor del post puede eliminarlo
+	srv.Do(t, http.MethodPut, comments+"/"+itoa(first.ID), map[string]string{"body": "Mío"}, token).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, comments+"/"+itoa(first.ID), map[string]string{"body": "Editado"}, commenterToken).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, comments+"/"+itoa(first.ID), nil, otherToken).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodDelete, comments+"/"+itoa(second.ID), nil, token).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodGet, comments+"/"+itoa(second.ID), nil, otherToken).Expect(t, http.StatusNotFound)
+
+	// Moderación: el oculto solo lo ven su autor y los administradores
+	srv.Do(t, http.MethodPost, "/api/v1/admin/comments/"+itoa(first.ID)+"/hide", map[string]string{}, adminToken).
+		Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/comments/"+itoa(first.ID)+"/hide", map[string]string{"reason": "Spam"}, adminToken).
+		Expect(t, http.StatusOK)
+	list = get(comments, otherToken)
+	if len(list.Data) != 0 {
+		t.Errorf("comentarios con uno oculto = %+v", list.Data)
+	}
+	list = get(comments, commenterToken)
+	if len(list.Data) != 1 || list.Data[0].HiddenReason != "Spam" {
+		t.Errorf("comentarios del autor = %+v", list.Data)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/comments", nil, otherToken).Expect(t, http.StatusForbidden)
+	list = get("/api/v1/admin/comments", adminToken)
+	if list.Meta.Total != 1 || list.Data[0].ID != first.ID {
+		t.Errorf("ocultos = %+v", list)
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/admin/comments/"+itoa(first.ID)+"/unhide", nil, adminToken).Expect(t, http.StatusOK)
+	list = get("/api/v1/admin/comments?status=deleted", adminToken)
+	if list.Meta.Total != 1 || list.Data[0].ID != second.ID {
+		t.Errorf("eliminados = %+v", list)
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/admin/comments/"+itoa(second.ID)+"/restore", nil, adminToken).Expect(t, http.StatusOK)
+	list = get(comments, otherToken)
+	if len(list.Data) != 2 {
+		t.Errorf("comentarios tras moderar = %+v", list.Data)
+	}
+
+	// Al eliminar el post se eliminan sus comentarios, también los eliminados
+	srv.Do(t, http.MethodDelete, comments+"/"+itoa(second.ID), nil, otherToken).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodDelete, comments[:len(comments)-len("/comments")], nil, token).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodGet, comments, nil, token).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/comments/"+itoa(second.ID)+"/restore", nil, adminToken).Expect(t, http.StatusNotFound)
+	list = get("/api/v1/admin/comments?status=visible", adminToken)
+	if list.Meta.Total != 0 {
+		t.Errorf("comentarios tras eliminar el post = %+v", list)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"api/captcha"
+	"api/database"
+	"api/localtime"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID devuelve el ID del usuario autenticado establecido por AuthMiddleware
+func currentUserID(c *gin.Context) uint {
+	return c.GetUint("userID")
+}
+
+// currentIdentity identidad autenticada, para las comprobaciones de permisos de services
+func currentIdentity(c *gin.Context) services.Identity {
+	return services.Identity{
+		UserID:   currentUserID(c),
+		Role:     c.GetString("userRole"),
+		APIKeyID: c.GetUint("apiKeyID"),
+		// OAuthClientID: sin él, services trataría un token OAuth como una sesión
+		OAuthClientID: c.GetUint("oauthClientID"),
+		Permissions:   c.GetStringSlice("permissions"),
+	}
+}
+
+// responseLocation zona horaria de las fechas de la respuesta: la de la
+// cabecera X-Timezone o la del usuario autenticado (ver localtime.Resolve)
+func responseLocation(c *gin.Context) (string, *time.Location) {
+	return localtime.Resolve(c.GetHeader(localtime.Header), c.GetString("userTimezone"))
+}
+
+// writeJSON responde con obj como JSON y sus fechas en la zona horaria del
+// cliente, que se indica en la cabecera X-Timezone de la respuesta. Las
+// respuestas con datos usan writeJSON en lugar de c.JSON.
+func writeJSON(c *gin.Context, status int, obj interface{}) {
+	name, loc := responseLocation(c)
+	c.Header(localtime.Header, name)
+	c.Writer.Header().Add("Vary", localtime.Header)
+	c.JSON(status, localtime.Localize(obj, loc))
+}
+
+// currentUser carga el usuario autenticado; si no existe responde 401 y devuelve false
+func currentUser(c *gin.Context) (*database.User, bool) {
+	var user database.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// deviceTrustCookie cookie con el token de dispositivo de confianza
+const deviceTrustCookie = "device_trust"
+
+// refreshCookie cookie HttpOnly con el token de renovación de las sesiones de
+// navegador (X-Token-Delivery: cookie)
+const refreshCookie = "refresh_token"
+
+// loginMeta datos del cliente que se guardan en el historial de inicios de sesión,
+// junto con el token del CAPTCHA (X-Captcha-Token), la clave de API, el token de
+// dispositivo de confianza (X-Device-Token o la cookie device_trust) si los hay
+// y si el token de renovación se entrega en una cookie (X-Token-Delivery)
+func loginMeta(c *gin.Context) services.LoginMeta {
+	meta := services.LoginMeta{
+		IP:           c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		CaptchaToken: c.GetHeader("X-Captcha-Token"),
+		APIKey:       c.GetHeader("X-API-Key"),
+		DeviceToken:  c.GetHeader("X-Device-Token"),
+		// El token de renovación va en una cookie que el JavaScript de la página
+		// no puede leer; en el cuerpo solo el token de acceso, de corta duración
+		RefreshCookie: c.GetHeader("X-Token-Delivery") == "cookie",
+	}
+	if meta.DeviceToken == "" {
+		meta.DeviceToken, _ = c.Cookie(deviceTrustCookie)
+	}
+	return meta
+}
+
+// captchaError responde a los errores de CheckCaptcha con los datos que el
+// cliente necesita para mostrar el widget; devuelve false si err no es de CAPTCHA
+func captchaError(c *gin.Context, err error) bool {
+	var message string
+	switch {
+	case errors.Is(err, services.ErrCaptchaRequired):
+		message = "Se requiere verificación CAPTCHA"
+	case errors.Is(err, services.ErrCaptchaInvalid):
+		message = "Verificación CAPTCHA no superada"
+	default:
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":            message,
+		"captcha_required": true,
+		"captcha_provider": captcha.Provider(),
+		"captcha_site_key": captcha.SiteKey(),
+	})
+	return true
+}
+
+// setRefreshCookie guarda el token de renovación en una cookie HttpOnly,
+// SameSite=Strict por defecto (REFRESH_COOKIE_SAMESITE=lax o none si el
+// frontend está en otro sitio); con maxAge < 0 la borra
+func setRefreshCookie(c *gin.Context, token string, maxAge int) {
+	sameSite, secure := http.SameSiteStrictMode, gin.Mode() == gin.ReleaseMode
+	switch strings.ToLower(os.Getenv("REFRESH_COOKIE_SAMESITE")) {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		// Los navegadores solo envían a otros sitios las cookies Secure
+		sameSite, secure = http.SameSiteNoneMode, true
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(refreshCookie, token, maxAge, "/api", "", secure, true)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/deprecation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeprecations informa del uso de las rutas obsoletas
+// @Summary Uso de rutas obsoletas
+// @Description Lista las rutas marcadas como obsoletas con sus peticiones, usuarios y claves de API que aún las utilizan
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Días a considerar (por defecto 30)"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/deprecations [get]
+func GetDeprecations(c *gin.Context) {
+	days := statsDays(c)
+	since := clock.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+
+	routes := []gin.H{}
+	for _, info := range deprecation.All() {
+		var stats struct {
+			Requests   int64
+			Users      int64
+			LastSeenAt string
+		}
+		database.DB.WithContext(c.Request.Context()).Model(&database.UserUsage{}).
+			Select("COALESCE(SUM(count), 0) AS requests, COUNT(DISTINCT user_id) AS users, MAX(last_seen_at) AS last_seen_at").
+			Where("endpoint = ? AND day >= ?", info.Endpoint(), since).Scan(&stats)
+
+		var apiKeys int64
+		database.DB.WithContext(c.Request.Context()).Model(&database.APIKeyUsage{}).Where("endpoint = ? AND day >= ?", info.Endpoint(), since).
+			Distinct("api_key_id").Count(&apiKeys)
+
+		var top []struct {
+			UserID uint  `json:"user_id"`
+			Count  int64 `json:"count"`
+		}
+		database.DB.WithContext(c.Request.Context()).Model(&database.UserUsage{}).Select("user_id, SUM(count) AS count").
+			Where("endpoint = ? AND day >= ?", info.Endpoint(), since).
+			Group("user_id").Order("count DESC").Limit(10).Scan(&top)
+
+		var lastSeen *time.Time
+		if t := database.ParseTime(stats.LastSeenAt); !t.IsZero() {
+			lastSeen = &t
+		}
+		routes = append(routes, gin.H{
+			"route":        info,
+			"requests":     stats.Requests,
+			"users":        stats.Users,
+			"api_keys":     apiKeys,
+			"last_seen_at": lastSeen,
+			"top_users":    top,
+		})
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"period_days": days, "routes": routes})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api/auth"
+	"api/database"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyDevices lista los dispositivos del usuario autenticado
+// @Summary Mis dispositivos
+// @Description Dispositivos (navegador, sistema operativo y tipo) desde los que el usuario ha iniciado sesión
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /profile/devices [get]
+func GetMyDevices(c *gin.Context) {
+	devices, err := services.ListDevices(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los dispositivos"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"devices": devices})
+}
+
+// UntrustMyDevice retira la confianza de un dispositivo del usuario autenticado
+// @Summary Olvidar dispositivo de confianza
+// @Description El dispositivo deja de ser de confianza: sus tokens de dispositivo dejan de valer y los inicios de sesión arriesgados desde él vuelven a pedir el código
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del dispositivo"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /profile/devices/{id}/trust [delete]
+func UntrustMyDevice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	err = services.UntrustDevice(c.Request.Context(), currentUserID(c), uint(id))
+	switch {
+	case errors.Is(err, services.ErrDeviceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dispositivo no encontrado"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el dispositivo"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "El dispositivo ya no es de confianza"})
+}
+
+// GetMySessions lista las sesiones abiertas del usuario autenticado
+// @Summary Mis sesiones
+// @Description Sesiones sin caducar con su dispositivo; current indica la de la petición
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /profile/sessions [get]
+func GetMySessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	sessions, err := services.ListSessions(ctx, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las sesiones"})
+		return
+	}
+	devices, err := services.ListDevices(ctx, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las sesiones"})
+		return
+	}
+	byID := make(map[uint]database.Device, len(devices))
+	for _, d := range devices {
+		byID[d.ID] = d
+	}
+
+	// Con una clave de API no hay sesión actual
+	var current string
+	if claims, ok := c.Get("claims"); ok {
+		if claims, ok := claims.(*auth.Claims); ok && claims != nil {
+			current = claims.ID
+		}
+	}
+
+	list := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		item := gin.H{
+			"id":         s.ID,
+			"ip":         s.IP,
+			"country":    s.Country,
+			"created_at": s.CreatedAt,
+			"expires_at": s.ExpiresAt,
+			"current":    s.ID == current,
+		}
+		if s.DeviceID != nil {
+			if d, ok := byID[*s.DeviceID]; ok {
+				item["device"] = d
+			}
+		}
+		list = append(list, item)
+	}
+	writeJSON(c, http.StatusOK, gin.H{"sessions": list})
+}
+
+// RevokeSessionLink cierra la sesión del enlace "no he sido yo" de los avisos de inicio de sesión
+// @Summary Cerrar sesión desde el aviso
+// @Description Revoca la sesión indicada en el enlace firmado del correo de aviso; su token deja de aceptarse
+// @Tags auth
+// @Produce json
+// @Param token query string true "Token del enlace"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /auth/sessions/revoke [get]
+func RevokeSessionLink(c *gin.Context) {
+	err := services.RevokeSessionFromLink(c.Request.Context(), c.Query("token"))
+	switch {
+	case errors.Is(err, services.ErrInvalidRevokeLink):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enlace inválido o caducado"})
+		return
+	case errors.Is(err, services.ErrSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "La sesión no existe o ya estaba cerrada"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cerrar la sesión"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Sesión cerrada. Te recomendamos cambiar tu contraseña"})
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/ids"
+	"api/jobs"
+	"api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestExport solicita la exportación de todos los datos del usuario
+// @Summary Exportar mis datos
+// @Description Genera de forma asíncrona un ZIP con todos los datos del usuario y avisa por email cuando está listo
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} database.DataExport
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/export [post]
+func RequestExport(c *gin.Context) {
+	userID := currentUserID(c)
+
+	// Las pendientes demasiado antiguas se perdieron (p. ej. en un reinicio) y no deben bloquear
+	exports.FailStale(c.Request.Context())
+
+	var pending int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.DataExport{}).Where("user_id = ? AND status = ?", userID, "pending").Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya hay una exportación en curso"})
+		return
+	}
+
+	export := database.DataExport{ID: ids.New(), UserID: userID, Status: "pending"}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&export).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear la exportación"})
+		return
+	}
+
+	if err := jobs.Enqueue(c.Request.Context(), exports.Job, exports.Payload{ExportID: export.ID}); err != nil {
+		database.DB.WithContext(c.Request.Context()).Model(&export).Update("status", "failed")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No se pudo iniciar la exportación, inténtalo más tarde"})
+		return
+	}
+
+	writeJSON(c, http.StatusAccepted, export)
+}
+
+// GetExport devuelve el estado de una exportación y su enlace de descarga
+// @Summary Estado de exportación
+// @Description Devuelve el estado de la exportación y, si está lista, una URL de descarga firmada
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID de la exportación"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Router /profile/exports/{id} [get]
+func GetExport(c *gin.Context) {
+	var export database.DataExport
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), currentUserID(c)).First(&export).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exportación no encontrada"})
+		return
+	}
+
+	if export.Status != "ready" {
+		writeJSON(c, http.StatusOK, gin.H{"export": export})
+		return
+	}
+
+	remaining := clock.Until(*export.ExpiresAt)
+	if remaining <= 0 {
+		c.JSON(http.StatusGone, gin.H{"error": "La exportación ha expirado, solicita una nueva"})
+		return
+	}
+	if remaining > signedURLTTL {
+		remaining = signedURLTTL
+	}
+
+	url, err := storage.Default.SignedURL(c.Request.Context(), export.ObjectKey, remaining)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar la URL de descarga"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"export": export, "download_url": url})
+}
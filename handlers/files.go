@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/images"
+	"api/jobs"
+	"api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tamaño máximo permitido para avatares
+const maxAvatarSize = 5 << 20
+
+// Duración de las URLs de descarga firmadas
+const signedURLTTL = 15 * time.Minute
+
+var avatarExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// UploadAvatar sube el avatar del usuario autenticado
+// @Summary Subir avatar
+// @Description Sube una imagen de avatar; las variantes (thumb, medium) se generan de forma asíncrona
+// @Tags profile
+// @Accept multipart/form-data
+// @Produce json
+// @Security BearerAuth
+// @Param avatar formData file true "Imagen del avatar"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /profile/avatar [post]
+func UploadAvatar(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	file, header, err := c.Request.FormFile("avatar")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Archivo 'avatar' requerido"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAvatarSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El avatar supera el tamaño máximo permitido"})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+	if err != nil || len(data) > maxAvatarSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No se pudo leer el avatar"})
+		return
+	}
+
+	// Detectar el tipo real del contenido en lugar de confiar en el cliente
+	contentType := http.DetectContentType(data)
+	ext, allowed := avatarExtensions[contentType]
+	if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de imagen no soportado"})
+		return
+	}
+	if err := images.CheckDimensions(data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La imagen es demasiado grande o no es válida"})
+		return
+	}
+
+	// El original se guarda aparte y nunca se sirve: puede contener metadatos EXIF
+	key := fmt.Sprintf("avatars/%d/original/%d%s", user.ID, clock.Now().UnixNano(), ext)
+	if err := storage.Default.Put(c.Request.Context(), key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar el avatar"})
+		return
+	}
+
+	if err := setAvatar(c.Request.Context(), user, key); err != nil {
+		storage.Default.Delete(c.Request.Context(), key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar el avatar"})
+		return
+	}
+
+	writeJSON(c, http.StatusAccepted, gin.H{
+		"message": "Avatar recibido, procesando variantes",
+		"status":  "processing",
+	})
+}
+
+// GetAvatar devuelve el estado y las URLs de las variantes del avatar
+// @Summary Obtener avatar
+// @Description Devuelve el estado de procesamiento y las URLs firmadas de las variantes del avatar
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /profile/avatar [get]
+func GetAvatar(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	urls := gin.H{}
+	for name, key := range map[string]string{"thumb": user.AvatarThumbKey, "medium": user.AvatarMediumKey} {
+		if key == "" {
+			continue
+		}
+		url, err := storage.Default.SignedURL(c.Request.Context(), key, signedURLTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar la URL del avatar"})
+			return
+		}
+		urls[name] = url
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"status":   user.AvatarStatus,
+		"variants": urls,
+	})
+}
+
+// setAvatar asigna el original subido al usuario y encola la generación de variantes
+func setAvatar(ctx context.Context, user *database.User, key string) error {
+	previous, previousStatus := user.AvatarKey, user.AvatarStatus
+	if err := database.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"avatar_key":    key,
+		"avatar_status": "processing",
+	}).Error; err != nil {
+		return err
+	}
+	if err := jobs.Enqueue(ctx, images.AvatarJob, images.AvatarPayload{UserID: user.ID, Key: key}); err != nil {
+		// Volver al avatar anterior, que sigue intacto en el almacenamiento
+		database.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+			"avatar_key":    previous,
+			"avatar_status": previousStatus,
+		})
+		return err
+	}
+
+	// El original anterior solo se borra cuando el nuevo ya está registrado
+	if previous != "" && previous != key {
+		storage.Default.Delete(ctx, previous)
+	}
+	return nil
+}
+
+// ServeFile sirve archivos del almacenamiento local mediante URLs firmadas
+// @Summary Descargar archivo
+// @Description Descarga un archivo usando una URL firmada y con expiración
+// @Tags files
+// @Produce octet-stream
+// @Param key path string true "Clave del archivo"
+// @Param expires query int true "Expiración (unix)"
+// @Param signature query string true "Firma"
+// @Success 200 {file} file
+// @Failure 403 {object} map[string]interface{}
+// @Router /files/{key} [get]
+func ServeFile(c *gin.Context) {
+	local, ok := storage.Default.(*storage.LocalStorage)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ruta no disponible con el almacenamiento actual"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if !local.VerifySignature(key, c.Query("expires"), c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "URL inválida o expirada"})
+		return
+	}
+
+	reader, err := local.Get(c.Request.Context(), key)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archivo no encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al leer el archivo"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, -1, contentTypeFor(key), reader, nil)
+}
+
+// ReceiveFile recibe subidas directas al almacenamiento local mediante URLs
+// generadas por PresignPut (equivalente local a una URL prefirmada de S3)
+// @Summary Subir archivo con URL firmada
+// @Description Recibe el contenido de una subida directa prefirmada
+// @Tags files
+// @Accept octet-stream
+// @Produce json
+// @Param key path string true "Clave del archivo"
+// @Param expires query int true "Expiración (unix)"
+// @Param signature query string true "Firma"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /files/{key} [put]
+func ReceiveFile(c *gin.Context) {
+	local, ok := storage.Default.(*storage.LocalStorage)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ruta no disponible con el almacenamiento actual"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	size := c.Request.ContentLength
+	contentType := c.GetHeader("Content-Type")
+	if size < 0 || !local.VerifySignature(key, c.Query("expires"), c.Query("signature"),
+		http.MethodPut, contentType, strconv.FormatInt(size, 10)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "URL inválida, expirada o cabeceras no coincidentes"})
+		return
+	}
+
+	if err := local.Put(c.Request.Context(), key, io.LimitReader(c.Request.Body, size), size, contentType); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar el archivo"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// contentTypeFor deduce el Content-Type a partir de la extensión de la clave
+func contentTypeFor(key string) string {
+	for contentType, ext := range avatarExtensions {
+		if strings.HasSuffix(key, ext) {
+			return contentType
+		}
+	}
+	switch {
+	case strings.HasSuffix(key, ".json"):
+		return "application/json"
+	case strings.HasSuffix(key, ".zip"):
+		return "application/zip"
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"api/graph"
+	"api/localtime"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/gin-gonic/gin"
+)
+
+// graphqlComplexityLimit coste máximo de una consulta (1 por campo solicitado)
+const graphqlComplexityLimit = 200
+
+var (
+	graphqlOnce   sync.Once
+	graphqlServer *handler.Server
+)
+
+// newGraphQLServer configura el servidor GraphQL. Se crea en la primera petición,
+// cuando ya se ha fijado el modo de Gin, para desactivar la introspección en release.
+func newGraphQLServer() *handler.Server {
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{}}))
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.SetQueryCache(lru.New(1000))
+
+	if gin.Mode() != gin.ReleaseMode {
+		srv.Use(extension.Introspection{})
+	}
+	srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New(100)})
+	srv.Use(extension.FixedComplexityLimit(graphqlComplexityLimit))
+	srv.AroundOperations(graph.RejectRestrictedMutations)
+	// Fechas en la zona horaria del cliente, como en REST
+	srv.AroundFields(func(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+		res, err := next(ctx)
+		switch t := res.(type) {
+		case time.Time:
+			res = t.In(localtime.FromContext(ctx))
+		case *time.Time:
+			if t != nil {
+				local := t.In(localtime.FromContext(ctx))
+				res = &local
+			}
+		}
+		return res, err
+	})
+	return srv
+}
+
+// GraphQL atiende las consultas GraphQL. La autenticación la resuelve el mismo
+// middleware que en REST; las operaciones que la requieren lo comprueban en el resolver.
+func GraphQL(c *gin.Context) {
+	graphqlOnce.Do(func() { graphqlServer = newGraphQLServer() })
+
+	identity := graph.Identity{
+		UserID: currentUserID(c), Role: c.GetString("userRole"),
+		APIKeyID: c.GetUint("apiKeyID"), OAuthClientID: c.GetUint("oauthClientID"),
+		Restricted: c.GetBool("restricted"),
+	}
+	ctx := graph.WithRequest(c.Request.Context(), identity, loginMeta(c))
+	name, loc := responseLocation(c)
+	ctx = localtime.WithLocation(ctx, loc)
+	c.Header(localtime.Header, name)
+	c.Writer.Header().Add("Vary", localtime.Header)
+	graphqlServer.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+}
+
+// GraphQLPlayground sirve el explorador interactivo de GraphQL
+func GraphQLPlayground(c *gin.Context) {
+	playground.Handler("GraphQL", "/graphql").ServeHTTP(c.Writer, c.Request)
+}
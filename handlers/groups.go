@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"api/database"
+	"api/normalize"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetGroups lista los grupos de una organización
+// @Summary Grupos de la organización
+// @Description Grupos de la organización con el rol que concede cada uno a sus miembros
+// @Tags orgs
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /orgs/{org}/groups [get]
+func GetGroups(c *gin.Context) {
+	list, err := services.ListGroups(c.Request.Context(), c.GetUint("orgID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los grupos"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"groups": list})
+}
+
+// CreateGroup crea un grupo en una organización
+// @Summary Crear grupo
+// @Description Crea un grupo (engineering, finance...) cuyos miembros reciben su rol en la organización además del suyo propio. Requiere el rol admin en ella
+// @Tags orgs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param group body CreateGroupRequest true "Identificador, nombre y rol"
+// @Success 201 {object} database.Group
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/groups [post]
+func CreateGroup(c *gin.Context) {
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = services.OrgRoleMember
+	}
+
+	group, err := services.CreateGroup(c.Request.Context(), c.GetUint("orgID"), req.Slug, req.Name, req.Role)
+	if respondOrgError(c, err, "Error al crear el grupo") {
+		return
+	}
+	writeJSON(c, http.StatusCreated, group)
+}
+
+// GetGroup devuelve un grupo con sus miembros
+// @Summary Obtener grupo
+// @Description Devuelve el grupo con sus miembros
+// @Tags orgs
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param group path string true "Identificador o ID del grupo"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /orgs/{org}/groups/{group} [get]
+func GetGroup(c *gin.Context) {
+	group, ok := groupFromPath(c)
+	if !ok {
+		return
+	}
+	members, err := services.ListGroupMembers(c.Request.Context(), group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los miembros del grupo"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"group": group, "members": members})
+}
+
+// UpdateGroup cambia el nombre o el rol de un grupo
+// @Summary Modificar grupo
+// @Description Cambia el nombre y/o el rol que concede el grupo. No se puede dejar a la organización sin administradores. Requiere el rol admin en ella
+// @Tags orgs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param group path string true "Identificador o ID del grupo"
+// @Param body body UpdateGroupRequest true "Nombre y/o rol"
+// @Success 200 {object} database.Group
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/groups/{group} [put]
+func UpdateGroup(c *gin.Context) {
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	group, ok := groupFromPath(c)
+	if !ok {
+		return
+	}
+
+	err := services.UpdateGroup(c.Request.Context(), group, req.Name, req.Role)
+	if respondOrgError(c, err, "Error al modificar el grupo") {
+		return
+	}
+	writeJSON(c, http.StatusOK, group)
+}
+
+// DeleteGroup elimina un grupo
+// @Summary Eliminar grupo
+// @Description Elimina el grupo; sus miembros siguen en la organización con su propio rol. Requiere el rol admin en ella
+// @Tags orgs
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param group path string true "Identificador o ID del grupo"
+// @Success 204
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/groups/{group} [delete]
+func DeleteGroup(c *gin.Context) {
+	group, ok := groupFromPath(c)
+	if !ok {
+		return
+	}
+	if respondOrgError(c, services.DeleteGroup(c.Request.Context(), group), "Error al eliminar el grupo") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AddGroupMember añade un miembro de la organización a un grupo
+// @Summary Añadir miembro a un grupo
+// @Description Añade al grupo a un miembro de la organización, que recibe el rol del grupo. Requiere el rol admin en ella
+// @Tags orgs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param group path string true "Identificador o ID del grupo"
+// @Param member body AddGroupMemberRequest true "ID del usuario"
+// @Success 201 {object} database.GroupMember
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/groups/{group}/members [post]
+func AddGroupMember(c *gin.Context) {
+	var req AddGroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	group, ok := groupFromPath(c)
+	if !ok {
+		return
+	}
+
+	member, err := services.AddGroupMember(c.Request.Context(), group, req.UserID)
+	if respondOrgError(c, err, "Error al añadir el miembro al grupo") {
+		return
+	}
+	writeJSON(c, http.StatusCreated, member)
+}
+
+// RemoveGroupMember saca a un usuario de un grupo
+// @Summary Quitar miembro de un grupo
+// @Description Saca al usuario del grupo; sigue en la organización con su propio rol. Requiere el rol admin en ella
+// @Tags orgs
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param group path string true "Identificador o ID del grupo"
+// @Param user_id path int true "ID del usuario"
+// @Success 204
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/groups/{group}/members/{user_id} [delete]
+func RemoveGroupMember(c *gin.Context) {
+	userID, ok := memberIDFromPath(c)
+	if !ok {
+		return
+	}
+	group, ok := groupFromPath(c)
+	if !ok {
+		return
+	}
+	if respondOrgError(c, services.RemoveGroupMember(c.Request.Context(), group, userID), "Error al quitar el miembro del grupo") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// groupFromPath busca el grupo :group en la organización de la ruta; si no
+// existe responde 404 y devuelve false
+func groupFromPath(c *gin.Context) (*database.Group, bool) {
+	group, err := services.FindGroup(c.Request.Context(), c.GetUint("orgID"), c.Param("group"))
+	if errors.Is(err, services.ErrGroupNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el grupo"})
+		return nil, false
+	}
+	return group, true
+}
+
+// CreateGroupRequest estructura para crear un grupo
+type CreateGroupRequest struct {
+	// Minúsculas, dígitos y -, empezando por una letra
+	Slug string `json:"slug" binding:"required" example:"engineering"`
+	Name string `json:"name" binding:"required,max=100" example:"Ingeniería"`
+	// Rol en la organización que reciben sus miembros (por defecto member)
+	Role string `json:"role" binding:"omitempty,oneof=admin member"`
+}
+
+// UpdateGroupRequest estructura para modificar un grupo
+type UpdateGroupRequest struct {
+	Name string `json:"name" binding:"max=100"`
+	Role string `json:"role" binding:"omitempty,oneof=admin member"`
+}
+
+// AddGroupMemberRequest estructura para añadir un miembro a un grupo
+type AddGroupMemberRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+func (r *CreateGroupRequest) Normalize() {
+	r.Slug = normalize.Text(r.Slug)
+	r.Name = normalize.Name(r.Name)
+}
+
+func (r *UpdateGroupRequest) Normalize() {
+	r.Name = normalize.Name(r.Name)
+}
@@ -1,40 +1,75 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
-	"strconv"
 
+	"api/auth"
+	"api/breaker"
+	"api/clock"
 	"api/database"
+	"api/health"
+	"api/normalize"
+	"api/services"
+	"api/terms"
+	// Reglas propias de las etiquetas binding (strong_password, not_disposable...)
+	_ "api/validation"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // HealthCheck verifica el estado de la API
 // @Summary Verificar estado de la API
-// @Description Verifica que la API esté funcionando correctamente
+// @Description Verifica que la API esté funcionando correctamente. Con verbose=1 (solo administradores) comprueba además cada dependencia (base de datos, migraciones, Redis, correo, almacenamiento, búsqueda, PDF, Stripe) con su estado, latencia y último error, y responde 503 si alguna falla
 // @Tags health
 // @Accept json
 // @Produce json
+// @Param verbose query string false "1 para el diagnóstico de cada dependencia (requiere un administrador)"
 // @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
 // @Router /health [get]
 func HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"status":  "OK",
 		"message": "API funcionando correctamente",
 		"version": "1.0.0",
-	})
+	}
+	if verbose := c.Query("verbose"); verbose != "1" && verbose != "true" {
+		writeJSON(c, http.StatusOK, response)
+		return
+	}
+
+	// VerboseHealthMiddleware ya ha autenticado la petición
+	if c.GetString("userRole") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Acceso restringido a administradores"})
+		return
+	}
+	checks, healthy := health.Run(c.Request.Context())
+	response["checks"] = checks
+	status := http.StatusOK
+	if !healthy {
+		response["status"] = "DEGRADED"
+		response["message"] = "Alguna dependencia no responde"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(c, status, response)
 }
 
 // Register registra un nuevo usuario
 // @Summary Registrar nuevo usuario
-// @Description Crea una nueva cuenta de usuario
+// @Description Crea una nueva cuenta de usuario. La contraseña debe tener entre 8 y 72 caracteres con minúscula, mayúscula y dígito y, con PWNED_PASSWORDS activo, no aparecer en filtraciones conocidas (Have I Been Pwned); no se admiten emails de dominios desechables
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param user body RegisterRequest true "Datos del usuario"
+// @Param X-Captcha-Token header string false "Token del CAPTCHA (si CAPTCHA_PROVIDER está configurado)"
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
 // @Router /auth/register [post]
 func Register(c *gin.Context) {
 	var req RegisterRequest
@@ -43,35 +78,36 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Verificar si el usuario ya existe
-	var existingUser database.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "El email ya está registrado"})
+	if err := services.CheckCaptcha(c.Request.Context(), services.CaptchaRegister, req.Email, loginMeta(c)); err != nil {
+		if !captchaError(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear el usuario"})
+		}
 		return
 	}
 
-	// Encriptar contraseña
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar la contraseña"})
+	user, err := services.RegisterUser(c.Request.Context(), req.Email, req.Password, req.Name)
+	if errors.Is(err, services.ErrEmailTaken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El email ya está registrado"})
 		return
 	}
-
-	// Crear usuario
-	user := database.User{
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		Name:     req.Name,
-		Role:     "user",
-		IsActive: true,
+	if errors.Is(err, services.ErrUserLimitReached) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "La organización ha alcanzado su máximo de usuarios"})
+		return
 	}
-
-	if err := database.DB.Create(&user).Error; err != nil {
+	if errors.Is(err, services.ErrPwnedPassword) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La contraseña aparece en filtraciones de datos conocidas; elige otra"})
+		return
+	}
+	if errors.Is(err, services.ErrPasswordCheckUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No se pudo comprobar la contraseña, inténtalo más tarde"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear el usuario"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
+	writeJSON(c, http.StatusCreated, gin.H{
 		"message": "Usuario creado exitosamente",
 		"user": gin.H{
 			"id":    user.ID,
@@ -84,13 +120,19 @@ func Register(c *gin.Context) {
 
 // Login autentica un usuario
 // @Summary Iniciar sesión
-// @Description Autentica un usuario y devuelve un token
+// @Description Autentica un usuario y devuelve un token. Si se supera el máximo de sesiones del rol se cierran las más antiguas (terminated_sessions) o se responde 409 según SESSION_LIMIT_POLICY. Con X-Token-Delivery: cookie (clientes de navegador) el token dura solo COOKIE_ACCESS_TOKEN_TTL (expires_in) y se renueva con POST /auth/refresh gracias al token de renovación que llega en la cookie HttpOnly refresh_token
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param credentials body LoginRequest true "Credenciales de login"
+// @Param X-Captcha-Token header string false "Token del CAPTCHA, exigido tras varios intentos fallidos"
+// @Param X-Token-Delivery header string false "cookie para recibir el token de renovación en una cookie HttpOnly"
 // @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
 // @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
 // @Router /auth/login [post]
 func Login(c *gin.Context) {
 	var req LoginRequest
@@ -99,80 +141,299 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Buscar usuario
-	var user database.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Credenciales inválidas"})
+	result, err := services.Authenticate(c.Request.Context(), req.Email, req.Password, loginMeta(c))
+	if captchaError(c, err) || rejectedLogin(c, result, err) {
 		return
 	}
+	loginResponse(c, result, err)
+}
 
-	// Verificar contraseña
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+// rejectedLogin responde a los inicios de sesión rechazados o pendientes de
+// verificación; devuelve false si el error es de los que trata loginResponse
+func rejectedLogin(c *gin.Context, result *services.LoginResult, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Credenciales inválidas"})
+	case errors.Is(err, services.ErrStepUpRequired):
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":            "Inicio de sesión inusual: introduce el código que te hemos enviado por correo",
+			"step_up_required": true,
+			"challenge_id":     result.ChallengeID,
+		})
+	case errors.Is(err, services.ErrLoginBlocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Inicio de sesión bloqueado por actividad sospechosa"})
+	default:
+		return false
+	}
+	return true
+}
+
+// VerifyLogin completa un inicio de sesión pendiente de verificación
+// @Summary Verificar inicio de sesión
+// @Description Completa con el código enviado por correo un inicio de sesión que la puntuación de riesgo marcó como inusual (respuesta con step_up_required). Con remember_device el dispositivo queda como de confianza: la respuesta incluye device_token (también en la cookie device_trust) y, enviándolo en X-Device-Token, los siguientes inicios de sesión desde él no piden el código.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param verification body VerifyLoginRequest true "Verificación y código"
+// @Param X-Token-Delivery header string false "cookie para recibir el token de renovación en una cookie HttpOnly"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /auth/login/verify [post]
+func VerifyLogin(c *gin.Context) {
+	var req VerifyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Generar token JWT (simulado por ahora)
-	token := "jwt_token_simulado_" + strconv.FormatUint(uint64(user.ID), 10)
+	result, err := services.CompleteChallenge(c.Request.Context(), req.ChallengeID, req.Code, req.RememberDevice, loginMeta(c))
+	if errors.Is(err, services.ErrInvalidChallenge) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Código incorrecto o caducado"})
+		return
+	}
+	loginResponse(c, result, err)
+}
 
-	c.JSON(http.StatusOK, gin.H{
+// loginResponse responde a un inicio de sesión completado con el token o con
+// los errores comunes a Login y VerifyLogin
+func loginResponse(c *gin.Context, result *services.LoginResult, err error) {
+	switch {
+	case errors.Is(err, services.ErrPendingDeletion):
+		c.JSON(http.StatusForbidden, gin.H{"error": "La cuenta está en proceso de eliminación"})
+		return
+	case errors.Is(err, services.ErrAccountDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": "La cuenta está desactivada"})
+		return
+	case errors.Is(err, services.ErrMaintenance):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Servicio en mantenimiento"})
+		return
+	case errors.Is(err, breaker.ErrOpen):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "El proveedor externo no está disponible, inténtalo más tarde"})
+		return
+	case errors.Is(err, services.ErrTooManySessions):
+		c.JSON(http.StatusConflict, gin.H{"error": "Has alcanzado el máximo de sesiones abiertas; cierra alguna antes de iniciar otra"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al iniciar sesión"})
+		return
+	}
+
+	user := result.User
+	response := gin.H{
 		"message": "Login exitoso",
-		"token":   token,
+		"token":   result.Token,
 		"user": gin.H{
 			"id":    user.ID,
 			"email": user.Email,
 			"name":  user.Name,
 			"role":  user.Role,
 		},
-	})
+	}
+	if result.DeletionCancelled {
+		response["deletion_cancelled"] = true
+	}
+	if result.Suspension != nil {
+		// Solo sirve para consultar la suspensión y apelarla; el resto de rutas responde 403
+		response["suspension"] = result.Suspension
+	}
+	if user.RestrictedAt != nil {
+		// Puede consultar, pero las peticiones que modifican algo responden 403
+		response["restricted"] = true
+	}
+	if result.PasswordChangeRequired {
+		// Hasta cambiarla (POST /profile/password) el resto de rutas responde 403
+		response["password_change_required"] = true
+	}
+	if result.TermsPending {
+		// Hasta aceptarlos (POST /profile/terms) el resto de rutas responde 403
+		response["terms_required"] = true
+		response["terms"] = terms.Current()
+	}
+	if len(result.TerminatedSessions) > 0 {
+		terminated := make([]gin.H, 0, len(result.TerminatedSessions))
+		for _, s := range result.TerminatedSessions {
+			terminated = append(terminated, gin.H{"id": s.ID, "ip": s.IP, "country": s.Country, "created_at": s.CreatedAt})
+		}
+		response["terminated_sessions"] = terminated
+	}
+	if result.RefreshToken != "" {
+		response["expires_in"] = int(services.CookieAccessTokenTTL().Seconds())
+		setRefreshCookie(c, result.RefreshToken, int(result.RefreshExpiresAt.Sub(clock.Now()).Seconds()))
+	}
+	if result.DeviceToken != "" {
+		response["device_token"] = result.DeviceToken
+		response["device_trusted_until"] = result.DeviceTrustedUntil
+		c.SetSameSite(http.SameSiteStrictMode)
+		c.SetCookie(deviceTrustCookie, result.DeviceToken, int(services.TrustedDeviceDuration().Seconds()),
+			"/api", "", gin.Mode() == gin.ReleaseMode, true)
+	}
+
+	writeJSON(c, http.StatusOK, response)
+}
+
+// RefreshWithCookie atiende POST /auth/refresh cuando la petición trae la
+// cookie de renovación, sin exigir un token de acceso vigente; sin ella sigue
+// la cadena (AuthMiddleware y RefreshToken)
+func RefreshWithCookie(c *gin.Context) {
+	refresh, err := c.Cookie(refreshCookie)
+	if err != nil || refresh == "" {
+		c.Next()
+		return
+	}
+	c.Abort()
+
+	c.Header("Cache-Control", "no-store")
+	result, err := services.RefreshSession(c.Request.Context(), refresh)
+	switch {
+	case errors.Is(err, services.ErrInvalidRefreshToken), errors.Is(err, services.ErrSessionRevoked),
+		errors.Is(err, services.ErrSessionExpired), errors.Is(err, services.ErrInactiveUser):
+		setRefreshCookie(c, "", -1)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "La sesión se ha cerrado"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al renovar el token"})
+	default:
+		setRefreshCookie(c, result.RefreshToken, int(result.RefreshExpiresAt.Sub(clock.Now()).Seconds()))
+		writeJSON(c, http.StatusOK, gin.H{"token": result.Token, "expires_in": result.ExpiresIn})
+	}
+}
+
+// RefreshToken renueva el token con los permisos actuales
+// @Summary Renovar token
+// @Description Emite para la misma sesión un token con el rol y los permisos actuales del usuario. Los tokens incluyen los permisos con que se emitieron (perms) y su versión (perm_version); cuando cambian (rol, organizaciones, grupos o políticas) las respuestas llevan X-Permissions-Stale: true y el token sigue valiendo, pero se autoriza consultando las políticas hasta que se renueva. La sesión y la caducidad no cambian. Las sesiones iniciadas con X-Token-Delivery: cookie se renuevan con la cookie refresh_token, aunque el token haya caducado: la respuesta trae un token nuevo (expires_in) y la cookie se sustituye; volver a presentar una ya sustituida cierra la sesión
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /auth/refresh [post]
+func RefreshToken(c *gin.Context) {
+	value, _ := c.Get("claims")
+	claims, _ := value.(*auth.Claims)
+	if claims == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Solo se pueden renovar los tokens de sesión"})
+		return
+	}
+
+	token, err := services.RefreshToken(c.Request.Context(), claims)
+	switch {
+	case errors.Is(err, services.ErrInactiveUser):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario inactivo o eliminado"})
+	case errors.Is(err, services.ErrWrongTenant):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "El token pertenece a otro tenant"})
+	case errors.Is(err, services.ErrSessionRevoked), errors.Is(err, services.ErrSessionExpired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "La sesión se ha cerrado"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al renovar el token"})
+	default:
+		writeJSON(c, http.StatusOK, gin.H{"token": token})
+	}
 }
 
 // GetUsers obtiene todos los usuarios
 // @Summary Obtener usuarios
-// @Description Obtiene la lista de todos los usuarios
+// @Description Obtiene la lista de todos los usuarios (en v2 paginada: {"data": [...], "meta": {...}}). Con Accept: application/x-ndjson se envían todos en streaming, uno por línea, y con stream=true como un array JSON por partes.
 // @Tags users
 // @Accept json
-// @Produce json
+// @Produce json,application/x-ndjson
 // @Security BearerAuth
+// @Param page query int false "Página (solo v2)"
+// @Param per_page query int false "Resultados por página, máximo 100 (solo v2)"
+// @Param exact_count query bool false "Contar el total exacto en lugar de estimarlo en tablas grandes (solo v2)"
+// @Param include query string false "Relaciones que añadir a cada usuario en included, separadas por comas: plan, posts (sus últimos posts públicos) y, para administradores, profile, identities y tags"
+// @Param tag query string false "Solo los usuarios con todas estas etiquetas, separadas por comas (solo administradores)"
+// @Param stream query bool false "Enviar todos los usuarios en streaming como un array JSON"
 // @Success 200 {array} database.User
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Router /users [get]
 func GetUsers(c *gin.Context) {
-	var users []database.User
-	if err := database.DB.Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener usuarios"})
+	filter, ok := userFilter(c)
+	if !ok {
 		return
 	}
 
-	// Ocultar contraseñas
-	for i := range users {
-		users[i].Password = ""
+	// En streaming se envían todos los usuarios sin paginar
+	if format := streamFormat(c); format != "" {
+		err := services.StreamUsers(c.Request.Context(), filter, func(rows *sql.Rows) error {
+			streamRows(c, format, rows, func(user *database.User) interface{} {
+				user.Password = ""
+				return linkUser(c, user)
+			})
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener usuarios"})
+		}
+		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	page := pagination(c)
+	offset, limit := 0, 0
+	if apiVersion(c) >= 2 {
+		offset, limit = page.Offset(), page.PerPage
+	}
+
+	users, total, err := services.ListUsers(countContext(c), filter, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener usuarios"})
+		return
+	}
+
+	if apiVersion(c) >= 2 {
+		if respondJSONAPI(c, http.StatusOK, users, pageMeta(page, total), pageLinks(c, page, total.Count)) {
+			return
+		}
+		list := withUserLinks(c, users)
+		if !includeUsers(c, list) {
+			return
+		}
+		response := paginated(list, page, total)
+		response["links"] = pageLinks(c, page, total.Count)
+		writeJSON(c, http.StatusOK, response)
+		return
+	}
+	if respondJSONAPI(c, http.StatusOK, users, nil, nil) {
+		return
+	}
+	list := withUserLinks(c, users)
+	if !includeUsers(c, list) {
+		return
+	}
+	writeJSON(c, http.StatusOK, list)
 }
 
 // GetUser obtiene un usuario específico
 // @Summary Obtener usuario
-// @Description Obtiene un usuario por su ID
+// @Description Obtiene un usuario por su ID: la cuenta propia o, para administradores, cualquiera
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param id path int true "ID del usuario"
+// @Param include query string false "Relaciones que añadir en included, separadas por comas: plan, posts (sus últimos posts públicos) y, para administradores, profile e identities"
 // @Success 200 {object} database.User
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Router /users/{id} [get]
 func GetUser(c *gin.Context) {
-	id := c.Param("id")
-	var user database.User
-
-	if err := database.DB.First(&user, id).Error; err != nil {
+	user, err := services.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
 
-	user.Password = ""
-	c.JSON(http.StatusOK, user)
+	if respondJSONAPI(c, http.StatusOK, user, nil, nil) {
+		return
+	}
+	list := []linkedUser{linkUser(c, user)}
+	if !includeUsers(c, list) {
+		return
+	}
+	writeJSON(c, http.StatusOK, list[0])
 }
 
 // UpdateUser actualiza un usuario
@@ -185,40 +446,52 @@ func GetUser(c *gin.Context) {
 // @Param id path int true "ID del usuario"
 // @Param user body UpdateUserRequest true "Datos a actualizar"
 // @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
 // @Router /users/{id} [put]
 func UpdateUser(c *gin.Context) {
-	id := c.Param("id")
 	var req UpdateUserRequest
-
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var user database.User
-	if err := database.DB.First(&user, id).Error; err != nil {
+	user, err := services.UpdateUser(c.Request.Context(), currentIdentity(c), c.Param("id"), services.UserChanges{
+		Name: req.Name, Email: req.Email, Username: req.Username, LoginAlertsDisabled: req.LoginAlertsDisabled,
+		Timezone: req.Timezone, Locale: req.Locale,
+	})
+	if errors.Is(err, services.ErrUserNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-
-	// Actualizar campos
-	if req.Name != "" {
-		user.Name = req.Name
+	if errors.Is(err, services.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para modificar este usuario"})
+		return
 	}
-	if req.Email != "" {
-		user.Email = req.Email
+	if errors.Is(err, services.ErrEmailChangeForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "El email solo se puede cambiar desde una sesión iniciada"})
+		return
 	}
-
-	if err := database.DB.Save(&user).Error; err != nil {
+	if errors.Is(err, services.ErrUsernameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "El nombre de usuario no está disponible"})
+		return
+	}
+	if errors.Is(err, services.ErrEmailTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "El email ya está registrado"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar usuario"})
 		return
 	}
 
-	user.Password = ""
-	c.JSON(http.StatusOK, gin.H{
+	if respondJSONAPI(c, http.StatusOK, user, nil, nil) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{
 		"message": "Usuario actualizado exitosamente",
-		"user":    user,
+		"user":    linkUser(c, user),
 	})
 }
 
@@ -231,52 +504,31 @@ func UpdateUser(c *gin.Context) {
 // @Security BearerAuth
 // @Param id path int true "ID del usuario"
 // @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
 // @Router /users/{id} [delete]
 func DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	var user database.User
-
-	if err := database.DB.First(&user, id).Error; err != nil {
+	err := services.DeleteUser(c.Request.Context(), currentIdentity(c), c.Param("id"))
+	if errors.Is(err, services.ErrUserNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
 		return
 	}
-
-	if err := database.DB.Delete(&user).Error; err != nil {
+	if errors.Is(err, services.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No tienes permiso para eliminar este usuario"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar usuario"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Usuario eliminado exitosamente"})
-}
-
-// GetProfile obtiene el perfil del usuario autenticado
-// @Summary Obtener perfil
-// @Description Obtiene el perfil del usuario autenticado
-// @Tags profile
-// @Accept json
-// @Produce json
-// @Security BearerAuth
-// @Success 200 {object} database.User
-// @Router /profile [get]
-func GetProfile(c *gin.Context) {
-	// Por simplicidad, devolvemos un perfil de ejemplo
-	// En una implementación real, obtendrías el usuario del token JWT
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Perfil del usuario",
-		"profile": gin.H{
-			"id":    1,
-			"email": "usuario@ejemplo.com",
-			"name":  "Usuario Ejemplo",
-			"role":  "user",
-		},
-	})
+	writeJSON(c, http.StatusOK, gin.H{"message": "Usuario eliminado exitosamente"})
 }
 
 // Estructuras para las peticiones
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Email    string `json:"email" binding:"required,email,not_disposable"`
+	Password string `json:"password" binding:"required,strong_password"`
 	Name     string `json:"name" binding:"required"`
 }
 
@@ -285,7 +537,51 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// VerifyLoginRequest código de un inicio de sesión pendiente de verificación
+type VerifyLoginRequest struct {
+	ChallengeID string `json:"challenge_id" binding:"required"`
+	Code        string `json:"code" binding:"required" example:"123456"`
+	// Recordar este dispositivo y no volver a pedir el código en él
+	RememberDevice bool `json:"remember_device"`
+}
+
 type UpdateUserRequest struct {
 	Name  string `json:"name"`
-	Email string `json:"email" binding:"omitempty,email"`
+	Email string `json:"email" binding:"omitempty,email,not_disposable"`
+	// Nombre de usuario público (3-32 caracteres: minúsculas, dígitos, punto, guion y guion bajo)
+	Username *string `json:"username" binding:"omitempty,username" example:"ana.garcia"`
+	// Desactiva los avisos de inicio de sesión desde dispositivos o países nuevos
+	// (no se aplica a los administradores)
+	LoginAlertsDisabled *bool `json:"login_alerts_disabled"`
+	// Zona horaria IANA en la que se presentan las fechas ("" = UTC)
+	Timezone *string `json:"timezone" binding:"omitempty,timezone" example:"Europe/Madrid"`
+	// Idioma preferido como etiqueta BCP 47 ("" = idioma por defecto)
+	Locale *string `json:"locale" binding:"omitempty,bcp47_language_tag" example:"es-ES"`
+}
+
+// Normalize se aplica al hacer binding, antes de validar (ver paquete normalize)
+func (r *RegisterRequest) Normalize() {
+	r.Email = normalize.Email(r.Email)
+	r.Name = normalize.Name(r.Name)
+}
+
+func (r *LoginRequest) Normalize() {
+	r.Email = normalize.Email(r.Email)
+}
+
+func (r *UpdateUserRequest) Normalize() {
+	r.Email = normalize.Email(r.Email)
+	r.Name = normalize.Name(r.Name)
+	if r.Username != nil {
+		username := normalize.Username(*r.Username)
+		r.Username = &username
+	}
+	if r.Timezone != nil {
+		timezone := normalize.Text(*r.Timezone)
+		r.Timezone = &timezone
+	}
+	if r.Locale != nil {
+		locale := normalize.Text(*r.Locale)
+		r.Locale = &locale
+	}
 }
@@ -0,0 +1,3194 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api/apitest"
+	"api/auth"
+	"api/authz"
+	"api/backup"
+	"api/branding"
+	"api/breaker"
+	"api/clock"
+	"api/database"
+	"api/geoip"
+	"api/handlers"
+	"api/health"
+	"api/jobs"
+	"api/mail"
+	"api/maintenance"
+	"api/oauth"
+	"api/reports"
+	"api/search"
+	"api/services"
+	"api/storage"
+	"api/terms"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	srv := apitest.New(t)
+
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", map[string]string{
+		"email": "ana@example.com", "password": "Secreto123", "name": "Ana",
+	}).Expect(t, http.StatusCreated)
+	// El email se normaliza: con otras mayúsculas o espacios es el mismo
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", map[string]string{
+		"email": " Ana@Example.COM ", "password": "Secreto123", "name": "Ana",
+	}).Expect(t, http.StatusBadRequest)
+
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", map[string]string{
+		"email": "debil@example.com", "password": "secret123", "name": "Débil",
+	}).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", map[string]string{
+		"email": "ana@mailinator.com", "password": "Secreto123", "name": "Ana",
+	}).Expect(t, http.StatusBadRequest)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{
+		"email": "ANA@example.com", "password": "Secreto123",
+	}).Expect(t, http.StatusOK).JSON(t, &login)
+	if login.Token == "" {
+		t.Fatal("el login no devolvió token")
+	}
+
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{
+		"email": "ana@example.com", "password": "incorrecta",
+	}).Expect(t, http.StatusUnauthorized)
+}
+
+func TestUserAccess(t *testing.T) {
+	srv := apitest.New(t)
+	owner := srv.CreateUser(t, "user")
+	other := srv.CreateUser(t, "user")
+	admin := srv.CreateUser(t, "admin")
+	path := "/api/v1/users/" + itoa(owner.ID)
+
+	tests := []struct {
+		name   string
+		method string
+		opts   []apitest.RequestOption
+		body   interface{}
+		want   int
+	}{
+		{"sin token", http.MethodGet, nil, nil, http.StatusUnauthorized},
+		{"token inválido", http.MethodGet, []apitest.RequestOption{apitest.WithToken("x.y.z")}, nil, http.StatusUnauthorized},
+		{"leer", http.MethodGet, []apitest.RequestOption{apitest.WithToken(owner.Token)}, nil, http.StatusOK},
+		{"leer otro usuario", http.MethodGet, []apitest.RequestOption{apitest.WithToken(other.Token)}, nil, http.StatusForbidden},
+		{"admin lee", http.MethodGet, []apitest.RequestOption{apitest.WithToken(admin.Token)}, nil, http.StatusOK},
+		{"modificar otro usuario", http.MethodPut, []apitest.RequestOption{apitest.WithToken(other.Token)}, map[string]string{"name": "X"}, http.StatusForbidden},
+		{"modificarse a sí mismo", http.MethodPut, []apitest.RequestOption{apitest.WithToken(owner.Token)}, map[string]string{"name": "Nuevo"}, http.StatusOK},
+		{"admin modifica", http.MethodPut, []apitest.RequestOption{apitest.WithToken(admin.Token)}, map[string]string{"name": "Admin"}, http.StatusOK},
+		{"borrar otro usuario", http.MethodDelete, []apitest.RequestOption{apitest.WithToken(other.Token)}, nil, http.StatusForbidden},
+		{"email de otro usuario", http.MethodPut, []apitest.RequestOption{apitest.WithToken(owner.Token)}, map[string]string{"email": strings.ToUpper(other.Email)}, http.StatusConflict},
+		{"su propio email", http.MethodPut, []apitest.RequestOption{apitest.WithToken(owner.Token)}, map[string]string{"email": owner.Email}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.Do(t, tt.method, path, tt.body, tt.opts...).Expect(t, tt.want)
+		})
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/users/999999", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, "/api/v1/users/yo", nil, apitest.WithToken(owner.Token)).Expect(t, http.StatusNotFound)
+	// La comprobación de propiedad también protege las peticiones dentro de un lote
+	var batch struct {
+		Responses []struct {
+			Status int `json:"status"`
+		} `json:"responses"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/batch", map[string]interface{}{
+		"requests": []map[string]interface{}{{"method": "GET", "path": "/api/v1/users/" + itoa(owner.ID)}},
+	}, apitest.WithToken(other.Token)).Expect(t, http.StatusOK).JSON(t, &batch)
+	if len(batch.Responses) != 1 || batch.Responses[0].Status != http.StatusForbidden {
+		t.Errorf("lote = %+v", batch.Responses)
+	}
+}
+
+func TestUserHistory(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	path := "/api/v1/users/" + itoa(user.ID)
+	asAdmin := apitest.WithToken(admin.Token)
+
+	// Los cambios del propio usuario no se registran
+	srv.Do(t, http.MethodPut, path, map[string]string{"name": "Elegido"}, apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, path, map[string]string{"name": "Impuesto", "timezone": "Europe/Madrid"}, asAdmin).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, "/api/v1/admin/users/"+itoa(user.ID)+"/plan", map[string]string{"plan": "pro"}, asAdmin).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, path, nil, asAdmin).Expect(t, http.StatusOK)
+
+	type change struct {
+		Field  string  `json:"field"`
+		Before *string `json:"before"`
+		After  *string `json:"after"`
+	}
+	var history struct {
+		Data []struct {
+			Action string `json:"action"`
+			Actor  struct {
+				Email string `json:"email"`
+			} `json:"actor"`
+			Changes []change `json:"changes"`
+		} `json:"data"`
+		Meta struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+	}
+	// La cuenta eliminada conserva su historial
+	srv.Do(t, http.MethodGet, "/api/v1/admin/users/"+itoa(user.ID)+"/history", nil, asAdmin).
+		Expect(t, http.StatusOK).JSON(t, &history)
+	if history.Meta.Total != 3 || len(history.Data) != 3 {
+		t.Fatalf("historial = %+v", history)
+	}
+	actions := []string{}
+	for _, entry := range history.Data {
+		actions = append(actions, entry.Action)
+		if entry.Actor.Email != admin.Email {
+			t.Errorf("%s: administrador = %q, se esperaba %s", entry.Action, entry.Actor.Email, admin.Email)
+		}
+	}
+	if strings.Join(actions, ",") != "delete,plan,update" {
+		t.Errorf("acciones = %v", actions)
+	}
+	update := history.Data[2].Changes
+	if len(update) != 2 || update[0].Field != "name" || *update[0].Before != "Elegido" || *update[0].After != "Impuesto" ||
+		update[1].Field != "timezone" || *update[1].Before != "" || *update[1].After != "Europe/Madrid" {
+		t.Errorf("cambios de la modificación = %+v", update)
+	}
+	if plan := history.Data[1].Changes; len(plan) != 1 || plan[0].Field != "plan_code" || *plan[0].After != "pro" {
+		t.Errorf("cambios del plan = %+v", plan)
+	}
+	if deleted := history.Data[0].Changes; len(deleted) != 1 || deleted[0].Field != "deleted_at" || deleted[0].Before != nil {
+		t.Errorf("cambios de la eliminación = %+v", deleted)
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/admin/users/"+itoa(user.ID)+"/history", nil, apitest.WithToken(srv.CreateUser(t, "").Token)).
+		Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/users/999999/history", nil, asAdmin).Expect(t, http.StatusNotFound)
+}
+
+func TestExportUsers(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(user.ID), map[string]string{"name": "=HYPERLINK(\"x\")"}, apitest.WithToken(user.Token)).
+		Expect(t, http.StatusOK)
+
+	res := srv.Do(t, http.MethodGet, "/api/v1/admin/users/export.csv", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusOK)
+	if ct := res.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != "id,email,name,username,role,is_active,plan,created_at,last_activity_at" {
+		t.Fatalf("CSV = %v", records)
+	}
+	if records[1][0] != itoa(admin.ID) || records[1][4] != "admin" {
+		t.Errorf("primera fila = %v", records[1])
+	}
+	// Los textos que empiezan como una fórmula no se evalúan al abrir el fichero
+	if records[2][2] != `'=HYPERLINK("x")` || records[2][5] != "true" || records[2][6] != "free" {
+		t.Errorf("segunda fila = %v", records[2])
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/admin/users/export.csv", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+}
+
+func TestStreamUsers(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	other := srv.CreateUser(t, "")
+
+	res := srv.Do(t, http.MethodGet, "/api/v2/users", nil, apitest.WithToken(user.Token),
+		apitest.WithHeader("Accept", "application/x-ndjson"), apitest.WithHeader("X-Timezone", "Europe/Madrid")).Expect(t, http.StatusOK)
+	if ct := res.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(res.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("NDJSON = %q", res.Body.String())
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	// Sin paginar, con los enlaces de cada usuario, sin contraseña y con las
+	// fechas en la zona horaria del cliente
+	if first["ID"] != float64(user.ID) || first["password"] != "" || first["links"] == nil ||
+		strings.HasSuffix(first["CreatedAt"].(string), "Z") || res.Header().Get("X-Timezone") != "Europe/Madrid" {
+		t.Errorf("primera línea = %v", first)
+	}
+
+	var users []map[string]interface{}
+	srv.Do(t, http.MethodGet, "/api/v1/users?stream=true", nil, apitest.WithToken(user.Token)).
+		Expect(t, http.StatusOK).JSON(t, &users)
+	if len(users) != 2 || users[1]["ID"] != float64(other.ID) {
+		t.Errorf("array = %v", users)
+	}
+}
+
+func TestEstimatedCount(t *testing.T) {
+	t.Setenv("COUNT_ESTIMATE_THRESHOLD", "2")
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	srv.CreateUser(t, "")
+
+	type meta struct {
+		Total          int64 `json:"total"`
+		TotalEstimated bool  `json:"total_estimated"`
+	}
+	list := func(query string) meta {
+		var res struct {
+			Meta meta `json:"meta"`
+		}
+		srv.Do(t, http.MethodGet, "/api/v2/users"+query, nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK).JSON(t, &res)
+		return res.Meta
+	}
+
+	// El primer total se cuenta; los siguientes reutilizan el guardado aunque haya cambiado
+	if got := list(""); got.Total != 2 || got.TotalEstimated {
+		t.Errorf("primer listado: meta = %+v", got)
+	}
+	srv.CreateUser(t, "")
+	if got := list(""); got.Total != 2 || !got.TotalEstimated {
+		t.Errorf("listado estimado: meta = %+v", got)
+	}
+	if got := list("?exact_count=true"); got.Total != 3 || got.TotalEstimated {
+		t.Errorf("exact_count=true: meta = %+v", got)
+	}
+}
+
+// reportSheets genera el informe y devuelve el XML de cada hoja del libro
+func reportSheets(t *testing.T, srv *apitest.Server, token, reportType string) []string {
+	t.Helper()
+	var report database.Report
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": reportType}, apitest.WithToken(token)).
+		Expect(t, http.StatusAccepted).JSON(t, &report)
+	if err := reports.Process(context.Background(), []byte(`{"report_id":"`+report.ID+`"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var status struct {
+		Report      database.Report `json:"report"`
+		DownloadURL string          `json:"download_url"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/reports/"+report.ID, nil, apitest.WithToken(token)).
+		Expect(t, http.StatusOK).JSON(t, &status)
+	if status.Report.Status != "ready" || status.DownloadURL == "" || status.Report.Size == 0 {
+		t.Fatalf("informe = %+v", status)
+	}
+
+	f, err := storage.Default.Get(context.Background(), "reports/"+reportType+"-"+report.ID+".xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheets []string
+	for i := 1; ; i++ {
+		sheet, err := zr.Open(fmt.Sprintf("xl/worksheets/sheet%d.xml", i))
+		if err != nil {
+			return sheets
+		}
+		content, _ := io.ReadAll(sheet)
+		sheet.Close()
+		sheets = append(sheets, string(content))
+	}
+}
+
+func TestReports(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	asAdmin := apitest.WithToken(admin.Token)
+
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "facturas"}, asAdmin).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "users"}, apitest.WithToken(user.Token)).
+		Expect(t, http.StatusForbidden)
+
+	// Mientras uno está pendiente no se puede pedir otro del mismo tipo
+	var pending database.Report
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "users"}, asAdmin).
+		Expect(t, http.StatusAccepted).JSON(t, &pending)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "users"}, asAdmin).Expect(t, http.StatusConflict)
+	var status struct {
+		Report      database.Report `json:"report"`
+		DownloadURL string          `json:"download_url"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/reports/"+pending.ID, nil, asAdmin).Expect(t, http.StatusOK).JSON(t, &status)
+	if status.Report.Status != "pending" || status.DownloadURL != "" {
+		t.Errorf("informe pendiente = %+v", status)
+	}
+	database.DB.Delete(&pending)
+
+	sheets := reportSheets(t, srv, admin.Token, "users")
+	if len(sheets) != 1 || !strings.Contains(sheets[0], admin.Email) || !strings.Contains(sheets[0], user.Email) {
+		t.Errorf("hoja de usuarios = %v", sheets)
+	}
+
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(user.ID), map[string]string{"name": "Cambiado por el admin"}, asAdmin).
+		Expect(t, http.StatusOK)
+	sheets = reportSheets(t, srv, admin.Token, "audit")
+	if len(sheets) != 2 {
+		t.Fatalf("el informe de auditoría tiene %d hojas, se esperaban 2", len(sheets))
+	}
+	if !strings.Contains(sheets[0], "Cambiado por el admin") {
+		t.Errorf("hoja de cambios = %s", sheets[0])
+	}
+	if !strings.Contains(sheets[1], "Agente de usuario") {
+		t.Errorf("hoja de inicios de sesión = %s", sheets[1])
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/admin/reports/no-existe", nil, asAdmin).Expect(t, http.StatusNotFound)
+}
+
+// fakeRenderer conversor a PDF que guarda el HTML recibido
+type fakeRenderer struct{ html string }
+
+func (f *fakeRenderer) Render(ctx context.Context, html []byte) ([]byte, error) {
+	f.html = string(html)
+	return []byte("%PDF-1.7"), nil
+}
+
+func TestSummaryReport(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	srv.CreateUser(t, "")
+	asAdmin := apitest.WithToken(admin.Token)
+
+	reports.PDF = nil
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "summary"}, asAdmin).
+		Expect(t, http.StatusServiceUnavailable)
+
+	renderer := &fakeRenderer{}
+	reports.PDF = renderer
+	t.Cleanup(func() { reports.PDF = nil })
+	for _, month := range []string{"2026/09", "2999-01"} {
+		srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "summary", "month": month}, asAdmin).
+			Expect(t, http.StatusBadRequest)
+	}
+
+	var report database.Report
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "summary"}, asAdmin).
+		Expect(t, http.StatusAccepted).JSON(t, &report)
+	if report.Period != reports.PreviousMonth().Format("2006-01") {
+		t.Errorf("periodo = %q, se esperaba el mes anterior", report.Period)
+	}
+	database.DB.Delete(&report)
+
+	// Los usuarios del test se crearon este mes
+	month := clock.Now().UTC().Format("2006-01")
+	srv.Do(t, http.MethodPost, "/api/v1/admin/reports", map[string]string{"type": "summary", "month": month}, asAdmin).
+		Expect(t, http.StatusAccepted).JSON(t, &report)
+	if err := reports.Process(context.Background(), []byte(`{"report_id":"`+report.ID+`"}`)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := storage.Default.Get(context.Background(), "reports/summary-"+month+"-"+report.ID+".pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf, _ := io.ReadAll(f)
+	f.Close()
+	if string(pdf) != "%PDF-1.7" {
+		t.Errorf("pdf = %q", pdf)
+	}
+	if !strings.Contains(renderer.html, `<tr><td>Altas</td><td class="num">2</td></tr>`) ||
+		!strings.Contains(renderer.html, `<tr><td>Usuarios al final del mes</td><td class="num">2</td></tr>`) {
+		t.Errorf("HTML del informe = %s", renderer.html)
+	}
+}
+
+func TestReportSchedules(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	asAdmin := apitest.WithToken(admin.Token)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	t.Cleanup(func() { mail.Default = mail.LogMailer{} })
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+
+	path := "/api/v1/admin/report-schedules"
+	for _, invalid := range []map[string]interface{}{
+		{"name": "Altas", "type": "signups", "frequency": "hourly", "recipients": []string{"ops@example.com"}},
+		{"name": "Resumen", "type": "summary", "frequency": "weekly", "recipients": []string{"ops@example.com"}},
+		{"name": "Facturas", "type": "facturas", "frequency": "daily", "recipients": []string{"ops@example.com"}},
+		{"name": "Altas", "type": "signups", "frequency": "daily", "recipients": []string{"no es un email"}},
+		{"name": "Altas", "type": "signups", "frequency": "daily", "recipients": []string{}},
+	} {
+		srv.Do(t, http.MethodPost, path, invalid, asAdmin).Expect(t, http.StatusBadRequest)
+	}
+	srv.Do(t, http.MethodPost, path, map[string]interface{}{
+		"name": "Altas", "type": "signups", "frequency": "daily", "recipients": []string{"ops@example.com"},
+	}, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+
+	var schedule database.ReportSchedule
+	srv.Do(t, http.MethodPost, path, map[string]interface{}{
+		"name": "Altas diarias", "type": "signups", "frequency": "daily", "recipients": []string{" Ops@Example.com", "cto@example.com"},
+	}, asAdmin).Expect(t, http.StatusCreated).JSON(t, &schedule)
+	tomorrow := reports.NextRun(reports.Daily, now.Now())
+	if !schedule.Enabled || schedule.Recipients[0] != "ops@example.com" || !schedule.NextRunAt.Equal(tomorrow) {
+		t.Fatalf("programación = %+v", schedule)
+	}
+
+	// Hasta que termina el día no se envía nada
+	if err := reports.RunSchedules(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if mailer.count() != 0 {
+		t.Fatalf("se enviaron %d correos antes de tiempo", mailer.count())
+	}
+
+	// Al día siguiente se envían las altas de hoy, una vez, a cada destinatario
+	now.Set(tomorrow.Add(time.Hour))
+	for i := 0; i < 2; i++ {
+		if err := reports.RunSchedules(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if mailer.count() != 2 || strings.Join(mailer.recipients, ",") != "ops@example.com,cto@example.com" {
+		t.Fatalf("correos a %v", mailer.recipients)
+	}
+	attachment := mailer.attachments[0]
+	day := tomorrow.AddDate(0, 0, -1).Format("2006-01-02")
+	if len(attachment) != 1 || attachment[0].Filename != "signups-"+day+".xlsx" {
+		t.Fatalf("adjuntos = %+v", attachment)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(attachment[0].Data), int64(len(attachment[0].Data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sheet, _ := zr.Open("xl/worksheets/sheet1.xml")
+	content, _ := io.ReadAll(sheet)
+	if !strings.Contains(string(content), user.Email) {
+		t.Errorf("la hoja de altas no incluye al usuario de hoy: %s", content)
+	}
+
+	var list struct {
+		Schedules []database.ReportSchedule `json:"schedules"`
+	}
+	srv.Do(t, http.MethodGet, path, nil, asAdmin).Expect(t, http.StatusOK).JSON(t, &list)
+	if len(list.Schedules) != 1 || list.Schedules[0].LastRunAt == nil || list.Schedules[0].LastError != "" ||
+		!list.Schedules[0].NextRunAt.Equal(tomorrow.AddDate(0, 0, 1)) {
+		t.Fatalf("programaciones = %+v", list.Schedules)
+	}
+
+	// Los informes que superan el límite se envían como enlace
+	t.Setenv("REPORT_ATTACHMENT_MAX_MB", "0")
+	now.Set(tomorrow.AddDate(0, 0, 1).Add(time.Hour))
+	if err := reports.RunSchedules(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if mailer.count() != 4 || len(mailer.attachments[2]) != 0 || !strings.Contains(mailer.bodies[2], "/api/v1/admin/reports/") {
+		t.Fatalf("correo sin adjunto = %q", mailer.bodies[len(mailer.bodies)-1])
+	}
+
+	// La sesión del administrador caduca con el reloj adelantado
+	now.Set(time.Now())
+	id := itoa(schedule.ID)
+	srv.Do(t, http.MethodPut, path+"/"+id, map[string]interface{}{
+		"name": "Auditoría semanal", "type": "audit", "frequency": "weekly", "recipients": []string{"ops@example.com"}, "enabled": false,
+	}, asAdmin).Expect(t, http.StatusOK).JSON(t, &schedule)
+	if schedule.Enabled || schedule.NextRunAt.Weekday() != time.Monday || !schedule.NextRunAt.After(now.Now()) {
+		t.Errorf("programación modificada = %+v", schedule)
+	}
+	srv.Do(t, http.MethodPut, path+"/999999", map[string]interface{}{
+		"name": "x", "type": "audit", "frequency": "weekly", "recipients": []string{"ops@example.com"},
+	}, asAdmin).Expect(t, http.StatusNotFound)
+
+	srv.Do(t, http.MethodDelete, path+"/"+id, nil, asAdmin).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, path+"/"+id, nil, asAdmin).Expect(t, http.StatusNotFound)
+}
+
+func TestBackups(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+
+	var created database.Backup
+	srv.Do(t, http.MethodPost, "/api/v1/admin/backups", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusAccepted).JSON(t, &created)
+	if created.Status != "pending" || created.RequestedBy == nil || *created.RequestedBy != admin.ID {
+		t.Fatalf("copia = %+v", created)
+	}
+	// Solo una copia a la vez
+	srv.Do(t, http.MethodPost, "/api/v1/admin/backups", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+
+	if err := backup.Process(context.Background(), []byte(`{"backup_id":"`+created.ID+`"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var status struct {
+		Backup      database.Backup `json:"backup"`
+		DownloadURL string          `json:"download_url"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/backups/"+created.ID, nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK).JSON(t, &status)
+	if status.Backup.Status != "ready" || status.Backup.Driver != "sqlite" || status.Backup.Size == 0 ||
+		status.Backup.CompletedAt == nil || status.DownloadURL == "" {
+		t.Fatalf("estado = %+v", status)
+	}
+	// La copia se guarda cifrada
+	f, err := storage.Default.Get(context.Background(), backup.ObjectKey(created.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if bytes.Contains(data, []byte("SQLite format 3")) || bytes.Contains(data, []byte(user.Email)) {
+		t.Error("la copia se guardó sin cifrar")
+	}
+
+	var list struct {
+		Data []database.Backup `json:"data"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/backups", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK).JSON(t, &list)
+	if len(list.Data) != 1 || list.Data[0].ID != created.ID {
+		t.Errorf("listado = %+v", list.Data)
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/admin/backups/nope", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/backups", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+}
+
+func TestEmailChangeRequiresSession(t *testing.T) {
+	srv := apitest.New(t)
+	// admin: el plan free no incluye claves de API
+	owner := srv.CreateUser(t, "admin")
+	var created struct {
+		Key string `json:"key"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/api-keys", map[string]string{"name": "backend"},
+		apitest.WithToken(owner.Token)).Expect(t, http.StatusCreated).JSON(t, &created)
+	path := "/api/v1/users/" + itoa(owner.ID)
+
+	srv.Do(t, http.MethodPut, path, map[string]string{"email": "robado@example.com"},
+		apitest.WithAPIKey(created.Key)).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, path, map[string]string{"name": "Backend"},
+		apitest.WithAPIKey(created.Key)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, path, map[string]string{"email": "nuevo@example.com"},
+		apitest.WithToken(owner.Token)).Expect(t, http.StatusOK)
+}
+
+func TestUsernames(t *testing.T) {
+	srv := apitest.New(t)
+	owner := srv.CreateUser(t, "")
+	other := srv.CreateUser(t, "")
+
+	available := func(name string) (result struct {
+		Available bool   `json:"available"`
+		Reason    string `json:"reason"`
+	}) {
+		t.Helper()
+		srv.Do(t, http.MethodGet, "/api/v1/usernames/"+name+"/available", nil).Expect(t, http.StatusOK).JSON(t, &result)
+		return result
+	}
+	if got := available("ana.garcia"); !got.Available {
+		t.Fatalf("ana.garcia no disponible: %+v", got)
+	}
+	if got := available("admin"); got.Available || got.Reason != "reserved" {
+		t.Errorf("admin = %+v", got)
+	}
+	if got := available("a"); got.Available || got.Reason != "invalid" {
+		t.Errorf("a = %+v", got)
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/u/ana.garcia", nil).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(owner.ID), map[string]string{"username": " @Ana.Garcia"},
+		apitest.WithToken(owner.Token)).Expect(t, http.StatusOK)
+	if got := available("Ana.Garcia"); got.Available || got.Reason != "taken" {
+		t.Errorf("tras elegirlo = %+v", got)
+	}
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(other.ID), map[string]string{"username": "ana.garcia"},
+		apitest.WithToken(other.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(other.ID), map[string]string{"username": "ana garcia"},
+		apitest.WithToken(other.Token)).Expect(t, http.StatusBadRequest)
+
+	// El perfil público no expone el email ni el rol
+	var profile map[string]interface{}
+	srv.Do(t, http.MethodGet, "/api/v1/u/ana.garcia", nil).Expect(t, http.StatusOK).JSON(t, &profile)
+	if profile["username"] != "ana.garcia" || profile["name"] != owner.Name {
+		t.Errorf("perfil = %v", profile)
+	}
+	for _, field := range []string{"email", "role", "id"} {
+		if _, ok := profile[field]; ok {
+			t.Errorf("el perfil público incluye %s", field)
+		}
+	}
+}
+
+func TestIncludeUsers(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]interface{}{"bio": "Hola"}, apitest.WithToken(user.Token)).
+		Expect(t, http.StatusOK)
+
+	var res struct {
+		Data []struct {
+			ID       uint `json:"ID"`
+			Included struct {
+				Plan       *database.Plan            `json:"plan"`
+				Profile    *database.Profile         `json:"profile"`
+				Identities []database.LinkedIdentity `json:"identities"`
+			} `json:"included"`
+		} `json:"data"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v2/users?include=plan,profile,identities", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK).JSON(t, &res)
+	if len(res.Data) != 2 {
+		t.Fatalf("usuarios = %+v", res.Data)
+	}
+	for _, u := range res.Data {
+		if u.Included.Plan == nil || u.Included.Plan.Code != "free" || u.Included.Identities == nil {
+			t.Errorf("usuario %d: included = %+v", u.ID, u.Included)
+		}
+		// Solo el que rellenó sus datos personales tiene perfil
+		if hasProfile := u.Included.Profile != nil; hasProfile != (u.ID == user.ID) {
+			t.Errorf("usuario %d: perfil = %+v", u.ID, u.Included.Profile)
+		}
+	}
+	if bio := res.Data[1].Included.Profile; bio == nil || bio.Bio != "Hola" {
+		t.Errorf("perfil = %+v", bio)
+	}
+
+	// Sin include no se añade nada
+	var plain []map[string]interface{}
+	srv.Do(t, http.MethodGet, "/api/v1/users", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK).JSON(t, &plain)
+	if _, ok := plain[0]["included"]; ok {
+		t.Errorf("usuario sin include = %v", plain[0])
+	}
+
+	// Los datos personales solo para administradores; las relaciones desconocidas se rechazan
+	srv.Do(t, http.MethodGet, "/api/v1/users?include=plan", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/users?include=profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodGet, "/api/v1/users/"+itoa(user.ID)+"?include=sessions", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusBadRequest)
+}
+
+func TestProfile(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+
+	var got struct {
+		User    database.User    `json:"user"`
+		Profile database.Profile `json:"profile"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, session).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.User.Email != user.Email || got.Profile.Phone != "" {
+		t.Fatalf("perfil inicial = %+v", got)
+	}
+
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]interface{}{"phone": "600111222"}, session).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]interface{}{"address": map[string]string{"country": "XX"}}, session).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]interface{}{"birthday": "2999-01-01"}, session).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]interface{}{
+		"bio":      "Hola",
+		"phone":    "+34 600 111 222",
+		"birthday": "1990-05-17",
+		"address":  map[string]string{"line1": "Calle Mayor 1", "city": "Madrid", "country": "es"},
+	}, session).Expect(t, http.StatusOK)
+
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, session).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.Profile.Phone != "+34600111222" || got.Profile.Birthday != "1990-05-17" || got.Profile.Address.Country != "ES" || got.Profile.Address.Line1 != "Calle Mayor 1" {
+		t.Fatalf("perfil guardado = %+v", got.Profile)
+	}
+
+	// PUT reemplaza: lo que no se envía se borra
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]interface{}{"bio": "Adiós"}, session).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, session).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.Profile.Bio != "Adiós" || got.Profile.Phone != "" || got.Profile.Address.City != "" {
+		t.Fatalf("perfil reemplazado = %+v", got.Profile)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+
+	var got struct {
+		Settings map[string]interface{} `json:"settings"`
+		Version  int                    `json:"version"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile/settings", nil, session).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.Version != 0 || got.Settings["theme"] != "system" || got.Settings["page_size"] != float64(20) {
+		t.Fatalf("preferencias iniciales = %+v", got)
+	}
+
+	srv.Do(t, http.MethodPut, "/api/v1/profile/settings", map[string]interface{}{"settings": map[string]interface{}{"theme": "rosa"}}, session).
+		Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPut, "/api/v1/profile/settings", map[string]interface{}{"settings": map[string]interface{}{"idioma": "es"}}, session).
+		Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPut, "/api/v1/profile/settings", map[string]interface{}{
+		"settings": map[string]interface{}{"theme": "dark", "page_size": 50}, "version": 0,
+	}, session).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.Version != 1 {
+		t.Fatalf("versión = %d", got.Version)
+	}
+
+	// Los cambios se combinan con lo guardado
+	srv.Do(t, http.MethodPut, "/api/v1/profile/settings", map[string]interface{}{
+		"settings": map[string]interface{}{"page_size": nil, "email_frequency": "never"},
+	}, session).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.Version != 2 || got.Settings["theme"] != "dark" || got.Settings["page_size"] != float64(20) || got.Settings["email_frequency"] != "never" {
+		t.Fatalf("preferencias combinadas = %+v", got)
+	}
+
+	// Una versión antigua no pisa los cambios de otra sesión
+	srv.Do(t, http.MethodPut, "/api/v1/profile/settings", map[string]interface{}{
+		"settings": map[string]interface{}{"theme": "light"}, "version": 1,
+	}, session).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodGet, "/api/v1/profile/settings", nil, session).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.Settings["theme"] != "dark" {
+		t.Errorf("tema = %v tras el conflicto", got.Settings["theme"])
+	}
+}
+
+func TestAvatarURL(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+
+	var got struct {
+		User struct {
+			AvatarURL string `json:"avatar_url"`
+		} `json:"user"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK).JSON(t, &got)
+	hash := sha256.Sum256([]byte(user.Email))
+	want := "https://www.gravatar.com/avatar/" + hex.EncodeToString(hash[:]) + "?s=128&d=identicon"
+	if got.User.AvatarURL != want {
+		t.Errorf("avatar_url = %q, se esperaba %q", got.User.AvatarURL, want)
+	}
+
+	t.Setenv("AVATAR_FALLBACK", "none")
+	got.User.AvatarURL = ""
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK).JSON(t, &got)
+	if got.User.AvatarURL != "" {
+		t.Errorf("avatar_url = %q sin Gravatar", got.User.AvatarURL)
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+	for _, name := range []string{"Ana García", "Anabel Ruiz", "Juan_Pérez"} {
+		other := srv.CreateUser(t, "")
+		database.DB.Model(other.User).Update("name", name)
+	}
+	inactive := srv.CreateUser(t, "")
+	database.DB.Model(inactive.User).Updates(map[string]interface{}{"name": "Ana Inactiva", "is_active": false})
+
+	search := func(query string) []string {
+		t.Helper()
+		var got struct {
+			Data []struct {
+				ID    uint   `json:"id"`
+				Name  string `json:"name"`
+				Email string `json:"email"`
+			} `json:"data"`
+		}
+		srv.Do(t, http.MethodGet, "/api/v1/users/search?"+query, nil, session).Expect(t, http.StatusOK).JSON(t, &got)
+		names := []string{}
+		for _, u := range got.Data {
+			if u.Email != "" {
+				t.Errorf("la búsqueda devuelve el email de %s", u.Name)
+			}
+			names = append(names, u.Name)
+		}
+		return names
+	}
+
+	if got := search("q=ANA"); strings.Join(got, ",") != "Ana García,Anabel Ruiz" {
+		t.Errorf("q=ANA: %v", got)
+	}
+	if got := search("q=ana&limit=1"); len(got) != 1 {
+		t.Errorf("limit=1: %v", got)
+	}
+	if got := search("q=a"); len(got) != 0 {
+		t.Errorf("q de un carácter: %v", got)
+	}
+	// Los comodines de LIKE se buscan literalmente
+	if got := search("q=juan_"); len(got) != 1 {
+		t.Errorf("q=juan_: %v", got)
+	}
+	if got := search("q=" + url.QueryEscape(user.Email[:6])); len(got) == 0 {
+		t.Errorf("sin resultados por email para %s", user.Email[:6])
+	}
+}
+
+func TestSearchEngine(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+	first, second, inactive := srv.CreateUser(t, ""), srv.CreateUser(t, ""), srv.CreateUser(t, "")
+	database.DB.Model(first.User).Update("name", "Zoe Primera")
+	database.DB.Model(second.User).Update("name", "Zoe Segunda")
+	database.DB.Model(inactive.User).Updates(map[string]interface{}{"name": "Zoe Inactiva", "is_active": false})
+
+	engine := &fakeEngine{ids: []uint{second.ID, inactive.ID, first.ID}, indexed: map[uint]search.Document{}}
+	search.Default = engine
+	t.Cleanup(func() { search.Default = nil })
+
+	names := func() string {
+		t.Helper()
+		var got struct {
+			Data []struct {
+				Name string `json:"name"`
+			} `json:"data"`
+		}
+		srv.Do(t, http.MethodGet, "/api/v1/users/search?q=zoe", nil, session).Expect(t, http.StatusOK).JSON(t, &got)
+		list := []string{}
+		for _, u := range got.Data {
+			list = append(list, u.Name)
+		}
+		return strings.Join(list, ",")
+	}
+	// Orden del motor; los usuarios que ya no son buscables se descartan
+	if got := names(); got != "Zoe Segunda,Zoe Primera" {
+		t.Errorf("con el motor: %s", got)
+	}
+	// Si el motor falla se busca en la base de datos
+	engine.err = errors.New("sin conexión")
+	if got := names(); got != "Zoe Primera,Zoe Segunda" {
+		t.Errorf("sin el motor: %s", got)
+	}
+
+	// El trabajo de indexación lee el estado actual del usuario
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(first.ID), map[string]string{"name": "Zoe Renombrada"},
+		apitest.WithToken(first.Token)).Expect(t, http.StatusOK)
+	for _, id := range []uint{first.ID, inactive.ID} {
+		if err := search.IndexUser(context.Background(), []byte(`{"user_id":`+itoa(id)+`}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if doc := engine.indexed[first.ID]; doc.Name != "Zoe Renombrada" || doc.Email != first.Email {
+		t.Errorf("documento indexado = %+v", doc)
+	}
+	if len(engine.deleted) != 1 || engine.deleted[0] != inactive.ID {
+		t.Errorf("eliminados del índice = %v, se esperaba [%d]", engine.deleted, inactive.ID)
+	}
+}
+
+func TestTimezone(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(user.ID), map[string]string{"timezone": "Marte/Olympus"}, session).
+		Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(user.ID), map[string]string{"timezone": "Asia/Kolkata", "locale": "es-ES"}, session).
+		Expect(t, http.StatusOK)
+
+	var got struct {
+		User struct {
+			CreatedAt string `json:"CreatedAt"`
+			Timezone  string `json:"timezone"`
+			Locale    string `json:"locale"`
+		} `json:"user"`
+	}
+	resp := srv.Do(t, http.MethodGet, "/api/v1/profile", nil, session).Expect(t, http.StatusOK)
+	resp.JSON(t, &got)
+	if got.User.Timezone != "Asia/Kolkata" || got.User.Locale != "es-ES" || resp.Header().Get("X-Timezone") != "Asia/Kolkata" {
+		t.Fatalf("usuario = %+v, X-Timezone = %q", got.User, resp.Header().Get("X-Timezone"))
+	}
+	if !strings.HasSuffix(got.User.CreatedAt, "+05:30") {
+		t.Errorf("created_at = %s, se esperaba en la zona del usuario", got.User.CreatedAt)
+	}
+
+	// La cabecera X-Timezone tiene prioridad sobre la zona guardada
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, session, apitest.WithHeader("X-Timezone", "UTC")).
+		Expect(t, http.StatusOK).JSON(t, &got)
+	if !strings.HasSuffix(got.User.CreatedAt, "Z") {
+		t.Errorf("created_at = %s, se esperaba en UTC", got.User.CreatedAt)
+	}
+
+	// Solo se convierten las fechas: un texto con forma de fecha se devuelve tal cual
+	const bio = "2026-01-01T00:00:00Z"
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]string{"bio": bio}, session).Expect(t, http.StatusOK)
+	var profile struct {
+		Profile struct {
+			Bio       string `json:"bio"`
+			UpdatedAt string `json:"updated_at"`
+		} `json:"profile"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, session).Expect(t, http.StatusOK).JSON(t, &profile)
+	if profile.Profile.Bio != bio {
+		t.Errorf("bio = %q, se esperaba %q sin convertir", profile.Profile.Bio, bio)
+	}
+	if !strings.HasSuffix(profile.Profile.UpdatedAt, "+05:30") {
+		t.Errorf("updated_at = %s, se esperaba en la zona del usuario", profile.Profile.UpdatedAt)
+	}
+}
+
+func TestMaintenanceLogin(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	if err := maintenance.Set(maintenance.State{Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { maintenance.Set(maintenance.State{}) })
+
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusServiceUnavailable)
+
+	// El inicio de sesión sigue abierto en todas las versiones, solo para administradores
+	for _, version := range []string{"v1", "v2"} {
+		srv.Do(t, http.MethodPost, "/api/"+version+"/auth/login", map[string]string{"email": admin.Email, "password": apitest.Password}).
+			Expect(t, http.StatusOK)
+		srv.Do(t, http.MethodPost, "/api/"+version+"/auth/login", map[string]string{"email": user.Email, "password": apitest.Password}).
+			Expect(t, http.StatusServiceUnavailable)
+	}
+	// La ruta de identidades externas la atiende el handler, no el middleware
+	srv.Do(t, http.MethodPost, "/api/v2/auth/login/identity", map[string]string{"provider": "desconocido", "credential": "x"}).
+		Expect(t, http.StatusNotFound)
+}
+
+func TestTenantsDisabled(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, services.RolePlatformAdmin)
+	tenantAdmin := srv.CreateUser(t, "admin")
+
+	// La gestión de tenants es solo de los administradores de la plataforma
+	srv.Do(t, http.MethodGet, "/api/v1/admin/tenants", nil, apitest.WithToken(tenantAdmin.Token)).Expect(t, http.StatusForbidden)
+	// y tienen el resto de permisos de admin
+	srv.Do(t, http.MethodGet, "/api/v1/admin/stats", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusOK)
+
+	// Sin TENANCY=schema no hay tenants que listar ni dar de alta, y X-Tenant se ignora
+	srv.Do(t, http.MethodGet, "/api/v1/admin/tenants", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/tenants/stats", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/tenants", map[string]string{"slug": "acme", "name": "Acme"},
+		apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/tenants/acme", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/tenants/acme/suspend", map[string]string{"reason": "moroso"},
+		apitest.WithToken(admin.Token)).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/tenants/acme/suspend", map[string]string{"reason": "billing"},
+		apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/tenants/acme/export", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodDelete, "/api/v1/admin/tenants/acme", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/tenants/events?after=0", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusOK)
+	// Las cuotas de los tenants solo las ajustan los administradores de la plataforma
+	limit := map[string]interface{}{"quota": "users_per_org", "limit": 10}
+	srv.Do(t, http.MethodPut, "/api/v1/admin/quotas/tenant/1", limit, apitest.WithToken(tenantAdmin.Token)).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, "/api/v1/admin/quotas/tenant/1", limit, apitest.WithToken(admin.Token)).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/tenant/quotas", nil, apitest.WithToken(tenantAdmin.Token)).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(admin.Token),
+		apitest.WithHeader("X-Tenant", "acme")).Expect(t, http.StatusOK)
+}
+
+func TestTenantSettings(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	asAdmin := apitest.WithToken(admin.Token)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	t.Cleanup(func() {
+		mail.Default = mail.LogMailer{}
+		branding.Set(context.Background(), branding.Settings{})
+	})
+
+	path := "/api/v1/admin/tenant/settings"
+	for _, invalid := range []map[string]interface{}{
+		{"branding": map[string]string{"accent_color": "verde"}},
+		{"branding": map[string]string{"logo_url": "javascript:alert(1)"}},
+		{"retention": map[string]string{"desconocida": "24h"}},
+		{"retention": map[string]string{"quota_counters": "pronto"}},
+	} {
+		srv.Do(t, http.MethodPut, path, invalid, asAdmin).Expect(t, http.StatusBadRequest)
+	}
+	srv.Do(t, http.MethodPut, path, map[string]interface{}{}, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+
+	var settings handlers.TenantSettings
+	srv.Do(t, http.MethodPut, path, map[string]interface{}{
+		"branding": map[string]string{
+			"logo_url": "https://cdn.example.com/acme.png", "sender_name": "Acme", "accent_color": "#1a73e8", "email_footer": "Acme S.L.",
+		},
+		"retention": map[string]string{"quota_counters": "24h", "stripe_events": "off"},
+	}, asAdmin).Expect(t, http.StatusOK).JSON(t, &settings)
+	if settings.Branding.SenderName != "Acme" || settings.Retention["quota_counters"] != "24h" {
+		t.Fatalf("ajustes = %+v", settings)
+	}
+
+	// La personalización es pública para la página de inicio de sesión
+	var public branding.Settings
+	srv.Do(t, http.MethodGet, "/api/v1/branding", nil).Expect(t, http.StatusOK).JSON(t, &public)
+	if public.LogoURL != "https://cdn.example.com/acme.png" || public.AccentColor != "#1a73e8" {
+		t.Errorf("personalización pública = %+v", public)
+	}
+
+	// Los plazos propios sustituyen a los de la instalación
+	var rules []struct {
+		Name       string `json:"name"`
+		Enabled    bool   `json:"enabled"`
+		TTL        string `json:"ttl"`
+		Overridden bool   `json:"overridden"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/retention", nil, asAdmin).Expect(t, http.StatusOK).JSON(t, &rules)
+	for _, rule := range rules {
+		switch rule.Name {
+		case "quota_counters":
+			if rule.TTL != "24h0m0s" || !rule.Overridden {
+				t.Errorf("regla quota_counters = %+v", rule)
+			}
+		case "stripe_events":
+			if rule.Enabled || !rule.Overridden {
+				t.Errorf("regla stripe_events = %+v", rule)
+			}
+		case "deleted_users":
+			if rule.TTL != "720h0m0s" || rule.Overridden {
+				t.Errorf("regla deleted_users = %+v", rule)
+			}
+		}
+	}
+
+	// Los correos transaccionales llevan el pie
+	if err := branding.Send(context.Background(), user.Email, "Prueba", "Hola"); err != nil {
+		t.Fatal(err)
+	}
+	if body := mailer.wait(t); !strings.HasSuffix(body, "\n--\nAcme S.L.") {
+		t.Errorf("correo sin el pie del tenant:\n%s", body)
+	}
+}
+
+func TestOrganizationRoles(t *testing.T) {
+	srv := apitest.New(t)
+	ana := srv.CreateUser(t, "")
+	luis := srv.CreateUser(t, "")
+	outsider := srv.CreateUser(t, "")
+	admin := srv.CreateUser(t, "admin")
+	asAna, asLuis := apitest.WithToken(ana.Token), apitest.WithToken(luis.Token)
+
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "1acme", "name": "Acme"}, asAna).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "acme", "name": "Acme"}, asAna).Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "acme", "name": "Otra"}, asLuis).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "globex", "name": "Globex"}, asLuis).Expect(t, http.StatusCreated)
+
+	// Ana es admin de acme y member de globex; Luis al revés
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/members", map[string]string{"email": luis.Email, "role": "member"}, asAna).
+		Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/globex/members", map[string]string{"email": ana.Email, "role": "member"}, asLuis).
+		Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/globex/members", map[string]string{"email": ana.Email, "role": "admin"}, asLuis).
+		Expect(t, http.StatusConflict)
+
+	var mine struct {
+		Organizations []services.UserOrganization `json:"organizations"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/orgs", nil, asAna).Expect(t, http.StatusOK).JSON(t, &mine)
+	roles := map[string]string{}
+	for _, org := range mine.Organizations {
+		roles[org.Slug] = org.Role
+	}
+	if roles["acme"] != "admin" || roles["globex"] != "member" || len(roles) != 2 {
+		t.Fatalf("organizaciones de Ana = %v", roles)
+	}
+
+	// Los permisos dependen del rol en la organización de la ruta
+	srv.Do(t, http.MethodPut, "/api/v1/orgs/acme", map[string]string{"name": "Acme S.L."}, asAna).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, "/api/v1/orgs/globex", map[string]string{"name": "Globex S.L."}, asAna).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/members", map[string]string{"email": outsider.Email, "role": "member"}, asLuis).
+		Expect(t, http.StatusForbidden)
+	var members struct {
+		Members []services.OrgMember `json:"members"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/orgs/globex/members", nil, asAna).Expect(t, http.StatusOK).JSON(t, &members)
+	if len(members.Members) != 2 || members.Members[0].UserID != luis.ID || members.Members[0].Role != "admin" {
+		t.Errorf("miembros de globex = %+v", members.Members)
+	}
+
+	// Para quien no pertenece a ella la organización no existe; un admin global accede a todas
+	srv.Do(t, http.MethodGet, "/api/v1/orgs/acme", nil, apitest.WithToken(outsider.Token)).Expect(t, http.StatusNotFound)
+	var org services.UserOrganization
+	srv.Do(t, http.MethodGet, "/api/v1/orgs/acme", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusOK).JSON(t, &org)
+	if org.Name != "Acme S.L." || org.Role != "admin" {
+		t.Errorf("organización vista por el admin = %+v", org)
+	}
+
+	// La organización conserva al menos un administrador
+	anaPath := fmt.Sprintf("/api/v1/orgs/acme/members/%d", ana.ID)
+	srv.Do(t, http.MethodPut, anaPath, map[string]string{"role": "member"}, asAna).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodDelete, anaPath, nil, asAna).Expect(t, http.StatusConflict)
+	luisPath := fmt.Sprintf("/api/v1/orgs/acme/members/%d", luis.ID)
+	srv.Do(t, http.MethodPut, luisPath, map[string]string{"role": "admin"}, asAna).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, anaPath, map[string]string{"role": "member"}, asAna).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, "/api/v1/orgs/acme", map[string]string{"name": "Acme"}, asAna).Expect(t, http.StatusForbidden)
+
+	srv.Do(t, http.MethodDelete, "/api/v1/orgs/acme", nil, asLuis).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodGet, "/api/v1/orgs/acme", nil, asAna).Expect(t, http.StatusNotFound)
+}
+
+func TestOrganizationGroups(t *testing.T) {
+	srv := apitest.New(t)
+	owner := srv.CreateUser(t, "")
+	dev := srv.CreateUser(t, "")
+	outsider := srv.CreateUser(t, "")
+	asOwner, asDev := apitest.WithToken(owner.Token), apitest.WithToken(dev.Token)
+
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "acme", "name": "Acme"}, asOwner).Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/members", map[string]string{"email": dev.Email, "role": "member"}, asOwner).
+		Expect(t, http.StatusCreated)
+
+	var group database.Group
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups", map[string]string{"slug": "engineering", "name": "Ingeniería"}, asDev).
+		Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups", map[string]string{"slug": "engineering", "name": "Ingeniería", "role": "admin"}, asOwner).
+		Expect(t, http.StatusCreated).JSON(t, &group)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups", map[string]string{"slug": "engineering", "name": "Otro"}, asOwner).
+		Expect(t, http.StatusConflict)
+
+	// Solo los miembros de la organización pueden estar en sus grupos
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups/engineering/members", map[string]uint{"user_id": outsider.ID}, asOwner).
+		Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups/engineering/members", map[string]uint{"user_id": dev.ID}, asOwner).
+		Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups/engineering/members", map[string]uint{"user_id": dev.ID}, asOwner).
+		Expect(t, http.StatusConflict)
+
+	// El grupo concede su rol: el member pasa a administrar la organización
+	var org services.UserOrganization
+	srv.Do(t, http.MethodGet, "/api/v1/orgs/acme", nil, asDev).Expect(t, http.StatusOK).JSON(t, &org)
+	if org.Role != "admin" {
+		t.Fatalf("rol efectivo = %q, se esperaba admin por el grupo", org.Role)
+	}
+	var mine struct {
+		Organizations []services.UserOrganization `json:"organizations"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/orgs", nil, asDev).Expect(t, http.StatusOK).JSON(t, &mine)
+	if len(mine.Organizations) != 1 || mine.Organizations[0].Role != "admin" || len(mine.Organizations[0].Groups) != 1 {
+		t.Errorf("organizaciones = %+v", mine.Organizations)
+	}
+	srv.Do(t, http.MethodPut, "/api/v1/orgs/acme", map[string]string{"name": "Acme S.L."}, asDev).Expect(t, http.StatusOK)
+
+	// Con el grupo como administrador, el propietario puede dejar de serlo; el
+	// grupo ya no puede perder su rol ni su último miembro
+	srv.Do(t, http.MethodPut, fmt.Sprintf("/api/v1/orgs/acme/members/%d", owner.ID), map[string]string{"role": "member"}, asOwner).
+		Expect(t, http.StatusOK)
+	groupPath := fmt.Sprintf("/api/v1/orgs/acme/groups/%d", group.ID)
+	srv.Do(t, http.MethodPut, groupPath, map[string]string{"role": "member"}, asDev).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodDelete, fmt.Sprintf("%s/members/%d", groupPath, dev.ID), nil, asDev).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodDelete, groupPath, nil, asDev).Expect(t, http.StatusConflict)
+
+	var detail struct {
+		Group   database.Group       `json:"group"`
+		Members []services.GroupUser `json:"members"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/orgs/acme/groups/engineering", nil, asOwner).Expect(t, http.StatusOK).JSON(t, &detail)
+	if detail.Group.Role != "admin" || len(detail.Members) != 1 || detail.Members[0].UserID != dev.ID {
+		t.Errorf("grupo = %+v", detail)
+	}
+
+	// Salir de la organización saca también de sus grupos
+	srv.Do(t, http.MethodPut, fmt.Sprintf("/api/v1/orgs/acme/members/%d", owner.ID), map[string]string{"role": "admin"}, asDev).
+		Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, fmt.Sprintf("/api/v1/orgs/acme/members/%d", dev.ID), nil, asOwner).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodGet, "/api/v1/orgs/acme/groups/engineering", nil, asOwner).Expect(t, http.StatusOK).JSON(t, &detail)
+	if len(detail.Members) != 0 {
+		t.Errorf("el grupo conserva a quien salió de la organización: %+v", detail.Members)
+	}
+}
+
+func TestAuthorizationPolicies(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	ana := srv.CreateUser(t, "")
+	bob := srv.CreateUser(t, "")
+	outsider := srv.CreateUser(t, "")
+	asAdmin, asAna := apitest.WithToken(admin.Token), apitest.WithToken(ana.Token)
+
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "acme", "name": "Acme"}, asAna).Expect(t, http.StatusCreated)
+	for _, member := range []*apitest.User{bob, admin} {
+		srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/members", map[string]string{"email": member.Email, "role": "member"}, asAna).
+			Expect(t, http.StatusCreated)
+	}
+	bobPath := "/api/v1/users/" + itoa(bob.ID)
+	srv.Do(t, http.MethodPut, bobPath, map[string]string{"name": "Bob"}, asAna).Expect(t, http.StatusForbidden)
+
+	for _, invalid := range []map[string]interface{}{
+		{"name": "x", "effect": "allow", "actions": []string{"users:update"}, "condition": "resource.org_id = 1"},
+		{"name": "x", "effect": "allow", "actions": []string{"users:update"}, "condition": "user.role == 1"},
+		{"name": "x", "effect": "allow", "actions": []string{"update"}},
+		{"name": "x", "effect": "maybe", "actions": []string{"users:update"}},
+	} {
+		srv.Do(t, http.MethodPost, "/api/v1/admin/policies", invalid, asAdmin).Expect(t, http.StatusBadRequest)
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/admin/policies", map[string]interface{}{"name": "owner", "effect": "allow", "actions": []string{"*"}}, asAdmin).
+		Expect(t, http.StatusConflict)
+
+	// Los administradores de una organización modifican a sus miembros, salvo a los administradores globales
+	srv.Do(t, http.MethodPost, "/api/v1/admin/policies", map[string]interface{}{
+		"name": "org-admins-update-members", "effect": "allow", "actions": []string{"users:update"},
+		"condition": `resource.orgs intersects actor.admin_orgs and resource.role != "admin"`,
+	}, asAdmin).Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPut, bobPath, map[string]string{"name": "Bob"}, asAna).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, bobPath, nil, asAna).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(outsider.ID), map[string]string{"name": "X"}, asAna).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(admin.ID), map[string]string{"name": "X"}, asAna).Expect(t, http.StatusForbidden)
+
+	// Una política deny prevalece sobre cualquier allow, también sobre la de los administradores
+	var deny authz.Policy
+	srv.Do(t, http.MethodPost, "/api/v1/admin/policies", map[string]interface{}{
+		"name": "freeze-bob", "effect": "deny", "actions": []string{"users:update", "users:delete"},
+		"condition": "resource.id == " + itoa(bob.ID),
+	}, asAdmin).Expect(t, http.StatusCreated).JSON(t, &deny)
+	srv.Do(t, http.MethodPut, bobPath, map[string]string{"name": "Bob"}, asAna).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, bobPath, map[string]string{"name": "Bob"}, asAdmin).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, bobPath, nil, asAdmin).Expect(t, http.StatusOK)
+
+	var list struct {
+		Policies []authz.Policy `json:"policies"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/policies", nil, asAdmin).Expect(t, http.StatusOK).JSON(t, &list)
+	if len(list.Policies) != 4 || !list.Policies[0].BuiltIn || list.Policies[3].Name != "freeze-bob" {
+		t.Errorf("políticas = %+v", list.Policies)
+	}
+
+	policyPath := fmt.Sprintf("/api/v1/admin/policies/%d", deny.ID)
+	srv.Do(t, http.MethodPut, policyPath, map[string]interface{}{
+		"name": "freeze-bob", "effect": "deny", "actions": []string{"users:delete"}, "condition": "resource.id == " + itoa(bob.ID),
+	}, asAdmin).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, bobPath, map[string]string{"name": "Bob"}, asAdmin).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, bobPath, nil, apitest.WithToken(bob.Token)).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodDelete, policyPath, nil, asAdmin).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodDelete, policyPath, nil, asAdmin).Expect(t, http.StatusNotFound)
+}
+
+func TestAuthorizationSimulation(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	ana := srv.CreateUser(t, "")
+	bob := srv.CreateUser(t, "")
+	asAdmin := apitest.WithToken(admin.Token)
+
+	simulate := func(body map[string]interface{}) authz.Simulation {
+		t.Helper()
+		var sim authz.Simulation
+		srv.Do(t, http.MethodPost, "/api/v1/admin/authz/simulate", body, asAdmin).Expect(t, http.StatusOK).JSON(t, &sim)
+		return sim
+	}
+
+	sim := simulate(map[string]interface{}{"user_id": ana.ID, "action": "users:update", "resource": "users/" + itoa(ana.ID)})
+	if !sim.Allowed || sim.Policy != "owner" || !sim.BuiltIn || sim.Resource["type"] != "users" {
+		t.Errorf("simulación propia = %+v", sim)
+	}
+	var matched []string
+	for _, e := range sim.Trace {
+		if e.Matched {
+			matched = append(matched, e.Policy)
+		}
+	}
+	if len(sim.Trace) != 2 || len(matched) != 1 || matched[0] != "owner" {
+		t.Errorf("traza = %+v", sim.Trace)
+	}
+
+	bobPath := "users/" + itoa(bob.ID)
+	sim = simulate(map[string]interface{}{"user_id": ana.ID, "action": "users:delete", "resource": bobPath})
+	if sim.Allowed || sim.Policy != "" {
+		t.Errorf("simulación ajena = %+v", sim)
+	}
+
+	// Un borrador cambia la decisión sin guardarse
+	draft := map[string]interface{}{"name": "everyone-deletes", "effect": "allow", "actions": []string{"users:delete"}}
+	sim = simulate(map[string]interface{}{"user_id": ana.ID, "action": "users:delete", "resource": bobPath, "policies": []interface{}{draft}})
+	if !sim.Allowed || sim.Policy != "everyone-deletes" || !sim.Draft {
+		t.Errorf("simulación con borrador = %+v", sim)
+	}
+	srv.Do(t, http.MethodDelete, "/api/v1/"+bobPath, nil, apitest.WithToken(ana.Token)).Expect(t, http.StatusForbidden)
+
+	draft["condition"] = "actor.id = 1"
+	srv.Do(t, http.MethodPost, "/api/v1/admin/authz/simulate", map[string]interface{}{
+		"user_id": ana.ID, "action": "users:delete", "resource": bobPath, "policies": []interface{}{draft},
+	}, asAdmin).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/authz/simulate", map[string]interface{}{"user_id": ana.ID, "action": "users:read", "resource": "orders/1"}, asAdmin).
+		Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/authz/simulate", map[string]interface{}{"user_id": 999999, "action": "users:read", "resource": bobPath}, asAdmin).
+		Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/authz/simulate", map[string]interface{}{"user_id": ana.ID, "action": "users:read", "resource": bobPath},
+		apitest.WithToken(ana.Token)).Expect(t, http.StatusForbidden)
+}
+
+func TestCheckPermission(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	ana := srv.CreateUser(t, "")
+	bob := srv.CreateUser(t, "")
+
+	for _, tc := range []struct {
+		user     *apitest.User
+		action   string
+		resource string
+		allowed  bool
+	}{
+		{ana, "users:delete", "users/" + itoa(ana.ID), true},
+		{ana, "users:delete", "users/" + itoa(bob.ID), false},
+		{ana, "users:export", "users/" + itoa(ana.ID), false},
+		{admin, "users:delete", "users/" + itoa(bob.ID), true},
+	} {
+		var body struct {
+			Allowed bool `json:"allowed"`
+		}
+		srv.Do(t, http.MethodGet, "/api/v1/authz/can?action="+tc.action+"&resource="+tc.resource, nil, apitest.WithToken(tc.user.Token)).
+			Expect(t, http.StatusOK).JSON(t, &body)
+		if body.Allowed != tc.allowed {
+			t.Errorf("%s %s por %d = %v, se esperaba %v", tc.action, tc.resource, tc.user.ID, body.Allowed, tc.allowed)
+		}
+	}
+
+	asAna := apitest.WithToken(ana.Token)
+	srv.Do(t, http.MethodGet, "/api/v1/authz/can?action=users:read&resource=orders/1", nil, asAna).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodGet, "/api/v1/authz/can?action=read&resource=users/1", nil, asAna).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodGet, "/api/v1/authz/can?action=users:read&resource=users/1", nil).Expect(t, http.StatusUnauthorized)
+}
+
+func TestUserPermissions(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	ana := srv.CreateUser(t, "")
+	bob := srv.CreateUser(t, "")
+	asAdmin, asAna := apitest.WithToken(admin.Token), apitest.WithToken(ana.Token)
+
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "acme", "name": "Acme"}, asAna).Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/members", map[string]string{"email": bob.Email, "role": "member"}, asAna).
+		Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups", map[string]string{"slug": "leads", "name": "Leads", "role": "admin"}, asAna).
+		Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/orgs/acme/groups/leads/members", map[string]uint{"user_id": bob.ID}, asAna).
+		Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/policies", map[string]interface{}{
+		"name": "org-admins-update-members", "effect": "allow", "actions": []string{"users:update"},
+		"condition": "resource.orgs intersects actor.admin_orgs",
+	}, asAdmin).Expect(t, http.StatusCreated)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/policies", map[string]interface{}{
+		"name": "no-deletes", "effect": "deny", "actions": []string{"users:delete"}, "condition": `actor.role != "admin"`,
+	}, asAdmin).Expect(t, http.StatusCreated)
+
+	permissions := func(user *apitest.User) map[string]services.Permission {
+		t.Helper()
+		var body services.EffectivePermissions
+		srv.Do(t, http.MethodGet, "/api/v1/admin/users/"+itoa(user.ID)+"/permissions", nil, asAdmin).Expect(t, http.StatusOK).JSON(t, &body)
+		found := map[string]services.Permission{}
+		for _, p := range body.Permissions {
+			found[p.Permission+" "+p.Source+" "+p.Rule] = p
+		}
+		return found
+	}
+
+	got := permissions(bob)
+	for key, scope := range map[string]string{
+		"orgs/acme:member membership acme":              authz.ScopeAll,
+		"orgs/acme:admin group acme/leads":              authz.ScopeAll,
+		"users:read policy owner":                       authz.ScopeConditional,
+		"users:update policy org-admins-update-members": authz.ScopeConditional,
+		"users:delete policy no-deletes":                authz.ScopeAll,
+	} {
+		if p, ok := got[key]; !ok || p.Scope != scope {
+			t.Errorf("permiso %q = %+v (ok %v), se esperaba scope %s", key, p, ok, scope)
+		}
+	}
+	if p := got["users:update policy org-admins-update-members"]; p.Actor["admin_orgs"] == nil {
+		t.Errorf("sin atributos del actor: %+v", p)
+	}
+	if p := got["users:delete policy no-deletes"]; p.Effect != authz.Deny {
+		t.Errorf("no-deletes = %+v", p)
+	}
+	if _, ok := got["admin role user"]; ok || len(got) != 7 {
+		t.Errorf("permisos de bob = %v", got)
+	}
+
+	got = permissions(admin)
+	if _, ok := got["admin role admin"]; !ok || got["users:delete policy admins"].Scope != authz.ScopeAll {
+		t.Errorf("permisos del administrador = %v", got)
+	}
+	if _, ok := got["users:delete policy no-deletes"]; ok {
+		t.Errorf("no-deletes no se aplica a los administradores: %v", got)
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/admin/users/999999/permissions", nil, asAdmin).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/users/"+itoa(bob.ID)+"/permissions", nil, asAna).Expect(t, http.StatusForbidden)
+}
+
+func TestPermissionClaims(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	ana := srv.CreateUser(t, "")
+	bob := srv.CreateUser(t, "")
+
+	login := func(user *apitest.User) (string, *auth.Claims) {
+		t.Helper()
+		var body struct {
+			Token string `json:"token"`
+		}
+		srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": user.Email, "password": apitest.Password}).
+			Expect(t, http.StatusOK).JSON(t, &body)
+		claims, err := auth.ParseToken(body.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body.Token, claims
+	}
+	refresh := func(token string) (string, *auth.Claims) {
+		t.Helper()
+		var body struct {
+			Token string `json:"token"`
+		}
+		srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil, apitest.WithToken(token)).Expect(t, http.StatusOK).JSON(t, &body)
+		claims, err := auth.ParseToken(body.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body.Token, claims
+	}
+	stale := func(token string) string {
+		t.Helper()
+		return srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(token)).Expect(t, http.StatusOK).Header().Get("X-Permissions-Stale")
+	}
+
+	adminToken, claims := login(admin)
+	if claims.Role != "admin" || claims.PermVersion == 0 || strings.Join(claims.Permissions, ",") != "admin,users:read,users:update,users:delete" {
+		t.Errorf("claims del administrador = %+v", claims)
+	}
+	anaToken, claims := login(ana)
+	if len(claims.Permissions) != 0 || stale(anaToken) != "" {
+		t.Errorf("claims de ana = %+v", claims)
+	}
+
+	// Un cambio en sus organizaciones deja los permisos del token desfasados
+	srv.Do(t, http.MethodPost, "/api/v1/orgs", map[string]string{"slug": "acme", "name": "Acme"}, apitest.WithToken(anaToken)).
+		Expect(t, http.StatusCreated)
+	if stale(anaToken) != "true" {
+		t.Error("el token de ana no está desfasado tras crear una organización")
+	}
+	anaToken, claims = refresh(anaToken)
+	if strings.Join(claims.Permissions, ",") != "orgs/acme:admin" || stale(anaToken) != "" {
+		t.Errorf("claims renovados de ana = %+v", claims)
+	}
+
+	// Un cambio en las políticas afecta a todos: hasta renovar el token se
+	// autoriza con las políticas, y la nueva deny prevalece
+	bobPath := "/api/v1/users/" + itoa(bob.ID)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/policies", map[string]interface{}{
+		"name": "freeze-bob", "effect": "deny", "actions": []string{"users:update"}, "condition": "resource.id == " + itoa(bob.ID),
+	}, apitest.WithToken(adminToken)).Expect(t, http.StatusCreated)
+	if stale(adminToken) != "true" || stale(anaToken) != "true" {
+		t.Error("los tokens no están desfasados tras cambiar las políticas")
+	}
+	srv.Do(t, http.MethodPut, bobPath, map[string]string{"name": "Bob"}, apitest.WithToken(adminToken)).Expect(t, http.StatusForbidden)
+	adminToken, claims = refresh(adminToken)
+	if strings.Join(claims.Permissions, ",") != "admin,users:read,users:delete" {
+		t.Errorf("claims renovados del administrador = %+v", claims)
+	}
+	srv.Do(t, http.MethodPut, bobPath, map[string]string{"name": "Bob"}, apitest.WithToken(adminToken)).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, bobPath, nil, apitest.WithToken(adminToken)).Expect(t, http.StatusOK)
+
+	var key struct {
+		Key string `json:"key"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/api-keys", map[string]string{"name": "backend"}, apitest.WithToken(adminToken)).
+		Expect(t, http.StatusCreated).JSON(t, &key)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil, apitest.WithAPIKey(key.Key)).Expect(t, http.StatusForbidden)
+}
+
+func TestTokenExchange(t *testing.T) {
+	srv := apitest.New(t)
+	developer := srv.CreateUser(t, "")
+	user := srv.CreateUser(t, "")
+	admin := srv.CreateUser(t, "admin")
+
+	register := func(name string) (string, string) {
+		t.Helper()
+		var registered struct {
+			Client       database.OAuthClient `json:"client"`
+			ClientSecret string               `json:"client_secret"`
+		}
+		srv.Do(t, http.MethodPost, "/api/v1/oauth/clients",
+			map[string]interface{}{"name": name, "redirect_uris": []string{"https://" + name + ".example.com/callback"}}, apitest.WithToken(developer.Token)).
+			Expect(t, http.StatusCreated).JSON(t, &registered)
+		return registered.Client.ClientID, registered.ClientSecret
+	}
+	gateway, gatewaySecret := register("gateway")
+	billing, billingSecret := register("billing")
+	outsider, outsiderSecret := register("outsider")
+	t.Setenv("TOKEN_EXCHANGE_CLIENTS", gateway+","+billing)
+
+	form := func(path, id, secret string, values url.Values, status int, v interface{}) {
+		t.Helper()
+		values.Set("client_id", id)
+		values.Set("client_secret", secret)
+		res := srv.Do(t, http.MethodPost, path, []byte(values.Encode()),
+			apitest.WithHeader("Content-Type", "application/x-www-form-urlencoded")).Expect(t, status)
+		if v != nil {
+			res.JSON(t, v)
+		}
+	}
+	exchangeOf := func(subject, audience, scope string) url.Values {
+		return url.Values{
+			"grant_type":         {oauth.GrantTypeTokenExchange},
+			"subject_token":      {subject},
+			"subject_token_type": {oauth.TokenTypeJWT},
+			"audience":           {audience},
+			"scope":              {scope},
+		}
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	// Solo los servicios internos canjean y solo para otro servicio interno
+	form("/api/v1/oauth/token", outsider, outsiderSecret, exchangeOf(user.Token, billing, "profile:read"), http.StatusBadRequest, &failure)
+	if failure.Error != oauth.UnauthorizedClient {
+		t.Fatalf("error = %q", failure.Error)
+	}
+	form("/api/v1/oauth/token", gateway, gatewaySecret, exchangeOf(user.Token, outsider, "profile:read"), http.StatusBadRequest, &failure)
+	if failure.Error != oauth.InvalidTarget {
+		t.Fatalf("error = %q", failure.Error)
+	}
+	form("/api/v1/oauth/token", gateway, gatewaySecret, exchangeOf("no-es-un-token", billing, "profile:read"), http.StatusBadRequest, &failure)
+	if failure.Error != oauth.InvalidGrant {
+		t.Fatalf("error = %q", failure.Error)
+	}
+
+	var token struct {
+		AccessToken     string `json:"access_token"`
+		RefreshToken    string `json:"refresh_token"`
+		IssuedTokenType string `json:"issued_token_type"`
+		ExpiresIn       int    `json:"expires_in"`
+		Scope           string `json:"scope"`
+	}
+	form("/api/v1/oauth/token", gateway, gatewaySecret, exchangeOf(user.Token, billing, "profile:read"), http.StatusOK, &token)
+	if token.AccessToken == "" || token.RefreshToken != "" || token.IssuedTokenType != oauth.TokenTypeAccessToken || token.Scope != "profile:read" || token.ExpiresIn > 300 {
+		t.Fatalf("token canjeado = %+v", token)
+	}
+	// Es para billing: esta API no lo acepta
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(token.AccessToken)).Expect(t, http.StatusUnauthorized)
+
+	var info services.Introspection
+	form("/api/v1/oauth/introspect", billing, billingSecret, url.Values{"token": {token.AccessToken}}, http.StatusOK, &info)
+	if !info.Active || info.Subject != itoa(user.ID) || info.Audience != billing || info.Actor == nil || info.Actor.Subject != gateway || info.Scope != "profile:read" {
+		t.Fatalf("introspección = %+v", info)
+	}
+	form("/api/v1/oauth/introspect", outsider, outsiderSecret, url.Values{"token": {token.AccessToken}}, http.StatusOK, &info)
+	if info.Active {
+		t.Fatal("un tercero puede consultar el token canjeado")
+	}
+
+	// billing lo vuelve a canjear, sin ampliar los scopes
+	again := exchangeOf(token.AccessToken, gateway, "profile:read profile:write")
+	again.Set("subject_token_type", oauth.TokenTypeAccessToken)
+	form("/api/v1/oauth/token", billing, billingSecret, again, http.StatusBadRequest, &failure)
+	if failure.Error != oauth.InvalidScope {
+		t.Fatalf("error = %q", failure.Error)
+	}
+	again.Del("scope")
+	form("/api/v1/oauth/token", billing, billingSecret, again, http.StatusOK, &token)
+	// gateway no es el destinatario del primero
+	form("/api/v1/oauth/token", gateway, gatewaySecret, again, http.StatusBadRequest, nil)
+
+	var audit struct {
+		Data []services.TokenExchangeEntry `json:"data"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/token-exchanges?user_id="+itoa(user.ID), nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK).JSON(t, &audit)
+	if len(audit.Data) != 2 || audit.Data[0].Service != billing || audit.Data[0].SubjectType != services.ExchangeSubjectOAuth ||
+		audit.Data[1].Service != gateway || audit.Data[1].Audience != billing || audit.Data[1].SubjectType != services.ExchangeSubjectSession {
+		t.Fatalf("registro de canjes = %+v", audit.Data)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/token-exchanges", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+}
+
+func TestRefreshCookie(t *testing.T) {
+	srv := apitest.New(t)
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+	user := srv.CreateUser(t, "")
+
+	refreshCookie := func(res *apitest.Response) *http.Cookie {
+		t.Helper()
+		for _, cookie := range res.Result().Cookies() {
+			if cookie.Name == "refresh_token" {
+				return cookie
+			}
+		}
+		t.Fatalf("sin cookie de renovación: %v", res.Header()["Set-Cookie"])
+		return nil
+	}
+	withCookie := func(cookie *http.Cookie) apitest.RequestOption {
+		return apitest.WithHeader("Cookie", cookie.Name+"="+cookie.Value)
+	}
+	var session struct {
+		Token     string `json:"token"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+
+	res := srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": user.Email, "password": apitest.Password},
+		apitest.WithHeader("X-Token-Delivery", "cookie")).Expect(t, http.StatusOK)
+	res.JSON(t, &session)
+	first := refreshCookie(res)
+	if session.ExpiresIn != 900 || !first.HttpOnly || first.SameSite != http.SameSiteStrictMode || strings.Contains(res.Body.String(), first.Value) {
+		t.Fatalf("login con cookie = %s; cookie = %+v", res.Body.String(), first)
+	}
+
+	// Caducado el token de acceso, la cookie da uno nuevo y se sustituye
+	now.Advance(16 * time.Minute)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(session.Token)).Expect(t, http.StatusUnauthorized)
+	res = srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil, withCookie(first)).Expect(t, http.StatusOK)
+	res.JSON(t, &session)
+	second := refreshCookie(res)
+	if second.Value == first.Value {
+		t.Fatal("la cookie de renovación no se sustituyó")
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(session.Token)).Expect(t, http.StatusOK)
+
+	// Justo después de renovar la anterior se rechaza (otra pestaña) sin más;
+	// más tarde, reutilizarla cierra la sesión
+	srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil, withCookie(first)).Expect(t, http.StatusUnauthorized)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(session.Token)).Expect(t, http.StatusOK)
+	now.Advance(time.Minute)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil, withCookie(first)).Expect(t, http.StatusUnauthorized)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil, withCookie(second)).Expect(t, http.StatusUnauthorized)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(session.Token)).Expect(t, http.StatusUnauthorized)
+
+	// Sin cookie se renueva con el token de sesión, como hasta ahora
+	srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/refresh", nil).Expect(t, http.StatusUnauthorized)
+}
+
+func TestOAuthDeviceFlow(t *testing.T) {
+	srv := apitest.New(t)
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+	developer := srv.CreateUser(t, "")
+	user := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+
+	var registered struct {
+		Client database.OAuthClient `json:"client"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/oauth/clients",
+		map[string]interface{}{"name": "CLI", "redirect_uris": []string{"http://localhost/cb"}, "public": true}, apitest.WithToken(developer.Token)).
+		Expect(t, http.StatusCreated).JSON(t, &registered)
+	clientID := registered.Client.ClientID
+
+	form := func(path string, values url.Values, status int, v interface{}) {
+		t.Helper()
+		values.Set("client_id", clientID)
+		res := srv.Do(t, http.MethodPost, path, []byte(values.Encode()),
+			apitest.WithHeader("Content-Type", "application/x-www-form-urlencoded")).Expect(t, status)
+		if v != nil {
+			res.JSON(t, v)
+		}
+	}
+	type deviceAuthorization struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		Interval                int    `json:"interval"`
+	}
+	start := func() deviceAuthorization {
+		t.Helper()
+		var device deviceAuthorization
+		form("/api/v1/oauth/device_authorization", url.Values{"scope": {"profile:read"}}, http.StatusOK, &device)
+		if device.DeviceCode == "" || len(device.UserCode) != 9 || !strings.Contains(device.VerificationURIComplete, "user_code=") || device.Interval != 5 {
+			t.Fatalf("autorización de dispositivo = %+v", device)
+		}
+		return device
+	}
+	poll := func(device deviceAuthorization, want string) string {
+		t.Helper()
+		var res struct {
+			Error       string `json:"error"`
+			AccessToken string `json:"access_token"`
+		}
+		status := http.StatusBadRequest
+		if want == "" {
+			status = http.StatusOK
+		}
+		form("/api/v1/oauth/token", url.Values{"grant_type": {oauth.GrantTypeDeviceCode}, "device_code": {device.DeviceCode}}, status, &res)
+		if res.Error != want {
+			t.Fatalf("error = %q, se esperaba %q", res.Error, want)
+		}
+		return res.AccessToken
+	}
+
+	device := start()
+	poll(device, oauth.AuthorizationPending)
+	poll(device, oauth.SlowDown)
+	// Cada slow_down alarga el intervalo 5 s: 10 s y luego 15 s
+	now.Advance(6 * time.Second)
+	poll(device, oauth.SlowDown)
+	now.Advance(16 * time.Second)
+	poll(device, oauth.AuthorizationPending)
+
+	// El usuario teclea el código como le venga bien
+	typed := strings.ToLower(strings.ReplaceAll(device.UserCode, "-", ""))
+	var pending struct {
+		Client struct {
+			Name string `json:"name"`
+		} `json:"client"`
+		Granted bool `json:"granted"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/oauth/device?user_code="+typed, nil, session).Expect(t, http.StatusOK).JSON(t, &pending)
+	if pending.Client.Name != "CLI" || pending.Granted {
+		t.Fatalf("dispositivo pendiente = %+v", pending)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/oauth/device?user_code=BCDF-GHJK", nil, session).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPost, "/api/v1/oauth/device", map[string]interface{}{"user_code": typed, "approve": true}, session).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/oauth/device", map[string]interface{}{"user_code": typed, "approve": true}, session).Expect(t, http.StatusNotFound)
+
+	token := poll(device, "")
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(token)).Expect(t, http.StatusOK)
+	poll(device, oauth.InvalidGrant)
+
+	denied := start()
+	srv.Do(t, http.MethodPost, "/api/v1/oauth/device", map[string]interface{}{"user_code": denied.UserCode, "approve": false}, session).Expect(t, http.StatusOK)
+	poll(denied, oauth.AccessDenied)
+
+	expired := start()
+	now.Advance(11 * time.Minute)
+	poll(expired, oauth.ExpiredToken)
+	srv.Do(t, http.MethodGet, "/api/v1/oauth/device?user_code="+expired.UserCode, nil, session).Expect(t, http.StatusNotFound)
+}
+
+func TestMagicLink(t *testing.T) {
+	srv := apitest.New(t)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	t.Cleanup(func() { mail.Default = mail.LogMailer{} })
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+
+	user := srv.CreateUser(t, "")
+	firefox := apitest.WithHeader("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	iphone := apitest.WithHeader("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) Mobile/15E148 Safari/604.1")
+	request := func(email string, opts ...apitest.RequestOption) *apitest.Response {
+		return srv.Do(t, http.MethodPost, "/api/v1/auth/magic-link", map[string]string{"email": email}, opts...)
+	}
+	linkPattern := regexp.MustCompile(`/api/v1/auth/magic-link/verify\?token=\S+`)
+	lastLink := func() string {
+		mailer.mu.Lock()
+		defer mailer.mu.Unlock()
+		return linkPattern.FindString(mailer.bodies[len(mailer.bodies)-1])
+	}
+
+	// Un email sin cuenta responde igual pero no recibe nada
+	request("nadie@example.com", firefox).Expect(t, http.StatusAccepted)
+	if mailer.count() != 0 {
+		t.Fatalf("se envió un enlace a un email sin cuenta")
+	}
+
+	request(strings.ToUpper(user.Email), firefox).Expect(t, http.StatusAccepted)
+	link := lastLink()
+	if link == "" {
+		t.Fatal("el correo no incluye el enlace")
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.Do(t, http.MethodGet, link, nil, firefox).Expect(t, http.StatusOK).JSON(t, &login)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK)
+	// Un solo uso
+	srv.Do(t, http.MethodGet, link, nil, firefox).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodGet, "/api/v1/auth/magic-link/verify?token="+login.Token, nil).Expect(t, http.StatusBadRequest)
+
+	// En otro dispositivo hay que confirmar después de ver desde dónde se pidió
+	request(user.Email, firefox).Expect(t, http.StatusAccepted)
+	link = lastLink()
+	var pending struct {
+		ConfirmationRequired bool `json:"confirmation_required"`
+		RequestedFrom        struct {
+			Device string `json:"device"`
+		} `json:"requested_from"`
+	}
+	srv.Do(t, http.MethodGet, link, nil, iphone).Expect(t, http.StatusConflict).JSON(t, &pending)
+	if !pending.ConfirmationRequired || pending.RequestedFrom.Device != "Firefox en Linux" {
+		t.Fatalf("confirmación = %+v", pending)
+	}
+	srv.Do(t, http.MethodGet, link+"&confirm=true", nil, iphone).Expect(t, http.StatusOK)
+
+	// Tres enlaces por hora para un mismo email, desde cualquier IP
+	request(user.Email, firefox).Expect(t, http.StatusAccepted)
+	request(user.Email, firefox, apitest.WithClientIP("198.51.100.7")).Expect(t, http.StatusTooManyRequests)
+
+	// Caduca a los 15 minutos
+	now.Advance(time.Hour)
+	request(user.Email, firefox).Expect(t, http.StatusAccepted)
+	link = lastLink()
+	now.Advance(16 * time.Minute)
+	srv.Do(t, http.MethodGet, link, nil, firefox).Expect(t, http.StatusBadRequest)
+
+	// Límite por IP, con cualquier email
+	for i := 0; i < 9; i++ {
+		request("otro"+itoa(uint(i))+"@example.com", firefox).Expect(t, http.StatusAccepted)
+	}
+	resp := request("otro@example.com", firefox).Expect(t, http.StatusTooManyRequests)
+	if resp.Header().Get("Retry-After") == "" {
+		t.Error("falta Retry-After")
+	}
+}
+
+func TestLoginCode(t *testing.T) {
+	srv := apitest.New(t)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	t.Cleanup(func() { mail.Default = mail.LogMailer{} })
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+
+	user := srv.CreateUser(t, "")
+	codePattern := regexp.MustCompile(`\b\d{6}\b`)
+	request := func() string {
+		srv.Do(t, http.MethodPost, "/api/v1/auth/code", map[string]string{"email": user.Email}).Expect(t, http.StatusAccepted)
+		mailer.mu.Lock()
+		defer mailer.mu.Unlock()
+		return codePattern.FindString(mailer.bodies[len(mailer.bodies)-1])
+	}
+	verify := func(code string) *apitest.Response {
+		return srv.Do(t, http.MethodPost, "/api/v1/auth/code/verify", map[string]string{"email": user.Email, "code": code})
+	}
+	wrong := func(code string) string {
+		if code == "000000" {
+			return "111111"
+		}
+		return "000000"
+	}
+
+	code := request()
+	if code == "" {
+		t.Fatal("el correo no incluye el código")
+	}
+	verify(wrong(code)).Expect(t, http.StatusUnauthorized)
+	var login struct {
+		Token string `json:"token"`
+	}
+	verify(code).Expect(t, http.StatusOK).JSON(t, &login)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK)
+	verify(code).Expect(t, http.StatusUnauthorized)
+
+	// Agotados los intentos ni el código correcto sirve
+	code = request()
+	for i := 0; i < 5; i++ {
+		verify(wrong(code)).Expect(t, http.StatusUnauthorized)
+	}
+	verify(code).Expect(t, http.StatusUnauthorized)
+
+	// Caduca a los 10 minutos
+	code = request()
+	now.Advance(11 * time.Minute)
+	verify(code).Expect(t, http.StatusUnauthorized)
+}
+
+func TestPwnedPassword(t *testing.T) {
+	srv := apitest.New(t)
+	sum := sha1.Sum([]byte("Filtrada123"))
+	breached := strings.ToUpper(hex.EncodeToString(sum[:]))
+	hibp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/"+breached[:5]) {
+			fmt.Fprintf(w, "%s:42\r\n", breached[5:])
+		}
+	}))
+	t.Setenv("PWNED_PASSWORDS", "true")
+	t.Setenv("PWNED_PASSWORDS_URL", hibp.URL)
+	register := func(email, password string) *apitest.Response {
+		return srv.Do(t, http.MethodPost, "/api/v1/auth/register", map[string]string{"email": email, "password": password, "name": "Ana"})
+	}
+
+	register("filtrada@example.com", "Filtrada123").Expect(t, http.StatusBadRequest)
+	register("segura@example.com", "Xq7vR2mLp9zK").Expect(t, http.StatusCreated)
+
+	// Sin el servicio se acepta salvo con PWNED_PASSWORDS_FAIL=closed
+	hibp.Close()
+	register("abierto@example.com", "Filtrada123").Expect(t, http.StatusCreated)
+	t.Setenv("PWNED_PASSWORDS_FAIL", "closed")
+	register("cerrado@example.com", "Xq7vR2mLp9zK").Expect(t, http.StatusServiceUnavailable)
+}
+
+func TestPasswordExpiry(t *testing.T) {
+	srv := apitest.New(t)
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+	t.Setenv("PASSWORD_MAX_AGE_DAYS", "90")
+
+	login := func(email, password string) (string, bool) {
+		var res struct {
+			Token                  string `json:"token"`
+			PasswordChangeRequired bool   `json:"password_change_required"`
+		}
+		srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": email, "password": password}).
+			Expect(t, http.StatusOK).JSON(t, &res)
+		return res.Token, res.PasswordChangeRequired
+	}
+	change := func(token, current, next string) *apitest.Response {
+		return srv.Do(t, http.MethodPost, "/api/v1/profile/password",
+			map[string]string{"current_password": current, "new_password": next}, apitest.WithToken(token))
+	}
+
+	// Rotación exigida por un administrador: bloquea también las sesiones abiertas
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	srv.Do(t, http.MethodGet, "/api/v1/profile/sessions", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/users/"+itoa(user.ID)+"/require-password-change", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile/sessions", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+	if _, required := login(user.Email, apitest.Password); !required {
+		t.Error("el inicio de sesión no indica que hay que cambiar la contraseña")
+	}
+	change(user.Token, "incorrecta1", "Nueva12345").Expect(t, http.StatusBadRequest)
+	change(user.Token, apitest.Password, apitest.Password).Expect(t, http.StatusBadRequest)
+	change(user.Token, apitest.Password, "Nueva12345").Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile/sessions", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+
+	// Caducidad: pasados 90 días desde el último cambio
+	now.Advance(91 * 24 * time.Hour)
+	token, required := login(user.Email, "Nueva12345")
+	if !required {
+		t.Fatal("la contraseña caducada no exige cambiarla")
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile/sessions", nil, apitest.WithToken(token)).Expect(t, http.StatusForbidden)
+	change(token, "Nueva12345", "Otra123456").Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile/sessions", nil, apitest.WithToken(token)).Expect(t, http.StatusOK)
+	if _, required := login(user.Email, "Otra123456"); required {
+		t.Error("tras cambiarla se sigue exigiendo el cambio de contraseña")
+	}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	login := func() *apitest.Response {
+		return srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": user.Email, "password": apitest.Password})
+	}
+	set := func(id uint, action string) *apitest.Response {
+		return srv.Do(t, http.MethodPost, "/api/v1/admin/users/"+itoa(id)+"/"+action, nil, apitest.WithToken(admin.Token))
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+	set(user.ID, "deactivate").Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusUnauthorized)
+	login().Expect(t, http.StatusForbidden)
+	var revoked int64
+	database.DB.Model(&database.Session{}).Where("user_id = ? AND revoked_at IS NOT NULL", user.ID).Count(&revoked)
+	if revoked == 0 {
+		t.Error("no se cerraron las sesiones del usuario desactivado")
+	}
+
+	set(admin.ID, "deactivate").Expect(t, http.StatusBadRequest)
+	set(999999, "deactivate").Expect(t, http.StatusNotFound)
+
+	// Al reactivarla se puede volver a entrar, pero las sesiones cerradas no vuelven
+	set(user.ID, "activate").Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusUnauthorized)
+	login().Expect(t, http.StatusOK)
+}
+
+func TestSuspension(t *testing.T) {
+	srv := apitest.New(t)
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	adminDo := func(method, path string, body interface{}) *apitest.Response {
+		return srv.Do(t, method, "/api/v1/admin"+path, body, apitest.WithToken(admin.Token))
+	}
+	userDo := func(method, path string, body interface{}) *apitest.Response {
+		return srv.Do(t, method, "/api/v1"+path, body, apitest.WithToken(user.Token))
+	}
+	base := "/users/" + itoa(user.ID)
+
+	adminDo(http.MethodPost, base+"/suspend", map[string]string{"reason": "Spam"}).Expect(t, http.StatusCreated)
+	adminDo(http.MethodPost, base+"/suspend", map[string]string{"reason": "Otra vez"}).Expect(t, http.StatusConflict)
+	adminDo(http.MethodPost, "/users/"+itoa(admin.ID)+"/suspend", map[string]string{"reason": "Yo"}).Expect(t, http.StatusBadRequest)
+
+	var blocked struct {
+		Suspension struct {
+			Reason string `json:"reason"`
+		} `json:"suspension"`
+	}
+	userDo(http.MethodGet, "/profile", nil).Expect(t, http.StatusForbidden).JSON(t, &blocked)
+	if blocked.Suspension.Reason != "Spam" {
+		t.Errorf("motivo = %q", blocked.Suspension.Reason)
+	}
+	userDo(http.MethodGet, "/profile/suspension", nil).Expect(t, http.StatusOK)
+	var login struct {
+		Suspension *struct{} `json:"suspension"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": user.Email, "password": apitest.Password}).
+		Expect(t, http.StatusOK).JSON(t, &login)
+	if login.Suspension == nil {
+		t.Error("el login no indica la suspensión")
+	}
+
+	// Apelación y revisión
+	userDo(http.MethodPost, "/profile/suspension/appeal", map[string]string{"message": "No fui yo"}).Expect(t, http.StatusCreated)
+	userDo(http.MethodPost, "/profile/suspension/appeal", map[string]string{"message": "De verdad"}).Expect(t, http.StatusConflict)
+	var appeals struct {
+		Data []struct {
+			UserID uint `json:"user_id"`
+		} `json:"data"`
+	}
+	adminDo(http.MethodGet, "/suspensions/appeals", nil).Expect(t, http.StatusOK).JSON(t, &appeals)
+	if len(appeals.Data) != 1 || appeals.Data[0].UserID != user.ID {
+		t.Errorf("apelaciones pendientes = %+v", appeals.Data)
+	}
+	adminDo(http.MethodPost, base+"/suspension/appeal/reject", map[string]string{}).Expect(t, http.StatusBadRequest)
+	adminDo(http.MethodPost, base+"/suspension/appeal/reject", map[string]string{"note": "Hay pruebas"}).Expect(t, http.StatusOK)
+	adminDo(http.MethodPost, base+"/suspension/appeal/reject", map[string]string{"note": "Otra"}).Expect(t, http.StatusConflict)
+	adminDo(http.MethodPost, base+"/suspension/lift", nil).Expect(t, http.StatusOK)
+	userDo(http.MethodGet, "/profile", nil).Expect(t, http.StatusOK)
+	adminDo(http.MethodPost, base+"/suspension/lift", nil).Expect(t, http.StatusNotFound)
+
+	var history struct {
+		Suspensions []struct {
+			Actions []struct {
+				Action string `json:"action"`
+			} `json:"actions"`
+		} `json:"suspensions"`
+	}
+	adminDo(http.MethodGet, base+"/suspensions", nil).Expect(t, http.StatusOK).JSON(t, &history)
+	if len(history.Suspensions) != 1 || len(history.Suspensions[0].Actions) != 4 {
+		t.Fatalf("historial = %+v", history.Suspensions)
+	}
+
+	// Con fin, acaba sola
+	until := now.Now().Add(time.Hour)
+	adminDo(http.MethodPost, base+"/suspend", map[string]interface{}{"reason": "Un rato", "until": until}).Expect(t, http.StatusCreated)
+	userDo(http.MethodGet, "/profile", nil).Expect(t, http.StatusForbidden)
+	now.Advance(2 * time.Hour)
+	userDo(http.MethodGet, "/profile", nil).Expect(t, http.StatusOK)
+}
+
+func TestRestrictedAccount(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	token := apitest.WithToken(user.Token)
+	update := map[string]string{"bio": "Hola"}
+
+	srv.Do(t, http.MethodPost, "/api/v1/admin/users/"+itoa(user.ID)+"/restrict", map[string]string{"reason": "Spam"}, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK)
+	var login struct {
+		Restricted bool `json:"restricted"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": user.Email, "password": apitest.Password}).
+		Expect(t, http.StatusOK).JSON(t, &login)
+	if !login.Restricted {
+		t.Error("el login no indica la restricción")
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, token).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, "/api/v1/profile", update, token).Expect(t, http.StatusForbidden)
+
+	// También dentro de un lote y en GraphQL, donde las consultas siguen funcionando
+	var batch struct {
+		Responses []struct {
+			Status int `json:"status"`
+		} `json:"responses"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/batch", map[string]interface{}{"requests": []map[string]interface{}{
+		{"method": "GET", "path": "/api/v1/profile"},
+		{"method": "PUT", "path": "/api/v1/profile", "body": update},
+	}}, token).Expect(t, http.StatusOK).JSON(t, &batch)
+	if len(batch.Responses) != 2 || batch.Responses[0].Status != http.StatusOK || batch.Responses[1].Status != http.StatusForbidden {
+		t.Errorf("lote = %+v", batch.Responses)
+	}
+	var gql struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	srv.Do(t, http.MethodPost, "/graphql", map[string]string{"query": "{ profile { id } }"}, token).Expect(t, http.StatusOK).JSON(t, &gql)
+	if len(gql.Errors) > 0 {
+		t.Errorf("consulta rechazada: %+v", gql.Errors)
+	}
+	mutation := `mutation { updateUser(id: "` + itoa(user.ID) + `", input: {name: "Otro"}) { id } }`
+	srv.Do(t, http.MethodPost, "/graphql", map[string]string{"query": mutation}, token).JSON(t, &gql)
+	if len(gql.Errors) == 0 {
+		t.Error("la mutación de una cuenta restringida no se rechazó")
+	}
+
+	srv.Do(t, http.MethodPost, "/api/v1/admin/users/"+itoa(user.ID)+"/unrestrict", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, "/api/v1/profile", update, token).Expect(t, http.StatusOK)
+}
+
+func TestTermsGating(t *testing.T) {
+	srv := apitest.New(t)
+	t.Cleanup(func() { terms.Set(terms.Terms{}) })
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	token := apitest.WithToken(user.Token)
+
+	srv.Do(t, http.MethodPut, "/api/v1/admin/terms", map[string]string{"version": "v1", "url": "https://example.com/terminos"}, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK)
+
+	var blocked struct {
+		TermsRequired bool        `json:"terms_required"`
+		Terms         terms.Terms `json:"terms"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile/settings", nil, token).Expect(t, http.StatusForbidden).JSON(t, &blocked)
+	if !blocked.TermsRequired || blocked.Terms.Version != "v1" || blocked.Terms.URL == "" {
+		t.Errorf("respuesta = %+v", blocked)
+	}
+	// El propio administrador que los publica también tiene que aceptarlos
+	srv.Do(t, http.MethodGet, "/api/v1/admin/terms", nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusForbidden)
+
+	var login struct {
+		TermsRequired bool `json:"terms_required"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": user.Email, "password": apitest.Password}).
+		Expect(t, http.StatusOK).JSON(t, &login)
+	if !login.TermsRequired {
+		t.Error("el login no indica los términos pendientes")
+	}
+
+	srv.Do(t, http.MethodGet, "/api/v1/terms", nil).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, token).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/profile/terms", map[string]string{"version": "v0"}, token).Expect(t, http.StatusConflict)
+	srv.Do(t, http.MethodPost, "/api/v1/profile/terms", map[string]string{"version": "v1"}, token).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile/settings", nil, token).Expect(t, http.StatusOK)
+
+	// Una versión nueva vuelve a exigir la aceptación
+	if err := terms.Set(terms.Terms{Version: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile/settings", nil, token).Expect(t, http.StatusForbidden)
+}
+
+func TestVerification(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	token := apitest.WithToken(user.Token)
+	adminToken := apitest.WithToken(admin.Token)
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(user.ID), map[string]string{"username": "verificable"}, token).
+		Expect(t, http.StatusOK)
+	evidence := map[string]interface{}{"evidence": "Soy yo", "links": []string{"https://example.com/yo"}}
+
+	var request struct {
+		ID     uint   `json:"id"`
+		Status string `json:"status"`
+		Notes  string `json:"notes"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/profile/verification", evidence, token).Expect(t, http.StatusCreated).JSON(t, &request)
+	srv.Do(t, http.MethodPost, "/api/v1/profile/verification", evidence, token).Expect(t, http.StatusConflict)
+	first := itoa(request.ID)
+
+	// Rechazar exige una nota, que luego ve el usuario
+	srv.Do(t, http.MethodPost, "/api/v1/admin/verifications/"+first+"/reject", nil, adminToken).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/verifications/"+first+"/reject", map[string]string{"notes": "Faltan pruebas"}, adminToken).
+		Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile/verification", nil, token).Expect(t, http.StatusOK).JSON(t, &request)
+	if request.Status != "rejected" || request.Notes != "Faltan pruebas" {
+		t.Errorf("solicitud = %+v", request)
+	}
+	// Una rechazada ya no se puede aprobar
+	srv.Do(t, http.MethodPost, "/api/v1/admin/verifications/"+first+"/approve", nil, adminToken).Expect(t, http.StatusConflict)
+
+	srv.Do(t, http.MethodPost, "/api/v1/profile/verification", evidence, token).Expect(t, http.StatusCreated).JSON(t, &request)
+	var pending struct {
+		Data []struct {
+			ID uint `json:"id"`
+		} `json:"data"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/verifications", nil, adminToken).Expect(t, http.StatusOK).JSON(t, &pending)
+	if len(pending.Data) != 1 || pending.Data[0].ID != request.ID {
+		t.Errorf("pendientes = %+v", pending.Data)
+	}
+	second := itoa(request.ID)
+	srv.Do(t, http.MethodPost, "/api/v1/admin/verifications/"+second+"/approve", nil, adminToken).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, "/api/v1/profile/verification", nil, token).Expect(t, http.StatusConflict)
+
+	var profile struct {
+		Verified bool `json:"verified"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/u/verificable", nil).Expect(t, http.StatusOK).JSON(t, &profile)
+	if !profile.Verified {
+		t.Error("el perfil público no indica la verificación")
+	}
+
+	srv.Do(t, http.MethodPost, "/api/v1/admin/verifications/"+second+"/revoke", map[string]string{"notes": "Suplantación"}, adminToken).
+		Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/u/verificable", nil).Expect(t, http.StatusOK).JSON(t, &profile)
+	if profile.Verified {
+		t.Error("la verificación revocada sigue en el perfil público")
+	}
+}
+
+func TestUserTags(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	beta := srv.CreateUser(t, "")
+	other := srv.CreateUser(t, "")
+	adminToken := apitest.WithToken(admin.Token)
+
+	var tags struct {
+		Tags []string `json:"tags"`
+	}
+	srv.Do(t, http.MethodPut, "/api/v1/admin/users/"+itoa(beta.ID)+"/tags/Beta", nil, adminToken).
+		Expect(t, http.StatusOK).JSON(t, &tags)
+	if len(tags.Tags) != 1 || tags.Tags[0] != "beta" {
+		t.Errorf("etiquetas = %v", tags.Tags)
+	}
+	srv.Do(t, http.MethodPut, "/api/v1/admin/users/"+itoa(beta.ID)+"/tags/no%20vale", nil, adminToken).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPut, "/api/v1/admin/users/99999/tags/beta", nil, adminToken).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPut, "/api/v1/admin/users/"+itoa(beta.ID)+"/tags/beta", nil, apitest.WithToken(other.Token)).
+		Expect(t, http.StatusForbidden)
+
+	// En bloque: las que ya estaban no cuentan y los IDs inexistentes se devuelven
+	var bulk struct {
+		Users   int    `json:"users"`
+		Missing []uint `json:"missing"`
+		Added   int64  `json:"added"`
+	}
+	body := map[string]interface{}{"user_ids": []uint{beta.ID, other.ID, 99999}, "add": []string{"beta", "vip"}}
+	srv.Do(t, http.MethodPost, "/api/v1/admin/tags/bulk", body, adminToken).Expect(t, http.StatusOK).JSON(t, &bulk)
+	if bulk.Users != 2 || bulk.Added != 3 || len(bulk.Missing) != 1 || bulk.Missing[0] != 99999 {
+		t.Errorf("asignación en bloque = %+v", bulk)
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/admin/tags/bulk", map[string]interface{}{"user_ids": []uint{beta.ID}}, adminToken).
+		Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodDelete, "/api/v1/admin/users/"+itoa(other.ID)+"/tags/vip", nil, adminToken).Expect(t, http.StatusOK).JSON(t, &tags)
+	if len(tags.Tags) != 1 || tags.Tags[0] != "beta" {
+		t.Errorf("etiquetas tras quitar vip = %v", tags.Tags)
+	}
+
+	// El filtro exige todas las etiquetas y es solo para administradores
+	var users struct {
+		Data []struct {
+			ID       uint `json:"ID"`
+			Included struct {
+				Tags []string `json:"tags"`
+			} `json:"included"`
+		} `json:"data"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v2/users?tag=beta,vip&include=tags", nil, adminToken).Expect(t, http.StatusOK).JSON(t, &users)
+	if len(users.Data) != 1 || users.Data[0].ID != beta.ID || len(users.Data[0].Included.Tags) != 2 {
+		t.Errorf("usuarios beta y vip = %+v", users.Data)
+	}
+	srv.Do(t, http.MethodGet, "/api/v2/users?tag=beta", nil, adminToken).Expect(t, http.StatusOK).JSON(t, &users)
+	if len(users.Data) != 2 {
+		t.Errorf("usuarios beta = %+v", users.Data)
+	}
+	srv.Do(t, http.MethodGet, "/api/v2/users?tag=beta", nil, apitest.WithToken(other.Token)).Expect(t, http.StatusForbidden)
+	csv := srv.Do(t, http.MethodGet, "/api/v1/admin/users/export.csv?tag=vip", nil, adminToken).Expect(t, http.StatusOK).Body.String()
+	if lines := strings.Count(csv, "\n"); lines != 2 {
+		t.Errorf("CSV de vip con %d líneas:\n%s", lines, csv)
+	}
+
+	var list struct {
+		Tags []struct {
+			Name  string `json:"name"`
+			Users int64  `json:"users"`
+		} `json:"tags"`
+	}
+	srv.Do(t, http.MethodDelete, "/api/v1/admin/tags/vip", nil, adminToken).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodDelete, "/api/v1/admin/tags/vip", nil, adminToken).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/tags", nil, adminToken).Expect(t, http.StatusOK).JSON(t, &list)
+	if len(list.Tags) != 1 || list.Tags[0].Name != "beta" || list.Tags[0].Users != 2 {
+		t.Errorf("etiquetas = %+v", list.Tags)
+	}
+}
+
+func TestUserMetadata(t *testing.T) {
+	t.Setenv("USER_METADATA_MAX_BYTES", "256")
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+	userToken := apitest.WithToken(user.Token)
+	path := "/api/v1/users/" + itoa(user.ID) + "/metadata"
+
+	var values struct {
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	get := func(opt apitest.RequestOption) map[string]interface{} {
+		values.Metadata = nil
+		srv.Do(t, http.MethodGet, path, nil, opt).Expect(t, http.StatusOK).JSON(t, &values)
+		return values.Metadata
+	}
+	if m := get(userToken); m == nil || len(m) != 0 {
+		t.Errorf("metadatos iniciales = %v", m)
+	}
+
+	// PATCH combina y null quita la clave
+	body := map[string]interface{}{"metadata": map[string]interface{}{"crm_id": "A-1", "seats": 5, "segments": []string{"a"}}}
+	srv.Do(t, http.MethodPatch, path, body, userToken).Expect(t, http.StatusOK)
+	body = map[string]interface{}{"metadata": map[string]interface{}{"seats": nil, "beta": true}}
+	srv.Do(t, http.MethodPatch, path, body, userToken).Expect(t, http.StatusOK)
+	if m := get(userToken); len(m) != 3 || m["crm_id"] != "A-1" || m["beta"] != true || m["seats"] != nil {
+		t.Errorf("metadatos tras combinar = %v", m)
+	}
+
+	// Claves, valores y tamaño inválidos
+	for name, invalid := range map[string]interface{}{
+		"clave":  map[string]interface{}{"CrmId": "x"},
+		"objeto": map[string]interface{}{"address": map[string]string{"city": "Madrid"}},
+		"tamaño": map[string]interface{}{"notes": strings.Repeat("x", 300)},
+	} {
+		if res := srv.Do(t, http.MethodPatch, path, map[string]interface{}{"metadata": invalid}, userToken); res.Code != http.StatusBadRequest {
+			t.Errorf("%s: código %d, se esperaba 400", name, res.Code)
+		}
+	}
+	srv.Do(t, http.MethodPatch, path, map[string]interface{}{}, userToken).Expect(t, http.StatusBadRequest)
+
+	// Otro usuario no puede leerlos ni cambiarlos
+	other := apitest.WithToken(srv.CreateUser(t, "").Token)
+	srv.Do(t, http.MethodGet, path, nil, other).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, path, map[string]interface{}{"metadata": map[string]interface{}{}}, other).Expect(t, http.StatusForbidden)
+
+	// PUT sustituye; el cambio del administrador queda en el historial
+	body = map[string]interface{}{"metadata": map[string]interface{}{"crm_id": "B-2"}}
+	srv.Do(t, http.MethodPut, path, body, apitest.WithToken(admin.Token)).Expect(t, http.StatusOK)
+	if m := get(userToken); len(m) != 1 || m["crm_id"] != "B-2" {
+		t.Errorf("metadatos tras sustituir = %v", m)
+	}
+	var history struct {
+		Data []struct {
+			Action  string `json:"action"`
+			Changes []struct {
+				Field string `json:"field"`
+			} `json:"changes"`
+		} `json:"data"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/users/"+itoa(user.ID)+"/history", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK).JSON(t, &history)
+	if len(history.Data) != 1 || history.Data[0].Action != "metadata" || len(history.Data[0].Changes) != 3 {
+		t.Errorf("historial = %+v", history.Data)
+	}
+
+	// PATCH simultáneos con claves distintas: no se pierde ninguna
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			res := srv.Do(t, http.MethodPatch, path, map[string]interface{}{"metadata": map[string]interface{}{key: true}}, userToken)
+			if res.Code != http.StatusOK {
+				t.Errorf("PATCH %s: código %d: %s", key, res.Code, res.Body.String())
+			}
+		}(fmt.Sprintf("flag_%d", i))
+	}
+	wg.Wait()
+	if m := get(userToken); len(m) != 9 {
+		t.Errorf("metadatos tras los PATCH simultáneos = %v", m)
+	}
+}
+
+func TestCompleteUploadOnce(t *testing.T) {
+	srv := apitest.New(t)
+	token := apitest.WithToken(srv.CreateUser(t, "").Token)
+
+	var session struct {
+		ID string `json:"id"`
+	}
+	// Varias partes para que ensamblar el archivo lleve su tiempo
+	t.Setenv("UPLOAD_CHUNK_SIZE", strconv.Itoa(1<<20))
+	part := bytes.Repeat([]byte("x"), 1<<20)
+	srv.Do(t, http.MethodPost, "/api/v1/uploads", map[string]interface{}{"filename": "informe.txt", "content_type": "text/plain", "total_size": 8 << 20}, token).
+		Expect(t, http.StatusCreated).JSON(t, &session)
+	for n := 1; n <= 8; n++ {
+		srv.Do(t, http.MethodPut, "/api/v1/uploads/"+session.ID+"/parts/"+strconv.Itoa(n), part, token).Expect(t, http.StatusOK)
+	}
+
+	// Varias peticiones a la vez: solo una ensambla el archivo
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	codes := map[int]int{}
+	assembled := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := srv.Do(t, http.MethodPost, "/api/v1/uploads/"+session.ID+"/complete", nil, token)
+			mu.Lock()
+			defer mu.Unlock()
+			codes[res.Code]++
+			if strings.Contains(res.Body.String(), "Subida completada exitosamente") {
+				assembled++
+			}
+		}()
+	}
+	wg.Wait()
+	if assembled != 1 || codes[http.StatusOK]+codes[http.StatusConflict] != 8 {
+		t.Errorf("ensamblados = %d, códigos = %v", assembled, codes)
+	}
+	srv.Do(t, http.MethodDelete, "/api/v1/uploads/"+session.ID, nil, token).Expect(t, http.StatusOK)
+}
+
+func TestVersionedErrors(t *testing.T) {
+	srv := apitest.New(t)
+
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v2/profile", nil).Expect(t, http.StatusUnauthorized).JSON(t, &body)
+	if body.Error.Code != "unauthorized" || body.Error.Message == "" {
+		t.Errorf("error v2 = %+v", body.Error)
+	}
+}
+
+func TestCaptcha(t *testing.T) {
+	srv := apitest.New(t)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success": ` + strconv.FormatBool(r.FormValue("response") == "humano") + `}`))
+	}))
+	defer provider.Close()
+	t.Setenv("CAPTCHA_PROVIDER", "turnstile")
+	t.Setenv("CAPTCHA_SECRET", "secreto")
+	t.Setenv("CAPTCHA_VERIFY_URL", provider.URL)
+	t.Setenv("CAPTCHA_LOGIN_FAILURES", "2")
+
+	register := map[string]string{"email": "eva@example.com", "password": "Secreto123", "name": "Eva"}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", register).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", register,
+		apitest.WithHeader("X-Captcha-Token", "robot")).Expect(t, http.StatusBadRequest)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", register,
+		apitest.WithHeader("X-Captcha-Token", "humano")).Expect(t, http.StatusCreated)
+
+	// Tras dos intentos fallidos el login exige CAPTCHA, aunque la contraseña sea correcta
+	credentials := map[string]string{"email": "eva@example.com", "password": "Secreto123"}
+	for i := 0; i < 2; i++ {
+		srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{
+			"email": "eva@example.com", "password": "incorrecta",
+		}).Expect(t, http.StatusUnauthorized)
+	}
+	var body struct {
+		CaptchaRequired bool `json:"captcha_required"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusBadRequest).JSON(t, &body)
+	if !body.CaptchaRequired {
+		t.Error("la respuesta no indica captcha_required")
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials,
+		apitest.WithHeader("X-Captcha-Token", "humano")).Expect(t, http.StatusOK)
+
+	// Las claves de confianza no necesitan CAPTCHA (admin: el plan free no incluye claves de API)
+	owner := srv.CreateUser(t, "admin")
+	var created struct {
+		Key    string `json:"key"`
+		APIKey struct {
+			ID uint `json:"id"`
+		} `json:"api_key"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/api-keys", map[string]string{"name": "backend"},
+		apitest.WithToken(owner.Token)).Expect(t, http.StatusCreated).JSON(t, &created)
+	other := map[string]string{"email": "leo@example.com", "password": "Secreto123", "name": "Leo"}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", other,
+		apitest.WithAPIKey(created.Key)).Expect(t, http.StatusBadRequest)
+	t.Setenv("CAPTCHA_TRUSTED_API_KEYS", itoa(created.APIKey.ID))
+	srv.Do(t, http.MethodPost, "/api/v1/auth/register", other,
+		apitest.WithAPIKey(created.Key)).Expect(t, http.StatusCreated)
+}
+
+func TestVerboseHealth(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+
+	// La comprobación simple es pública y no incluye el diagnóstico
+	var simple map[string]interface{}
+	srv.Do(t, http.MethodGet, "/api/v1/health", nil).Expect(t, http.StatusOK).JSON(t, &simple)
+	if _, ok := simple["checks"]; ok {
+		t.Errorf("health = %v", simple)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/health?verbose=1", nil).Expect(t, http.StatusUnauthorized)
+	srv.Do(t, http.MethodGet, "/api/v1/health?verbose=1", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+
+	var verbose struct {
+		Status string                   `json:"status"`
+		Checks map[string]health.Result `json:"checks"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/health?verbose=1", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK).JSON(t, &verbose)
+	if verbose.Status != "OK" {
+		t.Errorf("status = %q", verbose.Status)
+	}
+	for name, want := range map[string]string{"database": "ok", "migrations": "ok", "storage": "ok", "redis": "disabled", "mail": "disabled", "stripe": "disabled"} {
+		if got := verbose.Checks[name].Status; got != want {
+			t.Errorf("%s = %q, se esperaba %q", name, got, want)
+		}
+	}
+
+	// Desde fuera de las IPs de administración tampoco
+	t.Setenv("ADMIN_ALLOW_IPS", "10.8.0.0/16")
+	srv.Do(t, http.MethodGet, "/api/v1/health?verbose=1", nil, apitest.WithToken(admin.Token), apitest.WithClientIP("203.0.113.9")).
+		Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/health", nil, apitest.WithClientIP("203.0.113.9")).Expect(t, http.StatusOK)
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	user := srv.CreateUser(t, "")
+
+	t.Setenv("CIRCUIT_BREAKER_FAILURES", "2")
+	circuit := breaker.Get("test." + t.Name())
+	for i := 0; i < 2; i++ {
+		circuit.Do(func() error { return errors.New("timeout") })
+	}
+
+	var res struct {
+		CircuitBreakers []breaker.Stats `json:"circuit_breakers"`
+		Threshold       int             `json:"threshold"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/circuit-breakers", nil, apitest.WithToken(admin.Token)).
+		Expect(t, http.StatusOK).JSON(t, &res)
+	found := false
+	for _, s := range res.CircuitBreakers {
+		if s.Name == "test."+t.Name() {
+			found = s.State == breaker.Open && s.Failures == 2 && s.LastError == "timeout"
+		}
+	}
+	if !found || res.Threshold != 2 {
+		t.Errorf("circuitos = %+v", res)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/circuit-breakers", nil, apitest.WithToken(user.Token)).Expect(t, http.StatusForbidden)
+}
+
+func TestIPBans(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	t.Setenv("IP_BAN_ENABLED", "true")
+	t.Setenv("IP_BAN_LOGIN_FAILURES", "3")
+	t.Setenv("IP_BAN_ALLOWLIST", "198.51.100.0/24")
+
+	attacker := apitest.WithClientIP("203.0.113.50")
+	office := apitest.WithClientIP("198.51.100.7")
+	// Una IP privada como cliente suele ser la del balanceador: no se bloquea
+	balancer := apitest.WithClientIP("10.0.0.4")
+	failed := map[string]string{"email": admin.Email, "password": "incorrecta"}
+	for i := 0; i < 3; i++ {
+		srv.Do(t, http.MethodPost, "/api/v1/auth/login", failed, attacker).Expect(t, http.StatusUnauthorized)
+		srv.Do(t, http.MethodPost, "/api/v1/auth/login", failed, office).Expect(t, http.StatusUnauthorized)
+		srv.Do(t, http.MethodPost, "/api/v1/auth/login", failed, balancer).Expect(t, http.StatusUnauthorized)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/health", nil, attacker).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/health", nil, office).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/health", nil, balancer).Expect(t, http.StatusOK)
+
+	var list struct {
+		Bans []struct {
+			IP     string `json:"ip"`
+			Reason string `json:"reason"`
+		} `json:"bans"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/admin/ip-bans", nil, apitest.WithToken(admin.Token), office).
+		Expect(t, http.StatusOK).JSON(t, &list)
+	if len(list.Bans) != 1 || list.Bans[0].IP != "203.0.113.50" || list.Bans[0].Reason != "login_failures" {
+		t.Fatalf("bloqueos = %+v", list.Bans)
+	}
+
+	srv.Do(t, http.MethodDelete, "/api/v1/admin/ip-bans/203.0.113.50", nil, apitest.WithToken(admin.Token), office).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/health", nil, attacker).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, "/api/v1/admin/ip-bans/203.0.113.50", nil, apitest.WithToken(admin.Token), office).Expect(t, http.StatusNotFound)
+}
+
+func TestIPAllowlists(t *testing.T) {
+	srv := apitest.New(t)
+	admin := srv.CreateUser(t, "admin")
+	vpn := apitest.WithClientIP("10.8.1.20")
+	outside := apitest.WithClientIP("203.0.113.9")
+
+	t.Setenv("ADMIN_ALLOW_IPS", "10.8.0.0/16")
+	srv.Do(t, http.MethodGet, "/api/v1/admin/stats", nil, apitest.WithToken(admin.Token), outside).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/admin/stats", nil, apitest.WithToken(admin.Token), vpn).Expect(t, http.StatusOK)
+	// El resto de la API no se ve afectado
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(admin.Token), outside).Expect(t, http.StatusOK)
+
+	srv.Do(t, http.MethodPost, "/api/v1/api-keys", map[string]interface{}{"name": "mal", "allowed_ips": []string{"oficina"}},
+		apitest.WithToken(admin.Token)).Expect(t, http.StatusBadRequest)
+	var created struct {
+		Key string `json:"key"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/api-keys", map[string]interface{}{"name": "vpn", "allowed_ips": []string{"10.8.0.0/16"}},
+		apitest.WithToken(admin.Token)).Expect(t, http.StatusCreated).JSON(t, &created)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithAPIKey(created.Key), outside).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(created.Key), outside).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithAPIKey(created.Key), vpn).Expect(t, http.StatusOK)
+}
+
+func TestDevicesAndSessions(t *testing.T) {
+	srv := apitest.New(t)
+	user := srv.CreateUser(t, "")
+	// Solo cuentan las sesiones de los inicios de sesión de la prueba
+	database.DB.Delete(&database.Session{}, "user_id = ?", user.ID)
+	credentials := map[string]string{"email": user.Email, "password": apitest.Password}
+	firefox := apitest.WithHeader("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	iphone := apitest.WithHeader("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1")
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, firefox).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, firefox).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, iphone).Expect(t, http.StatusOK).JSON(t, &login)
+
+	var devices struct {
+		Devices []struct {
+			Browser string `json:"browser"`
+			OS      string `json:"os"`
+			Type    string `json:"type"`
+		} `json:"devices"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile/devices", nil, apitest.WithToken(login.Token)).
+		Expect(t, http.StatusOK).JSON(t, &devices)
+	if len(devices.Devices) != 2 || devices.Devices[0].OS != "iOS" || devices.Devices[0].Type != "mobile" ||
+		devices.Devices[1].Browser != "Firefox" {
+		t.Fatalf("dispositivos = %+v", devices.Devices)
+	}
+
+	var sessions struct {
+		Sessions []struct {
+			Current bool `json:"current"`
+			Device  struct {
+				Browser string `json:"browser"`
+			} `json:"device"`
+		} `json:"sessions"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile/sessions", nil, apitest.WithToken(login.Token)).
+		Expect(t, http.StatusOK).JSON(t, &sessions)
+	if len(sessions.Sessions) != 3 || !sessions.Sessions[0].Current || sessions.Sessions[0].Device.Browser != "Safari" ||
+		sessions.Sessions[1].Current {
+		t.Fatalf("sesiones = %+v", sessions.Sessions)
+	}
+}
+
+func TestLoginAlerts(t *testing.T) {
+	srv := apitest.New(t)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	geoip.Default = fakeLocator{"203.0.113.10": {Country: "ES"}, "198.51.100.20": {Country: "FR"}}
+	t.Cleanup(func() { geoip.Default = geoip.NoopLocator{} })
+	jobs.Register(services.LoginAlertJob, services.SendLoginAlert)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	jobs.Start(ctx, 1)
+
+	user := srv.CreateUser(t, "")
+	credentials := map[string]string{"email": user.Email, "password": apitest.Password}
+	firefox := apitest.WithHeader("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	spain, france := apitest.WithClientIP("203.0.113.10"), apitest.WithClientIP("198.51.100.20")
+
+	// El primer dispositivo y el primer país no avisan
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, firefox, spain).Expect(t, http.StatusOK)
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, firefox, france).Expect(t, http.StatusOK).JSON(t, &login)
+	body := mailer.wait(t)
+	if mailer.count() != 1 || !strings.Contains(body, "un país nuevo") || !strings.Contains(body, "País: FR") {
+		t.Fatalf("aviso inesperado (%d correos):\n%s", mailer.count(), body)
+	}
+
+	link := regexp.MustCompile(`/api/v1/auth/sessions/revoke\?token=\S+`).FindString(body)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, link, nil).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusUnauthorized)
+	srv.Do(t, http.MethodGet, link, nil).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, "/api/v1/auth/sessions/revoke?token="+login.Token, nil).Expect(t, http.StatusBadRequest)
+
+	// Con los avisos desactivados un dispositivo nuevo no envía nada
+	srv.Do(t, http.MethodPut, "/api/v1/users/"+itoa(user.ID), map[string]bool{"login_alerts_disabled": true},
+		apitest.WithToken(user.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, spain,
+		apitest.WithHeader("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) Mobile/15E148 Safari/604.1")).
+		Expect(t, http.StatusOK)
+	time.Sleep(100 * time.Millisecond)
+	if n := mailer.count(); n != 1 {
+		t.Fatalf("se enviaron %d avisos con los avisos desactivados", n)
+	}
+}
+
+func TestRiskScoring(t *testing.T) {
+	srv := apitest.New(t)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	madrid, tokyo := apitest.WithClientIP("203.0.113.10"), apitest.WithClientIP("198.51.100.20")
+	geoip.Default = fakeLocator{
+		"203.0.113.10":  {Country: "ES", Latitude: 40.4, Longitude: -3.7, HasCoordinates: true},
+		"198.51.100.20": {Country: "JP", Latitude: 35.7, Longitude: 139.7, HasCoordinates: true},
+	}
+	t.Cleanup(func() { geoip.Default = geoip.NoopLocator{} })
+	t.Setenv("RISK_SCORING", "true")
+
+	user := srv.CreateUser(t, "")
+	credentials := map[string]string{"email": user.Email, "password": apitest.Password}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, madrid).Expect(t, http.StatusOK)
+
+	// Madrid y Tokio en unos segundos: viaje imposible, se pide el código
+	var pending struct {
+		StepUp      bool   `json:"step_up_required"`
+		ChallengeID string `json:"challenge_id"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, tokyo).Expect(t, http.StatusUnauthorized).JSON(t, &pending)
+	code := regexp.MustCompile(`\b\d{6}\b`).FindString(mailer.wait(t))
+	if !pending.StepUp || pending.ChallengeID == "" || code == "" {
+		t.Fatalf("verificación = %+v, código %q", pending, code)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	verify := func(code string) map[string]string {
+		return map[string]string{"challenge_id": pending.ChallengeID, "code": code}
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login/verify", verify(wrong), tokyo).Expect(t, http.StatusUnauthorized)
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login/verify", verify(code), tokyo).Expect(t, http.StatusOK).JSON(t, &login)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login/verify", verify(code), tokyo).Expect(t, http.StatusUnauthorized)
+
+	// Por encima del umbral de bloqueo no hay segunda oportunidad
+	t.Setenv("RISK_BLOCK_SCORE", "60")
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, madrid).Expect(t, http.StatusForbidden)
+
+	var decisions []string
+	database.DB.Model(&database.LoginEvent{}).Where("user_id = ?", user.ID).Order("id").Pluck("risk_decision", &decisions)
+	if want := []string{"allow", "challenge", "challenge", "block"}; strings.Join(decisions, ",") != strings.Join(want, ",") {
+		t.Fatalf("decisiones registradas = %v, se esperaba %v", decisions, want)
+	}
+}
+
+func TestStepUpAttemptsConcurrent(t *testing.T) {
+	srv := apitest.New(t)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	madrid, tokyo := apitest.WithClientIP("203.0.113.10"), apitest.WithClientIP("198.51.100.20")
+	geoip.Default = fakeLocator{
+		"203.0.113.10":  {Country: "ES", Latitude: 40.4, Longitude: -3.7, HasCoordinates: true},
+		"198.51.100.20": {Country: "JP", Latitude: 35.7, Longitude: 139.7, HasCoordinates: true},
+	}
+	t.Cleanup(func() { geoip.Default = geoip.NoopLocator{} })
+	t.Setenv("RISK_SCORING", "true")
+
+	user := srv.CreateUser(t, "")
+	credentials := map[string]string{"email": user.Email, "password": apitest.Password}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, madrid).Expect(t, http.StatusOK)
+	var pending struct {
+		ChallengeID string `json:"challenge_id"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, tokyo).Expect(t, http.StatusUnauthorized).JSON(t, &pending)
+	code := regexp.MustCompile(`\b\d{6}\b`).FindString(mailer.wait(t))
+
+	// Muchos códigos a la vez no pueden superar el máximo de intentos
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		guess := fmt.Sprintf("%06d", i)
+		if guess == code {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.Do(t, http.MethodPost, "/api/v1/auth/login/verify", map[string]string{"challenge_id": pending.ChallengeID, "code": guess}, tokyo)
+		}()
+	}
+	wg.Wait()
+
+	var challenge database.LoginChallenge
+	database.DB.First(&challenge, "id = ?", pending.ChallengeID)
+	if challenge.Attempts != 5 {
+		t.Errorf("intentos registrados = %d, se esperaban 5", challenge.Attempts)
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login/verify", map[string]string{"challenge_id": pending.ChallengeID, "code": code}, tokyo).
+		Expect(t, http.StatusUnauthorized)
+}
+
+func TestTrustedDevice(t *testing.T) {
+	srv := apitest.New(t)
+	mailer := &captureMailer{}
+	mail.Default = mailer
+	madrid, tokyo := apitest.WithClientIP("203.0.113.10"), apitest.WithClientIP("198.51.100.20")
+	geoip.Default = fakeLocator{
+		"203.0.113.10":  {Country: "ES", Latitude: 40.4, Longitude: -3.7, HasCoordinates: true},
+		"198.51.100.20": {Country: "JP", Latitude: 35.7, Longitude: 139.7, HasCoordinates: true},
+	}
+	t.Cleanup(func() { geoip.Default = geoip.NoopLocator{} })
+	t.Setenv("RISK_SCORING", "true")
+
+	user := srv.CreateUser(t, "")
+	credentials := map[string]string{"email": user.Email, "password": apitest.Password}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, madrid).Expect(t, http.StatusOK)
+
+	var pending struct {
+		ChallengeID string `json:"challenge_id"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, tokyo).Expect(t, http.StatusUnauthorized).JSON(t, &pending)
+	code := regexp.MustCompile(`\b\d{6}\b`).FindString(mailer.wait(t))
+	var login struct {
+		Token       string `json:"token"`
+		DeviceToken string `json:"device_token"`
+	}
+	res := srv.Do(t, http.MethodPost, "/api/v1/auth/login/verify",
+		map[string]interface{}{"challenge_id": pending.ChallengeID, "code": code, "remember_device": true}, tokyo)
+	res.Expect(t, http.StatusOK).JSON(t, &login)
+	if login.DeviceToken == "" || !strings.Contains(res.Header().Get("Set-Cookie"), "device_trust=") {
+		t.Fatalf("no se recordó el dispositivo: %s", res.Body.String())
+	}
+
+	// Desde el dispositivo de confianza el viaje imposible ya no pide el código,
+	// pero el token de dispositivo no sirve como token de acceso
+	trusted := apitest.WithHeader("X-Device-Token", login.DeviceToken)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, madrid, trusted).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.DeviceToken)).Expect(t, http.StatusUnauthorized)
+
+	var devices struct {
+		Devices []database.Device `json:"devices"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile/devices", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK).JSON(t, &devices)
+	if len(devices.Devices) != 1 || devices.Devices[0].TrustedUntil == nil {
+		t.Fatalf("dispositivos = %+v", devices.Devices)
+	}
+	path := "/api/v1/profile/devices/" + itoa(devices.Devices[0].ID) + "/trust"
+	other := srv.CreateUser(t, "")
+	srv.Do(t, http.MethodDelete, path, nil, apitest.WithToken(other.Token)).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodDelete, path, nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials, tokyo, trusted).Expect(t, http.StatusUnauthorized)
+}
+
+func TestSessionLimit(t *testing.T) {
+	srv := apitest.New(t)
+	t.Setenv("SESSION_LIMIT", "2")
+	user := srv.CreateUser(t, "")
+	// Solo cuentan las sesiones de los inicios de sesión de la prueba
+	database.DB.Delete(&database.Session{}, "user_id = ?", user.ID)
+	credentials := map[string]string{"email": user.Email, "password": apitest.Password}
+
+	type login struct {
+		Token      string `json:"token"`
+		Terminated []struct {
+			ID string `json:"id"`
+		} `json:"terminated_sessions"`
+	}
+	var first, second, third login
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusOK).JSON(t, &first)
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusOK).JSON(t, &second)
+	if len(second.Terminated) != 0 {
+		t.Fatalf("sesiones cerradas sin superar el máximo: %+v", second.Terminated)
+	}
+
+	// La tercera sesión cierra la más antigua
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusOK).JSON(t, &third)
+	var claims auth.Claims
+	if err := auth.Verify(first.Token, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if len(third.Terminated) != 1 || third.Terminated[0].ID != claims.ID {
+		t.Fatalf("sesiones cerradas = %+v, se esperaba %s", third.Terminated, claims.ID)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(first.Token)).Expect(t, http.StatusUnauthorized)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(second.Token)).Expect(t, http.StatusOK)
+
+	t.Setenv("SESSION_LIMIT_POLICY", "refuse")
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusConflict)
+	t.Setenv("SESSION_LIMIT_USER", "0")
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusOK)
+}
+
+func TestSlidingSessionExpiry(t *testing.T) {
+	srv := apitest.New(t)
+	now := clock.NewFixed(time.Now())
+	defer clock.Set(now)()
+	t.Setenv("SESSION_IDLE_TIMEOUT", "30m")
+	t.Setenv("SESSION_MAX_LIFETIME", "2h")
+	user := srv.CreateUser(t, "")
+	credentials := map[string]string{"email": user.Email, "password": apitest.Password}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusOK).JSON(t, &login)
+	profile := func(status int) {
+		t.Helper()
+		srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, status)
+	}
+
+	// Mientras se use la sesión sigue abierta, hasta la duración máxima
+	for i := 0; i < 4; i++ {
+		now.Advance(25 * time.Minute)
+		profile(http.StatusOK)
+	}
+	now.Advance(25 * time.Minute)
+	profile(http.StatusUnauthorized)
+
+	// Sin actividad caduca a los 30 minutos
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusOK).JSON(t, &login)
+	now.Advance(29 * time.Minute)
+	profile(http.StatusOK)
+	now.Advance(31 * time.Minute)
+	profile(http.StatusUnauthorized)
+
+	// Purgar el registro de la sesión no vuelve a abrirla
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", credentials).Expect(t, http.StatusOK).JSON(t, &login)
+	claims, err := auth.ParseToken(login.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Delete(&database.Session{}, "id = ?", claims.ID)
+	profile(http.StatusUnauthorized)
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	srv := apitest.New(t)
+	developer := srv.CreateUser(t, "")
+	user := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+	const callback = "https://app.example.com/callback"
+
+	var registered struct {
+		Client       database.OAuthClient `json:"client"`
+		ClientSecret string               `json:"client_secret"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/oauth/clients",
+		map[string]interface{}{"name": "Ejemplo", "redirect_uris": []string{callback}}, apitest.WithToken(developer.Token)).
+		Expect(t, http.StatusCreated).JSON(t, &registered)
+	clientID := registered.Client.ClientID
+
+	verifier := strings.Repeat("v", 50)
+	sum := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID},
+		"redirect_uri":          {callback},
+		"scope":                 {"profile:read"},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	var consent struct {
+		Granted bool `json:"granted"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/oauth/authorize?"+params.Encode(), nil, session).Expect(t, http.StatusOK).JSON(t, &consent)
+	if consent.Granted {
+		t.Fatal("permisos concedidos antes de la primera autorización")
+	}
+
+	// authorize aprueba la petición y devuelve el código de la redirección
+	authorize := func() string {
+		t.Helper()
+		body := map[string]interface{}{"approve": true}
+		for k, v := range params {
+			body[k] = v[0]
+		}
+		var approved struct {
+			RedirectTo string `json:"redirect_to"`
+		}
+		srv.Do(t, http.MethodPost, "/api/v1/oauth/authorize", body, session).Expect(t, http.StatusOK).JSON(t, &approved)
+		redirect, err := url.Parse(approved.RedirectTo)
+		if err != nil || !strings.HasPrefix(approved.RedirectTo, callback) || redirect.Query().Get("state") != "xyz" || redirect.Query().Get("code") == "" {
+			t.Fatalf("redirección = %s", approved.RedirectTo)
+		}
+		return redirect.Query().Get("code")
+	}
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	exchange := func(values url.Values, status int) {
+		t.Helper()
+		values.Set("client_id", clientID)
+		values.Set("client_secret", registered.ClientSecret)
+		res := srv.Do(t, http.MethodPost, "/api/v1/oauth/token", []byte(values.Encode()),
+			apitest.WithHeader("Content-Type", "application/x-www-form-urlencoded")).Expect(t, status)
+		if status == http.StatusOK {
+			res.JSON(t, &token)
+		}
+	}
+	withCode := func(code, verifier string) url.Values {
+		return url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {callback}, "code_verifier": {verifier}}
+	}
+
+	code := authorize()
+	exchange(withCode(code, strings.Repeat("w", 50)), http.StatusBadRequest)
+	exchange(withCode(code, verifier), http.StatusOK)
+	if token.Scope != "profile:read" {
+		t.Fatalf("scope = %q", token.Scope)
+	}
+	// Un código reutilizado se rechaza y revoca lo emitido con él
+	exchange(withCode(code, verifier), http.StatusBadRequest)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(token.AccessToken)).Expect(t, http.StatusUnauthorized)
+
+	srv.Do(t, http.MethodGet, "/api/v1/oauth/authorize?"+params.Encode(), nil, session).Expect(t, http.StatusOK).JSON(t, &consent)
+	if !consent.Granted {
+		t.Fatal("no constan los permisos ya concedidos")
+	}
+	exchange(withCode(authorize(), verifier), http.StatusOK)
+	refresh := token.RefreshToken
+	exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refresh}}, http.StatusOK)
+	exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refresh}}, http.StatusBadRequest)
+
+	// Solo las rutas de los scopes concedidos: ni otras rutas ni GraphQL
+	access := apitest.WithToken(token.AccessToken)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, access).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, "/api/v1/profile", nil, access).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodGet, "/api/v1/oauth/clients", nil, access).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPost, "/graphql", map[string]string{"query": "{ me { id } }"}, access).Expect(t, http.StatusForbidden)
+
+	// El usuario retira el acceso y el token deja de valer
+	srv.Do(t, http.MethodDelete, "/api/v1/profile/apps/"+clientID, nil, session).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, access).Expect(t, http.StatusUnauthorized)
+}
+
+func TestIdentityLinking(t *testing.T) {
+	srv := apitest.New(t)
+	t.Setenv("SAML_BRIDGE_SECRET", "puente")
+	user := srv.CreateUser(t, "")
+	other := srv.CreateUser(t, "")
+	session := apitest.WithToken(user.Token)
+	credential := map[string]string{"credential": samlToken("puente", "https://idp.example.com", "ana")}
+
+	srv.Do(t, http.MethodPost, "/api/v1/profile/identities/saml",
+		map[string]string{"credential": samlToken("otro", "https://idp.example.com", "ana")}, session).Expect(t, http.StatusUnauthorized)
+	srv.Do(t, http.MethodPost, "/api/v1/profile/identities/google", credential, session).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodPost, "/api/v1/profile/identities/saml", credential, session).Expect(t, http.StatusCreated)
+	// Una identidad solo puede estar vinculada a una cuenta
+	srv.Do(t, http.MethodPost, "/api/v1/profile/identities/saml", credential, apitest.WithToken(other.Token)).Expect(t, http.StatusConflict)
+
+	var login struct {
+		Token string `json:"token"`
+		User  struct {
+			ID uint `json:"id"`
+		} `json:"user"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login/identity",
+		map[string]string{"provider": "saml", "credential": credential["credential"]}).Expect(t, http.StatusOK).JSON(t, &login)
+	if login.Token == "" || login.User.ID != user.ID {
+		t.Fatalf("login con identidad = %+v", login)
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login/identity",
+		map[string]string{"provider": "saml", "credential": samlToken("puente", "https://idp.example.com", "eva")}).Expect(t, http.StatusUnauthorized)
+
+	srv.Do(t, http.MethodDelete, "/api/v1/profile/identities/saml", nil, session).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodDelete, "/api/v1/profile/identities/saml", nil, session).Expect(t, http.StatusNotFound)
+
+	// Sin contraseña la única identidad no se puede desvincular
+	srv.Do(t, http.MethodPost, "/api/v1/profile/identities/saml", credential, session).Expect(t, http.StatusCreated)
+	if err := database.DB.Model(user.User).Update("password", "").Error; err != nil {
+		t.Fatal(err)
+	}
+	srv.Do(t, http.MethodDelete, "/api/v1/profile/identities/saml", nil, session).Expect(t, http.StatusConflict)
+}
+
+// samlToken firma un token del puente SAML como el proveedor de servicio
+func samlToken(secret, issuer, subject string) string {
+	encode := func(v string) string { return base64.RawURLEncoding.EncodeToString([]byte(v)) }
+	signed := encode(`{"alg":"HS256","typ":"JWT"}`) + "." +
+		encode(`{"iss":"`+issuer+`","sub":"`+subject+`","exp":`+strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)+`}`)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// captureMailer guarda los correos enviados
+type captureMailer struct {
+	mu          sync.Mutex
+	bodies      []string
+	recipients  []string
+	attachments [][]mail.Attachment
+}
+
+func (m *captureMailer) Send(to, subject, body string) error {
+	return m.SendWithAttachments(to, subject, body, nil)
+}
+
+func (m *captureMailer) SendWithAttachments(to, subject, body string, attachments []mail.Attachment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bodies = append(m.bodies, body)
+	m.recipients = append(m.recipients, to)
+	m.attachments = append(m.attachments, attachments)
+	return nil
+}
+
+func (m *captureMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.bodies)
+}
+
+// wait espera al primer correo y lo devuelve
+func (m *captureMailer) wait(t *testing.T) string {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		m.mu.Lock()
+		if len(m.bodies) > 0 {
+			body := m.bodies[0]
+			m.mu.Unlock()
+			return body
+		}
+		m.mu.Unlock()
+	}
+	t.Fatal("no se envió ningún correo")
+	return ""
+}
+
+// fakeEngine motor de búsqueda en memoria: devuelve siempre ids y guarda lo indexado
+type fakeEngine struct {
+	ids     []uint
+	err     error
+	indexed map[uint]search.Document
+	deleted []uint
+}
+
+func (e *fakeEngine) Index(ctx context.Context, doc search.Document) error {
+	e.indexed[doc.ID] = doc
+	return nil
+}
+
+func (e *fakeEngine) Delete(ctx context.Context, id uint) error {
+	e.deleted = append(e.deleted, id)
+	return nil
+}
+
+func (e *fakeEngine) Search(ctx context.Context, q string, limit int, fuzzy bool) ([]uint, error) {
+	return e.ids, e.err
+}
+
+// fakeLocator asigna ubicaciones fijas a algunas IPs
+type fakeLocator map[string]geoip.Location
+
+func (l fakeLocator) Locate(ip net.IP) (geoip.Location, error) {
+	return l[ip.String()], nil
+}
+
+func itoa(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
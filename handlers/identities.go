@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"api/identity"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyIdentities lista las identidades externas vinculadas al usuario autenticado
+// @Summary Mis identidades vinculadas
+// @Description Identidades (Google, GitHub, SAML) con las que el usuario puede iniciar sesión, y los proveedores configurados en available_providers
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /profile/identities [get]
+func GetMyIdentities(c *gin.Context) {
+	list, err := services.ListIdentities(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las identidades"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"identities": list, "available_providers": identity.Available()})
+}
+
+// LinkMyIdentity vincula una identidad externa a la cuenta del usuario autenticado
+// @Summary Vincular identidad
+// @Description Verifica la credencial con el proveedor (ID token de Google, código OAuth de GitHub o token del puente SAML) y vincula la identidad para iniciar sesión con ella. Requiere sesión
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "Proveedor (google, github, saml)"
+// @Param identity body LinkIdentityRequest true "Credencial del proveedor"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/identities/{provider} [post]
+func LinkMyIdentity(c *gin.Context) {
+	var req LinkIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	linked, err := services.LinkIdentity(c.Request.Context(), currentUserID(c), c.Param("provider"), req.Credential)
+	switch {
+	case errors.Is(err, identity.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proveedor de identidad no disponible"})
+		return
+	case errors.Is(err, identity.ErrInvalidCredential):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "El proveedor no ha validado la credencial"})
+		return
+	case errors.Is(err, services.ErrIdentityTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "La identidad ya está vinculada a una cuenta o ya tienes una de este proveedor"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al vincular la identidad"})
+		return
+	}
+	writeJSON(c, http.StatusCreated, gin.H{"message": "Identidad vinculada", "identity": linked})
+}
+
+// UnlinkMyIdentity desvincula una identidad externa de la cuenta del usuario autenticado
+// @Summary Desvincular identidad
+// @Description Desvincula la identidad del proveedor. No se permite si es el último método de inicio de sesión de la cuenta (sin contraseña ni otras identidades). Requiere sesión
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param provider path string true "Proveedor (google, github, saml)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/identities/{provider} [delete]
+func UnlinkMyIdentity(c *gin.Context) {
+	err := services.UnlinkIdentity(c.Request.Context(), currentUserID(c), c.Param("provider"))
+	switch {
+	case errors.Is(err, services.ErrIdentityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No tienes ninguna identidad vinculada de este proveedor"})
+		return
+	case errors.Is(err, services.ErrLastLoginMethod):
+		c.JSON(http.StatusConflict, gin.H{"error": "No puedes desvincular tu único método de inicio de sesión"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al desvincular la identidad"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Identidad desvinculada"})
+}
+
+// LoginWithIdentity inicia sesión con una identidad externa vinculada
+// @Summary Iniciar sesión con una identidad externa
+// @Description Verifica la credencial con el proveedor e inicia sesión en la cuenta a la que está vinculada la identidad. Responde igual que /auth/login (verificación por riesgo, límite de sesiones...)
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body IdentityLoginRequest true "Proveedor y credencial"
+// @Param X-Token-Delivery header string false "cookie para recibir el token de renovación en una cookie HttpOnly"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /auth/login/identity [post]
+func LoginWithIdentity(c *gin.Context) {
+	var req IdentityLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := services.AuthenticateIdentity(c.Request.Context(), req.Provider, req.Credential, loginMeta(c))
+	if errors.Is(err, identity.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proveedor de identidad no disponible"})
+		return
+	}
+	if rejectedLogin(c, result, err) {
+		return
+	}
+	loginResponse(c, result, err)
+}
+
+// LinkIdentityRequest credencial obtenida del proveedor de identidad
+type LinkIdentityRequest struct {
+	Credential string `json:"credential" binding:"required"`
+}
+
+// IdentityLoginRequest inicio de sesión con una identidad externa
+type IdentityLoginRequest struct {
+	Provider   string `json:"provider" binding:"required" example:"google"`
+	Credential string `json:"credential" binding:"required"`
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"api/preload"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userIncludes relaciones que se pueden pedir con ?include= en las respuestas
+// de usuarios; profile, identities y tags solo los administradores
+var userIncludes = []string{"plan", "profile", "identities", "posts", "tags"}
+
+// postIncludes relaciones que se pueden pedir con ?include= en las respuestas
+// de posts
+var postIncludes = []string{"author"}
+
+// commentIncludes relaciones que se pueden pedir con ?include= en las
+// respuestas de comentarios
+var commentIncludes = []string{"author"}
+
+// includeUsers carga en bloque las relaciones pedidas en ?include= y las añade
+// a cada usuario en "included". Devuelve false si ya respondió con un error.
+func includeUsers(c *gin.Context, list []linkedUser) bool {
+	ids := make([]uint, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+	}
+	set, ok := includeRelations(c, "users", userIncludes, ids, "Error al obtener usuarios")
+	for i := range list {
+		list[i].Included = set.For(list[i].ID)
+	}
+	return ok
+}
+
+// includePosts como includeUsers, para los posts
+func includePosts(c *gin.Context, list []linkedPost) bool {
+	ids := make([]uint, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+	}
+	set, ok := includeRelations(c, "posts", postIncludes, ids, "Error al obtener los posts")
+	for i := range list {
+		list[i].Included = set.For(list[i].ID)
+	}
+	return ok
+}
+
+// includeComments como includeUsers, para los comentarios
+func includeComments(c *gin.Context, list []linkedComment) bool {
+	ids := make([]uint, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+	}
+	set, ok := includeRelations(c, "comments", commentIncludes, ids, "Error al obtener los comentarios")
+	for i := range list {
+		list[i].Included = set.For(list[i].ID)
+	}
+	return ok
+}
+
+// includeRelations carga las relaciones de ?include= admitidas por el endpoint
+// (allowed) para los recursos ids. Devuelve false si ya respondió con un
+// error; failure es el mensaje si falla la carga.
+func includeRelations(c *gin.Context, resource string, allowed []string, ids []uint, failure string) (preload.Set, bool) {
+	names, err := preload.Parse(resource, c.Query("include"), c.GetString("userRole") == "admin", allowed...)
+	var unknown *preload.UnknownError
+	if errors.As(err, &unknown) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Relación no admitida en include: " + unknown.Name,
+			"allowed": strings.Join(allowed, ","),
+		})
+		return nil, false
+	}
+	if len(names) == 0 {
+		return nil, true
+	}
+
+	set, err := preload.Load(c.Request.Context(), resource, names, ids)
+	if err != nil {
+		log.Printf("❌ Error cargando las relaciones de %s: %v", resource, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return nil, false
+	}
+	return set, true
+}
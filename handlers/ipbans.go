@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"api/bans"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetIPBans lista las IPs bloqueadas
+// @Summary Listar IPs bloqueadas
+// @Description Devuelve los bloqueos vigentes, automáticos (logins fallidos, avalanchas de 4xx) o manuales
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/ip-bans [get]
+func GetIPBans(c *gin.Context) {
+	list, err := bans.Active(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los bloqueos"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"bans": list})
+}
+
+// CreateIPBan bloquea una IP a mano
+// @Summary Bloquear IP
+// @Description Bloquea la IP durante el tiempo indicado (por defecto IP_BAN_DURATION)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param ban body CreateIPBanRequest true "IP y duración"
+// @Success 201 {object} database.IPBan
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/ip-bans [post]
+func CreateIPBan(c *gin.Context) {
+	var req CreateIPBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var d time.Duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duración inválida (p. ej. 30m, 24h)"})
+			return
+		}
+	}
+	if bans.Allowed(req.IP) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La IP está en IP_BAN_ALLOWLIST"})
+		return
+	}
+
+	admin := currentUserID(c)
+	ban, err := bans.Ban(c.Request.Context(), net.ParseIP(req.IP).String(), bans.ReasonManual, d, &admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al bloquear la IP"})
+		return
+	}
+	writeJSON(c, http.StatusCreated, ban)
+}
+
+// LiftIPBan levanta el bloqueo de una IP
+// @Summary Desbloquear IP
+// @Description Levanta los bloqueos vigentes de la IP y reinicia sus contadores
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param ip path string true "IP bloqueada"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/ip-bans/{ip} [delete]
+func LiftIPBan(c *gin.Context) {
+	ip := c.Param("ip")
+	if addr := net.ParseIP(ip); addr != nil {
+		ip = addr.String()
+	}
+	err := bans.Lift(c.Request.Context(), ip, currentUserID(c))
+	if errors.Is(err, bans.ErrNotBanned) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La IP no está bloqueada"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al desbloquear la IP"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "IP desbloqueada"})
+}
+
+// CreateIPBanRequest estructura para bloquear una IP
+type CreateIPBanRequest struct {
+	IP       string `json:"ip" binding:"required,ip"`
+	Duration string `json:"duration" example:"24h"`
+}
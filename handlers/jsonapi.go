@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api/database"
+	"api/jsonapi"
+	"api/links"
+	"api/localtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	jsonapi.Register(database.User{}, jsonapi.Type{
+		Name:      "users",
+		Relations: []jsonapi.Relation{{Name: "plan", Type: "plans", Field: "plan"}},
+	})
+	jsonapi.Register(database.Plan{}, jsonapi.Type{Name: "plans", IDField: "code"})
+	jsonapi.Register(database.APIKey{}, jsonapi.Type{
+		Name:      "api-keys",
+		Relations: []jsonapi.Relation{{Name: "user", Type: "users", Field: "user_id"}},
+	})
+}
+
+// respondJSONAPI responde con data como documento JSON:API si el cliente lo
+// negoció (config.JSONAPIMiddleware); devuelve false si debe usarse el formato normal.
+// Cada recurso lleva los enlaces de las rutas registradas para su tipo.
+func respondJSONAPI(c *gin.Context, status int, data interface{}, meta gin.H, docLinks links.Set) bool {
+	if !c.GetBool("jsonapi") {
+		return false
+	}
+	_, loc := responseLocation(c)
+	doc, err := jsonapi.NewDocument(localtime.Localize(data, loc), meta)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al serializar la respuesta"})
+		return true
+	}
+	for _, resource := range doc.Resources() {
+		resource.Links = resourceLinks(c, resource.Type, resource.ID).Hrefs()
+	}
+	doc.Links = docLinks.Hrefs()
+	writeJSON(c, status, doc)
+	return true
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"api/database"
+	"api/links"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// linkedUser usuario con sus enlaces HATEOAS y la URL de su avatar
+type linkedUser struct {
+	*database.User
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	Links     links.Set `json:"links,omitempty"`
+	// Relaciones pedidas con ?include=
+	Included map[string]interface{} `json:"included,omitempty"`
+}
+
+// linkedPost post con sus enlaces HATEOAS
+type linkedPost struct {
+	*database.Post
+	Links links.Set `json:"links,omitempty"`
+	// Relaciones pedidas con ?include=
+	Included map[string]interface{} `json:"included,omitempty"`
+}
+
+// linkedComment comentario con sus enlaces HATEOAS, bajo la ruta de su post
+type linkedComment struct {
+	*database.Comment
+	Links links.Set `json:"links,omitempty"`
+	// Relaciones pedidas con ?include=
+	Included map[string]interface{} `json:"included,omitempty"`
+}
+
+// apiBase prefijo del grupo de rutas de la petición (/api/v1 o /api/v2)
+func apiBase(c *gin.Context) string {
+	segments := strings.SplitN(c.FullPath(), "/", 4)
+	if len(segments) < 3 {
+		return ""
+	}
+	return "/" + segments[1] + "/" + segments[2]
+}
+
+// resourceLinks enlaces de las acciones registradas sobre /<collection>/:id
+func resourceLinks(c *gin.Context, collection, id string) links.Set {
+	return links.Resource(apiBase(c)+"/"+collection+"/:id", map[string]string{"id": id})
+}
+
+// withUserLinks añade a cada usuario sus enlaces
+func withUserLinks(c *gin.Context, users []database.User) []linkedUser {
+	list := make([]linkedUser, len(users))
+	for i := range users {
+		list[i] = linkUser(c, &users[i])
+	}
+	return list
+}
+
+func linkUser(c *gin.Context, user *database.User) linkedUser {
+	return linkedUser{
+		User:      user,
+		AvatarURL: services.AvatarURL(c.Request.Context(), user),
+		Links:     resourceLinks(c, "users", strconv.FormatUint(uint64(user.ID), 10)),
+	}
+}
+
+// withPostLinks añade a cada post sus enlaces
+func withPostLinks(c *gin.Context, posts []database.Post) []linkedPost {
+	list := make([]linkedPost, len(posts))
+	for i := range posts {
+		list[i] = linkedPost{Post: &posts[i], Links: resourceLinks(c, "posts", strconv.FormatUint(uint64(posts[i].ID), 10))}
+	}
+	return list
+}
+
+// withCommentLinks añade a cada comentario sus enlaces, que anidan su ruta en
+// la del post
+func withCommentLinks(c *gin.Context, comments []database.Comment) []linkedComment {
+	list := make([]linkedComment, len(comments))
+	for i := range comments {
+		params := map[string]string{
+			"id":         strconv.FormatUint(uint64(comments[i].PostID), 10),
+			"comment_id": strconv.FormatUint(uint64(comments[i].ID), 10),
+		}
+		list[i] = linkedComment{Comment: &comments[i], Links: links.Resource(apiBase(c)+"/posts/:id/comments/:comment_id", params)}
+	}
+	return list
+}
+
+// pageLinks enlaces de navegación de un listado paginado
+func pageLinks(c *gin.Context, page Page, total int64) links.Set {
+	totalPages := int((total + int64(page.PerPage) - 1) / int64(page.PerPage))
+	at := func(n int) links.Link {
+		u := *c.Request.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(n))
+		q.Set("per_page", strconv.Itoa(page.PerPage))
+		u.RawQuery = q.Encode()
+		return links.Link{Href: u.RequestURI(), Method: c.Request.Method}
+	}
+
+	set := links.Set{"self": at(page.Number), "first": at(1)}
+	if totalPages > 0 {
+		set["last"] = at(totalPages)
+	}
+	if page.Number > 1 {
+		set["prev"] = at(min(page.Number-1, max(totalPages, 1)))
+	}
+	if page.Number < totalPages {
+		set["next"] = at(page.Number + 1)
+	}
+	return set
+}
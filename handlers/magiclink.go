@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMagicLink envía un enlace de inicio de sesión sin contraseña
+// @Summary Pedir enlace de inicio de sesión
+// @Description Envía al email un enlace de un solo uso (caduca en 15 minutos) con el que iniciar sesión sin contraseña. Responde igual exista o no la cuenta. Se admiten 3 peticiones de enlaces o códigos por hora para un mismo email y 10 desde una misma IP; al superarlas, 429 con Retry-After
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MagicLinkRequest true "Email de la cuenta"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /auth/magic-link [post]
+func RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	err := services.RequestMagicLink(c.Request.Context(), req.Email, loginMeta(c))
+	if magicLinkLimited(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al enviar el enlace"})
+		return
+	}
+	writeJSON(c, http.StatusAccepted, gin.H{"message": "Si el email es de una cuenta, recibirás un enlace para iniciar sesión"})
+}
+
+// VerifyMagicLink inicia sesión con un enlace enviado por correo
+// @Summary Iniciar sesión con enlace
+// @Description Inicia sesión con el token del enlace; responde igual que /auth/login. Cada enlace sirve una vez y al usarlo se invalidan los demás pendientes. Si se abre en un dispositivo distinto del que lo pidió responde 409 con confirmation_required y desde dónde se pidió (requested_from): tras mostrárselo al usuario se vuelve a llamar con confirm=true
+// @Tags auth
+// @Produce json
+// @Param token query string true "Token del enlace"
+// @Param confirm query bool false "Confirmar el inicio de sesión en un dispositivo distinto del que pidió el enlace"
+// @Param X-Token-Delivery header string false "cookie para recibir el token de renovación en una cookie HttpOnly"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /auth/magic-link/verify [get]
+func VerifyMagicLink(c *gin.Context) {
+	var req MagicLinkQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	result, err := services.VerifyMagicLink(c.Request.Context(), req.Token, req.Confirm, loginMeta(c))
+	var confirm *services.MagicLinkConfirmationError
+	switch {
+	case errors.Is(err, services.ErrInvalidMagicLink):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Enlace inválido, caducado o ya usado"})
+		return
+	case errors.As(err, &confirm):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":                 "El enlace se pidió desde otro dispositivo; confirma que quieres iniciar sesión en este",
+			"confirmation_required": true,
+			"requested_from": gin.H{
+				"device":       confirm.Device,
+				"ip":           confirm.IP,
+				"requested_at": confirm.RequestedAt,
+			},
+		})
+		return
+	}
+	if rejectedLogin(c, result, err) {
+		return
+	}
+	loginResponse(c, result, err)
+}
+
+// RequestLoginCode envía un código de inicio de sesión por correo
+// @Summary Pedir código de inicio de sesión
+// @Description Alternativa al enlace para los clientes que no pueden abrirlo: envía al email un código de 6 cifras que caduca en 10 minutos y se canjea en /auth/code/verify. Responde igual exista o no la cuenta y comparte con /auth/magic-link el límite de peticiones (429 con Retry-After)
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body MagicLinkRequest true "Email de la cuenta"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /auth/code [post]
+func RequestLoginCode(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	err := services.RequestLoginCode(c.Request.Context(), req.Email, loginMeta(c))
+	if magicLinkLimited(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al enviar el código"})
+		return
+	}
+	writeJSON(c, http.StatusAccepted, gin.H{"message": "Si el email es de una cuenta, recibirás un código para iniciar sesión"})
+}
+
+// VerifyLoginCode inicia sesión con un código enviado por correo
+// @Summary Iniciar sesión con código
+// @Description Inicia sesión con el último código enviado al email; responde igual que /auth/login. Cada código admite 5 intentos y solo sirve una vez
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param verification body LoginCodeRequest true "Email y código"
+// @Param X-Token-Delivery header string false "cookie para recibir el token de renovación en una cookie HttpOnly"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /auth/code/verify [post]
+func VerifyLoginCode(c *gin.Context) {
+	var req LoginCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	result, err := services.VerifyLoginCode(c.Request.Context(), req.Email, req.Code, loginMeta(c))
+	if errors.Is(err, services.ErrInvalidLoginCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Código incorrecto o caducado"})
+		return
+	}
+	if rejectedLogin(c, result, err) {
+		return
+	}
+	loginResponse(c, result, err)
+}
+
+// magicLinkLimited responde 429 si se superó el límite de enlaces y códigos
+func magicLinkLimited(c *gin.Context, err error) bool {
+	var limit *services.MagicLinkLimitError
+	if !errors.As(err, &limit) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(limit.RetryAfter.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Has pedido demasiados enlaces o códigos; inténtalo más tarde"})
+	return true
+}
+
+// MagicLinkRequest petición de un enlace o código de inicio de sesión
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email" example:"ana@example.com"`
+}
+
+// MagicLinkQuery token del enlace y confirmación del dispositivo
+type MagicLinkQuery struct {
+	Token   string `form:"token" binding:"required"`
+	Confirm bool   `form:"confirm"`
+}
+
+// LoginCodeRequest código de inicio de sesión recibido por correo
+type LoginCodeRequest struct {
+	Email string `json:"email" binding:"required,email" example:"ana@example.com"`
+	Code  string `json:"code" binding:"required" example:"123456"`
+}
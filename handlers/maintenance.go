@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api/maintenance"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMaintenance devuelve el estado del modo mantenimiento
+// @Summary Estado del modo mantenimiento
+// @Description Indica si el modo mantenimiento está activo, el mensaje mostrado y las IPs permitidas
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} maintenance.State
+// @Router /admin/maintenance [get]
+func GetMaintenance(c *gin.Context) {
+	writeJSON(c, http.StatusOK, maintenance.Current())
+}
+
+// UpdateMaintenance activa o desactiva el modo mantenimiento
+// @Summary Activar/desactivar mantenimiento
+// @Description Todas las rutas salvo el health check responden 503 mientras esté activo; los administradores y las IPs permitidas pueden seguir accediendo
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param state body UpdateMaintenanceRequest true "Nuevo estado"
+// @Success 200 {object} maintenance.State
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/maintenance [put]
+func UpdateMaintenance(c *gin.Context) {
+	var req UpdateMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	state := maintenance.State{
+		Enabled:    *req.Enabled,
+		Message:    req.Message,
+		RetryAfter: req.RetryAfter,
+		AllowIPs:   req.AllowIPs,
+	}
+	if current := maintenance.Current(); current.Enabled && state.Enabled {
+		state.EnabledAt = current.EnabledAt
+	}
+
+	if err := maintenance.Set(state); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar el modo mantenimiento"})
+		return
+	}
+	writeJSON(c, http.StatusOK, maintenance.Current())
+}
+
+// UpdateMaintenanceRequest estructura para cambiar el modo mantenimiento
+type UpdateMaintenanceRequest struct {
+	Enabled    *bool    `json:"enabled" binding:"required"`
+	Message    string   `json:"message"`
+	RetryAfter int      `json:"retry_after" binding:"min=0"`
+	AllowIPs   []string `json:"allow_ips"`
+}
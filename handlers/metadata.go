@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"api/metadata"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserMetadata devuelve los metadatos de un usuario
+// @Summary Metadatos de un usuario
+// @Description Atributos propios que los integradores guardan en el usuario ({} si no tiene)
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /users/{id}/metadata [get]
+func GetUserMetadata(c *gin.Context) {
+	id, ok := pathUserID(c)
+	if !ok {
+		return
+	}
+	values, err := services.UserMetadata(c.Request.Context(), id)
+	if metadataError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"metadata": values})
+}
+
+// PatchUserMetadata modifica claves de los metadatos de un usuario
+// @Summary Modificar metadatos
+// @Description Combina las claves enviadas con las guardadas: las que no se envían no cambian y null las quita. Claves en snake_case; valores cadena, número, booleano o lista de ellos, sin objetos; hasta 50 claves y USER_METADATA_MAX_BYTES (8 KiB) en total. Con USER_METADATA_SCHEMA solo se admiten las claves declaradas, con su tipo
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param metadata body MetadataRequest true "Claves a cambiar"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /users/{id}/metadata [patch]
+func PatchUserMetadata(c *gin.Context) {
+	updateUserMetadata(c, false)
+}
+
+// ReplaceUserMetadata sustituye los metadatos de un usuario
+// @Summary Sustituir metadatos
+// @Description Como PATCH, pero las claves que no se envían se quitan; {} los vacía
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param metadata body MetadataRequest true "Metadatos"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /users/{id}/metadata [put]
+func ReplaceUserMetadata(c *gin.Context) {
+	updateUserMetadata(c, true)
+}
+
+func updateUserMetadata(c *gin.Context, replace bool) {
+	id, ok := pathUserID(c)
+	if !ok {
+		return
+	}
+	var req MetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	values, err := services.UpdateUserMetadata(c.Request.Context(), currentIdentity(c), id, req.Metadata, replace)
+	if metadataError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"metadata": values})
+}
+
+// metadataError responde a los errores de las rutas de metadatos; devuelve
+// false si no hubo error
+func metadataError(c *gin.Context, err error) bool {
+	var invalid *metadata.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &invalid):
+		response := gin.H{"error": "Metadatos inválidos", "details": invalid.Reason}
+		if invalid.Key != "" {
+			response["key"] = invalid.Key
+		}
+		c.JSON(http.StatusBadRequest, response)
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los metadatos"})
+	}
+	return true
+}
+
+// MetadataRequest claves de los metadatos de un usuario
+type MetadataRequest struct {
+	Metadata map[string]json.RawMessage `json:"metadata" binding:"required" swaggertype:"object"`
+}
@@ -0,0 +1,522 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/oauth"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateOAuthClient registra una aplicación de terceros
+// @Summary Registrar aplicación OAuth
+// @Description Registra una aplicación que podrá pedir acceso a los datos de los usuarios con OAuth2 (código de autorización + PKCE). Las aplicaciones confidenciales reciben un client_secret que solo se devuelve en esta respuesta; las públicas (SPA, móvil) no tienen secreto. Requiere sesión
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param client body CreateOAuthClientRequest true "Datos de la aplicación"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /oauth/clients [post]
+func CreateOAuthClient(c *gin.Context) {
+	var req CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	client, secret, err := services.RegisterOAuthClient(c.Request.Context(), currentUserID(c), req.Name, req.RedirectURIs, req.Public)
+	if errors.Is(err, services.ErrInvalidRedirectURI) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "URI de redirección inválida: debe ser https (o http a localhost) y sin fragmento"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la aplicación"})
+		return
+	}
+
+	response := gin.H{"message": "Aplicación registrada", "client": client}
+	if secret != "" {
+		response["message"] = "Aplicación registrada; guarda el secreto, no se volverá a mostrar"
+		response["client_secret"] = secret
+	}
+	writeJSON(c, http.StatusCreated, response)
+}
+
+// GetOAuthClients lista las aplicaciones registradas por el usuario
+// @Summary Mis aplicaciones OAuth
+// @Description Aplicaciones registradas por el usuario (sin el secreto)
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /oauth/clients [get]
+func GetOAuthClients(c *gin.Context) {
+	clients, err := services.ListOAuthClients(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las aplicaciones"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"clients": clients})
+}
+
+// DeleteOAuthClient da de baja una aplicación del usuario
+// @Summary Eliminar aplicación OAuth
+// @Description Da de baja la aplicación y revoca todos los tokens emitidos a ella
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID de la aplicación"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /oauth/clients/{id} [delete]
+func DeleteOAuthClient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	err = services.RevokeOAuthClient(c.Request.Context(), currentUserID(c), uint(id))
+	switch {
+	case errors.Is(err, services.ErrOAuthClientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aplicación no encontrada"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar la aplicación"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Aplicación eliminada y sus tokens revocados"})
+}
+
+// GetOAuthAuthorization valida una petición de autorización para la pantalla de consentimiento
+// @Summary Consultar petición de autorización
+// @Description La pantalla de consentimiento llama aquí con los parámetros que recibió de la aplicación (response_type=code, client_id, redirect_uri, scope, state, code_challenge y code_challenge_method=S256) y muestra la aplicación y los permisos pedidos; granted indica que el usuario ya los había concedido. Si la petición no es válida pero se puede avisar a la aplicación, la respuesta 400 incluye redirect_to
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Param response_type query string true "code"
+// @Param client_id query string true "ID de la aplicación"
+// @Param redirect_uri query string false "URI de redirección registrada"
+// @Param scope query string true "Scopes separados por espacios"
+// @Param state query string false "Valor opaco que se devuelve a la aplicación"
+// @Param code_challenge query string true "Desafío PKCE"
+// @Param code_challenge_method query string true "S256"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /oauth/authorize [get]
+func GetOAuthAuthorization(c *gin.Context) {
+	var req OAuthAuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	authz, err := services.PrepareAuthorization(c.Request.Context(), currentUserID(c), req.service())
+	if err != nil {
+		authorizationError(c, services.AuthorizationErrorRedirect(authz, req.service(), err), err)
+		return
+	}
+
+	scopes := make([]gin.H, 0, len(authz.Scopes))
+	for _, name := range authz.Scopes {
+		s, _ := oauth.Lookup(name)
+		scopes = append(scopes, gin.H{"name": s.Name, "description": s.Description})
+	}
+	writeJSON(c, http.StatusOK, gin.H{
+		"client":       gin.H{"client_id": authz.Client.ClientID, "name": authz.Client.Name},
+		"redirect_uri": authz.RedirectURI,
+		"scopes":       scopes,
+		"granted":      authz.Granted,
+	})
+}
+
+// AuthorizeOAuth registra la decisión del usuario en la pantalla de consentimiento
+// @Summary Conceder o denegar autorización
+// @Description Con approve=true emite un código de autorización; con false, error=access_denied. La respuesta trae en redirect_to la URL de la aplicación a la que hay que llevar al usuario
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param authorization body OAuthAuthorizeRequest true "Parámetros de la petición y decisión"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /oauth/authorize [post]
+func AuthorizeOAuth(c *gin.Context) {
+	var req OAuthAuthorizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	redirect, err := services.Authorize(c.Request.Context(), currentUserID(c), req.service(), req.Approve)
+	if err != nil {
+		authorizationError(c, redirect, err)
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"redirect_to": redirect})
+}
+
+// authorizationError responde a una petición de autorización inválida. Los
+// errores del cliente o de la URI de redirección no se devuelven a la aplicación.
+func authorizationError(c *gin.Context, redirect string, err error) {
+	var oauthErr *oauth.Error
+	switch {
+	case errors.Is(err, services.ErrOAuthClientNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Aplicación desconocida"})
+	case errors.Is(err, services.ErrInvalidRedirectURI):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La URI de redirección no está registrada para la aplicación"})
+	case errors.As(err, &oauthErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description, "redirect_to": redirect})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar la autorización"})
+	}
+}
+
+// OAuthToken endpoint de tokens OAuth2
+// @Summary Obtener token OAuth
+// @Description Canjea un código de autorización (grant_type=authorization_code con code, redirect_uri y code_verifier), un token de renovación (grant_type=refresh_token) o una autorización de dispositivo (grant_type=urn:ietf:params:oauth:grant-type:device_code con device_code; mientras el usuario no responde, error authorization_pending o slow_down si se consulta antes del intervalo) por un token de acceso. Los servicios internos (TOKEN_EXCHANGE_CLIENTS) pueden además canjear el token de un usuario por uno para otro servicio (grant_type=urn:ietf:params:oauth:grant-type:token-exchange, RFC 8693) con subject_token, subject_token_type, audience (client_id del servicio destino) y scope: el token emitido dura unos minutos, no tiene renovación, no supera los scopes del presentado y solo lo acepta el servicio destino (ver /oauth/introspect). Las aplicaciones confidenciales se autentican con HTTP Basic o client_id/client_secret en el formulario. Los errores siguen el RFC 6749
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token, urn:ietf:params:oauth:grant-type:device_code o urn:ietf:params:oauth:grant-type:token-exchange"
+// @Param code formData string false "Código de autorización"
+// @Param redirect_uri formData string false "URI de redirección usada al autorizar"
+// @Param code_verifier formData string false "Verificador PKCE"
+// @Param refresh_token formData string false "Token de renovación"
+// @Param device_code formData string false "Código del flujo de dispositivo"
+// @Param subject_token formData string false "Token del usuario que se canjea (JWT de sesión o token de acceso OAuth)"
+// @Param subject_token_type formData string false "urn:ietf:params:oauth:token-type:access_token o urn:ietf:params:oauth:token-type:jwt"
+// @Param requested_token_type formData string false "Solo urn:ietf:params:oauth:token-type:access_token"
+// @Param audience formData string false "client_id del servicio al que se llamará con el token"
+// @Param scope formData string false "Scopes del token canjeado (por defecto los del subject_token)"
+// @Param client_id formData string false "ID de la aplicación (si no se usa HTTP Basic)"
+// @Param client_secret formData string false "Secreto de la aplicación confidencial"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /oauth/token [post]
+func OAuthToken(c *gin.Context) {
+	req := services.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+		ClientID:     c.PostForm("client_id"),
+		ClientSecret: c.PostForm("client_secret"),
+		DeviceCode:   c.PostForm("device_code"),
+
+		SubjectToken:       c.PostForm("subject_token"),
+		SubjectTokenType:   c.PostForm("subject_token_type"),
+		RequestedTokenType: c.PostForm("requested_token_type"),
+		Audience:           c.PostForm("audience"),
+		Scope:              c.PostForm("scope"),
+		IP:                 c.ClientIP(),
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		req.ClientID, req.ClientSecret = id, secret
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	token, err := services.ExchangeOAuthToken(c.Request.Context(), req)
+	if respondOAuthError(c, err) {
+		return
+	}
+	response := gin.H{
+		"access_token": token.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   token.ExpiresIn,
+		"scope":        strings.Join(token.Scopes, " "),
+	}
+	if token.RefreshToken != "" {
+		response["refresh_token"] = token.RefreshToken
+	}
+	if token.IssuedTokenType != "" {
+		response["issued_token_type"] = token.IssuedTokenType
+	}
+	writeJSON(c, http.StatusOK, response)
+}
+
+// OAuthDeviceAuthorization inicia el flujo de dispositivo OAuth2
+// @Summary Autorizar un dispositivo
+// @Description Para aplicaciones sin navegador (CLI, TV) (RFC 8628): devuelve device_code, con el que la aplicación consulta POST /oauth/token cada interval segundos, y user_code, que el usuario teclea en verification_uri desde otro dispositivo con sesión iniciada (verification_uri_complete ya lo lleva). Caduca en expires_in segundos. Las aplicaciones confidenciales se autentican con HTTP Basic o client_id/client_secret
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param client_id formData string false "ID de la aplicación (si no se usa HTTP Basic)"
+// @Param client_secret formData string false "Secreto de la aplicación confidencial"
+// @Param scope formData string true "Scopes separados por espacios"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /oauth/device_authorization [post]
+func OAuthDeviceAuthorization(c *gin.Context) {
+	clientID, secret := c.PostForm("client_id"), c.PostForm("client_secret")
+	if id, s, ok := c.Request.BasicAuth(); ok {
+		clientID, secret = id, s
+	}
+
+	c.Header("Cache-Control", "no-store")
+	device, err := services.StartDeviceAuthorization(c.Request.Context(), clientID, secret, c.PostForm("scope"))
+	if respondOAuthError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{
+		"device_code":               device.DeviceCode,
+		"user_code":                 device.UserCode,
+		"verification_uri":          device.VerificationURI,
+		"verification_uri_complete": device.VerificationURIComplete,
+		"expires_in":                device.ExpiresIn,
+		"interval":                  device.Interval,
+	})
+}
+
+// GetOAuthDevice consulta la autorización de dispositivo de un código
+// @Summary Consultar autorización de dispositivo
+// @Description La página de verificación llama aquí con el código que tecleó el usuario y muestra la aplicación y los permisos que pide el dispositivo; granted indica que el usuario ya los había concedido
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Param user_code query string true "Código mostrado en el dispositivo"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /oauth/device [get]
+func GetOAuthDevice(c *gin.Context) {
+	var req OAuthDeviceQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	device, err := services.PendingDeviceAuthorization(c.Request.Context(), currentUserID(c), req.UserCode)
+	switch {
+	case errors.Is(err, services.ErrDeviceCodeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Código incorrecto o caducado"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al consultar el código"})
+		return
+	}
+	scopes := make([]gin.H, 0, len(device.Scopes))
+	for _, name := range device.Scopes {
+		s, _ := oauth.Lookup(name)
+		scopes = append(scopes, gin.H{"name": s.Name, "description": s.Description})
+	}
+	writeJSON(c, http.StatusOK, gin.H{
+		"client":  gin.H{"client_id": device.Client.ClientID, "name": device.Client.Name},
+		"scopes":  scopes,
+		"granted": device.Granted,
+	})
+}
+
+// AuthorizeOAuthDevice registra la decisión del usuario sobre un dispositivo
+// @Summary Aprobar o denegar un dispositivo
+// @Description Con approve=true la siguiente consulta del dispositivo recibe el token; con false, access_denied. El código solo vale una vez
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param decision body OAuthDeviceRequest true "Código y decisión"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /oauth/device [post]
+func AuthorizeOAuthDevice(c *gin.Context) {
+	var req OAuthDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	err := services.DecideDeviceAuthorization(c.Request.Context(), currentUserID(c), req.UserCode, req.Approve)
+	switch {
+	case errors.Is(err, services.ErrDeviceCodeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Código incorrecto o caducado"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la decisión"})
+	case req.Approve:
+		writeJSON(c, http.StatusOK, gin.H{"message": "Dispositivo autorizado"})
+	default:
+		writeJSON(c, http.StatusOK, gin.H{"message": "Acceso denegado al dispositivo"})
+	}
+}
+
+// OAuthIntrospect consulta un token de acceso OAuth
+// @Summary Consultar token OAuth
+// @Description Permite a un servicio comprobar el token de acceso que le presentan (RFC 7662): si está activo, su usuario (sub), scopes, caducidad, audiencia y, en los canjeados, el servicio que actúa en nombre del usuario (act). Solo informa de los tokens emitidos a la aplicación o canjeados para ella; del resto responde active=false. Requiere una aplicación confidencial autenticada con HTTP Basic o client_id/client_secret
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token de acceso"
+// @Param client_id formData string false "ID de la aplicación (si no se usa HTTP Basic)"
+// @Param client_secret formData string false "Secreto de la aplicación"
+// @Success 200 {object} services.Introspection
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /oauth/introspect [post]
+func OAuthIntrospect(c *gin.Context) {
+	clientID, secret := c.PostForm("client_id"), c.PostForm("client_secret")
+	if id, s, ok := c.Request.BasicAuth(); ok {
+		clientID, secret = id, s
+	}
+
+	c.Header("Cache-Control", "no-store")
+	result, err := services.IntrospectOAuthToken(c.Request.Context(), clientID, secret, c.PostForm("token"))
+	if respondOAuthError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, result)
+}
+
+// respondOAuthError responde a un error del endpoint de tokens con el formato
+// del RFC 6749; devuelve false si no hubo error
+func respondOAuthError(c *gin.Context, err error) bool {
+	var oauthErr *oauth.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &oauthErr):
+		status := http.StatusBadRequest
+		if oauthErr.Code == oauth.InvalidClient {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+	}
+	return true
+}
+
+// GetMyOAuthGrants lista las aplicaciones con acceso a los datos del usuario
+// @Summary Aplicaciones autorizadas
+// @Description Aplicaciones de terceros a las que el usuario ha dado acceso y con qué scopes
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /profile/apps [get]
+func GetMyOAuthGrants(c *gin.Context) {
+	grants, err := services.ListOAuthGrants(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las aplicaciones"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"apps": grants})
+}
+
+// RevokeMyOAuthGrant retira el acceso de una aplicación
+// @Summary Retirar acceso a una aplicación
+// @Description La aplicación pierde los permisos concedidos y sus tokens dejan de valer
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Param client_id path string true "ID de la aplicación"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /profile/apps/{client_id} [delete]
+func RevokeMyOAuthGrant(c *gin.Context) {
+	err := services.RevokeOAuthGrant(c.Request.Context(), currentUserID(c), c.Param("client_id"))
+	switch {
+	case errors.Is(err, services.ErrOAuthClientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "La aplicación no tiene acceso a tu cuenta"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al retirar el acceso"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Acceso retirado"})
+}
+
+// GetTokenExchanges lista los canjes de tokens entre servicios
+// @Summary Canjes de tokens
+// @Description Registro de los tokens de usuario que los servicios internos canjearon por otros para llamar a otro servicio (RFC 8693): quién canjeó (service), en nombre de qué usuario, con qué token, para qué servicio (audience), con qué scopes, desde qué IP y cuándo. Los más recientes primero
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "Filtrar por usuario"
+// @Param service query string false "Filtrar por el client_id del servicio que canjeó"
+// @Param audience query string false "Filtrar por el client_id del servicio destino"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Canjes por página"
+// @Param exact_count query bool false "Contar el total exacto en lugar de estimarlo en tablas grandes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/token-exchanges [get]
+func GetTokenExchanges(c *gin.Context) {
+	var req TokenExchangesQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	page := pagination(c)
+	filter := services.TokenExchangeFilter{UserID: req.UserID, Service: req.Service, Audience: req.Audience}
+	exchanges, total, err := services.ListTokenExchanges(countContext(c), filter, page.Offset(), page.PerPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los canjes de tokens"})
+		return
+	}
+
+	response := paginated(exchanges, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// CreateOAuthClientRequest datos de una aplicación OAuth
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,max=10" example:"https://app.example.com/callback"`
+	// Aplicación pública (SPA, móvil): sin secreto, solo PKCE
+	Public bool `json:"public"`
+}
+
+// OAuthDeviceQuery código de un dispositivo pendiente de aprobar
+type OAuthDeviceQuery struct {
+	UserCode string `form:"user_code" binding:"required" example:"WDJB-MJHT"`
+}
+
+// OAuthDeviceRequest decisión del usuario sobre un dispositivo
+type OAuthDeviceRequest struct {
+	UserCode string `json:"user_code" binding:"required" example:"WDJB-MJHT"`
+	Approve  bool   `json:"approve"`
+}
+
+// TokenExchangesQuery filtros del registro de canjes de tokens
+type TokenExchangesQuery struct {
+	UserID   uint   `form:"user_id"`
+	Service  string `form:"service"`
+	Audience string `form:"audience"`
+}
+
+// OAuthAuthorizeRequest parámetros de una petición de autorización OAuth2
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type" example:"code"`
+	ClientID            string `json:"client_id" form:"client_id" binding:"required"`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri"`
+	Scope               string `json:"scope" form:"scope" example:"profile:read"`
+	State               string `json:"state" form:"state"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method" example:"S256"`
+	// Decisión del usuario (solo en POST)
+	Approve bool `json:"approve"`
+}
+
+func (r OAuthAuthorizeRequest) service() services.AuthorizationRequest {
+	return services.AuthorizationRequest{
+		ResponseType:        r.ResponseType,
+		ClientID:            r.ClientID,
+		RedirectURI:         r.RedirectURI,
+		Scope:               r.Scope,
+		State:               r.State,
+		CodeChallenge:       r.CodeChallenge,
+		CodeChallengeMethod: r.CodeChallengeMethod,
+	}
+}
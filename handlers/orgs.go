@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api/database"
+	"api/normalize"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyOrganizations lista las organizaciones del usuario
+// @Summary Mis organizaciones
+// @Description Organizaciones a las que pertenece el usuario autenticado con su rol en cada una (admin o member)
+// @Tags orgs
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /orgs [get]
+func GetMyOrganizations(c *gin.Context) {
+	list, err := services.ListUserOrganizations(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las organizaciones"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"organizations": list})
+}
+
+// CreateOrganization crea una organización
+// @Summary Crear organización
+// @Description Crea una organización de la que el usuario autenticado es el primer administrador
+// @Tags orgs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param org body CreateOrganizationRequest true "Identificador y nombre"
+// @Success 201 {object} services.UserOrganization
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs [post]
+func CreateOrganization(c *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	org, err := services.CreateOrganization(c.Request.Context(), currentIdentity(c), req.Slug, req.Name)
+	switch {
+	case errors.Is(err, services.ErrInvalidOrgSlug):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrgExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear la organización"})
+	default:
+		writeJSON(c, http.StatusCreated, services.UserOrganization{Organization: *org, Role: services.OrgRoleAdmin})
+	}
+}
+
+// GetOrganization devuelve una organización
+// @Summary Obtener organización
+// @Description Devuelve la organización con el rol del usuario en ella. Las organizaciones a las que no pertenece responden 404
+// @Tags orgs
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Success 200 {object} services.UserOrganization
+// @Failure 404 {object} map[string]interface{}
+// @Router /orgs/{org} [get]
+func GetOrganization(c *gin.Context) {
+	writeJSON(c, http.StatusOK, services.UserOrganization{Organization: *currentOrg(c), Role: c.GetString("orgRole")})
+}
+
+// UpdateOrganization cambia el nombre de una organización
+// @Summary Modificar organización
+// @Description Cambia el nombre de la organización. Requiere el rol admin en ella
+// @Tags orgs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param body body UpdateOrganizationRequest true "Nuevo nombre"
+// @Success 200 {object} services.UserOrganization
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /orgs/{org} [put]
+func UpdateOrganization(c *gin.Context) {
+	var req UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	org := currentOrg(c)
+	if err := services.UpdateOrganization(c.Request.Context(), org, req.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al modificar la organización"})
+		return
+	}
+	GetOrganization(c)
+}
+
+// DeleteOrganization elimina una organización
+// @Summary Eliminar organización
+// @Description Elimina la organización y las pertenencias de sus miembros (no sus cuentas). Requiere el rol admin en ella
+// @Tags orgs
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Success 204
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /orgs/{org} [delete]
+func DeleteOrganization(c *gin.Context) {
+	if err := services.DeleteOrganization(c.Request.Context(), c.GetUint("orgID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar la organización"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetOrgMembers lista los miembros de una organización
+// @Summary Miembros de la organización
+// @Description Miembros con su rol en la organización, por orden de llegada
+// @Tags orgs
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /orgs/{org}/members [get]
+func GetOrgMembers(c *gin.Context) {
+	list, err := services.ListOrgMembers(c.Request.Context(), c.GetUint("orgID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los miembros"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"members": list})
+}
+
+// AddOrgMember añade un usuario a una organización
+// @Summary Añadir miembro
+// @Description Añade a la organización al usuario con ese email, con el rol admin o member. Requiere el rol admin en ella
+// @Tags orgs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param member body AddOrgMemberRequest true "Email del usuario y rol"
+// @Success 201 {object} database.Membership
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/members [post]
+func AddOrgMember(c *gin.Context) {
+	var req AddOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	membership, err := services.AddOrgMember(c.Request.Context(), c.GetUint("orgID"), req.Email, req.Role)
+	if respondOrgError(c, err, "Error al añadir el miembro") {
+		return
+	}
+	writeJSON(c, http.StatusCreated, membership)
+}
+
+// UpdateOrgMember cambia el rol de un miembro
+// @Summary Cambiar rol de un miembro
+// @Description Cambia el rol del miembro en la organización. No se puede quitar el rol admin al último administrador. Requiere el rol admin en ella
+// @Tags orgs
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param user_id path int true "ID del usuario"
+// @Param member body UpdateOrgMemberRequest true "Nuevo rol"
+// @Success 200 {object} database.Membership
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/members/{user_id} [put]
+func UpdateOrgMember(c *gin.Context) {
+	var req UpdateOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	userID, ok := memberIDFromPath(c)
+	if !ok {
+		return
+	}
+
+	membership, err := services.SetOrgMemberRole(c.Request.Context(), c.GetUint("orgID"), userID, req.Role)
+	if respondOrgError(c, err, "Error al cambiar el rol") {
+		return
+	}
+	writeJSON(c, http.StatusOK, membership)
+}
+
+// RemoveOrgMember saca a un usuario de una organización
+// @Summary Quitar miembro
+// @Description Saca al usuario de la organización (su cuenta no cambia). No se puede quitar al último administrador. Requiere el rol admin en ella
+// @Tags orgs
+// @Security BearerAuth
+// @Param org path string true "Identificador o ID de la organización"
+// @Param user_id path int true "ID del usuario"
+// @Success 204
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /orgs/{org}/members/{user_id} [delete]
+func RemoveOrgMember(c *gin.Context) {
+	userID, ok := memberIDFromPath(c)
+	if !ok {
+		return
+	}
+
+	err := services.RemoveOrgMember(c.Request.Context(), c.GetUint("orgID"), userID)
+	if respondOrgError(c, err, "Error al quitar el miembro") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondOrgError responde al error de una operación sobre los miembros o los
+// grupos de una organización; devuelve false si no hubo error
+func respondOrgError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrInvalidOrgRole), errors.Is(err, services.ErrInvalidGroupSlug):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrMemberNotFound), errors.Is(err, services.ErrNotInGroup):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyMember), errors.Is(err, services.ErrLastOrgAdmin),
+		errors.Is(err, services.ErrGroupExists), errors.Is(err, services.ErrAlreadyInGroup):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return true
+}
+
+// memberIDFromPath ID del usuario :user_id de la ruta; si no es un ID responde
+// 404 y devuelve false
+func memberIDFromPath(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrMemberNotFound.Error()})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// currentOrg organización de la ruta resuelta por OrgMiddleware
+func currentOrg(c *gin.Context) *database.Organization {
+	org, _ := c.MustGet("org").(*database.Organization)
+	return org
+}
+
+// CreateOrganizationRequest estructura para crear una organización
+type CreateOrganizationRequest struct {
+	// Minúsculas, dígitos y -, empezando por una letra
+	Slug string `json:"slug" binding:"required" example:"acme"`
+	Name string `json:"name" binding:"required,max=100" example:"Acme"`
+}
+
+// UpdateOrganizationRequest estructura para modificar una organización
+type UpdateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// AddOrgMemberRequest estructura para añadir un miembro a una organización
+type AddOrgMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=admin member"`
+}
+
+// UpdateOrgMemberRequest estructura para cambiar el rol de un miembro
+type UpdateOrgMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member"`
+}
+
+func (r *CreateOrganizationRequest) Normalize() {
+	r.Slug = normalize.Text(r.Slug)
+	r.Name = normalize.Name(r.Name)
+}
+
+func (r *UpdateOrganizationRequest) Normalize() {
+	r.Name = normalize.Name(r.Name)
+}
+
+func (r *AddOrgMemberRequest) Normalize() {
+	r.Email = normalize.Email(r.Email)
+}
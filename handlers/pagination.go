@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+
+	"api/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de la paginación de listados (v2)
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+	// maxPage acota ?page= para que el desplazamiento no desborde
+	maxPage = 1000000
+)
+
+// apiVersion devuelve la versión de la API negociada por config.APIVersion
+func apiVersion(c *gin.Context) int {
+	if v := c.GetInt("apiVersion"); v > 0 {
+		return v
+	}
+	return 1
+}
+
+// Page parámetros de paginación leídos de ?page= y ?per_page=
+type Page struct {
+	Number  int `json:"page"`
+	PerPage int `json:"per_page"`
+}
+
+// Offset devuelve el desplazamiento correspondiente a la página
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.PerPage
+}
+
+// pagination lee la página solicitada aplicando los valores por defecto y el máximo
+func pagination(c *gin.Context) Page {
+	page := Page{Number: 1, PerPage: defaultPerPage}
+	if n, err := strconv.Atoi(c.Query("page")); err == nil && n > 0 {
+		page.Number = n
+	}
+	if page.Number > maxPage {
+		page.Number = maxPage
+	}
+	if n, err := strconv.Atoi(c.Query("per_page")); err == nil && n > 0 {
+		page.PerPage = n
+	}
+	if page.PerPage > maxPerPage {
+		page.PerPage = maxPerPage
+	}
+	return page
+}
+
+// countContext contexto de la petición en el que el total de un listado puede
+// ser estimado (ver database.Count), salvo que se pida ?exact_count=true
+func countContext(c *gin.Context) context.Context {
+	if exact, _ := strconv.ParseBool(c.Query("exact_count")); exact {
+		return c.Request.Context()
+	}
+	return database.WithEstimatedCount(c.Request.Context())
+}
+
+// paginated construye la respuesta de un listado paginado de v2
+func paginated(data interface{}, page Page, total database.Total) gin.H {
+	return gin.H{
+		"data": data,
+		"meta": pageMeta(page, total),
+	}
+}
+
+// pageMeta metadatos de paginación de un listado; total_estimated indica que
+// el total (y el número de páginas) es aproximado
+func pageMeta(page Page, total database.Total) gin.H {
+	meta := gin.H{
+		"page":        page.Number,
+		"per_page":    page.PerPage,
+		"total":       total.Count,
+		"total_pages": (total.Count + int64(page.PerPage) - 1) / int64(page.PerPage),
+	}
+	if total.Estimated {
+		meta["total_estimated"] = true
+	}
+	return meta
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"api/database"
+	"api/plans"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetPlans lista los planes disponibles
+// @Summary Listar planes
+// @Description Devuelve los planes disponibles y las funciones que incluye cada uno
+// @Tags plans
+// @Produce json
+// @Success 200 {array} database.Plan
+// @Router /plans [get]
+func GetPlans(c *gin.Context) {
+	var list []database.Plan
+	database.DB.WithContext(c.Request.Context()).Order("id").Find(&list)
+	if respondJSONAPI(c, http.StatusOK, list, nil, nil) {
+		return
+	}
+	writeJSON(c, http.StatusOK, list)
+}
+
+// GetMyPlan devuelve el plan del usuario autenticado
+// @Summary Mi plan
+// @Description Devuelve el plan del usuario y las funciones que incluye
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} database.Plan
+// @Router /profile/plan [get]
+func GetMyPlan(c *gin.Context) {
+	plan, err := plans.ForUser(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el plan"})
+		return
+	}
+	if respondJSONAPI(c, http.StatusOK, plan, nil, nil) {
+		return
+	}
+	writeJSON(c, http.StatusOK, plan)
+}
+
+// UpdatePlan actualiza un plan
+// @Summary Actualizar plan
+// @Description Modifica el nombre, las funciones o el precio de Stripe asociado a un plan
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param code path string true "Código del plan"
+// @Param plan body UpdatePlanRequest true "Datos a actualizar"
+// @Success 200 {object} database.Plan
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/plans/{code} [put]
+func UpdatePlan(c *gin.Context) {
+	var req UpdatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var plan database.Plan
+	if err := database.DB.WithContext(c.Request.Context()).Where("code = ?", c.Param("code")).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan no encontrado"})
+		return
+	}
+
+	if req.Name != "" {
+		plan.Name = req.Name
+	}
+	if req.Features != nil {
+		plan.Features = req.Features
+	}
+	if req.StripePriceID != nil {
+		plan.StripePriceID = *req.StripePriceID
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Save(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el plan"})
+		return
+	}
+	writeJSON(c, http.StatusOK, plan)
+}
+
+// AssignUserPlan asigna un plan a un usuario
+// @Summary Asignar plan
+// @Description Cambia manualmente el plan de un usuario
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param plan body AssignPlanRequest true "Plan a asignar"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/plan [put]
+func AssignUserPlan(c *gin.Context) {
+	var req AssignPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := services.AssignPlan(c.Request.Context(), currentIdentity(c), c.Param("id"), req.Plan)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Plan no encontrado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al asignar el plan"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"message": "Plan asignado", "user_id": user.ID, "plan": req.Plan})
+}
+
+// UpdatePlanRequest estructura para actualizar un plan
+type UpdatePlanRequest struct {
+	Name          string   `json:"name"`
+	Features      []string `json:"features"`
+	StripePriceID *string  `json:"stripe_price_id"`
+}
+
+// AssignPlanRequest estructura para asignar un plan a un usuario
+type AssignPlanRequest struct {
+	Plan string `json:"plan" binding:"required"`
+}
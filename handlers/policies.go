@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api/authz"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPolicies lista las políticas de autorización
+// @Summary Políticas de autorización
+// @Description Políticas predefinidas (built_in, no modificables) seguidas de las definidas por la administración del tenant o de la instalación. Una política deny que se cumple prevalece sobre cualquier allow
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/policies [get]
+func GetPolicies(c *gin.Context) {
+	list, err := authz.Policies(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las políticas"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"policies": list})
+}
+
+// CreatePolicy crea una política de autorización
+// @Summary Crear política
+// @Description Crea una política con condiciones sobre los atributos del actor y del recurso, p. ej. permitir users:update con la condición resource.orgs intersects actor.admin_orgs and resource.role != "admin". Se aplica en unos segundos sin cambiar el código
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param policy body PolicyRequest true "Política"
+// @Success 201 {object} authz.Policy
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/policies [post]
+func CreatePolicy(c *gin.Context) {
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	policy, err := authz.Create(c.Request.Context(), req.policy())
+	if respondPolicyError(c, err, "Error al crear la política") {
+		return
+	}
+	writeJSON(c, http.StatusCreated, policy)
+}
+
+// UpdatePolicy sustituye una política de autorización
+// @Summary Modificar política
+// @Description Sustituye una política definida por la administración; las predefinidas no se pueden modificar
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID de la política"
+// @Param policy body PolicyRequest true "Política"
+// @Success 200 {object} authz.Policy
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/policies/{id} [put]
+func UpdatePolicy(c *gin.Context) {
+	var req PolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": authz.ErrPolicyNotFound.Error()})
+		return
+	}
+
+	policy, err := authz.Update(c.Request.Context(), uint(id), req.policy())
+	if respondPolicyError(c, err, "Error al modificar la política") {
+		return
+	}
+	writeJSON(c, http.StatusOK, policy)
+}
+
+// DeletePolicy elimina una política de autorización
+// @Summary Eliminar política
+// @Description Elimina una política definida por la administración
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID de la política"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/policies/{id} [delete]
+func DeletePolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": authz.ErrPolicyNotFound.Error()})
+		return
+	}
+	if respondPolicyError(c, authz.Delete(c.Request.Context(), uint(id)), "Error al eliminar la política") {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SimulateAuthorization explica una decisión de autorización sin aplicarla
+// @Summary Simular una decisión de autorización
+// @Description Responde si el usuario podría hacer la acción sobre el recurso (tipo/ID, p. ej. users/42) y qué política lo decidiría, con los atributos usados y el resultado de cada política. Se pueden añadir políticas en borrador, que no se guardan, para probar una regla antes de crearla
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param simulation body SimulateAuthorizationRequest true "Usuario, acción, recurso y borradores"
+// @Success 200 {object} authz.Simulation
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/authz/simulate [post]
+func SimulateAuthorization(c *gin.Context) {
+	var req SimulateAuthorizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	drafts := make([]authz.Policy, len(req.Policies))
+	for i := range req.Policies {
+		drafts[i] = req.Policies[i].policy()
+	}
+	sim, err := services.SimulateAccess(c.Request.Context(), req.UserID, req.Action, req.Resource, drafts)
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+	case errors.Is(err, services.ErrUnknownResource):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		if respondPolicyError(c, err, "Error al simular la autorización") {
+			return
+		}
+		writeJSON(c, http.StatusOK, sim)
+	}
+}
+
+// GetUserPermissions lista los permisos efectivos de un usuario
+// @Summary Permisos efectivos de un usuario
+// @Description Permisos del usuario resueltos a partir de su rol global, su rol en cada organización (propio y de sus grupos) y las políticas, cada uno con la regla que lo concede, para revisiones de acceso y auditorías. Las acciones con scope conditional dependen de los atributos del recurso (p. ej. solo su propia cuenta); las que tienen effect deny las deniega una política aunque otra las permita
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} services.EffectivePermissions
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/permissions [get]
+func GetUserPermissions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+
+	permissions, err := services.UserPermissions(c.Request.Context(), uint(id))
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los permisos"})
+	default:
+		writeJSON(c, http.StatusOK, permissions)
+	}
+}
+
+// CheckPermission indica si el usuario puede hacer una acción sobre un recurso
+// @Summary Comprobar un permiso
+// @Description Responde si el usuario autenticado puede hacer la acción sobre el recurso (tipo/ID, p. ej. users/42) con la misma decisión que se aplicará al hacerla, para que los clientes oculten o desactiven lo que no puede hacer sin repetir las reglas
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param action query string true "Acción recurso:operación, p. ej. users:delete"
+// @Param resource query string true "Recurso tipo/ID, p. ej. users/42"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /authz/can [get]
+func CheckPermission(c *gin.Context) {
+	var req CheckPermissionRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	allowed, err := services.Can(c.Request.Context(), currentIdentity(c), req.Action, req.Resource)
+	switch {
+	case errors.Is(err, services.ErrUnknownResource):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al comprobar el permiso"})
+	default:
+		writeJSON(c, http.StatusOK, gin.H{"action": req.Action, "resource": req.Resource, "allowed": allowed})
+	}
+}
+
+// respondPolicyError responde al error de una operación sobre las políticas;
+// devuelve false si no hubo error
+func respondPolicyError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, authz.ErrInvalidPolicy), errors.Is(err, authz.ErrInvalidCondition):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, authz.ErrPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, authz.ErrPolicyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return true
+}
+
+// PolicyRequest estructura para crear o sustituir una política
+type PolicyRequest struct {
+	Name        string `json:"name" binding:"required,max=64" example:"org-admins-update-members"`
+	Description string `json:"description" binding:"max=500"`
+	Effect      string `json:"effect" binding:"required,oneof=allow deny"`
+	// Acciones: recurso:operación (users:update), recurso:* o *
+	Actions []string `json:"actions" binding:"required,min=1,dive,required" example:"users:update"`
+	// Condición sobre actor.<atributo> y resource.<atributo>; vacía = siempre
+	Condition string `json:"condition" binding:"max=1000" example:"resource.orgs intersects actor.admin_orgs and resource.role != \"admin\""`
+}
+
+// SimulateAuthorizationRequest estructura para simular una decisión de autorización
+type SimulateAuthorizationRequest struct {
+	UserID uint `json:"user_id" binding:"required" example:"7"`
+	// Acción recurso:operación
+	Action string `json:"action" binding:"required,contains=:" example:"users:update"`
+	// Recurso tipo/ID
+	Resource string `json:"resource" binding:"required" example:"users/42"`
+	// Políticas en borrador que se evalúan junto a las vigentes sin guardarse
+	Policies []PolicyRequest `json:"policies" binding:"max=20,dive"`
+}
+
+// CheckPermissionRequest parámetros para comprobar un permiso
+type CheckPermissionRequest struct {
+	Action   string `form:"action" binding:"required,contains=:"`
+	Resource string `form:"resource" binding:"required"`
+}
+
+func (r *PolicyRequest) policy() authz.Policy {
+	return authz.Policy{Name: r.Name, Description: r.Description, Effect: r.Effect, Actions: r.Actions, Condition: r.Condition}
+}
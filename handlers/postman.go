@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"api/links"
+	"api/openapi"
+	"api/postman"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportPostman genera la colección de Postman de la API
+// @Summary Exportar colección de Postman
+// @Description Devuelve una colección de Postman v2.1 (importable también en Insomnia) con todas las rutas de esta versión de la API, agrupadas por etiqueta y con cuerpos de ejemplo. La autenticación usa las variables {{baseUrl}} y {{token}}; la petición de login rellena {{token}} automáticamente.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /admin/export/postman [get]
+func ExportPostman(c *gin.Context) {
+	base := apiBase(c)
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	collection, err := postman.Build("Geshuro API "+base, links.Routes(), base, scheme+"://"+c.Request.Host+base, openapi.Spec())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar la colección"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="geshuro-api.postman_collection.json"`)
+	writeJSON(c, http.StatusOK, collection)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/database"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPosts lista los posts
+// @Summary Listar posts
+// @Description Posts públicos y los propios del usuario (los administradores ven todos), los más recientes primero
+// @Tags posts
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query int false "Solo los del autor indicado"
+// @Param visibility query string false "public o private"
+// @Param include query string false "Relaciones que añadir en included: author"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Posts por página"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /posts [get]
+func GetPosts(c *gin.Context) {
+	var req PostsQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	page := pagination(c)
+	filter := services.PostFilter{UserID: req.UserID, Visibility: req.Visibility}
+	posts, total, err := services.ListPosts(countContext(c), currentIdentity(c), filter, page.Offset(), page.PerPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los posts"})
+		return
+	}
+	list := withPostLinks(c, posts)
+	if !includePosts(c, list) {
+		return
+	}
+
+	response := paginated(list, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// CreatePost publica un post
+// @Summary Crear post
+// @Description Publica un post del usuario autenticado; sin visibility es public
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param post body PostRequest true "Título, texto y visibilidad"
+// @Success 201 {object} database.Post
+// @Failure 400 {object} map[string]interface{}
+// @Router /posts [post]
+func CreatePost(c *gin.Context) {
+	var req PostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	post, err := services.CreatePost(c.Request.Context(), currentIdentity(c), req.Title, req.Body, req.Visibility)
+	if postError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusCreated, post)
+}
+
+// GetPost devuelve un post
+// @Summary Obtener post
+// @Description Devuelve el post si es público, del usuario autenticado o este es administrador; si no, 404
+// @Tags posts
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Param include query string false "Relaciones que añadir en included: author"
+// @Success 200 {object} database.Post
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id} [get]
+func GetPost(c *gin.Context) {
+	id, ok := postID(c)
+	if !ok {
+		return
+	}
+	post, err := services.GetPost(c.Request.Context(), currentIdentity(c), id)
+	if postError(c, err) {
+		return
+	}
+	list := withPostLinks(c, []database.Post{*post})
+	if !includePosts(c, list) {
+		return
+	}
+	writeJSON(c, http.StatusOK, list[0])
+}
+
+// UpdatePost modifica un post
+// @Summary Modificar post
+// @Description Sustituye el título, el texto y la visibilidad. Solo su autor y los administradores: al resto, 403 si pueden verlo y 404 si no
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Param post body PostRequest true "Título, texto y visibilidad"
+// @Success 200 {object} database.Post
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id} [put]
+func UpdatePost(c *gin.Context) {
+	id, ok := postID(c)
+	if !ok {
+		return
+	}
+	var req PostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	post, err := services.UpdatePost(c.Request.Context(), currentIdentity(c), id, req.Title, req.Body, req.Visibility)
+	if postError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, post)
+}
+
+// DeletePost elimina un post
+// @Summary Eliminar post
+// @Description Solo su autor y los administradores
+// @Tags posts
+// @Security BearerAuth
+// @Param id path int true "ID del post"
+// @Success 204
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /posts/{id} [delete]
+func DeletePost(c *gin.Context) {
+	id, ok := postID(c)
+	if !ok {
+		return
+	}
+	if postError(c, services.DeletePost(c.Request.Context(), currentIdentity(c), id)) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func postID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post no encontrado"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// postError responde a los errores de las rutas de posts; devuelve false si
+// no hubo error
+func postError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post no encontrado"})
+	case errors.Is(err, services.ErrPostForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Solo el autor puede modificar el post"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al gestionar el post"})
+	}
+	return true
+}
+
+// PostRequest datos de un post
+type PostRequest struct {
+	Title string `json:"title" binding:"required,max=200" example:"Primeros pasos"`
+	Body  string `json:"body" binding:"max=20000" example:"Hoy he empezado a usar la API"`
+	// public (por defecto) o private
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public private" example:"public"`
+}
+
+// PostsQuery filtros del listado de posts
+type PostsQuery struct {
+	UserID     uint   `form:"user_id"`
+	Visibility string `form:"visibility" binding:"omitempty,oneof=public private"`
+}
+
+func (r *PostRequest) Normalize() {
+	r.Title, r.Body = strings.TrimSpace(r.Title), strings.TrimSpace(r.Body)
+}
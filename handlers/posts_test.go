@@ -0,0 +1,83 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"api/apitest"
+)
+
+func TestPosts(t *testing.T) {
+	srv := apitest.New(t)
+	owner := srv.CreateUser(t, "")
+	other := srv.CreateUser(t, "")
+	admin := srv.CreateUser(t, "admin")
+	token := apitest.WithToken(owner.Token)
+	otherToken := apitest.WithToken(other.Token)
+
+	var post struct {
+		ID         uint   `json:"id"`
+		Title      string `json:"title"`
+		Visibility string `json:"visibility"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/posts", map[string]string{"title": " Público ", "body": "Hola"}, token).
+		Expect(t, http.StatusCreated).JSON(t, &post)
+	if post.Title != "Público" || post.Visibility != "public" {
+		t.Errorf("post = %+v", post)
+	}
+	public := "/api/v1/posts/" + strconv.FormatUint(uint64(post.ID), 10)
+	srv.Do(t, http.MethodPost, "/api/v1/posts", map[string]string{"title": "Privado", "visibility": "private"}, token).
+		Expect(t, http.StatusCreated).JSON(t, &post)
+	private := "/api/v1/posts/" + strconv.FormatUint(uint64(post.ID), 10)
+	srv.Do(t, http.MethodPost, "/api/v1/posts", map[string]string{"title": "X", "visibility": "friends"}, token).
+		Expect(t, http.StatusBadRequest)
+
+	// Los privados solo los ven su autor y los administradores; los públicos
+	// los ve cualquiera, pero solo los modifica su autor
+	srv.Do(t, http.MethodGet, private, nil, otherToken).Expect(t, http.StatusNotFound)
+	srv.Do(t, http.MethodGet, private, nil, apitest.WithToken(admin.Token)).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, public, nil, otherToken).Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodPut, public, map[string]string{"title": "Mío"}, otherToken).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodDelete, public, nil, otherToken).Expect(t, http.StatusForbidden)
+	srv.Do(t, http.MethodPut, private, map[string]string{"title": "Mío"}, otherToken).Expect(t, http.StatusNotFound)
+
+	var list struct {
+		Data []struct {
+			Title    string `json:"title"`
+			Included struct {
+				Author struct {
+					ID   uint   `json:"id"`
+					Name string `json:"name"`
+				} `json:"author"`
+			} `json:"included"`
+		} `json:"data"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/posts?include=author", nil, otherToken).Expect(t, http.StatusOK).JSON(t, &list)
+	if len(list.Data) != 1 || list.Data[0].Included.Author.ID != owner.ID || list.Data[0].Included.Author.Name != owner.Name {
+		t.Errorf("listado de otro usuario = %+v", list.Data)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/posts?visibility=private&user_id="+strconv.FormatUint(uint64(owner.ID), 10), nil, token).
+		Expect(t, http.StatusOK).JSON(t, &list)
+	if len(list.Data) != 1 || list.Data[0].Title != "Privado" {
+		t.Errorf("privados del autor = %+v", list.Data)
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/posts?include=comments", nil, token).Expect(t, http.StatusBadRequest)
+
+	// Desde los usuarios, sus últimos posts públicos
+	var user struct {
+		Included struct {
+			Posts []struct {
+				Title string `json:"title"`
+			} `json:"posts"`
+		} `json:"included"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/users/"+strconv.FormatUint(uint64(owner.ID), 10)+"?include=posts", nil, token).
+		Expect(t, http.StatusOK).JSON(t, &user)
+	if len(user.Included.Posts) != 1 || user.Included.Posts[0].Title != "Público" {
+		t.Errorf("posts del usuario = %+v", user.Included.Posts)
+	}
+
+	srv.Do(t, http.MethodDelete, public, nil, token).Expect(t, http.StatusNoContent)
+	srv.Do(t, http.MethodGet, public, nil, token).Expect(t, http.StatusNotFound)
+}
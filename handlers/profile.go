@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"api/database"
+	"api/normalize"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProfile obtiene el perfil del usuario autenticado
+// @Summary Obtener perfil
+// @Description Cuenta del usuario autenticado (user) y sus datos personales: biografía, teléfono, fecha de nacimiento y dirección (profile)
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /profile [get]
+func GetProfile(c *gin.Context) {
+	ctx := c.Request.Context()
+	user, err := services.GetUser(ctx, currentUserID(c))
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el perfil"})
+		return
+	}
+	profile, err := services.GetProfile(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el perfil"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"message": "Perfil del usuario",
+		"user":    linkUser(c, user),
+		"profile": profile,
+	})
+}
+
+// UpdateProfile reemplaza los datos personales del usuario autenticado
+// @Summary Actualizar perfil
+// @Description Reemplaza la biografía, el teléfono (E.164), la fecha de nacimiento (AAAA-MM-DD) y la dirección (país ISO 3166-1 alfa-2); los campos que no se envían se borran. El nombre y el email se cambian con PUT /users/{id}
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param profile body UpdateProfileRequest true "Datos personales"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /profile [put]
+func UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	profile, err := services.SaveProfile(c.Request.Context(), currentUserID(c), database.Profile{
+		Bio:      req.Bio,
+		Phone:    req.Phone,
+		Birthday: req.Birthday,
+		Address:  database.Address(req.Address),
+	})
+	if errors.Is(err, services.ErrInvalidBirthday) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La fecha de nacimiento no puede ser futura"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar el perfil"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Perfil actualizado", "profile": profile})
+}
+
+// ChangeMyPassword cambia la contraseña del usuario autenticado
+// @Summary Cambiar contraseña
+// @Description Cambia la contraseña comprobando la actual. Es lo único que se puede hacer, además de consultar el perfil, cuando el inicio de sesión devolvió password_change_required (la contraseña caducó o un administrador exige cambiarla); el resto de rutas responden 403 hasta entonces
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param password body ChangePasswordRequest true "Contraseña actual y nueva"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /profile/password [post]
+func ChangeMyPassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	err := services.ChangePassword(c.Request.Context(), currentUserID(c), req.CurrentPassword, req.NewPassword)
+	switch {
+	case errors.Is(err, services.ErrWrongPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La contraseña actual no es correcta"})
+		return
+	case errors.Is(err, services.ErrPasswordReused):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La contraseña nueva tiene que ser distinta de la actual"})
+		return
+	case errors.Is(err, services.ErrPwnedPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La contraseña aparece en filtraciones de datos conocidas; elige otra"})
+		return
+	case errors.Is(err, services.ErrPasswordCheckUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No se pudo comprobar la contraseña, inténtalo más tarde"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cambiar la contraseña"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Contraseña cambiada"})
+}
+
+// ChangePasswordRequest contraseña actual y nueva
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,strong_password"`
+}
+
+// UpdateProfileRequest datos personales del perfil
+type UpdateProfileRequest struct {
+	Bio      string         `json:"bio" binding:"max=500"`
+	Phone    string         `json:"phone" binding:"omitempty,phone" example:"+34600111222"`
+	Birthday string         `json:"birthday" binding:"omitempty,datetime=2006-01-02" example:"1990-05-17"`
+	Address  AddressRequest `json:"address"`
+}
+
+// AddressRequest dirección postal
+type AddressRequest struct {
+	Line1      string `json:"line1" binding:"max=200"`
+	Line2      string `json:"line2" binding:"max=200"`
+	City       string `json:"city" binding:"max=100"`
+	Region     string `json:"region" binding:"max=100"`
+	PostalCode string `json:"postal_code" binding:"max=16"`
+	Country    string `json:"country" binding:"omitempty,iso3166_1_alpha2" example:"ES"`
+}
+
+func (r *UpdateProfileRequest) Normalize() {
+	r.Bio = strings.TrimSpace(r.Bio)
+	r.Phone = normalize.Phone(r.Phone)
+	r.Birthday = normalize.Text(r.Birthday)
+	a := &r.Address
+	a.Line1 = normalize.Text(a.Line1)
+	a.Line2 = normalize.Text(a.Line2)
+	a.City = normalize.Name(a.City)
+	a.Region = normalize.Name(a.Region)
+	a.PostalCode = strings.ToUpper(normalize.Text(a.PostalCode))
+	a.Country = strings.ToUpper(normalize.Text(a.Country))
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api/database"
+	"api/quotas"
+	"api/tenancy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyQuotas devuelve las cuotas del usuario autenticado
+// @Summary Mis cuotas
+// @Description Límite, consumo y margen restante de cada cuota de la cuenta
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} quotas.Status
+// @Router /profile/quotas [get]
+func GetMyQuotas(c *gin.Context) {
+	list, err := quotaStatuses(c.Request.Context(), quotas.ScopeUser, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al calcular las cuotas"})
+		return
+	}
+	writeJSON(c, http.StatusOK, list)
+}
+
+// GetTenantQuotas devuelve las cuotas del tenant de la petición
+// @Summary Cuotas del tenant
+// @Description Límite, consumo y margen restante de las cuotas del tenant (X-Tenant): peticiones por minuto, usuarios y almacenamiento. Los límites los ajustan los administradores de la plataforma
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} quotas.Status
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/tenant/quotas [get]
+func GetTenantQuotas(c *gin.Context) {
+	tenantID := c.GetUint("tenantID")
+	if tenantID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "La petición no es de ningún tenant (X-Tenant)"})
+		return
+	}
+	list, err := quotaStatuses(c.Request.Context(), quotas.ScopeTenant, tenantID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al calcular las cuotas"})
+		return
+	}
+	writeJSON(c, http.StatusOK, list)
+}
+
+// GetQuotas devuelve las cuotas de una cuenta
+// @Summary Cuotas de una cuenta
+// @Description Límite efectivo (por defecto o personalizado) y consumo de cada cuota. Las del ámbito tenant solo las consultan y ajustan los administradores de la plataforma
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param scope path string true "Ámbito (user o tenant)"
+// @Param id path int true "ID de la cuenta o del tenant"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/quotas/{scope}/{id} [get]
+func GetQuotas(c *gin.Context) {
+	scope, id, ok := quotaScope(c)
+	if !ok {
+		return
+	}
+
+	list, err := quotaStatuses(c.Request.Context(), scope, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al calcular las cuotas"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"scope": scope, "scope_id": id, "quotas": list})
+}
+
+// UpdateQuota fija un límite personalizado para una cuenta
+// @Summary Ajustar cuota
+// @Description Sustituye el límite por defecto de una cuota (0 = sin límite)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param scope path string true "Ámbito (user o tenant)"
+// @Param id path int true "ID de la cuenta o del tenant"
+// @Param quota body UpdateQuotaRequest true "Cuota y nuevo límite"
+// @Success 200 {object} quotas.Status
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/quotas/{scope}/{id} [put]
+func UpdateQuota(c *gin.Context) {
+	scope, id, ok := quotaScope(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := quotas.Set(ctx, scope, id, req.Quota, *req.Limit); err != nil {
+		respondQuotaError(c, err)
+		return
+	}
+
+	status, err := quotas.Get(ctx, scope, id, req.Quota)
+	if err != nil {
+		respondQuotaError(c, err)
+		return
+	}
+	writeJSON(c, http.StatusOK, status)
+}
+
+// ResetQuota elimina el límite personalizado de una cuota
+// @Summary Restablecer cuota
+// @Description Vuelve a aplicar el límite por defecto configurado
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param scope path string true "Ámbito (user o tenant)"
+// @Param id path int true "ID de la cuenta o del tenant"
+// @Param name path string true "Nombre de la cuota"
+// @Success 200 {object} quotas.Status
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/quotas/{scope}/{id}/{name} [delete]
+func ResetQuota(c *gin.Context) {
+	scope, id, ok := quotaScope(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := quotas.Reset(ctx, scope, id, c.Param("name")); err != nil {
+		respondQuotaError(c, err)
+		return
+	}
+
+	status, err := quotas.Get(ctx, scope, id, c.Param("name"))
+	if err != nil {
+		respondQuotaError(c, err)
+		return
+	}
+	writeJSON(c, http.StatusOK, status)
+}
+
+// quotaScope valida el ámbito y el ID de la ruta; si no son válidos responde con error
+func quotaScope(c *gin.Context) (string, uint, bool) {
+	scope := c.Param("scope")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return "", 0, false
+	}
+
+	switch scope {
+	case quotas.ScopeUser:
+		var count int64
+		database.DB.WithContext(c.Request.Context()).Model(&database.User{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+			return "", 0, false
+		}
+	case quotas.ScopeTenant:
+		// Los tenants no ajustan sus propios límites
+		if !c.GetBool("platformAdmin") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Acceso restringido a los administradores de la plataforma"})
+			return "", 0, false
+		}
+		var count int64
+		database.DB.WithContext(tenancy.With(c.Request.Context(), "")).Model(&database.Tenant{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tenant no encontrado"})
+			return "", 0, false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ámbito de cuota inválido"})
+		return "", 0, false
+	}
+	return scope, uint(id), true
+}
+
+func quotaStatuses(ctx context.Context, scope string, id uint) ([]quotas.Status, error) {
+	list := []quotas.Status{}
+	for _, d := range quotas.Definitions(scope) {
+		status, err := quotas.Get(ctx, scope, id, d.Name)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, status)
+	}
+	return list, nil
+}
+
+func respondQuotaError(c *gin.Context, err error) {
+	if errors.Is(err, quotas.ErrUnknownQuota) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cuota desconocida para este ámbito"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al actualizar la cuota"})
+}
+
+// UpdateQuotaRequest estructura para ajustar una cuota
+type UpdateQuotaRequest struct {
+	Quota string `json:"quota" binding:"required"`
+	Limit *int64 `json:"limit" binding:"required,min=0"`
+}
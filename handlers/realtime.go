@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"api/realtime"
+	"api/services"
+	"api/terms"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 30 * time.Second
+
+	// sseHeartbeat intervalo de los comentarios que mantienen viva la conexión SSE
+	// a través de proxies con timeout de inactividad
+	sseHeartbeat = 15 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{"bearer"},
+	// La autenticación va en el token, no en cookies, así que no hay riesgo de
+	// secuestro de la conexión desde otro origen (igual que CORS con "*")
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WebSocket abre el canal de eventos en tiempo real del usuario
+// @Summary Canal de eventos en tiempo real
+// @Description Conexión WebSocket que recibe los eventos del usuario (profile.updated, export.ready, subscription.updated) y las difusiones de los administradores. El token se envía en Authorization o, desde el navegador, como subprotocolos ["bearer", "<token>"]
+// @Tags realtime
+// @Security BearerAuth
+// @Success 101
+// @Failure 401 {object} map[string]interface{}
+func WebSocket(c *gin.Context) {
+	identity, err := services.AuthenticateToken(c.Request.Context(), wsToken(c.Request), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido o expirado"})
+		return
+	}
+	if identity.Suspension != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tu cuenta está suspendida", "suspension": identity.Suspension})
+		return
+	}
+	if identity.PasswordChangeRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tienes que cambiar la contraseña antes de continuar", "password_change_required": true})
+		return
+	}
+	if identity.TermsPending {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Tienes que aceptar los términos de uso para continuar", "terms_required": true, "terms": terms.Current()})
+		return
+	}
+	// Un administrador de la plataforma no tiene usuario en el tenant
+	if identity.ActingTenant != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "En un tenant, los administradores de la plataforma solo acceden a su administración"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade ya ha respondido con el error
+		return
+	}
+	defer conn.Close()
+
+	sub := realtime.Subscribe(c.Request.Context(), identity.UserID)
+	defer sub.Close()
+
+	// Lectura: solo se atienden pings/pongs y el cierre; los mensajes del cliente se ignoran
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Events envía los mismos eventos que /ws como Server-Sent Events
+// @Summary Stream de eventos (SSE)
+// @Description Alternativa a /ws para clientes sin WebSocket. Cada evento lleva id; al reconectar con la cabecera Last-Event-ID se reenvían los eventos recientes que se perdieron. Cada 15 s se envía un comentario de keep-alive.
+// @Tags realtime
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param Last-Event-ID header string false "Último evento recibido"
+// @Success 200 {string} string "text/event-stream"
+// @Failure 401 {object} map[string]interface{}
+func Events(c *gin.Context) {
+	sub, missed := realtime.SubscribeFrom(c.Request.Context(), currentUserID(c), c.GetHeader("Last-Event-ID"))
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Desactiva el buffer de nginx para que los eventos lleguen al momento
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	for _, event := range missed {
+		writeSSE(c.Writer, event)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeSSE(c.Writer, event)
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeSSE(w io.Writer, event realtime.Event) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+// wsToken lee el token de Authorization o del subprotocolo "bearer, <token>"
+// (los navegadores no permiten cabeceras propias al abrir un WebSocket)
+func wsToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return header[7:]
+	}
+	protocols := websocket.Subprotocols(r)
+	if len(protocols) == 2 && protocols[0] == "bearer" {
+		return protocols[1]
+	}
+	return ""
+}
+
+// BroadcastEvent envía un aviso a todos los usuarios conectados
+// @Summary Difundir aviso
+// @Description Envía un evento admin.broadcast a todas las conexiones WebSocket abiertas
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param message body BroadcastRequest true "Aviso"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/broadcast [post]
+func BroadcastEvent(c *gin.Context) {
+	var req BroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	realtime.Broadcast(c.Request.Context(), realtime.EventBroadcast, req)
+	writeJSON(c, http.StatusAccepted, gin.H{"message": "Aviso enviado"})
+}
+
+type BroadcastRequest struct {
+	Message string `json:"message" binding:"required,max=1000"`
+	Level   string `json:"level" binding:"omitempty,oneof=info warning critical"`
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/ids"
+	"api/jobs"
+	"api/normalize"
+	"api/reports"
+	"api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReportRequest estructura para solicitar un informe
+type ReportRequest struct {
+	// users, signups, audit o summary
+	Type string `json:"type" binding:"required"`
+	// Mes del resumen (2006-01); por defecto el anterior al actual
+	Month string `json:"month"`
+}
+
+// RequestReport solicita un informe de administración
+// @Summary Generar informe
+// @Description Genera de forma asíncrona el informe indicado: users (usuarios), signups (altas) o audit (cambios de los administradores en los usuarios e inicios de sesión) en Excel (XLSX), o summary, el resumen mensual de crecimiento y actividad en PDF para el mes de month. Se avisa con el evento report.ready cuando está listo
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param report body ReportRequest true "Informe"
+// @Success 202 {object} database.Report
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/reports [post]
+func RequestReport(c *gin.Context) {
+	var req ReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !reports.Exists(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Informe desconocido, disponibles: " + strings.Join(reports.Types(), ", ")})
+		return
+	}
+
+	report := database.Report{ID: ids.New(), Type: req.Type, Status: "pending"}
+	if req.Type == reports.Summary {
+		if reports.PDF == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "La generación de informes en PDF no está configurada"})
+			return
+		}
+		month := reports.PreviousMonth()
+		if req.Month != "" {
+			parsed, err := time.Parse(reports.PeriodLayout, req.Month)
+			if err != nil || parsed.After(clock.Now().UTC()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "month debe ser un mes no futuro con el formato AAAA-MM"})
+				return
+			}
+			month = parsed
+		}
+		report.Period = month.Format(reports.PeriodLayout)
+	}
+
+	adminID := currentUserID(c)
+	var pending int64
+	database.DB.WithContext(c.Request.Context()).Model(&database.Report{}).Where("requested_by = ? AND type = ? AND status = ?", adminID, req.Type, "pending").Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya hay un informe de este tipo en curso"})
+		return
+	}
+
+	report.RequestedBy = adminID
+	if err := database.DB.WithContext(c.Request.Context()).Create(&report).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear el informe"})
+		return
+	}
+	if err := jobs.Enqueue(c.Request.Context(), reports.Job, reports.Payload{ReportID: report.ID}); err != nil {
+		database.DB.WithContext(c.Request.Context()).Model(&report).Update("status", "failed")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No se pudo iniciar el informe, inténtalo más tarde"})
+		return
+	}
+
+	writeJSON(c, http.StatusAccepted, report)
+}
+
+// GetReport devuelve el estado de un informe y su enlace de descarga
+// @Summary Estado de informe
+// @Description Devuelve el estado del informe y, si está listo, una URL de descarga firmada
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID del informe"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 410 {object} map[string]interface{}
+// @Router /admin/reports/{id} [get]
+func GetReport(c *gin.Context) {
+	var report database.Report
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ?", c.Param("id")).First(&report).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Informe no encontrado"})
+		return
+	}
+
+	if report.Status != "ready" {
+		writeJSON(c, http.StatusOK, gin.H{"report": report})
+		return
+	}
+
+	remaining := clock.Until(*report.ExpiresAt)
+	if remaining <= 0 {
+		c.JSON(http.StatusGone, gin.H{"error": "El informe ha expirado, solicita uno nuevo"})
+		return
+	}
+	if remaining > signedURLTTL {
+		remaining = signedURLTTL
+	}
+
+	url, err := storage.Default.SignedURL(c.Request.Context(), report.ObjectKey, remaining)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar la URL de descarga"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"report": report, "download_url": url})
+}
+
+// ReportScheduleRequest estructura para crear o modificar un informe programado
+type ReportScheduleRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	// Informe: users, signups, audit o summary
+	Type string `json:"type" binding:"required"`
+	// daily, weekly o monthly
+	Frequency  string   `json:"frequency" binding:"required"`
+	Recipients []string `json:"recipients" binding:"required,min=1,max=20,dive,email"`
+	// Por defecto true
+	Enabled *bool `json:"enabled"`
+}
+
+// Normalize limpia el nombre y los emails de los destinatarios
+func (r *ReportScheduleRequest) Normalize() {
+	r.Name = normalize.Text(r.Name)
+	for i, email := range r.Recipients {
+		r.Recipients[i] = normalize.Email(email)
+	}
+}
+
+// GetReportSchedules lista los informes programados
+// @Summary Listar informes programados
+// @Description Informes que se generan periódicamente y se envían por correo, con su próxima ejecución y el resultado de la última
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/report-schedules [get]
+func GetReportSchedules(c *gin.Context) {
+	var list []database.ReportSchedule
+	if err := database.DB.WithContext(c.Request.Context()).Order("id").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los informes programados"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"schedules": list})
+}
+
+// CreateReportSchedule programa un informe
+// @Summary Programar informe
+// @Description Programa el envío por correo del informe con la frecuencia indicada. Cada envío incluye los datos del último periodo completo (el día, la semana de lunes a domingo o el mes anteriores, en UTC)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param schedule body ReportScheduleRequest true "Informe programado"
+// @Success 201 {object} database.ReportSchedule
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/report-schedules [post]
+func CreateReportSchedule(c *gin.Context) {
+	var req ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := reports.ValidateSchedule(req.Type, req.Frequency); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := database.ReportSchedule{
+		Name:       req.Name,
+		Type:       req.Type,
+		Frequency:  req.Frequency,
+		Recipients: req.Recipients,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		CreatedBy:  currentUserID(c),
+		NextRunAt:  reports.NextRun(req.Frequency, clock.Now()),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al programar el informe"})
+		return
+	}
+	writeJSON(c, http.StatusCreated, schedule)
+}
+
+// UpdateReportSchedule modifica un informe programado
+// @Summary Modificar informe programado
+// @Description Sustituye los datos del informe programado; si cambia la frecuencia se recalcula la próxima ejecución
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del informe programado"
+// @Param schedule body ReportScheduleRequest true "Informe programado"
+// @Success 200 {object} database.ReportSchedule
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/report-schedules/{id} [put]
+func UpdateReportSchedule(c *gin.Context) {
+	var schedule database.ReportSchedule
+	if err := database.DB.WithContext(c.Request.Context()).First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Informe programado no encontrado"})
+		return
+	}
+	var req ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := reports.ValidateSchedule(req.Type, req.Frequency); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Frequency != schedule.Frequency {
+		schedule.NextRunAt = reports.NextRun(req.Frequency, clock.Now())
+	}
+	schedule.Name = req.Name
+	schedule.Type = req.Type
+	schedule.Frequency = req.Frequency
+	schedule.Recipients = req.Recipients
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	if err := database.DB.WithContext(c.Request.Context()).Save(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al modificar el informe programado"})
+		return
+	}
+	writeJSON(c, http.StatusOK, schedule)
+}
+
+// DeleteReportSchedule elimina un informe programado
+// @Summary Eliminar informe programado
+// @Description Deja de enviar el informe; los ya generados se conservan hasta que expiran
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del informe programado"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/report-schedules/{id} [delete]
+func DeleteReportSchedule(c *gin.Context) {
+	res := database.DB.WithContext(c.Request.Context()).Delete(&database.ReportSchedule{}, c.Param("id"))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al eliminar el informe programado"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Informe programado no encontrado"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Informe programado eliminado"})
+}
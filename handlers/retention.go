@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"api/database"
+	"api/jobs"
+	"api/retention"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRetentionRules lista las reglas de retención y su configuración efectiva
+// @Summary Reglas de retención
+// @Description Lista las reglas de retención de datos con su plazo efectivo (overridden si es uno propio del tenant, ver /admin/tenant/settings) y la última ejecución
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} map[string]interface{}
+// @Router /admin/retention [get]
+func GetRetentionRules(c *gin.Context) {
+	overrides, err := retention.Overrides(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los plazos de retención"})
+		return
+	}
+	result := []gin.H{}
+	for _, rule := range retention.Rules() {
+		ttl, enabled := rule.TTLWith(overrides)
+		_, overridden := overrides[rule.Name]
+		item := gin.H{
+			"name":        rule.Name,
+			"description": rule.Description,
+			"enabled":     enabled,
+			"ttl":         ttl.String(),
+			"overridden":  overridden,
+		}
+
+		var last database.RetentionRun
+		if err := database.DB.WithContext(c.Request.Context()).Where("rule = ?", rule.Name).Order("started_at DESC").First(&last).Error; err == nil {
+			item["last_run"] = last
+		}
+		result = append(result, item)
+	}
+
+	writeJSON(c, http.StatusOK, result)
+}
+
+// GetRetentionRuns devuelve el informe de lo purgado por las reglas de retención
+// @Summary Informe de retención
+// @Description Devuelve las ejecuciones recientes de las reglas de retención y cuántos registros purgó cada una
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param rule query string false "Filtrar por regla"
+// @Param limit query int false "Número máximo de resultados (por defecto 100)"
+// @Success 200 {array} database.RetentionRun
+// @Router /admin/retention/runs [get]
+func GetRetentionRuns(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Order("started_at DESC").Limit(limit)
+	if rule := c.Query("rule"); rule != "" {
+		query = query.Where("rule = ?", rule)
+	}
+
+	var runs []database.RetentionRun
+	if err := query.Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el informe de retención"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, runs)
+}
+
+// RunRetention ejecuta inmediatamente las reglas de retención
+// @Summary Ejecutar retención
+// @Description Encola una ejecución inmediata de todas las reglas de retención activas
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} map[string]interface{}
+// @Router /admin/retention/run [post]
+func RunRetention(c *gin.Context) {
+	if err := jobs.Enqueue(c.Request.Context(), retention.Job, nil); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No se pudo encolar la ejecución"})
+		return
+	}
+
+	writeJSON(c, http.StatusAccepted, gin.H{"message": "Ejecución de retención encolada"})
+}
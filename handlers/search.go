@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchUsers sugiere usuarios para autocompletado
+// @Summary Buscar usuarios (autocompletado)
+// @Description Usuarios activos cuyo nombre o email empieza por q, ordenados por nombre. Solo devuelve id, nombre, nombre de usuario y avatar. Con menos de 2 caracteres la lista está vacía. Para filtrar y paginar el listado completo usar GET /users
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Prefijo del nombre o del email"
+// @Param limit query int false "Máximo de resultados (por defecto 8, máximo 20)"
+// @Success 200 {object} map[string]interface{}
+// @Router /users/search [get]
+func SearchUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	users, err := services.SearchUsers(c.Request.Context(), c.Query("q"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al buscar usuarios"})
+		return
+	}
+	// Las pulsaciones seguidas repiten las mismas consultas
+	c.Header("Cache-Control", "private, max-age=30")
+	writeJSON(c, http.StatusOK, gin.H{"data": users})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"api/preferences"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMySettings devuelve las preferencias del usuario autenticado
+// @Summary Mis preferencias
+// @Description Preferencias del usuario (tema, tamaño de página, frecuencia de correos...) con los valores por defecto de las que no ha cambiado, y la versión que hay que enviar al modificarlas
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} services.Settings
+// @Router /profile/settings [get]
+func GetMySettings(c *gin.Context) {
+	settings, err := services.GetSettings(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las preferencias"})
+		return
+	}
+	writeJSON(c, http.StatusOK, settings)
+}
+
+// UpdateMySettings modifica las preferencias del usuario autenticado
+// @Summary Modificar mis preferencias
+// @Description Combina las preferencias enviadas con las guardadas: las que no se envían no cambian y null vuelve al valor por defecto. Con version, los cambios se rechazan (409, con las preferencias actuales) si otra sesión las modificó antes
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body UpdateSettingsRequest true "Preferencias a cambiar"
+// @Success 200 {object} services.Settings
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/settings [put]
+func UpdateMySettings(c *gin.Context) {
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	settings, err := services.UpdateSettings(ctx, currentUserID(c), req.Settings, req.Version)
+	var invalid *preferences.Error
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Preferencia inválida", "preference": invalid.Name, "details": invalid.Reason})
+		return
+	case errors.Is(err, services.ErrSettingsConflict):
+		response := gin.H{"error": "Las preferencias se han modificado en otra sesión; vuelve a aplicar los cambios sobre las actuales"}
+		if current, err := services.GetSettings(ctx, currentUserID(c)); err == nil {
+			response["current"] = current
+		}
+		writeJSON(c, http.StatusConflict, response)
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar las preferencias"})
+		return
+	}
+	writeJSON(c, http.StatusOK, settings)
+}
+
+// UpdateSettingsRequest preferencias a cambiar
+type UpdateSettingsRequest struct {
+	Settings map[string]json.RawMessage `json:"settings" binding:"required" swaggertype:"object"`
+	// Versión leída en GET /profile/settings (opcional)
+	Version *int `json:"version"`
+}
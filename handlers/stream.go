@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"api/database"
+	"api/localtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Formatos de los listados en streaming
+const (
+	// streamNDJSON un objeto JSON por línea (Accept: application/x-ndjson)
+	streamNDJSON = "ndjson"
+	// streamArray un array JSON que se envía por partes (?stream=true)
+	streamArray = "array"
+)
+
+// ndjsonContentType tipo de medio de las respuestas NDJSON
+const ndjsonContentType = "application/x-ndjson"
+
+// streamFlushRows filas que se envían de una vez en los listados en streaming
+const streamFlushRows = 500
+
+// streamFormat indica si el cliente pidió el listado en streaming y en qué
+// formato; vacío si no (o si pidió JSON:API, que no se envía en streaming)
+func streamFormat(c *gin.Context) string {
+	if c.GetBool("jsonapi") {
+		return ""
+	}
+	if strings.Contains(c.GetHeader("Accept"), ndjsonContentType) {
+		return streamNDJSON
+	}
+	if c.Query("stream") == "true" {
+		return streamArray
+	}
+	return ""
+}
+
+// streamRows responde con las filas del cursor en el formato indicado,
+// leyéndolas una a una en lugar de cargar el listado en memoria; item
+// convierte cada fila en el objeto que se envía. Las fechas se envían en la
+// zona horaria del cliente, como en writeJSON.
+//
+// Un error a mitad de respuesta ya no puede cambiar el estado: en NDJSON se
+// envía como una última línea {"error": "..."} y el array se deja sin cerrar,
+// para que el cliente no lo tome por completo.
+func streamRows[T any](c *gin.Context, format string, rows *sql.Rows, item func(*T) interface{}) {
+	defer rows.Close()
+
+	name, loc := responseLocation(c)
+	c.Header(localtime.Header, name)
+	c.Writer.Header().Add("Vary", localtime.Header)
+	if format == streamNDJSON {
+		c.Header("Content-Type", ndjsonContentType)
+	} else {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	fail := func(err error) {
+		log.Printf("⚠️  Listado en streaming %s interrumpido: %v", c.Request.URL.Path, err)
+		if format == streamNDJSON {
+			enc.Encode(gin.H{"error": "Error al obtener los datos"})
+		}
+	}
+
+	if format == streamArray {
+		c.Writer.WriteString("[")
+	}
+	n := 0
+	for rows.Next() {
+		var row T
+		if err := database.DB.ScanRows(rows, &row); err != nil {
+			fail(err)
+			return
+		}
+		if format == streamArray && n > 0 {
+			c.Writer.WriteString(",")
+		}
+		if err := enc.Encode(localtime.Localize(item(&row), loc)); err != nil {
+			// El cliente cerró la conexión
+			return
+		}
+		if n++; n%streamFlushRows == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		fail(err)
+		return
+	}
+	if format == streamArray {
+		c.Writer.WriteString("]")
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMySuspension devuelve la suspensión en curso del usuario autenticado
+// @Summary Consultar mi suspensión
+// @Description Motivo, inicio y fin (null = hasta que se levante) de la suspensión en curso y el estado de su apelación. Es, con la apelación, lo único que puede hacer un usuario suspendido: el resto de rutas responden 403 con este mismo contenido en suspension
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /profile/suspension [get]
+func GetMySuspension(c *gin.Context) {
+	suspension, err := services.MySuspension(c.Request.Context(), currentUserID(c))
+	if errors.Is(err, services.ErrNotSuspended) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tu cuenta no está suspendida"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener la suspensión"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"suspension": suspension})
+}
+
+// AppealMySuspension apela la suspensión en curso del usuario autenticado
+// @Summary Apelar mi suspensión
+// @Description Envía a los administradores las alegaciones del usuario contra su suspensión en curso; solo se admite una apelación por suspensión. Los administradores la revisan en GET /admin/suspensions/appeals y la aceptan levantando la suspensión o la rechazan con una nota
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param appeal body SuspensionAppealRequest true "Alegaciones"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/suspension/appeal [post]
+func AppealMySuspension(c *gin.Context) {
+	var req SuspensionAppealRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	suspension, err := services.AppealSuspension(c.Request.Context(), currentUserID(c), req.Message)
+	switch {
+	case errors.Is(err, services.ErrNotSuspended):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tu cuenta no está suspendida"})
+		return
+	case errors.Is(err, services.ErrAppealExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya apelaste esta suspensión"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la apelación"})
+		return
+	}
+	writeJSON(c, http.StatusCreated, gin.H{"message": "Apelación enviada", "suspension": suspension})
+}
+
+// SuspendUser suspende la cuenta de un usuario
+// @Summary Suspender usuario
+// @Description A diferencia de la desactivación, el usuario puede iniciar sesión (la respuesta incluye suspension) y sus sesiones siguen abiertas, pero el resto de rutas, claves de API y tokens OAuth incluidos, responden 403 con el motivo y el fin de la suspensión hasta que acabe o se levante; solo puede consultarla y apelarla. Sin until dura hasta que se levante. Un administrador no puede suspender su propia cuenta
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param suspension body SuspendUserRequest true "Motivo y fin"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/users/{id}/suspend [post]
+func SuspendUser(c *gin.Context) {
+	id, ok := suspendedUserID(c)
+	if !ok {
+		return
+	}
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	suspension, err := services.SuspendUser(c.Request.Context(), currentIdentity(c), id, req.Reason, req.Until)
+	switch {
+	case errors.Is(err, services.ErrSelfSuspension):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No puedes suspender tu propia cuenta"})
+		return
+	case errors.Is(err, services.ErrInvalidSuspensionEnd):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El fin de la suspensión tiene que ser futuro"})
+		return
+	case errors.Is(err, services.ErrAlreadySuspended):
+		c.JSON(http.StatusConflict, gin.H{"error": "El usuario ya está suspendido"})
+		return
+	}
+	if suspensionError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusCreated, gin.H{"message": "Usuario suspendido", "suspension": suspension})
+}
+
+// LiftUserSuspension levanta la suspensión en curso de un usuario
+// @Summary Levantar suspensión
+// @Description Levanta la suspensión en curso; si el usuario la había apelado, la apelación queda aceptada. La nota queda en el registro de la suspensión
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param decision body SuspensionNoteRequest false "Nota"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/suspension/lift [post]
+func LiftUserSuspension(c *gin.Context) {
+	id, ok := suspendedUserID(c)
+	if !ok {
+		return
+	}
+	var req SuspensionNoteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+			return
+		}
+	}
+
+	suspension, err := services.LiftSuspension(c.Request.Context(), currentIdentity(c), id, req.Note)
+	if suspensionError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Suspensión levantada", "suspension": suspension})
+}
+
+// RejectSuspensionAppeal rechaza la apelación de un usuario suspendido
+// @Summary Rechazar apelación
+// @Description Rechaza la apelación pendiente de la suspensión en curso, que se mantiene. La nota, obligatoria, queda en el registro de la suspensión
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param decision body SuspensionNoteRequest true "Motivo del rechazo"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/users/{id}/suspension/appeal/reject [post]
+func RejectSuspensionAppeal(c *gin.Context) {
+	id, ok := suspendedUserID(c)
+	if !ok {
+		return
+	}
+	var req SuspensionNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indica el motivo del rechazo en note"})
+		return
+	}
+
+	suspension, err := services.RejectSuspensionAppeal(c.Request.Context(), currentIdentity(c), id, req.Note)
+	if errors.Is(err, services.ErrNoPendingAppeal) {
+		c.JSON(http.StatusConflict, gin.H{"error": "La suspensión no tiene una apelación pendiente"})
+		return
+	}
+	if suspensionError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Apelación rechazada", "suspension": suspension})
+}
+
+// GetUserSuspensions devuelve el historial de suspensiones de un usuario
+// @Summary Suspensiones de un usuario
+// @Description Todas las suspensiones del usuario, las más recientes primero, con sus acciones (suspend, appeal, reject_appeal, lift), quién las hizo, cuándo y su nota, para revisar las apelaciones
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/suspensions [get]
+func GetUserSuspensions(c *gin.Context) {
+	id, ok := suspendedUserID(c)
+	if !ok {
+		return
+	}
+	suspensions, err := services.UserSuspensions(c.Request.Context(), id)
+	if suspensionError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"suspensions": suspensions})
+}
+
+// GetPendingAppeals lista las apelaciones por decidir
+// @Summary Apelaciones pendientes
+// @Description Suspensiones en curso con una apelación por decidir, las más antiguas primero
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Apelaciones por página"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/suspensions/appeals [get]
+func GetPendingAppeals(c *gin.Context) {
+	page := pagination(c)
+	suspensions, total, err := services.PendingAppeals(countContext(c), page.Offset(), page.PerPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las apelaciones"})
+		return
+	}
+
+	response := paginated(suspensions, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+func suspendedUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// suspensionError responde a los errores comunes de las rutas de suspensiones;
+// devuelve false si no hubo error
+func suspensionError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+	case errors.Is(err, services.ErrNotSuspended):
+		c.JSON(http.StatusNotFound, gin.H{"error": "El usuario no está suspendido"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al gestionar la suspensión"})
+	}
+	return true
+}
+
+// SuspendUserRequest motivo, que se muestra al usuario, y fin de la suspensión
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"required,max=500" example:"Envío masivo de mensajes no solicitados"`
+	// nil = hasta que se levante
+	Until *time.Time `json:"until" example:"2026-01-31T00:00:00Z"`
+}
+
+// SuspensionNoteRequest nota de un administrador sobre una suspensión
+type SuspensionNoteRequest struct {
+	Note string `json:"note" binding:"max=2000"`
+}
+
+// SuspensionAppealRequest alegaciones del usuario suspendido
+type SuspensionAppealRequest struct {
+	Message string `json:"message" binding:"required,max=2000"`
+}
+
+func (r *SuspendUserRequest) Normalize()      { r.Reason = strings.TrimSpace(r.Reason) }
+func (r *SuspensionNoteRequest) Normalize()   { r.Note = strings.TrimSpace(r.Note) }
+func (r *SuspensionAppealRequest) Normalize() { r.Message = strings.TrimSpace(r.Message) }
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTags lista las etiquetas de usuarios
+// @Summary Etiquetas
+// @Description Todas las etiquetas por nombre con el número de usuarios que tiene cada una
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/tags [get]
+func GetTags(c *gin.Context) {
+	tags, err := services.ListTags(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las etiquetas"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"tags": tags})
+}
+
+// DeleteTag elimina una etiqueta
+// @Summary Eliminar etiqueta
+// @Description Elimina la etiqueta y se la quita a todos los usuarios que la tenían
+// @Tags admin
+// @Security BearerAuth
+// @Param tag path string true "Etiqueta"
+// @Success 204
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/tags/{tag} [delete]
+func DeleteTag(c *gin.Context) {
+	if tagError(c, services.DeleteTag(c.Request.Context(), c.Param("tag"))) {
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// BulkTagUsers asigna y quita etiquetas a varios usuarios
+// @Summary Etiquetar usuarios en bloque
+// @Description Asigna las etiquetas de add (creando las que no existen) y quita las de remove a todos los usuarios de user_ids en una transacción. Hasta 1000 usuarios y 20 etiquetas entre add y remove; los IDs que no son de ningún usuario se devuelven en missing y las asignaciones que ya estaban no cuentan en added
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tags body BulkTagRequest true "Usuarios y etiquetas"
+// @Success 200 {object} services.BulkTagResult
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/tags/bulk [post]
+func BulkTagUsers(c *gin.Context) {
+	var req BulkTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	if len(req.Add)+len(req.Remove) == 0 || len(req.Add)+len(req.Remove) > services.MaxBulkTags {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indica entre 1 y " + strconv.Itoa(services.MaxBulkTags) + " etiquetas en add y remove"})
+		return
+	}
+
+	result, err := services.BulkTagUsers(c.Request.Context(), currentIdentity(c), req.UserIDs, req.Add, req.Remove)
+	if tagError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, result)
+}
+
+// GetUserTags devuelve las etiquetas de un usuario
+// @Summary Etiquetas de un usuario
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/tags [get]
+func GetUserTags(c *gin.Context) {
+	id, ok := pathUserID(c)
+	if !ok {
+		return
+	}
+	tags, err := services.UserTags(c.Request.Context(), id)
+	if tagError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"tags": tags})
+}
+
+// TagUser asigna una etiqueta a un usuario
+// @Summary Etiquetar usuario
+// @Description Asigna la etiqueta, que se crea si no existe; si el usuario ya la tenía no cambia. Las etiquetas se guardan en minúsculas
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param tag path string true "Etiqueta"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/tags/{tag} [put]
+func TagUser(c *gin.Context) {
+	id, ok := pathUserID(c)
+	if !ok {
+		return
+	}
+	tags, err := services.TagUser(c.Request.Context(), currentIdentity(c), id, c.Param("tag"))
+	if tagError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"tags": tags})
+}
+
+// UntagUser quita una etiqueta a un usuario
+// @Summary Quitar etiqueta
+// @Description Si el usuario no la tenía no cambia
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID del usuario"
+// @Param tag path string true "Etiqueta"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /admin/users/{id}/tags/{tag} [delete]
+func UntagUser(c *gin.Context) {
+	id, ok := pathUserID(c)
+	if !ok {
+		return
+	}
+	tags, err := services.UntagUser(c.Request.Context(), currentIdentity(c), id, c.Param("tag"))
+	if tagError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"tags": tags})
+}
+
+// userFilter lee los filtros del listado de usuarios (?tag=beta,vip: los que
+// tienen todas). Filtrar por etiqueta es solo para administradores. Devuelve
+// false si ya respondió con un error.
+func userFilter(c *gin.Context) (services.UserFilter, bool) {
+	var filter services.UserFilter
+	if c.Query("tag") == "" {
+		return filter, true
+	}
+	if c.GetString("userRole") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Solo los administradores pueden filtrar por etiqueta"})
+		return filter, false
+	}
+	tags, err := services.ParseTags(c.Query("tag"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return filter, false
+	}
+	filter.Tags = tags
+	return filter, true
+}
+
+// pathUserID ID del usuario de la ruta (:id)
+func pathUserID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// tagError responde a los errores de las rutas de etiquetas; devuelve false
+// si no hubo error
+func tagError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+	case errors.Is(err, services.ErrTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Etiqueta no encontrada"})
+	case errors.Is(err, services.ErrInvalidTag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al gestionar las etiquetas"})
+	}
+	return true
+}
+
+// BulkTagRequest usuarios y etiquetas de una asignación en bloque
+type BulkTagRequest struct {
+	UserIDs []uint `json:"user_ids" binding:"required,min=1,max=1000" example:"1,2,3"`
+	// Etiquetas que asignar
+	Add []string `json:"add" example:"beta"`
+	// Etiquetas que quitar, después de asignar las de add
+	Remove []string `json:"remove" example:"vip"`
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"api/clock"
+	"api/database"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTenants lista los tenants de la instalación
+// @Summary Listar tenants
+// @Description Devuelve los tenants con su estado (provisioning, active o failed). Solo con TENANCY=schema, para administradores de la plataforma y desde el esquema public.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/tenants [get]
+func GetTenants(c *gin.Context) {
+	list, err := services.ListTenants(c.Request.Context())
+	if errors.Is(err, services.ErrTenancyDisabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los tenants"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"tenants": list})
+}
+
+// CreateTenant da de alta un tenant con su propio esquema
+// @Summary Dar de alta un tenant
+// @Description Crea el esquema del tenant con todas las tablas, los planes predefinidos y, si se indica, su primer administrador. Solo para administradores de la plataforma. Si el alta falla el tenant queda como failed y repetir la petición la reintenta.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tenant body CreateTenantRequest true "Identificador, nombre y administrador"
+// @Success 201 {object} database.Tenant
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /admin/tenants [post]
+func CreateTenant(c *gin.Context) {
+	var req CreateTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var admin *services.TenantAdmin
+	if req.Admin != nil {
+		admin = &services.TenantAdmin{Email: req.Admin.Email, Password: req.Admin.Password, Name: req.Admin.Name}
+	}
+	tenant, err := services.ProvisionTenant(c.Request.Context(), req.Slug, req.Name, admin, currentUserID(c))
+	switch {
+	case errors.Is(err, services.ErrInvalidTenantSlug):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPwnedPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "La contraseña del administrador aparece en filtraciones de datos conocidas; elige otra"})
+	case errors.Is(err, services.ErrPasswordCheckUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No se pudo comprobar la contraseña, inténtalo más tarde"})
+	case errors.Is(err, services.ErrTenantExists), errors.Is(err, services.ErrTenancyDisabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al dar de alta el tenant"})
+	default:
+		writeJSON(c, http.StatusCreated, tenant)
+	}
+}
+
+// GetTenantStats devuelve métricas de todos los tenants
+// @Summary Métricas agregadas de los tenants
+// @Description Usuarios, usuarios activos, altas e inicios de sesión de los últimos días en el esquema public (tenant vacío) y en cada tenant activo, con la suma de todos. Solo para administradores de la plataforma.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Días a considerar para altas e inicios de sesión (por defecto 30)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/tenants/stats [get]
+func GetTenantStats(c *gin.Context) {
+	days := statsDays(c)
+	list, totals, err := services.AggregateTenantStats(c.Request.Context(), clock.Now().AddDate(0, 0, -days))
+	if errors.Is(err, services.ErrTenancyDisabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al calcular las métricas de los tenants"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"days": days, "tenants": list, "totals": totals})
+}
+
+// GetTenantAccesses lista las peticiones de los administradores de la plataforma en un tenant
+// @Summary Accesos de administradores de la plataforma a un tenant
+// @Description Peticiones hechas con X-Tenant por administradores de la plataforma, las más recientes primero, incluidas las rechazadas por las salvaguardas
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Identificador del tenant"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Accesos por página"
+// @Param exact_count query bool false "Contar el total exacto en lugar de estimarlo en tablas grandes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /admin/tenants/{slug}/accesses [get]
+func GetTenantAccesses(c *gin.Context) {
+	page := pagination(c)
+	var list []database.TenantAccess
+	query := database.DB.WithContext(countContext(c)).Model(&database.TenantAccess{}).Where("tenant = ?", c.Param("slug"))
+	total, err := database.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los accesos"})
+		return
+	}
+	if err := query.Order("created_at DESC, id DESC").Offset(page.Offset()).Limit(page.PerPage).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los accesos"})
+		return
+	}
+
+	response := paginated(list, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// GetTenant devuelve un tenant
+// @Summary Obtener tenant
+// @Description Devuelve el tenant sea cual sea su estado. Solo para administradores de la plataforma.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Identificador del tenant"
+// @Success 200 {object} database.Tenant
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/tenants/{slug} [get]
+func GetTenant(c *gin.Context) {
+	tenant, err := services.GetTenant(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondTenantError(c, err, "Error al obtener el tenant")
+		return
+	}
+	writeJSON(c, http.StatusOK, tenant)
+}
+
+// SuspendTenant suspende un tenant
+// @Summary Suspender tenant
+// @Description Rechaza todas las peticiones del tenant, con 402 si el motivo es billing (impago) y 403 si es admin, y detiene sus trabajos periódicos; sus datos se conservan. Sobre un tenant ya suspendido cambia el motivo. Solo para administradores de la plataforma.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Identificador del tenant"
+// @Param suspension body SuspendTenantRequest true "Motivo de la suspensión"
+// @Success 200 {object} database.Tenant
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/tenants/{slug}/suspend [post]
+func SuspendTenant(c *gin.Context) {
+	var req SuspendTenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenant, err := services.SuspendTenant(c.Request.Context(), c.Param("slug"), req.Reason, currentUserID(c))
+	if err != nil {
+		respondTenantError(c, err, "Error al suspender el tenant")
+		return
+	}
+	writeJSON(c, http.StatusOK, tenant)
+}
+
+// ResumeTenant reactiva un tenant suspendido
+// @Summary Reactivar tenant
+// @Description Migra el esquema del tenant suspendido y vuelve a aceptar sus peticiones. Solo para administradores de la plataforma.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Identificador del tenant"
+// @Success 200 {object} database.Tenant
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/tenants/{slug}/resume [post]
+func ResumeTenant(c *gin.Context) {
+	tenant, err := services.ResumeTenant(c.Request.Context(), c.Param("slug"), currentUserID(c))
+	if err != nil {
+		respondTenantError(c, err, "Error al reactivar el tenant")
+		return
+	}
+	writeJSON(c, http.StatusOK, tenant)
+}
+
+// ExportTenant exporta el esquema de un tenant
+// @Summary Exportar tenant
+// @Description Hace de forma asíncrona una copia cifrada del esquema del tenant, activo o suspendido. Es una copia de seguridad con el campo tenant: su estado y la descarga se consultan con GET /admin/backups/{id} y se restaura con el comando api restore. Solo para administradores de la plataforma.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Identificador del tenant"
+// @Success 202 {object} database.Backup
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/tenants/{slug}/export [post]
+func ExportTenant(c *gin.Context) {
+	b, err := services.ExportTenant(c.Request.Context(), c.Param("slug"), currentUserID(c))
+	if err != nil {
+		respondTenantError(c, err, "Error al exportar el tenant")
+		return
+	}
+	writeJSON(c, http.StatusAccepted, b)
+}
+
+// DeleteTenant da de baja un tenant
+// @Summary Eliminar tenant
+// @Description Borra el esquema del tenant con todos sus datos y libera su identificador. Solo se admite con el tenant suspendido o con el alta fallida; conviene exportarlo antes. Sus eventos y el registro de accesos se conservan. Solo para administradores de la plataforma.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param slug path string true "Identificador del tenant"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/tenants/{slug} [delete]
+func DeleteTenant(c *gin.Context) {
+	if err := services.DeleteTenant(c.Request.Context(), c.Param("slug"), currentUserID(c)); err != nil {
+		respondTenantError(c, err, "Error al eliminar el tenant")
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Tenant eliminado"})
+}
+
+// GetTenantEvents lista los eventos del ciclo de vida de los tenants
+// @Summary Eventos de los tenants
+// @Description Altas, suspensiones, reactivaciones, exportaciones y bajas de tenants, los más recientes primero, para facturación y automatizaciones de operaciones. Para procesarlos en orden, after devuelve los posteriores a un ID, los más antiguos primero. Solo para administradores de la plataforma.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param slug query string false "Filtrar por tenant"
+// @Param type query string false "Filtrar por tipo (tenant.provisioned, tenant.suspended, tenant.resumed, tenant.exported, tenant.export_failed, tenant.deleted)"
+// @Param after query int false "Solo los eventos con ID mayor, en orden ascendente"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Eventos por página"
+// @Param exact_count query bool false "Contar el total exacto en lugar de estimarlo en tablas grandes"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /admin/tenants/events [get]
+func GetTenantEvents(c *gin.Context) {
+	page := pagination(c)
+	var list []database.TenantEvent
+	query := database.DB.WithContext(countContext(c)).Model(&database.TenantEvent{})
+	if slug := c.Query("slug"); slug != "" {
+		query = query.Where("tenant = ?", slug)
+	}
+	if kind := c.Query("type"); kind != "" {
+		query = query.Where("type = ?", kind)
+	}
+	order := "id DESC"
+	if after, err := strconv.ParseUint(c.Query("after"), 10, 64); err == nil {
+		query = query.Where("id > ?", after)
+		order = "id"
+	}
+	total, err := database.Count(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los eventos"})
+		return
+	}
+	if err := query.Order(order).Offset(page.Offset()).Limit(page.PerPage).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los eventos"})
+		return
+	}
+
+	response := paginated(list, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+func respondTenantError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrTenantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tenant no encontrado"})
+	case errors.Is(err, services.ErrInvalidSuspendReason):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTenancyDisabled), errors.Is(err, services.ErrTenantState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("❌ %s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+type CreateTenantRequest struct {
+	Slug  string              `json:"slug" binding:"required"`
+	Name  string              `json:"name" binding:"required,max=200"`
+	Admin *TenantAdminRequest `json:"admin"`
+}
+
+type TenantAdminRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,strong_password"`
+	Name     string `json:"name" binding:"required"`
+}
+
+type SuspendTenantRequest struct {
+	Reason string `json:"reason" binding:"required,oneof=billing admin"`
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"api/services"
+	"api/terms"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTerms devuelve la versión vigente de los términos de uso
+// @Summary Términos de uso vigentes
+// @Description Versión que hay que aceptar y dirección de su texto; version vacía si no se exige ninguna
+// @Tags auth
+// @Produce json
+// @Success 200 {object} terms.Terms
+// @Router /terms [get]
+func GetTerms(c *gin.Context) {
+	writeJSON(c, http.StatusOK, terms.Current())
+}
+
+// AcceptMyTerms registra que el usuario autenticado acepta los términos vigentes
+// @Summary Aceptar los términos de uso
+// @Description Mientras el usuario no acepte la versión vigente, el resto de rutas responden 403 con terms_required y los términos (version y url) para mostrar la pantalla de aceptación. version tiene que ser la vigente: si cambió mientras se mostraba responde 409 con la nueva. La aceptación se conserva con la fecha y la IP
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param acceptance body AcceptTermsRequest true "Versión aceptada"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/terms [post]
+func AcceptMyTerms(c *gin.Context) {
+	var req AcceptTermsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	user, err := services.AcceptTerms(c.Request.Context(), currentUserID(c), req.Version, c.ClientIP())
+	switch {
+	case errors.Is(err, services.ErrTermsOutdated):
+		c.JSON(http.StatusConflict, gin.H{"error": "Los términos han cambiado; revisa la versión vigente", "terms": terms.Current()})
+		return
+	case errors.Is(err, services.ErrInactiveUser):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la aceptación"})
+		return
+	}
+	writeJSON(c, http.StatusOK, gin.H{"message": "Términos aceptados", "terms_version": user.TermsVersion, "terms_accepted_at": user.TermsAcceptedAt})
+}
+
+// GetAdminTerms devuelve los términos de uso vigentes
+// @Summary Consultar los términos exigidos
+// @Description Versión de los términos que tienen que haber aceptado los usuarios y cuándo se publicó
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} terms.Terms
+// @Router /admin/terms [get]
+func GetAdminTerms(c *gin.Context) {
+	writeJSON(c, http.StatusOK, terms.Current())
+}
+
+// UpdateTerms publica una nueva versión de los términos de uso
+// @Summary Publicar los términos de uso
+// @Description Al cambiar la versión, las sesiones de los usuarios que no la hayan aceptado solo sirven para aceptarla (POST /profile/terms); las claves de API y los tokens OAuth no se ven afectados. version vacía deja de exigir ninguna
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param terms body UpdateTermsRequest true "Versión y dirección del texto"
+// @Success 200 {object} terms.Terms
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/terms [put]
+func UpdateTerms(c *gin.Context) {
+	var req UpdateTermsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	if err := terms.Set(terms.Terms{Version: req.Version, URL: req.URL}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar los términos"})
+		return
+	}
+	writeJSON(c, http.StatusOK, terms.Current())
+}
+
+// AcceptTermsRequest versión de los términos que acepta el usuario
+type AcceptTermsRequest struct {
+	Version string `json:"version" binding:"required,max=32" example:"2026-10"`
+}
+
+// UpdateTermsRequest estructura para publicar los términos de uso
+type UpdateTermsRequest struct {
+	Version string `json:"version" binding:"max=32" example:"2026-10"`
+	URL     string `json:"url" binding:"omitempty,url,max=500" example:"https://example.com/terminos"`
+}
+
+func (r *AcceptTermsRequest) Normalize() { r.Version = strings.TrimSpace(r.Version) }
+func (r *UpdateTermsRequest) Normalize() {
+	r.Version, r.URL = strings.TrimSpace(r.Version), strings.TrimSpace(r.URL)
+}
@@ -0,0 +1,600 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/ids"
+	"api/images"
+	"api/quotas"
+	"api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Valores por defecto de las subidas por partes
+const (
+	defaultChunkSize     = 5 << 20
+	defaultMaxUploadSize = 1 << 30
+	uploadSessionTTL     = 24 * time.Hour
+	presignTTL           = 15 * time.Minute
+)
+
+func init() {
+	exports.RegisterSection("uploads", func(ctx context.Context, userID uint) (interface{}, error) {
+		var chunked []database.UploadSession
+		var direct []database.DirectUpload
+		if err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&chunked).Error; err != nil {
+			return nil, err
+		}
+		if err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&direct).Error; err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"chunked": chunked, "direct": direct}, nil
+	})
+}
+
+// InitUpload inicia una sesión de subida por partes
+// @Summary Iniciar subida por partes
+// @Description Crea una sesión de subida reanudable y devuelve el tamaño de parte a usar
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param upload body InitUploadRequest true "Datos del archivo"
+// @Success 201 {object} database.UploadSession
+// @Failure 400 {object} map[string]interface{}
+// @Router /uploads [post]
+func InitUpload(c *gin.Context) {
+	var req InitUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename, ok := safeFilename(req.Filename)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nombre de archivo inválido"})
+		return
+	}
+
+	if req.TotalSize > maxUploadSize() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo supera el tamaño máximo permitido"})
+		return
+	}
+
+	if !checkStorageQuota(c, req.TotalSize) {
+		return
+	}
+
+	chunkSize := chunkSize()
+	session := database.UploadSession{
+		ID:          ids.New(),
+		UserID:      currentUserID(c),
+		Filename:    filename,
+		ContentType: req.ContentType,
+		TotalSize:   req.TotalSize,
+		ChunkSize:   chunkSize,
+		TotalParts:  int((req.TotalSize + chunkSize - 1) / chunkSize),
+		Status:      "pending",
+		ExpiresAt:   clock.Now().Add(uploadSessionTTL),
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear la sesión de subida"})
+		return
+	}
+
+	writeJSON(c, http.StatusCreated, session)
+}
+
+// GetUpload devuelve el estado de una sesión y las partes ya recibidas
+// @Summary Estado de subida
+// @Description Devuelve las partes recibidas para que el cliente pueda reanudar la transferencia
+// @Tags uploads
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID de la sesión"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /uploads/{id} [get]
+func GetUpload(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+
+	var parts []int
+	database.DB.WithContext(c.Request.Context()).Model(&database.UploadPart{}).Where("session_id = ?", session.ID).Order("number").Pluck("number", &parts)
+
+	writeJSON(c, http.StatusOK, gin.H{
+		"upload":         session,
+		"received_parts": parts,
+	})
+}
+
+// UploadPart recibe una parte del archivo (cuerpo binario)
+// @Summary Subir parte
+// @Description Sube la parte indicada; reenviar una parte la sobrescribe
+// @Tags uploads
+// @Accept octet-stream
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID de la sesión"
+// @Param number path int true "Número de parte (desde 1)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /uploads/{id}/parts/{number} [put]
+func UploadPart(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "La sesión de subida ya no admite partes"})
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil || number < 1 || number > session.TotalParts {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Número de parte inválido"})
+		return
+	}
+
+	// Todas las partes miden ChunkSize salvo la última
+	expected := session.ChunkSize
+	if number == session.TotalParts {
+		expected = session.TotalSize - session.ChunkSize*int64(session.TotalParts-1)
+	}
+	if c.Request.ContentLength >= 0 && c.Request.ContentLength != expected {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("La parte %d debe medir %d bytes", number, expected)})
+		return
+	}
+
+	body := io.LimitReader(c.Request.Body, expected+1)
+	counter := &countingReader{r: body}
+	if err := storage.Default.Put(c.Request.Context(), storage.PartKey(session.ID, number), counter, c.Request.ContentLength, "application/octet-stream"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar la parte"})
+		return
+	}
+	if counter.n != expected {
+		storage.Default.Delete(c.Request.Context(), storage.PartKey(session.ID, number))
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("La parte %d debe medir %d bytes", number, expected)})
+		return
+	}
+
+	part := database.UploadPart{SessionID: session.ID, Number: number, Size: counter.n}
+	if err := database.DB.WithContext(c.Request.Context()).Where("session_id = ? AND number = ?", session.ID, number).
+		Assign(database.UploadPart{Size: counter.n}).FirstOrCreate(&part).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la parte"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"number": number, "size": counter.n})
+}
+
+// CompleteUpload ensambla las partes en el archivo final
+// @Summary Completar subida
+// @Description Verifica que todas las partes estén presentes y las une en el archivo final. Si otra petición ya lo está haciendo responde 409
+// @Tags uploads
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID de la sesión"
+// @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /uploads/{id}/complete [post]
+func CompleteUpload(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status == "completed" {
+		writeJSON(c, http.StatusOK, gin.H{"message": "Subida ya completada", "upload": session})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var parts []database.UploadPart
+	database.DB.WithContext(ctx).Where("session_id = ?", session.ID).Order("number").Find(&parts)
+	if len(parts) != session.TotalParts {
+		missing := missingParts(parts, session.TotalParts)
+		c.JSON(http.StatusConflict, gin.H{"error": "Faltan partes por subir", "missing_parts": missing})
+		return
+	}
+
+	// Solo una petición pasa de pending a completing y ensambla el archivo; las
+	// que se cruzan con ella reciben 409
+	claim := database.DB.WithContext(ctx).Model(session).Where("status = ?", "pending").Update("status", "completing")
+	if claim.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al completar la subida"})
+		return
+	}
+	if claim.RowsAffected != 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": "La subida ya se está completando"})
+		return
+	}
+
+	key := fmt.Sprintf("attachments/%d/%s/%s", session.UserID, session.ID, session.Filename)
+	reader := &partsReader{ctx: ctx, sessionID: session.ID, total: session.TotalParts}
+	defer reader.Close()
+
+	if err := storage.Default.Put(ctx, key, reader, session.TotalSize, session.ContentType); err != nil {
+		// Se libera para que el cliente pueda reintentarlo
+		database.DB.WithContext(context.WithoutCancel(ctx)).Model(session).Where("status = ?", "completing").Update("status", "pending")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al ensamblar el archivo"})
+		return
+	}
+
+	session.Status = "completed"
+	session.ObjectKey = key
+	if err := database.DB.WithContext(ctx).Model(session).Select("status", "object_key").Updates(session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al completar la subida"})
+		return
+	}
+	cleanupUploadParts(ctx, session.ID, session.TotalParts)
+
+	url, _ := storage.Default.SignedURL(ctx, key, signedURLTTL)
+	writeJSON(c, http.StatusOK, gin.H{
+		"message": "Subida completada exitosamente",
+		"upload":  session,
+		"url":     url,
+	})
+}
+
+// AbortUpload cancela una sesión y elimina las partes recibidas
+// @Summary Cancelar subida
+// @Description Cancela la sesión de subida y libera las partes almacenadas
+// @Tags uploads
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID de la sesión"
+// @Success 200 {object} map[string]interface{}
+// @Router /uploads/{id} [delete]
+func AbortUpload(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status == "completing" {
+		c.JSON(http.StatusConflict, gin.H{"error": "La subida ya se está completando"})
+		return
+	}
+
+	cleanupUploadParts(c.Request.Context(), session.ID, session.TotalParts)
+	database.DB.WithContext(c.Request.Context()).Delete(session)
+
+	writeJSON(c, http.StatusOK, gin.H{"message": "Subida cancelada"})
+}
+
+// PresignUpload emite una URL prefirmada para subir directamente al almacenamiento
+// @Summary Solicitar URL de subida directa
+// @Description Devuelve una URL PUT de corta duración restringida al tipo de contenido y tamaño indicados
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param upload body PresignUploadRequest true "Datos del archivo"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /uploads/presign [post]
+func PresignUpload(c *gin.Context) {
+	var req PresignUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename, ok := safeFilename(req.Filename)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nombre de archivo inválido"})
+		return
+	}
+
+	userID := currentUserID(c)
+	id := ids.New()
+	var key string
+
+	switch req.Purpose {
+	case "avatar":
+		ext, allowed := avatarExtensions[req.ContentType]
+		if !allowed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de imagen no soportado"})
+			return
+		}
+		if req.Size > maxAvatarSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El avatar supera el tamaño máximo permitido"})
+			return
+		}
+		key = fmt.Sprintf("avatars/%d/original/%d%s", userID, clock.Now().UnixNano(), ext)
+	case "attachment":
+		if req.Size > maxUploadSize() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo supera el tamaño máximo permitido"})
+			return
+		}
+		if !checkStorageQuota(c, req.Size) {
+			return
+		}
+		key = fmt.Sprintf("attachments/%d/%s/%s", userID, id, filename)
+	}
+
+	url, headers, err := storage.Default.PresignPut(c.Request.Context(), key, req.ContentType, req.Size, presignTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar la URL de subida"})
+		return
+	}
+
+	upload := database.DirectUpload{
+		ID:          id,
+		UserID:      userID,
+		Purpose:     req.Purpose,
+		Filename:    filename,
+		ContentType: req.ContentType,
+		Size:        req.Size,
+		Status:      "pending",
+		ObjectKey:   key,
+		ExpiresAt:   clock.Now().Add(presignTTL),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&upload).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al registrar la subida"})
+		return
+	}
+
+	writeJSON(c, http.StatusCreated, gin.H{
+		"upload":     upload,
+		"method":     http.MethodPut,
+		"upload_url": url,
+		"headers":    headers,
+	})
+}
+
+// ConfirmUpload confirma una subida directa y asocia el objeto a su registro
+// @Summary Confirmar subida directa
+// @Description Verifica que el objeto exista con el tamaño acordado y lo asocia al registro propietario
+// @Tags uploads
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "ID de la subida"
+// @Success 200 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /uploads/presign/{id}/confirm [post]
+func ConfirmUpload(c *gin.Context) {
+	var upload database.DirectUpload
+	if err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), currentUserID(c)).First(&upload).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subida no encontrada"})
+		return
+	}
+	if upload.Status == "confirmed" {
+		writeJSON(c, http.StatusOK, gin.H{"message": "Subida ya confirmada", "upload": upload})
+		return
+	}
+
+	ctx := c.Request.Context()
+	size, err := storage.Default.Stat(ctx, upload.ObjectKey)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusConflict, gin.H{"error": "El archivo todavía no se ha subido"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el archivo"})
+		return
+	}
+	if size != upload.Size {
+		storage.Default.Delete(ctx, upload.ObjectKey)
+		c.JSON(http.StatusConflict, gin.H{"error": "El tamaño del archivo no coincide con el solicitado"})
+		return
+	}
+
+	if upload.Purpose == "avatar" {
+		if err := checkAvatarObject(ctx, upload.ObjectKey); err != nil {
+			storage.Default.Delete(ctx, upload.ObjectKey)
+			database.DB.WithContext(c.Request.Context()).Model(&upload).Update("status", "rejected")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "El archivo subido no es una imagen válida"})
+			return
+		}
+
+		user, ok := currentUser(c)
+		if !ok {
+			return
+		}
+		if err := setAvatar(ctx, user, upload.ObjectKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al procesar el avatar"})
+			return
+		}
+	}
+
+	upload.Status = "confirmed"
+	if err := database.DB.WithContext(c.Request.Context()).Save(&upload).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al confirmar la subida"})
+		return
+	}
+
+	writeJSON(c, http.StatusOK, gin.H{"message": "Subida confirmada exitosamente", "upload": upload})
+}
+
+// checkAvatarObject verifica el contenido real de un avatar subido directamente:
+// el cliente declara el tipo al pedir la URL, pero puede subir cualquier cosa
+func checkAvatarObject(ctx context.Context, key string) error {
+	reader, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxAvatarSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxAvatarSize {
+		return images.ErrTooLarge
+	}
+	if _, allowed := avatarExtensions[http.DetectContentType(data)]; !allowed {
+		return errors.New("formato de imagen no soportado")
+	}
+	return images.CheckDimensions(data)
+}
+
+// safeFilename reduce el nombre enviado por el cliente a su último componente y
+// rechaza los que no sirven como nombre de objeto ("", ".", "..")
+func safeFilename(name string) (string, bool) {
+	base := path.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	switch base {
+	case "", ".", "..", "/":
+		return "", false
+	}
+	return base, true
+}
+
+// findUploadSession carga la sesión del usuario autenticado (404 si no le pertenece o expiró)
+func findUploadSession(c *gin.Context) (*database.UploadSession, bool) {
+	var session database.UploadSession
+	err := database.DB.WithContext(c.Request.Context()).Where("id = ? AND user_id = ?", c.Param("id"), currentUserID(c)).First(&session).Error
+	if err != nil || (session.Status == "pending" && clock.Now().After(session.ExpiresAt)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sesión de subida no encontrada"})
+		return nil, false
+	}
+	return &session, true
+}
+
+// checkStorageQuota comprueba que el usuario, y en un tenant también el
+// tenant, pueden ocupar size bytes más; si no responde 403
+func checkStorageQuota(c *gin.Context, size int64) bool {
+	status, ok, err := quotas.Check(c.Request.Context(), quotas.ScopeUser, currentUserID(c), quotas.StorageBytes, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al comprobar la cuota de almacenamiento"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cuota de almacenamiento superada", "quota": status})
+		return false
+	}
+
+	tenantID := c.GetUint("tenantID")
+	if tenantID == 0 {
+		return true
+	}
+	status, ok, err = quotas.Check(c.Request.Context(), quotas.ScopeTenant, tenantID, quotas.StorageBytes, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al comprobar la cuota de almacenamiento"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cuota de almacenamiento de la organización superada", "quota": status})
+		return false
+	}
+	return true
+}
+
+func cleanupUploadParts(ctx context.Context, sessionID string, total int) {
+	for n := 1; n <= total; n++ {
+		storage.Default.Delete(ctx, storage.PartKey(sessionID, n))
+	}
+	database.DB.WithContext(ctx).Where("session_id = ?", sessionID).Delete(&database.UploadPart{})
+}
+
+func missingParts(parts []database.UploadPart, total int) []int {
+	received := make(map[int]bool, len(parts))
+	for _, p := range parts {
+		received[p.Number] = true
+	}
+	missing := []int{}
+	for n := 1; n <= total; n++ {
+		if !received[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+func chunkSize() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("UPLOAD_CHUNK_SIZE"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultChunkSize
+}
+
+func maxUploadSize() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_SIZE"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxUploadSize
+}
+
+// countingReader cuenta los bytes leídos
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// partsReader concatena las partes almacenadas abriéndolas de una en una
+type partsReader struct {
+	ctx       context.Context
+	sessionID string
+	total     int
+	next      int
+	current   io.ReadCloser
+}
+
+func (pr *partsReader) Read(p []byte) (int, error) {
+	for {
+		if pr.current == nil {
+			if pr.next >= pr.total {
+				return 0, io.EOF
+			}
+			pr.next++
+			rc, err := storage.Default.Get(pr.ctx, storage.PartKey(pr.sessionID, pr.next))
+			if err != nil {
+				return 0, err
+			}
+			pr.current = rc
+		}
+
+		n, err := pr.current.Read(p)
+		if err == io.EOF {
+			pr.current.Close()
+			pr.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (pr *partsReader) Close() error {
+	if pr.current != nil {
+		return pr.current.Close()
+	}
+	return nil
+}
+
+// Estructuras para las peticiones
+type InitUploadRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type"`
+	TotalSize   int64  `json:"total_size" binding:"required,gt=0"`
+}
+
+type PresignUploadRequest struct {
+	Purpose     string `json:"purpose" binding:"required,oneof=avatar attachment"`
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type" binding:"required"`
+	Size        int64  `json:"size" binding:"required,gt=0"`
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api/clock"
+	"api/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExportMyUsage descarga en CSV todo el historial de uso de la API del usuario
+// @Summary Exportar mi uso de la API
+// @Description Descarga en CSV las peticiones por día y endpoint de todo el historial. Requiere un plan con la función bulk_export
+// @Tags profile
+// @Produce text/csv
+// @Security BearerAuth
+// @Success 200 {string} string "CSV con las columnas day, endpoint, count y last_seen_at"
+// @Failure 403 {object} map[string]interface{}
+// @Router /profile/usage/export [get]
+func ExportMyUsage(c *gin.Context) {
+	query := func(db *gorm.DB) *gorm.DB {
+		return db.Model(&database.UserUsage{}).Where("user_id = ?", currentUserID(c)).Order("day, endpoint")
+	}
+	err := database.Stream(c.Request.Context(), query, func(rows *sql.Rows) error {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s.csv"`, clock.Now().UTC().Format("2006-01-02")))
+		c.Status(http.StatusOK)
+
+		// Se escribe fila a fila para no cargar todo el historial en memoria
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"day", "endpoint", "count", "last_seen_at"})
+		for rows.Next() {
+			var row database.UserUsage
+			if err := database.DB.ScanRows(rows, &row); err != nil {
+				break
+			}
+			w.Write([]string{row.Day, row.Endpoint, strconv.FormatInt(row.Count, 10), row.LastSeenAt.UTC().Format(time.RFC3339)})
+		}
+		w.Flush()
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al exportar el uso"})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"api/normalize"
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckUsername indica si un nombre de usuario está libre
+// @Summary Disponibilidad de nombre de usuario
+// @Description Indica si el nombre se puede elegir con PUT /users/{id}; si no, reason es invalid (formato), reserved o taken. El nombre se normaliza (minúsculas, sin @ inicial)
+// @Tags users
+// @Produce json
+// @Param name path string true "Nombre de usuario"
+// @Success 200 {object} map[string]interface{}
+// @Router /usernames/{name}/available [get]
+func CheckUsername(c *gin.Context) {
+	name := normalize.Username(c.Param("name"))
+	available, reason, err := services.UsernameAvailability(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al comprobar el nombre de usuario"})
+		return
+	}
+	response := gin.H{"username": name, "available": available}
+	if reason != "" {
+		response["reason"] = reason
+	}
+	writeJSON(c, http.StatusOK, response)
+}
+
+// GetPublicProfile devuelve el perfil público de un usuario
+// @Summary Perfil público
+// @Description Nombre de usuario, nombre y fecha de alta de un usuario activo. No requiere autenticación
+// @Tags users
+// @Produce json
+// @Param username path string true "Nombre de usuario"
+// @Success 200 {object} services.PublicProfile
+// @Failure 404 {object} map[string]interface{}
+// @Router /u/{username} [get]
+func GetPublicProfile(c *gin.Context) {
+	profile, err := services.GetPublicProfile(c.Request.Context(), normalize.Username(c.Param("username")))
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener el perfil"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=60")
+	writeJSON(c, http.StatusOK, profile)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMyVerification envía una solicitud de verificación de la cuenta
+// @Summary Solicitar la verificación de mi cuenta
+// @Description Envía a los administradores las pruebas (texto y enlaces) para verificar la cuenta. Solo se admite una solicitud pendiente a la vez y ninguna si la cuenta ya está verificada. Al aprobarla el perfil público muestra verified=true
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body VerificationRequestBody true "Pruebas"
+// @Success 201 {object} database.VerificationRequest
+// @Failure 400 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/verification [post]
+func RequestMyVerification(c *gin.Context) {
+	var req VerificationRequestBody
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	request, err := services.RequestVerification(c.Request.Context(), currentUserID(c), req.Evidence, req.Links)
+	switch {
+	case errors.Is(err, services.ErrVerificationPending):
+		c.JSON(http.StatusConflict, gin.H{"error": "Ya tienes una solicitud de verificación pendiente"})
+		return
+	case errors.Is(err, services.ErrAlreadyVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tu cuenta ya está verificada"})
+		return
+	}
+	if verificationError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusCreated, request)
+}
+
+// GetMyVerification devuelve la última solicitud de verificación del usuario
+// @Summary Consultar mi solicitud de verificación
+// @Description Estado de la última solicitud (pending, approved, rejected, cancelled o revoked) y la nota del administrador que la revisó
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} database.VerificationRequest
+// @Failure 404 {object} map[string]interface{}
+// @Router /profile/verification [get]
+func GetMyVerification(c *gin.Context) {
+	request, err := services.MyVerification(c.Request.Context(), currentUserID(c))
+	if verificationError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, request)
+}
+
+// CancelMyVerification retira la solicitud de verificación pendiente
+// @Summary Retirar mi solicitud de verificación
+// @Description Retira la última solicitud si sigue pendiente; si ya se revisó responde 409
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} database.VerificationRequest
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /profile/verification [delete]
+func CancelMyVerification(c *gin.Context) {
+	request, err := services.CancelVerification(c.Request.Context(), currentUserID(c))
+	if verificationError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, request)
+}
+
+// GetVerificationRequests lista las solicitudes de verificación
+// @Summary Solicitudes de verificación
+// @Description Solicitudes en el estado indicado (por defecto pending), las más antiguas primero
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "pending, approved, rejected, cancelled, revoked o all"
+// @Param page query int false "Página (por defecto 1)"
+// @Param per_page query int false "Solicitudes por página"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /admin/verifications [get]
+func GetVerificationRequests(c *gin.Context) {
+	var req VerificationsQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+	status := req.Status
+	switch status {
+	case "":
+		status = services.VerificationPending
+	case "all":
+		status = ""
+	}
+
+	page := pagination(c)
+	requests, total, err := services.VerificationRequests(countContext(c), status, page.Offset(), page.PerPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener las solicitudes"})
+		return
+	}
+
+	response := paginated(requests, page, total)
+	response["links"] = pageLinks(c, page, total.Count)
+	writeJSON(c, http.StatusOK, response)
+}
+
+// ApproveVerification aprueba una solicitud de verificación
+// @Summary Aprobar verificación
+// @Description Aprueba la solicitud pendiente y verifica la cuenta, lo que queda en su historial de cambios. La nota es opcional y la ve el usuario
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID de la solicitud"
+// @Param decision body VerificationNoteRequest false "Nota"
+// @Success 200 {object} database.VerificationRequest
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/verifications/{id}/approve [post]
+func ApproveVerification(c *gin.Context) {
+	reviewVerification(c, services.VerificationApproved, false)
+}
+
+// RejectVerification rechaza una solicitud de verificación
+// @Summary Rechazar verificación
+// @Description Rechaza la solicitud pendiente; la nota, obligatoria, la ve el usuario, que puede enviar otra
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID de la solicitud"
+// @Param decision body VerificationNoteRequest true "Motivo del rechazo"
+// @Success 200 {object} database.VerificationRequest
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/verifications/{id}/reject [post]
+func RejectVerification(c *gin.Context) {
+	reviewVerification(c, services.VerificationRejected, true)
+}
+
+// RevokeVerification revoca una verificación aprobada
+// @Summary Revocar verificación
+// @Description Revoca la solicitud aprobada y quita la verificación a la cuenta, lo que queda en su historial de cambios. La nota es obligatoria
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "ID de la solicitud"
+// @Param decision body VerificationNoteRequest true "Motivo de la revocación"
+// @Success 200 {object} database.VerificationRequest
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /admin/verifications/{id}/revoke [post]
+func RevokeVerification(c *gin.Context) {
+	reviewVerification(c, services.VerificationRevoked, true)
+}
+
+// reviewVerification aplica la decisión de un administrador sobre la
+// solicitud de la ruta; con noteRequired la nota es obligatoria
+func reviewVerification(c *gin.Context, status string, noteRequired bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Solicitud de verificación no encontrada"})
+		return
+	}
+	var req VerificationNoteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+			return
+		}
+	}
+	if noteRequired && req.Notes == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indica el motivo en notes"})
+		return
+	}
+
+	request, err := services.ReviewVerification(c.Request.Context(), currentIdentity(c), id, status, req.Notes)
+	if errors.Is(err, services.ErrSelfVerification) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No puedes revisar tu propia solicitud de verificación"})
+		return
+	}
+	if verificationError(c, err) {
+		return
+	}
+	writeJSON(c, http.StatusOK, request)
+}
+
+// verificationError responde a los errores comunes de las rutas de
+// verificación; devuelve false si no hubo error
+func verificationError(c *gin.Context, err error) bool {
+	var transition *services.VerificationTransitionError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, services.ErrVerificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Solicitud de verificación no encontrada"})
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrInactiveUser):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Usuario no encontrado"})
+	case errors.As(err, &transition):
+		c.JSON(http.StatusConflict, gin.H{"error": "La solicitud ya no admite este cambio", "status": transition.From})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al gestionar la verificación"})
+	}
+	return true
+}
+
+// VerificationRequestBody pruebas para verificar la cuenta
+type VerificationRequestBody struct {
+	Evidence string   `json:"evidence" binding:"required,max=4000" example:"Soy la autora del blog enlazado; la bio lo menciona"`
+	Links    []string `json:"links" binding:"max=5,dive,url,max=500" example:"https://example.com/sobre-mi"`
+}
+
+// VerificationNoteRequest nota de un administrador sobre una solicitud
+type VerificationNoteRequest struct {
+	Notes string `json:"notes" binding:"max=2000"`
+}
+
+// VerificationsQuery filtro del listado de solicitudes
+type VerificationsQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending approved rejected cancelled revoked all"`
+}
+
+func (r *VerificationRequestBody) Normalize() {
+	r.Evidence = strings.TrimSpace(r.Evidence)
+	for i := range r.Links {
+		r.Links[i] = strings.TrimSpace(r.Links[i])
+	}
+}
+func (r *VerificationNoteRequest) Normalize() { r.Notes = strings.TrimSpace(r.Notes) }
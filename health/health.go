@@ -0,0 +1,124 @@
+// Package health comprueba las dependencias de la API (base de datos, Redis,
+// correo, servicios externos) para el modo detallado de /health. Cada
+// paquete registra con Register la comprobación de lo que configura.
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"api/clock"
+)
+
+// ErrDisabled lo devuelve la comprobación de una dependencia que no está
+// configurada; no cuenta como fallo
+var ErrDisabled = errors.New("no configurado")
+
+// Timeout tiempo máximo de cada comprobación
+const Timeout = 3 * time.Second
+
+// Check comprueba que una dependencia responde
+type Check func(ctx context.Context) error
+
+// Result estado de una dependencia
+type Result struct {
+	// ok, error o disabled
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// Último fallo, aunque la dependencia ya se haya recuperado
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type lastError struct {
+	message string
+	at      time.Time
+}
+
+var (
+	mu     sync.RWMutex
+	checks = map[string]Check{}
+	last   = map[string]lastError{}
+)
+
+// Register añade la comprobación de una dependencia
+func Register(name string, check Check) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// Names devuelve las dependencias registradas, ordenadas
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run ejecuta a la vez todas las comprobaciones, cada una con Timeout, y
+// devuelve su resultado y si ninguna ha fallado
+func Run(ctx context.Context) (map[string]Result, bool) {
+	mu.RLock()
+	pending := make(map[string]Check, len(checks))
+	for name, check := range checks {
+		pending[name] = check
+	}
+	mu.RUnlock()
+
+	results := make(map[string]Result, len(pending))
+	var wg sync.WaitGroup
+	var resultsMu sync.Mutex
+	for name, check := range pending {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := run(ctx, name, check)
+			resultsMu.Lock()
+			results[name] = result
+			resultsMu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	healthy := true
+	for _, result := range results {
+		if result.Status == "error" {
+			healthy = false
+		}
+	}
+	return results, healthy
+}
+
+func run(ctx context.Context, name string, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := Result{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+
+	mu.Lock()
+	defer mu.Unlock()
+	switch {
+	case errors.Is(err, ErrDisabled):
+		result.Status = "disabled"
+	case err != nil:
+		result.Status = "error"
+		result.Error = err.Error()
+		last[name] = lastError{message: err.Error(), at: clock.Now()}
+	}
+	if prev, ok := last[name]; ok {
+		at := prev.at
+		result.LastError, result.LastErrorAt = prev.message, &at
+	}
+	return result
+}
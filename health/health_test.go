@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	fail := true
+	Register("ok", func(ctx context.Context) error { return nil })
+	Register("off", func(ctx context.Context) error { return ErrDisabled })
+	Register("flaky", func(ctx context.Context) error {
+		if fail {
+			return errors.New("conexión rechazada")
+		}
+		return nil
+	})
+	Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	t.Cleanup(func() {
+		mu.Lock()
+		checks, last = map[string]Check{}, map[string]lastError{}
+		mu.Unlock()
+	})
+
+	start := time.Now()
+	results, healthy := Run(context.Background())
+	if healthy {
+		t.Error("Run() healthy con comprobaciones fallidas")
+	}
+	if elapsed := time.Since(start); elapsed > Timeout+time.Second {
+		t.Errorf("las comprobaciones no se ejecutan a la vez: %v", elapsed)
+	}
+	if results["ok"].Status != "ok" || results["off"].Status != "disabled" || results["slow"].Status != "error" {
+		t.Errorf("resultados = %+v", results)
+	}
+	if r := results["flaky"]; r.Status != "error" || r.Error != "conexión rechazada" || r.LastErrorAt == nil {
+		t.Errorf("flaky = %+v", r)
+	}
+
+	// Recuperada, conserva el último error
+	fail = false
+	mu.Lock()
+	delete(checks, "slow")
+	mu.Unlock()
+	results, _ = Run(context.Background())
+	if r := results["flaky"]; r.Status != "ok" || r.Error != "" || r.LastError != "conexión rechazada" {
+		t.Errorf("flaky tras recuperarse = %+v", r)
+	}
+}
@@ -0,0 +1,100 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GitHub canjea el código del flujo OAuth de GitHub (aplicación
+// GITHUB_CLIENT_ID/GITHUB_CLIENT_SECRET) y consulta la cuenta. La credencial
+// es el code que GitHub devuelve al frontend.
+type GitHub struct{}
+
+func (GitHub) Enabled() bool {
+	return os.Getenv("GITHUB_CLIENT_ID") != "" && os.Getenv("GITHUB_CLIENT_SECRET") != ""
+}
+
+// githubURL permite apuntar a GitHub Enterprise o a un servidor de pruebas
+func githubURL(key, fallback string) string {
+	if u := os.Getenv(key); u != "" {
+		return u
+	}
+	return fallback
+}
+
+func (GitHub) Verify(ctx context.Context, credential string) (Profile, error) {
+	if credential == "" {
+		return Profile{}, ErrInvalidCredential
+	}
+	form := url.Values{
+		"client_id":     {os.Getenv("GITHUB_CLIENT_ID")},
+		"client_secret": {os.Getenv("GITHUB_CLIENT_SECRET")},
+		"code":          {credential},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		githubURL("GITHUB_TOKEN_URL", "https://github.com/login/oauth/access_token"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return Profile{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := getJSON(req, &token); err != nil {
+		return Profile{}, err
+	}
+	if token.AccessToken == "" {
+		return Profile{}, ErrInvalidCredential
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, githubURL("GITHUB_API_URL", "https://api.github.com")+"/user", nil)
+	if err != nil {
+		return Profile{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := getJSON(req, &user); err != nil {
+		return Profile{}, err
+	}
+	if user.ID == 0 {
+		return Profile{}, ErrInvalidCredential
+	}
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+	// El id numérico no cambia aunque el usuario cambie de login
+	return Profile{Subject: strconv.FormatInt(user.ID, 10), Email: user.Email, Name: name}, nil
+}
+
+func getJSON(req *http.Request, dest interface{}) error {
+	resp, err := githubClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrInvalidCredential
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub: estado %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+		return fmt.Errorf("GitHub: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"api/clock"
+)
+
+const (
+	defaultGoogleJWKSURL = "https://www.googleapis.com/oauth2/v3/certs"
+	jwksTTL              = time.Hour
+)
+
+// Google verifica los ID tokens de Google Identity Services emitidos para
+// GOOGLE_CLIENT_ID. La credencial es el ID token que recibe el frontend.
+type Google struct{}
+
+func (Google) Enabled() bool {
+	return os.Getenv("GOOGLE_CLIENT_ID") != ""
+}
+
+func (Google) Verify(ctx context.Context, credential string) (Profile, error) {
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	var claims struct {
+		Issuer        string   `json:"iss"`
+		Audience      audience `json:"aud"`
+		Subject       string   `json:"sub"`
+		ExpiresAt     int64    `json:"exp"`
+		Email         string   `json:"email"`
+		EmailVerified bool     `json:"email_verified"`
+		Name          string   `json:"name"`
+	}
+	signed, signature, err := splitJWT(credential, &header, &claims)
+	if err != nil {
+		return Profile{}, err
+	}
+	if header.Alg != "RS256" {
+		return Profile{}, ErrInvalidCredential
+	}
+	key, err := googleKey(ctx, header.Kid)
+	if err != nil {
+		return Profile{}, err
+	}
+	sum := sha256.Sum256([]byte(signed))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature) != nil {
+		return Profile{}, ErrInvalidCredential
+	}
+
+	if claims.Issuer != "accounts.google.com" && claims.Issuer != "https://accounts.google.com" {
+		return Profile{}, ErrInvalidCredential
+	}
+	if !claims.Audience.contains(os.Getenv("GOOGLE_CLIENT_ID")) || clock.Now().Unix() >= claims.ExpiresAt || claims.Subject == "" {
+		return Profile{}, ErrInvalidCredential
+	}
+	profile := Profile{Subject: claims.Subject, Name: claims.Name}
+	if claims.EmailVerified {
+		profile.Email = claims.Email
+	}
+	return profile, nil
+}
+
+var (
+	jwksMu       sync.Mutex
+	jwksKeys     map[string]*rsa.PublicKey
+	jwksLoadedAt time.Time
+	jwksURL      string
+)
+
+// googleKey devuelve la clave pública de Google con ese kid. Las claves se
+// descargan de GOOGLE_JWKS_URL y se renuevan cada hora o al ver un kid nuevo.
+func googleKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	url := os.Getenv("GOOGLE_JWKS_URL")
+	if url == "" {
+		url = defaultGoogleJWKSURL
+	}
+
+	jwksMu.Lock()
+	defer jwksMu.Unlock()
+	if key, ok := jwksKeys[kid]; ok && url == jwksURL && time.Since(jwksLoadedAt) < jwksTTL {
+		return key, nil
+	}
+	keys, err := fetchJWKS(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	jwksKeys, jwksLoadedAt, jwksURL = keys, time.Now(), url
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrInvalidCredential
+}
+
+func fetchJWKS(ctx context.Context, url string) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := googleClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("claves de Google: estado %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("claves de Google: %w", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
@@ -0,0 +1,47 @@
+package identity
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"os"
+
+	"api/clock"
+)
+
+// SAML acepta las identidades que valida el proveedor de servicio SAML
+// desplegado delante de la API (Shibboleth, SimpleSAMLphp...): tras verificar
+// la aserción del IdP, firma con SAML_BRIDGE_SECRET (HS256) un token corto con
+// el emisor (iss, entityID del IdP) y el NameID (sub). La API no procesa XML.
+type SAML struct{}
+
+func (SAML) Enabled() bool {
+	return os.Getenv("SAML_BRIDGE_SECRET") != ""
+}
+
+func (SAML) Verify(ctx context.Context, credential string) (Profile, error) {
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	var claims struct {
+		Issuer    string `json:"iss"`
+		Subject   string `json:"sub"`
+		ExpiresAt int64  `json:"exp"`
+		Email     string `json:"email"`
+		Name      string `json:"name"`
+	}
+	signed, signature, err := splitJWT(credential, &header, &claims)
+	if err != nil {
+		return Profile{}, err
+	}
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SAML_BRIDGE_SECRET")))
+	mac.Write([]byte(signed))
+	if header.Alg != "HS256" || !hmac.Equal(mac.Sum(nil), signature) {
+		return Profile{}, ErrInvalidCredential
+	}
+	if claims.Issuer == "" || claims.Subject == "" || clock.Now().Unix() >= claims.ExpiresAt {
+		return Profile{}, ErrInvalidCredential
+	}
+	// El mismo NameID puede repetirse en IdPs distintos
+	return Profile{Subject: claims.Issuer + "|" + claims.Subject, Email: claims.Email, Name: claims.Name}, nil
+}
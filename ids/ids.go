@@ -0,0 +1,65 @@
+// Package ids genera los identificadores de los recursos que no usan la clave
+// autoincremental de la base de datos (subidas, exportaciones, tokens). Las
+// pruebas pueden sustituir el generador por uno secuencial y predecible.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Generator genera identificadores únicos
+type Generator interface {
+	New() string
+}
+
+// Random identificadores hexadecimales aleatorios de Bytes bytes
+type Random struct {
+	Bytes int
+}
+
+func (r Random) New() string {
+	b := make([]byte, r.Bytes)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Sequence identificadores consecutivos con prefijo (prefix-1, prefix-2...)
+type Sequence struct {
+	Prefix string
+	n      atomic.Int64
+}
+
+func (s *Sequence) New() string {
+	return fmt.Sprintf("%s-%d", s.Prefix, s.n.Add(1))
+}
+
+var (
+	mu      sync.RWMutex
+	current Generator = Random{Bytes: 16}
+)
+
+// Set sustituye el generador y devuelve una función que restaura el anterior
+func Set(g Generator) (restore func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	previous := current
+	current = g
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		current = previous
+	}
+}
+
+// New devuelve un identificador nuevo del generador configurado
+func New() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.New()
+}
@@ -0,0 +1,146 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	// Decodificadores soportados para los originales
+	_ "image/gif"
+
+	"api/database"
+	"api/storage"
+)
+
+// AvatarJob nombre del trabajo que genera las variantes de avatar
+const AvatarJob = "avatar.process"
+
+// ErrTooLarge la imagen supera el número máximo de píxeles
+var ErrTooLarge = errors.New("la imagen supera las dimensiones máximas permitidas")
+
+// maxSourceBytes límite de lectura del original (las subidas ya están limitadas antes)
+const maxSourceBytes = 32 << 20
+
+// MaxPixels número máximo de píxeles (ancho × alto) que se aceptan al decodificar
+// (AVATAR_MAX_PIXELS, por defecto 4096×4096)
+func MaxPixels() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("AVATAR_MAX_PIXELS"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return 4096 * 4096
+}
+
+// CheckDimensions lee solo la cabecera de la imagen y la rechaza si sus
+// dimensiones superan MaxPixels. Un PNG de pocos MB puede ocupar varios GB
+// una vez decodificado, así que hay que comprobarlo antes de image.Decode.
+func CheckDimensions(data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels() {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// AvatarPayload datos del trabajo de procesamiento de avatar
+type AvatarPayload struct {
+	UserID uint   `json:"user_id"`
+	Key    string `json:"key"`
+}
+
+// ProcessAvatar genera las variantes del avatar original. Volver a codificar
+// la imagen descarta los metadatos EXIF (ubicación, cámara, etc.).
+func ProcessAvatar(ctx context.Context, payload []byte) error {
+	var p AvatarPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, p.UserID).Error; err != nil {
+		return err
+	}
+	// El usuario subió otro avatar mientras tanto; este trabajo ya no aplica
+	if user.AvatarKey != p.Key {
+		return nil
+	}
+
+	reader, err := storage.Default.Get(ctx, p.Key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxSourceBytes))
+	if err != nil {
+		return err
+	}
+	if err := CheckDimensions(data); err != nil {
+		database.DB.WithContext(ctx).Model(&user).Update("avatar_status", "failed")
+		return fmt.Errorf("avatar %s: %w", p.Key, err)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		database.DB.WithContext(ctx).Model(&user).Update("avatar_status", "failed")
+		return fmt.Errorf("decodificando avatar %s: %w", p.Key, err)
+	}
+
+	// Conservar transparencia con PNG; el resto se guarda como JPEG
+	ext, contentType := ".jpg", "image/jpeg"
+	if HasAlpha(src) {
+		ext, contentType = ".png", "image/png"
+	}
+
+	base := strings.TrimSuffix(path.Base(p.Key), path.Ext(p.Key))
+	dir := path.Dir(path.Dir(p.Key))
+	crop := CropSquare(src)
+	keys := map[string]string{}
+
+	for _, v := range AvatarVariants {
+		var buf bytes.Buffer
+		resized := Resize(src, crop, v.Size)
+		if contentType == "image/png" {
+			err = png.Encode(&buf, resized)
+		} else {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		}
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("%s/%s_%s%s", dir, base, v.Name, ext)
+		if err := storage.Default.Put(ctx, key, &buf, int64(buf.Len()), contentType); err != nil {
+			return err
+		}
+		keys[v.Name] = key
+	}
+
+	previous := []string{user.AvatarThumbKey, user.AvatarMediumKey}
+	if err := database.DB.WithContext(ctx).Model(&user).Updates(map[string]interface{}{
+		"avatar_thumb_key":  keys["thumb"],
+		"avatar_medium_key": keys["medium"],
+		"avatar_status":     "ready",
+	}).Error; err != nil {
+		return err
+	}
+
+	for _, key := range previous {
+		if key != "" {
+			storage.Default.Delete(ctx, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package images
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// GravatarURL devuelve la URL de Gravatar del email con el tamaño indicado.
+// Si la dirección no tiene Gravatar se muestra la imagen generada que indique
+// AVATAR_FALLBACK (identicon por defecto; también mp, retro, robohash...).
+// Con AVATAR_FALLBACK=none devuelve "": el email no sale del servidor ni
+// siquiera como hash.
+func GravatarURL(email string, size int) string {
+	fallback := os.Getenv("AVATAR_FALLBACK")
+	if fallback == "none" {
+		return ""
+	}
+	if fallback == "" {
+		fallback = "identicon"
+	}
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return fmt.Sprintf("https://www.gravatar.com/avatar/%s?s=%d&d=%s", hex.EncodeToString(hash[:]), size, url.QueryEscape(fallback))
+}
@@ -0,0 +1,87 @@
+package images
+
+import (
+	"image"
+	"image/color"
+)
+
+// Variant tamaño derivado que se genera para cada imagen
+type Variant struct {
+	Name string
+	Size int
+}
+
+// AvatarVariants variantes generadas para los avatares (recorte cuadrado)
+var AvatarVariants = []Variant{
+	{Name: "thumb", Size: 128},
+	{Name: "medium", Size: 512},
+}
+
+// CropSquare recorta la región cuadrada central de la imagen
+func CropSquare(src image.Image) image.Rectangle {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	return image.Rect(x0, y0, x0+side, y0+side)
+}
+
+// Resize escala la región rect de src a size x size promediando el área de
+// origen que cubre cada píxel de destino. Nunca amplía la imagen.
+func Resize(src image.Image, rect image.Rectangle, size int) *image.NRGBA {
+	if rect.Dx() < size {
+		size = rect.Dx()
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	scale := float64(rect.Dx()) / float64(size)
+
+	for y := 0; y < size; y++ {
+		sy0 := rect.Min.Y + int(float64(y)*scale)
+		sy1 := rect.Min.Y + int(float64(y+1)*scale)
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < size; x++ {
+			sx0 := rect.Min.X + int(float64(x)*scale)
+			sx1 := rect.Min.X + int(float64(x+1)*scale)
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// HasAlpha indica si la imagen tiene algún píxel no opaco
+func HasAlpha(img image.Image) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
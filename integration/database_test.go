@@ -0,0 +1,226 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"api/auth"
+	"api/database"
+	"api/quotas"
+	"api/services"
+
+	"gorm.io/gorm"
+)
+
+var sequence atomic.Int64
+
+func uniqueEmail() string {
+	return fmt.Sprintf("integration%d@example.com", sequence.Add(1))
+}
+
+func TestMigrations(t *testing.T) {
+	// Volver a migrar sobre el esquema existente no debe fallar ni cambiar nada
+	if err := database.DB.AutoMigrate(database.Models()...); err != nil {
+		t.Fatalf("segunda migración: %v", err)
+	}
+
+	migrator := database.DB.Migrator()
+	for _, model := range database.Models() {
+		if !migrator.HasTable(model) {
+			t.Errorf("falta la tabla de %T", model)
+		}
+	}
+	indexes := []struct {
+		model interface{}
+		name  string
+	}{
+		{&database.User{}, "idx_users_email"},
+		{&database.User{}, "idx_users_name_prefix"},
+		{&database.User{}, "idx_users_email_prefix"},
+		{&database.APIKey{}, "idx_api_keys_key_hash"},
+		{&database.Plan{}, "idx_plans_code"},
+	}
+	for _, idx := range indexes {
+		if !migrator.HasIndex(idx.model, idx.name) {
+			t.Errorf("falta el índice %s", idx.name)
+		}
+	}
+}
+
+func TestUniqueConstraints(t *testing.T) {
+	ctx := context.Background()
+
+	email := uniqueEmail()
+	user := database.User{Email: email, Password: "x", Name: "A"}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&database.User{Email: email, Password: "x", Name: "B"}).Error; err == nil {
+		t.Error("se aceptó un email duplicado")
+	}
+
+	hash := auth.HashAPIKey(auth.RandomToken(24))
+	key := database.APIKey{UserID: user.ID, Name: "a", Prefix: "gk_a", KeyHash: hash}
+	if err := database.DB.Create(&key).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&database.APIKey{UserID: user.ID, Name: "b", Prefix: "gk_b", KeyHash: hash}).Error; err == nil {
+		t.Error("se aceptó un hash de clave de API duplicado")
+	}
+
+	// Registros simultáneos con el mismo email: la comprobación previa no basta,
+	// la restricción única garantiza que solo se crea uno
+	email = uniqueEmail()
+	var wg sync.WaitGroup
+	var created atomic.Int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := services.RegisterUser(ctx, email, "secret123", "Concurrente"); err == nil {
+				created.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	var count int64
+	database.DB.Model(&database.User{}).Where("email = ?", email).Count(&count)
+	if count != 1 || created.Load() != 1 {
+		t.Errorf("usuarios creados = %d (correctos %d), se esperaba 1", count, created.Load())
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	email := uniqueEmail()
+	errAbort := errors.New("abortar")
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&database.User{Email: email, Password: "x", Name: "T"}).Error; err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("err = %v", err)
+	}
+	var count int64
+	database.DB.Model(&database.User{}).Where("email = ?", email).Count(&count)
+	if count != 0 {
+		t.Error("la transacción abortada dejó el usuario creado")
+	}
+}
+
+func TestConcurrentQuotaConsume(t *testing.T) {
+	ctx := context.Background()
+	user, err := services.RegisterUser(ctx, uniqueEmail(), "secret123", "Cuota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const limit = 10
+	if err := quotas.Set(ctx, quotas.ScopeUser, user.ID, quotas.RequestsPerDay, limit); err != nil {
+		t.Fatal(err)
+	}
+
+	// Las peticiones simultáneas no pueden superar el límite ni dejar el contador
+	// por encima: el upsert bloquea la fila hasta que termina cada transacción
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for i := 0; i < 3*limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := quotas.Consume(ctx, quotas.ScopeUser, user.ID, quotas.RequestsPerDay, 1)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != limit {
+		t.Errorf("permitidas = %d, se esperaban %d", allowed.Load(), limit)
+	}
+	status, err := quotas.Get(ctx, quotas.ScopeUser, user.ID, quotas.RequestsPerDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Used != limit {
+		t.Errorf("contador = %d, se esperaba %d", status.Used, limit)
+	}
+}
+
+func TestFuzzyUserSearch(t *testing.T) {
+	ctx := context.Background()
+	if !database.HasTrigram() {
+		t.Fatal("pg_trgm no se activó al migrar")
+	}
+	for _, name := range []string{"John Trigrama", "Johanna Trigrama", "Pedro Trigrama"} {
+		if _, err := services.RegisterUser(ctx, uniqueEmail(), "secret123", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches, err := services.SearchUsers(ctx, "jhon", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 || matches[0].Name != "John Trigrama" {
+		t.Errorf("jhon = %+v, se esperaba John Trigrama primero", matches)
+	}
+
+	// Las coincidencias por prefijo van antes que las aproximadas
+	matches, err = services.SearchUsers(ctx, "joha", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) == 0 || matches[0].Name != "Johanna Trigrama" {
+		t.Errorf("joha = %+v, se esperaba Johanna Trigrama primero", matches)
+	}
+}
+
+func TestPartitions(t *testing.T) {
+	ctx := context.Background()
+	old := time.Now().UTC().AddDate(-2, 0, 0)
+	partition := "user_changes_p" + old.Format("2006_01")
+	if err := database.EnsurePartitions(database.DB, old); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []database.UserChange{
+		{UserID: 1, ActorID: 1, Action: "update", CreatedAt: old},
+		{UserID: 1, ActorID: 1, Action: "update", CreatedAt: time.Now()},
+	}
+	if err := database.DB.Create(&changes).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Cada fila va a la partición de su mes, no a la de por defecto
+	var n int64
+	database.DB.Table(partition).Count(&n)
+	if n != 1 {
+		t.Fatalf("filas en %s = %d, se esperaba 1", partition, n)
+	}
+
+	dropped, err := database.DropPartitions(ctx, "user_changes", time.Now().AddDate(-1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 1 {
+		t.Errorf("filas eliminadas = %d, se esperaba 1", dropped)
+	}
+	if database.DB.Migrator().HasTable(partition) {
+		t.Errorf("la partición %s sigue existiendo", partition)
+	}
+	database.DB.Model(&database.UserChange{}).Where("id = ?", changes[1].ID).Count(&n)
+	if n != 1 {
+		t.Error("se eliminó el cambio del mes actual")
+	}
+}
@@ -0,0 +1,47 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"api/realtime"
+)
+
+func TestRealtimeThroughRedis(t *testing.T) {
+	t.Setenv("REDIS_URL", redisURL)
+	t.Setenv("REALTIME_CHANNEL", "integration:realtime")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := realtime.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := realtime.Subscribe(ctx, 42)
+	defer sub.Close()
+	other := realtime.Subscribe(ctx, 7)
+	defer other.Close()
+
+	// La suscripción a Redis se establece en segundo plano: se publica hasta que llega
+	deadline := time.After(10 * time.Second)
+	for {
+		realtime.Publish(ctx, 42, realtime.EventProfileUpdated, map[string]string{"name": "Ana"})
+		select {
+		case event := <-sub.C:
+			if event.Type != realtime.EventProfileUpdated {
+				t.Fatalf("evento = %s", event.Type)
+			}
+			select {
+			case event := <-other.C:
+				t.Fatalf("el evento de otro usuario llegó a la conexión equivocada: %+v", event)
+			default:
+			}
+			return
+		case <-time.After(200 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("el evento no llegó a través de Redis")
+		}
+	}
+}
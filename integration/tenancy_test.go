@@ -0,0 +1,148 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"api/database"
+	"api/quotas"
+	"api/services"
+	"api/tenancy"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	ctx := context.Background()
+	if _, err := services.ProvisionTenant(ctx, "integracion", "Integración", nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.ProvisionTenant(ctx, "integracion", "Integración", nil, 0); !errors.Is(err, services.ErrTenantExists) {
+		t.Errorf("segunda alta: err = %v, se esperaba ErrTenantExists", err)
+	}
+	tenantCtx := tenancy.With(ctx, "integracion")
+
+	// El mismo email puede existir en el tenant y en public
+	email := uniqueEmail()
+	if _, err := services.RegisterUser(tenantCtx, email, "secret123", "Tenant"); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	database.DB.WithContext(ctx).Model(&database.User{}).Where("email = ?", email).Count(&count)
+	if count != 0 {
+		t.Error("el usuario del tenant aparece en el esquema public")
+	}
+	if _, err := services.RegisterUser(ctx, email, "secret123", "Public"); err != nil {
+		t.Fatalf("registro en public: %v", err)
+	}
+
+	// Los planes se crean en el esquema del tenant al darlo de alta
+	var plans int64
+	database.DB.WithContext(tenantCtx).Model(&database.Plan{}).Count(&plans)
+	if plans == 0 {
+		t.Error("el tenant no tiene los planes predefinidos")
+	}
+
+	// Un token del tenant no vale en public
+	result, err := services.Authenticate(tenantCtx, email, "secret123", services.LoginMeta{IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.AuthenticateToken(tenantCtx, result.Token, "127.0.0.1"); err != nil {
+		t.Errorf("token en su tenant: %v", err)
+	}
+	if _, err := services.AuthenticateToken(ctx, result.Token, "127.0.0.1"); !errors.Is(err, services.ErrWrongTenant) {
+		t.Errorf("token en public: err = %v, se esperaba ErrWrongTenant", err)
+	}
+
+	// Un administrador de la plataforma sí puede actuar en el tenant con su token de public
+	platformEmail := uniqueEmail()
+	platformAdmin, err := services.RegisterUser(ctx, platformEmail, "secret123", "Plataforma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.WithContext(ctx).Model(platformAdmin).Update("role", services.RolePlatformAdmin)
+	result, err = services.Authenticate(ctx, platformEmail, "secret123", services.LoginMeta{IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := services.AuthenticateToken(tenantCtx, result.Token, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.ActingTenant != "integracion" || identity.Role != "admin" || identity.UserID != platformAdmin.ID {
+		t.Errorf("identidad en el tenant = %+v", identity)
+	}
+
+	// Los trabajos periódicos recorren public y el tenant
+	var schemas []string
+	err = database.ForEachTenant(ctx, func(ctx context.Context) error {
+		schemas = append(schemas, tenancy.From(ctx))
+		return nil
+	})
+	if err != nil || len(schemas) != 2 || schemas[0] != "" || schemas[1] != "integracion" {
+		t.Errorf("ForEachTenant = %v, %v", schemas, err)
+	}
+}
+
+func TestTenantLifecycle(t *testing.T) {
+	ctx := context.Background()
+	tenant, err := services.ProvisionTenant(ctx, "ciclo", "Ciclo de vida", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// La cuota users_per_org del tenant se guarda en public y cuenta los usuarios de su esquema
+	tenantCtx := tenancy.With(ctx, "ciclo")
+	if err := quotas.Set(ctx, quotas.ScopeTenant, tenant.ID, quotas.UsersPerOrg, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.RegisterUser(tenantCtx, uniqueEmail(), "secret123", "Primero"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.RegisterUser(tenantCtx, uniqueEmail(), "secret123", "Segundo"); !errors.Is(err, services.ErrUserLimitReached) {
+		t.Errorf("alta por encima de users_per_org: err = %v, se esperaba ErrUserLimitReached", err)
+	}
+
+	// Solo se da de baja un tenant suspendido
+	if err := services.DeleteTenant(ctx, "ciclo", 0); !errors.Is(err, services.ErrTenantState) {
+		t.Errorf("baja de un tenant activo: err = %v, se esperaba ErrTenantState", err)
+	}
+	if _, err := services.SuspendTenant(ctx, "ciclo", services.SuspendBilling, 0); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, err := services.LookupTenant(ctx, "ciclo"); !errors.Is(err, services.ErrTenantSuspended) || tenant.SuspendReason != services.SuspendBilling {
+		t.Errorf("LookupTenant de un tenant suspendido = %+v, %v", tenant, err)
+	}
+	if _, err := services.ResumeTenant(ctx, "ciclo", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.LookupTenant(ctx, "ciclo"); err != nil {
+		t.Errorf("LookupTenant tras reactivarlo: %v", err)
+	}
+
+	if _, err := services.SuspendTenant(ctx, "ciclo", services.SuspendAdmin, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.DeleteTenant(ctx, "ciclo", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.GetTenant(ctx, "ciclo"); !errors.Is(err, services.ErrTenantNotFound) {
+		t.Errorf("tenant dado de baja: err = %v", err)
+	}
+	var schemas int64
+	database.DB.WithContext(ctx).Raw("SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = ?", tenancy.Schema("ciclo")).Scan(&schemas)
+	if schemas != 0 {
+		t.Error("el esquema del tenant dado de baja sigue existiendo")
+	}
+
+	// Los eventos del ciclo de vida se conservan tras la baja
+	var kinds []string
+	database.DB.WithContext(ctx).Model(&database.TenantEvent{}).Where("tenant = ?", "ciclo").Order("id").Pluck("type", &kinds)
+	want := []string{"tenant.provisioned", "tenant.suspended", "tenant.resumed", "tenant.suspended", "tenant.deleted"}
+	if len(kinds) < len(want) || strings.Join(kinds[len(kinds)-len(want):], ",") != strings.Join(want, ",") {
+		t.Errorf("eventos = %v, se esperaba que terminaran en %v", kinds, want)
+	}
+}
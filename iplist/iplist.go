@@ -0,0 +1,53 @@
+// Package iplist comprueba direcciones IP contra listas de IPs y rangos CIDR
+// (MAINTENANCE_ALLOW_IPS, IP_BAN_ALLOWLIST, ADMIN_ALLOW_IPS, claves de API...)
+package iplist
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Parse separa una lista por comas, sin espacios ni entradas vacías
+func Parse(s string) []string {
+	var list []string
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// Contains indica si la IP es una de las de la lista o pertenece a alguno de sus rangos
+func Contains(list []string, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(entry); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate comprueba que todas las entradas sean IPs o rangos CIDR
+func Validate(list []string) error {
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("%q no es una IP ni un rango CIDR", entry)
+		}
+	}
+	return nil
+}
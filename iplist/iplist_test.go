@@ -0,0 +1,40 @@
+package iplist
+
+import "testing"
+
+func TestContains(t *testing.T) {
+	list := Parse(" 10.8.0.0/16, 203.0.113.7 ,,2001:db8::/32")
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.8.4.2", true},
+		{"10.9.0.1", false},
+		{"203.0.113.7", true},
+		{"203.0.113.8", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"no-es-una-ip", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Contains(list, tt.ip); got != tt.want {
+			t.Errorf("Contains(%q) = %v, se esperaba %v", tt.ip, got, tt.want)
+		}
+	}
+	if Contains(nil, "10.8.4.2") {
+		t.Error("una lista vacía no contiene ninguna IP")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]string{"10.0.0.0/8", "::1", "192.0.2.1"}); err != nil {
+		t.Errorf("lista válida rechazada: %v", err)
+	}
+	if err := Validate([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("se esperaba un error con un rango inválido")
+	}
+	if err := Validate([]string{"oficina"}); err == nil {
+		t.Error("se esperaba un error con un nombre")
+	}
+}
@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api/tenancy"
+)
+
+// Handler procesa el payload de un trabajo
+type Handler func(ctx context.Context, payload []byte) error
+
+// Job trabajo encolado para ejecución asíncrona
+type Job struct {
+	Name     string
+	Payload  []byte
+	Attempts int
+	// Tenant de quien lo encoló; el manejador lo recibe en el contexto
+	Tenant string
+}
+
+// Número máximo de intentos antes de descartar un trabajo
+const maxAttempts = 3
+
+// schedule trabajo periódico registrado con Schedule
+type schedule struct {
+	name     string
+	interval time.Duration
+}
+
+var (
+	mu        sync.RWMutex
+	handlers  = map[string]Handler{}
+	schedules []schedule
+	queue     = make(chan Job, 1024)
+)
+
+// Register asocia un manejador al nombre de trabajo indicado
+func Register(name string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[name] = h
+}
+
+// Enqueue serializa el payload y encola el trabajo para el tenant de ctx
+func Enqueue(ctx context.Context, name string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	select {
+	case queue <- Job{Name: name, Payload: data, Tenant: tenancy.From(ctx)}:
+		return nil
+	default:
+		return fmt.Errorf("cola de trabajos llena, descartando %s", name)
+	}
+}
+
+// Schedule encola el trabajo indicado (sin payload) al iniciar la cola y después
+// cada interval. La primera ejecución es inmediata: con despliegues más
+// frecuentes que interval, el trabajo nunca llegaría a ejecutarse.
+func Schedule(name string, interval time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	schedules = append(schedules, schedule{name: name, interval: interval})
+}
+
+// Start lanza n workers que consumen la cola hasta que ctx se cancele
+func Start(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		go worker(ctx)
+	}
+
+	mu.RLock()
+	for _, s := range schedules {
+		go ticker(ctx, s)
+	}
+	mu.RUnlock()
+
+	log.Printf("⚙️  Cola de trabajos iniciada con %d workers", n)
+}
+
+// Discard vacía la cola sin ejecutar los trabajos; se usa en lugar de Start
+// cuando los datos sobre los que trabajarían no se conservan (modo sandbox)
+func Discard(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case job := <-queue:
+				log.Printf("🧪 Trabajo %s descartado (sandbox)", job.Name)
+			}
+		}
+	}()
+}
+
+func ticker(ctx context.Context, s schedule) {
+	if err := Enqueue(context.Background(), s.name, nil); err != nil {
+		log.Printf("⚠️  %v", err)
+	}
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := Enqueue(context.Background(), s.name, nil); err != nil {
+				log.Printf("⚠️  %v", err)
+			}
+		}
+	}
+}
+
+func worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-queue:
+			run(ctx, job)
+		}
+	}
+}
+
+func run(ctx context.Context, job Job) {
+	mu.RLock()
+	h, ok := handlers[job.Name]
+	mu.RUnlock()
+	if !ok {
+		log.Printf("❌ Trabajo sin manejador: %s", job.Name)
+		return
+	}
+
+	job.Attempts++
+	if job.Tenant != "" {
+		ctx = tenancy.With(ctx, job.Tenant)
+	}
+	err := safeCall(ctx, h, job.Payload)
+	if err == nil {
+		return
+	}
+
+	log.Printf("⚠️  Trabajo %s falló (intento %d/%d): %v", job.Name, job.Attempts, maxAttempts, err)
+	if job.Attempts >= maxAttempts {
+		return
+	}
+
+	// Reintentar con backoff sin bloquear al worker
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(job.Attempts*job.Attempts) * time.Second):
+			queue <- job
+		}
+	}()
+}
+
+// safeCall ejecuta el manejador recuperando pánicos
+func safeCall(ctx context.Context, h Handler, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, payload)
+}
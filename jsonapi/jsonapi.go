@@ -0,0 +1,215 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// MediaType tipo de medio de JSON:API; los clientes lo piden en Accept
+const MediaType = "application/vnd.api+json"
+
+// Type describe cómo se serializa un modelo como recurso JSON:API
+type Type struct {
+	// Name tipo del recurso (p. ej. "users")
+	Name string
+	// IDField campo JSON que se usa como id (por defecto "id" o el ID de gorm.Model)
+	IDField string
+	// Relations campos JSON que se sacan de los atributos como relaciones
+	Relations []Relation
+}
+
+// Relation relación a uno cuyo identificador está en un campo del modelo
+type Relation struct {
+	Name  string
+	Type  string
+	Field string
+}
+
+// Resource objeto de recurso de JSON:API
+type Resource struct {
+	Type          string                  `json:"type"`
+	ID            string                  `json:"id"`
+	Attributes    map[string]interface{}  `json:"attributes,omitempty"`
+	Relationships map[string]Relationship `json:"relationships,omitempty"`
+	Links         map[string]string       `json:"links,omitempty"`
+}
+
+// Identifier identificador de un recurso relacionado
+type Identifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Relationship relación de un recurso (data null si no hay recurso relacionado)
+type Relationship struct {
+	Data *Identifier `json:"data"`
+}
+
+// Error objeto de error de JSON:API
+type Error struct {
+	Status string                 `json:"status"`
+	Title  string                 `json:"title"`
+	Detail string                 `json:"detail,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// Document documento de nivel superior
+type Document struct {
+	Data    interface{}            `json:"data,omitempty"`
+	Errors  []Error                `json:"errors,omitempty"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	Links   map[string]string      `json:"links,omitempty"`
+	JSONAPI map[string]string      `json:"jsonapi"`
+}
+
+var (
+	mu    sync.RWMutex
+	types = map[reflect.Type]Type{}
+)
+
+// Register asocia un modelo a su tipo de recurso; los paquetes que exponen el
+// modelo lo registran en su init()
+func Register(model interface{}, t Type) {
+	mu.Lock()
+	defer mu.Unlock()
+	types[indirect(reflect.TypeOf(model))] = t
+}
+
+// Accepts indica si la cabecera Accept pide JSON:API
+func Accepts(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		if strings.TrimSpace(strings.SplitN(part, ";", 2)[0]) == MediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewDocument crea un documento con un recurso (struct o puntero) o una lista
+// (slice) de recursos de un tipo registrado
+func NewDocument(data interface{}, meta map[string]interface{}) (*Document, error) {
+	doc := &Document{Meta: meta, JSONAPI: map[string]string{"version": "1.1"}}
+
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Slice {
+		list := make([]Resource, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			resource, err := NewResource(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, *resource)
+		}
+		doc.Data = list
+		return doc, nil
+	}
+
+	resource, err := NewResource(data)
+	if err != nil {
+		return nil, err
+	}
+	doc.Data = resource
+	return doc, nil
+}
+
+// Resources devuelve los recursos del documento para completarlos (p. ej. con enlaces)
+func (d *Document) Resources() []*Resource {
+	switch data := d.Data.(type) {
+	case *Resource:
+		return []*Resource{data}
+	case []Resource:
+		list := make([]*Resource, len(data))
+		for i := range data {
+			list[i] = &data[i]
+		}
+		return list
+	}
+	return nil
+}
+
+// NewResource serializa un modelo registrado: sus campos JSON pasan a ser los
+// atributos, salvo el id y las relaciones
+func NewResource(model interface{}) (*Resource, error) {
+	mu.RLock()
+	t, ok := types[indirect(reflect.TypeOf(model))]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("jsonapi: tipo %T no registrado", model)
+	}
+
+	raw, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	var attributes map[string]interface{}
+	if err := json.Unmarshal(raw, &attributes); err != nil {
+		return nil, err
+	}
+
+	resource := &Resource{Type: t.Name, ID: takeID(attributes, t.IDField), Attributes: attributes}
+	for _, rel := range t.Relations {
+		value, ok := attributes[rel.Field]
+		if !ok {
+			continue
+		}
+		delete(attributes, rel.Field)
+
+		var data *Identifier
+		if id := idString(value); id != "" && id != "0" {
+			data = &Identifier{Type: rel.Type, ID: id}
+		}
+		if resource.Relationships == nil {
+			resource.Relationships = map[string]Relationship{}
+		}
+		resource.Relationships[rel.Name] = Relationship{Data: data}
+	}
+	return resource, nil
+}
+
+// takeID extrae el id de los atributos. Los modelos con gorm.Model se serializan
+// con ID, CreatedAt, UpdatedAt y DeletedAt; se renombran a snake_case.
+func takeID(attributes map[string]interface{}, field string) string {
+	for key, name := range map[string]string{"CreatedAt": "created_at", "UpdatedAt": "updated_at"} {
+		if value, ok := attributes[key]; ok {
+			attributes[name] = value
+			delete(attributes, key)
+		}
+	}
+	delete(attributes, "DeletedAt")
+
+	if field == "" {
+		field = "id"
+		if _, ok := attributes["ID"]; ok {
+			field = "ID"
+		}
+	}
+	id := idString(attributes[field])
+	// JSON:API reserva "id" y "type": no pueden aparecer como atributos
+	for _, reserved := range []string{field, "id", "ID", "type"} {
+		delete(attributes, reserved)
+	}
+	return id
+}
+
+func idString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,114 @@
+package links
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Link enlace a una acción sobre un recurso
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method"`
+}
+
+// Set enlaces de un recurso o listado por relación (self, update, delete, next...)
+type Set map[string]Link
+
+// Route ruta registrada en el router (plantilla completa, p. ej. /api/v1/users/:id)
+type Route struct {
+	Method string
+	Path   string
+}
+
+var (
+	mu     sync.RWMutex
+	routes = map[string][]string{}
+)
+
+// relations relación de cada método sobre la ruta de un recurso
+var relations = map[string]string{
+	http.MethodGet:    "self",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// Init guarda las rutas del router; se llama una vez registradas todas
+func Init(list []Route) {
+	mu.Lock()
+	defer mu.Unlock()
+	routes = map[string][]string{}
+	for _, r := range list {
+		routes[r.Path] = append(routes[r.Path], r.Method)
+	}
+}
+
+// Routes devuelve las rutas registradas ordenadas por ruta y método
+func Routes() []Route {
+	mu.RLock()
+	defer mu.RUnlock()
+	var list []Route
+	for path, methods := range routes {
+		for _, method := range methods {
+			list = append(list, Route{Method: method, Path: path})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Path != list[j].Path {
+			return list[i].Path < list[j].Path
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
+
+// Resource devuelve los enlaces de las acciones registradas sobre la plantilla
+// (GET = self, PUT/PATCH = update, DELETE = delete) con los parámetros sustituidos
+func Resource(pattern string, params map[string]string) Set {
+	mu.RLock()
+	methods := routes[pattern]
+	mu.RUnlock()
+	if len(methods) == 0 {
+		return nil
+	}
+
+	href := Expand(pattern, params)
+	set := Set{}
+	for _, method := range methods {
+		rel, ok := relations[method]
+		if !ok {
+			continue
+		}
+		// Con PUT y PATCH registrados se anuncia PATCH
+		if _, exists := set[rel]; exists && method != http.MethodPatch {
+			continue
+		}
+		set[rel] = Link{Href: href, Method: method}
+	}
+	return set
+}
+
+// Expand sustituye los parámetros :nombre de la plantilla
+func Expand(pattern string, params map[string]string) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = params[segment[1:]]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Hrefs devuelve solo las URLs de los enlaces (formato de links de JSON:API)
+func (s Set) Hrefs() map[string]string {
+	if len(s) == 0 {
+		return nil
+	}
+	hrefs := make(map[string]string, len(s))
+	for rel, link := range s {
+		hrefs[rel] = link.Href
+	}
+	return hrefs
+}
@@ -0,0 +1,167 @@
+// Package localtime presenta las fechas de las respuestas en la zona horaria
+// del cliente. Solo convierte valores time.Time: los textos que parecen una
+// fecha (una biografía, un valor de preferencia, un mensaje) se devuelven tal
+// cual se guardaron.
+package localtime
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Header cabecera con la que el cliente elige la zona horaria de las fechas;
+// tiene prioridad sobre la guardada en el usuario. Las respuestas la repiten
+// con la zona usada.
+const Header = "X-Timezone"
+
+// Resolve elige la zona de la cabecera si es válida, si no la del usuario y,
+// en último caso, UTC. "Local" se ignora: es la zona del servidor.
+func Resolve(header, user string) (string, *time.Location) {
+	for _, name := range []string{header, user} {
+		if name == "" || name == "Local" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc.String(), loc
+		}
+	}
+	return "UTC", time.UTC
+}
+
+type contextKey struct{}
+
+// WithLocation guarda en ctx la zona de la respuesta, para las capas que
+// serializan sin acceso a la petición HTTP (GraphQL)
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, contextKey{}, loc)
+}
+
+// FromContext devuelve la zona guardada con WithLocation o UTC
+func FromContext(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(contextKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// maxDepth profundidad máxima que se recorre; las respuestas son árboles poco
+// profundos y el límite evita recorrer sin fin una estructura con ciclos
+const maxDepth = 32
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Localize devuelve v con sus time.Time (en campos exportados, punteros,
+// listas, mapas e interfaces) pasados a loc sin cambiar el instante. v no se
+// modifica: las partes con fechas se copian y el resto se comparte.
+func Localize(v interface{}, loc *time.Location) interface{} {
+	if v == nil || loc == nil {
+		return v
+	}
+	out, changed := localize(reflect.ValueOf(v), loc, 0)
+	if !changed {
+		return v
+	}
+	return out.Interface()
+}
+
+// localize devuelve una copia de v con las fechas convertidas e indica si
+// había alguna; sin fechas devuelve el propio v
+func localize(v reflect.Value, loc *time.Location, depth int) (reflect.Value, bool) {
+	if depth > maxDepth {
+		return v, false
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return reflect.ValueOf(v.Interface().(time.Time).In(loc)), true
+		}
+		var out reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			// encoding/json tampoco serializa los campos no exportados
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			value, changed := localize(v.Field(i), loc, depth+1)
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Field(i).Set(value)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v, false
+		}
+		if elem, changed := localize(v.Elem(), loc, depth+1); changed {
+			out := reflect.New(v.Type().Elem())
+			out.Elem().Set(elem)
+			return out, true
+		}
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		if elem, changed := localize(v.Elem(), loc, depth+1); changed {
+			out := reflect.New(v.Type()).Elem()
+			out.Set(elem)
+			return out, true
+		}
+
+	case reflect.Slice, reflect.Array:
+		// []byte y json.RawMessage no pueden contener fechas
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false
+		}
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			value, changed := localize(v.Index(i), loc, depth+1)
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				if v.Kind() == reflect.Slice {
+					out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+					reflect.Copy(out, v)
+				} else {
+					out = reflect.New(v.Type()).Elem()
+					out.Set(v)
+				}
+			}
+			out.Index(i).Set(value)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+
+	case reflect.Map:
+		var out reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			value, changed := localize(iter.Value(), loc, depth+1)
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeMapWithSize(v.Type(), v.Len())
+				copied := v.MapRange()
+				for copied.Next() {
+					out.SetMapIndex(copied.Key(), copied.Value())
+				}
+			}
+			out.SetMapIndex(iter.Key(), value)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+	}
+	return v, false
+}
@@ -0,0 +1,102 @@
+package localtime
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type Profile struct {
+	Bio       string     `json:"bio"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	hidden    time.Time
+}
+
+type wrapper struct {
+	*Profile
+	Links map[string]string `json:"links,omitempty"`
+}
+
+func TestLocalize(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("sin base de datos de zonas horarias")
+	}
+	at := time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{
+			"los textos con forma de fecha no se tocan",
+			Profile{Bio: "desde 2026-07-01T10:00:00Z", CreatedAt: at},
+			`{"bio":"desde 2026-07-01T10:00:00Z","created_at":"2026-07-01T15:30:00+05:30"}`,
+		},
+		{
+			"un texto que es solo una fecha tampoco",
+			map[string]interface{}{"theme": "2026-07-01T10:00:00Z", "at": at},
+			`{"at":"2026-07-01T15:30:00+05:30","theme":"2026-07-01T10:00:00Z"}`,
+		},
+		{
+			"punteros e incrustados",
+			wrapper{Profile: &Profile{CreatedAt: at, DeletedAt: &at}},
+			`{"bio":"","created_at":"2026-07-01T15:30:00+05:30","deleted_at":"2026-07-01T15:30:00+05:30"}`,
+		},
+		{
+			"listas",
+			[]Profile{{CreatedAt: at}},
+			`[{"bio":"","created_at":"2026-07-01T15:30:00+05:30"}]`,
+		},
+		{"sin fechas", map[string]int{"a": 1}, `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := json.Marshal(Localize(tt.in, kolkata))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("Localize = %s, se esperaba %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalizeCopies(t *testing.T) {
+	at := time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC)
+	original := &Profile{CreatedAt: at, DeletedAt: &at, hidden: at}
+	loc := time.FixedZone("UTC+2", 2*60*60)
+
+	out := Localize(original, loc).(*Profile)
+	if out == original || out.CreatedAt.Location() != loc || out.DeletedAt.Location() != loc {
+		t.Fatalf("Localize = %+v", out)
+	}
+	if original.CreatedAt.Location() != time.UTC || original.DeletedAt.Location() != time.UTC {
+		t.Error("Localize modificó el valor original")
+	}
+	if !out.hidden.Equal(at) {
+		t.Error("se perdieron los campos no exportados")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name, header, user, want string
+	}{
+		{"sin zona", "", "", "UTC"},
+		{"del usuario", "", "America/Bogota", "America/Bogota"},
+		{"la cabecera manda", "UTC", "America/Bogota", "UTC"},
+		{"cabecera inválida", "Marte/Olympus", "America/Bogota", "America/Bogota"},
+		{"zona del servidor", "Local", "", "UTC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := Resolve(tt.header, tt.user); got != tt.want {
+				t.Errorf("Resolve(%q, %q) = %s, se esperaba %s", tt.header, tt.user, got, tt.want)
+			}
+		})
+	}
+}
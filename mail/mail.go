@@ -0,0 +1,300 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"api/breaker"
+	"api/health"
+)
+
+// Mailer envía correos transaccionales
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Default mailer configurado para la aplicación
+var Default Mailer = LogMailer{}
+
+func init() {
+	health.Register("mail", func(ctx context.Context) error {
+		m, ok := Default.(*SMTPMailer)
+		if !ok {
+			return health.ErrDisabled
+		}
+		return m.Ping(ctx)
+	})
+}
+
+// InitMailer usa SMTP si SMTP_HOST está definido; si no, registra los correos en el log
+func InitMailer() {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Println("✉️  SMTP no configurado, los correos se mostrarán en el log")
+		Default = LogMailer{}
+		return
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	Default = &SMTPMailer{
+		Addr:     host + ":" + port,
+		Host:     host,
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+	log.Printf("✉️  Usando SMTP en %s:%s", host, port)
+}
+
+// Send envía un correo con el mailer configurado
+func Send(to, subject, body string) error {
+	return Default.Send(to, subject, body)
+}
+
+// Attachment fichero adjunto a un correo
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// AttachmentMailer mailer que además sabe enviar ficheros adjuntos
+type AttachmentMailer interface {
+	SendWithAttachments(to, subject, body string, attachments []Attachment) error
+}
+
+// SendWithAttachments envía un correo con adjuntos; falla si el mailer
+// configurado no los admite
+func SendWithAttachments(to, subject, body string, attachments []Attachment) error {
+	m, ok := Default.(AttachmentMailer)
+	if !ok {
+		return fmt.Errorf("el mailer %T no admite adjuntos", Default)
+	}
+	return m.SendWithAttachments(to, subject, body, attachments)
+}
+
+// NamedMailer mailer que admite un nombre de remitente distinto en cada correo
+// (la dirección es siempre la configurada)
+type NamedMailer interface {
+	SendNamed(name, to, subject, body string, attachments []Attachment) error
+}
+
+// SMTPMailer envía correos mediante un servidor SMTP
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	return m.SendNamed("", to, subject, body, nil)
+}
+
+// SendNamed envía el correo con name como nombre del remitente; con adjuntos
+// como multipart/mixed
+func (m *SMTPMailer) SendNamed(name, to, subject, body string, attachments []Attachment) error {
+	if len(attachments) > 0 {
+		return m.sendMultipart(m.from(name), to, subject, body, attachments)
+	}
+	msg := strings.Join([]string{
+		"From: " + m.from(name),
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := m.deliver(to, []byte(msg)); err != nil {
+		return fmt.Errorf("enviando correo a %s: %w", to, err)
+	}
+	return nil
+}
+
+// Ping abre una conexión con el servidor SMTP y la cierra sin enviar nada
+func (m *SMTPMailer) Ping(ctx context.Context) error {
+	client, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err := client.Hello("localhost"); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Timeout tiempo máximo para entregar un correo al servidor SMTP
+// (SMTP_TIMEOUT, 30s por defecto)
+func Timeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SMTP_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return 30 * time.Second
+}
+
+// deliver entrega el mensaje como smtp.SendMail (con STARTTLS si el servidor
+// lo admite), pero con un tiempo máximo y a través del circuito "mail": si el
+// servidor no responde los envíos fallan al momento en lugar de ocupar los
+// workers
+func (m *SMTPMailer) deliver(to string, msg []byte) error {
+	return breaker.Get("mail").Do(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout())
+		defer cancel()
+		client, err := m.dial(ctx)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if err := client.Hello("localhost"); err != nil {
+			return err
+		}
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+				return err
+			}
+		}
+		if m.Username != "" {
+			if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+				return err
+			}
+		}
+		if err := client.Mail(m.From); err != nil {
+			return err
+		}
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+		w, err := client.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(msg); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return client.Quit()
+	})
+}
+
+// dial abre la conexión con el servidor; caduca cuando termina ctx
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// from cabecera From: la dirección configurada, precedida de name si se indica
+func (m *SMTPMailer) from(name string) string {
+	if name == "" {
+		return m.From
+	}
+	return (&netmail.Address{Name: name, Address: m.From}).String()
+}
+
+// SendWithAttachments envía el texto y los adjuntos como multipart/mixed
+func (m *SMTPMailer) SendWithAttachments(to, subject, body string, attachments []Attachment) error {
+	return m.sendMultipart(m.From, to, subject, body, attachments)
+}
+
+func (m *SMTPMailer) sendMultipart(from, to, subject, body string, attachments []Attachment) error {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		from, to, mime.QEncoding.Encode("utf-8", subject), parts.Boundary())
+
+	text, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	if err != nil {
+		return err
+	}
+	io.WriteString(text, body)
+	for _, att := range attachments {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {att.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename})},
+		})
+		if err != nil {
+			return err
+		}
+		// Líneas de 76 caracteres como máximo (RFC 2045)
+		encoded := base64.StdEncoding.EncodeToString(att.Data)
+		for len(encoded) > 76 {
+			io.WriteString(part, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(part, encoded)
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+
+	if err := m.deliver(to, buf.Bytes()); err != nil {
+		return fmt.Errorf("enviando correo a %s: %w", to, err)
+	}
+	return nil
+}
+
+// LogMailer escribe los correos en el log (desarrollo)
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("✉️  Para: %s | Asunto: %s\n%s", to, subject, body)
+	return nil
+}
+
+// SendWithAttachments registra el correo con el nombre y tamaño de cada adjunto
+func (l LogMailer) SendWithAttachments(to, subject, body string, attachments []Attachment) error {
+	for _, att := range attachments {
+		body += fmt.Sprintf("\n📎 %s (%d bytes)", att.Filename, len(att.Data))
+	}
+	return l.Send(to, subject, body)
+}
+
+// SendNamed registra el correo con el nombre del remitente
+func (LogMailer) SendNamed(name, to, subject, body string, attachments []Attachment) error {
+	for _, att := range attachments {
+		body += fmt.Sprintf("\n📎 %s (%d bytes)", att.Filename, len(att.Data))
+	}
+	log.Printf("✉️  De: %s | Para: %s | Asunto: %s\n%s", name, to, subject, body)
+	return nil
+}
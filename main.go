@@ -1,12 +1,40 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"api/accounts"
+	"api/auth"
+	"api/backup"
+	"api/billing"
 	"api/config"
 	"api/database"
+	"api/encryption"
+	"api/exports"
+	"api/geoip"
+	"api/grpcserver"
+	"api/images"
+	"api/jobs"
+	"api/mail"
+	"api/openapi"
+	"api/plans"
+	"api/realtime"
+	"api/reports"
+	"api/retention"
 	"api/routes"
+	"api/sandbox"
+	"api/search"
+	"api/secrets"
+	"api/services"
+	"api/storage"
+	"api/usage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -33,12 +61,47 @@ import (
 // @in header
 // @name Authorization
 // @description Type "Bearer" followed by a space and JWT token.
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key generated from /api-keys.
 func main() {
 	// Cargar variables de entorno
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using default values")
 	}
 
+	// Modo sandbox: base de datos desechable y sin servicios externos
+	if sandbox.Enabled() {
+		if err := sandbox.Configure(); err != nil {
+			log.Fatal("Failed to configure sandbox:", err)
+		}
+	}
+
+	// Resolver las referencias a secretos (vault://, awssm://) del entorno
+	if err := secrets.Load(context.Background()); err != nil {
+		log.Fatal("Failed to load secrets:", err)
+	}
+
+	// Cargar el secreto de firma de tokens (obligatorio en modo release)
+	if err := auth.Init(); err != nil {
+		log.Fatal("Failed to load JWT secret:", err)
+	}
+
+	// Inicializar el cifrado de campos sensibles
+	if err := encryption.Init(); err != nil {
+		log.Fatal("Failed to initialize encryption:", err)
+	}
+
+	// Subcomandos de mantenimiento
+	if len(os.Args) > 1 {
+		if !runCommand(os.Args[1:]) {
+			log.Fatalf("Comando desconocido: %s (usa 'help')", os.Args[1])
+		}
+		return
+	}
+
 	// Configurar el modo de Gin
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -49,6 +112,93 @@ func main() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// Vigilar la conexión y reconectar si se pierde
+	database.Monitor(context.Background(), 10*time.Second)
+
+	// Crear los planes predefinidos que falten (en cada tenant con TENANCY=schema)
+	if err := database.ForEachTenant(context.Background(), plans.Seed); err != nil {
+		log.Fatal("Failed to seed plans:", err)
+	}
+
+	// Datos de ejemplo del sandbox
+	if sandbox.Enabled() {
+		if err := sandbox.Reset(); err != nil {
+			log.Fatal("Failed to seed sandbox:", err)
+		}
+	}
+
+	// Inicializar el almacenamiento de archivos
+	if err := storage.InitStorage(); err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	// Configurar el envío de correos
+	mail.InitMailer()
+
+	// Conversor de HTML a PDF para el resumen mensual (opcional)
+	reports.InitPDF()
+
+	// Base de datos GeoIP para las alertas de inicio de sesión
+	if err := geoip.Init(); err != nil {
+		log.Fatal("Failed to open GeoIP database:", err)
+	}
+
+	// Motor de búsqueda externo (SEARCH_BACKEND), si lo hay
+	if err := search.Init(context.Background()); err != nil {
+		log.Fatal("Failed to initialize search backend:", err)
+	}
+
+	// Registrar e iniciar los trabajos asíncronos
+	jobs.Register(images.AvatarJob, images.ProcessAvatar)
+	jobs.Register(exports.Job, exports.Process)
+	jobs.Register(reports.Job, reports.Process)
+	// Los trabajos periódicos recorren el esquema public y el de cada tenant
+	jobs.Register(reports.ScheduleJob, database.PerTenant(reports.RunSchedules))
+	jobs.Schedule(reports.ScheduleJob, 15*time.Minute)
+	jobs.Register(backup.Job, backup.Process)
+	jobs.Register(services.TenantExportJob, services.RunTenantExport)
+	jobs.Register(accounts.PurgeJob, database.PerTenant(accounts.Purge))
+	jobs.Schedule(accounts.PurgeJob, time.Hour)
+	jobs.Register(retention.Job, database.PerTenant(retention.Run))
+	jobs.Schedule(retention.Job, 24*time.Hour)
+	jobs.Register(database.PartitionJob, database.PerTenant(database.MaintainPartitions))
+	jobs.Schedule(database.PartitionJob, 24*time.Hour)
+	jobs.Register(billing.CustomerJob, billing.CreateCustomerJob)
+	jobs.Register(services.LoginAlertJob, services.SendLoginAlert)
+	jobs.Register(search.IndexJob, search.IndexUser)
+	if sandbox.Enabled() {
+		// Trabajarían sobre datos que se restauran al terminar cada petición
+		jobs.Discard(context.Background())
+	} else {
+		jobs.Start(context.Background(), 2)
+	}
+
+	// Reencolar las exportaciones que quedaron pendientes antes del reinicio
+	if err := database.ForEachTenant(context.Background(), exports.Recover); err != nil {
+		log.Printf("⚠️  No se pudieron recuperar las exportaciones pendientes: %v", err)
+	}
+	if err := database.ForEachTenant(context.Background(), reports.Recover); err != nil {
+		log.Printf("⚠️  No se pudieron recuperar los informes pendientes: %v", err)
+	}
+	if err := backup.Recover(context.Background()); err != nil {
+		log.Printf("⚠️  No se pudieron recuperar las copias de seguridad pendientes: %v", err)
+	}
+
+	// Eventos en tiempo real (WebSocket), repartidos por Redis si hay varias réplicas
+	if err := realtime.Init(context.Background()); err != nil {
+		log.Fatal("Failed to initialize realtime events:", err)
+	}
+
+	// Volcar periódicamente las métricas de uso
+	usage.Start(context.Background(), 10*time.Second)
+
+	// Renovar periódicamente los secretos cargados
+	refresh, err := time.ParseDuration(os.Getenv("SECRETS_REFRESH_INTERVAL"))
+	if err != nil {
+		refresh = time.Hour
+	}
+	secrets.StartRenewal(context.Background(), refresh)
+
 	// Crear el router de Gin
 	router := gin.Default()
 
@@ -58,8 +208,25 @@ func main() {
 	// Configurar rutas
 	routes.SetupRoutes(router)
 
+	// Servidor gRPC para consumidores internos y su gateway JSON/HTTP en /rpc/v1
+	grpcServer, err := grpcserver.Start()
+	if err != nil {
+		log.Fatal("Failed to start gRPC server:", err)
+	}
+	gateway, err := grpcserver.Gateway(context.Background())
+	if err != nil {
+		log.Fatal("Failed to start gRPC gateway:", err)
+	}
+	router.Any("/rpc/v1/*path", func(c *gin.Context) {
+		// El gateway reenvía X-Forwarded-For al servidor gRPC: se sustituye por la IP
+		// resuelta por Gin (según TRUSTED_PROXIES) para que no se pueda falsificar
+		c.Request.Header.Set("X-Forwarded-For", c.ClientIP())
+		gateway.ServeHTTP(c.Writer, c.Request)
+	})
+
 	// Configurar Swagger
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	router.GET("/openapi.json", openapi.Handler)
 
 	// Obtener el puerto desde las variables de entorno
 	port := os.Getenv("PORT")
@@ -70,8 +237,29 @@ func main() {
 	// Iniciar el servidor
 	log.Printf("🚀 Servidor iniciado en http://localhost:%s", port)
 	log.Printf("📚 Documentación Swagger disponible en http://localhost:%s/swagger/index.html", port)
+	log.Printf("📄 Especificación OpenAPI 3 en http://localhost:%s/openapi.json", port)
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Parada ordenada: cerrar los streams de eventos, terminar las peticiones en
+	// curso y volcar las métricas de uso acumuladas en memoria antes de salir
+	stop, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+	log.Println("🛑 Deteniendo el servidor...")
 
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	realtime.Shutdown()
+	ctx, cancelShutdown := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("⚠️  Error deteniendo el servidor HTTP: %v", err)
 	}
+	grpcServer.GracefulStop()
+	usage.Flush()
+	log.Println("👋 Servidor detenido")
 }
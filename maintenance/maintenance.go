@@ -0,0 +1,98 @@
+package maintenance
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/iplist"
+
+	"gorm.io/gorm"
+)
+
+// settingKey clave del ajuste donde se guarda el estado
+const settingKey = "maintenance"
+
+// cacheTTL tiempo que se reutiliza el estado leído; con varias instancias el
+// cambio tarda como máximo esto en propagarse
+const cacheTTL = 5 * time.Second
+
+// State estado del modo mantenimiento
+type State struct {
+	Enabled    bool       `json:"enabled"`
+	Message    string     `json:"message"`
+	RetryAfter int        `json:"retry_after"`
+	AllowIPs   []string   `json:"allow_ips"`
+	EnabledAt  *time.Time `json:"enabled_at,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	cached   State
+	loadedAt time.Time
+)
+
+// Current devuelve el estado actual, releyéndolo de la base de datos como mucho cada cacheTTL
+func Current() State {
+	mu.Lock()
+	defer mu.Unlock()
+	if time.Since(loadedAt) < cacheTTL {
+		return cached
+	}
+
+	var setting database.Setting
+	err := database.DB.Where("key = ?", settingKey).First(&setting).Error
+	switch {
+	case err == nil:
+		var state State
+		if json.Unmarshal([]byte(setting.Value), &state) == nil {
+			cached = state
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		cached = State{}
+	}
+	// Ante un error de lectura se mantiene el último estado conocido
+	loadedAt = time.Now()
+	return cached
+}
+
+// Set guarda el nuevo estado y lo aplica inmediatamente en esta instancia
+func Set(state State) error {
+	if state.Enabled && state.EnabledAt == nil {
+		now := clock.Now().UTC()
+		state.EnabledAt = &now
+	}
+	if !state.Enabled {
+		state.EnabledAt = nil
+	}
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.Save(&database.Setting{Key: settingKey, Value: string(value)}).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	cached, loadedAt = state, time.Now()
+	mu.Unlock()
+	return nil
+}
+
+// Allowed indica si la IP puede saltarse el modo mantenimiento. Además de las
+// IPs del estado se aceptan las de MAINTENANCE_ALLOW_IPS (IPs o rangos CIDR).
+func (s State) Allowed(ip string) bool {
+	return iplist.Contains(s.AllowIPs, ip) || iplist.Contains(iplist.Parse(os.Getenv("MAINTENANCE_ALLOW_IPS")), ip)
+}
+
+// ValidBypassToken indica si el valor coincide con MAINTENANCE_BYPASS_TOKEN
+func ValidBypassToken(value string) bool {
+	token := os.Getenv("MAINTENANCE_BYPASS_TOKEN")
+	return token != "" && value != "" && subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+}
@@ -0,0 +1,190 @@
+// Package metadata valida los atributos propios que los integradores guardan
+// en los usuarios (columna metadata): claves en snake_case, valores planos
+// (cadenas, números, booleanos y listas de ellos) y un tamaño máximo. Con
+// USER_METADATA_SCHEMA solo se admiten las claves declaradas, con su tipo.
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Límites de los metadatos de un usuario
+const (
+	// MaxKeys claves por usuario
+	MaxKeys = 50
+	// MaxStringLength caracteres de cada cadena
+	MaxStringLength = 1000
+	// MaxArrayItems elementos de cada lista
+	MaxArrayItems = 50
+	// DefaultMaxBytes tamaño máximo del JSON serializado si no se configura
+	// USER_METADATA_MAX_BYTES
+	DefaultMaxBytes = 8 << 10
+)
+
+// Tipos de valor que se pueden declarar en USER_METADATA_SCHEMA
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeArray   = "array"
+)
+
+// keyPattern claves válidas
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Error clave o valor rechazado; Key vacía si el error es del conjunto
+type Error struct {
+	Key    string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	if e.Key == "" {
+		return "metadata: " + e.Reason
+	}
+	return fmt.Sprintf("metadata %s: %s", e.Key, e.Reason)
+}
+
+// MaxBytes tamaño máximo en bytes del JSON de los metadatos de un usuario
+// (USER_METADATA_MAX_BYTES, por defecto 8 KiB)
+func MaxBytes() int {
+	if n, err := strconv.Atoi(os.Getenv("USER_METADATA_MAX_BYTES")); err == nil && n > 0 {
+		return n
+	}
+	return DefaultMaxBytes
+}
+
+// Schema claves admitidas con su tipo, de USER_METADATA_SCHEMA
+// ("crm_id:string,seats:number,beta:boolean,segments:array"); nil si no se
+// ha configurado y se admite cualquier clave válida. Las entradas mal
+// formadas se ignoran.
+func Schema() map[string]string {
+	raw := strings.TrimSpace(os.Getenv("USER_METADATA_SCHEMA"))
+	if raw == "" {
+		return nil
+	}
+	schema := map[string]string{}
+	for _, entry := range strings.Split(raw, ",") {
+		key, kind, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		switch kind {
+		case TypeString, TypeNumber, TypeBoolean, TypeArray:
+			if keyPattern.MatchString(key) {
+				schema[key] = kind
+			}
+		}
+	}
+	return schema
+}
+
+// Merge aplica changes sobre los metadatos guardados y devuelve el resultado
+// sin modificar stored. Un valor null quita la clave. Con replace, el
+// resultado son solo los de changes. Las claves o valores que no cumplen las
+// reglas y un resultado que supera los límites se rechazan con un *Error.
+func Merge(stored map[string]interface{}, changes map[string]json.RawMessage, replace bool) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(stored)+len(changes))
+	if !replace {
+		for key, value := range stored {
+			merged[key] = value
+		}
+	}
+
+	schema := Schema()
+	// Orden estable para que el error sea siempre el de la misma clave
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		raw := changes[key]
+		if !keyPattern.MatchString(key) {
+			return nil, &Error{Key: key, Reason: "la clave debe empezar por minúscula y tener solo minúsculas, dígitos y _ (hasta 64 caracteres)"}
+		}
+		kind, declared := schema[key]
+		if schema != nil && !declared {
+			return nil, &Error{Key: key, Reason: "la clave no está en el esquema"}
+		}
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			delete(merged, key)
+			continue
+		}
+		value, err := parse(raw, kind)
+		if err != nil {
+			return nil, &Error{Key: key, Reason: err.Error()}
+		}
+		merged[key] = value
+	}
+
+	if len(merged) > MaxKeys {
+		return nil, &Error{Reason: fmt.Sprintf("no se admiten más de %d claves", MaxKeys)}
+	}
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	if max := MaxBytes(); len(encoded) > max {
+		return nil, &Error{Reason: fmt.Sprintf("ocupan %d bytes y el máximo es %d", len(encoded), max)}
+	}
+	return merged, nil
+}
+
+// parse valida un valor; kind es el tipo declarado en el esquema o vacío
+func parse(raw json.RawMessage, kind string) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("JSON inválido")
+	}
+	if err := check(value, kind, true); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func check(value interface{}, kind string, top bool) error {
+	switch v := value.(type) {
+	case string:
+		if utf8.RuneCountInString(v) > MaxStringLength {
+			return fmt.Errorf("las cadenas no pueden superar %d caracteres", MaxStringLength)
+		}
+		return expect(kind, TypeString)
+	case json.Number:
+		return expect(kind, TypeNumber)
+	case bool:
+		return expect(kind, TypeBoolean)
+	case []interface{}:
+		if !top {
+			return fmt.Errorf("no se admiten listas anidadas")
+		}
+		if len(v) > MaxArrayItems {
+			return fmt.Errorf("las listas no pueden tener más de %d elementos", MaxArrayItems)
+		}
+		for _, item := range v {
+			if err := check(item, "", false); err != nil {
+				return err
+			}
+		}
+		return expect(kind, TypeArray)
+	case nil:
+		return fmt.Errorf("las listas no admiten null")
+	default:
+		return fmt.Errorf("no se admiten objetos: los metadatos son planos")
+	}
+}
+
+// expect comprueba que got es el tipo declarado (si lo hay)
+func expect(kind, got string) error {
+	if kind != "" && kind != got {
+		return fmt.Errorf("debe ser de tipo %s", kind)
+	}
+	return nil
+}
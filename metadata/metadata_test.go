@@ -0,0 +1,81 @@
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	stored := map[string]interface{}{"crm_id": "A-1", "seats": 5}
+
+	tests := []struct {
+		name    string
+		changes string
+		replace bool
+		schema  string
+		want    []string
+		invalid string
+	}{
+		{"añade una clave", `{"beta": true}`, false, "", []string{"beta", "crm_id", "seats"}, ""},
+		{"null quita la clave", `{"seats": null}`, false, "", []string{"crm_id"}, ""},
+		{"sustituir", `{"segments": ["a", "b"]}`, true, "", []string{"segments"}, ""},
+		{"clave inválida", `{"CrmId": "x"}`, false, "", nil, "CrmId"},
+		{"objeto anidado", `{"address": {"city": "Madrid"}}`, false, "", nil, "address"},
+		{"lista anidada", `{"matrix": [[1]]}`, false, "", nil, "matrix"},
+		{"cadena larga", `{"notes": "` + strings.Repeat("x", MaxStringLength+1) + `"}`, false, "", nil, "notes"},
+		{"fuera del esquema", `{"beta": true}`, false, "crm_id:string,seats:number", nil, "beta"},
+		{"tipo del esquema", `{"seats": "5"}`, false, "crm_id:string,seats:number", nil, "seats"},
+		{"dentro del esquema", `{"seats": 7}`, false, "crm_id:string,seats:number", []string{"crm_id", "seats"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("USER_METADATA_SCHEMA", tt.schema)
+			var changes map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.changes), &changes); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Merge(stored, changes, tt.replace)
+			if tt.invalid != "" {
+				var merr *Error
+				if !errors.As(err, &merr) || merr.Key != tt.invalid {
+					t.Fatalf("error = %v, se esperaba uno de %s", err, tt.invalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("resultado = %v, se esperaban las claves %v", got, tt.want)
+			}
+			for _, key := range tt.want {
+				if _, ok := got[key]; !ok {
+					t.Errorf("falta %s en %v", key, got)
+				}
+			}
+		})
+	}
+	if len(stored) != 2 {
+		t.Errorf("Merge modificó los guardados: %v", stored)
+	}
+}
+
+func TestMergeLimits(t *testing.T) {
+	t.Setenv("USER_METADATA_MAX_BYTES", "64")
+	changes := map[string]json.RawMessage{"notes": json.RawMessage(`"` + strings.Repeat("x", 100) + `"`)}
+	var merr *Error
+	if _, err := Merge(nil, changes, false); !errors.As(err, &merr) || merr.Key != "" {
+		t.Errorf("error = %v, se esperaba el de tamaño", err)
+	}
+
+	t.Setenv("USER_METADATA_MAX_BYTES", "")
+	changes = map[string]json.RawMessage{}
+	for i := 0; i <= MaxKeys; i++ {
+		changes["k"+strings.Repeat("x", i)] = json.RawMessage(`1`)
+	}
+	if _, err := Merge(nil, changes, false); !errors.As(err, &merr) || merr.Key != "" {
+		t.Errorf("error = %v, se esperaba el de número de claves", err)
+	}
+}
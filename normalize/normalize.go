@@ -0,0 +1,134 @@
+// Package normalize limpia los datos de entrada antes de validarlos y
+// guardarlos. Los cuerpos de petición que implementan Normalizer se normalizan
+// automáticamente al hacer binding (ShouldBindJSON y similares), justo antes de
+// aplicar las reglas de validación:
+//
+//	func (r *RegisterRequest) Normalize() {
+//		r.Email = normalize.Email(r.Email)
+//		r.Name = normalize.Name(r.Name)
+//	}
+//
+// GraphQL y gRPC usan las mismas funciones para que el resultado no dependa
+// de la interfaz por la que llega el dato.
+package normalize
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer cuerpo de petición que sabe normalizar sus campos
+type Normalizer interface {
+	Normalize()
+}
+
+// confusables letras cirílicas y griegas que se confunden con letras latinas;
+// solo se sustituyen en nombres que mezclan alfabetos (p. ej. "Аdmin" con A cirílica)
+var confusables = map[rune]rune{
+	// Cirílico
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P',
+	'С': 'C', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'Ѕ': 'S', 'І': 'I', 'Ј': 'J',
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x',
+	'ѕ': 's', 'і': 'i', 'ј': 'j', 'һ': 'h', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	// Griego
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	'ο': 'o', 'ν': 'v', 'ρ': 'p', 'ι': 'i', 'κ': 'k', 'υ': 'u',
+}
+
+func init() {
+	binding.Validator = &validator{binding.Validator}
+}
+
+// validator normaliza el cuerpo antes de delegar la validación en el validador de Gin
+type validator struct {
+	binding.StructValidator
+}
+
+func (v *validator) ValidateStruct(obj interface{}) error {
+	if n, ok := obj.(Normalizer); ok {
+		n.Normalize()
+	}
+	return v.StructValidator.ValidateStruct(obj)
+}
+
+// Text quita los caracteres de control, unifica la forma Unicode (NFKC) y
+// reduce los espacios consecutivos a uno, sin espacios al principio ni al final
+func Text(s string) string {
+	s = norm.NFKC.String(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			// caracteres de control y de formato invisibles (p. ej. U+200B)
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Email limpia el email y lo pasa a minúsculas
+func Email(s string) string {
+	return strings.ToLower(Text(s))
+}
+
+// Username limpia un nombre de usuario y lo pasa a minúsculas; la @ inicial se ignora
+func Username(s string) string {
+	return strings.TrimPrefix(strings.ToLower(Text(s)), "@")
+}
+
+// Phone quita los separadores habituales de un teléfono (espacios, guiones,
+// puntos y paréntesis) y cambia el prefijo internacional 00 por +
+func Phone(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || strings.ContainsRune("-.()", r) {
+			return -1
+		}
+		return r
+	}, Text(s))
+	if strings.HasPrefix(s, "00") {
+		s = "+" + s[2:]
+	}
+	return s
+}
+
+// Name limpia un nombre y, si mezcla letras latinas con cirílicas o griegas de
+// aspecto idéntico, sustituye estas por las latinas
+func Name(s string) string {
+	s = Text(s)
+	if !mixedScripts(s) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if latin, ok := confusables[r]; ok {
+			return latin
+		}
+		return r
+	}, s)
+}
+
+// mixedScripts indica si el texto tiene letras latinas y también cirílicas o griegas
+func mixedScripts(s string) bool {
+	var latin, other bool
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin = true
+		case unicode.Is(unicode.Cyrillic, r), unicode.Is(unicode.Greek, r):
+			other = true
+		}
+	}
+	return latin && other
+}
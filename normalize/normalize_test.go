@@ -0,0 +1,31 @@
+package normalize
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(string) string
+		in   string
+		want string
+	}{
+		{"email con espacios y mayúsculas", Email, "  Ana.Garcia@Example.COM \n", "ana.garcia@example.com"},
+		{"email de ancho completo", Email, "ａｎａ@example.com", "ana@example.com"},
+		{"nombre con espacios", Name, "  Ana \t  García ", "Ana García"},
+		{"nombre con caracteres de control", Name, "Ana\x00\u200b García\x1b", "Ana García"},
+		{"nombre con cirílico mezclado", Name, "Аdmin Sоporte", "Admin Soporte"},
+		{"nombre solo en cirílico", Name, "Анна Петрова", "Анна Петрова"},
+		{"nombre griego", Name, "Νίκος", "Νίκος"},
+		{"nombre de usuario", Username, " @Ana.Garcia ", "ana.garcia"},
+		{"teléfono con separadores", Phone, "+34 (600) 111-222", "+34600111222"},
+		{"teléfono con prefijo 00", Phone, "0034 600.111.222", "+34600111222"},
+		{"texto vacío", Text, " \t\n ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn(tt.in); got != tt.want {
+				t.Errorf("%q -> %q, se esperaba %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Package oauth reúne las piezas del servidor de autorización OAuth2 que no
+// dependen de la base de datos: los scopes y las rutas que abre cada uno, la
+// verificación PKCE, el formato de los tokens y los errores del RFC 6749.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Prefijos de las credenciales emitidas, para distinguirlas de los JWT y de
+// las claves de API
+const (
+	ClientIDPrefix     = "goc_"
+	ClientSecretPrefix = "gos_"
+	AccessTokenPrefix  = "goa_"
+	RefreshTokenPrefix = "gor_"
+)
+
+// Canje de tokens (RFC 8693): un servicio con el token de un usuario obtiene
+// otro más limitado para llamar a otro servicio en su nombre
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Flujo de dispositivo (RFC 8628) para las aplicaciones sin navegador (CLI, TV)
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// userCodeAlphabet letras del código que teclea el usuario: sin vocales (no
+// forman palabras) ni caracteres que se confunden entre sí (RFC 8628 6.1)
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// NewUserCode genera el código que el usuario teclea para aprobar un
+// dispositivo, de 8 letras en dos grupos: WDJB-MJHT
+func NewUserCode() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = userCodeAlphabet[int(b[i])%len(userCodeAlphabet)]
+	}
+	return string(b[:4]) + "-" + string(b[4:])
+}
+
+// NormalizeUserCode quita al código tecleado los guiones y espacios y lo pasa a mayúsculas
+func NormalizeUserCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// IsAccessToken indica si la credencial recibida tiene formato de token de acceso OAuth
+func IsAccessToken(credential string) bool {
+	return strings.HasPrefix(credential, AccessTokenPrefix)
+}
+
+// Route ruta de la API (sin el prefijo /api/vN) que abre un scope
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Scope permiso que una aplicación puede pedir al usuario
+type Scope struct {
+	Name        string
+	Description string
+	Routes      []Route
+}
+
+var (
+	mu     sync.RWMutex
+	scopes = map[string]Scope{}
+)
+
+func init() {
+	Register(Scope{
+		Name:        "profile:read",
+		Description: "Ver tu perfil y datos personales, tus preferencias, tu plan, tus cuotas y tu avatar",
+		Routes: []Route{
+			{"GET", "/profile"},
+			{"GET", "/profile/settings"},
+			{"GET", "/profile/plan"},
+			{"GET", "/profile/quotas"},
+			{"GET", "/profile/avatar"},
+		},
+	})
+	Register(Scope{
+		Name:        "profile:write",
+		Description: "Modificar tu nombre, tu email, tus datos personales, tus preferencias y tu avatar",
+		Routes: []Route{
+			{"PUT", "/users/:id"},
+			{"PUT", "/profile"},
+			{"PUT", "/profile/settings"},
+			{"POST", "/profile/avatar"},
+		},
+	})
+	Register(Scope{
+		Name:        "uploads",
+		Description: "Subir archivos a tu cuenta",
+		Routes: []Route{
+			{"POST", "/uploads"},
+			{"GET", "/uploads/:id"},
+			{"PUT", "/uploads/:id/parts/:number"},
+			{"POST", "/uploads/:id/complete"},
+			{"DELETE", "/uploads/:id"},
+			{"POST", "/uploads/presign"},
+			{"POST", "/uploads/presign/:id/confirm"},
+		},
+	})
+}
+
+// Register añade un scope
+func Register(s Scope) {
+	mu.Lock()
+	defer mu.Unlock()
+	scopes[s.Name] = s
+}
+
+// Scopes devuelve los scopes registrados ordenados por nombre
+func Scopes() []Scope {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]Scope, 0, len(scopes))
+	for _, s := range scopes {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Lookup devuelve el scope con ese nombre
+func Lookup(name string) (Scope, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := scopes[name]
+	return s, ok
+}
+
+// ParseScope separa el parámetro scope (nombres separados por espacios), quita
+// los repetidos y comprueba que todos existen
+func ParseScope(value string) ([]string, error) {
+	seen := map[string]bool{}
+	var list []string
+	for _, name := range strings.Fields(value) {
+		if _, ok := Lookup(name); !ok {
+			return nil, &Error{Code: InvalidScope, Description: fmt.Sprintf("scope desconocido: %s", name)}
+		}
+		if !seen[name] {
+			seen[name] = true
+			list = append(list, name)
+		}
+	}
+	if len(list) == 0 {
+		return nil, &Error{Code: InvalidScope, Description: "hay que pedir al menos un scope"}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// Covers indica si granted incluye todos los scopes de requested
+func Covers(granted, requested []string) bool {
+	have := map[string]bool{}
+	for _, s := range granted {
+		have[s] = true
+	}
+	for _, s := range requested {
+		if !have[s] {
+			return false
+		}
+	}
+	return true
+}
+
+var versionPrefix = regexp.MustCompile(`^/api/v\d+`)
+
+// Allows indica si algún scope abre la ruta. route es la plantilla de Gin
+// (c.FullPath()); las rutas fuera de /api/vN (GraphQL, WebSocket...) nunca se abren.
+func Allows(granted []string, method, route string) bool {
+	prefix := versionPrefix.FindString(route)
+	if prefix == "" {
+		return false
+	}
+	route = strings.TrimPrefix(route, prefix)
+	for _, name := range granted {
+		s, ok := Lookup(name)
+		if !ok {
+			continue
+		}
+		for _, r := range s.Routes {
+			if r.Method == method && r.Path == route {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// VerifyPKCE comprueba el code_verifier contra el code_challenge (método S256)
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ValidRedirectURI comprueba que una URI de redirección se puede registrar:
+// absoluta, sin fragmento y, si es http, solo hacia la propia máquina (las
+// aplicaciones móviles pueden usar su esquema propio)
+func ValidRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return !strings.EqualFold(u.Scheme, "javascript") && !strings.EqualFold(u.Scheme, "data")
+	}
+}
+
+// RedirectWith añade parámetros a la URI de redirección del cliente
+func RedirectWith(redirectURI string, params map[string]string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for k, v := range params {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Códigos de error del RFC 6749, del RFC 8693 y del RFC 8628
+const (
+	InvalidRequest          = "invalid_request"
+	InvalidClient           = "invalid_client"
+	InvalidGrant            = "invalid_grant"
+	InvalidScope            = "invalid_scope"
+	AccessDenied            = "access_denied"
+	UnsupportedResponseType = "unsupported_response_type"
+	UnsupportedGrantType    = "unsupported_grant_type"
+	UnauthorizedClient      = "unauthorized_client"
+	// RFC 8693: la audiencia pedida no existe o el cliente no puede pedirla
+	InvalidTarget = "invalid_target"
+	// RFC 8628: respuestas a la consulta del flujo de dispositivo
+	AuthorizationPending = "authorization_pending"
+	SlowDown             = "slow_down"
+	ExpiredToken         = "expired_token"
+)
+
+// Error error OAuth2 tal y como se devuelve al cliente
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
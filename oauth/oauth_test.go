@@ -0,0 +1,87 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mJ92K9X3fGYcQmyJ2ZJN6yLdDnM6Ac"
+	challenge := "V90-JxdLEzT_kHJMP87918lLnpP1LGd9pTwPwmspZWs"
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("el verificador correcto no se acepta")
+	}
+	if VerifyPKCE(verifier+"x", challenge) {
+		t.Error("se aceptó un verificador distinto")
+	}
+	short := "abc"
+	sum := sha256.Sum256([]byte(short))
+	if VerifyPKCE(short, base64.RawURLEncoding.EncodeToString(sum[:])) {
+		t.Error("se aceptó un verificador de menos de 43 caracteres")
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	got, err := ParseScope("uploads profile:read uploads")
+	if err != nil || !reflect.DeepEqual(got, []string{"profile:read", "uploads"}) {
+		t.Fatalf("ParseScope = %v, %v", got, err)
+	}
+	var oauthErr *Error
+	for _, value := range []string{"", "admin"} {
+		if _, err := ParseScope(value); !errors.As(err, &oauthErr) || oauthErr.Code != InvalidScope {
+			t.Errorf("ParseScope(%q) = %v, se esperaba invalid_scope", value, err)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	granted := []string{"profile:read"}
+	tests := []struct {
+		method, route string
+		want          bool
+	}{
+		{"GET", "/api/v1/profile", true},
+		{"GET", "/api/v2/profile", true},
+		{"DELETE", "/api/v1/profile", false},
+		{"GET", "/api/v1/users", false},
+		{"GET", "/api/v1/admin/stats", false},
+		{"POST", "/graphql", false},
+	}
+	for _, tt := range tests {
+		if got := Allows(granted, tt.method, tt.route); got != tt.want {
+			t.Errorf("Allows(%s %s) = %v", tt.method, tt.route, got)
+		}
+	}
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	valid := []string{"https://app.example.com/callback", "http://localhost:8080/cb", "http://127.0.0.1/cb", "com.example.app:/oauth"}
+	invalid := []string{"", "/callback", "http://app.example.com/cb", "https://app.example.com/cb#x", "javascript:alert(1)"}
+	for _, uri := range valid {
+		if !ValidRedirectURI(uri) {
+			t.Errorf("%q debería ser válida", uri)
+		}
+	}
+	for _, uri := range invalid {
+		if ValidRedirectURI(uri) {
+			t.Errorf("%q no debería ser válida", uri)
+		}
+	}
+	if got := RedirectWith("https://app.example.com/cb?x=1", map[string]string{"code": "abc", "state": ""}); !strings.Contains(got, "code=abc") || strings.Contains(got, "state") {
+		t.Errorf("RedirectWith = %s", got)
+	}
+}
+
+func TestUserCode(t *testing.T) {
+	code := NewUserCode()
+	if len(code) != 9 || code[4] != '-' || strings.Trim(code[:4]+code[5:], userCodeAlphabet) != "" {
+		t.Errorf("NewUserCode = %q", code)
+	}
+	if got := NormalizeUserCode(" wdjb-mjht "); got != "WDJBMJHT" {
+		t.Errorf("NormalizeUserCode = %q", got)
+	}
+}
@@ -0,0 +1,274 @@
+package openapi
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Version versión de OpenAPI de la especificación generada
+const Version = "3.0.3"
+
+type object = map[string]interface{}
+
+// Convert traduce una especificación Swagger 2.0 (la que generan las anotaciones
+// de swag) a OpenAPI 3.0: servers, requestBody, content por tipo de medio y
+// components en lugar de definitions/securityDefinitions
+func Convert(swagger []byte) ([]byte, error) {
+	var in object
+	if err := json.Unmarshal(swagger, &in); err != nil {
+		return nil, err
+	}
+
+	out := object{
+		"openapi": Version,
+		"info":    in["info"],
+		"servers": servers(in),
+		"paths":   object{},
+	}
+	if tags, ok := in["tags"]; ok {
+		out["tags"] = tags
+	}
+
+	consumes := stringList(in["consumes"], "application/json")
+	produces := stringList(in["produces"], "application/json")
+
+	paths, _ := in["paths"].(object)
+	for path, item := range paths {
+		operations, _ := item.(object)
+		converted := object{}
+		for method, op := range operations {
+			if operation, ok := op.(object); ok {
+				converted[method] = convertOperation(operation, consumes, produces)
+			}
+		}
+		out["paths"].(object)[path] = converted
+	}
+
+	components := object{}
+	if definitions, ok := in["definitions"].(object); ok {
+		components["schemas"] = rewriteRefs(definitions)
+	}
+	if security, ok := in["securityDefinitions"].(object); ok {
+		components["securitySchemes"] = securitySchemes(security)
+	}
+	if len(components) > 0 {
+		out["components"] = components
+	}
+	if security, ok := in["security"]; ok {
+		out["security"] = security
+	}
+
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// servers combina schemes, host y basePath
+func servers(in object) []object {
+	host, _ := in["host"].(string)
+	basePath, _ := in["basePath"].(string)
+	if host == "" {
+		return []object{{"url": basePath}}
+	}
+	schemes := stringList(in["schemes"], "http")
+	list := make([]object, 0, len(schemes))
+	for _, scheme := range schemes {
+		list = append(list, object{"url": scheme + "://" + host + basePath})
+	}
+	return list
+}
+
+func convertOperation(op object, consumes, produces []string) object {
+	out := object{}
+	for key, value := range op {
+		switch key {
+		case "parameters", "responses", "consumes", "produces", "schemes":
+		default:
+			out[key] = value
+		}
+	}
+	consumes = stringList(op["consumes"], consumes...)
+	produces = stringList(op["produces"], produces...)
+
+	var params []interface{}
+	form := object{}
+	var formRequired []string
+	params0, _ := op["parameters"].([]interface{})
+	for _, p := range params0 {
+		param, _ := p.(object)
+		switch param["in"] {
+		case "body":
+			body := object{"content": content(consumes, rewriteRefs(param["schema"]))}
+			if required, _ := param["required"].(bool); required {
+				body["required"] = true
+			}
+			if description, ok := param["description"]; ok {
+				body["description"] = description
+			}
+			out["requestBody"] = body
+		case "formData":
+			name, _ := param["name"].(string)
+			form[name] = paramSchema(param)
+			if required, _ := param["required"].(bool); required {
+				formRequired = append(formRequired, name)
+			}
+		default:
+			params = append(params, convertParameter(param))
+		}
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+	if len(form) > 0 {
+		schema := object{"type": "object", "properties": form}
+		if len(formRequired) > 0 {
+			sort.Strings(formRequired)
+			schema["required"] = formRequired
+		}
+		mediaType := "application/x-www-form-urlencoded"
+		for _, c := range consumes {
+			if c == "multipart/form-data" {
+				mediaType = c
+			}
+		}
+		out["requestBody"] = object{"content": object{mediaType: object{"schema": schema}}}
+	}
+
+	responses := object{}
+	if in, ok := op["responses"].(object); ok {
+		for code, r := range in {
+			response, _ := r.(object)
+			converted := object{"description": response["description"]}
+			if converted["description"] == nil {
+				converted["description"] = ""
+			}
+			if schema, ok := response["schema"]; ok {
+				converted["content"] = content(produces, rewriteRefs(schema))
+			}
+			if headers, ok := response["headers"].(object); ok {
+				h := object{}
+				for name, header := range headers {
+					h[name] = object{"schema": rewriteRefs(header)}
+				}
+				converted["headers"] = h
+			}
+			responses[code] = converted
+		}
+	}
+	out["responses"] = responses
+	return out
+}
+
+// convertParameter mueve type/format/items/enum/default al schema del parámetro
+func convertParameter(param object) object {
+	out := object{"schema": paramSchema(param)}
+	for _, key := range []string{"name", "in", "description", "required"} {
+		if value, ok := param[key]; ok {
+			out[key] = value
+		}
+	}
+	if param["in"] == "path" {
+		out["required"] = true
+	}
+	return out
+}
+
+func paramSchema(param object) object {
+	schema := object{}
+	for _, key := range []string{"type", "format", "items", "enum", "default", "minimum", "maximum", "maxLength", "minLength", "pattern"} {
+		if value, ok := param[key]; ok {
+			schema[key] = rewriteRefs(value)
+		}
+	}
+	if schema["type"] == "file" {
+		schema["type"] = "string"
+		schema["format"] = "binary"
+	}
+	return schema
+}
+
+func content(mediaTypes []string, schema interface{}) object {
+	out := object{}
+	for _, mediaType := range mediaTypes {
+		out[mediaType] = object{"schema": schema}
+	}
+	return out
+}
+
+func securitySchemes(definitions object) object {
+	out := object{}
+	for name, d := range definitions {
+		def, _ := d.(object)
+		scheme := object{}
+		if description, ok := def["description"]; ok {
+			scheme["description"] = description
+		}
+		switch def["type"] {
+		case "basic":
+			scheme["type"], scheme["scheme"] = "http", "basic"
+		case "apiKey":
+			scheme["type"], scheme["name"], scheme["in"] = "apiKey", def["name"], def["in"]
+		case "oauth2":
+			flow := object{"scopes": def["scopes"]}
+			if flow["scopes"] == nil {
+				flow["scopes"] = object{}
+			}
+			for _, key := range []string{"authorizationUrl", "tokenUrl"} {
+				if value, ok := def[key]; ok {
+					flow[key] = value
+				}
+			}
+			flows := map[string]string{"implicit": "implicit", "password": "password", "application": "clientCredentials", "accessCode": "authorizationCode"}
+			flowName, _ := def["flow"].(string)
+			scheme["type"], scheme["flows"] = "oauth2", object{flows[flowName]: flow}
+		}
+		out[name] = scheme
+	}
+	return out
+}
+
+// rewriteRefs cambia las referencias #/definitions/ por #/components/schemas/ y
+// x-nullable por nullable en todo el árbol
+func rewriteRefs(value interface{}) interface{} {
+	switch v := value.(type) {
+	case object:
+		out := make(object, len(v))
+		for key, child := range v {
+			switch key {
+			case "$ref":
+				if ref, ok := child.(string); ok {
+					child = strings.Replace(ref, "#/definitions/", "#/components/schemas/", 1)
+				}
+				out[key] = child
+			case "x-nullable":
+				out["nullable"] = child
+			default:
+				out[key] = rewriteRefs(child)
+			}
+		}
+		if out["type"] == "file" {
+			out["type"], out["format"] = "string", "binary"
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = rewriteRefs(child)
+		}
+		return out
+	}
+	return value
+}
+
+func stringList(value interface{}, fallback ...string) []string {
+	list, _ := value.([]interface{})
+	if len(list) == 0 {
+		return fallback
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const swagger = `{
+  "swagger": "2.0",
+  "info": {"title": "API", "version": "1.0"},
+  "host": "localhost:8080",
+  "basePath": "/api/v1",
+  "securityDefinitions": {"BearerAuth": {"type": "apiKey", "name": "Authorization", "in": "header"}},
+  "paths": {
+    "/users/{id}": {
+      "put": {
+        "consumes": ["application/json"],
+        "parameters": [
+          {"name": "id", "in": "path", "type": "integer", "required": true},
+          {"name": "user", "in": "body", "required": true, "schema": {"$ref": "#/definitions/handlers.UpdateUserRequest"}}
+        ],
+        "responses": {"200": {"description": "OK", "schema": {"$ref": "#/definitions/database.User"}}}
+      }
+    },
+    "/profile/avatar": {
+      "post": {
+        "consumes": ["multipart/form-data"],
+        "parameters": [{"name": "avatar", "in": "formData", "type": "file", "required": true}],
+        "responses": {"204": {"description": "No Content"}}
+      }
+    }
+  },
+  "definitions": {
+    "database.User": {"type": "object", "properties": {"plan": {"$ref": "#/definitions/database.Plan", "x-nullable": true}}}
+  }
+}`
+
+func TestConvert(t *testing.T) {
+	out, err := Convert([]byte(swagger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		OpenAPI    string                       `json:"openapi"`
+		Servers    []map[string]string          `json:"servers"`
+		Paths      map[string]map[string]object `json:"paths"`
+		Components struct {
+			Schemas         object `json:"schemas"`
+			SecuritySchemes object `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(out, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.OpenAPI != Version {
+		t.Errorf("openapi = %q, se esperaba %q", spec.OpenAPI, Version)
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0]["url"] != "http://localhost:8080/api/v1" {
+		t.Errorf("servers = %v", spec.Servers)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want string
+	}{
+		{"parámetro de ruta", spec.Paths["/users/{id}"]["put"]["parameters"],
+			`[{"in":"path","name":"id","required":true,"schema":{"type":"integer"}}]`},
+		{"cuerpo JSON", spec.Paths["/users/{id}"]["put"]["requestBody"],
+			`{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/handlers.UpdateUserRequest"}}},"required":true}`},
+		{"respuesta", spec.Paths["/users/{id}"]["put"]["responses"],
+			`{"200":{"content":{"application/json":{"schema":{"$ref":"#/components/schemas/database.User"}}},"description":"OK"}}`},
+		{"formulario con archivo", spec.Paths["/profile/avatar"]["post"]["requestBody"],
+			`{"content":{"multipart/form-data":{"schema":{"properties":{"avatar":{"format":"binary","type":"string"}},"required":["avatar"],"type":"object"}}}}`},
+		{"respuesta sin cuerpo", spec.Paths["/profile/avatar"]["post"]["responses"],
+			`{"204":{"description":"No Content"}}`},
+		{"schemas", spec.Components.Schemas,
+			`{"database.User":{"properties":{"plan":{"$ref":"#/components/schemas/database.Plan","nullable":true}},"type":"object"}}`},
+		{"seguridad", spec.Components.SecuritySchemes,
+			`{"BearerAuth":{"in":"header","name":"Authorization","type":"apiKey"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := json.Marshal(tt.got)
+			if string(got) != tt.want {
+				t.Errorf("%s\nse esperaba %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// Command gen genera openapi/openapi.json a partir de las anotaciones de swag
+//
+//	go generate ./openapi
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"api/openapi"
+
+	"github.com/swaggo/swag"
+)
+
+func main() {
+	root := "."
+	if len(os.Args) > 1 {
+		root = os.Args[1]
+	}
+
+	parser := swag.New(swag.SetParseDependency(1))
+	if err := parser.ParseAPI(root, "main.go", 100); err != nil {
+		log.Fatalf("❌ Error leyendo las anotaciones: %v", err)
+	}
+	swagger, err := json.Marshal(parser.GetSwagger())
+	if err != nil {
+		log.Fatalf("❌ Error serializando Swagger: %v", err)
+	}
+
+	spec, err := openapi.Convert(swagger)
+	if err != nil {
+		log.Fatalf("❌ Error convirtiendo a OpenAPI 3: %v", err)
+	}
+	out := filepath.Join(root, "openapi", "openapi.json")
+	if err := os.WriteFile(out, append(spec, '\n'), 0o644); err != nil {
+		log.Fatalf("❌ Error escribiendo %s: %v", out, err)
+	}
+	log.Printf("✅ Especificación OpenAPI %s generada en %s", openapi.Version, out)
+}
@@ -0,0 +1,26 @@
+// Package openapi sirve la especificación OpenAPI 3 de la API, generada a partir
+// de las mismas anotaciones de swag que la documentación Swagger
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:generate go run ./gen ..
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec especificación OpenAPI 3 en JSON
+func Spec() []byte {
+	return spec
+}
+
+// Handler devuelve la especificación en JSON
+func Handler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+}
@@ -0,0 +1,82 @@
+package plans
+
+import (
+	"context"
+	"errors"
+
+	"api/database"
+
+	"gorm.io/gorm"
+)
+
+// Planes predefinidos
+const (
+	Free       = "free"
+	Pro        = "pro"
+	Enterprise = "enterprise"
+)
+
+// Funciones que pueden incluir los planes
+const (
+	FeatureAPIKeys         = "api_keys"
+	FeatureBulkExport      = "bulk_export"
+	FeaturePrioritySupport = "priority_support"
+)
+
+// defaults planes creados al arrancar si todavía no existen; después se
+// gestionan desde /admin/plans
+var defaults = []database.Plan{
+	{Code: Free, Name: "Free", Features: []string{}},
+	{Code: Pro, Name: "Pro", Features: []string{FeatureAPIKeys, FeatureBulkExport}},
+	{Code: Enterprise, Name: "Enterprise", Features: []string{FeatureAPIKeys, FeatureBulkExport, FeaturePrioritySupport}},
+}
+
+// Seed crea los planes predefinidos que falten
+func Seed(ctx context.Context) error {
+	db := database.DB.WithContext(ctx)
+	for _, plan := range defaults {
+		plan := plan
+		if err := db.Where("code = ?", plan.Code).FirstOrCreate(&plan).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForUser devuelve el plan del usuario; si no tiene uno válido se aplica el gratuito
+func ForUser(ctx context.Context, userID uint) (*database.Plan, error) {
+	db := database.DB.WithContext(ctx)
+	var user database.User
+	if err := db.Select("id", "plan_code").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var plan database.Plan
+	err := db.Where("code = ?", user.PlanCode).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) && user.PlanCode != Free {
+		err = db.Where("code = ?", Free).First(&plan).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// HasFeature indica si el plan del usuario incluye la función indicada
+func HasFeature(ctx context.Context, userID uint, feature string) bool {
+	plan, err := ForUser(ctx, userID)
+	return err == nil && plan.HasFeature(feature)
+}
+
+// Assign cambia el plan del usuario
+func Assign(ctx context.Context, userID uint, code string) error {
+	db := database.DB.WithContext(ctx)
+	var count int64
+	if err := db.Model(&database.Plan{}).Where("code = ?", code).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return db.Model(&database.User{}).Where("id = ?", userID).UpdateColumn("plan_code", code).Error
+}
@@ -0,0 +1,267 @@
+// Package postman genera una colección de Postman (formato v2.1, que también
+// importa Insomnia) a partir de las rutas registradas y la especificación OpenAPI
+package postman
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"api/links"
+)
+
+// Schema formato de la colección
+const Schema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// loginScript guarda el token de la respuesta del login en la variable {{token}}
+var loginScript = []string{
+	"const body = pm.response.json();",
+	"if (body.token) { pm.collectionVariables.set(\"token\", body.token); }",
+}
+
+type Collection struct {
+	Info     Info       `json:"info"`
+	Auth     *Auth      `json:"auth,omitempty"`
+	Variable []Variable `json:"variable,omitempty"`
+	Item     []Item     `json:"item"`
+}
+
+type Info struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+type Auth struct {
+	Type   string     `json:"type"`
+	Bearer []Variable `json:"bearer,omitempty"`
+}
+
+type Variable struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Type     string `json:"type,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// Item carpeta (con Item) o petición (con Request)
+type Item struct {
+	Name    string   `json:"name"`
+	Item    []Item   `json:"item,omitempty"`
+	Request *Request `json:"request,omitempty"`
+	Event   []Event  `json:"event,omitempty"`
+}
+
+type Request struct {
+	Method      string     `json:"method"`
+	Description string     `json:"description,omitempty"`
+	Auth        *Auth      `json:"auth,omitempty"`
+	Header      []Variable `json:"header"`
+	URL         URL        `json:"url"`
+	Body        *Body      `json:"body,omitempty"`
+}
+
+type URL struct {
+	Raw      string     `json:"raw"`
+	Host     []string   `json:"host"`
+	Path     []string   `json:"path"`
+	Query    []Variable `json:"query,omitempty"`
+	Variable []Variable `json:"variable,omitempty"`
+}
+
+type Body struct {
+	Mode     string      `json:"mode"`
+	Raw      string      `json:"raw,omitempty"`
+	FormData []FormField `json:"formdata,omitempty"`
+	Options  interface{} `json:"options,omitempty"`
+}
+
+type FormField struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+type Event struct {
+	Listen string `json:"listen"`
+	Script Script `json:"script"`
+}
+
+type Script struct {
+	Type string   `json:"type"`
+	Exec []string `json:"exec"`
+}
+
+type object = map[string]interface{}
+
+// Build genera la colección con las rutas de base (p. ej. /api/v1); baseURL es el
+// valor inicial de la variable {{baseUrl}}. Las peticiones usan el token de
+// {{token}}, que el login rellena automáticamente.
+func Build(name string, routes []links.Route, base, baseURL string, openAPI []byte) (*Collection, error) {
+	var spec struct {
+		Paths      map[string]map[string]object `json:"paths"`
+		Components struct {
+			Schemas map[string]object `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPI, &spec); err != nil {
+		return nil, err
+	}
+
+	folders := map[string][]Item{}
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, base+"/") {
+			continue
+		}
+		path := strings.TrimPrefix(route.Path, base)
+		op := spec.Paths[specPath(path)][strings.ToLower(route.Method)]
+
+		item := Item{Name: route.Method + " " + path, Request: request(route.Method, path, op, spec.Components.Schemas)}
+		if summary, ok := op["summary"].(string); ok && summary != "" {
+			item.Name = summary
+		}
+		if route.Method == "POST" && path == "/auth/login" {
+			item.Event = []Event{{Listen: "test", Script: Script{Type: "text/javascript", Exec: loginScript}}}
+		}
+
+		folder := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+		if tags, ok := op["tags"].([]interface{}); ok && len(tags) > 0 {
+			folder, _ = tags[0].(string)
+		}
+		folders[folder] = append(folders[folder], item)
+	}
+
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]Item, 0, len(names))
+	for _, name := range names {
+		items = append(items, Item{Name: name, Item: folders[name]})
+	}
+
+	return &Collection{
+		Info: Info{
+			Name:        name,
+			Description: "Colección generada a partir de las rutas de la API. Inicia sesión con \"Iniciar sesión\" para rellenar {{token}} o pon una API key en {{apiKey}} y cambia la autenticación de la colección a API Key.",
+			Schema:      Schema,
+		},
+		Auth: &Auth{Type: "bearer", Bearer: []Variable{{Key: "token", Value: "{{token}}", Type: "string"}}},
+		Variable: []Variable{
+			{Key: "baseUrl", Value: baseURL},
+			{Key: "token", Value: ""},
+			{Key: "apiKey", Value: ""},
+		},
+		Item: items,
+	}, nil
+}
+
+func request(method, path string, op object, schemas map[string]object) *Request {
+	req := &Request{Method: method, Header: []Variable{}}
+	req.Description, _ = op["description"].(string)
+	// Las operaciones documentadas sin seguridad son públicas (registro, login...)
+	if op != nil && op["security"] == nil {
+		req.Auth = &Auth{Type: "noauth"}
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = ":" + segment[1:]
+			req.URL.Variable = append(req.URL.Variable, Variable{Key: segment[1:], Value: ""})
+		}
+	}
+	req.URL.Host = []string{"{{baseUrl}}"}
+	req.URL.Path = segments
+
+	params, _ := op["parameters"].([]interface{})
+	for _, p := range params {
+		param, _ := p.(object)
+		name, _ := param["name"].(string)
+		switch param["in"] {
+		case "query":
+			req.URL.Query = append(req.URL.Query, Variable{Key: name, Value: "", Disabled: true})
+		case "header":
+			req.Header = append(req.Header, Variable{Key: name, Value: "", Disabled: true})
+		}
+	}
+	req.URL.Raw = "{{baseUrl}}/" + strings.Join(segments, "/")
+
+	content, _ := op["requestBody"].(object)
+	content, _ = content["content"].(object)
+	if media, ok := content["application/json"].(object); ok {
+		raw, _ := json.MarshalIndent(example(media["schema"], schemas, 0), "", "  ")
+		req.Header = append(req.Header, Variable{Key: "Content-Type", Value: "application/json"})
+		req.Body = &Body{Mode: "raw", Raw: string(raw), Options: object{"raw": object{"language": "json"}}}
+	} else if media, ok := content["multipart/form-data"].(object); ok {
+		req.Body = &Body{Mode: "formdata"}
+		schema, _ := media["schema"].(object)
+		properties, _ := schema["properties"].(object)
+		for _, name := range sortedKeys(properties) {
+			field := FormField{Key: name, Type: "text"}
+			if property, _ := properties[name].(object); property["format"] == "binary" {
+				field.Type = "file"
+			}
+			req.Body.FormData = append(req.Body.FormData, field)
+		}
+	}
+	return req
+}
+
+// example genera un cuerpo de ejemplo a partir del schema, con los valores de
+// example/enum/default cuando existen y valores vacíos del tipo en otro caso
+func example(s interface{}, schemas map[string]object, depth int) interface{} {
+	schema, _ := s.(object)
+	if ref, ok := schema["$ref"].(string); ok {
+		if depth > 5 {
+			return object{}
+		}
+		return example(schemas[strings.TrimPrefix(ref, "#/components/schemas/")], schemas, depth+1)
+	}
+	if value, ok := schema["example"]; ok {
+		return value
+	}
+	if value, ok := schema["default"]; ok {
+		return value
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	switch schema["type"] {
+	case "string":
+		return ""
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	case "array":
+		return []interface{}{example(schema["items"], schemas, depth+1)}
+	}
+	out := object{}
+	properties, _ := schema["properties"].(object)
+	for name, property := range properties {
+		out[name] = example(property, schemas, depth+1)
+	}
+	return out
+}
+
+// specPath convierte /users/:id en /users/{id}, como en la especificación
+func specPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func sortedKeys(m object) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+// Package preferences define las preferencias de usuario que guarda la API
+// (tema, tamaño de página, frecuencia de correos...): su tipo, su valor por
+// defecto y cómo se validan. Los clientes las leen y modifican en
+// /profile/settings; se añaden más con Register.
+package preferences
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Preference preferencia de usuario
+type Preference struct {
+	Name        string
+	Description string
+	Default     interface{}
+	// Parse valida el valor JSON recibido y lo devuelve con su tipo Go
+	Parse func(raw json.RawMessage) (interface{}, error)
+}
+
+// Error valor de preferencia rechazado
+type Error struct {
+	Name   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("preferencia %s: %s", e.Name, e.Reason)
+}
+
+var (
+	mu          sync.RWMutex
+	preferences = map[string]Preference{}
+)
+
+func init() {
+	Register(Preference{
+		Name:        "theme",
+		Description: "Tema de la interfaz",
+		Default:     "system",
+		Parse:       OneOf("light", "dark", "system"),
+	})
+	Register(Preference{
+		Name:        "page_size",
+		Description: "Elementos por página en los listados",
+		Default:     20,
+		Parse:       IntRange(5, 100),
+	})
+	Register(Preference{
+		Name:        "email_frequency",
+		Description: "Frecuencia de los correos de novedades",
+		Default:     "weekly",
+		Parse:       OneOf("instant", "daily", "weekly", "never"),
+	})
+}
+
+// Register añade una preferencia
+func Register(p Preference) {
+	mu.Lock()
+	defer mu.Unlock()
+	preferences[p.Name] = p
+}
+
+// List devuelve las preferencias registradas ordenadas por nombre
+func List() []Preference {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]Preference, 0, len(preferences))
+	for _, p := range preferences {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Defaults devuelve el valor por defecto de cada preferencia
+func Defaults() map[string]interface{} {
+	mu.RLock()
+	defer mu.RUnlock()
+	values := make(map[string]interface{}, len(preferences))
+	for name, p := range preferences {
+		values[name] = p.Default
+	}
+	return values
+}
+
+// Merge aplica changes sobre los valores guardados y devuelve el resultado sin
+// modificar stored. Un valor null vuelve al valor por defecto (se quita de los
+// guardados); las preferencias desconocidas y los valores inválidos se rechazan.
+func Merge(stored map[string]interface{}, changes map[string]json.RawMessage) (map[string]interface{}, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	merged := make(map[string]interface{}, len(stored)+len(changes))
+	for name, value := range stored {
+		merged[name] = value
+	}
+	for name, raw := range changes {
+		p, ok := preferences[name]
+		if !ok {
+			return nil, &Error{Name: name, Reason: "no existe"}
+		}
+		if string(raw) == "null" {
+			delete(merged, name)
+			continue
+		}
+		value, err := p.Parse(raw)
+		if err != nil {
+			return nil, &Error{Name: name, Reason: err.Error()}
+		}
+		merged[name] = value
+	}
+	return merged, nil
+}
+
+// Effective completa los valores guardados con los valores por defecto; los
+// guardados de preferencias que ya no existen se ignoran
+func Effective(stored map[string]interface{}) map[string]interface{} {
+	values := Defaults()
+	for name, value := range stored {
+		if _, ok := values[name]; ok {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// OneOf acepta una cadena de entre las indicadas
+func OneOf(options ...string) func(json.RawMessage) (interface{}, error) {
+	return func(raw json.RawMessage) (interface{}, error) {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("debe ser una cadena")
+		}
+		for _, o := range options {
+			if s == o {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("debe ser uno de %v", options)
+	}
+}
+
+// IntRange acepta un entero entre min y max, ambos incluidos
+func IntRange(min, max int) func(json.RawMessage) (interface{}, error) {
+	return func(raw json.RawMessage) (interface{}, error) {
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("debe ser un número entero")
+		}
+		if n < min || n > max {
+			return nil, fmt.Errorf("debe estar entre %d y %d", min, max)
+		}
+		return n, nil
+	}
+}
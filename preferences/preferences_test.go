@@ -0,0 +1,66 @@
+package preferences
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	stored := map[string]interface{}{"theme": "dark", "page_size": 50}
+
+	tests := []struct {
+		name    string
+		changes string
+		want    map[string]interface{}
+		invalid string
+	}{
+		{"cambia un valor", `{"theme": "light"}`, map[string]interface{}{"theme": "light", "page_size": 50}, ""},
+		{"null vuelve al defecto", `{"page_size": null}`, map[string]interface{}{"theme": "dark"}, ""},
+		{"añade otra", `{"email_frequency": "never"}`, map[string]interface{}{"theme": "dark", "page_size": 50, "email_frequency": "never"}, ""},
+		{"opción desconocida", `{"theme": "rosa"}`, nil, "theme"},
+		{"tipo incorrecto", `{"page_size": "50"}`, nil, "page_size"},
+		{"fuera de rango", `{"page_size": 1000}`, nil, "page_size"},
+		{"preferencia desconocida", `{"idioma": "es"}`, nil, "idioma"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(tt.changes), &changes); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Merge(stored, changes)
+			if tt.invalid != "" {
+				var perr *Error
+				if !errors.As(err, &perr) || perr.Name != tt.invalid {
+					t.Fatalf("error = %v, se esperaba uno de %s", err, tt.invalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Merge = %v, se esperaba %v", got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %v, se esperaba %v", k, got[k], v)
+				}
+			}
+		})
+	}
+	if stored["theme"] != "dark" || len(stored) != 2 {
+		t.Errorf("Merge modificó los valores guardados: %v", stored)
+	}
+}
+
+func TestEffective(t *testing.T) {
+	got := Effective(map[string]interface{}{"theme": "dark", "retirada": true})
+	if got["theme"] != "dark" || got["page_size"] != 20 || got["email_frequency"] != "weekly" {
+		t.Errorf("Effective = %v", got)
+	}
+	if _, ok := got["retirada"]; ok {
+		t.Error("Effective incluye una preferencia que no existe")
+	}
+}
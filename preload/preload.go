@@ -0,0 +1,118 @@
+// Package preload carga en bloque las relaciones de los recursos de una
+// respuesta (?include=plan,profile): una consulta por relación para todo el
+// listado en lugar de una por fila. Los paquetes que conocen cada relación la
+// registran con Register y cada endpoint declara cuáles admite.
+package preload
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Fetch carga la relación de los recursos con esos IDs; los que no la tienen
+// se quedan fuera del mapa
+type Fetch func(ctx context.Context, ids []uint) (map[uint]interface{}, error)
+
+// Relation relación de un tipo de recurso
+type Relation struct {
+	Fetch Fetch
+	// Solo la pueden pedir los administradores (datos personales)
+	AdminOnly bool
+}
+
+// UnknownError relación pedida que el endpoint no admite
+type UnknownError struct {
+	Name string
+}
+
+func (e *UnknownError) Error() string {
+	return fmt.Sprintf("relación no admitida: %s", e.Name)
+}
+
+var (
+	mu        sync.RWMutex
+	relations = map[string]map[string]Relation{}
+)
+
+// Register añade la relación name a los recursos de tipo resource (users...)
+func Register(resource, name string, relation Relation) {
+	mu.Lock()
+	defer mu.Unlock()
+	if relations[resource] == nil {
+		relations[resource] = map[string]Relation{}
+	}
+	relations[resource][name] = relation
+}
+
+// Parse lee la lista separada por comas de ?include= y comprueba que cada
+// relación esté entre las admitidas por el endpoint y registrada, y que el
+// usuario pueda pedirla
+func Parse(resource, include string, admin bool, allowed ...string) ([]string, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(include, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		relation, registered := relations[resource][name]
+		if !registered || !contains(allowed, name) || relation.AdminOnly && !admin {
+			return nil, &UnknownError{Name: name}
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Set relaciones cargadas: por nombre y por ID del recurso
+type Set map[string]map[uint]interface{}
+
+// For relaciones de un recurso; nil si no se pidió ninguna. Las relaciones
+// pedidas que el recurso no tiene aparecen como null.
+func (s Set) For(id uint) map[string]interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+	result := make(map[string]interface{}, len(s))
+	for name, values := range s {
+		result[name] = values[id]
+	}
+	return result
+}
+
+// Load carga las relaciones names de los recursos ids, una consulta por relación
+func Load(ctx context.Context, resource string, names []string, ids []uint) (Set, error) {
+	if len(names) == 0 || len(ids) == 0 {
+		return nil, nil
+	}
+	mu.RLock()
+	fetches := make(map[string]Fetch, len(names))
+	for _, name := range names {
+		fetches[name] = relations[resource][name].Fetch
+	}
+	mu.RUnlock()
+
+	set := make(Set, len(names))
+	for name, fetch := range fetches {
+		values, err := fetch(ctx, ids)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		set[name] = values
+	}
+	return set, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
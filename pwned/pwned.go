@@ -0,0 +1,97 @@
+// Package pwned comprueba si una contraseña aparece en las filtraciones
+// recopiladas por Have I Been Pwned con su API de rangos (k-anonimato): solo
+// se envían los 5 primeros caracteres del SHA-1 de la contraseña y el resto se
+// busca entre los sufijos que devuelve el servicio.
+package pwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/breaker"
+)
+
+const (
+	defaultURL     = "https://api.pwnedpasswords.com/range/"
+	defaultTimeout = 3 * time.Second
+)
+
+// El tiempo máximo de cada consulta lo pone Count con PWNED_PASSWORDS_TIMEOUT
+var client = &http.Client{Transport: breaker.Transport("pwned", nil)}
+
+// Enabled indica si se comprueban las contraseñas (PWNED_PASSWORDS=true)
+func Enabled() bool {
+	return os.Getenv("PWNED_PASSWORDS") == "true"
+}
+
+// FailClosed indica si se rechaza la contraseña cuando el servicio no responde
+// (PWNED_PASSWORDS_FAIL=closed); por defecto se acepta sin comprobar
+func FailClosed() bool {
+	return strings.ToLower(os.Getenv("PWNED_PASSWORDS_FAIL")) == "closed"
+}
+
+// timeout tiempo máximo de la consulta (PWNED_PASSWORDS_TIMEOUT, 3 s por defecto)
+func timeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("PWNED_PASSWORDS_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultTimeout
+}
+
+// rangeURL URL de la API de rangos; PWNED_PASSWORDS_URL la sustituye (réplica
+// propia del conjunto de datos o pruebas)
+func rangeURL() string {
+	if u := os.Getenv("PWNED_PASSWORDS_URL"); u != "" {
+		return strings.TrimRight(u, "/") + "/"
+	}
+	return defaultURL
+}
+
+// Count devuelve cuántas veces aparece la contraseña en las filtraciones
+// conocidas (0 si en ninguna)
+func Count(ctx context.Context, password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	ctx, cancel := context.WithTimeout(ctx, timeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rangeURL()+prefix, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Con relleno todas las respuestas tienen un tamaño parecido y no delatan
+	// el prefijo consultado; las entradas de relleno tienen 0 apariciones
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("consulta de contraseñas filtradas: estado %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return 0, fmt.Errorf("consulta de contraseñas filtradas: %w", err)
+		}
+		return n, nil
+	}
+	return 0, scanner.Err()
+}
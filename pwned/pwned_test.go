@@ -0,0 +1,54 @@
+package pwned
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCount(t *testing.T) {
+	// SHA-1 de "password": 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Error("falta la cabecera Add-Padding")
+		}
+		if !strings.HasSuffix(r.URL.Path, "/5BAA6") {
+			fmt.Fprint(w, "0018A45C4D1DEF81644B54AB7F969B88D65:0\r\n")
+			return
+		}
+		fmt.Fprint(w, "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n")
+	}))
+	defer srv.Close()
+	t.Setenv("PWNED_PASSWORDS_URL", srv.URL)
+
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"password", 9659365},
+		{"Xq7!vR2#mLp9", 0},
+	}
+	for _, tt := range tests {
+		got, err := Count(context.Background(), tt.password)
+		if err != nil || got != tt.want {
+			t.Errorf("Count(%q) = %d, %v; se esperaba %d", tt.password, got, err, tt.want)
+		}
+	}
+}
+
+func TestCountTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+	t.Setenv("PWNED_PASSWORDS_URL", srv.URL)
+	t.Setenv("PWNED_PASSWORDS_TIMEOUT", "20ms")
+
+	if _, err := Count(context.Background(), "password"); err == nil {
+		t.Error("se esperaba error por timeout")
+	}
+}
@@ -0,0 +1,77 @@
+package quotas
+
+import (
+	"context"
+
+	"api/database"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	Register(Definition{
+		Name:        RequestsPerDay,
+		Description: "Peticiones a la API por día (se reinicia a medianoche UTC; solo se cuentan mientras la cuota tiene límite)",
+		Scope:       ScopeUser,
+		Meter:       CounterMeter(ScopeUser, RequestsPerDay, Today),
+		Window:      Today,
+	})
+	Register(Definition{
+		Name:        StorageBytes,
+		Description: "Bytes de almacenamiento ocupados por las subidas (incluye las reservadas en curso)",
+		Scope:       ScopeUser,
+		Meter: func(ctx context.Context, userID uint) (int64, error) {
+			return storageUsed(database.DB.WithContext(ctx), func(db *gorm.DB) *gorm.DB {
+				return db.Where("user_id = ?", userID)
+			})
+		},
+	})
+
+	Register(Definition{
+		Name:        RequestsPerMinute,
+		Description: "Peticiones a la API por minuto de todos los clientes del tenant (se reinicia cada minuto UTC; solo se cuentan mientras la cuota tiene límite)",
+		Scope:       ScopeTenant,
+		Meter:       CounterMeter(ScopeTenant, RequestsPerMinute, ThisMinute),
+		Window:      ThisMinute,
+	})
+	Register(Definition{
+		Name:        UsersPerOrg,
+		Description: "Usuarios del tenant, activos o no (las cuentas eliminadas no cuentan)",
+		Scope:       ScopeTenant,
+		Meter: func(ctx context.Context, tenantID uint) (int64, error) {
+			ctx, err := tenantContext(ctx, tenantID)
+			if err != nil {
+				return 0, err
+			}
+			var count int64
+			err = database.DB.WithContext(ctx).Model(&database.User{}).Count(&count).Error
+			return count, err
+		},
+	})
+	Register(Definition{
+		Name:        StorageBytes,
+		Description: "Bytes de almacenamiento ocupados por las subidas de todos los usuarios del tenant (incluye las reservadas en curso)",
+		Scope:       ScopeTenant,
+		Meter: func(ctx context.Context, tenantID uint) (int64, error) {
+			ctx, err := tenantContext(ctx, tenantID)
+			if err != nil {
+				return 0, err
+			}
+			return storageUsed(database.DB.WithContext(ctx), func(db *gorm.DB) *gorm.DB { return db })
+		},
+	})
+}
+
+// storageUsed suma las subidas en curso o completadas que cumplen filter
+func storageUsed(db *gorm.DB, filter func(*gorm.DB) *gorm.DB) (int64, error) {
+	var sessions, direct int64
+	if err := db.Model(&database.UploadSession{}).Scopes(filter).
+		Where("status IN ?", []string{"pending", "completing", "completed"}).
+		Select("COALESCE(SUM(total_size), 0)").Scan(&sessions).Error; err != nil {
+		return 0, err
+	}
+	err := db.Model(&database.DirectUpload{}).Scopes(filter).
+		Where("purpose = ? AND status IN ?", "attachment", []string{"pending", "confirmed"}).
+		Select("COALESCE(SUM(size), 0)").Scan(&direct).Error
+	return sessions + direct, err
+}
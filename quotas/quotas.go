@@ -0,0 +1,283 @@
+package quotas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ámbitos a los que se puede aplicar una cuota. Los límites y contadores del
+// ámbito tenant (TENANCY=schema) se guardan en el esquema public, donde los
+// ajustan los administradores de la plataforma; su ID es el del tenant.
+const (
+	ScopeUser   = "user"
+	ScopeTenant = "tenant"
+)
+
+// Cuotas predefinidas
+const (
+	RequestsPerDay    = "requests_per_day"
+	RequestsPerMinute = "requests_per_minute"
+	StorageBytes      = "storage_bytes"
+	UsersPerOrg       = "users_per_org"
+)
+
+// ErrUnknownQuota la cuota solicitada no está registrada para ese ámbito
+var ErrUnknownQuota = errors.New("cuota desconocida")
+
+// Definition describe una cuota y cómo medir su consumo actual
+type Definition struct {
+	Name        string
+	Description string
+	Scope       string
+	// Meter devuelve el consumo actual del ámbito indicado
+	Meter func(ctx context.Context, scopeID uint) (int64, error)
+	// Window devuelve la ventana actual de las cuotas de consumo que se
+	// cuentan con Consume (p. ej. el día UTC); vacío en las de ocupación
+	Window func() string
+}
+
+// Default devuelve el límite por defecto configurado con QUOTA_<NOMBRE> en el
+// ámbito user (p. ej. QUOTA_REQUESTS_PER_DAY=10000) y QUOTA_<ÁMBITO>_<NOMBRE>
+// en los demás (p. ej. QUOTA_TENANT_USERS_PER_ORG=50); 0 significa sin límite.
+func (d Definition) Default() int64 {
+	key := "QUOTA_" + strings.ToUpper(d.Name)
+	if d.Scope != ScopeUser {
+		key = "QUOTA_" + strings.ToUpper(d.Scope) + "_" + strings.ToUpper(d.Name)
+	}
+	n, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// Status estado de una cuota para un ámbito concreto
+type Status struct {
+	Quota      string `json:"quota"`
+	Limit      int64  `json:"limit"`
+	Used       int64  `json:"used"`
+	Remaining  int64  `json:"remaining"`
+	Overridden bool   `json:"overridden"`
+}
+
+// Unlimited indica si la cuota no tiene límite
+func (s Status) Unlimited() bool {
+	return s.Limit == 0
+}
+
+var (
+	mu          sync.RWMutex
+	definitions = map[string]Definition{}
+)
+
+// Register añade una cuota; el mismo nombre puede repetirse en otro ámbito
+func Register(d Definition) {
+	mu.Lock()
+	defer mu.Unlock()
+	definitions[d.Scope+"/"+d.Name] = d
+}
+
+// Definitions devuelve las cuotas registradas para el ámbito, ordenadas por nombre
+func Definitions(scope string) []Definition {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := []Definition{}
+	for _, d := range definitions {
+		if d.Scope == scope {
+			list = append(list, d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func lookup(scope, name string) (Definition, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := definitions[scope+"/"+name]
+	if !ok {
+		return Definition{}, ErrUnknownQuota
+	}
+	return d, nil
+}
+
+// scopeContext contexto de los límites y contadores del ámbito: los del
+// ámbito tenant están en el esquema public
+func scopeContext(ctx context.Context, scope string) context.Context {
+	if scope == ScopeTenant {
+		return tenancy.With(ctx, "")
+	}
+	return ctx
+}
+
+// tenantContext contexto del esquema del tenant id, para medir su consumo
+func tenantContext(ctx context.Context, id uint) (context.Context, error) {
+	var tenant database.Tenant
+	if err := database.DB.WithContext(tenancy.With(ctx, "")).Select("slug").First(&tenant, id).Error; err != nil {
+		return nil, err
+	}
+	return tenancy.With(ctx, tenant.Slug), nil
+}
+
+// Get calcula el límite efectivo y el consumo actual de una cuota
+func Get(ctx context.Context, scope string, scopeID uint, name string) (Status, error) {
+	d, err := lookup(scope, name)
+	if err != nil {
+		return Status{}, err
+	}
+
+	status, err := limit(ctx, d, scope, scopeID)
+	if err != nil {
+		return Status{}, err
+	}
+	if status.Unlimited() && !status.Overridden {
+		return status, nil
+	}
+	if status.Used, err = d.Meter(ctx, scopeID); err != nil {
+		return Status{}, err
+	}
+	if status.Limit > status.Used {
+		status.Remaining = status.Limit - status.Used
+	}
+	return status, nil
+}
+
+// limit devuelve el límite efectivo: el personalizado o el valor por defecto
+func limit(ctx context.Context, d Definition, scope string, scopeID uint) (Status, error) {
+	status := Status{Quota: d.Name, Limit: d.Default()}
+	var override database.Quota
+	err := database.DB.WithContext(scopeContext(ctx, scope)).Where("scope = ? AND scope_id = ? AND name = ?", scope, scopeID, d.Name).First(&override).Error
+	if err == nil {
+		status.Limit, status.Overridden = override.Limit, true
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Status{}, err
+	}
+	return status, nil
+}
+
+// Check comprueba si el ámbito puede consumir delta unidades más de la cuota
+func Check(ctx context.Context, scope string, scopeID uint, name string, delta int64) (Status, bool, error) {
+	status, err := Get(ctx, scope, scopeID, name)
+	if err != nil {
+		return Status{}, false, err
+	}
+	return status, status.Unlimited() || status.Used+delta <= status.Limit, nil
+}
+
+// Consume suma delta al contador compartido de una cuota de consumo y
+// comprueba el límite con el valor resultante. El contador está en la base de
+// datos, por lo que el límite se respeta con varias instancias de la API. Solo
+// se cuenta mientras la cuota tiene límite.
+func Consume(ctx context.Context, scope string, scopeID uint, name string, delta int64) (Status, bool, error) {
+	d, err := lookup(scope, name)
+	if err != nil {
+		return Status{}, false, err
+	}
+	if d.Window == nil {
+		return Status{}, false, fmt.Errorf("%w: %s no es una cuota de consumo", ErrUnknownQuota, name)
+	}
+
+	status, err := limit(ctx, d, scope, scopeID)
+	if err != nil || status.Unlimited() {
+		return status, true, err
+	}
+
+	counter := database.QuotaCounter{Scope: scope, ScopeID: scopeID, Name: name, Period: d.Window(), Count: delta}
+	where := "scope = ? AND scope_id = ? AND name = ? AND period = ?"
+	allowed := true
+	err = database.DB.WithContext(scopeContext(ctx, scope)).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "scope"}, {Name: "scope_id"}, {Name: "name"}, {Name: "period"}},
+			DoUpdates: clause.Set{{Column: clause.Column{Name: "count"}, Value: gorm.Expr("quota_counters.count + ?", delta)}},
+		}).Create(&counter).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&database.QuotaCounter{}).Where(where, scope, scopeID, name, counter.Period).
+			Select("count").Scan(&status.Used).Error; err != nil {
+			return err
+		}
+		// Lo rechazado no consume cuota
+		if status.Used > status.Limit {
+			allowed = false
+			status.Used -= delta
+			return tx.Model(&database.QuotaCounter{}).Where(where, scope, scopeID, name, counter.Period).
+				UpdateColumn("count", gorm.Expr("count - ?", delta)).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return Status{}, false, err
+	}
+	if status.Limit > status.Used {
+		status.Remaining = status.Limit - status.Used
+	}
+	return status, allowed, nil
+}
+
+// CounterMeter devuelve un medidor que lee el contador compartido de la
+// ventana actual de una cuota de consumo
+func CounterMeter(scope, name string, window func() string) func(ctx context.Context, scopeID uint) (int64, error) {
+	return func(ctx context.Context, scopeID uint) (int64, error) {
+		var used int64
+		err := database.DB.WithContext(scopeContext(ctx, scope)).Model(&database.QuotaCounter{}).
+			Where("scope = ? AND scope_id = ? AND name = ? AND period = ?", scope, scopeID, name, window()).
+			Select("COALESCE(SUM(count), 0)").Scan(&used).Error
+		return used, err
+	}
+}
+
+// Set fija un límite personalizado (0 = sin límite) para el ámbito
+func Set(ctx context.Context, scope string, scopeID uint, name string, limit int64) error {
+	if _, err := lookup(scope, name); err != nil {
+		return err
+	}
+	return database.DB.WithContext(scopeContext(ctx, scope)).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "scope_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"quota_limit", "updated_at"}),
+	}).Create(&database.Quota{Scope: scope, ScopeID: scopeID, Name: name, Limit: limit}).Error
+}
+
+// Reset elimina el límite personalizado y vuelve al valor por defecto
+func Reset(ctx context.Context, scope string, scopeID uint, name string) error {
+	if _, err := lookup(scope, name); err != nil {
+		return err
+	}
+	return database.DB.WithContext(scopeContext(ctx, scope)).
+		Where("scope = ? AND scope_id = ? AND name = ?", scope, scopeID, name).
+		Delete(&database.Quota{}).Error
+}
+
+// Today ventana de las cuotas diarias: el día UTC actual
+func Today() string {
+	return clock.Now().UTC().Format("2006-01-02")
+}
+
+// NextReset devuelve el momento en que se reinician las cuotas diarias (medianoche UTC)
+func NextReset() time.Time {
+	now := clock.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// ThisMinute ventana de las cuotas por minuto: el minuto UTC actual
+func ThisMinute() string {
+	return clock.Now().UTC().Format("2006-01-02T15:04")
+}
+
+// NextMinute devuelve el momento en que se reinician las cuotas por minuto
+func NextMinute() time.Time {
+	return clock.Now().UTC().Truncate(time.Minute).Add(time.Minute)
+}
@@ -0,0 +1,279 @@
+package realtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"api/health"
+	"api/tenancy"
+)
+
+// Tipos de eventos publicados por la API
+const (
+	EventProfileUpdated      = "profile.updated"
+	EventExportReady         = "export.ready"
+	EventReportReady         = "report.ready"
+	EventSubscriptionUpdated = "subscription.updated"
+	EventBroadcast           = "admin.broadcast"
+)
+
+// bufferSize eventos pendientes por conexión; si un cliente no los consume a
+// tiempo se descartan los nuevos en lugar de bloquear al resto
+const bufferSize = 32
+
+// historySize eventos recientes que se guardan para reanudar un stream con Last-Event-ID
+const historySize = 1000
+
+// Event evento enviado a los clientes conectados
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+	At   time.Time       `json:"at"`
+}
+
+// message evento con su destinatario tal como viaja por el broker (UserID 0 =
+// todos los usuarios del tenant)
+type message struct {
+	Tenant string `json:"tenant,omitempty"`
+	UserID uint   `json:"user_id,omitempty"`
+	Event  Event  `json:"event"`
+}
+
+// subscriber usuario conectado; los IDs de usuario se repiten entre tenants
+type subscriber struct {
+	tenant string
+	userID uint
+}
+
+// Broker reparte los eventos entre las réplicas de la API
+type Broker interface {
+	Publish(ctx context.Context, payload []byte) error
+	// Run entrega a deliver los mensajes publicados por cualquier réplica hasta que ctx termina
+	Run(ctx context.Context, deliver func(payload []byte)) error
+}
+
+// Subscription canal de eventos de una conexión
+type Subscription struct {
+	C  <-chan Event
+	ch chan Event
+	subscriber
+}
+
+var (
+	mu      sync.RWMutex
+	subs    = map[subscriber]map[*Subscription]struct{}{}
+	history []message
+	broker  Broker = localBroker{}
+)
+
+// Init configura el broker: con REDIS_URL los eventos se reparten por Redis
+// pub/sub entre todas las réplicas; sin él solo llegan a las conexiones locales
+func Init(ctx context.Context) error {
+	if url := os.Getenv("REDIS_URL"); url != "" {
+		b, err := newRedisBroker(url, channel())
+		if err != nil {
+			return err
+		}
+		broker = b
+		log.Printf("📡 Eventos en tiempo real repartidos por Redis (%s)", channel())
+	}
+
+	go func() {
+		for {
+			err := broker.Run(ctx, deliver)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("⚠️  Suscripción a eventos interrumpida, se reintenta: %v", err)
+			time.Sleep(time.Second)
+		}
+	}()
+	return nil
+}
+
+func init() {
+	health.Register("redis", func(ctx context.Context) error {
+		b, ok := broker.(*redisBroker)
+		if !ok {
+			return health.ErrDisabled
+		}
+		return b.Ping(ctx)
+	})
+}
+
+func channel() string {
+	if name := os.Getenv("REALTIME_CHANNEL"); name != "" {
+		return name
+	}
+	return "geshuro:realtime"
+}
+
+// Subscribe abre un canal con los eventos del usuario del tenant de ctx y las
+// difusiones generales de ese tenant
+func Subscribe(ctx context.Context, userID uint) *Subscription {
+	sub, _ := SubscribeFrom(ctx, userID, "")
+	return sub
+}
+
+// SubscribeFrom abre el canal y devuelve además los eventos recientes posteriores
+// a lastID, sin huecos ni duplicados entre ambos. Si lastID ya no está en el
+// historial se devuelven todos los eventos guardados del usuario.
+func SubscribeFrom(ctx context.Context, userID uint, lastID string) (*Subscription, []Event) {
+	ch := make(chan Event, bufferSize)
+	key := subscriber{tenant: tenancy.From(ctx), userID: userID}
+	sub := &Subscription{C: ch, ch: ch, subscriber: key}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if subs[key] == nil {
+		subs[key] = map[*Subscription]struct{}{}
+	}
+	subs[key][sub] = struct{}{}
+
+	if lastID == "" {
+		return sub, nil
+	}
+	start := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Event.ID == lastID {
+			start = i + 1
+			break
+		}
+	}
+	var missed []Event
+	for _, msg := range history[start:] {
+		if msg.Tenant == key.tenant && (msg.UserID == 0 || msg.UserID == userID) {
+			missed = append(missed, msg.Event)
+		}
+	}
+	return sub, missed
+}
+
+// Close deja de recibir eventos
+func (s *Subscription) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := subs[s.subscriber][s]; !ok {
+		return
+	}
+	delete(subs[s.subscriber], s)
+	if len(subs[s.subscriber]) == 0 {
+		delete(subs, s.subscriber)
+	}
+	close(s.ch)
+}
+
+// Shutdown cierra todas las suscripciones para que terminen los streams abiertos
+func Shutdown() {
+	mu.Lock()
+	defer mu.Unlock()
+	for key, set := range subs {
+		for sub := range set {
+			close(sub.ch)
+		}
+		delete(subs, key)
+	}
+}
+
+// Connections número de conexiones abiertas en esta réplica
+func Connections() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	n := 0
+	for _, set := range subs {
+		n += len(set)
+	}
+	return n
+}
+
+// Publish envía un evento a las conexiones del usuario del tenant de ctx en
+// todas las réplicas
+func Publish(ctx context.Context, userID uint, eventType string, data interface{}) {
+	publish(tenancy.From(ctx), userID, eventType, data)
+}
+
+// Broadcast envía un evento a todos los usuarios conectados del tenant de ctx
+func Broadcast(ctx context.Context, eventType string, data interface{}) {
+	publish(tenancy.From(ctx), 0, eventType, data)
+}
+
+func publish(tenant string, userID uint, eventType string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("❌ Evento %s no serializable: %v", eventType, err)
+		return
+	}
+	event := Event{ID: newID(), Type: eventType, Data: raw, At: time.Now().UTC()}
+	payload, _ := json.Marshal(message{Tenant: tenant, UserID: userID, Event: event})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := broker.Publish(ctx, payload); err != nil {
+		log.Printf("⚠️  No se pudo publicar el evento %s: %v", eventType, err)
+	}
+}
+
+// deliver entrega un mensaje del broker a las conexiones locales
+func deliver(payload []byte) {
+	var msg message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("⚠️  Mensaje de eventos inválido: %v", err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Todas las réplicas reciben todos los mensajes, así que cualquiera puede reanudar un stream
+	history = append(history, msg)
+	if len(history) > historySize {
+		history = append([]message(nil), history[len(history)-historySize:]...)
+	}
+
+	if msg.UserID != 0 {
+		send(subs[subscriber{tenant: msg.Tenant, userID: msg.UserID}], msg.Event)
+		return
+	}
+	for key, set := range subs {
+		if key.tenant == msg.Tenant {
+			send(set, msg.Event)
+		}
+	}
+}
+
+func send(set map[*Subscription]struct{}, event Event) {
+	for sub := range set {
+		select {
+		case sub.ch <- event:
+		default:
+			log.Printf("⚠️  Conexión del usuario %d saturada, se descarta el evento %s", sub.userID, event.Type)
+		}
+	}
+}
+
+// newID identificador único y ordenable del evento
+func newID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + hex.EncodeToString(suffix)
+}
+
+// localBroker entrega los eventos directamente en esta réplica
+type localBroker struct{}
+
+func (localBroker) Publish(_ context.Context, payload []byte) error {
+	deliver(payload)
+	return nil
+}
+
+func (localBroker) Run(ctx context.Context, _ func([]byte)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
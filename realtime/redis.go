@@ -0,0 +1,52 @@
+package realtime
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisBroker reparte los eventos por un canal de Redis pub/sub; cada réplica
+// recibe todos los mensajes y los entrega a sus conexiones
+type redisBroker struct {
+	client  *redis.Client
+	channel string
+}
+
+func newRedisBroker(url, channel string) (*redisBroker, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &redisBroker{client: redis.NewClient(opts), channel: channel}, nil
+}
+
+func (b *redisBroker) Publish(ctx context.Context, payload []byte) error {
+	return b.client.Publish(ctx, b.channel, payload).Err()
+}
+
+func (b *redisBroker) Run(ctx context.Context, deliver func([]byte)) error {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	// Channel se reconecta solo si se pierde la conexión con Redis
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			deliver([]byte(msg.Payload))
+		}
+	}
+}
+
+func (b *redisBroker) Ping(ctx context.Context) error {
+	return b.client.Ping(ctx).Err()
+}
@@ -0,0 +1,113 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"api/breaker"
+	"api/health"
+)
+
+// ErrPDFDisabled no hay ningún conversor de HTML a PDF configurado
+var ErrPDFDisabled = errors.New("la generación de PDF no está configurada (PDF_RENDERER_URL)")
+
+// PDFRenderer convierte un documento HTML autocontenido (estilos en línea, sin
+// recursos externos) en PDF
+type PDFRenderer interface {
+	Render(ctx context.Context, html []byte) ([]byte, error)
+}
+
+// PDF conversor configurado; nil si no se pueden generar informes en PDF
+var PDF PDFRenderer
+
+func init() {
+	health.Register("pdf", func(ctx context.Context) error {
+		g, ok := PDF.(*Gotenberg)
+		if !ok {
+			return health.ErrDisabled
+		}
+		return g.Ping(ctx)
+	})
+}
+
+// InitPDF configura el conversor con PDF_RENDERER_URL, la URL de un servicio
+// Gotenberg (Chromium): la API no incluye un navegador propio
+func InitPDF() {
+	url := os.Getenv("PDF_RENDERER_URL")
+	if url == "" {
+		PDF = nil
+		return
+	}
+	PDF = NewGotenberg(url)
+	log.Printf("📄 Informes en PDF con Gotenberg en %s", url)
+}
+
+// Gotenberg conversor que usa la ruta de Chromium de Gotenberg
+type Gotenberg struct {
+	url    string
+	client *http.Client
+}
+
+// NewGotenberg crea el conversor para el servicio en url
+func NewGotenberg(url string) *Gotenberg {
+	return &Gotenberg{url: strings.TrimRight(url, "/"), client: &http.Client{Timeout: time.Minute, Transport: breaker.Transport("pdf", nil)}}
+}
+
+// Ping consulta el estado del servicio (GET /health)
+func (g *Gotenberg) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.url+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gotenberg: %s", resp.Status)
+	}
+	return nil
+}
+
+func (g *Gotenberg) Render(ctx context.Context, html []byte) ([]byte, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, err
+	}
+	file.Write(html)
+	// A4 (en pulgadas) con los fondos de las tablas
+	form.WriteField("paperWidth", "8.27")
+	form.WriteField("paperHeight", "11.7")
+	form.WriteField("printBackground", "true")
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url+"/forms/chromium/convert/html", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("gotenberg: %d %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,44 @@
+package reports
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGotenberg(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/forms/chromium/convert/html" {
+			http.NotFound(w, r)
+			return
+		}
+		file, header, err := r.FormFile("files")
+		if err != nil || header.Filename != "index.html" {
+			http.Error(w, "falta index.html", http.StatusBadRequest)
+			return
+		}
+		html, _ := io.ReadAll(file)
+		if !strings.Contains(string(html), "<h1>Hola</h1>") || r.FormValue("printBackground") != "true" {
+			http.Error(w, "formulario inesperado", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("%PDF-1.7"))
+	}))
+	defer srv.Close()
+
+	pdf, err := NewGotenberg(srv.URL+"/").Render(context.Background(), []byte("<h1>Hola</h1>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pdf) != "%PDF-1.7" {
+		t.Errorf("pdf = %q", pdf)
+	}
+
+	_, err = NewGotenberg(srv.URL).Render(context.Background(), []byte("<p>otro</p>"))
+	if err == nil || !strings.Contains(err.Error(), "formulario inesperado") {
+		t.Errorf("err = %v, se esperaba el mensaje de Gotenberg", err)
+	}
+}
@@ -0,0 +1,214 @@
+// Package reports genera en segundo plano los informes de administración: los
+// libros de Excel y el resumen mensual en PDF (Summary). Cada libro se
+// registra con Register y escribe sus hojas directamente, así que su tamaño no
+// está limitado por la memoria: se escribe en un fichero temporal y se sube al
+// almacenamiento al terminar.
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/jobs"
+	"api/realtime"
+	"api/storage"
+	"api/xlsx"
+
+	"gorm.io/gorm"
+)
+
+// Job nombre del trabajo que genera un informe
+const Job = "report.generate"
+
+// Tipos de contenido de los informes generados
+const (
+	ContentType    = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	PDFContentType = "application/pdf"
+)
+
+// Payload datos del trabajo
+type Payload struct {
+	ReportID string `json:"report_id"`
+}
+
+// Report escribe en el libro las hojas de un informe con los datos del periodo
+type Report func(ctx context.Context, w *xlsx.Writer, period Range) error
+
+// Range periodo [From, To) de los datos de un informe; sin límites, todo el
+// historial
+type Range struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// Scope limita la consulta a las filas con column dentro del periodo
+func (r Range) Scope(column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if r.From != nil {
+			db = db.Where(column+" >= ?", *r.From)
+		}
+		if r.To != nil {
+			db = db.Where(column+" < ?", *r.To)
+		}
+		return db
+	}
+}
+
+var (
+	mu      sync.RWMutex
+	reports = map[string]Report{}
+)
+
+// Register añade un tipo de informe
+func Register(name string, r Report) {
+	mu.Lock()
+	defer mu.Unlock()
+	reports[name] = r
+}
+
+// Types devuelve los tipos de informe disponibles, ordenados
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := []string{Summary}
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Exists indica si hay un informe con ese nombre
+func Exists(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := reports[name]
+	return ok || name == Summary
+}
+
+// Recover vuelve a encolar al arrancar los informes que quedaron pendientes en
+// un proceso anterior; los que superan exports.PendingTimeout se dan por fallidos
+func Recover(ctx context.Context) error {
+	if err := database.DB.WithContext(ctx).Model(&database.Report{}).
+		Where("status = ? AND created_at < ?", "pending", clock.Now().Add(-exports.PendingTimeout())).
+		Update("status", "failed").Error; err != nil {
+		return err
+	}
+
+	var pending []database.Report
+	if err := database.DB.WithContext(ctx).Where("status = ?", "pending").Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, r := range pending {
+		if err := jobs.Enqueue(ctx, Job, Payload{ReportID: r.ID}); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("📊 %d informes pendientes vueltos a encolar", len(pending))
+	}
+	return nil
+}
+
+// Process genera el informe, lo sube al almacenamiento y avisa al
+// administrador que lo pidió. El enlace dura lo mismo que el de las
+// exportaciones de datos (EXPORT_LINK_TTL).
+func Process(ctx context.Context, payload []byte) error {
+	var p Payload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var report database.Report
+	if err := database.DB.WithContext(ctx).First(&report, "id = ?", p.ReportID).Error; err != nil {
+		return err
+	}
+
+	if err := complete(ctx, &report); err != nil {
+		return err
+	}
+	realtime.Publish(ctx, report.RequestedBy, realtime.EventReportReady, map[string]interface{}{"id": report.ID, "type": report.Type, "expires_at": report.ExpiresAt})
+	return nil
+}
+
+// complete genera el informe y lo deja listo para descargar, o fallido
+func complete(ctx context.Context, report *database.Report) error {
+	size, key, err := generate(ctx, report)
+	if err != nil {
+		database.DB.WithContext(ctx).Model(report).Update("status", "failed")
+		return err
+	}
+	expires := clock.Now().Add(exports.LinkTTL())
+	return database.DB.WithContext(ctx).Model(report).Updates(map[string]interface{}{
+		"status":     "ready",
+		"object_key": key,
+		"size":       size,
+		"expires_at": expires,
+	}).Error
+}
+
+// generate genera el informe y lo sube; devuelve su tamaño y la clave en el
+// almacenamiento
+func generate(ctx context.Context, report *database.Report) (int64, string, error) {
+	if report.Type == Summary {
+		period, err := time.Parse(PeriodLayout, report.Period)
+		if err != nil {
+			return 0, "", err
+		}
+		pdf, err := renderSummary(ctx, period)
+		if err != nil {
+			return 0, "", err
+		}
+		key := fmt.Sprintf("reports/%s-%s-%s.pdf", report.Type, report.Period, report.ID)
+		if err := storage.Default.Put(ctx, key, bytes.NewReader(pdf), int64(len(pdf)), PDFContentType); err != nil {
+			return 0, "", err
+		}
+		return int64(len(pdf)), key, nil
+	}
+
+	// Los libros de Excel se escriben en un fichero temporal
+	mu.RLock()
+	build, ok := reports[report.Type]
+	mu.RUnlock()
+	if !ok {
+		return 0, "", fmt.Errorf("tipo de informe desconocido: %s", report.Type)
+	}
+
+	f, err := os.CreateTemp("", "report-*.xlsx")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := xlsx.NewWriter(f)
+	if err := build(ctx, w, Range{From: report.PeriodStart, To: report.PeriodEnd}); err != nil {
+		return 0, "", fmt.Errorf("informe %s: %w", report.Type, err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, "", err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, "", err
+	}
+
+	key := fmt.Sprintf("reports/%s-%s.xlsx", report.Type, report.ID)
+	if err := storage.Default.Put(ctx, key, f, size, ContentType); err != nil {
+		return 0, "", err
+	}
+	return size, key, nil
+}
@@ -0,0 +1,204 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/branding"
+	"api/clock"
+	"api/database"
+	"api/ids"
+	"api/mail"
+	"api/storage"
+	"api/tenancy"
+)
+
+// ScheduleJob trabajo periódico que genera y envía los informes programados
+const ScheduleJob = "report.schedules"
+
+// Frecuencias de los informes programados
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+// ErrSummaryMonthly el resumen en PDF es mensual y solo se programa cada mes
+var ErrSummaryMonthly = errors.New("el informe summary solo se puede programar con frecuencia monthly")
+
+// ValidateSchedule comprueba que el informe existe y se puede programar con
+// esa frecuencia
+func ValidateSchedule(reportType, frequency string) error {
+	if !Exists(reportType) {
+		return fmt.Errorf("informe desconocido, disponibles: %s", strings.Join(Types(), ", "))
+	}
+	switch frequency {
+	case Daily, Weekly, Monthly:
+	default:
+		return errors.New("frequency debe ser daily, weekly o monthly")
+	}
+	if reportType == Summary {
+		if frequency != Monthly {
+			return ErrSummaryMonthly
+		}
+		if PDF == nil {
+			return ErrPDFDisabled
+		}
+	}
+	return nil
+}
+
+// NextRun devuelve el final del periodo en curso, cuando se envía su informe:
+// las 00:00 UTC del día siguiente, del lunes siguiente o del día 1 del mes
+// siguiente
+func NextRun(frequency string, now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch frequency {
+	case Weekly:
+		// time.Sunday = 0: días que faltan hasta el próximo lunes
+		return day.AddDate(0, 0, 7-(int(day.Weekday())+6)%7)
+	case Monthly:
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day.AddDate(0, 0, 1)
+	}
+}
+
+// periodStart inicio del periodo de la frecuencia que termina en end
+func periodStart(frequency string, end time.Time) time.Time {
+	switch frequency {
+	case Weekly:
+		return end.AddDate(0, 0, -7)
+	case Monthly:
+		return end.AddDate(0, -1, 0)
+	default:
+		return end.AddDate(0, 0, -1)
+	}
+}
+
+// AttachmentLimit tamaño máximo del informe para enviarlo adjunto
+// (REPORT_ATTACHMENT_MAX_MB, 10 por defecto); los mayores se envían como enlace
+func AttachmentLimit() int64 {
+	if mb, err := strconv.Atoi(os.Getenv("REPORT_ATTACHMENT_MAX_MB")); err == nil && mb >= 0 {
+		return int64(mb) << 20
+	}
+	return 10 << 20
+}
+
+// RunSchedules trabajo ScheduleJob: genera y envía los informes programados
+// que han vencido. Tras una parada solo se envía el último periodo completo.
+func RunSchedules(ctx context.Context, _ []byte) error {
+	now := clock.Now()
+	var due []database.ReportSchedule
+	if err := database.DB.WithContext(ctx).Where("enabled = ? AND next_run_at <= ?", true, now).Find(&due).Error; err != nil {
+		return err
+	}
+	for _, schedule := range due {
+		// Con varias réplicas solo la que consigue adelantar la próxima
+		// ejecución envía el informe
+		next := NextRun(schedule.Frequency, now)
+		res := database.DB.WithContext(ctx).Model(&database.ReportSchedule{}).
+			Where("id = ? AND next_run_at = ?", schedule.ID, schedule.NextRunAt).Update("next_run_at", next)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+
+		end := periodStart(schedule.Frequency, next)
+		errMsg := ""
+		if err := runSchedule(ctx, &schedule, periodStart(schedule.Frequency, end), end); err != nil {
+			log.Printf("⚠️  Informe programado %d (%s): %v", schedule.ID, schedule.Name, err)
+			errMsg = err.Error()
+		}
+		database.DB.WithContext(ctx).Model(&database.ReportSchedule{}).Where("id = ?", schedule.ID).
+			Updates(map[string]interface{}{"last_run_at": now, "last_error": errMsg})
+	}
+	return nil
+}
+
+// runSchedule genera el informe del periodo [from, to) y lo envía a los
+// destinatarios: adjunto si no supera AttachmentLimit o, si no, con el enlace
+// para descargarlo
+func runSchedule(ctx context.Context, schedule *database.ReportSchedule, from, to time.Time) error {
+	report := database.Report{
+		ID:          ids.New(),
+		Type:        schedule.Type,
+		RequestedBy: schedule.CreatedBy,
+		ScheduleID:  &schedule.ID,
+		PeriodStart: &from,
+		PeriodEnd:   &to,
+		Status:      "pending",
+	}
+	if schedule.Type == Summary {
+		report.Period = from.Format(PeriodLayout)
+	}
+	if err := database.DB.WithContext(ctx).Create(&report).Error; err != nil {
+		return err
+	}
+	if err := complete(ctx, &report); err != nil {
+		return err
+	}
+
+	last := to.Add(-time.Second)
+	subject := fmt.Sprintf("Informe programado: %s (%s - %s)", schedule.Name, from.Format("02/01/2006"), last.Format("02/01/2006"))
+	body := fmt.Sprintf("Informe %s con los datos del %s al %s (UTC).\n", schedule.Type, from.Format("02/01/2006"), last.Format("02/01/2006"))
+	var attachments []mail.Attachment
+	if report.Size <= AttachmentLimit() {
+		data, err := read(ctx, report.ObjectKey)
+		if err != nil {
+			return err
+		}
+		contentType := ContentType
+		if path.Ext(report.ObjectKey) == ".pdf" {
+			contentType = PDFContentType
+		}
+		attachments = append(attachments, mail.Attachment{
+			Filename:    fmt.Sprintf("%s-%s%s", schedule.Type, from.Format("2006-01-02"), path.Ext(report.ObjectKey)),
+			ContentType: contentType,
+			Data:        data,
+		})
+	} else {
+		link := tenancy.Link(ctx, fmt.Sprintf("%s/api/v1/admin/reports/%s", appURL(), report.ID))
+		body += fmt.Sprintf("\nEs demasiado grande para adjuntarlo: descárgalo hasta el %s desde %s\n",
+			report.ExpiresAt.Format("02/01/2006 15:04 MST"), link)
+	}
+
+	var failed []string
+	for _, recipient := range schedule.Recipients {
+		if err := branding.SendWithAttachments(ctx, recipient, subject, body, attachments); err != nil {
+			log.Printf("⚠️  No se pudo enviar el informe programado a %s: %v", recipient, err)
+			failed = append(failed, recipient)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("no se pudo enviar a %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func read(ctx context.Context, key string) ([]byte, error) {
+	f, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return u
+	}
+	return "http://localhost:8080"
+}
@@ -0,0 +1,52 @@
+package reports
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	// Miércoles
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	for frequency, want := range map[string]time.Time{
+		Daily:   time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC),
+		Weekly:  time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		Monthly: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		next := NextRun(frequency, now)
+		if !next.Equal(want) {
+			t.Errorf("NextRun(%s) = %s, se esperaba %s", frequency, next, want)
+		}
+		// El periodo que cubre el envío es el anterior completo
+		if start := periodStart(frequency, next); !NextRun(frequency, start).Equal(next) {
+			t.Errorf("%s: el periodo [%s, %s) no es completo", frequency, start, next)
+		}
+	}
+	// Un lunes a las 00:00 el siguiente envío semanal es el lunes siguiente
+	monday := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	if next := NextRun(Weekly, monday); !next.Equal(monday.AddDate(0, 0, 7)) {
+		t.Errorf("NextRun(weekly, lunes) = %s", next)
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	Register("prueba", nil)
+	defer func() {
+		mu.Lock()
+		delete(reports, "prueba")
+		mu.Unlock()
+	}()
+	if err := ValidateSchedule("prueba", Weekly); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateSchedule("prueba", "hourly"); err == nil {
+		t.Error("frecuencia no válida aceptada")
+	}
+	if err := ValidateSchedule(Summary, Weekly); err != ErrSummaryMonthly {
+		t.Errorf("err = %v", err)
+	}
+	PDF = nil
+	if err := ValidateSchedule(Summary, Monthly); err != ErrPDFDisabled {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"html/template"
+	"time"
+
+	"api/clock"
+	"api/database"
+
+	"gorm.io/gorm"
+)
+
+// Summary informe mensual de resumen (crecimiento de usuarios y actividad) en
+// PDF, pensado para los informes de cumplimiento
+const Summary = "summary"
+
+// PeriodLayout formato del mes de un informe de resumen
+const PeriodLayout = "2006-01"
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var summaryTemplate = template.Must(template.New("summary.html").Funcs(template.FuncMap{
+	"percent": func(part, total int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(part) * 100 / float64(total)
+	},
+}).ParseFS(templates, "templates/summary.html"))
+
+// SummaryData datos del informe de resumen de un mes (en UTC)
+type SummaryData struct {
+	Period      time.Time
+	GeneratedAt time.Time
+	Users       struct {
+		AtStart int64
+		AtEnd   int64
+		New     int64
+		Deleted int64
+		// Growth variación del total en el mes, en porcentaje
+		Growth float64
+	}
+	Activity struct {
+		Logins       int64
+		FailedLogins int64
+		ActiveUsers  int64
+		APIRequests  int64
+		APIUsers     int64
+	}
+	// Altas por día; Max la del día con más, para escalar las barras
+	Signups    []DailyCount
+	MaxSignups int64
+}
+
+// DailyCount recuento de un día
+type DailyCount struct {
+	Date  string
+	Count int64
+}
+
+// PreviousMonth primer día del mes anterior al actual, el periodo por
+// defecto de los informes de resumen
+func PreviousMonth() time.Time {
+	now := clock.Now().UTC()
+	return time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// BuildSummary calcula los datos del informe del mes que empieza en period
+func BuildSummary(ctx context.Context, period time.Time) (*SummaryData, error) {
+	from := time.Date(period.Year(), period.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	db := database.DB.WithContext(ctx)
+	data := &SummaryData{Period: from, GeneratedAt: clock.Now().UTC()}
+
+	users := func() *gorm.DB { return db.Unscoped().Model(&database.User{}) }
+	logins := func() *gorm.DB {
+		return db.Model(&database.LoginEvent{}).Where("created_at >= ? AND created_at < ?", from, to)
+	}
+	usage := func() *gorm.DB {
+		return db.Model(&database.UserUsage{}).Where("day >= ? AND day < ?", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	// Las cuentas eliminadas cuentan en el total mientras existían
+	counts := []struct {
+		query *gorm.DB
+		dst   *int64
+	}{
+		{users().Where("created_at < ? AND (deleted_at IS NULL OR deleted_at >= ?)", from, from), &data.Users.AtStart},
+		{users().Where("created_at < ? AND (deleted_at IS NULL OR deleted_at >= ?)", to, to), &data.Users.AtEnd},
+		{users().Where("created_at >= ? AND created_at < ?", from, to), &data.Users.New},
+		{users().Where("deleted_at >= ? AND deleted_at < ?", from, to), &data.Users.Deleted},
+		{logins().Where("success = ?", true), &data.Activity.Logins},
+		{logins().Where("success = ?", false), &data.Activity.FailedLogins},
+		{logins().Where("success = ? AND user_id IS NOT NULL", true).Distinct("user_id"), &data.Activity.ActiveUsers},
+		{usage().Distinct("user_id"), &data.Activity.APIUsers},
+	}
+	for _, c := range counts {
+		if err := c.query.Count(c.dst).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := usage().Select("COALESCE(SUM(count), 0)").Scan(&data.Activity.APIRequests).Error; err != nil {
+		return nil, err
+	}
+	if data.Users.AtStart > 0 {
+		data.Users.Growth = float64(data.Users.AtEnd-data.Users.AtStart) * 100 / float64(data.Users.AtStart)
+	}
+
+	// Todos los días del mes, también los que no tuvieron altas
+	bucket := database.DateBucket("created_at", "day")
+	var rows []DailyCount
+	if err := users().Select(bucket+" AS date, COUNT(*) AS count").Where("created_at >= ? AND created_at < ?", from, to).
+		Group(bucket).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	byDay := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		byDay[row.Date] = row.Count
+	}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		count := byDay[day.Format("2006-01-02")]
+		data.Signups = append(data.Signups, DailyCount{Date: day.Format("02/01"), Count: count})
+		if count > data.MaxSignups {
+			data.MaxSignups = count
+		}
+	}
+	return data, nil
+}
+
+// renderSummary genera el PDF del informe del mes indicado
+func renderSummary(ctx context.Context, period time.Time) ([]byte, error) {
+	if PDF == nil {
+		return nil, ErrPDFDisabled
+	}
+	data, err := BuildSummary(ctx, period)
+	if err != nil {
+		return nil, err
+	}
+	var html bytes.Buffer
+	if err := summaryTemplate.Execute(&html, data); err != nil {
+		return nil, err
+	}
+	return PDF.Render(ctx, html.Bytes())
+}
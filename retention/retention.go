@@ -0,0 +1,470 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/storage"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// Job nombre del trabajo periódico que aplica las reglas de retención
+const Job = "retention.run"
+
+// Rule regla de retención: los registros anteriores a now-TTL se purgan
+type Rule struct {
+	Name        string
+	Description string
+	DefaultTTL  time.Duration
+	// Apply purga los registros anteriores a cutoff y devuelve cuántos eliminó
+	Apply func(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// overridesKey clave del ajuste con los plazos propios de un esquema
+const overridesKey = "retention"
+
+var (
+	// ErrUnknownRule no hay ninguna regla con ese nombre
+	ErrUnknownRule = errors.New("regla de retención desconocida")
+	// ErrInvalidTTL el plazo no es una duración positiva ni "off"
+	ErrInvalidTTL = errors.New(`plazo de retención inválido: una duración positiva (p. ej. 720h) u "off"`)
+)
+
+// TTL devuelve el plazo de la regla en la instalación. Se puede sobrescribir
+// con RETENTION_<NOMBRE> (p. ej. RETENTION_DELETED_USERS=720h); "off" la
+// desactiva. Las reglas sin DefaultTTL solo se aplican si se configura su plazo.
+func (r Rule) TTL() (time.Duration, bool) {
+	v := os.Getenv("RETENTION_" + strings.ToUpper(r.Name))
+	if v == "off" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d, true
+	}
+	return r.DefaultTTL, r.DefaultTTL > 0
+}
+
+// TTLWith devuelve el plazo efectivo de la regla en un esquema con los plazos
+// propios overrides (ver Overrides): el suyo si lo tiene y si no, el de TTL
+func (r Rule) TTLWith(overrides map[string]string) (time.Duration, bool) {
+	v, ok := overrides[r.Name]
+	if !ok {
+		return r.TTL()
+	}
+	if v == "off" {
+		return 0, false
+	}
+	d, _ := time.ParseDuration(v)
+	return d, true
+}
+
+// Overrides devuelve los plazos propios del esquema de ctx por regla: con
+// TENANCY=schema, los que ha fijado el tenant para sus datos
+func Overrides(ctx context.Context) (map[string]string, error) {
+	overrides := map[string]string{}
+	var setting database.Setting
+	err := database.DB.WithContext(ctx).Where("key = ?", overridesKey).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return overrides, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(setting.Value), &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// SetOverrides sustituye los plazos propios del esquema de ctx; las reglas que
+// no aparecen vuelven al plazo de la instalación
+func SetOverrides(ctx context.Context, overrides map[string]string) error {
+	for name, v := range overrides {
+		mu.RLock()
+		_, ok := rules[name]
+		mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownRule, name)
+		}
+		if d, err := time.ParseDuration(v); v != "off" && (err != nil || d <= 0) {
+			return fmt.Errorf("%w: %s", ErrInvalidTTL, name)
+		}
+	}
+	value, err := json.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Save(&database.Setting{Key: overridesKey, Value: string(value)}).Error
+}
+
+var (
+	mu    sync.RWMutex
+	rules = map[string]Rule{}
+)
+
+// Register añade una regla de retención
+func Register(r Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[r.Name] = r
+}
+
+// Rules devuelve las reglas registradas ordenadas por nombre
+func Rules() []Rule {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Run aplica todas las reglas activas en el esquema de ctx, con sus plazos
+// propios, y guarda el resultado de cada una
+func Run(ctx context.Context, _ []byte) error {
+	overrides, err := Overrides(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rule := range Rules() {
+		ttl, enabled := rule.TTLWith(overrides)
+		if !enabled {
+			continue
+		}
+
+		run := database.RetentionRun{Rule: rule.Name, Cutoff: clock.Now().Add(-ttl), StartedAt: clock.Now()}
+		purged, err := rule.Apply(ctx, run.Cutoff)
+		run.Purged = purged
+		run.FinishedAt = clock.Now()
+		if err != nil {
+			run.Error = err.Error()
+			log.Printf("❌ Retención %s: %v", rule.Name, err)
+		} else if purged > 0 {
+			log.Printf("🧹 Retención %s: %d registros purgados", rule.Name, purged)
+		}
+		if err := database.DB.WithContext(ctx).Create(&run).Error; err != nil {
+			log.Printf("❌ No se pudo registrar la ejecución de la retención %s: %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	Register(Rule{
+		Name:        "deleted_users",
+		Description: "Elimina definitivamente los usuarios borrados (soft delete) y sus datos relacionados",
+		DefaultTTL:  30 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			var users []database.User
+			if err := database.DB.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&users).Error; err != nil {
+				return 0, err
+			}
+			var purged int64
+			for i := range users {
+				if err := accounts.Anonymize(ctx, &users[i]); err != nil {
+					return purged, err
+				}
+				if err := database.DB.WithContext(ctx).Unscoped().Delete(&users[i]).Error; err != nil {
+					return purged, err
+				}
+				purged++
+			}
+			return purged, nil
+		},
+	})
+	Register(Rule{
+		Name:        "deleted_comments",
+		Description: "Elimina definitivamente los comentarios eliminados (soft delete)",
+		DefaultTTL:  30 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(&database.Comment{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "upload_sessions",
+		Description: "Elimina las sesiones de subida por partes abandonadas (también las que se quedaron a medio completar) y sus partes",
+		DefaultTTL:  7 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			var sessions []database.UploadSession
+			if err := database.DB.WithContext(ctx).Where("status IN ? AND expires_at < ?", []string{"pending", "completing"}, cutoff).Find(&sessions).Error; err != nil {
+				return 0, err
+			}
+			for _, s := range sessions {
+				for n := 1; n <= s.TotalParts; n++ {
+					storage.Default.Delete(ctx, storage.PartKey(s.ID, n))
+				}
+				database.DB.WithContext(ctx).Where("session_id = ?", s.ID).Delete(&database.UploadPart{})
+				database.DB.WithContext(ctx).Delete(&s)
+			}
+			return int64(len(sessions)), nil
+		},
+	})
+	Register(Rule{
+		Name:        "direct_uploads",
+		Description: "Elimina las subidas directas nunca confirmadas",
+		DefaultTTL:  24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			var uploads []database.DirectUpload
+			if err := database.DB.WithContext(ctx).Where("status = ? AND expires_at < ?", "pending", cutoff).Find(&uploads).Error; err != nil {
+				return 0, err
+			}
+			for _, u := range uploads {
+				storage.Default.Delete(ctx, u.ObjectKey)
+				database.DB.WithContext(ctx).Delete(&u)
+			}
+			return int64(len(uploads)), nil
+		},
+	})
+	Register(Rule{
+		Name:        "data_exports",
+		Description: "Elimina los archivos de exportación de datos expirados",
+		DefaultTTL:  24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			var list []database.DataExport
+			if err := database.DB.WithContext(ctx).Where("status = ? AND expires_at < ?", "ready", cutoff).Find(&list).Error; err != nil {
+				return 0, err
+			}
+			for _, e := range list {
+				storage.Default.Delete(ctx, e.ObjectKey)
+				database.DB.WithContext(ctx).Model(&e).Updates(map[string]interface{}{"status": "expired", "object_key": ""})
+			}
+			return int64(len(list)), nil
+		},
+	})
+	Register(Rule{
+		Name:        "export_records",
+		Description: "Elimina los registros de exportaciones fallidas o expiradas",
+		DefaultTTL:  30 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			if _, err := exports.FailStale(ctx); err != nil {
+				return 0, err
+			}
+			res := database.DB.WithContext(ctx).Where("status IN ? AND updated_at < ?", []string{"failed", "expired"}, cutoff).Delete(&database.DataExport{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "reports",
+		Description: "Elimina los informes de administración expirados y los fallidos",
+		DefaultTTL:  24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			var list []database.Report
+			if err := database.DB.WithContext(ctx).Where("(status = ? AND expires_at < ?) OR (status = ? AND updated_at < ?)", "ready", cutoff, "failed", cutoff).
+				Find(&list).Error; err != nil {
+				return 0, err
+			}
+			for _, r := range list {
+				if r.ObjectKey != "" {
+					storage.Default.Delete(ctx, r.ObjectKey)
+				}
+				database.DB.WithContext(ctx).Delete(&r)
+			}
+			return int64(len(list)), nil
+		},
+	})
+	Register(Rule{
+		Name:        "login_history",
+		Description: "Elimina el historial de inicios de sesión antiguo",
+		DefaultTTL:  90 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			dropped, err := database.DropPartitions(ctx, "login_events", cutoff)
+			if err != nil {
+				return dropped, err
+			}
+			res := database.DB.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&database.LoginEvent{})
+			return dropped + res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "user_changes",
+		Description: "Elimina el historial de cambios de usuarios antiguo (solo con RETENTION_USER_CHANGES)",
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			dropped, err := database.DropPartitions(ctx, "user_changes", cutoff)
+			if err != nil {
+				return dropped, err
+			}
+			res := database.DB.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&database.UserChange{})
+			return dropped + res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "sessions",
+		Description: "Elimina el registro de sesiones caducadas",
+		DefaultTTL:  30 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			// Por la caducidad del token, no la de la sesión (que con inactividad
+			// es anterior); las sesiones registradas antes de guardarla, por la suya
+			res := database.DB.WithContext(ctx).Where("token_expires_at < ? OR (token_expires_at IS NULL AND expires_at < ?)", cutoff, cutoff).
+				Delete(&database.Session{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "devices",
+		Description: "Elimina los dispositivos que no se usan desde hace tiempo",
+		DefaultTTL:  365 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("last_seen_at < ?", cutoff).Delete(&database.Device{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "login_challenges",
+		Description: "Elimina las verificaciones de inicio de sesión por riesgo caducadas",
+		DefaultTTL:  24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("expires_at < ?", cutoff).Delete(&database.LoginChallenge{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "magic_links",
+		Description: "Elimina los enlaces de inicio de sesión por correo caducados",
+		DefaultTTL:  24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("expires_at < ?", cutoff).Delete(&database.MagicLink{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "oauth_codes",
+		Description: "Elimina los códigos de autorización OAuth caducados",
+		DefaultTTL:  24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("expires_at < ?", cutoff).Delete(&database.OAuthCode{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "oauth_device_codes",
+		Description: "Elimina las autorizaciones de dispositivo OAuth caducadas",
+		DefaultTTL:  24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("expires_at < ?", cutoff).Delete(&database.OAuthDeviceCode{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "oauth_tokens",
+		Description: "Elimina los tokens OAuth cuya renovación ya caducó",
+		DefaultTTL:  30 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("refresh_expires_at < ?", cutoff).Delete(&database.OAuthToken{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "token_exchanges",
+		Description: "Elimina el registro de canjes de tokens entre servicios",
+		DefaultTTL:  365 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&database.TokenExchange{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "ip_bans",
+		Description: "Elimina el historial de bloqueos de IPs vencidos",
+		DefaultTTL:  90 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("expires_at < ?", cutoff).Delete(&database.IPBan{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "user_usage",
+		Description: "Elimina las métricas diarias de uso de la API antiguas",
+		DefaultTTL:  365 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			dropped, err := database.DropPartitions(ctx, "user_usages", cutoff)
+			if err != nil {
+				return dropped, err
+			}
+			res := database.DB.WithContext(ctx).Where("day < ?", cutoff.UTC().Format("2006-01-02")).Delete(&database.UserUsage{})
+			return dropped + res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "api_key_usage",
+		Description: "Elimina las métricas diarias de uso de claves de API antiguas",
+		DefaultTTL:  365 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			dropped, err := database.DropPartitions(ctx, "api_key_usages", cutoff)
+			if err != nil {
+				return dropped, err
+			}
+			res := database.DB.WithContext(ctx).Where("day < ?", cutoff.UTC().Format("2006-01-02")).Delete(&database.APIKeyUsage{})
+			return dropped + res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "quota_counters",
+		Description: "Elimina los contadores de cuotas de consumo de ventanas pasadas",
+		DefaultTTL:  7 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("period < ?", cutoff.UTC().Format("2006-01-02")).Delete(&database.QuotaCounter{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "stripe_events",
+		Description: "Elimina el registro de eventos de Stripe procesados (Stripe deja de reenviarlos a los 3 días)",
+		DefaultTTL:  30 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("processed_at < ?", cutoff).Delete(&database.StripeEvent{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "tenant_accesses",
+		Description: "Elimina el registro antiguo de accesos de los administradores de la plataforma a los tenants",
+		DefaultTTL:  365 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			// La tabla solo existe en el esquema public
+			if !tenancy.Enabled() || tenancy.From(ctx) != "" {
+				return 0, nil
+			}
+			res := database.DB.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&database.TenantAccess{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "tenant_events",
+		Description: "Elimina los eventos antiguos del ciclo de vida de los tenants (altas, suspensiones, bajas...)",
+		DefaultTTL:  2 * 365 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			// La tabla solo existe en el esquema public
+			if !tenancy.Enabled() || tenancy.From(ctx) != "" {
+				return 0, nil
+			}
+			res := database.DB.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&database.TenantEvent{})
+			return res.RowsAffected, res.Error
+		},
+	})
+	Register(Rule{
+		Name:        "retention_runs",
+		Description: "Elimina el historial de ejecuciones de retención antiguo",
+		DefaultTTL:  180 * 24 * time.Hour,
+		Apply: func(ctx context.Context, cutoff time.Time) (int64, error) {
+			res := database.DB.WithContext(ctx).Where("started_at < ?", cutoff).Delete(&database.RetentionRun{})
+			return res.RowsAffected, res.Error
+		},
+	})
+}
@@ -0,0 +1,129 @@
+// Package risk puntúa los inicios de sesión con señales enchufables (viajes
+// imposibles, nodos de salida de TOR, ráfagas de intentos...) y decide si se
+// permiten, si exigen un segundo factor o si se bloquean. Se activa con
+// RISK_SCORING=true.
+package risk
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decisiones posibles sobre un inicio de sesión
+const (
+	Allow     = "allow"
+	Challenge = "challenge"
+	Block     = "block"
+)
+
+// Umbrales por defecto: desde ChallengeScore se exige un segundo factor y desde
+// BlockScore se rechaza el acceso
+const (
+	defaultChallengeScore = 50
+	defaultBlockScore     = 100
+)
+
+// Attempt inicio de sesión con credenciales correctas que se va a puntuar
+type Attempt struct {
+	UserID    uint
+	Email     string
+	IP        string
+	UserAgent string
+	At        time.Time
+}
+
+// Signal señal de riesgo: si Detect la encuentra en el intento suma su peso
+type Signal struct {
+	Name          string
+	Description   string
+	DefaultWeight int
+	Detect        func(ctx context.Context, a Attempt) (bool, error)
+}
+
+// Weight devuelve el peso efectivo de la señal. Se puede sobrescribir con
+// RISK_WEIGHT_<NOMBRE> (p. ej. RISK_WEIGHT_TOR_EXIT=100); 0 la desactiva.
+func (s Signal) Weight() int {
+	if n, err := strconv.Atoi(os.Getenv("RISK_WEIGHT_" + strings.ToUpper(s.Name))); err == nil && n >= 0 {
+		return n
+	}
+	return s.DefaultWeight
+}
+
+// Assessment resultado de puntuar un intento
+type Assessment struct {
+	Score    int
+	Decision string
+	// Señales encontradas
+	Reasons []string
+}
+
+var (
+	mu      sync.RWMutex
+	signals = map[string]Signal{}
+)
+
+// Register añade una señal de riesgo
+func Register(s Signal) {
+	mu.Lock()
+	defer mu.Unlock()
+	signals[s.Name] = s
+}
+
+// Signals devuelve las señales registradas ordenadas por nombre
+func Signals() []Signal {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]Signal, 0, len(signals))
+	for _, s := range signals {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Enabled indica si se puntúan los inicios de sesión (RISK_SCORING=true)
+func Enabled() bool {
+	return os.Getenv("RISK_SCORING") == "true"
+}
+
+// Evaluate suma el peso de las señales presentes en el intento y decide. Una
+// señal que falla no cuenta: un error al consultar la lista de TOR no debe
+// impedir el acceso a todo el mundo.
+func Evaluate(ctx context.Context, a Attempt) Assessment {
+	var assessment Assessment
+	for _, s := range Signals() {
+		weight := s.Weight()
+		if weight == 0 {
+			continue
+		}
+		found, err := s.Detect(ctx, a)
+		if err != nil {
+			log.Printf("⚠️  Señal de riesgo %s no disponible: %v", s.Name, err)
+			continue
+		}
+		if found {
+			assessment.Score += weight
+			assessment.Reasons = append(assessment.Reasons, s.Name)
+		}
+	}
+	assessment.Decision = Decide(assessment.Score)
+	return assessment
+}
+
+// Decide aplica los umbrales RISK_CHALLENGE_SCORE y RISK_BLOCK_SCORE a una puntuación
+func Decide(score int) string {
+	switch {
+	case score >= number("RISK_BLOCK_SCORE", defaultBlockScore):
+		return Block
+	case score >= number("RISK_CHALLENGE_SCORE", defaultChallengeScore):
+		return Challenge
+	default:
+		return Allow
+	}
+}
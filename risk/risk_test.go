@@ -0,0 +1,52 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	saved := signals
+	t.Cleanup(func() { signals = saved })
+	signals = map[string]Signal{}
+
+	detect := func(found bool, err error) func(context.Context, Attempt) (bool, error) {
+		return func(context.Context, Attempt) (bool, error) { return found, err }
+	}
+	Register(Signal{Name: "a", DefaultWeight: 30, Detect: detect(true, nil)})
+	Register(Signal{Name: "b", DefaultWeight: 30, Detect: detect(true, nil)})
+	Register(Signal{Name: "c", DefaultWeight: 80, Detect: detect(false, nil)})
+	Register(Signal{Name: "d", DefaultWeight: 80, Detect: detect(true, errors.New("no disponible"))})
+
+	got := Evaluate(context.Background(), Attempt{})
+	want := Assessment{Score: 60, Decision: Challenge, Reasons: []string{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Evaluate = %+v, se esperaba %+v", got, want)
+	}
+
+	t.Setenv("RISK_WEIGHT_B", "0")
+	if got := Evaluate(context.Background(), Attempt{}); got.Decision != Allow || got.Score != 30 {
+		t.Errorf("con la señal b desactivada: %+v", got)
+	}
+	t.Setenv("RISK_WEIGHT_A", "100")
+	if got := Evaluate(context.Background(), Attempt{}); got.Decision != Block {
+		t.Errorf("con la señal a a 100: %+v", got)
+	}
+}
+
+func TestDecide(t *testing.T) {
+	t.Setenv("RISK_CHALLENGE_SCORE", "")
+	t.Setenv("RISK_BLOCK_SCORE", "")
+	tests := map[int]string{0: Allow, 49: Allow, 50: Challenge, 99: Challenge, 100: Block, 250: Block}
+	for score, want := range tests {
+		if got := Decide(score); got != want {
+			t.Errorf("Decide(%d) = %s, se esperaba %s", score, got, want)
+		}
+	}
+	t.Setenv("RISK_CHALLENGE_SCORE", "20")
+	if got := Decide(30); got != Challenge {
+		t.Errorf("con RISK_CHALLENGE_SCORE=20, Decide(30) = %s", got)
+	}
+}
@@ -0,0 +1,179 @@
+package risk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api/database"
+	"api/geoip"
+
+	"gorm.io/gorm"
+)
+
+// Valores por defecto de las señales
+const (
+	defaultMaxSpeed       = 900 // km/h, algo más que un avión comercial
+	minTravelDistance     = 500 // km; por debajo la imprecisión de GeoIP da falsos positivos
+	defaultVelocityWindow = 10 * time.Minute
+	defaultVelocityLimit  = 10
+	defaultVelocityIPs    = 4
+	torListTTL            = time.Hour
+)
+
+func init() {
+	Register(Signal{
+		Name:          "impossible_travel",
+		Description:   "Ubicación incompatible con la del último inicio de sesión dado el tiempo transcurrido (RISK_MAX_SPEED_KMH)",
+		DefaultWeight: 60,
+		Detect:        impossibleTravel,
+	})
+	Register(Signal{
+		Name:          "tor_exit",
+		Description:   "La IP es un nodo de salida de TOR (lista de RISK_TOR_EXIT_LIST_URL)",
+		DefaultWeight: 50,
+		Detect:        torExit,
+	})
+	Register(Signal{
+		Name:          "velocity",
+		Description:   "Ráfaga de intentos para la cuenta o desde demasiadas IPs en RISK_VELOCITY_WINDOW",
+		DefaultWeight: 40,
+		Detect:        velocity,
+	})
+}
+
+// impossibleTravel compara la ubicación del intento con la de la última sesión
+// abierta; necesita una base de datos GeoIP con coordenadas (edición City)
+func impossibleTravel(ctx context.Context, a Attempt) (bool, error) {
+	current := geoip.Lookup(a.IP)
+	if !current.HasCoordinates {
+		return false, nil
+	}
+
+	var last database.Session
+	err := database.DB.WithContext(ctx).Where("user_id = ?", a.UserID).Order("created_at DESC").First(&last).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	previous := geoip.Lookup(last.IP)
+	if !previous.HasCoordinates {
+		return false, nil
+	}
+
+	distance := geoip.Distance(previous, current)
+	if distance < minTravelDistance {
+		return false, nil
+	}
+	hours := a.At.Sub(last.CreatedAt).Hours()
+	return hours <= 0 || distance/hours > float64(number("RISK_MAX_SPEED_KMH", defaultMaxSpeed)), nil
+}
+
+var (
+	torMu       sync.Mutex
+	torExits    map[string]bool
+	torLoadedAt time.Time
+	torURL      string
+)
+
+// torExit busca la IP en la lista de nodos de salida de TOR, que se descarga
+// de RISK_TOR_EXIT_LIST_URL (p. ej. https://check.torproject.org/torbulkexitlist)
+// y se renueva cada hora. Sin URL la señal no actúa.
+func torExit(ctx context.Context, a Attempt) (bool, error) {
+	url := os.Getenv("RISK_TOR_EXIT_LIST_URL")
+	if url == "" {
+		return false, nil
+	}
+
+	torMu.Lock()
+	defer torMu.Unlock()
+	if url != torURL || time.Since(torLoadedAt) >= torListTTL {
+		list, err := fetchTorExits(ctx, url)
+		if url != torURL {
+			torExits = nil
+		}
+		// Tras un error no se reintenta hasta pasado torListTTL y se sigue usando
+		// la última lista descargada, si la hay
+		torURL, torLoadedAt = url, time.Now()
+		if err == nil {
+			torExits = list
+		} else if torExits == nil {
+			return false, err
+		}
+	}
+	if addr := net.ParseIP(a.IP); addr != nil {
+		return torExits[addr.String()], nil
+	}
+	return false, nil
+}
+
+func fetchTorExits(ctx context.Context, url string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lista de nodos TOR: HTTP %d", resp.StatusCode)
+	}
+
+	list := map[string]bool{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if addr := net.ParseIP(line); addr != nil {
+			list[addr.String()] = true
+		}
+	}
+	return list, scanner.Err()
+}
+
+// velocity detecta ráfagas de intentos contra la cuenta: más de
+// RISK_VELOCITY_ATTEMPTS intentos o desde RISK_VELOCITY_IPS IPs distintas en
+// RISK_VELOCITY_WINDOW
+func velocity(ctx context.Context, a Attempt) (bool, error) {
+	window := defaultVelocityWindow
+	if d, err := time.ParseDuration(os.Getenv("RISK_VELOCITY_WINDOW")); err == nil && d > 0 {
+		window = d
+	}
+	limit := number("RISK_VELOCITY_ATTEMPTS", defaultVelocityLimit)
+
+	// Las IPs del historial están cifradas, así que se cuentan aquí y no en SQL
+	var events []database.LoginEvent
+	err := database.DB.WithContext(ctx).Where("LOWER(email) = LOWER(?) AND created_at > ?", a.Email, a.At.Add(-window)).
+		Order("created_at DESC").Limit(limit).Find(&events).Error
+	if err != nil {
+		return false, err
+	}
+	if len(events) >= limit {
+		return true, nil
+	}
+	ips := map[string]bool{a.IP: true}
+	for _, e := range events {
+		ips[e.IP] = true
+	}
+	return len(ips) >= number("RISK_VELOCITY_IPS", defaultVelocityIPs), nil
+}
+
+func number(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
@@ -2,9 +2,15 @@ package routes
 
 import (
 	"net/http"
+	"path"
+	"time"
 
 	"api/config"
+	"api/deprecation"
 	"api/handlers"
+	"api/links"
+	"api/plans"
+	"api/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -13,23 +19,39 @@ import (
 func SetupRoutes(router *gin.Engine) {
 	// Grupo de rutas para la API v1
 	v1 := router.Group("/api/v1")
+	v1.Use(config.APIVersion(1), config.JSONAPIMiddleware(), config.QueryTimeoutMiddleware())
+	registerAPI(v1, router)
+
+	// Grupo de rutas para la API v2: mismos handlers, con sobre de errores y
+	// paginación en los listados (ver "Versionado de la API" en el README)
+	v2 := router.Group("/api/v2")
+	v2.Use(config.APIVersion(2), config.JSONAPIMiddleware(), config.QueryTimeoutMiddleware())
+	registerAPI(v2, router)
+
+	// Rutas obsoletas: responden con Deprecation/Sunset/Link apuntando a su sustituta
+	deprecate(v1, http.MethodGet, "/users", deprecation.Info{
+		Since:     time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC),
+		Successor: v2.BasePath() + "/users",
+	})
+
+	// GraphQL: mismos servicios y middleware de autenticación que REST
+	graphql := router.Group("/graphql")
+	graphql.Use(config.OptionalAuthMiddleware(), config.QuotaMiddleware(), config.UsageMiddleware())
 	{
-		// Rutas públicas
-		v1.GET("/health", handlers.HealthCheck)
-		v1.POST("/auth/register", handlers.Register)
-		v1.POST("/auth/login", handlers.Login)
-
-		// Rutas protegidas
-		protected := v1.Group("/")
-		protected.Use(config.AuthMiddleware())
-		{
-			protected.GET("/users", handlers.GetUsers)
-			protected.GET("/users/:id", handlers.GetUser)
-			protected.PUT("/users/:id", handlers.UpdateUser)
-			protected.DELETE("/users/:id", handlers.DeleteUser)
-			protected.GET("/profile", handlers.GetProfile)
-		}
+		graphql.POST("", handlers.GraphQL)
+		graphql.GET("", handlers.GraphQL)
 	}
+	if gin.Mode() != gin.ReleaseMode {
+		router.GET("/graphql/playground", handlers.GraphQLPlayground)
+	}
+
+	// Canal de eventos en tiempo real (WebSocket o Server-Sent Events)
+	router.GET("/ws", handlers.WebSocket)
+	router.GET("/events", config.AuthMiddleware(), handlers.Events)
+
+	// Descarga de archivos locales mediante URLs firmadas
+	router.GET("/files/*key", handlers.ServeFile)
+	router.PUT("/files/*key", handlers.ReceiveFile)
 
 	// Ruta de bienvenida
 	router.GET("/", func(c *gin.Context) {
@@ -40,6 +62,13 @@ func SetupRoutes(router *gin.Engine) {
 		})
 	})
 
+	// Registro de rutas para los enlaces HATEOAS de las respuestas
+	var registered []links.Route
+	for _, route := range router.Routes() {
+		registered = append(registered, links.Route{Method: route.Method, Path: route.Path})
+	}
+	links.Init(registered)
+
 	// Manejo de rutas no encontradas
 	router.NoRoute(func(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{
@@ -49,3 +78,246 @@ func SetupRoutes(router *gin.Engine) {
 		})
 	})
 }
+
+// deprecate marca como obsoleta una ruta del grupo
+func deprecate(group *gin.RouterGroup, method, relativePath string, info deprecation.Info) {
+	info.Method = method
+	info.Path = path.Join(group.BasePath(), relativePath)
+	deprecation.Register(info)
+}
+
+// registerAPI registra las rutas comunes a todas las versiones de la API
+func registerAPI(api *gin.RouterGroup, router *gin.Engine) {
+	// Rutas públicas
+	api.GET("/health", config.VerboseHealthMiddleware(), handlers.HealthCheck)
+	api.POST("/auth/register", handlers.Register)
+	api.POST("/auth/login", handlers.Login)
+	api.POST("/auth/login/verify", handlers.VerifyLogin)
+	api.POST("/auth/login/identity", handlers.LoginWithIdentity)
+	api.POST("/auth/magic-link", handlers.RequestMagicLink)
+	api.GET("/auth/magic-link/verify", handlers.VerifyMagicLink)
+	api.POST("/auth/code", handlers.RequestLoginCode)
+	api.POST("/auth/code/verify", handlers.VerifyLoginCode)
+	api.GET("/auth/sessions/revoke", handlers.RevokeSessionLink)
+	// Token con los permisos actuales tras X-Permissions-Stale o, con la cookie
+	// de renovación, nuevo aunque haya caducado
+	api.POST("/auth/refresh", handlers.RefreshWithCookie, config.AuthMiddleware(), config.SessionOnlyMiddleware(), handlers.RefreshToken)
+	api.POST("/billing/webhook", handlers.StripeWebhook)
+	api.GET("/plans", handlers.GetPlans)
+	api.GET("/branding", handlers.GetBranding)
+	api.GET("/terms", handlers.GetTerms)
+	api.GET("/usernames/:name/available", handlers.CheckUsername)
+	api.GET("/u/:username", handlers.GetPublicProfile)
+	api.POST("/oauth/token", handlers.OAuthToken)
+	api.POST("/oauth/device_authorization", handlers.OAuthDeviceAuthorization)
+	api.POST("/oauth/introspect", handlers.OAuthIntrospect)
+
+	// Rutas protegidas
+	protected := api.Group("/")
+	protected.Use(config.AuthMiddleware(), config.QuotaMiddleware(), config.UsageMiddleware())
+	{
+		// Varias peticiones en una sola llamada, ejecutadas a través del propio router
+		protected.POST("/batch", handlers.Batch(router))
+
+		protected.GET("/users", handlers.GetUsers)
+		protected.GET("/users/search", handlers.SearchUsers)
+		// El acceso a cada cuenta lo deciden las políticas de autorización: por
+		// defecto, su propietario y los administradores
+		protected.GET("/users/:id", config.UserAccessMiddleware(services.ActionUsersRead), handlers.GetUser)
+		protected.PUT("/users/:id", config.UserAccessMiddleware(services.ActionUsersUpdate), handlers.UpdateUser)
+		protected.DELETE("/users/:id", config.UserAccessMiddleware(services.ActionUsersDelete), handlers.DeleteUser)
+		protected.GET("/users/:id/metadata", config.UserAccessMiddleware(services.ActionUsersRead), handlers.GetUserMetadata)
+		protected.PATCH("/users/:id/metadata", config.UserAccessMiddleware(services.ActionUsersUpdate), handlers.PatchUserMetadata)
+		protected.PUT("/users/:id/metadata", config.UserAccessMiddleware(services.ActionUsersUpdate), handlers.ReplaceUserMetadata)
+		// Decisión de autorización para que los clientes adapten la interfaz
+		protected.GET("/authz/can", handlers.CheckPermission)
+		protected.GET("/profile", handlers.GetProfile)
+		protected.PUT("/profile", handlers.UpdateProfile)
+		protected.POST("/profile/password", config.SessionOnlyMiddleware(), handlers.ChangeMyPassword)
+		protected.POST("/profile/terms", handlers.AcceptMyTerms)
+		protected.POST("/profile/verification", config.SessionOnlyMiddleware(), handlers.RequestMyVerification)
+		protected.GET("/profile/verification", handlers.GetMyVerification)
+		protected.DELETE("/profile/verification", config.SessionOnlyMiddleware(), handlers.CancelMyVerification)
+		protected.GET("/profile/suspension", handlers.GetMySuspension)
+		protected.POST("/profile/suspension/appeal", config.SessionOnlyMiddleware(), handlers.AppealMySuspension)
+		protected.GET("/profile/settings", handlers.GetMySettings)
+		protected.PUT("/profile/settings", handlers.UpdateMySettings)
+		protected.DELETE("/profile", config.SessionOnlyMiddleware(), handlers.DeleteProfile)
+		protected.GET("/profile/quotas", handlers.GetMyQuotas)
+		protected.GET("/profile/plan", handlers.GetMyPlan)
+		protected.GET("/profile/devices", handlers.GetMyDevices)
+		protected.DELETE("/profile/devices/:id/trust", handlers.UntrustMyDevice)
+		protected.GET("/profile/sessions", handlers.GetMySessions)
+		protected.GET("/profile/identities", handlers.GetMyIdentities)
+		protected.POST("/profile/identities/:provider", config.SessionOnlyMiddleware(), handlers.LinkMyIdentity)
+		protected.DELETE("/profile/identities/:provider", config.SessionOnlyMiddleware(), handlers.UnlinkMyIdentity)
+		protected.GET("/profile/usage/export", config.RequireFeature(plans.FeatureBulkExport), handlers.ExportMyUsage)
+		protected.GET("/profile/avatar", handlers.GetAvatar)
+		protected.POST("/profile/avatar", handlers.UploadAvatar)
+		protected.POST("/profile/export", handlers.RequestExport)
+		protected.GET("/profile/exports/:id", handlers.GetExport)
+
+		// Facturación
+		protected.GET("/billing/subscription", handlers.GetSubscription)
+		protected.POST("/billing/checkout", handlers.CreateCheckoutSession)
+		protected.POST("/billing/portal", handlers.CreatePortalSession)
+
+		// Claves de API (solo con sesión iniciada, nunca con otra clave)
+		keys := protected.Group("/api-keys", config.SessionOnlyMiddleware())
+		keys.GET("", handlers.GetAPIKeys)
+		keys.POST("", config.RequireFeature(plans.FeatureAPIKeys), handlers.CreateAPIKey)
+		keys.DELETE("/:id", handlers.RevokeAPIKey)
+		keys.GET("/:id/usage", handlers.GetAPIKeyUsage)
+
+		// Servidor de autorización OAuth2 para aplicaciones de terceros
+		oauthGroup := protected.Group("/oauth", config.SessionOnlyMiddleware())
+		oauthGroup.GET("/clients", handlers.GetOAuthClients)
+		oauthGroup.POST("/clients", handlers.CreateOAuthClient)
+		oauthGroup.DELETE("/clients/:id", handlers.DeleteOAuthClient)
+		oauthGroup.GET("/authorize", handlers.GetOAuthAuthorization)
+		oauthGroup.POST("/authorize", handlers.AuthorizeOAuth)
+		oauthGroup.GET("/device", handlers.GetOAuthDevice)
+		oauthGroup.POST("/device", handlers.AuthorizeOAuthDevice)
+		protected.GET("/profile/apps", config.SessionOnlyMiddleware(), handlers.GetMyOAuthGrants)
+		protected.DELETE("/profile/apps/:client_id", config.SessionOnlyMiddleware(), handlers.RevokeMyOAuthGrant)
+
+		// Subidas por partes reanudables
+		protected.POST("/uploads", handlers.InitUpload)
+		protected.GET("/uploads/:id", handlers.GetUpload)
+		protected.PUT("/uploads/:id/parts/:number", handlers.UploadPart)
+		protected.POST("/uploads/:id/complete", handlers.CompleteUpload)
+		protected.DELETE("/uploads/:id", handlers.AbortUpload)
+
+		// Subidas directas con URL prefirmada
+		protected.POST("/uploads/presign", handlers.PresignUpload)
+		protected.POST("/uploads/presign/:id/confirm", handlers.ConfirmUpload)
+
+		// Organizaciones: dentro de cada una se aplica el rol del usuario en
+		// ella (admin o member, el mayor entre el suyo y los de sus grupos), no
+		// su rol global
+		orgs := protected.Group("/orgs")
+		orgs.GET("", handlers.GetMyOrganizations)
+		orgs.POST("", handlers.CreateOrganization)
+		org := orgs.Group("/:org", config.OrgMiddleware(services.OrgRoleMember))
+		org.GET("", handlers.GetOrganization)
+		org.GET("/members", handlers.GetOrgMembers)
+		orgAdmin := org.Group("", config.RequireOrgRole(services.OrgRoleAdmin))
+		orgAdmin.PUT("", handlers.UpdateOrganization)
+		orgAdmin.DELETE("", handlers.DeleteOrganization)
+		orgAdmin.POST("/members", handlers.AddOrgMember)
+		orgAdmin.PUT("/members/:user_id", handlers.UpdateOrgMember)
+		orgAdmin.DELETE("/members/:user_id", handlers.RemoveOrgMember)
+		org.GET("/groups", handlers.GetGroups)
+		org.GET("/groups/:group", handlers.GetGroup)
+		orgAdmin.POST("/groups", handlers.CreateGroup)
+		orgAdmin.PUT("/groups/:group", handlers.UpdateGroup)
+		orgAdmin.DELETE("/groups/:group", handlers.DeleteGroup)
+		orgAdmin.POST("/groups/:group/members", handlers.AddGroupMember)
+		orgAdmin.DELETE("/groups/:group/members/:user_id", handlers.RemoveGroupMember)
+
+		// Posts: los públicos los ve cualquier usuario; solo su autor y los
+		// administradores los modifican
+		protected.GET("/posts", handlers.GetPosts)
+		protected.POST("/posts", handlers.CreatePost)
+		protected.GET("/posts/:id", handlers.GetPost)
+		protected.PUT("/posts/:id", handlers.UpdatePost)
+		protected.DELETE("/posts/:id", handlers.DeletePost)
+		protected.GET("/posts/:id/comments", handlers.GetComments)
+		protected.POST("/posts/:id/comments", handlers.CreateComment)
+		protected.GET("/posts/:id/comments/:comment_id", handlers.GetComment)
+		protected.PUT("/posts/:id/comments/:comment_id", handlers.UpdateComment)
+		protected.DELETE("/posts/:id/comments/:comment_id", handlers.DeleteComment)
+
+		// api generate resource: las rutas de los recursos generados se añaden encima de esta línea
+	}
+
+	// Rutas de administración
+	admin := api.Group("/admin")
+	admin.Use(config.AdminIPMiddleware(), config.AuthMiddleware(), config.AdminMiddleware(), config.UsageMiddleware())
+	{
+		admin.GET("/stats", handlers.GetAdminStats)
+		admin.GET("/stats/signups", handlers.GetSignupStats)
+		admin.GET("/stats/logins", handlers.GetLoginStats)
+		admin.GET("/users/export.csv", handlers.ExportUsers)
+		admin.GET("/users/:id/usage", handlers.GetUserUsage)
+		admin.GET("/users/:id/history", handlers.GetUserHistory)
+		admin.POST("/users/:id/require-password-change", handlers.RequireUserPasswordChange)
+		admin.POST("/users/:id/deactivate", handlers.DeactivateUser)
+		admin.POST("/users/:id/activate", handlers.ActivateUser)
+		admin.POST("/users/:id/restrict", handlers.RestrictUser)
+		admin.POST("/users/:id/unrestrict", handlers.UnrestrictUser)
+		admin.POST("/users/:id/suspend", handlers.SuspendUser)
+		admin.POST("/users/:id/suspension/lift", handlers.LiftUserSuspension)
+		admin.POST("/users/:id/suspension/appeal/reject", handlers.RejectSuspensionAppeal)
+		admin.GET("/users/:id/suspensions", handlers.GetUserSuspensions)
+		admin.GET("/suspensions/appeals", handlers.GetPendingAppeals)
+		admin.GET("/verifications", handlers.GetVerificationRequests)
+		admin.POST("/verifications/:id/approve", handlers.ApproveVerification)
+		admin.POST("/verifications/:id/reject", handlers.RejectVerification)
+		admin.POST("/verifications/:id/revoke", handlers.RevokeVerification)
+		admin.GET("/comments", handlers.GetModerationComments)
+		admin.POST("/comments/:id/hide", handlers.HideComment)
+		admin.POST("/comments/:id/unhide", handlers.UnhideComment)
+		admin.POST("/comments/:id/restore", handlers.RestoreComment)
+		admin.GET("/tags", handlers.GetTags)
+		admin.POST("/tags/bulk", handlers.BulkTagUsers)
+		admin.DELETE("/tags/:tag", handlers.DeleteTag)
+		admin.GET("/users/:id/tags", handlers.GetUserTags)
+		admin.PUT("/users/:id/tags/:tag", handlers.TagUser)
+		admin.DELETE("/users/:id/tags/:tag", handlers.UntagUser)
+		admin.GET("/users/:id/permissions", handlers.GetUserPermissions)
+		admin.GET("/token-exchanges", handlers.GetTokenExchanges)
+		admin.GET("/deprecations", handlers.GetDeprecations)
+		admin.POST("/broadcast", handlers.BroadcastEvent)
+		admin.GET("/export/postman", handlers.ExportPostman)
+		admin.POST("/reports", handlers.RequestReport)
+		admin.GET("/reports/:id", handlers.GetReport)
+		admin.GET("/report-schedules", handlers.GetReportSchedules)
+		admin.POST("/report-schedules", handlers.CreateReportSchedule)
+		admin.PUT("/report-schedules/:id", handlers.UpdateReportSchedule)
+		admin.DELETE("/report-schedules/:id", handlers.DeleteReportSchedule)
+		admin.PUT("/plans/:code", handlers.UpdatePlan)
+		admin.PUT("/users/:id/plan", handlers.AssignUserPlan)
+		admin.GET("/quotas/:scope/:id", handlers.GetQuotas)
+		admin.PUT("/quotas/:scope/:id", handlers.UpdateQuota)
+		admin.DELETE("/quotas/:scope/:id/:name", handlers.ResetQuota)
+		admin.GET("/tenant/quotas", handlers.GetTenantQuotas)
+		admin.GET("/tenant/settings", handlers.GetTenantSettings)
+		admin.PUT("/tenant/settings", handlers.UpdateTenantSettings)
+		admin.GET("/retention", handlers.GetRetentionRules)
+		admin.GET("/retention/runs", handlers.GetRetentionRuns)
+		admin.POST("/retention/run", handlers.RunRetention)
+		admin.GET("/policies", handlers.GetPolicies)
+		admin.POST("/policies", handlers.CreatePolicy)
+		admin.PUT("/policies/:id", handlers.UpdatePolicy)
+		admin.DELETE("/policies/:id", handlers.DeletePolicy)
+		admin.POST("/authz/simulate", handlers.SimulateAuthorization)
+
+		// Operaciones de la instalación completa: no se admiten desde un tenant
+		platform := admin.Group("/", config.PlatformMiddleware())
+		platform.GET("/maintenance", handlers.GetMaintenance)
+		platform.PUT("/maintenance", handlers.UpdateMaintenance)
+		platform.GET("/terms", handlers.GetAdminTerms)
+		platform.PUT("/terms", handlers.UpdateTerms)
+		platform.GET("/circuit-breakers", handlers.GetCircuitBreakers)
+		platform.POST("/backups", handlers.RequestBackup)
+		platform.GET("/backups", handlers.GetBackups)
+		platform.GET("/backups/:id", handlers.GetBackup)
+		platform.GET("/ip-bans", handlers.GetIPBans)
+		platform.POST("/ip-bans", handlers.CreateIPBan)
+		platform.DELETE("/ip-bans/:ip", handlers.LiftIPBan)
+
+		// Tenants: solo los administradores de la plataforma (rol platform_admin)
+		tenants := platform.Group("/tenants", config.PlatformAdminMiddleware())
+		tenants.GET("", handlers.GetTenants)
+		tenants.POST("", handlers.CreateTenant)
+		tenants.GET("/stats", handlers.GetTenantStats)
+		tenants.GET("/events", handlers.GetTenantEvents)
+		tenants.GET("/:slug", handlers.GetTenant)
+		tenants.DELETE("/:slug", handlers.DeleteTenant)
+		tenants.POST("/:slug/suspend", handlers.SuspendTenant)
+		tenants.POST("/:slug/resume", handlers.ResumeTenant)
+		tenants.POST("/:slug/export", handlers.ExportTenant)
+		tenants.GET("/:slug/accesses", handlers.GetTenantAccesses)
+	}
+}
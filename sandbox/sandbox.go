@@ -0,0 +1,200 @@
+// Package sandbox implementa el modo sandbox (SANDBOX_MODE=true): la API usa una
+// base de datos desechable con datos de ejemplo deterministas y deshace las
+// escrituras al terminar cada petición, para integrarse sin tocar datos reales
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"api/auth"
+	"api/database"
+	"api/plans"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Credenciales de las cuentas de ejemplo
+const (
+	Password    = "sandbox123"
+	AdminEmail  = "admin@sandbox.test"
+	DemoEmail   = "demo@sandbox.test"
+	DemoAPIKey  = auth.APIKeyPrefix + "sandbox0demo0key0000000000000000"
+	sampleUsers = 25
+)
+
+// seededAt fecha de creación de todos los datos de ejemplo
+var seededAt = time.Date(2026, time.January, 1, 9, 0, 0, 0, time.UTC)
+
+var (
+	firstNames = []string{"Ana", "Bruno", "Carla", "Diego", "Elena", "Fernando", "Gloria", "Hugo", "Irene", "Javier", "Lucía", "Marcos", "Nuria"}
+	lastNames  = []string{"García", "López", "Martín", "Sánchez", "Romero", "Navarro", "Torres"}
+	planCodes  = []string{plans.Free, plans.Free, plans.Pro, plans.Free, plans.Enterprise}
+)
+
+var (
+	// lock: las lecturas se atienden en paralelo; una escritura en exclusiva
+	// hasta que se restauran los datos
+	lock sync.RWMutex
+
+	hashOnce sync.Once
+	hash     string
+)
+
+type ctxKey struct{}
+
+// Enabled indica si la API se ejecuta en modo sandbox
+func Enabled() bool {
+	return os.Getenv("SANDBOX_MODE") == "true"
+}
+
+// Configure ajusta el entorno antes de inicializar el resto de paquetes: base de
+// datos SQLite propia y archivos en un directorio temporal, sin Stripe, SMTP, Redis ni CAPTCHA
+func Configure() error {
+	dir := filepath.Join(os.TempDir(), "geshuro-sandbox")
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	env := map[string]string{
+		"DB_TYPE":            "sqlite",
+		"DB_NAME":            filepath.Join(dir, "sandbox.db"),
+		"STORAGE_DRIVER":     "local",
+		"STORAGE_LOCAL_PATH": filepath.Join(dir, "uploads"),
+	}
+	for key, value := range env {
+		os.Setenv(key, value)
+	}
+	for _, key := range []string{"STRIPE_SECRET_KEY", "STRIPE_WEBHOOK_SECRET", "SMTP_HOST", "REDIS_URL", "CAPTCHA_PROVIDER", "CAPTCHA_VERIFY_URL"} {
+		os.Unsetenv(key)
+	}
+
+	log.Printf("🧪 Modo sandbox: datos de ejemplo en %s, las escrituras no se conservan", dir)
+	return nil
+}
+
+// Read bloquea las escrituras mientras se atiende una lectura
+func Read() (release func()) {
+	lock.RLock()
+	return lock.RUnlock
+}
+
+// Write atiende una escritura en exclusiva; al liberarla se restauran los datos de ejemplo
+func Write() (release func()) {
+	lock.Lock()
+	return func() {
+		defer lock.Unlock()
+		if err := Reset(); err != nil {
+			log.Printf("❌ No se pudieron restaurar los datos del sandbox: %v", err)
+		}
+	}
+}
+
+// WithLock marca el contexto de una petición que ya tiene el bloqueo, para que
+// sus subpeticiones (lotes) no intenten obtenerlo de nuevo
+func WithLock(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKey{}, true)
+}
+
+// Locked indica si el contexto pertenece a una petición que ya tiene el bloqueo
+func Locked(ctx context.Context) bool {
+	locked, _ := ctx.Value(ctxKey{}).(bool)
+	return locked
+}
+
+// Reset borra todos los datos, salvo los de las sesiones abiertas, y vuelve a
+// crear los de ejemplo
+func Reset() error {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		sequences := tx.Migrator().HasTable("sqlite_sequence")
+		for _, model := range database.Models() {
+			// Se conservan las sesiones (un token sin sesión registrada se
+			// rechaza), sus dispositivos y el registro de accesos: si no, un
+			// inicio de sesión se desharía al terminar la petición
+			switch model.(type) {
+			case *database.Session, *database.Device, *database.LoginEvent:
+				continue
+			}
+			stmt := &gorm.Statement{DB: tx}
+			if err := stmt.Parse(model); err != nil {
+				return err
+			}
+			table := stmt.Schema.Table
+			if err := tx.Exec("DELETE FROM " + stmt.Quote(table)).Error; err != nil {
+				return err
+			}
+			// Los IDs vuelven a empezar tras los datos de ejemplo
+			if sequences {
+				if err := tx.Exec("DELETE FROM sqlite_sequence WHERE name = ?", table).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return seed(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return plans.Seed(context.Background())
+}
+
+// seed crea el administrador, el usuario de demostración (con una clave de API
+// conocida) y usuarios de ejemplo con nombres y planes fijos
+func seed(tx *gorm.DB) error {
+	hashOnce.Do(func() {
+		h, _ := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+		hash = string(h)
+	})
+	if hash == "" {
+		return fmt.Errorf("no se pudo calcular el hash de la contraseña de ejemplo")
+	}
+
+	users := []database.User{
+		{Email: AdminEmail, Name: "Admin Sandbox", Role: "admin", PlanCode: plans.Enterprise},
+		{Email: DemoEmail, Name: "Demo Sandbox", Role: "user", PlanCode: plans.Pro},
+	}
+	for i := 0; i < sampleUsers; i++ {
+		first, last := firstNames[i%len(firstNames)], lastNames[i%len(lastNames)]
+		users = append(users, database.User{
+			Email:    fmt.Sprintf("%s.%s%d@sandbox.test", ascii(first), ascii(last), i+1),
+			Name:     first + " " + last,
+			Role:     "user",
+			PlanCode: planCodes[i%len(planCodes)],
+		})
+	}
+	for i := range users {
+		users[i].ID = uint(i + 1)
+		users[i].Password = hash
+		users[i].IsActive = true
+		users[i].CreatedAt = seededAt.Add(time.Duration(i) * time.Hour)
+		users[i].UpdatedAt = users[i].CreatedAt
+	}
+	if _, err := database.BulkInsert(context.Background(), tx, users); err != nil {
+		return err
+	}
+
+	key := database.APIKey{
+		ID:        1,
+		UserID:    users[1].ID,
+		Name:      "Clave de demostración",
+		Prefix:    DemoAPIKey[:len(auth.APIKeyPrefix)+8],
+		KeyHash:   auth.HashAPIKey(DemoAPIKey),
+		CreatedAt: seededAt,
+	}
+	return tx.Create(&key).Error
+}
+
+// ascii minúsculas sin tildes para las direcciones de correo de ejemplo
+func ascii(s string) string {
+	return strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u").Replace(strings.ToLower(s))
+}
@@ -0,0 +1,39 @@
+package sandbox_test
+
+import (
+	"net/http"
+	"testing"
+
+	"api/apitest"
+	"api/sandbox"
+)
+
+func TestLoginSurvivesReset(t *testing.T) {
+	t.Setenv("SANDBOX_MODE", "true")
+	srv := apitest.New(t)
+	if err := sandbox.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+
+	// El inicio de sesión es una escritura: al terminar se restauran los datos
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.Do(t, http.MethodPost, "/api/v1/auth/login", map[string]string{"email": sandbox.DemoEmail, "password": sandbox.Password}).
+		Expect(t, http.StatusOK).JSON(t, &login)
+
+	var profile struct {
+		User struct {
+			Email string `json:"email"`
+		} `json:"user"`
+	}
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK).JSON(t, &profile)
+	if profile.User.Email != sandbox.DemoEmail {
+		t.Errorf("perfil = %+v", profile)
+	}
+
+	// Otra escritura vuelve a restaurar los datos sin cerrar la sesión
+	srv.Do(t, http.MethodPut, "/api/v1/profile", map[string]string{"bio": "Hola"}, apitest.WithToken(login.Token)).
+		Expect(t, http.StatusOK)
+	srv.Do(t, http.MethodGet, "/api/v1/profile", nil, apitest.WithToken(login.Token)).Expect(t, http.StatusOK)
+}
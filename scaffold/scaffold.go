@@ -0,0 +1,224 @@
+// Package scaffold genera el esqueleto de un recurso CRUD nuevo (modelo,
+// servicio, handlers con anotaciones de Swagger, rutas y pruebas) siguiendo
+// las convenciones del proyecto: api generate resource <nombre>
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// RoutesMarker línea de routes/routes.go encima de la que se añaden las rutas
+// de los recursos generados
+const RoutesMarker = `// api generate resource: las rutas de los recursos generados se añaden encima de esta línea`
+
+// ErrExists alguno de los ficheros del recurso ya existe
+var ErrExists = errors.New("el recurso ya existe")
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9]*([-_][a-z0-9]+)*$`)
+
+// Resource nombres de un recurso en cada contexto, derivados del que se
+// indica en singular (blog-post)
+type Resource struct {
+	// Nombre tal como se indicó
+	Arg string
+	// Tipo en Go: BlogPost y BlogPosts
+	Name   string
+	Plural string
+	// Variable en Go: blogPost
+	Var string
+	// Tabla, secciones de la exportación y ficheros: blog_posts
+	Table string
+	// Ruta de la API: blog-posts
+	Path string
+	// Nombre legible: blog post y blog posts
+	Label       string
+	LabelPlural string
+}
+
+// New deriva los nombres del recurso de name, en singular y en minúsculas con
+// palabras separadas por - o _
+func New(name string) (Resource, error) {
+	name = strings.TrimSpace(name)
+	if !validName.MatchString(name) {
+		return Resource{}, fmt.Errorf("nombre de recurso inválido %q: usa minúsculas, dígitos y - o _ entre palabras", name)
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' })
+	plural := append(append([]string(nil), words[:len(words)-1]...), pluralize(words[len(words)-1]))
+
+	return Resource{
+		Arg:         name,
+		Name:        camel(words),
+		Plural:      camel(plural),
+		Var:         words[0] + camel(words[1:]),
+		Table:       strings.Join(plural, "_"),
+		Path:        strings.Join(plural, "-"),
+		Label:       strings.Join(words, " "),
+		LabelPlural: strings.Join(plural, " "),
+	}, nil
+}
+
+// pluralize plural inglés de una palabra, suficiente para los nombres de los
+// recursos
+func pluralize(word string) string {
+	switch {
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsAny(word[len(word)-2:len(word)-1], "aeiou"):
+		return word[:len(word)-1] + "ies"
+	case strings.HasSuffix(word, "s"), strings.HasSuffix(word, "x"), strings.HasSuffix(word, "z"),
+		strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"):
+		return word + "es"
+	}
+	return word + "s"
+}
+
+func camel(words []string) string {
+	var b strings.Builder
+	for _, w := range words {
+		if w == "id" || w == "url" || w == "api" {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+// file fichero que genera una plantilla, relativo a la raíz del proyecto
+type file struct {
+	template string
+	path     string
+}
+
+func (r Resource) files() []file {
+	return []file{
+		{"model.go.tmpl", filepath.Join("database", r.Table+".go")},
+		{"service.go.tmpl", filepath.Join("services", r.Table+".go")},
+		{"handler.go.tmpl", filepath.Join("handlers", r.Table+".go")},
+		{"test.go.tmpl", filepath.Join("handlers", r.Table+"_test.go")},
+	}
+}
+
+// Generate escribe en el proyecto de root los ficheros del recurso y registra
+// su modelo en database.Models y sus rutas en routes/routes.go. Devuelve las
+// rutas de los ficheros creados y modificados. Si alguno de los ficheros ya
+// existe no escribe nada (ErrExists).
+func Generate(root string, r Resource) ([]string, error) {
+	var paths []string
+	outputs := map[string][]byte{}
+	for _, f := range r.files() {
+		if _, err := os.Stat(filepath.Join(root, f.path)); err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrExists, f.path)
+		}
+		code, err := render(f.template, r)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, f.path)
+		outputs[f.path] = code
+	}
+
+	// Las modificaciones se preparan antes de escribir nada: si los ficheros
+	// no tienen el formato esperado no quedan ficheros sueltos
+	for _, edit := range []struct {
+		path  string
+		apply func(string, Resource) ([]byte, error)
+	}{
+		{filepath.Join("database", "database.go"), registerModel},
+		{filepath.Join("routes", "routes.go"), registerRoutes},
+	} {
+		code, err := edit.apply(filepath.Join(root, edit.path), r)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, edit.path)
+		outputs[edit.path] = code
+	}
+
+	for i, path := range paths {
+		if err := os.WriteFile(filepath.Join(root, path), outputs[path], 0o644); err != nil {
+			return paths[:i], err
+		}
+	}
+	return paths, nil
+}
+
+func render(name string, r Resource) ([]byte, error) {
+	tmpl, err := template.ParseFS(templates, "templates/"+name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, r); err != nil {
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return code, nil
+}
+
+var modelsList = regexp.MustCompile(`(?m)^(\treturn \[\]interface\{\}\{.*)\}$`)
+
+// registerModel añade el modelo al final de la lista de database.Models
+func registerModel(path string, r Resource) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	start := bytes.Index(src, []byte("func Models() []interface{} {"))
+	if start < 0 {
+		return nil, fmt.Errorf("%s: no se encontró la función Models", path)
+	}
+	loc := modelsList.FindSubmatchIndex(src[start:])
+	if loc == nil {
+		return nil, fmt.Errorf("%s: Models no tiene el formato esperado", path)
+	}
+	end := start + loc[3]
+	var out bytes.Buffer
+	out.Write(src[:end])
+	fmt.Fprintf(&out, ", &%s{}", r.Name)
+	out.Write(src[end:])
+	return out.Bytes(), nil
+}
+
+// registerRoutes añade las rutas del recurso encima de RoutesMarker
+func registerRoutes(path string, r Resource) ([]byte, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	at := bytes.Index(src, []byte(RoutesMarker))
+	if at < 0 {
+		return nil, fmt.Errorf("%s: falta la línea %q", path, RoutesMarker)
+	}
+	lineStart := bytes.LastIndexByte(src[:at], '\n') + 1
+	indent := string(src[lineStart:at])
+
+	routes, err := render("routes.go.tmpl", r)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.Write(src[:lineStart])
+	for _, line := range strings.Split(strings.TrimSpace(string(routes)), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "package ") || strings.HasPrefix(line, "func ") || line == "}" {
+			continue
+		}
+		out.WriteString(indent + line + "\n")
+	}
+	out.WriteString("\n")
+	out.Write(src[lineStart:])
+	return format.Source(out.Bytes())
+}
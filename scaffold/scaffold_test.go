@@ -0,0 +1,71 @@
+package scaffold
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		want Resource
+	}{
+		{"post", Resource{Arg: "post", Name: "Post", Plural: "Posts", Var: "post", Table: "posts", Path: "posts", Label: "post", LabelPlural: "posts"}},
+		{"blog-post", Resource{Arg: "blog-post", Name: "BlogPost", Plural: "BlogPosts", Var: "blogPost", Table: "blog_posts", Path: "blog-posts", Label: "blog post", LabelPlural: "blog posts"}},
+		{"api_category", Resource{Arg: "api_category", Name: "APICategory", Plural: "APICategories", Var: "apiCategory", Table: "api_categories", Path: "api-categories", Label: "api category", LabelPlural: "api categories"}},
+		{"box", Resource{Arg: "box", Name: "Box", Plural: "Boxes", Var: "box", Table: "boxes", Path: "boxes", Label: "box", LabelPlural: "boxes"}},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.name)
+		if err != nil || got != tt.want {
+			t.Errorf("New(%q) = %+v, %v", tt.name, got, err)
+		}
+	}
+	for _, name := range []string{"", "Post", "blog post", "1post", "post-"} {
+		if _, err := New(name); err == nil {
+			t.Errorf("New(%q) no falla", name)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"database", "services", "handlers", "routes"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("database/database.go", "package database\n\nfunc Models() []interface{} {\n\treturn []interface{}{&User{}}\n}\n")
+	write("routes/routes.go", "package routes\n\nfunc registerAPI() {\n\t{\n\t\tprotected.GET(\"/profile\", handlers.GetProfile)\n\n\t\t"+RoutesMarker+"\n\t}\n}\n")
+
+	resource, _ := New("blog-post")
+	files, err := Generate(root, resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 6 {
+		t.Errorf("ficheros = %v", files)
+	}
+
+	models, _ := os.ReadFile(filepath.Join(root, "database/database.go"))
+	if !strings.Contains(string(models), "[]interface{}{&User{}, &BlogPost{}}") {
+		t.Errorf("Models:\n%s", models)
+	}
+	routes, _ := os.ReadFile(filepath.Join(root, "routes/routes.go"))
+	if !strings.Contains(string(routes), "\t\tprotected.DELETE(\"/blog-posts/:id\", handlers.DeleteBlogPost)\n\n\t\t"+RoutesMarker) {
+		t.Errorf("rutas:\n%s", routes)
+	}
+
+	// Un recurso que ya existe no se vuelve a generar
+	if _, err := Generate(root, resource); !errors.Is(err, ErrExists) {
+		t.Errorf("segunda generación: %v", err)
+	}
+}
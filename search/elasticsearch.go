@@ -0,0 +1,175 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ElasticsearchConfig conexión con Elasticsearch u OpenSearch; las
+// credenciales son opcionales (usuario y contraseña o clave de API)
+type ElasticsearchConfig struct {
+	URL      string
+	Index    string
+	Username string
+	Password string
+	APIKey   string
+}
+
+// Elasticsearch implementación de Engine sobre la API REST de Elasticsearch,
+// que OpenSearch comparte en las operaciones usadas
+type Elasticsearch struct {
+	cfg    ElasticsearchConfig
+	client *http.Client
+}
+
+// indexMapping el nombre se indexa para búsqueda mientras se escribe y el email
+// y el nombre de usuario como palabras completas en minúsculas, para prefijos
+const indexMapping = `{
+	"settings": {"analysis": {"normalizer": {"lowercase": {"type": "custom", "filter": ["lowercase"]}}}},
+	"mappings": {"properties": {
+		"name": {"type": "search_as_you_type"},
+		"email": {"type": "keyword", "normalizer": "lowercase"},
+		"username": {"type": "keyword", "normalizer": "lowercase"}
+	}}
+}`
+
+// NewElasticsearch crea el cliente; el índice por defecto es "users"
+func NewElasticsearch(cfg ElasticsearchConfig) (*Elasticsearch, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("ELASTICSEARCH_URL es obligatoria para buscar con Elasticsearch u OpenSearch")
+	}
+	if cfg.Index == "" {
+		cfg.Index = "users"
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &Elasticsearch{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// Ping comprueba que el motor responde y que el índice existe
+func (e *Elasticsearch) Ping(ctx context.Context) error {
+	status, err := e.do(ctx, http.MethodHead, "", nil, nil)
+	if err == nil && status == http.StatusNotFound {
+		return fmt.Errorf("el índice %s no existe", e.cfg.Index)
+	}
+	return err
+}
+
+// EnsureIndex crea el índice con su mapping si todavía no existe
+func (e *Elasticsearch) EnsureIndex(ctx context.Context) error {
+	status, err := e.do(ctx, http.MethodHead, "", nil, nil)
+	if err != nil || status == http.StatusOK {
+		return err
+	}
+	_, err = e.do(ctx, http.MethodPut, "", json.RawMessage(indexMapping), nil)
+	return err
+}
+
+func (e *Elasticsearch) Index(ctx context.Context, doc Document) error {
+	_, err := e.do(ctx, http.MethodPut, "/_doc/"+docID(doc.ID), doc, nil)
+	return err
+}
+
+func (e *Elasticsearch) Delete(ctx context.Context, id uint) error {
+	_, err := e.do(ctx, http.MethodDelete, "/_doc/"+docID(id), nil, nil)
+	return err
+}
+
+func (e *Elasticsearch) Search(ctx context.Context, q string, limit int, fuzzy bool) ([]uint, error) {
+	should := []map[string]interface{}{
+		// Las coincidencias por prefijo del nombre pesan más que las parecidas
+		{"multi_match": map[string]interface{}{
+			"query": q, "type": "bool_prefix", "boost": 3,
+			"fields": []string{"name", "name._2gram", "name._3gram"},
+		}},
+		{"prefix": map[string]interface{}{"email": map[string]interface{}{"value": q}}},
+		{"prefix": map[string]interface{}{"username": map[string]interface{}{"value": q}}},
+	}
+	if fuzzy {
+		should = append(should, map[string]interface{}{
+			"match": map[string]interface{}{"name": map[string]interface{}{"query": q, "fuzziness": "AUTO"}},
+		})
+	}
+	query := map[string]interface{}{
+		"size":    limit,
+		"_source": false,
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}},
+	}
+
+	var out struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if _, err := e.do(ctx, http.MethodPost, "/_search", query, &out); err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(out.Hits.Hits))
+	for _, hit := range out.Hits.Hits {
+		if id, err := strconv.ParseUint(hit.ID, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, nil
+}
+
+// do envía una petición al índice (path relativo a él) y decodifica la
+// respuesta en out. Un 404 no es un error: borrar un documento que no existe
+// o comprobar un índice que falta. Devuelve el código de estado.
+func (e *Elasticsearch) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.cfg.URL+"/"+url.PathEscape(e.cfg.Index)+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case e.cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+e.cfg.APIKey)
+	case e.cfg.Username != "":
+		req.SetBasicAuth(e.cfg.Username, e.cfg.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(data, &apiErr)
+		return resp.StatusCode, fmt.Errorf("elasticsearch: %d %s", resp.StatusCode, apiErr.Error.Reason)
+	}
+	if out != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
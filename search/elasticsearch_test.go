@@ -0,0 +1,111 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeCluster servidor que responde como un clúster con el índice indicado
+type fakeCluster struct {
+	requests []string
+	bodies   map[string]string
+	exists   bool
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + r.URL.Path
+	f.requests = append(f.requests, key)
+	body, _ := io.ReadAll(r.Body)
+	f.bodies[key] = string(body)
+	if r.Header.Get("Authorization") != "ApiKey secreta" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch key {
+	case "HEAD /usuarios":
+		if !f.exists {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case "PUT /usuarios":
+		f.exists = true
+		w.Write([]byte(`{"acknowledged":true}`))
+	case "POST /usuarios/_search":
+		w.Write([]byte(`{"hits":{"hits":[{"_id":"7"},{"_id":"3"},{"_id":"x"}]}}`))
+	case "DELETE /usuarios/_doc/404":
+		w.WriteHeader(http.StatusNotFound)
+	case "PUT /usuarios/_doc/9":
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"reason":"mapper_parsing_exception"}}`))
+	default:
+		w.Write([]byte(`{}`))
+	}
+}
+
+func TestElasticsearch(t *testing.T) {
+	cluster := &fakeCluster{bodies: map[string]string{}}
+	srv := httptest.NewServer(cluster)
+	defer srv.Close()
+	engine, err := NewElasticsearch(ElasticsearchConfig{URL: srv.URL + "/", Index: "usuarios", APIKey: "secreta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// El índice se crea una sola vez
+	for i := 0; i < 2; i++ {
+		if err := engine.EnsureIndex(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(cluster.requests, ","); got != "HEAD /usuarios,PUT /usuarios,HEAD /usuarios" {
+		t.Errorf("peticiones = %s", got)
+	}
+	if !strings.Contains(cluster.bodies["PUT /usuarios"], "search_as_you_type") {
+		t.Errorf("mapping = %s", cluster.bodies["PUT /usuarios"])
+	}
+
+	if err := engine.Index(ctx, Document{ID: 5, Name: "Ana", Email: "ana@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := cluster.bodies["PUT /usuarios/_doc/5"]; got != `{"name":"Ana","email":"ana@example.com"}` {
+		t.Errorf("documento = %s", got)
+	}
+	if err := engine.Index(ctx, Document{ID: 9}); err == nil || !strings.Contains(err.Error(), "mapper_parsing_exception") {
+		t.Errorf("err = %v, se esperaba el motivo del clúster", err)
+	}
+	if err := engine.Delete(ctx, 404); err != nil {
+		t.Errorf("borrar un documento que no existe: %v", err)
+	}
+
+	ids, err := engine.Search(ctx, "an", 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != 7 || ids[1] != 3 {
+		t.Errorf("ids = %v, se esperaba [7 3]", ids)
+	}
+	var query struct {
+		Size  int `json:"size"`
+		Query struct {
+			Bool struct {
+				Should []map[string]json.RawMessage `json:"should"`
+			} `json:"bool"`
+		} `json:"query"`
+	}
+	if err := json.Unmarshal([]byte(cluster.bodies["POST /usuarios/_search"]), &query); err != nil {
+		t.Fatal(err)
+	}
+	if query.Size != 5 || len(query.Query.Bool.Should) != 4 {
+		t.Errorf("consulta = %s", cluster.bodies["POST /usuarios/_search"])
+	}
+	engine.Search(ctx, "an", 5, false)
+	json.Unmarshal([]byte(cluster.bodies["POST /usuarios/_search"]), &query)
+	if len(query.Query.Bool.Should) != 3 {
+		t.Errorf("sin búsqueda aproximada la consulta no debe incluir fuzziness: %s", cluster.bodies["POST /usuarios/_search"])
+	}
+}
@@ -0,0 +1,175 @@
+// Package search delega la búsqueda de usuarios en un motor externo
+// (Elasticsearch u OpenSearch) en las instalaciones grandes. El índice se
+// mantiene al día con los eventos de dominio de los usuarios; sin motor
+// configurado services busca directamente en la base de datos.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"api/database"
+	"api/events"
+	"api/health"
+	"api/jobs"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// IndexJob trabajo que actualiza en el índice el documento de un usuario
+const IndexJob = "search.index_user"
+
+// reindexBatch usuarios leídos por consulta al reconstruir el índice
+const reindexBatch = 500
+
+// Document datos de un usuario que se indexan: solo los campos por los que se busca
+type Document struct {
+	ID       uint   `json:"-"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
+}
+
+// Engine motor de búsqueda externo
+type Engine interface {
+	// Index crea o sustituye el documento del usuario
+	Index(ctx context.Context, doc Document) error
+	// Delete quita el usuario del índice (no falla si no estaba)
+	Delete(ctx context.Context, id uint) error
+	// Search devuelve los IDs de los usuarios que encajan con q, los más
+	// relevantes primero; fuzzy incluye los nombres parecidos
+	Search(ctx context.Context, q string, limit int, fuzzy bool) ([]uint, error)
+}
+
+// Default motor configurado; nil si la búsqueda se hace en la base de datos
+var Default Engine
+
+// For motor con el que buscar en ctx. El índice es único, así que los tenants
+// (TENANCY=schema) buscan siempre en su esquema de la base de datos.
+func For(ctx context.Context) Engine {
+	if tenancy.From(ctx) != "" {
+		return nil
+	}
+	return Default
+}
+
+// IndexPayload payload de IndexJob
+type IndexPayload struct {
+	UserID uint `json:"user_id"`
+}
+
+func init() {
+	health.Register("search", func(ctx context.Context) error {
+		engine, ok := Default.(*Elasticsearch)
+		if !ok {
+			return health.ErrDisabled
+		}
+		return engine.Ping(ctx)
+	})
+	// Cada cambio en un usuario se refleja en el índice en segundo plano
+	events.Subscribe(func(ctx context.Context, e events.Event) {
+		if e.UserID == 0 || For(ctx) == nil {
+			return
+		}
+		if err := jobs.Enqueue(ctx, IndexJob, IndexPayload{UserID: e.UserID}); err != nil {
+			log.Printf("⚠️  No se pudo encolar la indexación del usuario %d: %v", e.UserID, err)
+		}
+	})
+}
+
+// Init configura el motor según SEARCH_BACKEND: database (por defecto, sin
+// motor externo) o elasticsearch/opensearch con ELASTICSEARCH_URL
+func Init(ctx context.Context) error {
+	switch backend := os.Getenv("SEARCH_BACKEND"); backend {
+	case "", "database":
+		return nil
+	case "elasticsearch", "opensearch":
+		engine, err := NewElasticsearch(ElasticsearchConfig{
+			URL:      os.Getenv("ELASTICSEARCH_URL"),
+			Index:    os.Getenv("ELASTICSEARCH_INDEX"),
+			Username: os.Getenv("ELASTICSEARCH_USERNAME"),
+			Password: os.Getenv("ELASTICSEARCH_PASSWORD"),
+			APIKey:   os.Getenv("ELASTICSEARCH_API_KEY"),
+		})
+		if err != nil {
+			return err
+		}
+		if err := engine.EnsureIndex(ctx); err != nil {
+			return err
+		}
+		log.Printf("🔎 Búsqueda de usuarios en %s (índice %s)", backend, engine.cfg.Index)
+		Default = engine
+	default:
+		return errors.New("SEARCH_BACKEND desconocido: " + backend)
+	}
+	return nil
+}
+
+// IndexUser trabajo IndexJob: indexa el usuario con sus datos actuales o lo
+// quita del índice si ya no debe aparecer en las búsquedas. Lee siempre de la
+// base de datos, así que el orden en que lleguen los eventos no importa.
+func IndexUser(ctx context.Context, payload []byte) error {
+	if For(ctx) == nil {
+		return nil
+	}
+	var p IndexPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var user database.User
+	err := database.DB.WithContext(ctx).Unscoped().Limit(1).Find(&user, p.UserID).Error
+	if err != nil {
+		return err
+	}
+	if user.ID == 0 || !Searchable(&user) {
+		return Default.Delete(ctx, p.UserID)
+	}
+	return Default.Index(ctx, NewDocument(&user))
+}
+
+// Reindex vuelve a indexar todos los usuarios buscables; sirve para poblar el
+// índice al activar el motor o tras perderlo. Devuelve cuántos indexó.
+func Reindex(ctx context.Context) (int, error) {
+	if Default == nil {
+		return 0, errors.New("no hay ningún motor de búsqueda configurado (SEARCH_BACKEND)")
+	}
+	var total int
+	var users []database.User
+	err := database.DB.WithContext(ctx).Where("is_active = ? AND anonymized_at IS NULL AND deletion_scheduled_at IS NULL", true).
+		FindInBatches(&users, reindexBatch, func(_ *gorm.DB, _ int) error {
+			for i := range users {
+				if err := Default.Index(ctx, NewDocument(&users[i])); err != nil {
+					return err
+				}
+			}
+			total += len(users)
+			return nil
+		}).Error
+	return total, err
+}
+
+// Searchable indica si el usuario debe aparecer en las búsquedas: activo, sin
+// anonimizar, sin eliminación programada y sin borrar
+func Searchable(user *database.User) bool {
+	return user.IsActive && user.AnonymizedAt == nil && user.DeletionScheduledAt == nil && !user.DeletedAt.Valid
+}
+
+// NewDocument prepara el documento del usuario; el email se indexa en
+// minúsculas, como se compara en la base de datos
+func NewDocument(user *database.User) Document {
+	doc := Document{ID: user.ID, Name: user.Name, Email: strings.ToLower(user.Email)}
+	if user.Username != nil {
+		doc.Username = *user.Username
+	}
+	return doc
+}
+
+func docID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
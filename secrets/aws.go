@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"api/sigv4"
+)
+
+// awsProvider lee secretos de AWS Secrets Manager mediante su API JSON firmada con SigV4
+type awsProvider struct {
+	region       string
+	endpoint     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+func newAWSProvider() (Provider, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	p := &awsProvider{
+		region:       region,
+		endpoint:     os.Getenv("AWS_SECRETS_MANAGER_ENDPOINT"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.region == "" || p.accessKey == "" || p.secretKey == "" {
+		return nil, errors.New("AWS_REGION, AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY son obligatorias")
+	}
+	if p.endpoint == "" {
+		p.endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", p.region)
+	}
+	return p, nil
+}
+
+// Fetch devuelve las claves del SecretString (JSON) o el texto completo bajo "value"
+func (p *awsProvider) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	payload, _ := json.Marshal(map[string]string{"SecretId": path})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signer := sigv4.Signer{
+		AccessKeyID:     p.accessKey,
+		SecretAccessKey: p.secretKey,
+		SessionToken:    p.sessionToken,
+		Region:          p.region,
+		Service:         "secretsmanager",
+	}
+	signer.Sign(req, sigv4.HashPayload(payload), time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("secretsmanager: %d %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(out.SecretString), &data); err == nil {
+		values := flatten(data)
+		values["value"] = out.SecretString
+		return values, nil
+	}
+	return map[string]string{"value": out.SecretString}, nil
+}
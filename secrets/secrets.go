@@ -0,0 +1,231 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider obtiene el contenido de un secreto (todas sus claves) por ruta
+type Provider interface {
+	Fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+// Esquemas de referencia admitidos en las variables de entorno:
+//
+//	DB_PASSWORD=vault://secret/data/api#db_password
+//	JWT_SECRET=awssm://prod/api#JWT_SECRET
+var schemes = map[string]func() (Provider, error){
+	"vault": newVaultProvider,
+	"awssm": newAWSProvider,
+}
+
+type cacheEntry struct {
+	values  map[string]string
+	fetched time.Time
+}
+
+var (
+	mu        sync.Mutex
+	providers = map[string]Provider{}
+	cache     = map[string]cacheEntry{}
+	// refs variables de entorno resueltas y su referencia original
+	refs = map[string]string{}
+	// hooks se ejecutan cuando una renovación cambia algún valor
+	hooks []hook
+)
+
+type hook struct {
+	name string
+	fn   func() error
+}
+
+// OnRenew registra una función que vuelve a leer la configuración derivada
+// del entorno (claves, credenciales...) cuando una renovación cambia algún
+// secreto. Los valores ya leídos al arrancar no se actualizan por sí solos.
+func OnRenew(name string, fn func() error) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, hook{name: name, fn: fn})
+}
+
+// Load resuelve todas las variables de entorno que contienen una referencia
+// a un secreto y sustituye su valor en el entorno del proceso
+func Load(ctx context.Context) error {
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if isReference(value) {
+			mu.Lock()
+			refs[name] = value
+			mu.Unlock()
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	if _, err := resolveAll(ctx); err != nil {
+		return err
+	}
+	log.Printf("🔑 %d variables de configuración cargadas desde el gestor de secretos", len(refs))
+	return nil
+}
+
+// StartRenewal vuelve a leer los secretos cada interval para recoger
+// rotaciones sin reiniciar el proceso
+func StartRenewal(ctx context.Context, interval time.Duration) {
+	mu.Lock()
+	n := len(refs)
+	mu.Unlock()
+	if n == 0 || interval <= 0 {
+		return
+	}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				changed, err := resolveAll(ctx)
+				if err != nil {
+					log.Printf("⚠️  Error renovando secretos: %v", err)
+				}
+				if changed > 0 {
+					log.Printf("🔑 %d secretos rotados, recargando configuración", changed)
+					runHooks()
+				}
+			}
+		}
+	}()
+}
+
+// Get resuelve una referencia usando la caché (ttl) del contenido del secreto
+func Get(ctx context.Context, ref string, ttl time.Duration) (string, error) {
+	scheme, path, key, err := parseReference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	cacheKey := scheme + "://" + path
+	mu.Lock()
+	entry, ok := cache[cacheKey]
+	mu.Unlock()
+
+	if !ok || time.Since(entry.fetched) > ttl {
+		p, err := provider(scheme)
+		if err != nil {
+			return "", err
+		}
+		values, err := p.Fetch(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", cacheKey, err)
+		}
+		entry = cacheEntry{values: values, fetched: time.Now()}
+		mu.Lock()
+		cache[cacheKey] = entry
+		mu.Unlock()
+	}
+
+	value, ok := entry.values[key]
+	if !ok {
+		return "", fmt.Errorf("%s no contiene la clave %q", cacheKey, key)
+	}
+	return value, nil
+}
+
+// resolveAll vuelve a leer todos los secretos referenciados, actualiza el
+// entorno y devuelve cuántas variables cambiaron de valor
+func resolveAll(ctx context.Context) (int, error) {
+	mu.Lock()
+	snapshot := make(map[string]string, len(refs))
+	for k, v := range refs {
+		snapshot[k] = v
+	}
+	cache = map[string]cacheEntry{}
+	mu.Unlock()
+
+	changed := 0
+	for name, ref := range snapshot {
+		value, err := Get(ctx, ref, time.Hour)
+		if err != nil {
+			return changed, fmt.Errorf("%s: %w", name, err)
+		}
+		if os.Getenv(name) != value {
+			os.Setenv(name, value)
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+func runHooks() {
+	mu.Lock()
+	list := append([]hook(nil), hooks...)
+	mu.Unlock()
+
+	for _, h := range list {
+		if err := h.fn(); err != nil {
+			log.Printf("⚠️  Error recargando %s tras la rotación: %v", h.name, err)
+		}
+	}
+}
+
+func provider(scheme string) (Provider, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p, ok := providers[scheme]; ok {
+		return p, nil
+	}
+	factory, ok := schemes[scheme]
+	if !ok {
+		return nil, fmt.Errorf("esquema de secreto desconocido: %s", scheme)
+	}
+	p, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	providers[scheme] = p
+	return p, nil
+}
+
+func isReference(value string) bool {
+	scheme, _, ok := strings.Cut(value, "://")
+	_, known := schemes[scheme]
+	return ok && known
+}
+
+// parseReference separa esquema://ruta#clave; sin #clave se usa "value"
+func parseReference(ref string) (scheme, path, key string, err error) {
+	scheme, rest, ok := strings.Cut(ref, "://")
+	if !ok || rest == "" {
+		return "", "", "", fmt.Errorf("referencia de secreto inválida: %q", ref)
+	}
+	path, key, ok = strings.Cut(rest, "#")
+	if !ok || key == "" {
+		key = "value"
+	}
+	return scheme, path, key, nil
+}
+
+// flatten convierte un objeto JSON de secretos en un mapa de strings
+func flatten(data map[string]interface{}) map[string]string {
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		switch t := v.(type) {
+		case string:
+			values[k] = t
+		default:
+			b, _ := json.Marshal(t)
+			values[k] = string(b)
+		}
+	}
+	return values
+}
@@ -0,0 +1,171 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultProvider lee secretos de HashiCorp Vault (KV v1 y v2)
+type vaultProvider struct {
+	addr      string
+	namespace string
+	client    *http.Client
+
+	mu       sync.Mutex
+	token    string
+	roleID   string
+	secretID string
+	expires  time.Time
+	ttl      time.Duration
+	// looked indica si ya se consultó el TTL del token estático (VAULT_TOKEN)
+	looked bool
+}
+
+func newVaultProvider() (Provider, error) {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	if addr == "" {
+		return nil, errors.New("VAULT_ADDR no configurada")
+	}
+	p := &vaultProvider{
+		addr:      addr,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+		token:     os.Getenv("VAULT_TOKEN"),
+		roleID:    os.Getenv("VAULT_ROLE_ID"),
+		secretID:  os.Getenv("VAULT_SECRET_ID"),
+	}
+	if p.token == "" && p.roleID == "" {
+		return nil, errors.New("se requiere VAULT_TOKEN o VAULT_ROLE_ID/VAULT_SECRET_ID")
+	}
+	return p, nil
+}
+
+func (p *vaultProvider) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	token, err := p.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := p.request(ctx, http.MethodGet, "/v1/"+strings.TrimLeft(path, "/"), token, nil, &body); err != nil {
+		return nil, err
+	}
+
+	// KV v2 anida los valores en data.data
+	if inner, ok := body.Data["data"].(map[string]interface{}); ok {
+		if _, hasMeta := body.Data["metadata"]; hasMeta {
+			return flatten(inner), nil
+		}
+	}
+	return flatten(body.Data), nil
+}
+
+// authToken devuelve un token válido, iniciando sesión con AppRole o
+// renovando el token actual cuando está próximo a expirar
+func (p *vaultProvider) authToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Un VAULT_TOKEN estático también caduca: consultar su TTL la primera vez
+	// para renovarlo antes de que expire (TTL 0 = token sin caducidad)
+	if p.roleID == "" && !p.looked {
+		var lookup struct {
+			Data struct {
+				TTL int `json:"ttl"`
+			} `json:"data"`
+		}
+		if err := p.request(ctx, http.MethodGet, "/v1/auth/token/lookup-self", p.token, nil, &lookup); err != nil {
+			return "", fmt.Errorf("consultando token: %w", err)
+		}
+		p.looked = true
+		p.setTTL(lookup.Data.TTL)
+	}
+
+	if p.token != "" && (p.expires.IsZero() || time.Until(p.expires) > p.renewBefore()) {
+		return p.token, nil
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+
+	if p.roleID != "" {
+		payload := map[string]string{"role_id": p.roleID, "secret_id": p.secretID}
+		if err := p.request(ctx, http.MethodPost, "/v1/auth/approle/login", "", payload, &resp); err != nil {
+			return "", fmt.Errorf("login AppRole: %w", err)
+		}
+	} else if err := p.request(ctx, http.MethodPost, "/v1/auth/token/renew-self", p.token, map[string]string{}, &resp); err != nil {
+		return "", fmt.Errorf("renovando token: %w", err)
+	}
+
+	p.token = resp.Auth.ClientToken
+	p.setTTL(resp.Auth.LeaseDuration)
+	return p.token, nil
+}
+
+// setTTL registra la vida del token en segundos (0 = sin caducidad)
+func (p *vaultProvider) setTTL(seconds int) {
+	p.ttl = time.Duration(seconds) * time.Second
+	p.expires = time.Time{}
+	if seconds > 0 {
+		p.expires = time.Now().Add(p.ttl)
+	}
+}
+
+// renewBefore margen con el que se renueva el token: un tercio de su vida,
+// al menos un minuto. Solo se renueva al leer secretos, por lo que
+// SECRETS_REFRESH_INTERVAL debe ser menor que ese margen.
+func (p *vaultProvider) renewBefore() time.Duration {
+	if margin := p.ttl / 3; margin > time.Minute {
+		return margin
+	}
+	return time.Minute
+}
+
+func (p *vaultProvider) request(ctx context.Context, method, path, token string, payload, dest interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.addr+path, body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("vault %s %s: %d %s", method, path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"api/clock"
+	"api/database"
+	"api/events"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAccountDisabled la cuenta está desactivada por un administrador
+	ErrAccountDisabled = errors.New("la cuenta está desactivada")
+	// ErrSelfDeactivation un administrador no puede desactivar su propia cuenta
+	ErrSelfDeactivation = errors.New("no puedes desactivar tu propia cuenta")
+)
+
+// SetUserActive desactiva o reactiva la cuenta indicada. Una cuenta
+// desactivada no puede iniciar sesión y sus tokens, claves de API y tokens
+// OAuth dejan de valer; al desactivarla además se cierran sus sesiones y se
+// revocan sus tokens OAuth, que no vuelven a valer al reactivarla. Las cuentas
+// anonimizadas no se pueden reactivar. Queda en el historial de cambios.
+func SetUserActive(ctx context.Context, actor Identity, id interface{}, active bool) (*database.User, error) {
+	db := database.DB.WithContext(ctx)
+	var user database.User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if !active && user.ID == actor.UserID && actor.ActingTenant == "" {
+		return nil, ErrSelfDeactivation
+	}
+	if user.IsActive == active {
+		return &user, nil
+	}
+
+	before := user
+	user.IsActive = active
+	var closed int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("is_active", active).Error; err != nil {
+			return err
+		}
+		if !active {
+			now := clock.Now()
+			result := tx.Model(&database.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			closed = result.RowsAffected
+			if err := tx.Model(&database.OAuthToken{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return recordChange(tx, actor, &before, &user, ChangeUpdate)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		log.Printf("🔒 Usuario %d desactivado por %d; cerradas %d sesiones", user.ID, actor.UserID, closed)
+	}
+
+	user.Password = ""
+	events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+	return &user, nil
+}
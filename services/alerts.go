@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"api/auth"
+	"api/branding"
+	"api/clock"
+	"api/database"
+	"api/jobs"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// LoginAlertJob trabajo que avisa por correo de un inicio de sesión desde un
+// dispositivo o un país nuevos
+const LoginAlertJob = "alerts.login"
+
+// revokePurpose distingue los tokens de los enlaces "no he sido yo" de los de acceso
+const revokePurpose = "session_revoke"
+
+// ErrInvalidRevokeLink el enlace para cerrar la sesión no es válido o ha caducado
+var ErrInvalidRevokeLink = errors.New("enlace de revocación inválido o caducado")
+
+// LoginAlertPayload datos del trabajo LoginAlertJob
+type LoginAlertPayload struct {
+	SessionID   string `json:"session_id"`
+	NewDevice   bool   `json:"new_device"`
+	NewLocation bool   `json:"new_location"`
+}
+
+// revokeClaims contenido del token del enlace "no he sido yo". Se firma con la
+// misma clave que los de acceso, así que no usa sub ni exp: leído como token de
+// acceso no tendría usuario y estaría caducado.
+type revokeClaims struct {
+	Purpose   string `json:"purpose"`
+	SessionID string `json:"sid"`
+	UserID    uint   `json:"uid"`
+	ExpiresAt int64  `json:"until"`
+}
+
+// checkLoginAlert encola el aviso si la sesión se abrió desde un dispositivo o
+// un país que el usuario no había usado. El primer dispositivo y el primer país
+// conocidos no avisan: no hay nada con qué compararlos.
+func checkLoginAlert(ctx context.Context, user *database.User, session *database.Session, newDevice bool) error {
+	if user.LoginAlertsDisabled && !IsAdmin(user.Role) {
+		return nil
+	}
+	db := database.DB.WithContext(ctx)
+
+	if newDevice && session.DeviceID != nil {
+		var others int64
+		if err := db.Model(&database.Device{}).Where("user_id = ? AND id <> ?", user.ID, *session.DeviceID).Count(&others).Error; err != nil {
+			return err
+		}
+		newDevice = others > 0
+	}
+
+	newLocation := false
+	if session.Country != "" {
+		var known, same int64
+		previous := func() *gorm.DB {
+			return db.Model(&database.Session{}).Where("user_id = ? AND id <> ? AND country <> ''", user.ID, session.ID)
+		}
+		if err := previous().Count(&known).Error; err != nil {
+			return err
+		}
+		if err := previous().Where("country = ?", session.Country).Count(&same).Error; err != nil {
+			return err
+		}
+		newLocation = known > 0 && same == 0
+	}
+
+	if !newDevice && !newLocation {
+		return nil
+	}
+	return jobs.Enqueue(ctx, LoginAlertJob, LoginAlertPayload{SessionID: session.ID, NewDevice: newDevice, NewLocation: newLocation})
+}
+
+// SendLoginAlert envía el correo del trabajo LoginAlertJob con el enlace para
+// cerrar la sesión si el usuario no la reconoce
+func SendLoginAlert(ctx context.Context, payload []byte) error {
+	var p LoginAlertPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	var session database.Session
+	if err := database.DB.WithContext(ctx).First(&session, "id = ?", p.SessionID).Error; err != nil {
+		return err
+	}
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, session.UserID).Error; err != nil {
+		return err
+	}
+	device := "Desconocido"
+	if session.DeviceID != nil {
+		var d database.Device
+		if err := database.DB.WithContext(ctx).First(&d, *session.DeviceID).Error; err == nil {
+			device = fmt.Sprintf("%s en %s (%s)", d.Browser, d.OS, d.Type)
+		}
+	}
+	country := session.Country
+	if country == "" {
+		country = "Desconocido"
+	}
+
+	token, err := auth.Sign(revokeClaims{
+		Purpose:   revokePurpose,
+		SessionID: session.ID,
+		UserID:    user.ID,
+		ExpiresAt: session.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	link := tenancy.Link(ctx, fmt.Sprintf("%s/api/v1/auth/sessions/revoke?token=%s", appURL(), url.QueryEscape(token)))
+
+	var reasons []string
+	if p.NewDevice {
+		reasons = append(reasons, "un dispositivo nuevo")
+	}
+	if p.NewLocation {
+		reasons = append(reasons, "un país nuevo")
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hola %s,\n\nSe ha iniciado sesión en tu cuenta desde %s:\n\n", user.Name, strings.Join(reasons, " y "))
+	fmt.Fprintf(&body, "  Dispositivo: %s\n  País: %s\n  IP: %s\n  Fecha: %s\n\n",
+		device, country, session.IP, session.CreatedAt.Format("02/01/2006 15:04 MST"))
+	fmt.Fprintf(&body, "Si has sido tú, no tienes que hacer nada. Si no, cierra esa sesión desde este enlace y cambia tu contraseña:\n\n%s\n", link)
+	if !IsAdmin(user.Role) {
+		body.WriteString("\nPuedes desactivar estos avisos en tu perfil (login_alerts_disabled).\n")
+	}
+	return branding.Send(ctx, user.Email, "Nuevo inicio de sesión en tu cuenta", body.String())
+}
+
+// RevokeSessionFromLink cierra la sesión del enlace "no he sido yo" del aviso
+func RevokeSessionFromLink(ctx context.Context, token string) error {
+	var claims revokeClaims
+	if err := auth.Verify(token, &claims); err != nil {
+		return ErrInvalidRevokeLink
+	}
+	if claims.Purpose != revokePurpose || clock.Now().Unix() >= claims.ExpiresAt {
+		return ErrInvalidRevokeLink
+	}
+	if err := RevokeSession(ctx, claims.UserID, claims.SessionID); err != nil {
+		return err
+	}
+	// El dispositivo de esa sesión deja de ser de confianza, si lo era
+	var session database.Session
+	if err := database.DB.WithContext(ctx).First(&session, "id = ?", claims.SessionID).Error; err == nil && session.DeviceID != nil {
+		if err := UntrustDevice(ctx, claims.UserID, *session.DeviceID); err != nil {
+			log.Printf("⚠️  No se pudo retirar la confianza del dispositivo %d: %v", *session.DeviceID, err)
+		}
+	}
+	log.Printf("🔒 Sesión %s del usuario %d cerrada desde el aviso de inicio de sesión", claims.SessionID, claims.UserID)
+	return nil
+}
+
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return "http://localhost:8080"
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"api/auth"
+	"api/database"
+	"api/iplist"
+	"api/tenancy"
+)
+
+var (
+	// ErrInvalidAPIKey la clave de API no existe, está revocada o su usuario ya no existe
+	ErrInvalidAPIKey = errors.New("clave de API inválida o revocada")
+	// ErrInactiveUser el usuario está desactivado, eliminado o pendiente de eliminación
+	ErrInactiveUser = errors.New("usuario inactivo o eliminado")
+	// ErrIPNotAllowed la clave de API no se puede usar desde la IP del cliente
+	ErrIPNotAllowed = errors.New("la clave de API no admite peticiones desde esta IP")
+	// ErrSessionRevoked la sesión del token se revocó
+	ErrSessionRevoked = errors.New("sesión revocada")
+	// ErrWrongTenant el token se emitió para otro tenant
+	ErrWrongTenant = errors.New("el token pertenece a otro tenant")
+)
+
+// Identity usuario autenticado por un token JWT o una clave de API
+type Identity struct {
+	UserID   uint
+	Role     string
+	APIKeyID uint
+	Claims   *auth.Claims
+	// Aplicación OAuth y scopes concedidos, si se autenticó con un token OAuth
+	OAuthClientID uint
+	Scopes        []string
+	// Zona horaria del usuario para presentar las fechas ("" = UTC)
+	Timezone string
+	// Permisos del token para autorizar sin evaluar las políticas, si están al
+	// día; StalePermissions si cambiaron desde que se emitió y hay que renovarlo
+	Permissions      []string
+	StalePermissions bool
+	// Administrador de la plataforma (RolePlatformAdmin); Role es admin
+	PlatformAdmin bool
+	// Tenant en el que actúa el administrador de la plataforma; UserID es el
+	// de su usuario en el esquema public
+	ActingTenant string
+	// La contraseña caducó o un administrador exige cambiarla: la sesión solo
+	// sirve para hacerlo (ver PasswordExpired)
+	PasswordChangeRequired bool
+	// Suspensión en curso: solo se puede consultar y apelar (ver SuspendUser)
+	Suspension *SuspensionNotice
+	// Cuenta restringida: solo puede consultar (ver RestrictUser)
+	Restricted bool
+	// No ha aceptado los términos de uso vigentes: la sesión solo sirve para
+	// aceptarlos (ver AcceptTerms)
+	TermsPending bool
+}
+
+// RolePlatformAdmin rol de los administradores de la plataforma. Solo cuenta
+// en el esquema public: administran los tenants y pueden actuar en cualquiera
+// de ellos con la cabecera X-Tenant. Fuera de eso tienen los permisos de admin.
+const RolePlatformAdmin = "platform_admin"
+
+// IsAdmin indica si el rol tiene permisos de administración
+func IsAdmin(role string) bool {
+	return role == "admin" || role == RolePlatformAdmin
+}
+
+// AuthenticateToken valida un token JWT o una clave de API (gk_...). El rol se
+// toma de la base de datos, no de los claims, para que los cambios de rol y
+// las desactivaciones tengan efecto sin esperar a que caduque el token.
+// ip es la del cliente, para las claves limitadas a ciertas IPs.
+func AuthenticateToken(ctx context.Context, token, ip string) (*Identity, error) {
+	if auth.IsAPIKey(token) {
+		return AuthenticateAPIKey(ctx, token, ip)
+	}
+
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	// Los IDs de usuario se repiten entre los esquemas de los tenants
+	tenant := tenancy.From(ctx)
+	if claims.Tenant != tenant {
+		if claims.Tenant == "" {
+			return actInTenant(ctx, claims)
+		}
+		return nil, ErrWrongTenant
+	}
+	user, err := activeUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := touchSession(ctx, claims, user.Role); err != nil {
+		return nil, err
+	}
+	suspension, err := suspensionNotice(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	identity := &Identity{
+		UserID: user.ID, Role: user.Role, Claims: claims, Timezone: user.Timezone,
+		PasswordChangeRequired: PasswordExpired(user), Suspension: suspension, Restricted: user.RestrictedAt != nil,
+		TermsPending: TermsPending(user),
+	}
+	// La versión llega con el usuario que ya se lee: comprobarla no cuesta consultas
+	if claims.PermVersion == user.PermVersion {
+		identity.Permissions = claims.Permissions
+	} else {
+		identity.StalePermissions = true
+	}
+	if user.Role == RolePlatformAdmin && tenant == "" {
+		identity.Role, identity.PlatformAdmin = "admin", true
+	}
+	return identity, nil
+}
+
+// RefreshToken emite para la misma sesión que claims un token con el rol y los
+// permisos actuales del usuario, p. ej. cuando cambiaron (StalePermissions).
+// La sesión y la caducidad no cambian.
+func RefreshToken(ctx context.Context, claims *auth.Claims) (string, error) {
+	if claims.Tenant != tenancy.From(ctx) {
+		return "", ErrWrongTenant
+	}
+	user, err := activeUser(ctx, claims.UserID)
+	if err != nil {
+		return "", err
+	}
+	if err := touchSession(ctx, claims, user.Role); err != nil {
+		return "", err
+	}
+	refreshed := *claims
+	refreshed.Role = user.Role
+	refreshed.Permissions, refreshed.PermVersion = tokenPermissions(ctx, user.ID), user.PermVersion
+	return auth.Sign(refreshed)
+}
+
+// actInTenant autentica en el tenant de ctx un token del esquema public: solo
+// se acepta si es de un administrador de la plataforma
+func actInTenant(ctx context.Context, claims *auth.Claims) (*Identity, error) {
+	public := tenancy.With(ctx, "")
+	user, err := activeUser(public, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != RolePlatformAdmin {
+		return nil, ErrWrongTenant
+	}
+	if err := touchSession(public, claims, user.Role); err != nil {
+		return nil, err
+	}
+	return &Identity{
+		UserID: user.ID, Role: "admin", Claims: claims, Timezone: user.Timezone,
+		PlatformAdmin: true, ActingTenant: tenancy.From(ctx), PasswordChangeRequired: PasswordExpired(user),
+	}, nil
+}
+
+// APIKeyRole rol con el que actúan las claves de API. Una clave nunca hereda
+// el rol admin de su propietario: la administración requiere iniciar sesión.
+const APIKeyRole = "user"
+
+// AuthenticateAPIKey valida una clave de API y devuelve la identidad de su
+// propietario con el rol limitado a APIKeyRole. Si la clave tiene IPs
+// permitidas, ip (la del cliente) debe estar entre ellas.
+func AuthenticateAPIKey(ctx context.Context, key, ip string) (*Identity, error) {
+	var apiKey database.APIKey
+	if err := database.DB.WithContext(ctx).Where("key_hash = ? AND revoked_at IS NULL", auth.HashAPIKey(key)).First(&apiKey).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if len(apiKey.AllowedIPs) > 0 && !iplist.Contains(apiKey.AllowedIPs, ip) {
+		return nil, ErrIPNotAllowed
+	}
+
+	user, err := activeUser(ctx, apiKey.UserID)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	suspension, err := suspensionNotice(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		UserID: user.ID, Role: APIKeyRole, APIKeyID: apiKey.ID, Timezone: user.Timezone,
+		Suspension: suspension, Restricted: user.RestrictedAt != nil,
+	}, nil
+}
+
+// activeUser carga el usuario si puede seguir autenticándose: no borrado, activo,
+// sin anonimizar y sin eliminación programada (iniciar sesión la cancela)
+func activeUser(ctx context.Context, id uint) (*database.User, error) {
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, ErrInactiveUser
+	}
+	if !user.IsActive || user.AnonymizedAt != nil || user.DeletionScheduledAt != nil {
+		return nil, ErrInactiveUser
+	}
+	return &user, nil
+}
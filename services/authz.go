@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"api/authz"
+	"api/database"
+
+	"gorm.io/gorm"
+)
+
+// Acciones sobre las cuentas que decide el motor de políticas
+const (
+	ActionUsersRead   = "users:read"
+	ActionUsersUpdate = "users:update"
+	ActionUsersDelete = "users:delete"
+)
+
+// actions acciones que deciden las políticas, para los permisos efectivos
+var actions = []string{ActionUsersRead, ActionUsersUpdate, ActionUsersDelete}
+
+// Origen de un permiso efectivo
+const (
+	PermissionFromRole       = "role"
+	PermissionFromMembership = "membership"
+	PermissionFromGroup      = "group"
+	PermissionFromPolicy     = "policy"
+)
+
+// ErrUnknownResource el recurso no es tipo/ID de un tipo que decidan las políticas
+var ErrUnknownResource = errors.New("recurso desconocido: se esperaba tipo/ID, p. ej. users/42")
+
+// resourceTypes atributos de cada tipo de recurso que deciden las políticas
+var resourceTypes = map[string]func(ctx context.Context, id uint) authz.Attributes{
+	"users": UserAttributes,
+}
+
+func init() {
+	authz.Register(authz.Policy{
+		Name:        "admins",
+		Description: "Los administradores pueden hacer cualquier acción",
+		Effect:      authz.Allow,
+		Actions:     []string{"*"},
+		Condition:   "actor.admin == true",
+	})
+	// Los permisos de los tokens se calculan con las políticas vigentes
+	authz.OnChange(func(ctx context.Context) error {
+		db := database.DB.WithContext(ctx)
+		return bumpPermVersion(db, db.Model(&database.User{}).Select("id"))
+	})
+	authz.Register(authz.Policy{
+		Name:        "owner",
+		Description: "Cada usuario lee, modifica y elimina su propia cuenta",
+		Effect:      authz.Allow,
+		Actions:     []string{ActionUsersRead, ActionUsersUpdate, ActionUsersDelete},
+		Condition:   `resource.type == "users" and resource.id == actor.id`,
+	})
+}
+
+// AuthorizeAction decide con el motor de políticas si actor puede hacer
+// action sobre resource; ErrForbidden si no. Si el token del actor incluye
+// la acción entre sus permisos al día se permite sin evaluar las políticas.
+func AuthorizeAction(ctx context.Context, actor Identity, action string, resource authz.Attributes) error {
+	for _, p := range actor.Permissions {
+		if p == action {
+			return nil
+		}
+	}
+	decision, err := authz.Evaluate(ctx, authz.Request{Action: action, Actor: ActorAttributes(ctx, actor), Resource: resource})
+	if err != nil {
+		return err
+	}
+	if !decision.Allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeUser comprobación central de acceso a las cuentas: la aplican
+// config.UserAccessMiddleware en REST, los resolvers de GraphQL, gRPC y las
+// operaciones de services sobre una cuenta indicada por ID
+func AuthorizeUser(ctx context.Context, actor Identity, action string, userID uint) error {
+	return AuthorizeAction(ctx, actor, action, UserAttributes(ctx, userID))
+}
+
+// ResourceAttributes atributos del recurso ref (tipo/ID, p. ej. users/42)
+func ResourceAttributes(ctx context.Context, ref string) (authz.Attributes, error) {
+	kind, rawID, _ := strings.Cut(ref, "/")
+	attributes, ok := resourceTypes[kind]
+	id, err := strconv.ParseUint(rawID, 10, 64)
+	if !ok || err != nil {
+		return nil, ErrUnknownResource
+	}
+	return attributes(ctx, uint(id)), nil
+}
+
+// Can indica si actor puede hacer action sobre resource (tipo/ID), con la
+// misma decisión que se aplicará al hacerla
+func Can(ctx context.Context, actor Identity, action, resource string) (bool, error) {
+	attributes, err := ResourceAttributes(ctx, resource)
+	if err != nil {
+		return false, err
+	}
+	err = AuthorizeAction(ctx, actor, action, attributes)
+	if errors.Is(err, ErrForbidden) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SimulateAccess explica si el usuario userID podría hacer action sobre
+// resource y qué política lo decidiría, con los borradores drafts añadidos a
+// las políticas vigentes. No se aplica nada.
+func SimulateAccess(ctx context.Context, userID uint, action, resource string, drafts []authz.Policy) (*authz.Simulation, error) {
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	attributes, err := ResourceAttributes(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+	actor := ActorAttributes(ctx, Identity{UserID: user.ID, Role: user.Role})
+	return authz.Simulate(ctx, authz.Request{Action: action, Actor: actor, Resource: attributes}, drafts)
+}
+
+// Permission permiso efectivo de un usuario con la regla que lo concede
+type Permission struct {
+	// Acción (users:update), admin (API de administración) o rol en una
+	// organización (orgs/acme:admin)
+	Permission string `json:"permission" example:"users:update"`
+	// allow, o deny si una política lo deniega
+	Effect string `json:"effect" example:"allow"`
+	// all, o conditional si depende de los atributos del recurso
+	Scope string `json:"scope" example:"conditional"`
+	// role, membership, group o policy
+	Source string `json:"source" example:"policy"`
+	// Rol, organización, grupo (acme/engineering) o política que lo concede
+	Rule      string `json:"rule" example:"owner"`
+	Condition string `json:"condition,omitempty"`
+	// Atributos del usuario que usa la condición de la política
+	Actor authz.Attributes `json:"actor,omitempty"`
+}
+
+// EffectivePermissions permisos efectivos de un usuario
+type EffectivePermissions struct {
+	UserID      uint         `json:"user_id"`
+	Role        string       `json:"role"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// UserPermissions resuelve los permisos efectivos del usuario userID: los de
+// su rol global, su rol en cada organización (propio y de sus grupos) y las
+// acciones que le conceden o deniegan las políticas, cada uno con su origen
+func UserPermissions(ctx context.Context, userID uint) (*EffectivePermissions, error) {
+	db := database.DB.WithContext(ctx)
+	var user database.User
+	if err := db.Select("id", "role").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	result := &EffectivePermissions{UserID: user.ID, Role: user.Role, Permissions: []Permission{}}
+	if IsAdmin(user.Role) {
+		result.Permissions = append(result.Permissions, Permission{
+			Permission: "admin", Effect: authz.Allow, Scope: authz.ScopeAll, Source: PermissionFromRole, Rule: user.Role,
+		})
+	}
+
+	var memberships []struct{ Slug, Role string }
+	err := db.Model(&database.Membership{}).
+		Select("organizations.slug, memberships.role").
+		Joins("JOIN organizations ON organizations.id = memberships.organization_id").
+		Where("memberships.user_id = ?", userID).
+		Order("organizations.slug").
+		Scan(&memberships).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range memberships {
+		result.Permissions = append(result.Permissions, Permission{
+			Permission: "orgs/" + m.Slug + ":" + m.Role, Effect: authz.Allow, Scope: authz.ScopeAll,
+			Source: PermissionFromMembership, Rule: m.Slug,
+		})
+	}
+	var groups []struct{ Org, Slug, Role string }
+	err = db.Model(&database.Group{}).
+		Select("organizations.slug AS org, org_groups.slug, org_groups.role").
+		Joins("JOIN group_members ON group_members.group_id = org_groups.id").
+		Joins("JOIN organizations ON organizations.id = org_groups.organization_id").
+		Where("group_members.user_id = ?", userID).
+		Order("organizations.slug, org_groups.slug").
+		Scan(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		result.Permissions = append(result.Permissions, Permission{
+			Permission: "orgs/" + g.Org + ":" + g.Role, Effect: authz.Allow, Scope: authz.ScopeAll,
+			Source: PermissionFromGroup, Rule: g.Org + "/" + g.Slug,
+		})
+	}
+
+	grants, err := authz.Grants(ctx, ActorAttributes(ctx, Identity{UserID: user.ID, Role: user.Role}), actions)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range grants {
+		result.Permissions = append(result.Permissions, Permission{
+			Permission: g.Action, Effect: g.Effect, Scope: g.Scope, Source: PermissionFromPolicy,
+			Rule: g.Policy, Condition: g.Condition, Actor: g.Actor,
+		})
+	}
+	return result, nil
+}
+
+// tokenPermissions permisos del usuario que se incluyen en sus tokens: los
+// concedidos para cualquier recurso que ninguna política deniega
+func tokenPermissions(ctx context.Context, userID uint) []string {
+	effective, err := UserPermissions(ctx, userID)
+	if err != nil {
+		log.Printf("⚠️  No se pudieron calcular los permisos del token del usuario %d: %v", userID, err)
+		return nil
+	}
+	denied := map[string]bool{}
+	for _, p := range effective.Permissions {
+		if p.Effect == authz.Deny {
+			denied[p.Permission] = true
+		}
+	}
+	var list []string
+	for _, p := range effective.Permissions {
+		if p.Effect == authz.Allow && p.Scope == authz.ScopeAll && !denied[p.Permission] {
+			denied[p.Permission] = true // sin repetir
+			list = append(list, p.Permission)
+		}
+	}
+	return list
+}
+
+// bumpPermVersion aumenta la versión de los permisos de users (IDs o una
+// subconsulta de IDs): sus tokens dejan de autorizar sin evaluar las políticas
+// hasta que se renuevan
+func bumpPermVersion(tx *gorm.DB, users interface{}) error {
+	return tx.Model(&database.User{}).Where("id IN (?)", users).
+		UpdateColumn("perm_version", gorm.Expr("perm_version + 1")).Error
+}
+
+// ActorAttributes atributos de actor para las condiciones de las políticas:
+// id, role, admin, api_key, oauth, orgs (identificadores de sus
+// organizaciones), admin_orgs (en las que tiene el rol admin) y groups
+// (organización/grupo)
+func ActorAttributes(ctx context.Context, actor Identity) authz.Attributes {
+	orgs := orgAttributes(ctx, actor.UserID)
+	return authz.Attributes{
+		"id":         actor.UserID,
+		"role":       actor.Role,
+		"admin":      IsAdmin(actor.Role),
+		"api_key":    actor.APIKeyID != 0,
+		"oauth":      actor.OAuthClientID != 0,
+		"orgs":       authz.Lazy(func() interface{} { return orgs().slugs }),
+		"admin_orgs": authz.Lazy(func() interface{} { return orgs().admin }),
+		"groups":     authz.Lazy(func() interface{} { return orgs().groups }),
+	}
+}
+
+// UserAttributes atributos de la cuenta userID como recurso: type (users),
+// id, role, is_active y orgs. Los que requieren consultas solo se leen si
+// alguna condición los usa.
+func UserAttributes(ctx context.Context, userID uint) authz.Attributes {
+	var user *database.User
+	loadUser := func() *database.User {
+		if user == nil {
+			user = &database.User{}
+			if err := database.DB.WithContext(ctx).Select("id", "role", "is_active").First(user, userID).Error; err != nil {
+				user = &database.User{}
+			}
+		}
+		return user
+	}
+	orgs := orgAttributes(ctx, userID)
+	return authz.Attributes{
+		"type":      "users",
+		"id":        userID,
+		"role":      authz.Lazy(func() interface{} { return loadUser().Role }),
+		"is_active": authz.Lazy(func() interface{} { return loadUser().IsActive }),
+		"orgs":      authz.Lazy(func() interface{} { return orgs().slugs }),
+	}
+}
+
+type userOrgs struct {
+	slugs, admin, groups []string
+}
+
+// orgAttributes carga una sola vez, cuando se pide, las organizaciones del
+// usuario con su rol efectivo y sus grupos
+func orgAttributes(ctx context.Context, userID uint) func() userOrgs {
+	var loaded *userOrgs
+	return func() userOrgs {
+		if loaded != nil {
+			return *loaded
+		}
+		loaded = &userOrgs{slugs: []string{}, admin: []string{}, groups: []string{}}
+		if userID == 0 {
+			return *loaded
+		}
+		list, err := ListUserOrganizations(ctx, userID)
+		if err != nil {
+			log.Printf("⚠️  No se pudieron leer las organizaciones del usuario %d para autorizar: %v", userID, err)
+			return *loaded
+		}
+		for _, org := range list {
+			loaded.slugs = append(loaded.slugs, org.Slug)
+			if org.Role == OrgRoleAdmin {
+				loaded.admin = append(loaded.admin, org.Slug)
+			}
+			for _, group := range org.Groups {
+				loaded.groups = append(loaded.groups, org.Slug+"/"+group)
+			}
+		}
+		return *loaded
+	}
+}
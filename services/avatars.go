@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"api/database"
+	"api/images"
+	"api/storage"
+)
+
+// avatarURLTTL validez de las URLs firmadas de los avatares subidos
+const avatarURLTTL = time.Hour
+
+// avatarSize tamaño en píxeles de la imagen de AvatarURL (el de la variante thumb)
+const avatarSize = 128
+
+// AvatarURL devuelve una URL lista para mostrar el avatar del usuario: la
+// variante thumb del avatar subido (URL firmada) o, si no tiene o aún se está
+// procesando, la de Gravatar con la imagen generada de respaldo
+func AvatarURL(ctx context.Context, user *database.User) string {
+	if user.AvatarThumbKey != "" {
+		if url, err := storage.Default.SignedURL(ctx, user.AvatarThumbKey, avatarURLTTL); err == nil {
+			return url
+		}
+	}
+	return images.GravatarURL(user.Email, avatarSize)
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"api/captcha"
+	"api/clock"
+	"api/database"
+	"api/risk"
+)
+
+// Operaciones protegidas por CAPTCHA
+const (
+	CaptchaRegister = "register"
+	CaptchaLogin    = "login"
+)
+
+var (
+	// ErrCaptchaRequired la operación exige CAPTCHA y la petición no lo incluye
+	ErrCaptchaRequired = errors.New("se requiere verificación CAPTCHA")
+	// ErrCaptchaInvalid el token del CAPTCHA no es válido
+	ErrCaptchaInvalid = errors.New("verificación CAPTCHA no superada")
+)
+
+// CheckCaptcha exige un CAPTCHA válido en el registro y, tras varios intentos
+// fallidos recientes para el mismo email, en el login. Las claves de API de
+// CAPTCHA_TRUSTED_API_KEYS (IDs separados por comas) quedan exentas.
+func CheckCaptcha(ctx context.Context, action, email string, meta LoginMeta) error {
+	if !captcha.Enabled() || trustedAPIKey(ctx, meta.APIKey, meta.IP) {
+		return nil
+	}
+
+	switch action {
+	case CaptchaRegister:
+		if !captcha.RequiredOnRegister() {
+			return nil
+		}
+	case CaptchaLogin:
+		var failures int64
+		// Los intentos pendientes de verificación (riesgo) no son contraseñas fallidas
+		err := database.DB.WithContext(ctx).Model(&database.LoginEvent{}).
+			Where("LOWER(email) = LOWER(?) AND success = ? AND created_at > ?", email, false, clock.Now().Add(-captcha.LoginWindow())).
+			Where("COALESCE(risk_decision, '') <> ?", risk.Challenge).
+			Count(&failures).Error
+		if err != nil {
+			return err
+		}
+		if failures < int64(captcha.LoginFailures()) {
+			return nil
+		}
+	}
+
+	err := captcha.Verify(ctx, meta.CaptchaToken, meta.IP)
+	switch {
+	case errors.Is(err, captcha.ErrMissingToken):
+		return ErrCaptchaRequired
+	case errors.Is(err, captcha.ErrRejected):
+		return ErrCaptchaInvalid
+	case err != nil:
+		// Si el proveedor no responde se rechaza la petición: dejar pasar sin
+		// verificar anularía la protección justo cuando se la intenta saturar
+		log.Printf("❌ Error verificando el CAPTCHA: %v", err)
+		return ErrCaptchaInvalid
+	}
+	return nil
+}
+
+// trustedAPIKey indica si la clave es válida y está en CAPTCHA_TRUSTED_API_KEYS
+func trustedAPIKey(ctx context.Context, key, ip string) bool {
+	if key == "" {
+		return false
+	}
+	trusted := os.Getenv("CAPTCHA_TRUSTED_API_KEYS")
+	if trusted == "" {
+		return false
+	}
+	identity, err := AuthenticateAPIKey(ctx, key, ip)
+	if err != nil {
+		return false
+	}
+	for _, id := range strings.Split(trusted, ",") {
+		if strings.TrimSpace(id) == strconv.FormatUint(uint64(identity.APIKeyID), 10) {
+			return true
+		}
+	}
+	return false
+}
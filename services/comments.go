@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/preload"
+
+	"gorm.io/gorm"
+)
+
+// Estados de los comentarios para la moderación
+const (
+	CommentVisible = "visible"
+	CommentHidden  = "hidden"
+	CommentDeleted = "deleted"
+)
+
+var (
+	// ErrCommentNotFound no existe, está eliminado o el usuario no puede verlo
+	ErrCommentNotFound = errors.New("comentario no encontrado")
+	// ErrCommentForbidden el usuario puede ver el comentario pero no modificarlo
+	ErrCommentForbidden = errors.New("no puedes modificar este comentario")
+)
+
+func init() {
+	exports.RegisterSection("comments", func(ctx context.Context, userID uint) (interface{}, error) {
+		var comments []database.Comment
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&comments).Error
+		return comments, err
+	})
+	// Los comentarios en los posts del usuario se eliminan con los posts
+	accounts.RegisterCleanup("comments", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&database.Comment{}).Error
+	})
+	preload.Register("comments", "author", preload.Relation{Fetch: fetchCommentAuthors})
+}
+
+// commentScope limita la consulta a los comentarios no eliminados del post que
+// puede ver actor: los no ocultos y los suyos o, si es administrador, todos
+func commentScope(ctx context.Context, actor Identity, postID uint) *gorm.DB {
+	db := database.DB.WithContext(ctx).Model(&database.Comment{}).Where("post_id = ?", postID)
+	if !IsAdmin(actor.Role) {
+		db = db.Where("hidden_at IS NULL OR user_id = ?", actor.UserID)
+	}
+	return db
+}
+
+// ListComments devuelve los comentarios del post que puede ver actor, los más
+// antiguos primero. ErrPostNotFound si no puede ver el post.
+func ListComments(ctx context.Context, actor Identity, postID uint, offset, limit int) ([]database.Comment, database.Total, error) {
+	if _, err := GetPost(ctx, actor, postID); err != nil {
+		return nil, database.Total{}, err
+	}
+	query := commentScope(ctx, actor, postID)
+	total, err := database.Count(query)
+	if err != nil {
+		return nil, total, err
+	}
+	var comments []database.Comment
+	if err := query.Order("created_at, id").Offset(offset).Limit(limit).Find(&comments).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+	return comments, total, nil
+}
+
+// GetComment devuelve el comentario del post si actor puede ver ambos
+func GetComment(ctx context.Context, actor Identity, postID, id uint) (*database.Comment, error) {
+	if _, err := GetPost(ctx, actor, postID); err != nil {
+		return nil, err
+	}
+	return scopedComment(ctx, actor, postID, id)
+}
+
+func scopedComment(ctx context.Context, actor Identity, postID, id uint) (*database.Comment, error) {
+	var comment database.Comment
+	if err := commentScope(ctx, actor, postID).First(&comment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// CreateComment publica un comentario de actor en un post que puede ver
+func CreateComment(ctx context.Context, actor Identity, postID uint, body string) (*database.Comment, error) {
+	if _, err := GetPost(ctx, actor, postID); err != nil {
+		return nil, err
+	}
+	comment := database.Comment{PostID: postID, UserID: actor.UserID, Body: body}
+	if err := database.DB.WithContext(ctx).Create(&comment).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// UpdateComment sustituye el texto del comentario; solo su autor. Si estaba
+// oculto sigue oculto.
+func UpdateComment(ctx context.Context, actor Identity, postID, id uint, body string) (*database.Comment, error) {
+	comment, err := GetComment(ctx, actor, postID, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.UserID != actor.UserID {
+		return nil, ErrCommentForbidden
+	}
+	comment.Body = body
+	if err := database.DB.WithContext(ctx).Model(comment).Update("body", body).Error; err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// DeleteComment elimina (soft delete) el comentario; pueden su autor, el autor
+// del post y los administradores
+func DeleteComment(ctx context.Context, actor Identity, postID, id uint) error {
+	post, err := GetPost(ctx, actor, postID)
+	if err != nil {
+		return err
+	}
+	comment, err := scopedComment(ctx, actor, postID, id)
+	if err != nil {
+		return err
+	}
+	if comment.UserID != actor.UserID && post.UserID != actor.UserID && !IsAdmin(actor.Role) {
+		return ErrCommentForbidden
+	}
+	return database.DB.WithContext(ctx).Delete(comment).Error
+}
+
+// deletePostComments elimina definitivamente los comentarios de los posts de
+// la consulta posts (IDs), también los ya eliminados
+func deletePostComments(tx *gorm.DB, posts interface{}) error {
+	return tx.Unscoped().Where("post_id IN (?)", posts).Delete(&database.Comment{}).Error
+}
+
+// ModerationComments devuelve para los administradores los comentarios en el
+// estado indicado (hidden por defecto), los más recientes primero
+func ModerationComments(ctx context.Context, status string, offset, limit int) ([]database.Comment, database.Total, error) {
+	query := database.DB.WithContext(ctx).Model(&database.Comment{})
+	switch status {
+	case CommentVisible:
+		query = query.Where("hidden_at IS NULL")
+	case CommentDeleted:
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	default:
+		query = query.Where("hidden_at IS NOT NULL")
+	}
+	total, err := database.Count(query)
+	if err != nil {
+		return nil, total, err
+	}
+	var comments []database.Comment
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&comments).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+	return comments, total, nil
+}
+
+// moderatedComment carga el comentario sobre el que actúa un administrador;
+// con deleted, también si está eliminado
+func moderatedComment(ctx context.Context, id uint, deleted bool) (*database.Comment, error) {
+	db := database.DB.WithContext(ctx)
+	if deleted {
+		db = db.Unscoped()
+	}
+	var comment database.Comment
+	if err := db.First(&comment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// HideComment oculta el comentario al resto de usuarios; su autor lo sigue
+// viendo con el motivo. Si ya estaba oculto no cambia.
+func HideComment(ctx context.Context, actor Identity, id uint, reason string) (*database.Comment, error) {
+	comment, err := moderatedComment(ctx, id, false)
+	if err != nil || comment.HiddenAt != nil {
+		return comment, err
+	}
+	now := clock.Now()
+	comment.HiddenAt, comment.HiddenBy, comment.HiddenReason = &now, &actor.UserID, reason
+	updates := map[string]interface{}{"hidden_at": now, "hidden_by": actor.UserID, "hidden_reason": reason}
+	if err := database.DB.WithContext(ctx).Model(comment).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("🙈 Comentario %d ocultado por %d", comment.ID, actor.UserID)
+	return comment, nil
+}
+
+// UnhideComment vuelve a mostrar un comentario oculto
+func UnhideComment(ctx context.Context, actor Identity, id uint) (*database.Comment, error) {
+	comment, err := moderatedComment(ctx, id, false)
+	if err != nil || comment.HiddenAt == nil {
+		return comment, err
+	}
+	comment.HiddenAt, comment.HiddenBy, comment.HiddenReason = nil, nil, ""
+	updates := map[string]interface{}{"hidden_at": nil, "hidden_by": nil, "hidden_reason": ""}
+	if err := database.DB.WithContext(ctx).Model(comment).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// RestoreComment recupera un comentario eliminado que la retención aún no ha
+// purgado
+func RestoreComment(ctx context.Context, actor Identity, id uint) (*database.Comment, error) {
+	comment, err := moderatedComment(ctx, id, true)
+	if err != nil || !comment.DeletedAt.Valid {
+		return comment, err
+	}
+	comment.DeletedAt = gorm.DeletedAt{}
+	if err := database.DB.WithContext(ctx).Unscoped().Model(comment).Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("♻️ Comentario %d recuperado por %d", comment.ID, actor.UserID)
+	return comment, nil
+}
+
+// fetchCommentAuthors autor de cada comentario
+func fetchCommentAuthors(ctx context.Context, ids []uint) (map[uint]interface{}, error) {
+	var comments []database.Comment
+	if err := database.DB.WithContext(ctx).Unscoped().Select("id", "user_id").Where("id IN ?", ids).Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	owners := make(map[uint]uint, len(comments))
+	for _, comment := range comments {
+		owners[comment.ID] = comment.UserID
+	}
+	return authorsOf(ctx, owners)
+}
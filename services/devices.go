@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api/auth"
+	"api/clock"
+	"api/database"
+	"api/encryption"
+	"api/exports"
+	"api/useragent"
+
+	"gorm.io/gorm"
+)
+
+// ErrSessionNotFound la sesión no existe, no es del usuario o ya estaba revocada
+var ErrSessionNotFound = errors.New("sesión no encontrada")
+
+func init() {
+	encryption.RegisterModel(&database.Device{})
+	encryption.RegisterModel(&database.Session{})
+
+	exports.RegisterSection("devices", func(ctx context.Context, userID uint) (interface{}, error) {
+		var devices []database.Device
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("first_seen_at").Find(&devices).Error
+		return devices, err
+	})
+	exports.RegisterSection("sessions", func(ctx context.Context, userID uint) (interface{}, error) {
+		var sessions []database.Session
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&sessions).Error
+		return sessions, err
+	})
+}
+
+// recordDevice registra el dispositivo del inicio de sesión y devuelve si es
+// la primera vez que el usuario lo usa
+func recordDevice(ctx context.Context, userID uint, ua string) (*database.Device, bool, error) {
+	db := database.DB.WithContext(ctx)
+	info := useragent.Parse(ua)
+	now := clock.Now()
+
+	var device database.Device
+	err := db.Where("user_id = ? AND fingerprint = ?", userID, info.Fingerprint()).First(&device).Error
+	if err == nil {
+		err = db.Model(&device).Updates(map[string]interface{}{"user_agent": ua, "last_seen_at": now}).Error
+		return &device, false, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	device = database.Device{
+		UserID:      userID,
+		Fingerprint: info.Fingerprint(),
+		Browser:     info.Browser,
+		OS:          info.OS,
+		Type:        info.Type,
+		UserAgent:   ua,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	if err := db.Create(&device).Error; err != nil {
+		return nil, false, err
+	}
+	return &device, true, nil
+}
+
+// recordSession guarda la sesión abierta por el token emitido. Con caducidad
+// deslizante (SESSION_IDLE_TIMEOUT) la sesión caduca antes que el token si no se
+// usa. refresh es el token de renovación de la cookie, si se entregó.
+func recordSession(ctx context.Context, claims auth.Claims, device *database.Device, ip, country, refresh string) (*database.Session, error) {
+	now := clock.Now()
+	session := database.Session{
+		ID:             claims.ID,
+		UserID:         claims.UserID,
+		IP:             ip,
+		Country:        country,
+		CreatedAt:      now,
+		ExpiresAt:      sessionExpiry(claims, now),
+		TokenExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+	if device != nil {
+		session.DeviceID = &device.ID
+	}
+	if refresh != "" {
+		session.RefreshHash = auth.HashAPIKey(refresh)
+	}
+	if err := database.DB.WithContext(ctx).Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeSession revoca la sesión: su token deja de aceptarse aunque no haya caducado
+func RevokeSession(ctx context.Context, userID uint, id string) error {
+	result := database.DB.WithContext(ctx).Model(&database.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", clock.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// ListDevices devuelve los dispositivos del usuario, los usados más recientemente primero
+func ListDevices(ctx context.Context, userID uint) ([]database.Device, error) {
+	var devices []database.Device
+	err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// ListSessions devuelve las sesiones sin caducar ni revocar del usuario, las más recientes primero
+func ListSessions(ctx context.Context, userID uint) ([]database.Session, error) {
+	var sessions []database.Session
+	err := database.DB.WithContext(ctx).Where("user_id = ? AND expires_at > ? AND revoked_at IS NULL", userID, clock.Now()).
+		Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"api/database"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrGroupNotFound la organización no tiene ese grupo
+	ErrGroupNotFound = errors.New("grupo no encontrado")
+	// ErrGroupExists la organización ya tiene un grupo con ese identificador
+	ErrGroupExists = errors.New("ya existe un grupo con ese identificador en la organización")
+	// ErrInvalidGroupSlug el identificador no es válido
+	ErrInvalidGroupSlug = errors.New("identificador de grupo inválido: minúsculas, dígitos y -, empezando por una letra (2-40 caracteres)")
+	// ErrAlreadyInGroup el usuario ya pertenece al grupo
+	ErrAlreadyInGroup = errors.New("el usuario ya pertenece al grupo")
+	// ErrNotInGroup el usuario no pertenece al grupo
+	ErrNotInGroup = errors.New("el usuario no pertenece al grupo")
+)
+
+// GroupUser miembro de un grupo
+type GroupUser struct {
+	UserID  uint      `json:"user_id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// ListGroups grupos de la organización por identificador
+func ListGroups(ctx context.Context, orgID uint) ([]database.Group, error) {
+	var list []database.Group
+	err := database.DB.WithContext(ctx).Where("organization_id = ?", orgID).Order("slug").Find(&list).Error
+	return list, err
+}
+
+// FindGroup busca en la organización el grupo ref (identificador o ID)
+func FindGroup(ctx context.Context, orgID uint, ref string) (*database.Group, error) {
+	query := database.DB.WithContext(ctx).Where("organization_id = ?", orgID)
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		query = query.Where("id = ?", id)
+	} else {
+		query = query.Where("slug = ?", ref)
+	}
+	var group database.Group
+	if err := query.First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateGroup crea un grupo en la organización que concede role a sus miembros
+func CreateGroup(ctx context.Context, orgID uint, slug, name, role string) (*database.Group, error) {
+	if !orgSlugPattern.MatchString(slug) {
+		return nil, ErrInvalidGroupSlug
+	}
+	if !ValidOrgRole(role) {
+		return nil, ErrInvalidOrgRole
+	}
+	group := database.Group{OrganizationID: orgID, Slug: slug, Name: name, Role: role}
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&database.Group{}).Where("organization_id = ? AND slug = ?", orgID, slug).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrGroupExists
+		}
+		return tx.Create(&group).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// UpdateGroup cambia el nombre y/o el rol del grupo (los vacíos no cambian)
+func UpdateGroup(ctx context.Context, group *database.Group, name, role string) error {
+	if role != "" && !ValidOrgRole(role) {
+		return ErrInvalidOrgRole
+	}
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if name != "" {
+			group.Name = name
+		}
+		if role != "" {
+			group.Role = role
+		}
+		if err := tx.Model(group).Updates(map[string]interface{}{"name": group.Name, "role": group.Role}).Error; err != nil {
+			return err
+		}
+		if role != "" {
+			if err := bumpPermVersion(tx, groupMembers(tx, group.ID)); err != nil {
+				return err
+			}
+		}
+		return keepOrgAdmin(tx, group.OrganizationID)
+	})
+}
+
+// DeleteGroup elimina el grupo; sus miembros siguen en la organización
+func DeleteGroup(ctx context.Context, group *database.Group) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := bumpPermVersion(tx, groupMembers(tx, group.ID)); err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&database.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(group).Error; err != nil {
+			return err
+		}
+		return keepOrgAdmin(tx, group.OrganizationID)
+	})
+}
+
+// groupMembers subconsulta de los IDs de los miembros del grupo
+func groupMembers(tx *gorm.DB, groupID uint) *gorm.DB {
+	return tx.Model(&database.GroupMember{}).Select("user_id").Where("group_id = ?", groupID)
+}
+
+// ListGroupMembers miembros del grupo por orden de llegada
+func ListGroupMembers(ctx context.Context, groupID uint) ([]GroupUser, error) {
+	var list []GroupUser
+	err := database.DB.WithContext(ctx).Model(&database.GroupMember{}).
+		Select("group_members.user_id, users.name, users.email, group_members.created_at AS added_at").
+		Joins("JOIN users ON users.id = group_members.user_id AND users.deleted_at IS NULL").
+		Where("group_members.group_id = ?", groupID).
+		Order("group_members.created_at, group_members.id").
+		Scan(&list).Error
+	return list, err
+}
+
+// AddGroupMember añade al grupo a un miembro de su organización
+func AddGroupMember(ctx context.Context, group *database.Group, userID uint) (*database.GroupMember, error) {
+	member := database.GroupMember{GroupID: group.ID, UserID: userID}
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var membership database.Membership
+		if err := findMembership(tx, group.OrganizationID, userID, &membership); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&database.GroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyInGroup
+		}
+		if err := tx.Create(&member).Error; err != nil {
+			return err
+		}
+		return bumpPermVersion(tx, []uint{userID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RemoveGroupMember saca al usuario del grupo; sigue en la organización
+func RemoveGroupMember(ctx context.Context, group *database.Group, userID uint) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("group_id = ? AND user_id = ?", group.ID, userID).Delete(&database.GroupMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotInGroup
+		}
+		if err := bumpPermVersion(tx, []uint{userID}); err != nil {
+			return err
+		}
+		return keepOrgAdmin(tx, group.OrganizationID)
+	})
+}
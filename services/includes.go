@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+
+	"api/database"
+	"api/preload"
+)
+
+// Relaciones de los usuarios que se pueden pedir con ?include= (ver handlers.GetUsers)
+func init() {
+	preload.Register("users", "plan", preload.Relation{Fetch: fetchPlans})
+	preload.Register("users", "profile", preload.Relation{Fetch: fetchProfiles, AdminOnly: true})
+	preload.Register("users", "identities", preload.Relation{Fetch: fetchIdentities, AdminOnly: true})
+}
+
+// fetchPlans plan contratado de cada usuario
+func fetchPlans(ctx context.Context, ids []uint) (map[uint]interface{}, error) {
+	var users []database.User
+	if err := database.DB.WithContext(ctx).Select("id", "plan_code").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, len(users))
+	for _, user := range users {
+		codes = append(codes, user.PlanCode)
+	}
+	var list []database.Plan
+	if err := database.DB.WithContext(ctx).Where("code IN ?", codes).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]database.Plan, len(list))
+	for _, plan := range list {
+		byCode[plan.Code] = plan
+	}
+
+	result := make(map[uint]interface{}, len(users))
+	for _, user := range users {
+		if plan, ok := byCode[user.PlanCode]; ok {
+			result[user.ID] = plan
+		}
+	}
+	return result, nil
+}
+
+// fetchProfiles datos personales de los usuarios que los han rellenado
+func fetchProfiles(ctx context.Context, ids []uint) (map[uint]interface{}, error) {
+	var list []database.Profile
+	if err := database.DB.WithContext(ctx).Where("user_id IN ?", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]interface{}, len(list))
+	for _, profile := range list {
+		result[profile.UserID] = profile
+	}
+	return result, nil
+}
+
+// fetchIdentities identidades externas vinculadas a cada usuario (lista vacía si ninguna)
+func fetchIdentities(ctx context.Context, ids []uint) (map[uint]interface{}, error) {
+	var list []database.LinkedIdentity
+	if err := database.DB.WithContext(ctx).Where("user_id IN ?", ids).Order("provider").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	byUser := make(map[uint][]database.LinkedIdentity, len(ids))
+	for _, id := range ids {
+		byUser[id] = []database.LinkedIdentity{}
+	}
+	for _, identity := range list {
+		byUser[identity.UserID] = append(byUser[identity.UserID], identity)
+	}
+	result := make(map[uint]interface{}, len(byUser))
+	for id, identities := range byUser {
+		result[id] = identities
+	}
+	return result, nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"api/auth"
+	"api/branding"
+	"api/clock"
+	"api/database"
+	"api/encryption"
+	"api/ids"
+	"api/tenancy"
+	"api/useragent"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// magicLinkTTL vigencia de los enlaces de inicio de sesión
+	magicLinkTTL = 15 * time.Minute
+	// magicLinkWindow periodo en el que se cuentan las peticiones de enlaces
+	magicLinkWindow = time.Hour
+	// Enlaces que se pueden pedir en magicLinkWindow para un mismo email y
+	// desde una misma IP
+	magicLinkEmailLimit = 3
+	magicLinkIPLimit    = 10
+)
+
+// magicLinkPurpose distingue los tokens de los enlaces de inicio de sesión de los de acceso
+const magicLinkPurpose = "magic_link"
+
+var (
+	// ErrInvalidMagicLink el enlace no es válido, caducó o ya se usó
+	ErrInvalidMagicLink = errors.New("enlace de inicio de sesión inválido o caducado")
+	// ErrInvalidLoginCode el código no es correcto, caducó, ya se usó o se
+	// agotaron sus intentos
+	ErrInvalidLoginCode = errors.New("código de inicio de sesión incorrecto o caducado")
+)
+
+func init() {
+	encryption.RegisterModel(&database.MagicLink{})
+}
+
+// MagicLinkLimitError se han pedido demasiados enlaces para el email o desde
+// la IP; RetryAfter es lo que falta para poder pedir otro
+type MagicLinkLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MagicLinkLimitError) Error() string {
+	return "demasiados enlaces de inicio de sesión solicitados"
+}
+
+// MagicLinkConfirmationError el enlace se abrió en un dispositivo distinto del
+// que lo pidió: el inicio de sesión se completa volviendo a abrirlo con
+// confirmación tras mostrar al usuario desde dónde se pidió
+type MagicLinkConfirmationError struct {
+	Device      string
+	IP          string
+	RequestedAt time.Time
+}
+
+func (e *MagicLinkConfirmationError) Error() string {
+	return "el enlace se pidió desde otro dispositivo"
+}
+
+// magicLinkClaims contenido del token del enlace. Como el del enlace "no he
+// sido yo", no usa sub ni exp para no valer como token de acceso.
+type magicLinkClaims struct {
+	Purpose string `json:"purpose"`
+	LinkID  string `json:"lid"`
+	Until   int64  `json:"until"`
+}
+
+// magicLinkURL dirección a la que apunta el enlace del correo
+// (MAGIC_LINK_URL, por defecto el propio endpoint de verificación)
+func magicLinkURL() string {
+	if u := os.Getenv("MAGIC_LINK_URL"); u != "" {
+		return u
+	}
+	return appURL() + "/api/v1/auth/magic-link/verify"
+}
+
+// RequestMagicLink envía al email un enlace de un solo uso con el que iniciar
+// sesión sin contraseña. La petición se registra aunque el email no sea de
+// ninguna cuenta activa, sin enviar nada: el resultado es el mismo y no delata
+// qué emails están registrados.
+func RequestMagicLink(ctx context.Context, email string, meta LoginMeta) error {
+	link, user, err := createMagicLink(ctx, email, meta, magicLinkTTL, "")
+	if err != nil || user == nil {
+		return err
+	}
+
+	token, err := auth.Sign(magicLinkClaims{Purpose: magicLinkPurpose, LinkID: link.ID, Until: link.ExpiresAt.Unix()})
+	if err != nil {
+		return err
+	}
+	address := tenancy.Link(ctx, magicLinkURL()+"?token="+url.QueryEscape(token))
+	body := fmt.Sprintf("Hola %s,\n\nPara iniciar sesión abre este enlace:\n\n%s\n\n"+
+		"Solo sirve una vez y caduca en %d minutos. Se pidió desde %s (IP %s); si no has sido tú, ignora este correo.\n",
+		user.Name, address, int(magicLinkTTL.Minutes()), useragent.Parse(meta.UserAgent), meta.IP)
+	return branding.Send(ctx, user.Email, "Tu enlace de inicio de sesión", body)
+}
+
+// RequestLoginCode envía al email un código de 6 cifras con el que iniciar
+// sesión en VerifyLoginCode, para los clientes que no pueden abrir un enlace.
+// Comparte con RequestMagicLink el límite de peticiones y, como ella, no
+// delata si el email es de una cuenta.
+func RequestLoginCode(ctx context.Context, email string, meta LoginMeta) error {
+	code, err := randomCode()
+	if err != nil {
+		return err
+	}
+	_, user, err := createMagicLink(ctx, email, meta, challengeTTL, code)
+	if err != nil || user == nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hola %s,\n\nTu código para iniciar sesión es:\n\n  %s\n\n"+
+		"Caduca en %d minutos. Se pidió desde %s (IP %s); si no has sido tú, ignora este correo.\n",
+		user.Name, code, int(challengeTTL.Minutes()), useragent.Parse(meta.UserAgent), meta.IP)
+	return branding.Send(ctx, user.Email, "Tu código de inicio de sesión", body)
+}
+
+// createMagicLink aplica el límite de peticiones y registra la petición de un
+// enlace o, con code, de un código. user es nil si el email no es de ninguna
+// cuenta activa: entonces no se envía nada.
+func createMagicLink(ctx context.Context, email string, meta LoginMeta, ttl time.Duration, code string) (*database.MagicLink, *database.User, error) {
+	db := database.DB.WithContext(ctx)
+	email = strings.ToLower(strings.TrimSpace(email))
+	now := clock.Now()
+
+	if err := checkMagicLinkLimit(db.Where("email = ?", email), magicLinkEmailLimit, now); err != nil {
+		return nil, nil, err
+	}
+	if err := checkMagicLinkLimit(db.Where("ip = ?", meta.IP), magicLinkIPLimit, now); err != nil {
+		return nil, nil, err
+	}
+
+	link := database.MagicLink{
+		ID:          ids.New(),
+		Email:       email,
+		IP:          meta.IP,
+		UserAgent:   meta.UserAgent,
+		Fingerprint: useragent.Parse(meta.UserAgent).Fingerprint(),
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+	if code != "" {
+		link.CodeHash = hashCode(link.ID, code)
+	}
+	var user database.User
+	err := db.Where("LOWER(email) = ? AND is_active = ? AND anonymized_at IS NULL", email, true).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	if err == nil {
+		link.UserID = &user.ID
+	}
+	if err := db.Create(&link).Error; err != nil {
+		return nil, nil, err
+	}
+	if link.UserID == nil {
+		return &link, nil, nil
+	}
+	return &link, &user, nil
+}
+
+// checkMagicLinkLimit devuelve *MagicLinkLimitError si las peticiones de
+// query en magicLinkWindow ya llegan a limit
+func checkMagicLinkLimit(query *gorm.DB, limit int, now time.Time) error {
+	var recent []database.MagicLink
+	err := query.Where("created_at > ?", now.Add(-magicLinkWindow)).
+		Order("created_at DESC").Limit(limit).Select("created_at").Find(&recent).Error
+	if err != nil {
+		return err
+	}
+	if len(recent) < limit {
+		return nil
+	}
+	// Se podrá pedir otro cuando la más antigua de las últimas limit salga del periodo
+	return &MagicLinkLimitError{RetryAfter: recent[limit-1].CreatedAt.Add(magicLinkWindow).Sub(now)}
+}
+
+// VerifyMagicLink inicia sesión con el token de un enlace. Si se abre en un
+// dispositivo distinto del que lo pidió devuelve *MagicLinkConfirmationError
+// salvo con confirm, para que el usuario vea antes desde dónde se pidió: quien
+// reciba un enlace que no ha pedido no debe abrir una sesión sin saberlo. Al
+// usarlo se invalidan los demás enlaces pendientes del usuario.
+func VerifyMagicLink(ctx context.Context, token string, confirm bool, meta LoginMeta) (*LoginResult, error) {
+	var claims magicLinkClaims
+	if err := auth.Verify(token, &claims); err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+	if claims.Purpose != magicLinkPurpose || clock.Now().Unix() >= claims.Until {
+		return nil, ErrInvalidMagicLink
+	}
+
+	db := database.DB.WithContext(ctx)
+	var link database.MagicLink
+	if err := db.First(&link, "id = ?", claims.LinkID).Error; err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+	if link.UserID == nil || link.CodeHash != "" || link.UsedAt != nil || !clock.Now().Before(link.ExpiresAt) {
+		return nil, ErrInvalidMagicLink
+	}
+	if !confirm && useragent.Parse(meta.UserAgent).Fingerprint() != link.Fingerprint {
+		return nil, &MagicLinkConfirmationError{
+			Device:      useragent.Parse(link.UserAgent).String(),
+			IP:          link.IP,
+			RequestedAt: link.CreatedAt,
+		}
+	}
+
+	return useMagicLink(ctx, &link, meta, ErrInvalidMagicLink)
+}
+
+// VerifyLoginCode inicia sesión con el código enviado al email. Cada código
+// admite challengeMaxAttempts intentos; al usarlo se invalidan los demás
+// enlaces y códigos pendientes del usuario.
+func VerifyLoginCode(ctx context.Context, email, code string, meta LoginMeta) (*LoginResult, error) {
+	db := database.DB.WithContext(ctx)
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	// Solo vale el último código pedido
+	var link database.MagicLink
+	err := db.Where("email = ? AND code_hash <> '' AND user_id IS NOT NULL AND used_at IS NULL AND expires_at > ?", email, clock.Now()).
+		Order("created_at DESC").First(&link).Error
+	if err != nil {
+		return nil, ErrInvalidLoginCode
+	}
+	// El intento se consume antes de comparar y en una sola sentencia, como en
+	// CompleteChallenge
+	claim := db.Model(&database.MagicLink{}).
+		Where("id = ? AND attempts < ? AND used_at IS NULL", link.ID, challengeMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if claim.Error != nil {
+		return nil, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return nil, ErrInvalidLoginCode
+	}
+	if !hmac.Equal([]byte(hashCode(link.ID, strings.TrimSpace(code))), []byte(link.CodeHash)) {
+		recordLogin(ctx, link.UserID, link.Email, false, meta, nil)
+		return nil, ErrInvalidLoginCode
+	}
+	return useMagicLink(ctx, &link, meta, ErrInvalidLoginCode)
+}
+
+// useMagicLink completa el inicio de sesión con un enlace o código ya
+// comprobado; invalid es el error si ya se usó o la cuenta no puede entrar
+func useMagicLink(ctx context.Context, link *database.MagicLink, meta LoginMeta, invalid error) (*LoginResult, error) {
+	db := database.DB.WithContext(ctx)
+
+	// Se marca como usado antes de emitir el token: dos peticiones simultáneas
+	// con el mismo enlace o código no deben abrir dos sesiones
+	now := clock.Now()
+	result := db.Model(&database.MagicLink{}).Where("id = ? AND used_at IS NULL", link.ID).Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, invalid
+	}
+	if err := db.Model(&database.MagicLink{}).Where("user_id = ? AND used_at IS NULL", *link.UserID).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+
+	// Como con la contraseña, iniciar sesión cancela la eliminación programada
+	// (lo decide startSession); las cuentas desactivadas o anonimizadas no entran
+	var user database.User
+	if err := db.First(&user, *link.UserID).Error; err != nil || !user.IsActive || user.AnonymizedAt != nil {
+		recordLogin(ctx, link.UserID, link.Email, false, meta, nil)
+		return nil, invalid
+	}
+	return acceptLogin(ctx, &user, meta)
+}
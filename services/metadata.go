@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"api/database"
+	"api/events"
+	"api/metadata"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserMetadata devuelve los metadatos del usuario (vacíos si no tiene)
+func UserMetadata(ctx context.Context, id uint) (map[string]interface{}, error) {
+	user, err := GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return metadataOf(user), nil
+}
+
+// UpdateUserMetadata aplica changes sobre los metadatos del usuario (null
+// quita la clave) o, con replace, los sustituye. Los inválidos se rechazan
+// con un *metadata.Error. Los cambios de un administrador sobre otra cuenta
+// quedan en el historial, clave a clave.
+func UpdateUserMetadata(ctx context.Context, actor Identity, id uint, changes map[string]json.RawMessage, replace bool) (map[string]interface{}, error) {
+	var user database.User
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// La fila queda bloqueada hasta el final: dos PATCH a la vez con claves
+		// distintas se aplican uno tras otro y ninguno pisa al otro
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		merged, err := metadata.Merge(user.Metadata, changes, replace)
+		if err != nil {
+			return err
+		}
+
+		before := user
+		user.Metadata = merged
+		// Solo la columna metadata: no pisa cambios simultáneos en otros campos
+		if err := tx.Model(&user).Select("metadata").Updates(&user).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, actor, &before, &user, ChangeMetadata)
+	})
+	if err != nil {
+		return nil, err
+	}
+	events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+	return metadataOf(&user), nil
+}
+
+func metadataOf(user *database.User) map[string]interface{} {
+	if user.Metadata == nil {
+		return map[string]interface{}{}
+	}
+	return user.Metadata
+}
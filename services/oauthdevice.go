@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"time"
+
+	"api/auth"
+	"api/clock"
+	"api/database"
+	"api/oauth"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// deviceCodeTTL tiempo que tiene el usuario para aprobar el dispositivo
+	deviceCodeTTL = 10 * time.Minute
+	// devicePollInterval segundos entre consultas y lo que suma cada slow_down
+	devicePollInterval = 5
+)
+
+// Estados de una autorización de dispositivo
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeUsed     = "used"
+)
+
+// ErrDeviceCodeNotFound el código tecleado no es de ninguna autorización de
+// dispositivo pendiente
+var ErrDeviceCodeNotFound = errors.New("código incorrecto, caducado o ya usado")
+
+// DeviceAuthorization respuesta al inicio del flujo de dispositivo (RFC 8628 3.2)
+type DeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               int
+	Interval                int
+}
+
+// deviceVerificationURI página del frontend en la que el usuario teclea el
+// código (DEVICE_VERIFICATION_URI, por defecto APP_URL/device)
+func deviceVerificationURI() string {
+	if u := os.Getenv("DEVICE_VERIFICATION_URI"); u != "" {
+		return u
+	}
+	return appURL() + "/device"
+}
+
+// StartDeviceAuthorization inicia el flujo de dispositivo para una aplicación
+// sin navegador: devuelve el código con el que consultará el endpoint de
+// tokens y el que el usuario tiene que teclear en la página de verificación.
+// Los errores de la petición son *oauth.Error.
+func StartDeviceAuthorization(ctx context.Context, clientID, secret, scope string) (*DeviceAuthorization, error) {
+	client, err := authenticateOAuthClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	scopes, err := oauth.ParseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	deviceCode, userCode := auth.RandomToken(32), oauth.NewUserCode()
+	err = database.DB.WithContext(ctx).Create(&database.OAuthDeviceCode{
+		DeviceCodeHash: auth.HashAPIKey(deviceCode),
+		UserCodeHash:   auth.HashAPIKey(oauth.NormalizeUserCode(userCode)),
+		ClientID:       client.ID,
+		Scopes:         scopes,
+		Status:         DeviceCodePending,
+		Interval:       devicePollInterval,
+		ExpiresAt:      clock.Now().Add(deviceCodeTTL),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	uri := deviceVerificationURI()
+	return &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         uri,
+		VerificationURIComplete: uri + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+// DeviceRequest autorización de dispositivo pendiente, para la pantalla en la
+// que el usuario la aprueba
+type DeviceRequest struct {
+	Client *database.OAuthClient
+	Scopes []string
+	// El usuario ya había concedido todos los scopes pedidos
+	Granted bool
+}
+
+// PendingDeviceAuthorization busca la autorización pendiente del código que
+// tecleó el usuario
+func PendingDeviceAuthorization(ctx context.Context, userID uint, userCode string) (*DeviceRequest, error) {
+	db := database.DB.WithContext(ctx)
+	record, err := pendingDeviceCode(db, userCode)
+	if err != nil {
+		return nil, err
+	}
+	var client database.OAuthClient
+	if err := db.Where("id = ? AND revoked_at IS NULL", record.ClientID).First(&client).Error; err != nil {
+		return nil, ErrDeviceCodeNotFound
+	}
+	request := &DeviceRequest{Client: &client, Scopes: record.Scopes}
+	var grant database.OAuthGrant
+	if err := db.Where("user_id = ? AND client_id = ?", userID, client.ID).First(&grant).Error; err == nil {
+		request.Granted = oauth.Covers(grant.Scopes, record.Scopes)
+	}
+	return request, nil
+}
+
+// DecideDeviceAuthorization registra la decisión del usuario sobre el
+// dispositivo; al aprobarla se guardan los scopes concedidos a la aplicación
+// y su siguiente consulta recibe el token
+func DecideDeviceAuthorization(ctx context.Context, userID uint, userCode string, approve bool) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := pendingDeviceCode(tx, userCode)
+		if err != nil {
+			return err
+		}
+		status := DeviceCodeDenied
+		if approve {
+			status = DeviceCodeApproved
+		}
+		result := tx.Model(&database.OAuthDeviceCode{}).Where("id = ? AND status = ?", record.ID, DeviceCodePending).
+			Updates(map[string]interface{}{"status": status, "user_id": userID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDeviceCodeNotFound
+		}
+		if !approve {
+			return nil
+		}
+		return recordGrant(tx, userID, record.ClientID, record.Scopes)
+	})
+}
+
+func pendingDeviceCode(db *gorm.DB, userCode string) (*database.OAuthDeviceCode, error) {
+	var record database.OAuthDeviceCode
+	err := db.Where("user_code_hash = ? AND status = ? AND expires_at > ?",
+		auth.HashAPIKey(oauth.NormalizeUserCode(userCode)), DeviceCodePending, clock.Now()).First(&record).Error
+	if err != nil {
+		return nil, ErrDeviceCodeNotFound
+	}
+	return &record, nil
+}
+
+// pollDeviceCode responde a la consulta de la aplicación: authorization_pending
+// mientras el usuario no decide, slow_down si consulta más a menudo que el
+// intervalo (que aumenta) y el token cuando la aprueba, una sola vez
+func pollDeviceCode(ctx context.Context, client *database.OAuthClient, deviceCode string) (*TokenResponse, error) {
+	invalid := &oauth.Error{Code: oauth.InvalidGrant, Description: "device_code inválido o ya usado"}
+	db := database.DB.WithContext(ctx)
+	var record database.OAuthDeviceCode
+	if err := db.Where("device_code_hash = ? AND client_id = ?", auth.HashAPIKey(deviceCode), client.ID).First(&record).Error; err != nil {
+		return nil, invalid
+	}
+	now := clock.Now()
+	if !now.Before(record.ExpiresAt) {
+		return nil, &oauth.Error{Code: oauth.ExpiredToken, Description: "el código caducó; hay que volver a empezar"}
+	}
+
+	switch record.Status {
+	case DeviceCodeDenied:
+		return nil, &oauth.Error{Code: oauth.AccessDenied, Description: "el usuario denegó el acceso"}
+	case DeviceCodeUsed:
+		return nil, invalid
+	case DeviceCodePending:
+		if record.LastPolledAt != nil && now.Sub(*record.LastPolledAt) < time.Duration(record.Interval)*time.Second {
+			err := db.Model(&record).Updates(map[string]interface{}{"interval": record.Interval + devicePollInterval, "last_polled_at": now}).Error
+			if err != nil {
+				return nil, err
+			}
+			return nil, &oauth.Error{Code: oauth.SlowDown, Description: "consulta demasiado frecuente; espera más entre consultas"}
+		}
+		if err := db.Model(&record).Update("last_polled_at", now).Error; err != nil {
+			return nil, err
+		}
+		return nil, &oauth.Error{Code: oauth.AuthorizationPending, Description: "el usuario aún no ha respondido"}
+	}
+
+	result := db.Model(&database.OAuthDeviceCode{}).Where("id = ? AND status = ?", record.ID, DeviceCodeApproved).Update("status", DeviceCodeUsed)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || record.UserID == nil {
+		return nil, invalid
+	}
+	if _, err := activeUser(ctx, *record.UserID); err != nil {
+		return nil, invalid
+	}
+	return issueOAuthToken(ctx, db, client.ID, *record.UserID, record.Scopes)
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"api/accounts"
+	"api/database"
+	"api/exports"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrgNotFound la organización no existe o el usuario no pertenece a ella
+	ErrOrgNotFound = errors.New("organización no encontrada")
+	// ErrInvalidOrgSlug el identificador no es válido
+	ErrInvalidOrgSlug = errors.New("identificador de organización inválido: minúsculas, dígitos y -, empezando por una letra (2-40 caracteres)")
+	// ErrOrgExists ya hay una organización con ese identificador
+	ErrOrgExists = errors.New("ya existe una organización con ese identificador")
+	// ErrInvalidOrgRole el rol no es admin ni member
+	ErrInvalidOrgRole = errors.New("rol de organización inválido: admin o member")
+	// ErrMemberNotFound el usuario no pertenece a la organización
+	ErrMemberNotFound = errors.New("el usuario no pertenece a la organización")
+	// ErrAlreadyMember el usuario ya pertenece a la organización
+	ErrAlreadyMember = errors.New("el usuario ya pertenece a la organización")
+	// ErrLastOrgAdmin la operación dejaría a la organización sin administradores
+	ErrLastOrgAdmin = errors.New("la organización debe conservar al menos un administrador")
+)
+
+// Roles dentro de una organización, independientes del rol global del usuario
+const (
+	// OrgRoleAdmin gestiona la organización y sus miembros
+	OrgRoleAdmin = "admin"
+	// OrgRoleMember accede a la organización
+	OrgRoleMember = "member"
+)
+
+// orgRoleRank orden de los roles de organización: cada uno incluye los permisos
+// de los de menor rango
+var orgRoleRank = map[string]int{OrgRoleMember: 1, OrgRoleAdmin: 2}
+
+// orgSlugPattern identificadores de organización válidos; empiezan por una
+// letra para no confundirse con un ID en las rutas
+var orgSlugPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{1,39}$`)
+
+func init() {
+	exports.RegisterSection("organizations", func(ctx context.Context, userID uint) (interface{}, error) {
+		return ListUserOrganizations(ctx, userID)
+	})
+	accounts.RegisterCleanup("memberships", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&database.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.Membership{}).Error
+	})
+}
+
+// ValidOrgRole indica si role es un rol de organización
+func ValidOrgRole(role string) bool {
+	_, ok := orgRoleRank[role]
+	return ok
+}
+
+// OrgRoleAllows indica si el rol de organización role incluye los permisos de required
+func OrgRoleAllows(role, required string) bool {
+	return role != "" && orgRoleRank[role] >= orgRoleRank[required]
+}
+
+// UserOrganization organización de un usuario con su rol efectivo en ella (el
+// mayor entre el suyo y los de sus grupos)
+type UserOrganization struct {
+	database.Organization
+	Role string `json:"role"`
+	// Grupos de la organización a los que pertenece
+	Groups []string `json:"groups,omitempty" gorm:"-"`
+}
+
+// OrgMember miembro de una organización
+type OrgMember struct {
+	UserID   uint      `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// CreateOrganization crea una organización cuyo primer administrador es actor
+func CreateOrganization(ctx context.Context, actor Identity, slug, name string) (*database.Organization, error) {
+	if !orgSlugPattern.MatchString(slug) {
+		return nil, ErrInvalidOrgSlug
+	}
+	org := database.Organization{Slug: slug, Name: name}
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&database.Organization{}).Where("slug = ?", slug).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrgExists
+		}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		// Un administrador de la plataforma dentro de un tenant no tiene usuario en él
+		if actor.UserID == 0 {
+			return nil
+		}
+		if err := tx.Create(&database.Membership{OrganizationID: org.ID, UserID: actor.UserID, Role: OrgRoleAdmin}).Error; err != nil {
+			return err
+		}
+		return bumpPermVersion(tx, []uint{actor.UserID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// ResolveOrganization busca la organización ref (identificador o ID) y el rol
+// de actor en ella. Los administradores globales actúan como administradores
+// de todas; para el resto, una organización a la que no pertenecen no existe.
+func ResolveOrganization(ctx context.Context, actor Identity, ref string) (*database.Organization, string, error) {
+	db := database.DB.WithContext(ctx)
+	query := db.Where("slug = ?", ref)
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		query = db.Where("id = ?", id)
+	}
+	var org database.Organization
+	if err := query.First(&org).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrOrgNotFound
+		}
+		return nil, "", err
+	}
+
+	role, err := orgRole(ctx, org.ID, actor.UserID)
+	if err != nil {
+		return nil, "", err
+	}
+	if IsAdmin(actor.Role) {
+		role = OrgRoleAdmin
+	}
+	if role == "" {
+		return nil, "", ErrOrgNotFound
+	}
+	return &org, role, nil
+}
+
+// orgRole rol efectivo del usuario en la organización: el mayor entre el suyo
+// y los de sus grupos; vacío si no pertenece a ella
+func orgRole(ctx context.Context, orgID, userID uint) (string, error) {
+	if userID == 0 {
+		return "", nil
+	}
+	db := database.DB.WithContext(ctx)
+	var membership database.Membership
+	err := db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var groupRoles []string
+	err = db.Model(&database.Group{}).
+		Joins("JOIN group_members ON group_members.group_id = org_groups.id").
+		Where("org_groups.organization_id = ? AND group_members.user_id = ?", orgID, userID).
+		Pluck("org_groups.role", &groupRoles).Error
+	if err != nil {
+		return "", err
+	}
+	return highestOrgRole(membership.Role, groupRoles...), nil
+}
+
+// highestOrgRole el rol de organización de mayor rango
+func highestOrgRole(role string, others ...string) string {
+	for _, other := range others {
+		if orgRoleRank[other] > orgRoleRank[role] {
+			role = other
+		}
+	}
+	return role
+}
+
+// ListUserOrganizations organizaciones del usuario con su rol en cada una
+func ListUserOrganizations(ctx context.Context, userID uint) ([]UserOrganization, error) {
+	var list []UserOrganization
+	err := database.DB.WithContext(ctx).Model(&database.Organization{}).
+		Select("organizations.*, memberships.role").
+		Joins("JOIN memberships ON memberships.organization_id = organizations.id").
+		Where("memberships.user_id = ?", userID).
+		Order("organizations.slug").
+		Scan(&list).Error
+	if err != nil || len(list) == 0 {
+		return list, err
+	}
+
+	var groups []struct {
+		OrganizationID uint
+		Slug           string
+		Role           string
+	}
+	err = database.DB.WithContext(ctx).Model(&database.Group{}).
+		Select("org_groups.organization_id, org_groups.slug, org_groups.role").
+		Joins("JOIN group_members ON group_members.group_id = org_groups.id").
+		Where("group_members.user_id = ?", userID).
+		Order("org_groups.slug").
+		Scan(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		for _, g := range groups {
+			if g.OrganizationID == list[i].ID {
+				list[i].Groups = append(list[i].Groups, g.Slug)
+				list[i].Role = highestOrgRole(list[i].Role, g.Role)
+			}
+		}
+	}
+	return list, nil
+}
+
+// UpdateOrganization cambia el nombre de la organización
+func UpdateOrganization(ctx context.Context, org *database.Organization, name string) error {
+	org.Name = name
+	return database.DB.WithContext(ctx).Model(org).Update("name", name).Error
+}
+
+// DeleteOrganization elimina la organización con sus grupos y pertenencias
+func DeleteOrganization(ctx context.Context, orgID uint) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		groups := tx.Model(&database.Group{}).Select("id").Where("organization_id = ?", orgID)
+		if err := tx.Where("group_id IN (?)", groups).Delete(&database.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", orgID).Delete(&database.Group{}).Error; err != nil {
+			return err
+		}
+		members := tx.Model(&database.Membership{}).Select("user_id").Where("organization_id = ?", orgID)
+		if err := bumpPermVersion(tx, members); err != nil {
+			return err
+		}
+		if err := tx.Where("organization_id = ?", orgID).Delete(&database.Membership{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&database.Organization{}, orgID).Error
+	})
+}
+
+// ListOrgMembers miembros de la organización con su rol, por orden de llegada
+func ListOrgMembers(ctx context.Context, orgID uint) ([]OrgMember, error) {
+	var list []OrgMember
+	err := database.DB.WithContext(ctx).Model(&database.Membership{}).
+		Select("memberships.user_id, users.name, users.email, memberships.role, memberships.created_at AS joined_at").
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ?", orgID).
+		Order("memberships.created_at, memberships.id").
+		Scan(&list).Error
+	return list, err
+}
+
+// AddOrgMember añade a la organización al usuario con ese email y el rol indicado
+func AddOrgMember(ctx context.Context, orgID uint, email, role string) (*database.Membership, error) {
+	if !ValidOrgRole(role) {
+		return nil, ErrInvalidOrgRole
+	}
+	var user database.User
+	if err := database.DB.WithContext(ctx).Where("LOWER(email) = LOWER(?)", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	current, err := orgRole(ctx, orgID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current != "" {
+		return nil, ErrAlreadyMember
+	}
+	membership := database.Membership{OrganizationID: orgID, UserID: user.ID, Role: role}
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&membership).Error; err != nil {
+			return err
+		}
+		return bumpPermVersion(tx, []uint{user.ID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// SetOrgMemberRole cambia el rol de un miembro de la organización
+func SetOrgMemberRole(ctx context.Context, orgID, userID uint, role string) (*database.Membership, error) {
+	if !ValidOrgRole(role) {
+		return nil, ErrInvalidOrgRole
+	}
+	var membership database.Membership
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := findMembership(tx, orgID, userID, &membership); err != nil {
+			return err
+		}
+		membership.Role = role
+		if err := tx.Model(&membership).Update("role", role).Error; err != nil {
+			return err
+		}
+		if err := bumpPermVersion(tx, []uint{userID}); err != nil {
+			return err
+		}
+		return keepOrgAdmin(tx, orgID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// RemoveOrgMember saca al usuario de la organización y de sus grupos
+func RemoveOrgMember(ctx context.Context, orgID, userID uint) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var membership database.Membership
+		if err := findMembership(tx, orgID, userID, &membership); err != nil {
+			return err
+		}
+		groups := tx.Model(&database.Group{}).Select("id").Where("organization_id = ?", orgID)
+		if err := tx.Where("user_id = ? AND group_id IN (?)", userID, groups).Delete(&database.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&membership).Error; err != nil {
+			return err
+		}
+		if err := bumpPermVersion(tx, []uint{userID}); err != nil {
+			return err
+		}
+		return keepOrgAdmin(tx, orgID)
+	})
+}
+
+func findMembership(tx *gorm.DB, orgID, userID uint, membership *database.Membership) error {
+	err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).First(membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMemberNotFound
+	}
+	return err
+}
+
+// keepOrgAdmin comprueba, tras un cambio dentro de la transacción tx, que la
+// organización conserva algún administrador, propio o por un grupo
+func keepOrgAdmin(tx *gorm.DB, orgID uint) error {
+	var admins int64
+	err := tx.Model(&database.Membership{}).Where("organization_id = ? AND role = ?", orgID, OrgRoleAdmin).Count(&admins).Error
+	if err != nil || admins > 0 {
+		return err
+	}
+	err = tx.Model(&database.GroupMember{}).
+		Joins("JOIN org_groups ON org_groups.id = group_members.group_id").
+		Where("org_groups.organization_id = ? AND org_groups.role = ?", orgID, OrgRoleAdmin).
+		Count(&admins).Error
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastOrgAdmin
+	}
+	return nil
+}
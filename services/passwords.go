@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/pwned"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPwnedPassword la contraseña aparece en filtraciones de datos conocidas
+	ErrPwnedPassword = errors.New("la contraseña aparece en filtraciones de datos conocidas")
+	// ErrPasswordCheckUnavailable no se pudo comprobar la contraseña y
+	// PWNED_PASSWORDS_FAIL=closed obliga a rechazarla
+	ErrPasswordCheckUnavailable = errors.New("no se pudo comprobar si la contraseña está filtrada")
+	// ErrWrongPassword la contraseña actual no es correcta
+	ErrWrongPassword = errors.New("la contraseña actual no es correcta")
+	// ErrPasswordReused la contraseña nueva es igual que la actual
+	ErrPasswordReused = errors.New("la contraseña nueva es igual que la actual")
+)
+
+// checkPassword rechaza, con PWNED_PASSWORDS activo, las contraseñas que
+// aparecen en Have I Been Pwned. Se aplica a toda contraseña nueva antes de
+// guardarla. Si el servicio no responde se acepta, salvo con
+// PWNED_PASSWORDS_FAIL=closed.
+func checkPassword(ctx context.Context, password string) error {
+	if !pwned.Enabled() {
+		return nil
+	}
+	count, err := pwned.Count(ctx, password)
+	if err != nil {
+		log.Printf("⚠️  No se pudo comprobar la contraseña en Have I Been Pwned: %v", err)
+		if pwned.FailClosed() {
+			return ErrPasswordCheckUnavailable
+		}
+		return nil
+	}
+	if count > 0 {
+		return ErrPwnedPassword
+	}
+	return nil
+}
+
+// PasswordMaxAge vigencia de las contraseñas (PASSWORD_MAX_AGE_DAYS; 0, por
+// defecto, = no caducan)
+func PasswordMaxAge() time.Duration {
+	days, _ := strconv.Atoi(os.Getenv("PASSWORD_MAX_AGE_DAYS"))
+	if days <= 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PasswordExpired indica si el usuario tiene que cambiar la contraseña: un
+// administrador lo exigió o pasó PasswordMaxAge desde el último cambio (o el
+// alta). Las cuentas sin contraseña (solo identidades externas) no caducan.
+func PasswordExpired(user *database.User) bool {
+	if user.Password == "" {
+		return false
+	}
+	if user.PasswordChangeRequired {
+		return true
+	}
+	maxAge := PasswordMaxAge()
+	if maxAge == 0 {
+		return false
+	}
+	changed := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changed = *user.PasswordChangedAt
+	}
+	return !clock.Now().Before(changed.Add(maxAge))
+}
+
+// ChangePassword cambia la contraseña del usuario comprobando la actual. La
+// nueva no puede ser igual ni estar filtrada; con ella deja de exigirse el cambio.
+func ChangePassword(ctx context.Context, userID uint, current, next string) error {
+	user, err := activeUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(current)) != nil {
+		return ErrWrongPassword
+	}
+	if current == next {
+		return ErrPasswordReused
+	}
+	if err := checkPassword(ctx, next); err != nil {
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(next), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"password":                 string(hashed),
+		"password_changed_at":      clock.Now(),
+		"password_change_required": false,
+	}).Error
+}
+
+// RequirePasswordChange obliga al usuario a cambiar la contraseña: sus
+// sesiones, también las abiertas, solo sirven para hacerlo hasta entonces.
+// Queda en su historial de cambios.
+func RequirePasswordChange(ctx context.Context, actor Identity, id interface{}) (*database.User, error) {
+	db := database.DB.WithContext(ctx)
+	var user database.User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	before := user
+	user.PasswordChangeRequired = true
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_change_required", true).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, actor, &before, &user, ChangeRotation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"api/accounts"
+	"api/database"
+	"api/exports"
+	"api/preload"
+
+	"gorm.io/gorm"
+)
+
+// Visibilidad de un post
+const (
+	PostPublic  = "public"
+	PostPrivate = "private"
+)
+
+// postsPerUser posts públicos que se incluyen por usuario con ?include=posts
+const postsPerUser = 10
+
+var (
+	// ErrPostNotFound no existe o el usuario no puede verlo
+	ErrPostNotFound = errors.New("post no encontrado")
+	// ErrPostForbidden el usuario puede ver el post pero no es su autor
+	ErrPostForbidden = errors.New("solo el autor puede modificar el post")
+)
+
+func init() {
+	exports.RegisterSection("posts", func(ctx context.Context, userID uint) (interface{}, error) {
+		var posts []database.Post
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&posts).Error
+		return posts, err
+	})
+	accounts.RegisterCleanup("posts", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		posts := tx.Model(&database.Post{}).Select("id").Where("user_id = ?", userID)
+		if err := deletePostComments(tx, posts); err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.Post{}).Error
+	})
+	preload.Register("users", "posts", preload.Relation{Fetch: fetchUserPosts})
+	preload.Register("posts", "author", preload.Relation{Fetch: fetchPostAuthors})
+}
+
+// PostFilter filtros del listado de posts; los vacíos no filtran
+type PostFilter struct {
+	UserID     uint
+	Visibility string
+}
+
+// postScope limita la consulta a los posts que puede ver actor: los públicos y
+// los suyos o, si es administrador, todos
+func postScope(ctx context.Context, actor Identity) *gorm.DB {
+	db := database.DB.WithContext(ctx).Model(&database.Post{})
+	if !IsAdmin(actor.Role) {
+		db = db.Where("visibility = ? OR user_id = ?", PostPublic, actor.UserID)
+	}
+	return db
+}
+
+// ListPosts devuelve los posts que puede ver actor con los filtros indicados,
+// los más recientes primero
+func ListPosts(ctx context.Context, actor Identity, filter PostFilter, offset, limit int) ([]database.Post, database.Total, error) {
+	query := postScope(ctx, actor)
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Visibility != "" {
+		query = query.Where("visibility = ?", filter.Visibility)
+	}
+	total, err := database.Count(query)
+	if err != nil {
+		return nil, total, err
+	}
+	var posts []database.Post
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&posts).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+	return posts, total, nil
+}
+
+// GetPost devuelve el post indicado si actor puede verlo
+func GetPost(ctx context.Context, actor Identity, id uint) (*database.Post, error) {
+	var post database.Post
+	if err := postScope(ctx, actor).First(&post, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+	return &post, nil
+}
+
+// ownPost devuelve el post indicado si actor puede modificarlo: es su autor o
+// administrador. Si solo puede verlo, ErrPostForbidden.
+func ownPost(ctx context.Context, actor Identity, id uint) (*database.Post, error) {
+	post, err := GetPost(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID != actor.UserID && !IsAdmin(actor.Role) {
+		return nil, ErrPostForbidden
+	}
+	return post, nil
+}
+
+// CreatePost publica un post de actor (visibility vacía = public)
+func CreatePost(ctx context.Context, actor Identity, title, body, visibility string) (*database.Post, error) {
+	if visibility == "" {
+		visibility = PostPublic
+	}
+	post := database.Post{UserID: actor.UserID, Title: title, Body: body, Visibility: visibility}
+	if err := database.DB.WithContext(ctx).Create(&post).Error; err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// UpdatePost sustituye el título, el texto y la visibilidad del post; solo
+// su autor y los administradores
+func UpdatePost(ctx context.Context, actor Identity, id uint, title, body, visibility string) (*database.Post, error) {
+	post, err := ownPost(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if visibility == "" {
+		visibility = PostPublic
+	}
+	post.Title, post.Body, post.Visibility = title, body, visibility
+	updates := map[string]interface{}{"title": title, "body": body, "visibility": visibility}
+	if err := database.DB.WithContext(ctx).Model(post).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// DeletePost elimina el post con todos sus comentarios; solo su autor y los
+// administradores
+func DeletePost(ctx context.Context, actor Identity, id uint) error {
+	post, err := ownPost(ctx, actor, id)
+	if err != nil {
+		return err
+	}
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := deletePostComments(tx, []uint{post.ID}); err != nil {
+			return err
+		}
+		return tx.Delete(post).Error
+	})
+}
+
+// Author datos públicos del autor de un contenido
+type Author struct {
+	ID        uint    `json:"id"`
+	Name      string  `json:"name"`
+	Username  *string `json:"username,omitempty"`
+	AvatarURL string  `json:"avatar_url,omitempty"`
+	Verified  bool    `json:"verified"`
+}
+
+// authors datos públicos de los usuarios indicados, por ID
+func authors(ctx context.Context, ids []uint) (map[uint]Author, error) {
+	var users []database.User
+	if err := database.DB.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]Author, len(users))
+	for i := range users {
+		user := &users[i]
+		result[user.ID] = Author{ID: user.ID, Name: user.Name, Username: user.Username, AvatarURL: AvatarURL(ctx, user), Verified: user.VerifiedAt != nil}
+	}
+	return result, nil
+}
+
+// fetchPostAuthors autor de cada post
+func fetchPostAuthors(ctx context.Context, ids []uint) (map[uint]interface{}, error) {
+	var posts []database.Post
+	if err := database.DB.WithContext(ctx).Select("id", "user_id").Where("id IN ?", ids).Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	owners := make(map[uint]uint, len(posts))
+	for _, post := range posts {
+		owners[post.ID] = post.UserID
+	}
+	return authorsOf(ctx, owners)
+}
+
+// authorsOf Author de cada contenido a partir del ID de su autor (owners);
+// los de autores que ya no existen se omiten
+func authorsOf(ctx context.Context, owners map[uint]uint) (map[uint]interface{}, error) {
+	userIDs := make([]uint, 0, len(owners))
+	for _, userID := range owners {
+		userIDs = append(userIDs, userID)
+	}
+	byID, err := authors(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]interface{}, len(owners))
+	for id, userID := range owners {
+		if author, ok := byID[userID]; ok {
+			result[id] = author
+		}
+	}
+	return result, nil
+}
+
+// fetchUserPosts últimos postsPerUser posts públicos de cada usuario (lista
+// vacía si ninguno). Los privados no se incluyen: la relación no sabe quién
+// la pide.
+func fetchUserPosts(ctx context.Context, ids []uint) (map[uint]interface{}, error) {
+	db := database.DB.WithContext(ctx)
+	ranked := db.Model(&database.Post{}).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, id DESC) AS position").
+		Where("user_id IN ? AND visibility = ?", ids, PostPublic)
+	var list []database.Post
+	if err := db.Table("(?) AS ranked", ranked).Where("position <= ?", postsPerUser).
+		Order("user_id, position").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	byUser := make(map[uint][]database.Post, len(ids))
+	for _, id := range ids {
+		byUser[id] = []database.Post{}
+	}
+	for _, post := range list {
+		byUser[post.UserID] = append(byUser[post.UserID], post)
+	}
+	result := make(map[uint]interface{}, len(byUser))
+	for id, posts := range byUser {
+		result[id] = posts
+	}
+	return result, nil
+}
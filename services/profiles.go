@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/encryption"
+	"api/exports"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidBirthday la fecha de nacimiento no es una fecha válida o es futura
+var ErrInvalidBirthday = errors.New("fecha de nacimiento inválida")
+
+func init() {
+	encryption.RegisterModel(&database.Profile{})
+
+	exports.RegisterSection("profile_details", func(ctx context.Context, userID uint) (interface{}, error) {
+		return GetProfile(ctx, userID)
+	})
+	accounts.RegisterCleanup("profile_details", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		return tx.Where("user_id = ?", userID).Delete(&database.Profile{}).Error
+	})
+}
+
+// GetProfile devuelve los datos personales del usuario; si aún no los ha
+// rellenado, un perfil vacío
+func GetProfile(ctx context.Context, userID uint) (*database.Profile, error) {
+	profile := database.Profile{UserID: userID}
+	err := database.DB.WithContext(ctx).Where("user_id = ?", userID).First(&profile).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// SaveProfile reemplaza los datos personales del usuario por los de profile:
+// los campos vacíos se borran
+func SaveProfile(ctx context.Context, userID uint, profile database.Profile) (*database.Profile, error) {
+	if profile.Birthday != "" {
+		birthday, err := time.Parse("2006-01-02", profile.Birthday)
+		if err != nil || birthday.After(clock.Now()) {
+			return nil, ErrInvalidBirthday
+		}
+	}
+
+	profile.UserID = userID
+	profile.UpdatedAt = clock.Now()
+	err := database.DB.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&profile).Error
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+
+	"api/database"
+	"api/reports"
+	"api/xlsx"
+
+	"gorm.io/gorm"
+)
+
+// Tipos de informe de administración
+const (
+	ReportUsers   = "users"
+	ReportSignups = "signups"
+	ReportAudit   = "audit"
+)
+
+func init() {
+	reports.Register(ReportUsers, usersReport)
+	reports.Register(ReportSignups, signupsReport)
+	reports.Register(ReportAudit, auditReport)
+}
+
+// userColumns columnas de las hojas de usuarios
+var userColumns = []xlsx.Column{
+	{Header: "ID", Type: xlsx.Number},
+	{Header: "Email", Width: 32},
+	{Header: "Nombre", Width: 24},
+	{Header: "Usuario", Width: 16},
+	{Header: "Rol"},
+	{Header: "Activo", Type: xlsx.Bool},
+	{Header: "Plan"},
+	{Header: "Alta", Type: xlsx.Date, Width: 20},
+	{Header: "Última actividad", Type: xlsx.Date, Width: 20},
+}
+
+func writeUser(sheet *xlsx.Sheet, user *database.User) error {
+	return sheet.WriteRow(user.ID, user.Email, user.Name, user.Username, user.Role,
+		user.IsActive, user.PlanCode, user.CreatedAt, user.LastActivityAt)
+}
+
+// usersReport los usuarios de ListUsers en una hoja; siempre todos, es una
+// foto del momento en que se genera
+func usersReport(ctx context.Context, w *xlsx.Writer, _ reports.Range) error {
+	sheet, err := w.AddSheet("Usuarios", userColumns)
+	if err != nil {
+		return err
+	}
+	return StreamUsers(ctx, UserFilter{}, func(rows *sql.Rows) error {
+		return eachRow(rows, func(user *database.User) error { return writeUser(sheet, user) })
+	})
+}
+
+// signupsReport los usuarios que se dieron de alta en el periodo
+func signupsReport(ctx context.Context, w *xlsx.Writer, period reports.Range) error {
+	sheet, err := w.AddSheet("Altas", userColumns)
+	if err != nil {
+		return err
+	}
+	query := func(db *gorm.DB) *gorm.DB { return usersQuery(db).Scopes(period.Scope("created_at")) }
+	return database.Stream(ctx, query, func(rows *sql.Rows) error {
+		return eachRow(rows, func(user *database.User) error { return writeUser(sheet, user) })
+	})
+}
+
+// auditReport los cambios de los administradores en los usuarios (una fila por
+// campo) y el historial de inicios de sesión del periodo, cada uno en su hoja
+func auditReport(ctx context.Context, w *xlsx.Writer, period reports.Range) error {
+	changes, err := w.AddSheet("Cambios de usuarios", []xlsx.Column{
+		{Header: "Fecha", Type: xlsx.Date, Width: 20},
+		{Header: "Usuario", Type: xlsx.Number},
+		{Header: "Administrador", Type: xlsx.Number},
+		{Header: "Acción"},
+		{Header: "Campo", Width: 20},
+		{Header: "Antes", Width: 28},
+		{Header: "Después", Width: 28},
+	})
+	if err != nil {
+		return err
+	}
+	query := func(db *gorm.DB) *gorm.DB {
+		return db.Model(&database.UserChange{}).Scopes(period.Scope("created_at")).Order("created_at, id")
+	}
+	err = database.Stream(ctx, query, func(rows *sql.Rows) error {
+		return eachRow(rows, func(change *database.UserChange) error {
+			for _, field := range change.Changes {
+				if err := changes.WriteRow(change.CreatedAt, change.UserID, change.ActorID, change.Action,
+					field.Field, field.Before, field.After); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	logins, err := w.AddSheet("Inicios de sesión", []xlsx.Column{
+		{Header: "Fecha", Type: xlsx.Date, Width: 20},
+		{Header: "Usuario", Type: xlsx.Number},
+		{Header: "Email", Width: 32},
+		{Header: "Correcto", Type: xlsx.Bool},
+		{Header: "IP", Width: 16},
+		{Header: "Agente de usuario", Width: 40},
+		{Header: "Riesgo", Type: xlsx.Number},
+		{Header: "Decisión"},
+	})
+	if err != nil {
+		return err
+	}
+	query = func(db *gorm.DB) *gorm.DB {
+		return db.Model(&database.LoginEvent{}).Scopes(period.Scope("created_at")).Order("created_at, id")
+	}
+	return database.Stream(ctx, query, func(rows *sql.Rows) error {
+		return eachRow(rows, func(event *database.LoginEvent) error {
+			return logins.WriteRow(event.CreatedAt, event.UserID, event.Email, event.Success,
+				event.IP, event.UserAgent, event.RiskScore, event.RiskDecision)
+		})
+	})
+}
+
+// eachRow lee cada fila del cursor en un T (con los serializadores del modelo,
+// como el cifrado) y la cierra al terminar
+func eachRow[T any](rows *sql.Rows, fn func(*T) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		var row T
+		if err := database.DB.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"api/clock"
+	"api/database"
+	"api/events"
+
+	"gorm.io/gorm"
+)
+
+// RestrictUser restringe la cuenta indicada: el usuario puede iniciar sesión y
+// consultar, pero las peticiones que modifican algo se rechazan. Restringir una
+// cuenta ya restringida solo cambia el motivo. La detección de abusos la usa
+// con una identidad vacía (actor.UserID 0): entonces no queda en el historial
+// de cambios, que es de los administradores, pero sí en el log.
+func RestrictUser(ctx context.Context, actor Identity, id interface{}, reason string) (*database.User, error) {
+	return setRestriction(ctx, actor, id, true, reason)
+}
+
+// UnrestrictUser levanta la restricción de la cuenta indicada
+func UnrestrictUser(ctx context.Context, actor Identity, id interface{}) (*database.User, error) {
+	return setRestriction(ctx, actor, id, false, "")
+}
+
+func setRestriction(ctx context.Context, actor Identity, id interface{}, restricted bool, reason string) (*database.User, error) {
+	db := database.DB.WithContext(ctx)
+	var user database.User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	before := user
+	updates := map[string]interface{}{"restricted_at": nil, "restriction_reason": ""}
+	user.RestrictedAt, user.RestrictionReason = nil, ""
+	if restricted {
+		now := clock.Now()
+		if before.RestrictedAt != nil {
+			now = *before.RestrictedAt
+		}
+		updates = map[string]interface{}{"restricted_at": now, "restriction_reason": reason}
+		user.RestrictedAt, user.RestrictionReason = &now, reason
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, actor, &before, &user, ChangeRestrict)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if restricted {
+		log.Printf("🚧 Usuario %d restringido por %d: %s", user.ID, actor.UserID, reason)
+	}
+
+	user.Password = ""
+	events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+	return &user, nil
+}
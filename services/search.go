@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"api/database"
+	"api/search"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Límites de la búsqueda de usuarios para autocompletado
+const (
+	SearchMinLength    = 2
+	SearchDefaultLimit = 8
+	SearchMaxLimit     = 20
+)
+
+// UserMatch resultado de la búsqueda de usuarios: solo lo necesario para
+// mostrar la sugerencia
+type UserMatch struct {
+	ID        uint    `json:"id"`
+	Name      string  `json:"name"`
+	Username  *string `json:"username,omitempty"`
+	AvatarURL string  `json:"avatar_url,omitempty"`
+}
+
+// fuzzySearch indica si la búsqueda incluye nombres parecidos además de los
+// prefijos (PostgreSQL con pg_trgm y SEARCH_FUZZY distinto de false)
+func fuzzySearch() bool {
+	return database.HasTrigram() && os.Getenv("SEARCH_FUZZY") != "false"
+}
+
+// fuzzyThreshold similitud mínima (word_similarity de pg_trgm, entre 0 y 1) para
+// que un nombre cuente como parecido (SEARCH_FUZZY_THRESHOLD, por defecto 0.2:
+// las transposiciones en palabras cortas, como "jhon" por "john", comparten
+// pocos trigramas)
+func fuzzyThreshold() float64 {
+	if t, err := strconv.ParseFloat(os.Getenv("SEARCH_FUZZY_THRESHOLD"), 64); err == nil && t > 0 && t <= 1 {
+		return t
+	}
+	return 0.2
+}
+
+// SearchUsers busca usuarios activos cuyo nombre o email empiezan por q (sin
+// distinguir mayúsculas). Con pg_trgm también devuelve los nombres parecidos,
+// por detrás de los que coinciden por prefijo y ordenados por similitud. Con
+// menos de SearchMinLength caracteres no devuelve nada; limit se ajusta a
+// SearchMaxLimit. Con un motor externo (search.Default) la búsqueda se hace
+// en él y, si falla, en la base de datos.
+func SearchUsers(ctx context.Context, q string, limit int) ([]UserMatch, error) {
+	prefix := strings.ToLower(strings.TrimSpace(q))
+	matches := []UserMatch{}
+	if len([]rune(prefix)) < SearchMinLength {
+		return matches, nil
+	}
+	if limit <= 0 {
+		limit = SearchDefaultLimit
+	}
+	limit = min(limit, SearchMaxLimit)
+
+	if search.For(ctx) != nil {
+		found, err := searchEngine(ctx, prefix, limit)
+		if err == nil {
+			return found, nil
+		}
+		log.Printf("⚠️  Búsqueda de usuarios en el motor externo fallida, se usa la base de datos: %v", err)
+	}
+
+	byName, nameArgs := database.PrefixCondition("name", prefix)
+	byEmail, emailArgs := database.PrefixCondition("email", prefix)
+	byPrefix := "(" + byName + " OR " + byEmail + ")"
+	prefixArgs := append(append([]interface{}{}, nameArgs...), emailArgs...)
+	withQuery := append(append([]interface{}{}, prefixArgs...), prefix)
+
+	var users []database.User
+	find := func(tx *gorm.DB) error {
+		query := tx.Select("id", "name", "email", "username", "avatar_thumb_key").
+			Where("is_active = ? AND anonymized_at IS NULL AND deletion_scheduled_at IS NULL", true)
+		if !fuzzySearch() {
+			return query.Where(byPrefix, prefixArgs...).Order("name").Limit(limit).Find(&users).Error
+		}
+
+		// El operador <% usa el índice de trigramas con el umbral fijado en la transacción
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %g", fuzzyThreshold())).Error; err != nil {
+			return err
+		}
+		rank := clause.OrderBy{Expression: clause.Expr{
+			SQL:                byPrefix + " DESC, word_similarity(?, lower(name)) DESC, name",
+			Vars:               withQuery,
+			WithoutParentheses: true,
+		}}
+		return query.Where(byPrefix+" OR ? <% lower(name)", withQuery...).
+			Clauses(rank).Limit(limit).Find(&users).Error
+	}
+
+	db := database.DB.WithContext(ctx)
+	var err error
+	if fuzzySearch() {
+		err = db.Transaction(find)
+	} else {
+		err = find(db)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return userMatches(ctx, users), nil
+}
+
+// searchEngine busca en search.Default y completa los resultados con la base
+// de datos, en el orden de relevancia del motor. Los usuarios que ya no son
+// buscables se descartan aunque el índice aún no se haya actualizado.
+func searchEngine(ctx context.Context, q string, limit int) ([]UserMatch, error) {
+	ids, err := search.Default.Search(ctx, q, limit, os.Getenv("SEARCH_FUZZY") != "false")
+	if err != nil || len(ids) == 0 {
+		return []UserMatch{}, err
+	}
+	var found []database.User
+	err = database.DB.WithContext(ctx).Select("id", "name", "email", "username", "avatar_thumb_key").
+		Where("id IN ? AND is_active = ? AND anonymized_at IS NULL AND deletion_scheduled_at IS NULL", ids, true).
+		Find(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]database.User, len(found))
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+	users := make([]database.User, 0, len(found))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return userMatches(ctx, users), nil
+}
+
+func userMatches(ctx context.Context, users []database.User) []UserMatch {
+	matches := []UserMatch{}
+	for i := range users {
+		matches = append(matches, UserMatch{
+			ID:        users[i].ID,
+			Name:      users[i].Name,
+			Username:  users[i].Username,
+			AvatarURL: AvatarURL(ctx, &users[i]),
+		})
+	}
+	return matches
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api/auth"
+	"api/clock"
+	"api/database"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+// defaultMaxLifetime duración máxima de una sesión deslizante si no se configura SESSION_MAX_LIFETIME
+const defaultMaxLifetime = 7 * 24 * time.Hour
+
+// ErrSessionExpired la sesión del token caducó por inactividad
+var ErrSessionExpired = errors.New("sesión caducada por inactividad")
+
+// SessionIdleTimeout inactividad tras la que caduca una sesión del rol
+// (SESSION_IDLE_TIMEOUT_<ROL> o SESSION_IDLE_TIMEOUT). Con 0, por defecto, las
+// sesiones duran lo que el token (JWT_EXPIRATION) aunque se estén usando.
+func SessionIdleTimeout(role string) time.Duration {
+	if d, err := time.ParseDuration(roleSetting("SESSION_IDLE_TIMEOUT", role)); err == nil && d > 0 {
+		return d
+	}
+	return 0
+}
+
+// SessionMaxLifetime duración máxima de una sesión deslizante del rol, por mucho
+// que se use (SESSION_MAX_LIFETIME_<ROL> o SESSION_MAX_LIFETIME, 7 días por defecto)
+func SessionMaxLifetime(role string) time.Duration {
+	if d, err := time.ParseDuration(roleSetting("SESSION_MAX_LIFETIME", role)); err == nil && d > 0 {
+		return d
+	}
+	return defaultMaxLifetime
+}
+
+// newSessionClaims prepara los claims del token de una sesión nueva. Con
+// caducidad deslizante el token vale hasta la duración máxima de la sesión y es
+// la sesión la que caduca por inactividad.
+func newSessionClaims(ctx context.Context, user *database.User) auth.Claims {
+	claims := auth.NewClaims(user.ID, user.Email, user.Role)
+	claims.Tenant = tenancy.From(ctx)
+	claims.Permissions, claims.PermVersion = tokenPermissions(ctx, user.ID), user.PermVersion
+	if SessionIdleTimeout(user.Role) > 0 {
+		claims.ExpiresAt = time.Unix(claims.IssuedAt, 0).Add(SessionMaxLifetime(user.Role)).Unix()
+	}
+	return claims
+}
+
+// sessionExpiry caducidad de la sesión usada en now: now más la inactividad
+// permitida al rol, sin pasar de la caducidad del token
+func sessionExpiry(claims auth.Claims, now time.Time) time.Time {
+	expiry := time.Unix(claims.ExpiresAt, 0)
+	if idle := SessionIdleTimeout(claims.Role); idle > 0 && now.Add(idle).Before(expiry) {
+		expiry = now.Add(idle)
+	}
+	return expiry
+}
+
+// touchSession comprueba que la sesión del token sigue abierta y, con caducidad
+// deslizante, la prolonga. Los tokens sin sesión registrada se rechazan como
+// revocados: no se podrían revocar ni caducarían por inactividad. role es el
+// rol actual del usuario.
+func touchSession(ctx context.Context, claims *auth.Claims, role string) error {
+	db := database.DB.WithContext(ctx)
+	var session database.Session
+	err := db.First(&session, "id = ?", claims.ID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	now := clock.Now()
+	if !now.Before(session.ExpiresAt) {
+		return ErrSessionExpired
+	}
+
+	// Se escribe como mucho una vez por minuto y sesión, no en cada petición.
+	// El límite es el de la sesión: con renovación por cookie el token de
+	// acceso caduca antes
+	current := *claims
+	current.Role = role
+	current.ExpiresAt = session.TokenExpiresAt.Unix()
+	if expiry := sessionExpiry(current, now); expiry.Sub(session.ExpiresAt).Abs() >= time.Minute {
+		return db.Model(&session).Update("expires_at", expiry).Error
+	}
+	return nil
+}
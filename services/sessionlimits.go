@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"api/clock"
+	"api/database"
+)
+
+// Políticas al alcanzar el máximo de sesiones simultáneas
+const (
+	SessionLimitEvict  = "evict"
+	SessionLimitRefuse = "refuse"
+)
+
+// ErrTooManySessions el usuario ya tiene el máximo de sesiones abiertas y la
+// política es rechazar los nuevos inicios de sesión
+var ErrTooManySessions = errors.New("demasiadas sesiones abiertas")
+
+// MaxSessions máximo de sesiones abiertas a la vez para un rol: SESSION_LIMIT_<ROL>
+// (p. ej. SESSION_LIMIT_ADMIN=1) o, si no está, SESSION_LIMIT. 0 = sin límite.
+func MaxSessions(role string) int {
+	if n, err := strconv.Atoi(roleSetting("SESSION_LIMIT", role)); err == nil && n >= 0 {
+		return n
+	}
+	return 0
+}
+
+// roleSetting valor de la variable <key>_<ROL> o, si no está definida, de <key>
+func roleSetting(key, role string) string {
+	if value := os.Getenv(key + "_" + strings.ToUpper(role)); value != "" {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+// SessionLimitPolicy qué hacer al superar el máximo (SESSION_LIMIT_POLICY):
+// cerrar las sesiones más antiguas (evict, por defecto) o rechazar el inicio de
+// sesión (refuse)
+func SessionLimitPolicy() string {
+	if os.Getenv("SESSION_LIMIT_POLICY") == SessionLimitRefuse {
+		return SessionLimitRefuse
+	}
+	return SessionLimitEvict
+}
+
+// enforceSessionLimit deja sitio para una sesión nueva del usuario. Con la
+// política evict revoca las más antiguas y las devuelve; con refuse devuelve
+// ErrTooManySessions sin tocar ninguna.
+func enforceSessionLimit(ctx context.Context, user *database.User) ([]database.Session, error) {
+	limit := MaxSessions(user.Role)
+	if limit == 0 {
+		return nil, nil
+	}
+	sessions, err := ListSessions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) < limit {
+		return nil, nil
+	}
+	if SessionLimitPolicy() == SessionLimitRefuse {
+		return nil, ErrTooManySessions
+	}
+
+	// ListSessions las devuelve de la más reciente a la más antigua
+	evicted := sessions[limit-1:]
+	ids := make([]string, len(evicted))
+	for i, s := range evicted {
+		ids[i] = s.ID
+	}
+	now := clock.Now()
+	err = database.DB.WithContext(ctx).Model(&database.Session{}).
+		Where("id IN ? AND revoked_at IS NULL", ids).Update("revoked_at", now).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range evicted {
+		evicted[i].RevokedAt = &now
+	}
+	log.Printf("🔒 Cerradas %d sesiones del usuario %d por superar el máximo de %d", len(evicted), user.ID, limit)
+	return evicted, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"api/auth"
+	"api/clock"
+	"api/database"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultCookieAccessTTL vigencia de los tokens de acceso de las sesiones
+	// con cookie de renovación si no se configura COOKIE_ACCESS_TOKEN_TTL
+	defaultCookieAccessTTL = 15 * time.Minute
+	// refreshReuseGrace margen tras una renovación en el que el token de
+	// renovación anterior se rechaza sin revocar la sesión: dos pestañas del
+	// navegador pueden renovar a la vez con la misma cookie
+	refreshReuseGrace = 10 * time.Second
+)
+
+// ErrInvalidRefreshToken el token de renovación no es el vigente de ninguna sesión
+var ErrInvalidRefreshToken = errors.New("token de renovación inválido")
+
+// CookieAccessTokenTTL vigencia de los tokens de acceso de las sesiones con
+// cookie de renovación (COOKIE_ACCESS_TOKEN_TTL, 15 minutos por defecto)
+func CookieAccessTokenTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("COOKIE_ACCESS_TOKEN_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultCookieAccessTTL
+}
+
+// accessTokenExpiry caducidad de un token de acceso emitido en now para la
+// sesión de claims, sin pasar de la de la sesión
+func accessTokenExpiry(claims auth.Claims, now time.Time) int64 {
+	expiry := now.Add(CookieAccessTokenTTL())
+	if limit := time.Unix(claims.ExpiresAt, 0); limit.Before(expiry) {
+		expiry = limit
+	}
+	return expiry.Unix()
+}
+
+// SessionRefresh token de acceso nuevo y token de renovación que sustituye al usado
+type SessionRefresh struct {
+	Token            string
+	ExpiresIn        int
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// RefreshSession emite con el token de renovación de la cookie un token de
+// acceso para la misma sesión, con el rol y los permisos actuales, y rota el
+// token de renovación. Presentar uno ya rotado revoca la sesión: lo tiene
+// alguien más.
+func RefreshSession(ctx context.Context, refresh string) (*SessionRefresh, error) {
+	if refresh == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	db := database.DB.WithContext(ctx)
+	hash := auth.HashAPIKey(refresh)
+	var session database.Session
+	err := db.First(&session, "refresh_hash = ?", hash).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, detectRefreshReuse(ctx, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := activeUser(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := clock.Now()
+	claims := auth.NewClaims(user.ID, user.Email, user.Role)
+	claims.ID, claims.Tenant, claims.ExpiresAt = session.ID, tenancy.From(ctx), session.TokenExpiresAt.Unix()
+	if err := touchSession(ctx, &claims, user.Role); err != nil {
+		return nil, err
+	}
+	claims.Permissions, claims.PermVersion = tokenPermissions(ctx, user.ID), user.PermVersion
+	claims.ExpiresAt = accessTokenExpiry(claims, now)
+	token, err := auth.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	next := auth.RandomToken(32)
+	result := db.Model(&database.Session{}).Where("id = ? AND refresh_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{"refresh_hash": auth.HashAPIKey(next), "previous_refresh_hash": hash, "refreshed_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Otra petición lo renovó a la vez
+		return nil, ErrInvalidRefreshToken
+	}
+	return &SessionRefresh{
+		Token:            token,
+		ExpiresIn:        int(time.Unix(claims.ExpiresAt, 0).Sub(now).Seconds()),
+		RefreshToken:     next,
+		RefreshExpiresAt: session.TokenExpiresAt,
+	}, nil
+}
+
+// detectRefreshReuse trata un token de renovación que no es el vigente de
+// ninguna sesión. Si es el anterior de una y ya pasó refreshReuseGrace desde
+// la renovación, alguien más lo tiene: se revoca la sesión.
+func detectRefreshReuse(ctx context.Context, hash string) error {
+	db := database.DB.WithContext(ctx)
+	var session database.Session
+	if err := db.First(&session, "previous_refresh_hash = ? AND revoked_at IS NULL", hash).Error; err != nil {
+		return ErrInvalidRefreshToken
+	}
+	if session.RefreshedAt != nil && clock.Now().Sub(*session.RefreshedAt) < refreshReuseGrace {
+		return ErrInvalidRefreshToken
+	}
+	if err := db.Model(&session).Update("revoked_at", clock.Now()).Error; err != nil {
+		return err
+	}
+	log.Printf("🔒 Token de renovación reutilizado en la sesión %s del usuario %d; sesión revocada", session.ID, session.UserID)
+	return ErrSessionRevoked
+}
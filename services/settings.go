@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/preferences"
+
+	"gorm.io/gorm"
+)
+
+// ErrSettingsConflict las preferencias cambiaron desde la versión que leyó el cliente
+var ErrSettingsConflict = errors.New("las preferencias se han modificado en otra sesión")
+
+func init() {
+	exports.RegisterSection("settings", func(ctx context.Context, userID uint) (interface{}, error) {
+		return GetSettings(ctx, userID)
+	})
+	accounts.RegisterCleanup("settings", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		return tx.Where("user_id = ?", userID).Delete(&database.UserSettings{}).Error
+	})
+}
+
+// Settings preferencias efectivas del usuario (las guardadas completadas con
+// los valores por defecto) y la versión sobre la que se aplicarán los cambios
+type Settings struct {
+	Values    map[string]interface{} `json:"settings"`
+	Version   int                    `json:"version"`
+	UpdatedAt *time.Time             `json:"updated_at,omitempty"`
+}
+
+// GetSettings devuelve las preferencias del usuario; la versión es 0 si nunca las ha cambiado
+func GetSettings(ctx context.Context, userID uint) (*Settings, error) {
+	stored, err := storedSettings(database.DB.WithContext(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	return effectiveSettings(stored), nil
+}
+
+// UpdateSettings aplica changes sobre las preferencias guardadas (null vuelve al
+// valor por defecto). Con version, los cambios solo se aplican si las
+// preferencias siguen en esa versión; si no, ErrSettingsConflict. Los valores
+// inválidos se rechazan con un *preferences.Error.
+func UpdateSettings(ctx context.Context, userID uint, changes map[string]json.RawMessage, version *int) (*Settings, error) {
+	var result *Settings
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stored, err := storedSettings(tx, userID)
+		if err != nil {
+			return err
+		}
+		if version != nil && *version != stored.Version {
+			return ErrSettingsConflict
+		}
+		values, err := preferences.Merge(stored.Values, changes)
+		if err != nil {
+			return err
+		}
+
+		next := database.UserSettings{UserID: userID, Values: values, Version: stored.Version + 1, UpdatedAt: clock.Now()}
+		if stored.Version == 0 {
+			err = tx.Create(&next).Error
+		} else {
+			// La condición sobre la versión descarta las escrituras que se cruzan
+			update := tx.Model(&next).Where("version = ?", stored.Version).Select("preferences", "version", "updated_at").Updates(&next)
+			if err = update.Error; err == nil && update.RowsAffected == 0 {
+				err = ErrSettingsConflict
+			}
+		}
+		if err != nil {
+			return err
+		}
+		result = effectiveSettings(next)
+		return nil
+	})
+	return result, err
+}
+
+// storedSettings carga las preferencias guardadas; si no hay, unas vacías en la versión 0
+func storedSettings(db *gorm.DB, userID uint) (database.UserSettings, error) {
+	stored := database.UserSettings{UserID: userID}
+	err := db.Where("user_id = ?", userID).First(&stored).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return stored, err
+	}
+	return stored, nil
+}
+
+func effectiveSettings(stored database.UserSettings) *Settings {
+	settings := &Settings{Values: preferences.Effective(stored.Values), Version: stored.Version}
+	if stored.Version > 0 {
+		settings.UpdatedAt = &stored.UpdatedAt
+	}
+	return settings
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"api/branding"
+	"api/clock"
+	"api/database"
+	"api/ids"
+	"api/maintenance"
+	"api/risk"
+
+	"gorm.io/gorm"
+)
+
+// Vigencia e intentos de los códigos de verificación por correo
+const (
+	challengeTTL         = 10 * time.Minute
+	challengeMaxAttempts = 5
+)
+
+var (
+	// ErrStepUpRequired el inicio de sesión es arriesgado y se completa con el código enviado por correo
+	ErrStepUpRequired = errors.New("se requiere verificación adicional")
+	// ErrLoginBlocked el inicio de sesión se rechaza por su puntuación de riesgo
+	ErrLoginBlocked = errors.New("inicio de sesión bloqueado por riesgo")
+	// ErrInvalidChallenge el código no es correcto o la verificación caducó o ya se usó
+	ErrInvalidChallenge = errors.New("código de verificación incorrecto o caducado")
+)
+
+// riskReasons descripción de cada señal para el correo de verificación
+var riskReasons = map[string]string{
+	"impossible_travel": "ubicación incompatible con tu último acceso",
+	"tor_exit":          "conexión a través de TOR",
+	"velocity":          "muchos intentos en poco tiempo",
+}
+
+// createChallenge guarda una verificación pendiente y envía su código al usuario
+func createChallenge(ctx context.Context, user *database.User, assessment risk.Assessment) (*database.LoginChallenge, error) {
+	code, err := randomCode()
+	if err != nil {
+		return nil, err
+	}
+	challenge := database.LoginChallenge{
+		ID:          ids.New(),
+		UserID:      user.ID,
+		RiskScore:   assessment.Score,
+		RiskReasons: assessment.Reasons,
+		ExpiresAt:   clock.Now().Add(challengeTTL),
+	}
+	challenge.CodeHash = hashCode(challenge.ID, code)
+	if err := database.DB.WithContext(ctx).Create(&challenge).Error; err != nil {
+		return nil, err
+	}
+
+	reasons := make([]string, 0, len(assessment.Reasons))
+	for _, r := range assessment.Reasons {
+		if text, ok := riskReasons[r]; ok {
+			r = text
+		}
+		reasons = append(reasons, r)
+	}
+	body := fmt.Sprintf("Hola %s,\n\nHemos detectado un inicio de sesión inusual en tu cuenta (%s). "+
+		"Para completarlo introduce este código:\n\n  %s\n\nCaduca en %d minutos. Si no has sido tú, cambia tu contraseña.\n",
+		user.Name, strings.Join(reasons, ", "), code, int(challengeTTL.Minutes()))
+	if err := branding.Send(ctx, user.Email, "Código de verificación de inicio de sesión", body); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// CompleteChallenge comprueba el código de una verificación pendiente y, si es
+// correcto, completa el inicio de sesión con los datos del cliente que lo envía.
+// Con remember el dispositivo queda como de confianza durante
+// TrustedDeviceDuration y result.DeviceToken lo acredita.
+func CompleteChallenge(ctx context.Context, id, code string, remember bool, meta LoginMeta) (*LoginResult, error) {
+	db := database.DB.WithContext(ctx)
+
+	var challenge database.LoginChallenge
+	if err := db.First(&challenge, "id = ?", id).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if challenge.CompletedAt != nil || !clock.Now().Before(challenge.ExpiresAt) {
+		return nil, ErrInvalidChallenge
+	}
+	// El intento se consume antes de comparar y en una sola sentencia: con
+	// leer y luego sumar, varias peticiones simultáneas pasarían todas la
+	// comprobación y se podrían probar más de challengeMaxAttempts códigos
+	claim := db.Model(&database.LoginChallenge{}).
+		Where("id = ? AND attempts < ? AND completed_at IS NULL", challenge.ID, challengeMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if claim.Error != nil {
+		return nil, claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		return nil, ErrInvalidChallenge
+	}
+	if !hmac.Equal([]byte(hashCode(challenge.ID, strings.TrimSpace(code))), []byte(challenge.CodeHash)) {
+		return nil, ErrInvalidChallenge
+	}
+
+	// Se marca como usada antes de emitir el token: dos peticiones simultáneas
+	// con el mismo código no deben abrir dos sesiones
+	now := clock.Now()
+	result := db.Model(&database.LoginChallenge{}).Where("id = ? AND completed_at IS NULL", challenge.ID).Update("completed_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidChallenge
+	}
+
+	var user database.User
+	if err := db.First(&user, challenge.UserID).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	// Se pudo desactivar mientras el código estaba pendiente
+	if !user.IsActive {
+		return nil, ErrAccountDisabled
+	}
+	if !IsAdmin(user.Role) && maintenance.Current().Enabled {
+		return nil, ErrMaintenance
+	}
+
+	login, err := startSession(ctx, &user, meta, &risk.Assessment{
+		Score:    challenge.RiskScore,
+		Decision: risk.Challenge,
+		Reasons:  challenge.RiskReasons,
+	})
+	if err != nil || !remember || login.Device == nil {
+		return login, err
+	}
+	token, until, err := trustDevice(ctx, login.Device)
+	if err != nil {
+		return nil, err
+	}
+	login.DeviceToken, login.DeviceTrustedUntil = token, &until
+	return login, nil
+}
+
+// randomCode genera un código numérico de 6 cifras
+func randomCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func hashCode(id, code string) string {
+	sum := sha256.Sum256([]byte(id + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
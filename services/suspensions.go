@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/events"
+	"api/exports"
+
+	"gorm.io/gorm"
+)
+
+// Acciones registradas en una suspensión
+const (
+	SuspensionSuspend      = "suspend"
+	SuspensionAppeal       = "appeal"
+	SuspensionRejectAppeal = "reject_appeal"
+	SuspensionLift         = "lift"
+)
+
+// Estados de la apelación de una suspensión
+const (
+	AppealPending  = "pending"
+	AppealRejected = "rejected"
+	AppealAccepted = "accepted"
+)
+
+var (
+	// ErrAlreadySuspended el usuario ya tiene una suspensión en curso
+	ErrAlreadySuspended = errors.New("el usuario ya está suspendido")
+	// ErrNotSuspended el usuario no tiene ninguna suspensión en curso
+	ErrNotSuspended = errors.New("el usuario no está suspendido")
+	// ErrSelfSuspension un administrador no puede suspender su propia cuenta
+	ErrSelfSuspension = errors.New("no puedes suspender tu propia cuenta")
+	// ErrInvalidSuspensionEnd el fin de la suspensión no es futuro
+	ErrInvalidSuspensionEnd = errors.New("el fin de la suspensión tiene que ser futuro")
+	// ErrAppealExists la suspensión ya se apeló
+	ErrAppealExists = errors.New("la suspensión ya se apeló")
+	// ErrNoPendingAppeal la suspensión no tiene una apelación por decidir
+	ErrNoPendingAppeal = errors.New("la suspensión no tiene una apelación pendiente")
+)
+
+func init() {
+	exports.RegisterSection("suspensions", func(ctx context.Context, userID uint) (interface{}, error) {
+		var suspensions []database.Suspension
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&suspensions).Error
+		return suspensions, err
+	})
+	accounts.RegisterCleanup("suspensions", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		ids := tx.Model(&database.Suspension{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("suspension_id IN (?)", ids).Delete(&database.SuspensionAction{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.Suspension{}).Error
+	})
+}
+
+// SuspensionNotice lo que ve el usuario de su suspensión en curso
+type SuspensionNotice struct {
+	Reason      string     `json:"reason"`
+	SuspendedAt time.Time  `json:"suspended_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	// Estado de su apelación; vacío si no ha apelado
+	AppealStatus string `json:"appeal_status,omitempty"`
+}
+
+func noticeOf(s *database.Suspension) *SuspensionNotice {
+	return &SuspensionNotice{Reason: s.Reason, SuspendedAt: s.CreatedAt, EndsAt: s.EndsAt, AppealStatus: s.AppealStatus}
+}
+
+// userSuspension devuelve la suspensión en curso del usuario o nil. Solo
+// consulta la base de datos si el usuario tiene una: las que pasaron de su fin
+// ya no cuentan.
+func userSuspension(ctx context.Context, user *database.User) (*database.Suspension, error) {
+	if user.SuspensionID == nil {
+		return nil, nil
+	}
+	var suspension database.Suspension
+	err := database.DB.WithContext(ctx).Where("id = ? AND lifted_at IS NULL", *user.SuspensionID).First(&suspension).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if suspension.EndsAt != nil && !clock.Now().Before(*suspension.EndsAt) {
+		return nil, nil
+	}
+	return &suspension, nil
+}
+
+// suspensionNotice aviso de la suspensión en curso del usuario o nil
+func suspensionNotice(ctx context.Context, user *database.User) (*SuspensionNotice, error) {
+	suspension, err := userSuspension(ctx, user)
+	if err != nil || suspension == nil {
+		return nil, err
+	}
+	return noticeOf(suspension), nil
+}
+
+// MySuspension devuelve el aviso de la suspensión en curso del usuario
+// (ErrNotSuspended si no tiene)
+func MySuspension(ctx context.Context, userID uint) (*SuspensionNotice, error) {
+	user, err := activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	notice, err := suspensionNotice(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if notice == nil {
+		return nil, ErrNotSuspended
+	}
+	return notice, nil
+}
+
+// suspendable carga el usuario sobre el que actúa un administrador y su
+// suspensión en curso
+func suspendable(ctx context.Context, id interface{}) (*database.User, *database.Suspension, error) {
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrUserNotFound
+		}
+		return nil, nil, err
+	}
+	if user.AnonymizedAt != nil {
+		return nil, nil, ErrUserNotFound
+	}
+	suspension, err := userSuspension(ctx, &user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, suspension, nil
+}
+
+// SuspendUser suspende la cuenta indicada hasta until (nil = hasta que se
+// levante). A diferencia de la desactivación, el usuario puede iniciar sesión,
+// pero el resto de peticiones responden con el motivo salvo las que le permiten
+// consultar la suspensión y apelarla. Sus sesiones no se cierran.
+func SuspendUser(ctx context.Context, actor Identity, id interface{}, reason string, until *time.Time) (*database.Suspension, error) {
+	user, current, err := suspendable(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == actor.UserID && actor.ActingTenant == "" {
+		return nil, ErrSelfSuspension
+	}
+	if until != nil && !clock.Now().Before(*until) {
+		return nil, ErrInvalidSuspensionEnd
+	}
+	if current != nil {
+		return nil, ErrAlreadySuspended
+	}
+
+	suspension := database.Suspension{UserID: user.ID, Reason: reason, EndsAt: until, CreatedBy: actor.UserID, CreatedAt: clock.Now()}
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&suspension).Error; err != nil {
+			return err
+		}
+		if err := recordSuspensionAction(tx, &suspension, actor.UserID, SuspensionSuspend, reason); err != nil {
+			return err
+		}
+		return tx.Model(user).Update("suspension_id", suspension.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("⛔ Usuario %d suspendido por %d", user.ID, actor.UserID)
+	events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+	return &suspension, nil
+}
+
+// LiftSuspension levanta la suspensión en curso del usuario; si tenía una
+// apelación pendiente queda aceptada
+func LiftSuspension(ctx context.Context, actor Identity, id interface{}, note string) (*database.Suspension, error) {
+	user, suspension, err := suspendable(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if suspension == nil {
+		return nil, ErrNotSuspended
+	}
+
+	now := clock.Now()
+	suspension.LiftedAt, suspension.LiftedBy = &now, &actor.UserID
+	updates := map[string]interface{}{"lifted_at": now, "lifted_by": actor.UserID}
+	if suspension.AppealStatus == AppealPending {
+		suspension.AppealStatus = AppealAccepted
+		updates["appeal_status"] = AppealAccepted
+	}
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(suspension).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := recordSuspensionAction(tx, suspension, actor.UserID, SuspensionLift, note); err != nil {
+			return err
+		}
+		return tx.Model(user).Update("suspension_id", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+	return suspension, nil
+}
+
+// AppealSuspension registra la apelación del usuario a su suspensión en curso;
+// solo se admite una por suspensión
+func AppealSuspension(ctx context.Context, userID uint, message string) (*SuspensionNotice, error) {
+	user, err := activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	suspension, err := userSuspension(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if suspension == nil {
+		return nil, ErrNotSuspended
+	}
+
+	now := clock.Now()
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Suspension{}).Where("id = ? AND appealed_at IS NULL", suspension.ID).
+			Updates(map[string]interface{}{"appeal": message, "appealed_at": now, "appeal_status": AppealPending})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAppealExists
+		}
+		return recordSuspensionAction(tx, suspension, userID, SuspensionAppeal, message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	suspension.AppealStatus = AppealPending
+	return noticeOf(suspension), nil
+}
+
+// RejectSuspensionAppeal rechaza la apelación pendiente de la suspensión en
+// curso del usuario, que sigue suspendido
+func RejectSuspensionAppeal(ctx context.Context, actor Identity, id interface{}, note string) (*database.Suspension, error) {
+	_, suspension, err := suspendable(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if suspension == nil {
+		return nil, ErrNotSuspended
+	}
+	if suspension.AppealStatus != AppealPending {
+		return nil, ErrNoPendingAppeal
+	}
+
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&database.Suspension{}).Where("id = ? AND appeal_status = ?", suspension.ID, AppealPending).
+			Update("appeal_status", AppealRejected)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNoPendingAppeal
+		}
+		return recordSuspensionAction(tx, suspension, actor.UserID, SuspensionRejectAppeal, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	suspension.AppealStatus = AppealRejected
+	return suspension, nil
+}
+
+func recordSuspensionAction(tx *gorm.DB, suspension *database.Suspension, actorID uint, action, note string) error {
+	return tx.Create(&database.SuspensionAction{
+		SuspensionID: suspension.ID,
+		ActorID:      actorID,
+		Action:       action,
+		Note:         note,
+		CreatedAt:    clock.Now(),
+	}).Error
+}
+
+// UserSuspensions devuelve las suspensiones del usuario, las más recientes
+// primero, con todas sus acciones para revisar las apelaciones
+func UserSuspensions(ctx context.Context, userID uint) ([]database.Suspension, error) {
+	db := database.DB.WithContext(ctx)
+	if err := db.Unscoped().Select("id").First(&database.User{}, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	var suspensions []database.Suspension
+	err := db.Where("user_id = ?", userID).
+		Preload("Actions", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at, id") }).
+		Order("created_at DESC, id DESC").Find(&suspensions).Error
+	return suspensions, err
+}
+
+// PendingAppeals devuelve las suspensiones en curso con una apelación por
+// decidir, las más antiguas primero
+func PendingAppeals(ctx context.Context, offset, limit int) ([]database.Suspension, database.Total, error) {
+	query := database.DB.WithContext(ctx).Model(&database.Suspension{}).
+		Where("appeal_status = ? AND lifted_at IS NULL AND (ends_at IS NULL OR ends_at > ?)", AppealPending, clock.Now())
+	total, err := database.Count(query)
+	if err != nil {
+		return nil, total, err
+	}
+	var suspensions []database.Suspension
+	if err := query.Order("appealed_at, id").Offset(offset).Limit(limit).Find(&suspensions).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+	return suspensions, total, nil
+}
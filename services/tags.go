@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/preload"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxBulkTags etiquetas que se pueden asignar y quitar en una asignación en bloque
+const MaxBulkTags = 20
+
+// tagPattern nombres de etiqueta válidos (ya en minúsculas)
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,39}$`)
+
+var (
+	// ErrInvalidTag el nombre de la etiqueta no es válido
+	ErrInvalidTag = errors.New("etiqueta inválida: minúsculas, dígitos, _, . y -, empezando por letra o dígito (1-40 caracteres)")
+	// ErrTagNotFound no existe ninguna etiqueta con ese nombre
+	ErrTagNotFound = errors.New("etiqueta no encontrada")
+)
+
+func init() {
+	accounts.RegisterCleanup("tags", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		return tx.Where("user_id = ?", userID).Delete(&database.UserTag{}).Error
+	})
+	preload.Register("users", "tags", preload.Relation{Fetch: fetchUserTags, AdminOnly: true})
+}
+
+// NormalizeTag pasa el nombre a minúsculas y comprueba que es válido
+func NormalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !tagPattern.MatchString(name) {
+		return "", ErrInvalidTag
+	}
+	return name, nil
+}
+
+// ParseTags normaliza una lista de etiquetas separadas por comas, sin repetidas
+func ParseTags(list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	return normalizeTags(strings.Split(list, ","))
+}
+
+func normalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		tag, err := NormalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// UserFilter filtros del listado de usuarios; los vacíos no filtran
+type UserFilter struct {
+	// Solo los usuarios que tienen todas estas etiquetas (ya normalizadas)
+	Tags []string
+}
+
+// scope aplica el filtro a una consulta sobre users
+func (f UserFilter) scope(db *gorm.DB) *gorm.DB {
+	if len(f.Tags) == 0 {
+		return db
+	}
+	tagged := db.Session(&gorm.Session{NewDB: true}).Model(&database.UserTag{}).
+		Select("user_tags.user_id").
+		Joins("JOIN tags ON tags.id = user_tags.tag_id").
+		Where("tags.name IN ?", f.Tags).
+		Group("user_tags.user_id").
+		Having("COUNT(*) = ?", len(f.Tags))
+	return db.Where("users.id IN (?)", tagged)
+}
+
+// TagCount etiqueta con el número de usuarios que la tienen
+type TagCount struct {
+	Name      string    `json:"name"`
+	Users     int64     `json:"users"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListTags devuelve todas las etiquetas por nombre con cuántos usuarios la tienen
+func ListTags(ctx context.Context) ([]TagCount, error) {
+	var tags []database.Tag
+	db := database.DB.WithContext(ctx)
+	if err := db.Order("name").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		TagID uint
+		Users int64
+	}
+	if err := db.Model(&database.UserTag{}).Select("tag_id, COUNT(*) AS users").Group("tag_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	byTag := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		byTag[count.TagID] = count.Users
+	}
+	list := make([]TagCount, len(tags))
+	for i, tag := range tags {
+		list[i] = TagCount{Name: tag.Name, Users: byTag[tag.ID], CreatedAt: tag.CreatedAt}
+	}
+	return list, nil
+}
+
+// UserTags devuelve las etiquetas del usuario por nombre
+func UserTags(ctx context.Context, userID uint) ([]string, error) {
+	if _, err := GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	err := database.DB.WithContext(ctx).Model(&database.UserTag{}).
+		Joins("JOIN tags ON tags.id = user_tags.tag_id").
+		Where("user_tags.user_id = ?", userID).
+		Order("tags.name").Pluck("tags.name", &tags).Error
+	return tags, err
+}
+
+// TagUser asigna la etiqueta al usuario, creándola si no existe, y devuelve
+// sus etiquetas. Si ya la tenía no cambia.
+func TagUser(ctx context.Context, actor Identity, userID uint, name string) ([]string, error) {
+	tag, err := NormalizeTag(name)
+	if err != nil {
+		return nil, err
+	}
+	return tagUser(ctx, actor, userID, []string{tag}, nil)
+}
+
+// UntagUser quita la etiqueta al usuario y devuelve sus etiquetas. Si no la
+// tenía no cambia.
+func UntagUser(ctx context.Context, actor Identity, userID uint, name string) ([]string, error) {
+	tag, err := NormalizeTag(name)
+	if err != nil {
+		return nil, err
+	}
+	return tagUser(ctx, actor, userID, nil, []string{tag})
+}
+
+// tagUser aplica BulkTagUsers a un solo usuario y devuelve sus etiquetas
+func tagUser(ctx context.Context, actor Identity, userID uint, add, remove []string) ([]string, error) {
+	result, err := BulkTagUsers(ctx, actor, []uint{userID}, add, remove)
+	if err != nil {
+		return nil, err
+	}
+	if result.Users == 0 {
+		return nil, ErrUserNotFound
+	}
+	return UserTags(ctx, userID)
+}
+
+// BulkTagResult resultado de una asignación en bloque de etiquetas
+type BulkTagResult struct {
+	// Usuarios a los que se aplicó
+	Users int `json:"users"`
+	// IDs pedidos que no son de ningún usuario
+	Missing []uint `json:"missing"`
+	// Asignaciones creadas y quitadas; las que ya estaban no cuentan
+	Added   int64 `json:"added"`
+	Removed int64 `json:"removed"`
+}
+
+// BulkTagUsers asigna las etiquetas add y quita las remove a los usuarios
+// indicados en una sola transacción. Las etiquetas nuevas se crean; las
+// asignaciones que ya existían se dejan como estaban; remove se aplica después
+// de add.
+func BulkTagUsers(ctx context.Context, actor Identity, userIDs []uint, add, remove []string) (*BulkTagResult, error) {
+	add, err := normalizeTags(add)
+	if err != nil {
+		return nil, err
+	}
+	remove, err = normalizeTags(remove)
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.DB.WithContext(ctx)
+	var found []uint
+	if err := db.Model(&database.User{}).Where("id IN ? AND anonymized_at IS NULL", userIDs).Pluck("id", &found).Error; err != nil {
+		return nil, err
+	}
+	result := &BulkTagResult{Users: len(found), Missing: missingIDs(userIDs, found)}
+	if len(found) == 0 {
+		return result, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if len(add) > 0 {
+			ids, err := ensureTags(tx, add)
+			if err != nil {
+				return err
+			}
+			now := clock.Now()
+			rows := make([]database.UserTag, 0, len(found)*len(ids))
+			for _, userID := range found {
+				for _, tagID := range ids {
+					rows = append(rows, database.UserTag{UserID: userID, TagID: tagID, CreatedBy: actor.UserID, CreatedAt: now})
+				}
+			}
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(rows, 500)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Added = res.RowsAffected
+		}
+		if len(remove) > 0 {
+			tags := tx.Model(&database.Tag{}).Select("id").Where("name IN ?", remove)
+			res := tx.Where("user_id IN ? AND tag_id IN (?)", found, tags).Delete(&database.UserTag{})
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Removed = res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(userIDs) > 1 {
+		log.Printf("🏷️ Etiquetas aplicadas por %d a %d usuarios: +%v -%v", actor.UserID, len(found), add, remove)
+	}
+	return result, nil
+}
+
+// ensureTags crea las etiquetas que aún no existen y devuelve los IDs de todas
+func ensureTags(tx *gorm.DB, names []string) ([]uint, error) {
+	now := clock.Now()
+	tags := make([]database.Tag, len(names))
+	for i, name := range names {
+		tags[i] = database.Tag{Name: name, CreatedAt: now}
+	}
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Create(&tags).Error; err != nil {
+		return nil, err
+	}
+	var ids []uint
+	err := tx.Model(&database.Tag{}).Where("name IN ?", names).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// missingIDs IDs de requested que no están en found, ordenados y sin repetir
+func missingIDs(requested, found []uint) []uint {
+	present := make(map[uint]bool, len(found))
+	for _, id := range found {
+		present[id] = true
+	}
+	missing := []uint{}
+	for _, id := range requested {
+		if !present[id] {
+			missing = append(missing, id)
+			present[id] = true
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return missing
+}
+
+// DeleteTag elimina la etiqueta y la quita a todos los usuarios
+func DeleteTag(ctx context.Context, name string) error {
+	name, err := NormalizeTag(name)
+	if err != nil {
+		return ErrTagNotFound
+	}
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var tag database.Tag
+		if err := tx.Where("name = ?", name).First(&tag).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTagNotFound
+			}
+			return err
+		}
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&database.UserTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+}
+
+// fetchUserTags nombres de las etiquetas de cada usuario (lista vacía si ninguna)
+func fetchUserTags(ctx context.Context, ids []uint) (map[uint]interface{}, error) {
+	var rows []struct {
+		UserID uint
+		Name   string
+	}
+	err := database.DB.WithContext(ctx).Model(&database.UserTag{}).
+		Select("user_tags.user_id, tags.name").
+		Joins("JOIN tags ON tags.id = user_tags.tag_id").
+		Where("user_tags.user_id IN ?", ids).
+		Order("user_tags.user_id, tags.name").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]interface{}, len(ids))
+	byUser := make(map[uint][]string, len(ids))
+	for _, id := range ids {
+		byUser[id] = []string{}
+	}
+	for _, row := range rows {
+		byUser[row.UserID] = append(byUser[row.UserID], row.Name)
+	}
+	for id, tags := range byUser {
+		result[id] = tags
+	}
+	return result, nil
+}
@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api/backup"
+	"api/clock"
+	"api/database"
+	"api/events"
+	"api/ids"
+	"api/jobs"
+	"api/plans"
+	"api/quotas"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTenancyDisabled la instalación no tiene tenants (TENANCY distinto de schema)
+	ErrTenancyDisabled = errors.New("el aislamiento por tenants no está activo (TENANCY=schema)")
+	// ErrInvalidTenantSlug el identificador no sirve como nombre de esquema
+	ErrInvalidTenantSlug = errors.New("identificador de tenant inválido: minúsculas, dígitos y _, empezando por una letra (2-40 caracteres)")
+	// ErrTenantExists ya hay un tenant activo con ese identificador
+	ErrTenantExists = errors.New("ya existe un tenant con ese identificador")
+	// ErrTenantNotFound no hay ningún tenant con ese identificador
+	ErrTenantNotFound = errors.New("tenant no encontrado")
+	// ErrTenantUnavailable el tenant existe pero no admite peticiones (en
+	// creación o con la migración de su esquema fallida)
+	ErrTenantUnavailable = errors.New("tenant no disponible")
+	// ErrTenantSuspended el tenant está suspendido (ver su SuspendReason)
+	ErrTenantSuspended = errors.New("tenant suspendido")
+	// ErrTenantState el estado del tenant no admite la operación pedida
+	ErrTenantState = errors.New("el estado del tenant no admite la operación")
+	// ErrInvalidSuspendReason el motivo de suspensión no es billing ni admin
+	ErrInvalidSuspendReason = errors.New("motivo de suspensión inválido: billing o admin")
+	// ErrUserLimitReached el tenant ya tiene los usuarios que permite su cuota
+	// users_per_org
+	ErrUserLimitReached = errors.New("el tenant ha alcanzado su máximo de usuarios")
+)
+
+// Motivos de suspensión de un tenant
+const (
+	// SuspendBilling impago: sus peticiones responden 402
+	SuspendBilling = "billing"
+	// SuspendAdmin decisión de la administración: sus peticiones responden 403
+	SuspendAdmin = "admin"
+)
+
+// TenantExportJob trabajo que exporta el esquema de un tenant
+const TenantExportJob = "tenants.export"
+
+// TenantExportPayload datos del trabajo TenantExportJob
+type TenantExportPayload struct {
+	BackupID string `json:"backup_id"`
+}
+
+// tenantCacheTTL tiempo que se reutiliza la lista de tenants; con varias
+// instancias un tenant nuevo tarda como máximo esto en aceptarse en las demás
+const tenantCacheTTL = 5 * time.Second
+
+var (
+	tenantsMu       sync.Mutex
+	tenantsBySlug   map[string]database.Tenant
+	tenantsLoadedAt time.Time
+)
+
+// TenantAdmin primer administrador que se crea en el esquema de un tenant nuevo
+type TenantAdmin struct {
+	Email    string
+	Password string
+	Name     string
+}
+
+// ProvisionTenant da de alta un tenant: lo registra, crea su esquema con todas
+// las tablas, los planes predefinidos y, si se indica, su primer
+// administrador. Si falla a medias el tenant queda como failed y volver a
+// llamarlo con el mismo identificador reintenta el alta. by es el
+// administrador de la plataforma que lo pide (0 si no lo pide ninguno).
+func ProvisionTenant(ctx context.Context, slug, name string, admin *TenantAdmin, by uint) (*database.Tenant, error) {
+	if !tenancy.Enabled() {
+		return nil, ErrTenancyDisabled
+	}
+	if !tenancy.ValidSlug(slug) {
+		return nil, ErrInvalidTenantSlug
+	}
+	// La contraseña del administrador se comprueba antes de crear nada para no
+	// dejar el tenant a medias por ella
+	if admin != nil {
+		if err := checkPassword(ctx, admin.Password); err != nil {
+			return nil, err
+		}
+	}
+	// El registro de tenants está en el esquema public
+	db := database.DB.WithContext(tenancy.With(ctx, ""))
+
+	var tenant database.Tenant
+	err := db.Where("slug = ?", slug).First(&tenant).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		tenant = database.Tenant{Slug: slug, Name: name, Status: "provisioning"}
+		if err := db.Create(&tenant).Error; err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case tenant.Status == "active", tenant.Status == "suspended":
+		return nil, ErrTenantExists
+	default:
+		if err := db.Model(&tenant).Updates(map[string]interface{}{"name": name, "status": "provisioning", "error": ""}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := provision(tenancy.With(ctx, slug), admin); err != nil {
+		log.Printf("❌ Alta del tenant %s fallida: %v", slug, err)
+		db.Model(&tenant).Updates(map[string]interface{}{"status": "failed", "error": err.Error()})
+		return nil, err
+	}
+	if err := db.Model(&tenant).Updates(map[string]interface{}{"status": "active", "error": ""}).Error; err != nil {
+		return nil, err
+	}
+	tenant.Status, tenant.Error = "active", ""
+	invalidateTenants()
+	recordTenantEvent(ctx, slug, events.TenantProvisioned, by, "")
+	log.Printf("🏢 Tenant %s dado de alta en el esquema %s", slug, tenant.Schema())
+	return &tenant, nil
+}
+
+// provision prepara el esquema del tenant de ctx
+func provision(ctx context.Context, admin *TenantAdmin) error {
+	if err := database.MigrateTenant(ctx, tenancy.From(ctx)); err != nil {
+		return fmt.Errorf("migrando el esquema: %w", err)
+	}
+	if err := plans.Seed(ctx); err != nil {
+		return fmt.Errorf("creando los planes: %w", err)
+	}
+	if admin == nil {
+		return nil
+	}
+	user, err := RegisterUser(ctx, admin.Email, admin.Password, admin.Name)
+	if errors.Is(err, ErrEmailTaken) {
+		// Reintento de un alta que ya había creado al administrador
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("creando el administrador: %w", err)
+	}
+	return database.DB.WithContext(ctx).Model(user).
+		Updates(map[string]interface{}{"role": "admin", "perm_version": gorm.Expr("perm_version + 1")}).Error
+}
+
+// ListTenants devuelve todos los tenants, incluidos los que no están activos
+func ListTenants(ctx context.Context) ([]database.Tenant, error) {
+	if !tenancy.Enabled() {
+		return nil, ErrTenancyDisabled
+	}
+	var list []database.Tenant
+	err := database.DB.WithContext(tenancy.With(ctx, "")).Order("slug").Find(&list).Error
+	return list, err
+}
+
+// GetTenant devuelve el tenant slug sea cual sea su estado
+func GetTenant(ctx context.Context, slug string) (*database.Tenant, error) {
+	if !tenancy.Enabled() {
+		return nil, ErrTenancyDisabled
+	}
+	var tenant database.Tenant
+	err := database.DB.WithContext(tenancy.With(ctx, "")).Where("slug = ?", slug).First(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// SuspendTenant suspende un tenant activo, o cambia el motivo de uno ya
+// suspendido: sus peticiones se rechazan y sus trabajos periódicos dejan de
+// ejecutarse, pero sus datos se conservan
+func SuspendTenant(ctx context.Context, slug, reason string, by uint) (*database.Tenant, error) {
+	if reason != SuspendBilling && reason != SuspendAdmin {
+		return nil, ErrInvalidSuspendReason
+	}
+	tenant, err := GetTenant(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Status != "active" && tenant.Status != "suspended" {
+		return nil, ErrTenantState
+	}
+	now := clock.Now()
+	if err := database.DB.WithContext(tenancy.With(ctx, "")).Model(tenant).Updates(map[string]interface{}{
+		"status": "suspended", "suspend_reason": reason, "suspended_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	tenant.Status, tenant.SuspendReason, tenant.SuspendedAt = "suspended", reason, &now
+	invalidateTenants()
+	recordTenantEvent(ctx, slug, events.TenantSuspended, by, reason)
+	log.Printf("⏸️  Tenant %s suspendido (%s)", slug, reason)
+	return tenant, nil
+}
+
+// ResumeTenant reactiva un tenant suspendido. Antes migra su esquema: al
+// arrancar solo se migran los tenants activos.
+func ResumeTenant(ctx context.Context, slug string, by uint) (*database.Tenant, error) {
+	tenant, err := GetTenant(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Status != "suspended" {
+		return nil, ErrTenantState
+	}
+	if err := database.MigrateTenant(tenancy.With(ctx, slug), slug); err != nil {
+		return nil, fmt.Errorf("migrando el esquema: %w", err)
+	}
+	if err := database.DB.WithContext(tenancy.With(ctx, "")).Model(tenant).Updates(map[string]interface{}{
+		"status": "active", "suspend_reason": "", "suspended_at": nil,
+	}).Error; err != nil {
+		return nil, err
+	}
+	tenant.Status, tenant.SuspendReason, tenant.SuspendedAt = "active", "", nil
+	invalidateTenants()
+	recordTenantEvent(ctx, slug, events.TenantResumed, by, "")
+	log.Printf("▶️  Tenant %s reactivado", slug)
+	return tenant, nil
+}
+
+// ExportTenant pide una copia cifrada del esquema del tenant, que se hace en
+// segundo plano y se descarga como las copias de seguridad
+// (GET /admin/backups/{id}). Se restaura con api restore.
+func ExportTenant(ctx context.Context, slug string, by uint) (*database.Backup, error) {
+	tenant, err := GetTenant(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Status != "active" && tenant.Status != "suspended" {
+		return nil, ErrTenantState
+	}
+	ctx = tenancy.With(ctx, "")
+	b := database.Backup{ID: ids.New(), Status: "pending", Tenant: slug, RequestedBy: &by}
+	if err := database.DB.WithContext(ctx).Create(&b).Error; err != nil {
+		return nil, err
+	}
+	if err := jobs.Enqueue(ctx, TenantExportJob, TenantExportPayload{BackupID: b.ID}); err != nil {
+		database.DB.WithContext(ctx).Model(&b).Update("status", "failed")
+		return nil, err
+	}
+	return &b, nil
+}
+
+// RunTenantExport trabajo TenantExportJob: hace la copia del esquema y publica
+// si ha terminado o fallado. No se reintenta: la copia queda como failed y
+// se puede pedir otra.
+func RunTenantExport(ctx context.Context, payload []byte) error {
+	var p TenantExportPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var b database.Backup
+	if err := database.DB.WithContext(ctx).First(&b, "id = ?", p.BackupID).Error; err != nil {
+		return err
+	}
+	if err := backup.Run(ctx, &b); err != nil {
+		log.Printf("❌ Exportación del tenant %s fallida: %v", b.Tenant, err)
+		recordTenantEvent(ctx, b.Tenant, events.TenantExportFailed, 0, err.Error())
+		return nil
+	}
+	recordTenantEvent(ctx, b.Tenant, events.TenantExported, 0, b.ID)
+	return nil
+}
+
+// DeleteTenant da de baja un tenant: borra su esquema con todos sus datos y
+// su registro, de modo que el identificador queda libre. Solo se admite con
+// el tenant suspendido o con el alta fallida, para que no se borre uno en uso
+// por error; conviene exportarlo antes.
+func DeleteTenant(ctx context.Context, slug string, by uint) error {
+	tenant, err := GetTenant(ctx, slug)
+	if err != nil {
+		return err
+	}
+	if tenant.Status != "suspended" && tenant.Status != "failed" {
+		return ErrTenantState
+	}
+	if err := database.DropTenant(ctx, slug); err != nil {
+		return err
+	}
+	if err := database.DB.WithContext(tenancy.With(ctx, "")).Delete(tenant).Error; err != nil {
+		return err
+	}
+	invalidateTenants()
+	recordTenantEvent(ctx, slug, events.TenantDeleted, by, "")
+	log.Printf("🗑️  Tenant %s dado de baja", slug)
+	return nil
+}
+
+// checkTenantUsers comprueba que el tenant de ctx admita un usuario más según
+// su cuota users_per_org. Dos altas simultáneas pueden superarla en uno.
+func checkTenantUsers(ctx context.Context) error {
+	slug := tenancy.From(ctx)
+	if slug == "" {
+		return nil
+	}
+	// Sin LookupTenant: durante el alta el tenant aún no está activo y ya se
+	// crea su administrador
+	tenant, err := GetTenant(ctx, slug)
+	if err != nil {
+		return err
+	}
+	_, ok, err := quotas.Check(ctx, quotas.ScopeTenant, tenant.ID, quotas.UsersPerOrg, 1)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUserLimitReached
+	}
+	return nil
+}
+
+// recordTenantEvent guarda en public un evento del ciclo de vida del tenant
+// y lo publica. Un error al guardarlo no deshace la operación.
+func recordTenantEvent(ctx context.Context, slug, kind string, by uint, detail string) {
+	ctx = tenancy.With(ctx, "")
+	event := database.TenantEvent{Tenant: slug, Type: kind, Detail: detail}
+	if by != 0 {
+		event.ActorID = &by
+	}
+	if err := database.DB.WithContext(ctx).Create(&event).Error; err != nil {
+		log.Printf("⚠️  No se pudo registrar el evento %s del tenant %s: %v", kind, slug, err)
+	}
+	events.Publish(ctx, events.Event{Type: kind, Tenant: slug})
+}
+
+// LookupTenant comprueba que el tenant exista y esté activo. Usa una lista en
+// memoria que se recarga cada tenantCacheTTL. Con el tenant suspendido lo
+// devuelve junto con ErrTenantSuspended, para consultar el motivo.
+func LookupTenant(ctx context.Context, slug string) (*database.Tenant, error) {
+	tenantsMu.Lock()
+	defer tenantsMu.Unlock()
+	if time.Since(tenantsLoadedAt) >= tenantCacheTTL {
+		var list []database.Tenant
+		err := database.DB.WithContext(tenancy.With(ctx, "")).Find(&list).Error
+		if err != nil && tenantsBySlug == nil {
+			return nil, err
+		}
+		// Ante un error de lectura se mantiene la última lista conocida
+		if err == nil {
+			tenantsBySlug = make(map[string]database.Tenant, len(list))
+			for _, t := range list {
+				tenantsBySlug[t.Slug] = t
+			}
+		}
+		tenantsLoadedAt = time.Now()
+	}
+	tenant, ok := tenantsBySlug[slug]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	if tenant.Status == "suspended" {
+		return &tenant, ErrTenantSuspended
+	}
+	if tenant.Status != "active" {
+		return nil, ErrTenantUnavailable
+	}
+	return &tenant, nil
+}
+
+// invalidateTenants fuerza a recargar la lista de tenants en esta instancia
+func invalidateTenants() {
+	tenantsMu.Lock()
+	tenantsLoadedAt = time.Time{}
+	tenantsMu.Unlock()
+}
+
+// RecordTenantAccess registra, en el esquema public, una petición de un
+// administrador de la plataforma dentro de un tenant
+func RecordTenantAccess(ctx context.Context, access *database.TenantAccess) error {
+	return database.DB.WithContext(tenancy.With(ctx, "")).Create(access).Error
+}
+
+// TenantStats métricas de un esquema en los informes agregados de tenants
+type TenantStats struct {
+	// Vacío en el esquema public
+	Tenant      string `json:"tenant"`
+	Users       int64  `json:"users"`
+	ActiveUsers int64  `json:"active_users"`
+	Signups     int64  `json:"signups"`
+	Logins      int64  `json:"logins"`
+}
+
+// AggregateTenantStats cuenta usuarios, altas e inicios de sesión desde since
+// en el esquema public y en el de cada tenant activo, y devuelve también la
+// suma de todos. Solo lee: cada esquema se consulta con su propio contexto.
+func AggregateTenantStats(ctx context.Context, since time.Time) ([]TenantStats, TenantStats, error) {
+	if !tenancy.Enabled() {
+		return nil, TenantStats{}, ErrTenancyDisabled
+	}
+	var list []TenantStats
+	err := database.ForEachTenant(tenancy.With(ctx, ""), func(ctx context.Context) error {
+		stats := TenantStats{Tenant: tenancy.From(ctx)}
+		db := database.DB.WithContext(ctx)
+		counts := []struct {
+			query *gorm.DB
+			dest  *int64
+		}{
+			{db.Model(&database.User{}), &stats.Users},
+			{db.Model(&database.User{}).Where("is_active = ?", true), &stats.ActiveUsers},
+			{db.Model(&database.User{}).Where("created_at >= ?", since), &stats.Signups},
+			{db.Model(&database.LoginEvent{}).Where("success = ? AND created_at >= ?", true, since), &stats.Logins},
+		}
+		for _, count := range counts {
+			if err := count.query.Count(count.dest).Error; err != nil {
+				return err
+			}
+		}
+		list = append(list, stats)
+		return nil
+	})
+	var totals TenantStats
+	for _, s := range list {
+		totals.Users += s.Users
+		totals.ActiveUsers += s.ActiveUsers
+		totals.Signups += s.Signups
+		totals.Logins += s.Logins
+	}
+	return list, totals, err
+}
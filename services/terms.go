@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/terms"
+
+	"gorm.io/gorm"
+)
+
+// ErrTermsOutdated la versión aceptada no es la vigente: el cliente mostró unos
+// términos que ya cambiaron
+var ErrTermsOutdated = errors.New("la versión de los términos no es la vigente")
+
+func init() {
+	exports.RegisterSection("terms_acceptances", func(ctx context.Context, userID uint) (interface{}, error) {
+		var acceptances []database.TermsAcceptance
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("accepted_at").Find(&acceptances).Error
+		return acceptances, err
+	})
+	accounts.RegisterCleanup("terms_acceptances", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		return tx.Where("user_id = ?", userID).Delete(&database.TermsAcceptance{}).Error
+	})
+}
+
+// TermsPending indica si el usuario tiene que aceptar los términos vigentes
+// antes de usar la API
+func TermsPending(user *database.User) bool {
+	return !terms.Current().Accepted(user.TermsVersion)
+}
+
+// AcceptTerms registra que el usuario acepta la versión indicada de los
+// términos, que tiene que ser la vigente (ErrTermsOutdated si no), desde ip
+func AcceptTerms(ctx context.Context, userID uint, version, ip string) (*database.User, error) {
+	user, err := activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	current := terms.Current()
+	if current.Version == "" || version != current.Version {
+		return nil, ErrTermsOutdated
+	}
+	if user.TermsVersion == version {
+		return user, nil
+	}
+
+	now := clock.Now()
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&database.TermsAcceptance{UserID: user.ID, Version: version, IP: ip, AcceptedAt: now}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{"terms_version": version, "terms_accepted_at": now}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.TermsVersion, user.TermsAcceptedAt = version, &now
+	user.Password = ""
+	return user, nil
+}
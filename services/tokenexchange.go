@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/auth"
+	"api/clock"
+	"api/database"
+	"api/oauth"
+
+	"gorm.io/gorm"
+)
+
+// Vigencia por defecto de los tokens emitidos en un canje: solo sirven para
+// la llamada que el servicio va a hacer en nombre del usuario
+const defaultExchangeTTL = 5 * time.Minute
+
+// Token presentado en un canje (database.TokenExchange.SubjectType)
+const (
+	ExchangeSubjectSession = "session"
+	ExchangeSubjectOAuth   = "oauth"
+)
+
+// exchangeServices client_id de los servicios internos que pueden canjear
+// tokens y recibir los canjeados (TOKEN_EXCHANGE_CLIENTS, separados por comas)
+func exchangeServices() []string {
+	var list []string
+	for _, id := range strings.Split(os.Getenv("TOKEN_EXCHANGE_CLIENTS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			list = append(list, id)
+		}
+	}
+	return list
+}
+
+// exchangeToken canjea el token de un usuario (su JWT de sesión o un token de
+// acceso OAuth) por un token de acceso para el servicio audience, de corta
+// duración, sin renovación y con scopes que no superan los del token
+// presentado. Solo los servicios internos confidenciales pueden hacerlo y cada
+// canje queda registrado.
+func exchangeToken(ctx context.Context, client *database.OAuthClient, req TokenRequest) (*TokenResponse, error) {
+	services := exchangeServices()
+	if client.Public || !contains(services, client.ClientID) {
+		return nil, &oauth.Error{Code: oauth.UnauthorizedClient, Description: "la aplicación no puede canjear tokens"}
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != oauth.TokenTypeAccessToken {
+		return nil, &oauth.Error{Code: oauth.InvalidRequest, Description: "requested_token_type solo puede ser " + oauth.TokenTypeAccessToken}
+	}
+	if req.SubjectTokenType != oauth.TokenTypeAccessToken && req.SubjectTokenType != oauth.TokenTypeJWT {
+		return nil, &oauth.Error{Code: oauth.InvalidRequest, Description: "subject_token_type debe ser " + oauth.TokenTypeAccessToken + " o " + oauth.TokenTypeJWT}
+	}
+	db := database.DB.WithContext(ctx)
+	var target database.OAuthClient
+	if !contains(services, req.Audience) || db.Where("client_id = ? AND revoked_at IS NULL", req.Audience).First(&target).Error != nil {
+		return nil, &oauth.Error{Code: oauth.InvalidTarget, Description: "audience debe ser el client_id de un servicio interno"}
+	}
+
+	invalid := &oauth.Error{Code: oauth.InvalidGrant, Description: "subject_token inválido o caducado"}
+	exchange := database.TokenExchange{ClientID: client.ID, Audience: req.Audience, IP: req.IP}
+	// Scopes del token presentado (nil = los de una sesión, sin límite) y
+	// hasta cuándo vale: el canjeado no dura más
+	var granted []string
+	var expires time.Time
+	switch {
+	case oauth.IsAccessToken(req.SubjectToken):
+		record, _, err := validOAuthToken(ctx, req.SubjectToken)
+		// Un token ya canjeado solo lo puede volver a canjear su destinatario
+		if err != nil || (record.Audience != "" && record.Audience != client.ClientID) {
+			return nil, invalid
+		}
+		exchange.SubjectType, exchange.SubjectTokenID, exchange.UserID = ExchangeSubjectOAuth, record.ID, record.UserID
+		granted, expires = record.Scopes, record.ExpiresAt
+	case auth.IsAPIKey(req.SubjectToken):
+		return nil, invalid
+	default:
+		identity, err := AuthenticateToken(ctx, req.SubjectToken, req.IP)
+		if err != nil || identity.Claims == nil || identity.ActingTenant != "" {
+			return nil, invalid
+		}
+		exchange.SubjectType, exchange.UserID = ExchangeSubjectSession, identity.UserID
+		expires = time.Unix(identity.Claims.ExpiresAt, 0)
+	}
+
+	scopes := granted
+	if req.Scope != "" {
+		requested, err := oauth.ParseScope(req.Scope)
+		if err != nil {
+			return nil, err
+		}
+		if granted != nil && !oauth.Covers(granted, requested) {
+			return nil, &oauth.Error{Code: oauth.InvalidScope, Description: "el scope pedido supera el del subject_token"}
+		}
+		scopes = requested
+	} else if granted == nil {
+		return nil, &oauth.Error{Code: oauth.InvalidScope, Description: "hay que pedir scope al canjear un token de sesión"}
+	}
+
+	access := oauth.AccessTokenPrefix + auth.RandomToken(24)
+	now := clock.Now()
+	if limit := now.Add(oauthTTL("TOKEN_EXCHANGE_TTL", defaultExchangeTTL)); limit.Before(expires) {
+		expires = limit
+	}
+	token := database.OAuthToken{
+		ClientID:   client.ID,
+		UserID:     exchange.UserID,
+		AccessHash: auth.HashAPIKey(access),
+		// Sin renovación: el hash es de un valor que no se entrega
+		RefreshHash:      auth.HashAPIKey(auth.RandomToken(24)),
+		Scopes:           scopes,
+		Audience:         req.Audience,
+		ExpiresAt:        expires,
+		RefreshExpiresAt: expires,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&token).Error; err != nil {
+			return err
+		}
+		exchange.TokenID, exchange.Scopes = token.ID, scopes
+		return tx.Create(&exchange).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		AccessToken:     access,
+		ExpiresIn:       int(expires.Sub(now).Seconds()),
+		Scopes:          scopes,
+		IssuedTokenType: oauth.TokenTypeAccessToken,
+	}, nil
+}
+
+// Introspection estado de un token de acceso (RFC 7662 2.2)
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	// Servicio que obtuvo el token en un canje y actúa en nombre de sub (RFC 8693 4.1)
+	Actor *IntrospectionActor `json:"act,omitempty"`
+}
+
+// IntrospectionActor actor de un token canjeado
+type IntrospectionActor struct {
+	Subject string `json:"sub"`
+}
+
+// IntrospectOAuthToken permite a un servicio comprobar un token de acceso que
+// le presentan. Solo ve los tokens emitidos a él o canjeados para él (audience);
+// del resto, como de los caducados o revocados, solo sabe que no están activos.
+func IntrospectOAuthToken(ctx context.Context, clientID, secret, token string) (*Introspection, error) {
+	client, err := authenticateOAuthClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public {
+		return nil, &oauth.Error{Code: oauth.UnauthorizedClient, Description: "solo las aplicaciones confidenciales pueden consultar tokens"}
+	}
+	record, _, err := validOAuthToken(ctx, token)
+	if err != nil || (record.ClientID != client.ID && record.Audience != client.ClientID) {
+		return &Introspection{Active: false}, nil
+	}
+	var issuer database.OAuthClient
+	if err := database.DB.WithContext(ctx).Select("client_id").First(&issuer, record.ClientID).Error; err != nil {
+		return nil, err
+	}
+	result := &Introspection{
+		Active:    true,
+		Scope:     strings.Join(record.Scopes, " "),
+		ClientID:  issuer.ClientID,
+		Subject:   strconv.FormatUint(uint64(record.UserID), 10),
+		Audience:  record.Audience,
+		TokenType: "Bearer",
+		ExpiresAt: record.ExpiresAt.Unix(),
+		IssuedAt:  record.CreatedAt.Unix(),
+	}
+	if record.Audience != "" {
+		result.Actor = &IntrospectionActor{Subject: issuer.ClientID}
+	}
+	return result, nil
+}
+
+// TokenExchangeFilter filtros del registro de canjes; los vacíos no filtran
+type TokenExchangeFilter struct {
+	UserID uint
+	// client_id del servicio que canjeó o del destino
+	Service  string
+	Audience string
+}
+
+// TokenExchangeEntry canje del registro con el client_id del servicio que lo hizo
+type TokenExchangeEntry struct {
+	database.TokenExchange
+	Service string `json:"service"`
+}
+
+// ListTokenExchanges devuelve los canjes de tokens, los más recientes primero
+func ListTokenExchanges(ctx context.Context, filter TokenExchangeFilter, offset, limit int) ([]TokenExchangeEntry, database.Total, error) {
+	db := database.DB.WithContext(ctx)
+	query := db.Model(&database.TokenExchange{})
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Service != "" {
+		query = query.Where("client_id IN (?)", db.Model(&database.OAuthClient{}).Select("id").Where("client_id = ?", filter.Service))
+	}
+	if filter.Audience != "" {
+		query = query.Where("audience = ?", filter.Audience)
+	}
+	total, err := database.Count(query)
+	if err != nil {
+		return nil, total, err
+	}
+	var exchanges []database.TokenExchange
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&exchanges).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+
+	clientIDs := make([]uint, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		clientIDs = append(clientIDs, exchange.ClientID)
+	}
+	var clients []database.OAuthClient
+	if err := db.Select("id", "client_id").Where("id IN ?", clientIDs).Find(&clients).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+	names := make(map[uint]string, len(clients))
+	for _, client := range clients {
+		names[client.ID] = client.ClientID
+	}
+	entries := make([]TokenExchangeEntry, len(exchanges))
+	for i, exchange := range exchanges {
+		entries[i] = TokenExchangeEntry{TokenExchange: exchange, Service: names[exchange.ClientID]}
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"api/auth"
+	"api/clock"
+	"api/database"
+	"api/useragent"
+)
+
+// deviceTrustPurpose distingue los tokens de dispositivo de confianza de los de acceso
+const deviceTrustPurpose = "device_trust"
+
+// ErrDeviceNotFound el dispositivo no existe o no es del usuario
+var ErrDeviceNotFound = errors.New("dispositivo no encontrado")
+
+// deviceTrustClaims contenido del token de dispositivo de confianza. Como el del
+// enlace "no he sido yo", no usa sub ni exp para no valer como token de acceso.
+type deviceTrustClaims struct {
+	Purpose  string `json:"purpose"`
+	UserID   uint   `json:"uid"`
+	DeviceID uint   `json:"did"`
+	Nonce    string `json:"nonce"`
+	Until    int64  `json:"until"`
+}
+
+// TrustedDeviceDuration tiempo que un dispositivo se recuerda tras verificar el
+// inicio de sesión (TRUSTED_DEVICE_DAYS, 30 días por defecto)
+func TrustedDeviceDuration() time.Duration {
+	days := 30
+	if n, err := strconv.Atoi(os.Getenv("TRUSTED_DEVICE_DAYS")); err == nil && n > 0 {
+		days = n
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// trustDevice marca el dispositivo como de confianza y devuelve el token firmado
+// que el cliente presenta en los siguientes inicios de sesión
+func trustDevice(ctx context.Context, device *database.Device) (string, time.Time, error) {
+	until := clock.Now().Add(TrustedDeviceDuration())
+	nonce := auth.RandomToken(16)
+	err := database.DB.WithContext(ctx).Model(device).
+		Updates(map[string]interface{}{"trusted_until": until, "trust_nonce": nonce}).Error
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token, err := auth.Sign(deviceTrustClaims{
+		Purpose:  deviceTrustPurpose,
+		UserID:   device.UserID,
+		DeviceID: device.ID,
+		Nonce:    nonce,
+		Until:    until.Unix(),
+	})
+	return token, until, err
+}
+
+// deviceTrusted indica si el token es de un dispositivo de confianza vigente del
+// usuario y si el agente de usuario sigue correspondiendo a ese dispositivo
+func deviceTrusted(ctx context.Context, userID uint, token, ua string) bool {
+	if token == "" {
+		return false
+	}
+	var claims deviceTrustClaims
+	if err := auth.Verify(token, &claims); err != nil {
+		return false
+	}
+	if claims.Purpose != deviceTrustPurpose || claims.UserID != userID || clock.Now().Unix() >= claims.Until {
+		return false
+	}
+
+	var device database.Device
+	if err := database.DB.WithContext(ctx).Where("id = ? AND user_id = ?", claims.DeviceID, userID).First(&device).Error; err != nil {
+		return false
+	}
+	return device.TrustedUntil != nil && clock.Now().Before(*device.TrustedUntil) &&
+		device.TrustNonce == claims.Nonce &&
+		device.Fingerprint == useragent.Parse(ua).Fingerprint()
+}
+
+// UntrustDevice retira la confianza de un dispositivo del usuario: sus tokens
+// dejan de valer y el siguiente inicio de sesión arriesgado volverá a pedir el código
+func UntrustDevice(ctx context.Context, userID, deviceID uint) error {
+	result := database.DB.WithContext(ctx).Model(&database.Device{}).
+		Where("id = ? AND user_id = ?", deviceID, userID).
+		Updates(map[string]interface{}{"trusted_until": nil, "trust_nonce": ""})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/plans"
+
+	"gorm.io/gorm"
+)
+
+// Operaciones registradas en el historial de cambios de un usuario
+const (
+	ChangeUpdate   = "update"
+	ChangePlan     = "plan"
+	ChangeDelete   = "delete"
+	ChangeRotation = "password_rotation"
+	ChangeRestrict = "restriction"
+	ChangeVerify   = "verification"
+	ChangeMetadata = "metadata"
+)
+
+func init() {
+	exports.RegisterSection("change_history", func(ctx context.Context, userID uint) (interface{}, error) {
+		var changes []database.UserChange
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&changes).Error
+		return changes, err
+	})
+	// Solo el historial de la cuenta; los cambios que hizo como administrador
+	// a otros usuarios se conservan (el ID no identifica a nadie tras anonimizar)
+	accounts.RegisterCleanup("change_history", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		return tx.Where("user_id = ?", userID).Delete(&database.UserChange{}).Error
+	})
+}
+
+// auditedFields valores de los campos del usuario que se registran en el
+// historial; nil si el campo no tiene valor
+func auditedFields(u *database.User) map[string]*string {
+	text := func(s string) *string { return &s }
+	fields := map[string]*string{
+		"name":                     text(u.Name),
+		"email":                    text(u.Email),
+		"role":                     text(u.Role),
+		"is_active":                text(strconv.FormatBool(u.IsActive)),
+		"username":                 u.Username,
+		"plan_code":                text(u.PlanCode),
+		"login_alerts_disabled":    text(strconv.FormatBool(u.LoginAlertsDisabled)),
+		"password_change_required": text(strconv.FormatBool(u.PasswordChangeRequired)),
+		"timezone":                 text(u.Timezone),
+		"locale":                   text(u.Locale),
+		"verified":                 text(strconv.FormatBool(u.VerifiedAt != nil)),
+	}
+	if u.RestrictedAt != nil {
+		fields["restriction_reason"] = text(u.RestrictionReason)
+	} else {
+		fields["restriction_reason"] = nil
+	}
+	// Cada clave de los metadatos por separado, con su valor en JSON
+	for key, value := range u.Metadata {
+		if encoded, err := json.Marshal(value); err == nil {
+			fields["metadata."+key] = text(string(encoded))
+		}
+	}
+	if u.DeletedAt.Valid {
+		fields["deleted_at"] = text(u.DeletedAt.Time.UTC().Format(time.RFC3339))
+	} else {
+		fields["deleted_at"] = nil
+	}
+	return fields
+}
+
+// diffUser devuelve los campos auditados que difieren entre before y after,
+// ordenados por nombre
+func diffUser(before, after *database.User) []database.FieldChange {
+	old, current := auditedFields(before), auditedFields(after)
+	var changes []database.FieldChange
+	for field, value := range current {
+		previous := old[field]
+		if (previous == nil) == (value == nil) && (previous == nil || *previous == *value) {
+			continue
+		}
+		changes = append(changes, database.FieldChange{Field: field, Before: previous, After: value})
+	}
+	// Las claves de los metadatos que se quitaron solo están en before
+	for field, previous := range old {
+		if _, ok := current[field]; !ok {
+			changes = append(changes, database.FieldChange{Field: field, Before: previous})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// recordChange guarda en tx los cambios que actor hizo en el usuario. Solo se
+// registran los de un administrador sobre otra cuenta: los del propio usuario
+// no son objeto de disputa.
+func recordChange(tx *gorm.DB, actor Identity, before, after *database.User, action string) error {
+	if actor.UserID == 0 || actor.UserID == after.ID {
+		return nil
+	}
+	changes := diffUser(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+	return tx.Create(&database.UserChange{
+		UserID:    after.ID,
+		ActorID:   actor.UserID,
+		Action:    action,
+		Changes:   changes,
+		CreatedAt: clock.Now(),
+	}).Error
+}
+
+// UserChangeEntry cambio del historial con los datos del administrador que lo hizo
+type UserChangeEntry struct {
+	database.UserChange
+	Actor *ChangeActor `json:"actor,omitempty"`
+}
+
+// ChangeActor administrador que hizo un cambio; también si ya no existe
+type ChangeActor struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// UserHistory devuelve los cambios hechos por administradores en el usuario,
+// los más recientes primero, y el total. También sirve para cuentas eliminadas.
+func UserHistory(ctx context.Context, userID uint, offset, limit int) ([]UserChangeEntry, database.Total, error) {
+	var user database.User
+	if err := database.DB.WithContext(ctx).Unscoped().Select("id").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, database.Total{}, ErrUserNotFound
+		}
+		return nil, database.Total{}, err
+	}
+
+	query := database.DB.WithContext(ctx).Model(&database.UserChange{}).Where("user_id = ?", userID)
+	total, err := database.Count(query)
+	if err != nil {
+		return nil, total, err
+	}
+	var changes []database.UserChange
+	if err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&changes).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+
+	actorIDs := make([]uint, 0, len(changes))
+	for _, change := range changes {
+		actorIDs = append(actorIDs, change.ActorID)
+	}
+	var actors []database.User
+	err = database.DB.WithContext(ctx).Unscoped().Select("id", "name", "email").Where("id IN ?", actorIDs).Find(&actors).Error
+	if err != nil {
+		return nil, database.Total{}, err
+	}
+	byID := make(map[uint]*ChangeActor, len(actors))
+	for _, actor := range actors {
+		byID[actor.ID] = &ChangeActor{ID: actor.ID, Name: actor.Name, Email: actor.Email}
+	}
+
+	entries := make([]UserChangeEntry, 0, len(changes))
+	for _, change := range changes {
+		entries = append(entries, UserChangeEntry{UserChange: change, Actor: byID[change.ActorID]})
+	}
+	return entries, total, nil
+}
+
+// AssignPlan cambia el plan del usuario y lo registra en su historial.
+// Devuelve gorm.ErrRecordNotFound si el plan no existe.
+func AssignPlan(ctx context.Context, actor Identity, id interface{}, code string) (*database.User, error) {
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if err := plans.Assign(ctx, user.ID, code); err != nil {
+		return nil, err
+	}
+	before := user
+	user.PlanCode = code
+	if err := recordChange(database.DB.WithContext(ctx), actor, &before, &user, ChangePlan); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"api/database"
+	"api/validation"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUsernameTaken el nombre de usuario ya es de otra cuenta o está reservado
+	ErrUsernameTaken = errors.New("el nombre de usuario no está disponible")
+	// ErrInvalidUsername el nombre de usuario no tiene un formato válido
+	ErrInvalidUsername = errors.New("nombre de usuario inválido")
+)
+
+// reservedUsernames nombres que no puede elegir nadie porque coinciden con rutas
+// o se confundirían con cuentas del servicio
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "api": true, "help": true, "me": true,
+	"root": true, "security": true, "support": true, "system": true, "www": true,
+}
+
+// Motivos por los que un nombre de usuario no está disponible
+const (
+	UsernameInvalid  = "invalid"
+	UsernameReserved = "reserved"
+	UsernameTaken    = "taken"
+)
+
+// UsernameAvailability indica si el nombre (ya normalizado) se puede elegir y,
+// si no, el motivo. Los nombres de cuentas eliminadas siguen ocupados.
+func UsernameAvailability(ctx context.Context, name string) (available bool, reason string, err error) {
+	switch {
+	case !validation.Username(name):
+		return false, UsernameInvalid, nil
+	case reservedUsernames[name]:
+		return false, UsernameReserved, nil
+	}
+	var count int64
+	if err := database.DB.WithContext(ctx).Unscoped().Model(&database.User{}).Where("username = ?", name).Count(&count).Error; err != nil {
+		return false, "", err
+	}
+	if count > 0 {
+		return false, UsernameTaken, nil
+	}
+	return true, "", nil
+}
+
+// checkUsername comprueba que userID puede quedarse con el nombre
+func checkUsername(ctx context.Context, userID uint, name string) error {
+	var owner database.User
+	err := database.DB.WithContext(ctx).Unscoped().Select("id").Where("username = ?", name).First(&owner).Error
+	if err == nil && owner.ID == userID {
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	available, reason, err := UsernameAvailability(ctx, name)
+	switch {
+	case err != nil:
+		return err
+	case reason == UsernameInvalid:
+		return ErrInvalidUsername
+	case !available:
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// PublicProfile datos de un usuario visibles sin autenticación
+type PublicProfile struct {
+	Username    string    `json:"username"`
+	Name        string    `json:"name"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	MemberSince time.Time `json:"member_since"`
+	// Cuenta verificada por un administrador
+	Verified bool `json:"verified"`
+}
+
+// GetPublicProfile devuelve el perfil público del nombre de usuario. Las cuentas
+// desactivadas o pendientes de eliminación se tratan como inexistentes.
+func GetPublicProfile(ctx context.Context, username string) (*PublicProfile, error) {
+	var user database.User
+	err := database.DB.WithContext(ctx).
+		Where("username = ? AND is_active = ? AND deletion_scheduled_at IS NULL", username, true).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PublicProfile{
+		Username:    *user.Username,
+		Name:        user.Name,
+		AvatarURL:   AvatarURL(ctx, &user),
+		MemberSince: user.CreatedAt,
+		Verified:    user.VerifiedAt != nil,
+	}, nil
+}
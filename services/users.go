@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"api/accounts"
+	"api/auth"
+	"api/bans"
+	"api/billing"
+	"api/clock"
+	"api/database"
+	"api/encryption"
+	"api/events"
+	"api/exports"
+	"api/geoip"
+	"api/jobs"
+	"api/maintenance"
+	"api/realtime"
+	"api/risk"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Errores de negocio compartidos por REST y GraphQL
+var (
+	ErrUserNotFound       = errors.New("usuario no encontrado")
+	ErrEmailTaken         = errors.New("el email ya está registrado")
+	ErrInvalidCredentials = errors.New("credenciales inválidas")
+	ErrPendingDeletion    = errors.New("la cuenta está en proceso de eliminación")
+	ErrMaintenance        = errors.New("servicio en mantenimiento")
+	ErrForbidden          = errors.New("no tienes permiso para operar sobre este usuario")
+	// ErrEmailChangeForbidden el email (con el que se recupera la cuenta) solo
+	// se cambia desde una sesión, no con una clave de API ni un token OAuth
+	ErrEmailChangeForbidden = errors.New("el email solo se puede cambiar desde una sesión iniciada")
+)
+
+func init() {
+	// IP y agente de usuario del historial de inicios de sesión se guardan cifrados
+	encryption.RegisterModel(&database.LoginEvent{})
+
+	exports.RegisterSection("login_history", func(ctx context.Context, userID uint) (interface{}, error) {
+		var events []database.LoginEvent
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&events).Error
+		return events, err
+	})
+}
+
+// RegisterUser crea un usuario con rol user y encola la creación de su cliente
+// de facturación. En un tenant respeta su cuota users_per_org.
+func RegisterUser(ctx context.Context, email, password, name string) (*database.User, error) {
+	db := database.DB.WithContext(ctx)
+
+	// LOWER: las cuentas anteriores a la normalización pueden tener mayúsculas en el email
+	var count int64
+	if err := db.Model(&database.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrEmailTaken
+	}
+	if err := checkTenantUsers(ctx); err != nil {
+		return nil, err
+	}
+	if err := checkPassword(ctx, password); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := database.User{
+		Email:    email,
+		Password: string(hashedPassword),
+		Name:     name,
+		Role:     "user",
+		IsActive: true,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	events.Publish(ctx, events.Event{Type: events.UserCreated, UserID: user.ID})
+
+	// Crear el cliente de facturación en segundo plano
+	if billing.Enabled() {
+		if err := jobs.Enqueue(ctx, billing.CustomerJob, billing.CustomerPayload{UserID: user.ID}); err != nil {
+			log.Printf("⚠️  No se pudo encolar la creación del cliente de facturación: %v", err)
+		}
+	}
+
+	return &user, nil
+}
+
+// LoginMeta datos del cliente que se guardan en el historial de inicios de sesión
+type LoginMeta struct {
+	IP        string
+	UserAgent string
+	// CaptchaToken y APIKey no se guardan: solo sirven para CheckCaptcha
+	CaptchaToken string
+	APIKey       string
+	// Token de dispositivo de confianza: evita el código de verificación por riesgo
+	DeviceToken string
+	// Entregar un token de renovación para una cookie junto con un token de
+	// acceso de corta duración (clientes de navegador)
+	RefreshCookie bool
+}
+
+// LoginResult resultado de un inicio de sesión correcto
+type LoginResult struct {
+	User              *database.User
+	Token             string
+	DeletionCancelled bool
+	// Dispositivo desde el que se inició sesión y si es la primera vez que se usa
+	Device    *database.Device
+	NewDevice bool
+	// Verificación pendiente cuando Authenticate devuelve ErrStepUpRequired
+	ChallengeID string
+	// Token del dispositivo recordado al verificar con remember (ver CompleteChallenge)
+	DeviceToken        string
+	DeviceTrustedUntil *time.Time
+	// Sesiones cerradas para no superar el máximo de sesiones del rol
+	TerminatedSessions []database.Session
+	// Token de renovación de la cookie y hasta cuándo se puede renovar (con
+	// LoginMeta.RefreshCookie)
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	// La contraseña caducó o hay que rotarla: la sesión solo sirve para cambiarla
+	PasswordChangeRequired bool
+	// Suspensión en curso: el token solo sirve para consultarla y apelarla
+	Suspension *SuspensionNotice
+	// Faltan por aceptar los términos vigentes: el token solo sirve para hacerlo
+	TermsPending bool
+}
+
+// Authenticate valida las credenciales, registra el intento y emite un token JWT.
+// Si la cuenta tenía la eliminación programada se cancela (o se rechaza el acceso
+// si ACCOUNT_DELETION_CANCEL_ON_LOGIN está desactivado). Con RISK_SCORING activo
+// un intento arriesgado se bloquea (ErrLoginBlocked) o queda pendiente de un
+// código enviado por correo (ErrStepUpRequired, con result.ChallengeID).
+func Authenticate(ctx context.Context, email, password string, meta LoginMeta) (*LoginResult, error) {
+	if err := CheckCaptcha(ctx, CaptchaLogin, email, meta); err != nil {
+		return nil, err
+	}
+	db := database.DB.WithContext(ctx)
+
+	var user database.User
+	if err := db.Where("LOWER(email) = LOWER(?)", email).First(&user).Error; err != nil {
+		recordLogin(ctx, nil, email, false, meta, nil)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		recordLogin(ctx, &user.ID, email, false, meta, nil)
+		return nil, ErrInvalidCredentials
+	}
+	return acceptLogin(ctx, &user, meta)
+}
+
+// acceptLogin continúa un inicio de sesión con credenciales ya comprobadas
+// (contraseña o identidad vinculada): cuenta activa, mantenimiento, puntuación
+// de riesgo y sesión
+func acceptLogin(ctx context.Context, user *database.User, meta LoginMeta) (*LoginResult, error) {
+	if !user.IsActive {
+		recordLogin(ctx, &user.ID, user.Email, false, meta, nil)
+		return nil, ErrAccountDisabled
+	}
+	// Durante el mantenimiento solo pueden iniciar sesión los administradores
+	if !IsAdmin(user.Role) && maintenance.Current().Enabled {
+		return nil, ErrMaintenance
+	}
+
+	var assessment *risk.Assessment
+	if risk.Enabled() {
+		a := risk.Evaluate(ctx, risk.Attempt{UserID: user.ID, Email: user.Email, IP: meta.IP, UserAgent: meta.UserAgent, At: clock.Now()})
+		assessment = &a
+		switch a.Decision {
+		case risk.Block:
+			recordLogin(ctx, &user.ID, user.Email, false, meta, assessment)
+			log.Printf("🛑 Inicio de sesión del usuario %d bloqueado por riesgo %d (%v)", user.ID, a.Score, a.Reasons)
+			return nil, ErrLoginBlocked
+		case risk.Challenge:
+			// En un dispositivo de confianza no se vuelve a pedir el código
+			if deviceTrusted(ctx, user.ID, meta.DeviceToken, meta.UserAgent) {
+				a.Decision = risk.Allow
+				a.Reasons = append(a.Reasons, "trusted_device")
+				break
+			}
+			recordLogin(ctx, &user.ID, user.Email, false, meta, assessment)
+			challenge, err := createChallenge(ctx, user, a)
+			if err != nil {
+				return nil, err
+			}
+			return &LoginResult{User: user, ChallengeID: challenge.ID}, ErrStepUpRequired
+		}
+	}
+
+	return startSession(ctx, user, meta, assessment)
+}
+
+// startSession completa un inicio de sesión aceptado: aplica el máximo de
+// sesiones del rol, cancela la eliminación programada, emite el token y registra
+// el dispositivo, la sesión y el intento
+func startSession(ctx context.Context, user *database.User, meta LoginMeta, assessment *risk.Assessment) (*LoginResult, error) {
+	result := &LoginResult{User: user, PasswordChangeRequired: PasswordExpired(user), TermsPending: TermsPending(user)}
+	suspension, err := suspensionNotice(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	result.Suspension = suspension
+	terminated, err := enforceSessionLimit(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	result.TerminatedSessions = terminated
+
+	if user.DeletionScheduledAt != nil {
+		if !accounts.CancelOnLogin() {
+			return nil, ErrPendingDeletion
+		}
+		if err := database.DB.WithContext(ctx).Model(user).Update("deletion_scheduled_at", nil).Error; err != nil {
+			return nil, err
+		}
+		events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+		result.DeletionCancelled = true
+	}
+
+	// Con cookie de renovación la sesión dura lo de siempre, pero el token de
+	// acceso caduca enseguida y se renueva con ella
+	claims := newSessionClaims(ctx, user)
+	access := claims
+	if meta.RefreshCookie {
+		access.ExpiresAt = accessTokenExpiry(claims, clock.Now())
+		result.RefreshToken, result.RefreshExpiresAt = auth.RandomToken(32), time.Unix(claims.ExpiresAt, 0)
+	}
+	token, err := auth.Sign(access)
+	if err != nil {
+		return nil, err
+	}
+	result.Token = token
+
+	// El registro del dispositivo no debe impedir el acceso; el de la sesión sí:
+	// un token sin sesión registrada no se acepta
+	if result.Device, result.NewDevice, err = recordDevice(ctx, user.ID, meta.UserAgent); err != nil {
+		log.Printf("⚠️  No se pudo registrar el dispositivo del usuario %d: %v", user.ID, err)
+	}
+	session, err := recordSession(ctx, claims, result.Device, meta.IP, geoip.Country(meta.IP), result.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLoginAlert(ctx, user, session, result.NewDevice); err != nil {
+		log.Printf("⚠️  No se pudo preparar el aviso de inicio de sesión del usuario %d: %v", user.ID, err)
+	}
+
+	recordLogin(ctx, &user.ID, user.Email, true, meta, assessment)
+	return result, nil
+}
+
+// recordLogin registra un intento de inicio de sesión en el historial junto con
+// su evaluación de riesgo, si la hubo. Los intentos pendientes de verificación
+// no cuentan como fallidos para el bloqueo de IPs.
+func recordLogin(ctx context.Context, userID *uint, email string, success bool, meta LoginMeta, assessment *risk.Assessment) {
+	event := database.LoginEvent{
+		UserID:    userID,
+		Email:     email,
+		Success:   success,
+		IP:        meta.IP,
+		UserAgent: meta.UserAgent,
+	}
+	if assessment != nil {
+		event.RiskScore = assessment.Score
+		event.RiskDecision = assessment.Decision
+		event.RiskReasons = assessment.Reasons
+	}
+	if !success && event.RiskDecision != risk.Challenge {
+		bans.RecordFailedLogin(meta.IP)
+	}
+	database.DB.WithContext(ctx).Create(&event)
+}
+
+// usersQuery usuarios del listado, ordenados por ID; la comparten ListUsers y
+// StreamUsers para que la exportación incluya los mismos que el listado
+func usersQuery(db *gorm.DB) *gorm.DB {
+	return db.Model(&database.User{}).Order("id")
+}
+
+// ListUsers devuelve una página de usuarios ordenados por ID con los filtros
+// indicados (limit <= 0 = todos) y el total, que puede ser estimado si el
+// contexto lo permite (database.WithEstimatedCount)
+func ListUsers(ctx context.Context, filter UserFilter, offset, limit int) ([]database.User, database.Total, error) {
+	query := filter.scope(usersQuery(database.DB.WithContext(ctx)))
+
+	var total database.Total
+	if limit > 0 {
+		var err error
+		if total, err = database.Count(query); err != nil {
+			return nil, total, err
+		}
+		query = query.Offset(offset).Limit(limit)
+	}
+
+	var users []database.User
+	if err := query.Find(&users).Error; err != nil {
+		return nil, total, err
+	}
+	for i := range users {
+		users[i].Password = ""
+	}
+	if limit <= 0 {
+		total.Count = int64(len(users))
+	}
+	return users, total, nil
+}
+
+// StreamUsers pasa a fn un cursor sobre los usuarios de ListUsers para
+// recorrerlos sin cargarlos en memoria ni límite de tiempo (ver
+// database.Stream); cada fila se lee con database.DB.ScanRows
+func StreamUsers(ctx context.Context, filter UserFilter, fn func(rows *sql.Rows) error) error {
+	return database.Stream(ctx, func(db *gorm.DB) *gorm.DB { return filter.scope(usersQuery(db)) }, fn)
+}
+
+// GetUser devuelve un usuario por su ID
+func GetUser(ctx context.Context, id interface{}) (*database.User, error) {
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	user.Password = ""
+	return &user, nil
+}
+
+// GetUsersByIDs carga varios usuarios en una sola consulta
+func GetUsersByIDs(ctx context.Context, ids []uint) ([]database.User, error) {
+	var users []database.User
+	if err := database.DB.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for i := range users {
+		users[i].Password = ""
+	}
+	return users, nil
+}
+
+// UserChanges campos modificables de un usuario; los vacíos no se cambian
+type UserChanges struct {
+	Name  string
+	Email string
+	// nil = sin cambios
+	Username            *string
+	LoginAlertsDisabled *bool
+	// "" vuelve a UTC / al idioma por defecto
+	Timezone *string
+	Locale   *string
+}
+
+// UpdateUser aplica los cambios al usuario indicado; actor solo puede modificar
+// su propia cuenta salvo que sea administrador
+func UpdateUser(ctx context.Context, actor Identity, id interface{}, changes UserChanges) (*database.User, error) {
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if err := AuthorizeUser(ctx, actor, ActionUsersUpdate, user.ID); err != nil {
+		return nil, err
+	}
+	before := user
+
+	if changes.Name != "" {
+		user.Name = changes.Name
+	}
+	if changes.Email != "" && !strings.EqualFold(changes.Email, user.Email) {
+		if actor.APIKeyID != 0 || actor.OAuthClientID != 0 {
+			return nil, ErrEmailChangeForbidden
+		}
+		var count int64
+		err := database.DB.WithContext(ctx).Model(&database.User{}).
+			Where("LOWER(email) = LOWER(?) AND id <> ?", changes.Email, user.ID).Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrEmailTaken
+		}
+		user.Email = changes.Email
+	}
+	if changes.Username != nil {
+		if err := checkUsername(ctx, user.ID, *changes.Username); err != nil {
+			return nil, err
+		}
+		user.Username = changes.Username
+	}
+	if changes.LoginAlertsDisabled != nil {
+		user.LoginAlertsDisabled = *changes.LoginAlertsDisabled
+	}
+	if changes.Timezone != nil {
+		user.Timezone = *changes.Timezone
+	}
+	if changes.Locale != nil {
+		user.Locale = *changes.Locale
+	}
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, actor, &before, &user, ChangeUpdate)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+	realtime.Publish(ctx, user.ID, realtime.EventProfileUpdated, user)
+	return &user, nil
+}
+
+// DeleteUser elimina (borrado lógico) el usuario indicado con las mismas reglas
+// que UpdateUser; con una clave de API no se puede eliminar ninguna cuenta
+func DeleteUser(ctx context.Context, actor Identity, id interface{}) error {
+	if actor.APIKeyID != 0 {
+		return ErrForbidden
+	}
+	var user database.User
+	if err := database.DB.WithContext(ctx).First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if err := AuthorizeUser(ctx, actor, ActionUsersDelete, user.ID); err != nil {
+		return err
+	}
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before := user
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		user.DeletedAt = gorm.DeletedAt{Time: clock.Now(), Valid: true}
+		return recordChange(tx, actor, &before, &user, ChangeDelete)
+	})
+	if err != nil {
+		return err
+	}
+	events.Publish(ctx, events.Event{Type: events.UserDeleted, UserID: user.ID})
+	return nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"api/accounts"
+	"api/clock"
+	"api/database"
+	"api/events"
+	"api/exports"
+
+	"gorm.io/gorm"
+)
+
+// Estados de una solicitud de verificación
+const (
+	VerificationPending   = "pending"
+	VerificationApproved  = "approved"
+	VerificationRejected  = "rejected"
+	VerificationCancelled = "cancelled"
+	VerificationRevoked   = "revoked"
+)
+
+// verificationTransitions cambios de estado admitidos. Rechazadas, retiradas y
+// revocadas son definitivas: el usuario puede enviar otra solicitud.
+var verificationTransitions = map[string][]string{
+	VerificationPending:  {VerificationApproved, VerificationRejected, VerificationCancelled},
+	VerificationApproved: {VerificationRevoked},
+}
+
+var (
+	// ErrVerificationNotFound la solicitud de verificación no existe
+	ErrVerificationNotFound = errors.New("solicitud de verificación no encontrada")
+	// ErrVerificationPending el usuario ya tiene una solicitud por revisar
+	ErrVerificationPending = errors.New("ya hay una solicitud de verificación pendiente")
+	// ErrAlreadyVerified la cuenta ya está verificada
+	ErrAlreadyVerified = errors.New("la cuenta ya está verificada")
+	// ErrSelfVerification un administrador no puede revisar su propia solicitud
+	ErrSelfVerification = errors.New("no puedes revisar tu propia solicitud de verificación")
+)
+
+// VerificationTransitionError la solicitud está en un estado desde el que no
+// se puede pasar al pedido
+type VerificationTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *VerificationTransitionError) Error() string {
+	return "la solicitud de verificación no puede pasar de " + e.From + " a " + e.To
+}
+
+func init() {
+	exports.RegisterSection("verification_requests", func(ctx context.Context, userID uint) (interface{}, error) {
+		var requests []database.VerificationRequest
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&requests).Error
+		return requests, err
+	})
+	accounts.RegisterCleanup("verification_requests", func(ctx context.Context, tx *gorm.DB, userID uint, files *accounts.Files) error {
+		return tx.Where("user_id = ?", userID).Delete(&database.VerificationRequest{}).Error
+	})
+}
+
+// canTransition indica si una solicitud puede pasar de from a to
+func canTransition(from, to string) bool {
+	for _, next := range verificationTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestVerification registra una solicitud de verificación con las pruebas
+// del usuario. Solo se admite una pendiente a la vez y ninguna si la cuenta ya
+// está verificada.
+func RequestVerification(ctx context.Context, userID uint, evidence string, links []string) (*database.VerificationRequest, error) {
+	user, err := activeUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.VerifiedAt != nil {
+		return nil, ErrAlreadyVerified
+	}
+
+	request := database.VerificationRequest{UserID: user.ID, Status: VerificationPending, Evidence: evidence, Links: links}
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pending int64
+		if err := tx.Model(&database.VerificationRequest{}).Where("user_id = ? AND status = ?", user.ID, VerificationPending).Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrVerificationPending
+		}
+		return tx.Create(&request).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// MyVerification devuelve la última solicitud de verificación del usuario
+// (ErrVerificationNotFound si no ha enviado ninguna)
+func MyVerification(ctx context.Context, userID uint) (*database.VerificationRequest, error) {
+	var request database.VerificationRequest
+	err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC, id DESC").First(&request).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVerificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// CancelVerification retira la última solicitud del usuario, que tiene que
+// estar pendiente
+func CancelVerification(ctx context.Context, userID uint) (*database.VerificationRequest, error) {
+	request, err := MyVerification(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := transitionVerification(database.DB.WithContext(ctx), request, VerificationCancelled); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// ReviewVerification lleva la solicitud indicada a status (approved, rejected
+// o revoked) con la nota del administrador. Aprobarla verifica la cuenta y
+// revocarla le quita la verificación; ambas quedan en el historial de cambios.
+func ReviewVerification(ctx context.Context, actor Identity, id interface{}, status, notes string) (*database.VerificationRequest, error) {
+	db := database.DB.WithContext(ctx)
+	var request database.VerificationRequest
+	if err := db.First(&request, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVerificationNotFound
+		}
+		return nil, err
+	}
+	if status == VerificationCancelled {
+		// Solo el propio usuario retira su solicitud
+		return nil, &VerificationTransitionError{From: request.Status, To: status}
+	}
+	if request.UserID == actor.UserID && actor.ActingTenant == "" {
+		return nil, ErrSelfVerification
+	}
+	var user database.User
+	if err := db.First(&user, request.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	now := clock.Now()
+	request.Notes, request.ReviewedBy, request.ReviewedAt = notes, &actor.UserID, &now
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := transitionVerification(tx, &request, status); err != nil {
+			return err
+		}
+		before := user
+		switch status {
+		case VerificationApproved:
+			user.VerifiedAt = &now
+		case VerificationRevoked:
+			user.VerifiedAt = nil
+		default:
+			return nil
+		}
+		if err := tx.Model(&user).Update("verified_at", user.VerifiedAt).Error; err != nil {
+			return err
+		}
+		return recordChange(tx, actor, &before, &user, ChangeVerify)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("🪪 Solicitud de verificación %d del usuario %d: %s por %d", request.ID, user.ID, status, actor.UserID)
+	if status != VerificationRejected {
+		events.Publish(ctx, events.Event{Type: events.UserUpdated, UserID: user.ID})
+	}
+	return &request, nil
+}
+
+// transitionVerification cambia el estado de la solicitud si la transición se
+// admite. La actualización es condicional: dos revisiones simultáneas de la
+// misma solicitud no pueden aplicarse las dos.
+func transitionVerification(tx *gorm.DB, request *database.VerificationRequest, status string) error {
+	if !canTransition(request.Status, status) {
+		return &VerificationTransitionError{From: request.Status, To: status}
+	}
+	updates := map[string]interface{}{"status": status}
+	if request.ReviewedAt != nil {
+		updates["notes"], updates["reviewed_by"], updates["reviewed_at"] = request.Notes, request.ReviewedBy, request.ReviewedAt
+	}
+	result := tx.Model(&database.VerificationRequest{}).Where("id = ? AND status = ?", request.ID, request.Status).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &VerificationTransitionError{From: request.Status, To: status}
+	}
+	request.Status = status
+	return nil
+}
+
+// VerificationRequests devuelve las solicitudes de verificación en el estado
+// indicado (todas si está vacío), las más antiguas primero
+func VerificationRequests(ctx context.Context, status string, offset, limit int) ([]database.VerificationRequest, database.Total, error) {
+	query := database.DB.WithContext(ctx).Model(&database.VerificationRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	total, err := database.Count(query)
+	if err != nil {
+		return nil, total, err
+	}
+	var requests []database.VerificationRequest
+	if err := query.Order("created_at, id").Offset(offset).Limit(limit).Find(&requests).Error; err != nil {
+		return nil, database.Total{}, err
+	}
+	return requests, total, nil
+}
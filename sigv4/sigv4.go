@@ -0,0 +1,193 @@
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnsignedPayload valor de x-amz-content-sha256 cuando no se firma el cuerpo
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+const (
+	algorithm  = "AWS4-HMAC-SHA256"
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+)
+
+// Signer firma peticiones con AWS Signature Version 4 (S3, Secrets Manager
+// y cualquier servicio compatible)
+type Signer struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Service         string
+}
+
+// Sign añade la cabecera Authorization a la petición. Se firman host,
+// content-type y todas las cabeceras x-amz-*. payloadHash es el SHA-256 en
+// hexadecimal del cuerpo (HashPayload) o UnsignedPayload.
+func (s Signer) Sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(timeFormat))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	signed := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			signed[lk] = req.Header.Get(k)
+		}
+	}
+	signedHeaders, canonicalHeaders := canonicalizeHeaders(signed)
+
+	canonical := strings.Join([]string{
+		req.Method,
+		URIEncode(pathOf(req.URL), false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.AccessKeyID, s.scope(now), signedHeaders, s.signature(now, canonical)))
+}
+
+// Presign devuelve la URL firmada en la query string, válida durante ttl. Las
+// cabeceras pasadas quedan firmadas, por lo que el cliente debe enviarlas tal cual.
+func (s Signer) Presign(method string, u *url.URL, ttl time.Duration, headers map[string]string, now time.Time) string {
+	now = now.UTC()
+	u = cloneURL(u)
+
+	signed := map[string]string{"host": u.Host}
+	for k, v := range headers {
+		signed[strings.ToLower(k)] = v
+	}
+	signedHeaders, canonicalHeaders := canonicalizeHeaders(signed)
+
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", s.AccessKeyID+"/"+s.scope(now))
+	q.Set("X-Amz-Date", now.Format(timeFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", signedHeaders)
+	if s.SessionToken != "" {
+		q.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	canonical := strings.Join([]string{
+		method,
+		URIEncode(pathOf(u), false),
+		canonicalQuery(q),
+		canonicalHeaders,
+		signedHeaders,
+		UnsignedPayload,
+	}, "\n")
+	q.Set("X-Amz-Signature", s.signature(now, canonical))
+
+	u.RawQuery = canonicalQuery(q)
+	return u.String()
+}
+
+// HashPayload devuelve el SHA-256 en hexadecimal del cuerpo de la petición
+func HashPayload(payload []byte) string {
+	hash := sha256.Sum256(payload)
+	return hex.EncodeToString(hash[:])
+}
+
+// URIEncode codifica según las reglas de SigV4 (RFC 3986, '/' opcional)
+func URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'),
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func (s Signer) scope(t time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", t.Format(dateFormat), s.Region, s.Service)
+}
+
+func (s Signer) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		algorithm,
+		t.Format(timeFormat),
+		s.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), t.Format(dateFormat))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// pathOf devuelve la ruta sin codificar; una ruta vacía se firma como "/"
+func pathOf(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+func cloneURL(u *url.URL) *url.URL {
+	c := *u
+	return &c
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func canonicalizeHeaders(headers map[string]string) (signed, canonical string) {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, URIEncode(k, true)+"="+URIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
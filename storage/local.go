@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api/clock"
+)
+
+// LocalStorage guarda los objetos en el sistema de archivos local
+type LocalStorage struct {
+	root    string
+	baseURL string
+
+	mu  sync.RWMutex
+	key []byte
+}
+
+// NewLocalStorage crea un almacenamiento local con raíz en root
+func NewLocalStorage(root, baseURL string, key []byte) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{root: root, baseURL: strings.TrimRight(baseURL, "/"), key: key}, nil
+}
+
+// path resuelve la clave dentro de la raíz evitando escapar de ella
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", errors.New("clave de almacenamiento vacía")
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	// Escribir en un temporal y renombrar para no dejar archivos a medias
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// SignedURL genera una URL servida por la propia API con expiración y firma HMAC
+func (s *LocalStorage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	expires := strconv.FormatInt(clock.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.sign(key, expires))
+	return fmt.Sprintf("%s/%s?%s", s.baseURL, strings.TrimLeft(key, "/"), q.Encode()), nil
+}
+
+// PresignPut genera una URL de subida servida por la propia API; la firma
+// incluye el tipo de contenido y el tamaño para que no puedan alterarse
+func (s *LocalStorage) PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, map[string]string, error) {
+	expires := strconv.FormatInt(clock.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.sign(key, expires, http.MethodPut, contentType, strconv.FormatInt(size, 10)))
+	headers := map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.FormatInt(size, 10),
+	}
+	return fmt.Sprintf("%s/%s?%s", s.baseURL, strings.TrimLeft(key, "/"), q.Encode()), headers, nil
+}
+
+// VerifySignature comprueba una firma generada por SignedURL (o por
+// PresignPut cuando se pasan el método, el tipo y el tamaño firmados)
+func (s *LocalStorage) VerifySignature(key, expires, signature string, extra ...string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || clock.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(s.sign(key, expires, extra...)), []byte(signature))
+}
+
+// SetKey sustituye la clave de firma de URLs (rotación de secretos); las URLs
+// firmadas con la anterior dejan de ser válidas
+func (s *LocalStorage) SetKey(key []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.key = key
+}
+
+func (s *LocalStorage) sign(key, expires string, extra ...string) string {
+	s.mu.RLock()
+	mac := hmac.New(sha256.New, s.key)
+	s.mu.RUnlock()
+	mac.Write([]byte(strings.TrimLeft(key, "/") + "\n" + expires))
+	for _, v := range extra {
+		mac.Write([]byte("\n" + v))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
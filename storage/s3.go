@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api/sigv4"
+)
+
+// S3Config configuración de un almacenamiento compatible con S3 (AWS, MinIO, GCS interoperable)
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+}
+
+// S3Storage implementación de Storage sobre la API REST de S3 firmada con SigV4
+type S3Storage struct {
+	mu     sync.RWMutex
+	cfg    S3Config
+	client *http.Client
+}
+
+// NewS3Storage crea un almacenamiento S3 a partir de la configuración
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID y S3_SECRET_ACCESS_KEY son obligatorios")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &S3Storage{cfg: cfg, client: &http.Client{Timeout: 60 * time.Second}}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), r)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(key), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.ContentLength, nil
+}
+
+// SignedURL genera una URL GET prefirmada (query string SigV4)
+func (s *S3Storage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return s.Presign(http.MethodGet, key, ttl, nil)
+}
+
+// PresignPut genera una URL PUT prefirmada; S3 rechaza la subida si el
+// Content-Type o el Content-Length no coinciden con los firmados
+func (s *S3Storage) PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, map[string]string, error) {
+	headers := map[string]string{
+		"Content-Type":   contentType,
+		"Content-Length": strconv.FormatInt(size, 10),
+	}
+	url, err := s.Presign(http.MethodPut, key, ttl, headers)
+	return url, headers, err
+}
+
+// Presign genera una URL prefirmada para el método indicado. Las cabeceras
+// pasadas quedan firmadas, por lo que el cliente debe enviarlas tal cual.
+func (s *S3Storage) Presign(method, key string, ttl time.Duration, headers map[string]string) (string, error) {
+	u, err := url.Parse(s.objectURL(key))
+	if err != nil {
+		return "", err
+	}
+	return s.signer().Presign(method, u, ttl, headers, time.Now()), nil
+}
+
+// objectURL construye la URL del objeto según el estilo de direccionamiento
+func (s *S3Storage) objectURL(key string) string {
+	key = sigv4.URIEncode(strings.TrimLeft(key, "/"), false)
+	if s.cfg.PathStyle {
+		return fmt.Sprintf("%s/%s/%s", s.cfg.Endpoint, s.cfg.Bucket, key)
+	}
+	scheme, host, _ := strings.Cut(s.cfg.Endpoint, "://")
+	return fmt.Sprintf("%s://%s.%s/%s", scheme, s.cfg.Bucket, host, key)
+}
+
+// do firma la petición con cabecera Authorization y la ejecuta
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("x-amz-content-sha256", sigv4.UnsignedPayload)
+	s.signer().Sign(req, sigv4.UnsignedPayload, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: %s %s: %d %s", req.Method, req.URL.Path, resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return resp, nil
+}
+
+// SetCredentials sustituye las credenciales de acceso (rotación de secretos)
+func (s *S3Storage) SetCredentials(accessKeyID, secretAccessKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.AccessKeyID = accessKeyID
+	s.cfg.SecretAccessKey = secretAccessKey
+}
+
+func (s *S3Storage) signer() sigv4.Signer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sigv4.Signer{
+		AccessKeyID:     s.cfg.AccessKeyID,
+		SecretAccessKey: s.cfg.SecretAccessKey,
+		Region:          s.cfg.Region,
+		Service:         "s3",
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"api/auth"
+	"api/health"
+	"api/secrets"
+)
+
+// ErrNotFound se devuelve cuando el objeto solicitado no existe
+var ErrNotFound = errors.New("objeto no encontrado")
+
+// Storage abstracción del almacenamiento de archivos (avatares, exportaciones, adjuntos)
+type Storage interface {
+	// Put guarda el contenido bajo la clave indicada
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get abre el objeto para lectura
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete elimina el objeto (no falla si no existe)
+	Delete(ctx context.Context, key string) error
+	// Stat devuelve el tamaño del objeto o ErrNotFound
+	Stat(ctx context.Context, key string) (int64, error)
+	// SignedURL devuelve una URL de descarga firmada válida durante ttl
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// PresignPut devuelve una URL para subir el objeto directamente, junto con
+	// las cabeceras que el cliente debe enviar sin modificar
+	PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, map[string]string, error)
+}
+
+// Default almacenamiento configurado para la aplicación
+var Default Storage
+
+func init() {
+	// Se consulta un objeto que no existe: basta con que el almacenamiento responda
+	health.Register("storage", func(ctx context.Context) error {
+		if Default == nil {
+			return health.ErrDisabled
+		}
+		if _, err := Default.Stat(ctx, "health/check"); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+	secrets.OnRenew("almacenamiento", reloadCredentials)
+}
+
+// InitStorage selecciona la implementación según STORAGE_DRIVER (local o s3)
+func InitStorage() error {
+	driver := os.Getenv("STORAGE_DRIVER")
+	if driver == "" {
+		driver = "local"
+	}
+
+	switch driver {
+	case "local":
+		root := os.Getenv("STORAGE_LOCAL_PATH")
+		if root == "" {
+			root = "uploads"
+		}
+		baseURL := os.Getenv("STORAGE_PUBLIC_URL")
+		if baseURL == "" {
+			baseURL = "/files"
+		}
+		local, err := NewLocalStorage(root, baseURL, signingKey())
+		if err != nil {
+			return err
+		}
+		log.Printf("🗂️  Usando almacenamiento local en %s", root)
+		Default = local
+	case "s3", "gcs":
+		// GCS se usa a través de su API XML compatible con S3 (claves HMAC)
+		cfg := S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       os.Getenv("S3_PATH_STYLE") == "true",
+		}
+		if driver == "gcs" && cfg.Endpoint == "" {
+			cfg.Endpoint = "https://storage.googleapis.com"
+			cfg.PathStyle = true
+		}
+		s3, err := NewS3Storage(cfg)
+		if err != nil {
+			return err
+		}
+		log.Printf("☁️  Usando almacenamiento %s en el bucket %s", driver, cfg.Bucket)
+		Default = s3
+	default:
+		return fmt.Errorf("STORAGE_DRIVER desconocido: %s", driver)
+	}
+
+	return nil
+}
+
+// reloadCredentials aplica las credenciales renovadas al almacenamiento activo
+func reloadCredentials() error {
+	switch s := Default.(type) {
+	case *LocalStorage:
+		s.SetKey(signingKey())
+	case *S3Storage:
+		accessKey, secretKey := os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY")
+		if accessKey == "" || secretKey == "" {
+			return errors.New("S3_ACCESS_KEY_ID o S3_SECRET_ACCESS_KEY vacías tras la renovación")
+		}
+		s.SetCredentials(accessKey, secretKey)
+	}
+	return nil
+}
+
+// signingKey clave usada para firmar URLs de descarga locales
+func signingKey() []byte {
+	if key := os.Getenv("STORAGE_SIGNING_KEY"); key != "" {
+		return []byte(key)
+	}
+	return auth.DeriveKey("storage-signing")
+}
+
+// PartKey clave temporal de una parte de una subida por partes
+func PartKey(sessionID string, number int) string {
+	return fmt.Sprintf("uploads/tmp/%s/%05d", sessionID, number)
+}
@@ -0,0 +1,60 @@
+// Package tenancy identifica el tenant de cada operación. Con TENANCY=schema
+// cada tenant tiene su propio esquema de PostgreSQL; el tenant viaja en el
+// contexto de la petición o del trabajo y database envía sus consultas a ese
+// esquema. Sin tenant en el contexto se usa el esquema public, como en una
+// instalación sin tenants.
+package tenancy
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ModeSchema aislamiento con un esquema de PostgreSQL por tenant
+const ModeSchema = "schema"
+
+// Enabled indica si está activo el aislamiento por esquema (TENANCY=schema)
+func Enabled() bool {
+	return os.Getenv("TENANCY") == ModeSchema
+}
+
+// slugPattern identificadores de tenant válidos: también forman el nombre del esquema
+var slugPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,39}$`)
+
+// ValidSlug indica si slug puede identificar a un tenant
+func ValidSlug(slug string) bool {
+	return slugPattern.MatchString(slug)
+}
+
+// Schema esquema de PostgreSQL del tenant
+func Schema(slug string) string {
+	return "tenant_" + slug
+}
+
+type tenantKey struct{}
+
+// With devuelve un contexto cuyas operaciones son del tenant slug
+func With(ctx context.Context, slug string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, slug)
+}
+
+// From tenant del contexto; vacío si las operaciones son del esquema public
+func From(ctx context.Context) string {
+	slug, _ := ctx.Value(tenantKey{}).(string)
+	return slug
+}
+
+// Link añade a un enlace de la API el tenant de ctx (?tenant=), para que los
+// enlaces enviados por correo se resuelvan en su esquema
+func Link(ctx context.Context, link string) string {
+	slug := From(ctx)
+	if slug == "" {
+		return link
+	}
+	if strings.Contains(link, "?") {
+		return link + "&tenant=" + slug
+	}
+	return link + "?tenant=" + slug
+}
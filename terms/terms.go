@@ -0,0 +1,95 @@
+// Package terms guarda la versión de los términos de uso que los usuarios
+// tienen que haber aceptado para usar la API
+package terms
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/database"
+
+	"gorm.io/gorm"
+)
+
+// settingKey clave del ajuste donde se guarda la versión exigida
+const settingKey = "terms"
+
+// cacheTTL tiempo que se reutiliza la versión leída; con varias instancias el
+// cambio tarda como máximo esto en propagarse
+const cacheTTL = 5 * time.Second
+
+// Terms términos de uso vigentes
+type Terms struct {
+	// Versión que hay que haber aceptado; vacía = no se exige ninguna
+	Version string `json:"version"`
+	// Dirección del texto, para la pantalla de aceptación
+	URL         string     `json:"url"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	cached   Terms
+	loadedAt time.Time
+)
+
+// Current devuelve los términos vigentes, releyéndolos de la base de datos como
+// mucho cada cacheTTL
+func Current() Terms {
+	mu.Lock()
+	defer mu.Unlock()
+	if time.Since(loadedAt) < cacheTTL {
+		return cached
+	}
+
+	var setting database.Setting
+	err := database.DB.Where("key = ?", settingKey).First(&setting).Error
+	switch {
+	case err == nil:
+		var current Terms
+		if json.Unmarshal([]byte(setting.Value), &current) == nil {
+			cached = current
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		cached = Terms{}
+	}
+	// Ante un error de lectura se mantiene la última versión conocida
+	loadedAt = time.Now()
+	return cached
+}
+
+// Set publica una versión de los términos y la aplica inmediatamente en esta
+// instancia. PublishedAt solo cambia con la versión.
+func Set(next Terms) error {
+	if current := Current(); next.Version != "" && next.Version == current.Version {
+		next.PublishedAt = current.PublishedAt
+	}
+	if next.Version != "" && next.PublishedAt == nil {
+		now := clock.Now().UTC()
+		next.PublishedAt = &now
+	}
+	if next.Version == "" {
+		next.PublishedAt = nil
+	}
+
+	value, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.Save(&database.Setting{Key: settingKey, Value: string(value)}).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	cached, loadedAt = next, time.Now()
+	mu.Unlock()
+	return nil
+}
+
+// Accepted indica si haber aceptado la versión accepted basta para usar la API
+func (t Terms) Accepted(accepted string) bool {
+	return t.Version == "" || accepted == t.Version
+}
@@ -0,0 +1,250 @@
+package usage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"api/clock"
+	"api/database"
+	"api/exports"
+	"api/tenancy"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Las claves incluyen el tenant: los IDs se repiten entre esquemas
+type userKey struct {
+	tenant   string
+	userID   uint
+	day      string
+	endpoint string
+}
+
+type apiKeyKey struct {
+	tenant   string
+	keyID    uint
+	day      string
+	endpoint string
+}
+
+type counter struct {
+	count    int64
+	lastSeen time.Time
+}
+
+var (
+	mu         sync.Mutex
+	pending    = map[userKey]*counter{}
+	pendingKey = map[apiKeyKey]*counter{}
+)
+
+func init() {
+	exports.RegisterSection("api_usage", func(ctx context.Context, userID uint) (interface{}, error) {
+		var rows []database.UserUsage
+		err := database.DB.WithContext(ctx).Where("user_id = ?", userID).Order("day").Find(&rows).Error
+		return rows, err
+	})
+}
+
+// Track acumula en memoria una petición del usuario del tenant de ctx al
+// endpoint indicado
+func Track(ctx context.Context, userID uint, endpoint string) {
+	if userID == 0 || endpoint == "" {
+		return
+	}
+	now := clock.Now().UTC()
+	key := userKey{tenant: tenancy.From(ctx), userID: userID, day: now.Format("2006-01-02"), endpoint: endpoint}
+
+	mu.Lock()
+	defer mu.Unlock()
+	c, ok := pending[key]
+	if !ok {
+		c = &counter{}
+		pending[key] = c
+	}
+	c.count++
+	c.lastSeen = now
+}
+
+// Pending devuelve las peticiones del usuario de hoy que aún no se han volcado
+func Pending(ctx context.Context, userID uint) int64 {
+	day := clock.Now().UTC().Format("2006-01-02")
+	tenant := tenancy.From(ctx)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var total int64
+	for k, c := range pending {
+		if k.tenant == tenant && k.userID == userID && k.day == day {
+			total += c.count
+		}
+	}
+	return total
+}
+
+// TrackKey acumula en memoria una petición autenticada con la clave de API indicada
+func TrackKey(ctx context.Context, keyID uint, endpoint string) {
+	if keyID == 0 || endpoint == "" {
+		return
+	}
+	now := clock.Now().UTC()
+	key := apiKeyKey{tenant: tenancy.From(ctx), keyID: keyID, day: now.Format("2006-01-02"), endpoint: endpoint}
+
+	mu.Lock()
+	defer mu.Unlock()
+	c, ok := pendingKey[key]
+	if !ok {
+		c = &counter{}
+		pendingKey[key] = c
+	}
+	c.count++
+	c.lastSeen = now
+}
+
+// Start vuelca periódicamente los contadores acumulados a la base de datos
+func Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				Flush()
+				return
+			case <-t.C:
+				Flush()
+			}
+		}
+	}()
+}
+
+// Flush escribe los contadores pendientes sumándolos a los existentes, en el
+// esquema de cada tenant. Si la escritura falla, los contadores vuelven a la
+// cola para el siguiente volcado.
+func Flush() {
+	mu.Lock()
+	batch, keyBatch := pending, pendingKey
+	pending, pendingKey = map[userKey]*counter{}, map[apiKeyKey]*counter{}
+	mu.Unlock()
+
+	for tenant, batch := range byTenant(batch, func(k userKey) string { return k.tenant }) {
+		if err := flushUsers(tenancy.With(context.Background(), tenant), batch); err != nil {
+			log.Printf("⚠️  Error guardando métricas de uso, se reintentará: %v", err)
+			requeue(&pending, batch)
+		}
+	}
+	for tenant, batch := range byTenant(keyBatch, func(k apiKeyKey) string { return k.tenant }) {
+		if err := flushKeys(tenancy.With(context.Background(), tenant), batch); err != nil {
+			log.Printf("⚠️  Error guardando métricas de uso de claves de API, se reintentará: %v", err)
+			requeue(&pendingKey, batch)
+		}
+	}
+}
+
+// byTenant separa un lote por tenant
+func byTenant[K comparable](batch map[K]*counter, tenant func(K) string) map[string]map[K]*counter {
+	groups := map[string]map[K]*counter{}
+	for k, c := range batch {
+		t := tenant(k)
+		if groups[t] == nil {
+			groups[t] = map[K]*counter{}
+		}
+		groups[t][k] = c
+	}
+	return groups
+}
+
+// requeue suma un lote no guardado a los contadores pendientes actuales
+func requeue[K comparable](pendingMap *map[K]*counter, batch map[K]*counter) {
+	mu.Lock()
+	defer mu.Unlock()
+	dst := *pendingMap
+	for k, c := range batch {
+		current, ok := dst[k]
+		if !ok {
+			dst[k] = c
+			continue
+		}
+		current.count += c.count
+		if c.lastSeen.After(current.lastSeen) {
+			current.lastSeen = c.lastSeen
+		}
+	}
+}
+
+func flushUsers(ctx context.Context, batch map[userKey]*counter) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	rows := make([]database.UserUsage, 0, len(batch))
+	lastSeen := map[uint]time.Time{}
+	for k, c := range batch {
+		rows = append(rows, database.UserUsage{
+			UserID: k.userID, Day: k.day, Endpoint: k.endpoint, Count: c.count, LastSeenAt: c.lastSeen,
+		})
+		if c.lastSeen.After(lastSeen[k.userID]) {
+			lastSeen[k.userID] = c.lastSeen
+		}
+	}
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "day"}, {Name: "endpoint"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "count"}, Value: gorm.Expr("user_usages.count + excluded.count")},
+				{Column: clause.Column{Name: "last_seen_at"}, Value: gorm.Expr("excluded.last_seen_at")},
+			},
+		}).CreateInBatches(rows, 500).Error; err != nil {
+			return err
+		}
+		for userID, seen := range lastSeen {
+			if err := tx.Model(&database.User{}).Where("id = ?", userID).
+				UpdateColumn("last_activity_at", seen).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func flushKeys(ctx context.Context, batch map[apiKeyKey]*counter) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	rows := make([]database.APIKeyUsage, 0, len(batch))
+	lastUsed := map[uint]time.Time{}
+	for k, c := range batch {
+		rows = append(rows, database.APIKeyUsage{
+			APIKeyID: k.keyID, Day: k.day, Endpoint: k.endpoint, Count: c.count, LastSeenAt: c.lastSeen,
+		})
+		if c.lastSeen.After(lastUsed[k.keyID]) {
+			lastUsed[k.keyID] = c.lastSeen
+		}
+	}
+
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "api_key_id"}, {Name: "day"}, {Name: "endpoint"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "count"}, Value: gorm.Expr("api_key_usages.count + excluded.count")},
+				{Column: clause.Column{Name: "last_seen_at"}, Value: gorm.Expr("excluded.last_seen_at")},
+			},
+		}).CreateInBatches(rows, 500).Error; err != nil {
+			return err
+		}
+		for keyID, used := range lastUsed {
+			if err := tx.Model(&database.APIKey{}).Where("id = ?", keyID).
+				UpdateColumn("last_used_at", used).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+// Package useragent extrae del agente de usuario el navegador, el sistema
+// operativo y el tipo de dispositivo. No pretende cubrir todos los casos: basta
+// con reconocer los clientes habituales para agrupar los inicios de sesión por
+// dispositivo.
+package useragent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Tipos de dispositivo
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Bot     = "bot"
+	Unknown = "unknown"
+)
+
+// Info datos reconocidos en un agente de usuario
+type Info struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	Type    string `json:"type"`
+}
+
+// Fingerprint identifica el dispositivo sin depender de las versiones, para
+// que una actualización del navegador no cuente como un dispositivo nuevo
+func (i Info) Fingerprint() string {
+	sum := sha256.Sum256([]byte(i.Browser + "|" + i.OS + "|" + i.Type))
+	return hex.EncodeToString(sum[:])
+}
+
+// String descripción legible, p. ej. "Firefox en Windows"
+func (i Info) String() string {
+	return i.Browser + " en " + i.OS
+}
+
+// Las reglas se comprueban en orden: varios navegadores incluyen en su agente
+// el nombre de otros (Edge y Opera dicen ser Chrome, Chrome dice ser Safari...)
+var browsers = []struct{ token, name string }{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"yabrowser/", "Yandex"},
+	{"vivaldi/", "Vivaldi"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chromium/", "Chromium"},
+	{"chrome/", "Chrome"},
+	{"safari/", "Safari"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"postmanruntime/", "Postman"},
+	{"okhttp/", "OkHttp"},
+	{"python-requests/", "Python Requests"},
+	{"go-http-client/", "Go"},
+}
+
+var systems = []struct{ token, name string }{
+	{"windows phone", "Windows Phone"},
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iPadOS"},
+	{"ipod", "iOS"},
+	{"cros", "ChromeOS"},
+	{"android", "Android"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+var bots = []string{"bot", "crawler", "spider", "slurp", "headless"}
+
+// Parse analiza un agente de usuario; los datos que no se reconocen quedan
+// como "Desconocido" (o Unknown en el tipo)
+func Parse(ua string) Info {
+	s := strings.ToLower(ua)
+	info := Info{Browser: "Desconocido", OS: "Desconocido", Type: Unknown}
+	if strings.TrimSpace(s) == "" {
+		return info
+	}
+
+	for _, b := range browsers {
+		if strings.Contains(s, b.token) {
+			info.Browser = b.name
+			break
+		}
+	}
+	for _, o := range systems {
+		if strings.Contains(s, o.token) {
+			info.OS = o.name
+			break
+		}
+	}
+
+	switch {
+	case containsAny(s, bots):
+		info.Type = Bot
+	case containsAny(s, []string{"ipad", "tablet"}) ||
+		(strings.Contains(s, "android") && !strings.Contains(s, "mobile")):
+		info.Type = Tablet
+	case containsAny(s, []string{"mobile", "iphone", "ipod", "windows phone"}):
+		info.Type = Mobile
+	case info.OS != "Desconocido":
+		info.Type = Desktop
+	}
+	return info
+}
+
+func containsAny(s string, tokens []string) bool {
+	for _, t := range tokens {
+		if strings.Contains(s, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want Info
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			Info{"Chrome", "Windows", Desktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			Info{"Edge", "Windows", Desktop},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+			Info{"Safari", "macOS", Desktop},
+		},
+		{
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			Info{"Firefox", "Linux", Desktop},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			Info{"Chrome", "iOS", Mobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			Info{"Chrome", "Android", Mobile},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			Info{"Chrome", "Android", Tablet},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			Info{"Safari", "iPadOS", Tablet},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			Info{"Desconocido", "Desconocido", Bot},
+		},
+		{"curl/8.4.0", Info{"curl", "Desconocido", Unknown}},
+		{"", Info{"Desconocido", "Desconocido", Unknown}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.ua); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, se esperaba %+v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprintIgnoresVersions(t *testing.T) {
+	a := Parse("Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0")
+	b := Parse("Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0")
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("una actualización del navegador no debería cambiar la huella")
+	}
+	if a.Fingerprint() == Parse("Mozilla/5.0 (X11; Linux x86_64) Chrome/120.0.0.0 Safari/537.36").Fingerprint() {
+		t.Error("navegadores distintos deberían tener huellas distintas")
+	}
+}
@@ -0,0 +1,118 @@
+// Package validation registra en el validador de Gin las reglas propias de la
+// API. Las usan las etiquetas binding de los handlers y las validaciones de
+// GraphQL y gRPC, que comparten el mismo motor:
+//
+//	phone            número de teléfono en formato E.164 (+34600111222)
+//	strong_password  8-72 caracteres con minúscula, mayúscula y dígito
+//	username         3-32 caracteres: minúsculas, dígitos, punto, guion y guion bajo
+//	not_disposable   email cuyo dominio no es de correo desechable
+package validation
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// bcrypt ignora lo que pasa de 72 bytes, así que no se admiten contraseñas más largas
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,30}[a-z0-9]$`)
+
+// disposableDomains dominios de correo desechable más habituales; se pueden
+// añadir más con DISPOSABLE_EMAIL_DOMAINS (separados por comas)
+var disposableDomains = map[string]bool{
+	"10minutemail.com": true, "20minutemail.com": true, "dispostable.com": true,
+	"emailondeck.com": true, "fakeinbox.com": true, "getairmail.com": true,
+	"getnada.com": true, "guerrillamail.com": true, "guerrillamail.net": true,
+	"maildrop.cc": true, "mailinator.com": true, "mailnesia.com": true,
+	"mintemail.com": true, "mohmal.com": true, "moakt.com": true,
+	"sharklasers.com": true, "spamgourmet.com": true, "temp-mail.org": true,
+	"tempmail.com": true, "tempmailo.com": true, "throwawaymail.com": true,
+	"trashmail.com": true, "yopmail.com": true, "yopmail.net": true,
+}
+
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	Register(engine)
+}
+
+// Register añade las reglas al validador indicado
+func Register(v *validator.Validate) {
+	v.RegisterAlias("phone", "e164")
+	rules := map[string]validator.Func{
+		"strong_password": strongPassword,
+		"username":        username,
+		"not_disposable":  notDisposable,
+	}
+	for tag, fn := range rules {
+		if err := v.RegisterValidation(tag, fn); err != nil {
+			log.Fatalf("❌ No se pudo registrar la validación %s: %v", tag, err)
+		}
+	}
+}
+
+// StrongPassword indica si la contraseña cumple la política de la API
+func StrongPassword(password string) bool {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return false
+	}
+	var lower, upper, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return lower && upper && digit
+}
+
+// Username indica si el nombre de usuario tiene un formato válido
+func Username(name string) bool {
+	return usernamePattern.MatchString(name)
+}
+
+// Disposable indica si el email pertenece a un dominio de correo desechable
+func Disposable(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+	if disposableDomains[domain] {
+		return true
+	}
+	for _, extra := range strings.Split(os.Getenv("DISPOSABLE_EMAIL_DOMAINS"), ",") {
+		if extra = strings.ToLower(strings.TrimSpace(extra)); extra != "" && extra == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func strongPassword(fl validator.FieldLevel) bool {
+	return StrongPassword(fl.Field().String())
+}
+
+func username(fl validator.FieldLevel) bool {
+	return Username(fl.Field().String())
+}
+
+func notDisposable(fl validator.FieldLevel) bool {
+	return !Disposable(fl.Field().String())
+}
@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestRules(t *testing.T) {
+	t.Setenv("DISPOSABLE_EMAIL_DOMAINS", "desechable.test, otro.test")
+	v := validator.New()
+	Register(v)
+
+	tests := []struct {
+		rule  string
+		value string
+		valid bool
+	}{
+		{"phone", "+34600111222", true},
+		{"phone", "600111222", false},
+		{"phone", "+34 600 111 222", false},
+		{"strong_password", "Secreto123", true},
+		{"strong_password", "secreto123", false},
+		{"strong_password", "SECRETO123", false},
+		{"strong_password", "Secretos", false},
+		{"strong_password", "Sec123", false},
+		{"strong_password", "Aa1" + strings.Repeat("a", 70), false},
+		{"username", "ana.garcia_1", true},
+		{"username", "ab", false},
+		{"username", "Ana", false},
+		{"username", "ana garcia", false},
+		{"username", "-ana", false},
+		{"not_disposable", "ana@example.com", true},
+		{"not_disposable", "ana@Mailinator.com", false},
+		{"not_disposable", "ana@otro.test", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+"/"+tt.value, func(t *testing.T) {
+			if err := v.Var(tt.value, tt.rule); (err == nil) != tt.valid {
+				t.Errorf("%s(%q) válido = %v, se esperaba %v", tt.rule, tt.value, err == nil, tt.valid)
+			}
+		})
+	}
+}
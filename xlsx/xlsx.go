@@ -0,0 +1,341 @@
+// Package xlsx escribe libros de Excel (Office Open XML) fila a fila, sin
+// cargarlos en memoria: cada hoja se comprime en el ZIP según se escribe. Solo
+// cubre lo que necesitan los informes: columnas con tipo, cabecera con estilo
+// y fija al desplazarse, y varias hojas por libro.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType tipo de los valores de una columna
+type ColumnType int
+
+const (
+	// String texto (cualquier valor se escribe con fmt.Sprint)
+	String ColumnType = iota
+	// Number enteros o decimales
+	Number
+	// Bool verdadero o falso
+	Bool
+	// Date fecha y hora (time.Time o *time.Time), mostrada en UTC
+	Date
+)
+
+// Column columna de una hoja; Width en caracteres (0 = ancho por defecto)
+type Column struct {
+	Header string
+	Type   ColumnType
+	Width  float64
+}
+
+// Estilos de celda definidos en styles.xml
+const (
+	styleHeader = 1
+	styleDate   = 2
+)
+
+// maxSheetName longitud máxima del nombre de una hoja en Excel
+const maxSheetName = 31
+
+// Writer libro en escritura; las hojas se añaden de una en una y el libro se
+// completa con Close
+type Writer struct {
+	zw     *zip.Writer
+	sheets []string
+	// current hoja abierta: se cierra al añadir la siguiente o el libro
+	current *Sheet
+	closed  bool
+}
+
+// NewWriter empieza un libro que se escribe en w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w)}
+}
+
+// Sheet hoja en escritura
+type Sheet struct {
+	w       *bufio.Writer
+	columns []Column
+	rows    int
+	// row fila en preparación: solo se escribe si todas sus celdas son válidas
+	row bytes.Buffer
+}
+
+// AddSheet cierra la hoja anterior y empieza una nueva con la fila de
+// cabecera de columns. El nombre debe ser único y válido en Excel.
+func (w *Writer) AddSheet(name string, columns []Column) (*Sheet, error) {
+	if w.closed {
+		return nil, errors.New("xlsx: el libro ya está cerrado")
+	}
+	if err := validSheetName(name); err != nil {
+		return nil, err
+	}
+	for _, existing := range w.sheets {
+		if strings.EqualFold(existing, name) {
+			return nil, fmt.Errorf("xlsx: la hoja %q ya existe", name)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("xlsx: la hoja necesita al menos una columna")
+	}
+	if err := w.finishSheet(); err != nil {
+		return nil, err
+	}
+
+	entry, err := w.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)+1))
+	if err != nil {
+		return nil, err
+	}
+	w.sheets = append(w.sheets, name)
+	s := &Sheet{w: bufio.NewWriter(entry), columns: columns}
+
+	s.w.WriteString(xml.Header)
+	s.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// La cabecera queda fija al desplazarse
+	s.w.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	s.w.WriteString(`<cols>`)
+	for i, col := range columns {
+		width := col.Width
+		if width <= 0 {
+			width = math.Max(10, float64(len([]rune(col.Header)))+2)
+		}
+		fmt.Fprintf(s.w, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+	}
+	s.w.WriteString(`</cols><sheetData>`)
+
+	s.rows = 1
+	s.w.WriteString(`<row r="1">`)
+	for i, col := range columns {
+		s.writeString(cellRef(i, 1), col.Header, styleHeader)
+	}
+	s.w.Write(s.row.Bytes())
+	s.w.WriteString(`</row>`)
+	w.current = s
+	return s, nil
+}
+
+// WriteRow añade una fila con un valor por columna, del tipo de la columna;
+// nil deja la celda vacía
+func (s *Sheet) WriteRow(values ...interface{}) error {
+	if len(values) > len(s.columns) {
+		return fmt.Errorf("xlsx: %d valores para %d columnas", len(values), len(s.columns))
+	}
+	s.row.Reset()
+	for i, value := range values {
+		if err := s.writeCell(i, s.rows+1, value); err != nil {
+			return fmt.Errorf("xlsx: columna %q: %w", s.columns[i].Header, err)
+		}
+	}
+	s.rows++
+	fmt.Fprintf(s.w, `<row r="%d">`, s.rows)
+	s.w.Write(s.row.Bytes())
+	_, err := s.w.WriteString(`</row>`)
+	return err
+}
+
+func (s *Sheet) writeCell(col, row int, value interface{}) error {
+	ref := cellRef(col, row)
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		value = *v
+	case *string:
+		if v == nil {
+			return nil
+		}
+		value = *v
+	case *uint:
+		if v == nil {
+			return nil
+		}
+		value = *v
+	}
+
+	switch s.columns[col].Type {
+	case Number:
+		n, err := number(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&s.row, `<c r="%s"><v>%s</v></c>`, ref, n)
+	case Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("se esperaba un bool y no %T", value)
+		}
+		v := "0"
+		if b {
+			v = "1"
+		}
+		fmt.Fprintf(&s.row, `<c r="%s" t="b"><v>%s</v></c>`, ref, v)
+	case Date:
+		t, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("se esperaba una fecha y no %T", value)
+		}
+		if t.IsZero() {
+			return nil
+		}
+		fmt.Fprintf(&s.row, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleDate, strconv.FormatFloat(serial(t), 'f', -1, 64))
+	default:
+		s.writeString(ref, fmt.Sprint(value), 0)
+	}
+	return nil
+}
+
+// writeString escribe el texto en la propia celda (inlineStr): no hace falta
+// la tabla de cadenas compartidas, que obligaría a guardarlas todas en memoria
+func (s *Sheet) writeString(ref, text string, style int) {
+	s.row.WriteString(`<c r="` + ref + `" t="inlineStr"`)
+	if style != 0 {
+		fmt.Fprintf(&s.row, ` s="%d"`, style)
+	}
+	s.row.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(&s.row, []byte(text))
+	s.row.WriteString(`</t></is></c>`)
+}
+
+func (w *Writer) finishSheet() error {
+	if w.current == nil {
+		return nil
+	}
+	s := w.current
+	w.current = nil
+	s.w.WriteString(`</sheetData></worksheet>`)
+	return s.w.Flush()
+}
+
+// Close termina la hoja abierta y escribe las partes comunes del libro. No
+// cierra el io.Writer de destino.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.sheets) == 0 {
+		return errors.New("xlsx: el libro necesita al menos una hoja")
+	}
+	if err := w.finishSheet(); err != nil {
+		return err
+	}
+
+	var workbook, rels, types strings.Builder
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	types.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i, name := range w.sheets {
+		n := i + 1
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		fmt.Fprintf(&workbook, `" sheetId="%d" r:id="rId%d"/>`, n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+	}
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`, len(w.sheets)+1)
+	types.WriteString(`</Types>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", styles},
+	}
+	for _, part := range parts {
+		f, err := w.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return w.zw.Close()
+}
+
+// styles estilo 1: cabecera en negrita sobre gris con borde inferior; estilo
+// 2: fecha y hora. Los dos primeros rellenos son los reservados por Excel.
+const styles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFD9D9D9"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="2"><border><left/><right/><top/><bottom/><diagonal/></border>` +
+	`<border><left/><right/><top/><bottom style="thin"><color auto="1"/></bottom><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="1" xfId="0" applyFont="1" applyFill="1" applyBorder="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
+
+func validSheetName(name string) error {
+	if name == "" || len([]rune(name)) > maxSheetName || strings.ContainsAny(name, `[]:*?/\`) ||
+		strings.HasPrefix(name, "'") || strings.HasSuffix(name, "'") {
+		return fmt.Errorf("xlsx: nombre de hoja no válido: %q", name)
+	}
+	return nil
+}
+
+// cellRef referencia de la celda (A1, B7, AA3...) de la columna col (desde 0)
+// y la fila row (desde 1)
+func cellRef(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// excelEpoch día 0 de las fechas de Excel (contando su 29/02/1900 inexistente)
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// serial convierte la fecha al número de días (con fracción) que usa Excel
+func serial(t time.Time) float64 {
+	d := t.UTC().Sub(excelEpoch)
+	return math.Round(d.Seconds()) / 86400
+}
+
+func number(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", errors.New("número no finito")
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("se esperaba un número y no %T", value)
+}
@@ -0,0 +1,124 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// part lee una parte del libro generado
+func part(t *testing.T, zr *zip.Reader, name string) string {
+	t.Helper()
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatalf("falta %s: %v", name, err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	return string(data)
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	users, err := w.AddSheet("Usuarios", []Column{
+		{Header: "ID", Type: Number},
+		{Header: "Nombre"},
+		{Header: "Activo", Type: Bool},
+		{Header: "Alta", Type: Date},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2026, 7, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	if err := users.WriteRow(uint(7), "Ana <&> García", true, created); err != nil {
+		t.Fatal(err)
+	}
+	var never *time.Time
+	if err := users.WriteRow(8, nil, false, never); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.WriteRow("siete"); err == nil {
+		t.Error("un texto en una columna numérica debe fallar")
+	}
+	if _, err := w.AddSheet("usuarios", []Column{{Header: "x"}}); err == nil {
+		t.Error("los nombres de hoja no distinguen mayúsculas y no pueden repetirse")
+	}
+	if _, err := w.AddSheet("Cambios/2026", []Column{{Header: "x"}}); err == nil {
+		t.Error("el nombre de la hoja no puede contener /")
+	}
+	changes, err := w.AddSheet("Cambios", []Column{{Header: "Campo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes.WriteRow("email")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if doc := part(t, zr, name); xml.Unmarshal([]byte(doc), new(struct{})) != nil {
+			t.Errorf("%s no es XML válido: %s", name, doc)
+		}
+	}
+	if wb := part(t, zr, "xl/workbook.xml"); !strings.Contains(wb, `<sheet name="Usuarios" sheetId="1" r:id="rId1"/><sheet name="Cambios" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("workbook.xml = %s", wb)
+	}
+
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				Ref   string `xml:"r,attr"`
+				Type  string `xml:"t,attr"`
+				Style int    `xml:"s,attr"`
+				Value string `xml:"v"`
+				Text  string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal([]byte(part(t, zr, "xl/worksheets/sheet1.xml")), &sheet); err != nil {
+		t.Fatal(err)
+	}
+	// La fila con un valor no válido no se escribe
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("filas = %d, se esperaban 3", len(sheet.Rows))
+	}
+	header := sheet.Rows[0].Cells
+	if len(header) != 4 || header[0].Text != "ID" || header[0].Style != styleHeader || header[3].Ref != "D1" {
+		t.Errorf("cabecera = %+v", header)
+	}
+	row := sheet.Rows[1].Cells
+	if row[0].Value != "7" || row[0].Type != "" {
+		t.Errorf("número = %+v", row[0])
+	}
+	if row[1].Text != "Ana <&> García" || row[1].Type != "inlineStr" {
+		t.Errorf("texto = %+v", row[1])
+	}
+	if row[2].Value != "1" || row[2].Type != "b" {
+		t.Errorf("bool = %+v", row[2])
+	}
+	// 01/07/2026 10:00 UTC
+	if row[3].Value != "46204.416666666664" || row[3].Style != styleDate {
+		t.Errorf("fecha = %+v", row[3])
+	}
+	if cells := sheet.Rows[2].Cells; len(cells) != 2 || cells[0].Ref != "A3" || cells[1].Ref != "C3" || cells[1].Value != "0" {
+		t.Errorf("las celdas nil no se escriben: %+v", cells)
+	}
+}
+
+func TestCellRef(t *testing.T) {
+	for col, want := range map[int]string{0: "A1", 25: "Z1", 26: "AA1", 701: "ZZ1", 702: "AAA1"} {
+		if got := cellRef(col, 1); got != want {
+			t.Errorf("cellRef(%d) = %s, se esperaba %s", col, got, want)
+		}
+	}
+}